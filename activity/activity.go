@@ -0,0 +1,225 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package activity runs a Daisy workflow as a series of activities of an
+// external orchestrator, such as Temporal or Cloud Workflows. Each activity
+// runs a range of steps of the workflow and returns the State of the run,
+// which the orchestrator passes to the next activity. A last activity cleans
+// up:
+//
+//	st := a.Start(executionID)
+//	st, err := a.RunSteps(ctx, st, "create-disk", "create-instance")
+//	...
+//	st, err = a.Cleanup(ctx, st)
+//
+// Activities are idempotent: the steps that finished are not run again, and
+// a retried activity generates the same resource names, see
+// daisy.Workflow.ResumeSteps. The resources a step left when interrupted
+// half-way, e.g. when the worker running the activity crashed, must be
+// deleted before retrying it.
+package activity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+// State is the state of a run, passed from one activity to the next.
+type State struct {
+	// RunID identifies the run, it is the RunID of its workflows.
+	RunID string
+	// Finished are the steps of the workflow that finished.
+	Finished []string `json:",omitempty"`
+	// Pending are the steps of the workflow that did not finish yet, as of
+	// the last activity.
+	Pending []string `json:",omitempty"`
+	// CleanedUp is set once the resources of the run are deleted.
+	CleanedUp bool `json:",omitempty"`
+}
+
+// Adapter runs the activities of the runs of a workflow.
+type Adapter struct {
+	// NewWorkflow returns the workflow, called for each activity as a
+	// workflow runs once. It must return the same workflow every time.
+	// Workflows with Finally steps are not supported.
+	NewWorkflow func() (*daisy.Workflow, error)
+}
+
+// Start returns the State of a new run identified by runID, e.g. the ID of
+// the execution of the orchestrator.
+func (a *Adapter) Start(runID string) State {
+	return State{RunID: runID}
+}
+
+// RunSteps runs the steps named of the run st that did not finish, and
+// returns the State of the run once they did, or the error of the first
+// failing one. The steps they depend on must have finished or be named.
+// The resources of the run are left for the next activities.
+func (a *Adapter) RunSteps(ctx context.Context, st State, steps ...string) (State, error) {
+	w, err := a.workflow(st)
+	if err != nil {
+		return st, err
+	}
+	if st.CleanedUp {
+		return st, fmt.Errorf("run %s of workflow %q is cleaned up", st.RunID, w.Name)
+	}
+	finished := map[string]bool{}
+	for _, s := range st.Finished {
+		finished[s] = true
+	}
+	run := map[string]bool{}
+	for _, s := range steps {
+		if _, ok := w.Steps[s]; !ok {
+			return st, fmt.Errorf("workflow %q has no step %q", w.Name, s)
+		}
+		if !finished[s] {
+			run[s] = true
+		}
+	}
+	st.Pending = pending(w, finished)
+	if len(run) == 0 {
+		return st, nil
+	}
+	for s := range run {
+		deps := append(append([]string{}, w.Dependencies[s]...), w.Steps[s].DependsOnCompletionOf...)
+		for _, d := range deps {
+			if !finished[d] && !run[d] {
+				return st, fmt.Errorf("step %q depends on step %q, which neither finished nor is run", s, d)
+			}
+		}
+	}
+
+	keep := append([]string{}, st.Finished...)
+	for s := range run {
+		keep = append(keep, s)
+	}
+	if err := w.RunOnly(keep); err != nil {
+		return st, err
+	}
+	if err := w.ResumeSteps(st.Finished); err != nil {
+		return st, err
+	}
+	w.LeaveResources()
+	err = a.run(ctx, w, &st)
+	return st, err
+}
+
+// Cleanup deletes the resources the finished steps of the run st created,
+// as a workflow does once done, and returns the State of the run.
+func (a *Adapter) Cleanup(ctx context.Context, st State) (State, error) {
+	if st.CleanedUp {
+		return st, nil
+	}
+	w, err := a.workflow(st)
+	if err != nil {
+		return st, err
+	}
+	if len(st.Finished) > 0 {
+		if err := w.RunOnly(st.Finished); err != nil {
+			return st, err
+		}
+		if err := w.ResumeSteps(st.Finished); err != nil {
+			return st, err
+		}
+		// The finished steps are not run again, only their resources are
+		// looked up, to be deleted.
+		if err := a.run(ctx, w, &st); err != nil {
+			return st, err
+		}
+	}
+	st.CleanedUp = true
+	return st, nil
+}
+
+// workflow returns the workflow of run st.
+func (a *Adapter) workflow(st State) (*daisy.Workflow, error) {
+	w, err := a.NewWorkflow()
+	if err != nil {
+		return nil, err
+	}
+	if w.Finally != nil {
+		return nil, fmt.Errorf("workflow %q has Finally steps, which activities do not support", w.Name)
+	}
+	w.DeterministicNames = true
+	w.RunID = st.RunID
+	return w, nil
+}
+
+// run runs w, recording the steps that finish in st.
+func (a *Adapter) run(ctx context.Context, w *daisy.Workflow, st *State) error {
+	all := map[string]bool{}
+	for _, s := range st.Pending {
+		all[s] = true
+	}
+	for _, s := range st.Finished {
+		all[s] = true
+	}
+	r := &recorder{workflow: w.Name, st: st}
+	w.SetProgressWriter(r)
+	err := w.Run(ctx)
+
+	finished := map[string]bool{}
+	for _, s := range st.Finished {
+		finished[s] = true
+	}
+	st.Pending = nil
+	for s := range all {
+		if !finished[s] {
+			st.Pending = append(st.Pending, s)
+		}
+	}
+	sort.Strings(st.Pending)
+	return err
+}
+
+// pending returns the steps of w not in finished, sorted.
+func pending(w *daisy.Workflow, finished map[string]bool) []string {
+	var ps []string
+	for s := range w.Steps {
+		if !finished[s] {
+			ps = append(ps, s)
+		}
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+// recorder adds the steps of a workflow that finish to a State, from the
+// progress events of the workflow.
+type recorder struct {
+	workflow string
+	st       *State
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		var e daisy.ProgressEvent
+		if json.Unmarshal(line, &e) != nil || e.Stage != daisy.ProgressStepFinished || e.Workflow != r.workflow {
+			continue
+		}
+		found := false
+		for _, s := range r.st.Finished {
+			found = found || s == e.Step
+		}
+		if !found {
+			r.st.Finished = append(r.st.Finished, e.Step)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,98 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package activity
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+	"github.com/GoogleCloudPlatform/compute-daisy/daisytest"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestAdapter(t *testing.T) {
+	ctx := context.Background()
+	h := daisytest.New()
+	defer h.Close()
+	h.Server.AddImage("debian-cloud", &compute.Image{Name: "debian-11-v1", Family: "debian-11"})
+	h.Server.SetSerialOutput("bootstrap", 1, "BuildSuccess\n")
+	a := &Adapter{NewWorkflow: func() (*daisy.Workflow, error) {
+		return h.NewWorkflow("../daisytest/testdata/build.wf.json")
+	}}
+	count := func() (disks, instances, images int) {
+		return len(h.Server.Disks("test-project", "us-central1-a")), len(h.Server.Instances("test-project", "us-central1-a")), len(h.Server.Images("test-project"))
+	}
+
+	st := a.Start("run")
+	if _, err := a.RunSteps(ctx, st, "create-instance"); err == nil {
+		t.Error("expected error for a step whose dependency did not finish")
+	}
+	if _, err := a.RunSteps(ctx, st, "unknown"); err == nil {
+		t.Error("expected error for an unknown step")
+	}
+
+	st, err := a.RunSteps(ctx, st, "create-disk", "create-instance")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := State{RunID: "run", Finished: []string{"create-disk", "create-instance"}, Pending: []string{"create-image", "stop", "wait"}}
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("got state %+v, want %+v", st, want)
+	}
+	if d, i, _ := count(); d != 1 || i != 1 {
+		t.Errorf("resources not left for the next activities: %d disks, %d instances", d, i)
+	}
+
+	st, err = a.RunSteps(ctx, st, "wait", "stop", "create-image")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(st.Finished) != 5 || len(st.Pending) != 0 {
+		t.Errorf("got state %+v, want every step finished", st)
+	}
+	if d, i, im := count(); d != 1 || i != 1 || im != 1 {
+		t.Errorf("got %d disks, %d instances, %d images, want 1 of each", d, i, im)
+	}
+
+	// Retrying an activity that finished does nothing.
+	calls := len(h.Calls())
+	retried, err := a.RunSteps(ctx, st, "create-image")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(retried, st) {
+		t.Errorf("retry changed the state: got %+v, want %+v", retried, st)
+	}
+	if n := len(h.Calls()); n != calls {
+		t.Errorf("retry made %d API calls", n-calls)
+	}
+
+	st, err = a.Cleanup(ctx, st)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !st.CleanedUp {
+		t.Error("state not cleaned up")
+	}
+	// The image is NoCleanup.
+	if d, i, im := count(); d != 0 || i != 0 || im != 1 {
+		t.Errorf("got %d disks, %d instances, %d images after cleanup, want only the image", d, i, im)
+	}
+	if _, err := a.RunSteps(ctx, st, "create-disk"); err == nil {
+		t.Error("expected error for a run cleaned up")
+	}
+}
@@ -0,0 +1,49 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// logAPIUsage logs the compute API calls of the run, cleanup included, by
+// project and method, with the calls rejected by rate limits, to help size
+// PollingIntervals and MaxConcurrency for the project quotas.
+func (w *Workflow) logAPIUsage() {
+	if w.ComputeClient == nil {
+		return
+	}
+	usage := w.ComputeClient.APIUsage()
+	for i := 0; i < len(usage); {
+		project := usage[i].Project
+		var calls, rateLimited int
+		var lines []string
+		for ; i < len(usage) && usage[i].Project == project; i++ {
+			u := usage[i]
+			calls += u.Calls
+			rateLimited += u.RateLimited
+			line := fmt.Sprintf("  %s: %d", u.Method, u.Calls)
+			if u.RateLimited > 0 {
+				line += fmt.Sprintf(" (%d rate limited)", u.RateLimited)
+			}
+			lines = append(lines, line)
+		}
+		w.LogWorkflowInfo("Compute API usage in project %q: %d calls, %d rate limited (429):\n%s", project, calls, rateLimited, strings.Join(lines, "\n"))
+		if rateLimited > 0 {
+			w.LogWorkflowInfo("WARNING: %d compute API calls in project %q were rate limited, consider raising PollingIntervals or lowering MaxConcurrency.", rateLimited, project)
+		}
+	}
+}
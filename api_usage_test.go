@@ -0,0 +1,46 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestLogAPIUsage(t *testing.T) {
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).APIUsageFn = func() []daisyCompute.APIUsage {
+		return []daisyCompute.APIUsage{
+			{Project: "p1", Method: "instances.get", Calls: 10, RateLimited: 2},
+			{Project: "p1", Method: "instances.insert", Calls: 3},
+			{Project: "p2", Method: "disks.insert", Calls: 1},
+		}
+	}
+	w.logAPIUsage()
+
+	var got []string
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		got = append(got, e.Message)
+	}
+	want := []string{
+		"Compute API usage in project \"p1\": 13 calls, 2 rate limited (429):\n  instances.get: 10 (2 rate limited)\n  instances.insert: 3",
+		"WARNING: 2 compute API calls in project \"p1\" were rate limited, consider raising PollingIntervals or lowering MaxConcurrency.",
+		"Compute API usage in project \"p2\": 1 calls, 0 rate limited (429):\n  disks.insert: 1",
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("unexpected API usage logs: (-got,+want)\n%s", diffRes)
+	}
+}
@@ -0,0 +1,221 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// ArtifactsNamespace is the guest attribute namespace in which guests
+	// announce the GCS URLs of their artifacts, one per key, see
+	// daisy_artifact and Write-DaisyArtifact. The startup script harness
+	// announces the CollectArtifacts paths it uploads there too.
+	ArtifactsNamespace = "daisy-artifacts"
+
+	// artifactPathsMetadataKey holds the CollectArtifacts paths of an
+	// instance, one per line, and artifactsURLMetadataKey the GCS directory
+	// the startup script harness uploads them to.
+	artifactPathsMetadataKey = "daisy-artifact-paths"
+	artifactsURLMetadataKey  = "daisy-artifacts-url"
+)
+
+// windowsAbsPathRgx matches absolute Windows paths, e.g. C:\Windows\Panther.
+var windowsAbsPathRgx = regexp.MustCompile(`^[A-Za-z]:\\`)
+
+// StepArtifact is a file collected from an instance by a step, see
+// InstanceSignal.CollectArtifacts.
+type StepArtifact struct {
+	Step     string
+	Instance string
+	// URL is the GCS URL of the artifact in the scratch bucket.
+	URL string
+}
+
+// artifactKey returns the ArtifactsNamespace key under which the startup
+// script harness announces the upload of guest path p.
+func artifactKey(p string) string {
+	sum := md5.Sum([]byte(p))
+	return "p" + hex.EncodeToString(sum[:])[:16]
+}
+
+// isGuestAbsPath reports whether p is an absolute Linux or Windows path.
+func isGuestAbsPath(p string) bool {
+	return strings.HasPrefix(p, "/") || windowsAbsPathRgx.MatchString(p)
+}
+
+// artifactsDir returns the scratch directory the artifacts step s collects
+// from instance are copied to.
+func artifactsDir(s *Step, instance string) string {
+	return path.Join(s.w.scratchPath, "artifacts", getAbsoluteName(s.w)+"."+s.name, instance)
+}
+
+// prepareArtifacts sets the instance metadata telling the startup script
+// harness which guest paths to upload, and where, when its script ends.
+func prepareArtifacts(s *Step, project, zone, name string, paths []string) DError {
+	url := fmt.Sprintf("gs://%s/%s", s.w.bucket, artifactsDir(s, name))
+	return updateMetadata(s.computeClient(), project, zone, name, func(md *compute.Metadata) {
+		setMetadataValue(md, artifactPathsMetadataKey, strings.Join(paths, "\n"))
+		setMetadataValue(md, artifactsURLMetadataKey, url)
+	})
+}
+
+// collectArtifacts copies the artifacts the instance announced in
+// ArtifactsNamespace to its scratch artifacts directory, if they are not
+// there already, and records them. Errors are logged, collecting artifacts
+// does not fail the step. Guest paths whose upload was not announced are
+// logged as missing.
+func collectArtifacts(ctx context.Context, s *Step, project, zone, name string, paths []string) {
+	w := s.w
+	resp, err := w.ComputeClient.GetGuestAttributes(project, zone, name, ArtifactsNamespace+"/", "")
+	if err != nil {
+		if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != 404 {
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: error listing artifacts: %v", name, err)
+			return
+		}
+	}
+	announced := map[string]string{}
+	if resp != nil && resp.QueryValue != nil {
+		for _, e := range resp.QueryValue.Items {
+			announced[e.Key] = strings.TrimSpace(e.Value)
+		}
+	}
+	for _, p := range paths {
+		if _, ok := announced[artifactKey(p)]; !ok {
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: artifact %q was not uploaded", name, p)
+		}
+	}
+
+	var keys []string
+	for k := range announced {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	dir := artifactsDir(s, name)
+	for _, k := range keys {
+		url := announced[k]
+		b, o, err := splitGCSPath(url)
+		if err != nil || o == "" {
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: artifact %q is not a GCS object", name, url)
+			continue
+		}
+		if b != w.bucket || !strings.HasPrefix(o, dir+"/") {
+			dst := path.Join(dir, path.Base(o))
+			if err := copyObject(ctx, w.storage(), b, o, w.bucket, dst); err != nil {
+				w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: error collecting artifact %q: %v", name, url, err)
+				continue
+			}
+			url = fmt.Sprintf("gs://%s/%s", w.bucket, dst)
+		}
+		w.recordArtifact(s, name, url)
+	}
+}
+
+// copyObject copies object srcObject of srcBucket to dstObject of dstBucket.
+func copyObject(ctx context.Context, st Storage, srcBucket, srcObject, dstBucket, dstObject string) error {
+	attrs, err := st.Attrs(ctx, srcBucket, srcObject)
+	if err != nil {
+		return err
+	}
+	r, err := st.Get(ctx, srcBucket, srcObject, 0)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return st.Put(ctx, dstBucket, dstObject, attrs.ContentType, r)
+}
+
+// recordArtifact logs the artifact step s collected from instance and adds
+// it to the artifacts of the run.
+func (w *Workflow) recordArtifact(s *Step, instance, url string) {
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: collected artifact %s", instance, url)
+	root := w.root()
+	root.artifactsMx.Lock()
+	defer root.artifactsMx.Unlock()
+	root.artifacts = append(root.artifacts, StepArtifact{Step: getAbsoluteName(w) + "." + s.name, Instance: instance, URL: url})
+}
+
+// Artifacts returns the artifacts the steps of the run collected from
+// instances, see InstanceSignal.CollectArtifacts.
+func (w *Workflow) Artifacts() []StepArtifact {
+	root := w.root()
+	root.artifactsMx.Lock()
+	defer root.artifactsMx.Unlock()
+	return append([]StepArtifact{}, root.artifacts...)
+}
+
+// logArtifacts logs a summary of the artifacts of the run.
+func (w *Workflow) logArtifacts() {
+	for _, a := range w.Artifacts() {
+		w.LogWorkflowInfo("Step %q collected artifact of %q: %s", a.Step, a.Instance, a.URL)
+	}
+}
+
+// artifactsShellFunc returns the shell definition of daisy_upload_artifacts,
+// which the startup script harness runs once its script ends.
+func artifactsShellFunc() string {
+	return fmt.Sprintf(`daisy_upload_artifacts() {
+  local url paths p
+  url=$(curl -sf -H 'Metadata-Flavor: Google' %[1]s/%[2]s) || return 0
+  paths=$(curl -sf -H 'Metadata-Flavor: Google' %[1]s/%[3]s) || return 0
+  while IFS= read -r p; do
+    [ -n "$p" ] || continue
+    if [ ! -e "$p" ]; then
+      echo "Daisy startup script harness: artifact $p not found"
+      continue
+    fi
+    if gsutil -m cp -r "$p" "$url/"; then
+      curl -sf -X PUT --data "$url/$(basename "$p")" -H 'Metadata-Flavor: Google' "%[4]s/%[5]s/p$(printf %%s "$p" | md5sum | cut -c1-16)" >/dev/null
+    fi
+  done <<< "$paths"
+}
+`, metadataAttributesURL, artifactsURLMetadataKey, artifactPathsMetadataKey, guestAttributesURL, ArtifactsNamespace)
+}
+
+// artifactsPowerShellFunc returns the PowerShell definition of
+// Send-DaisyArtifacts, the counterpart of daisy_upload_artifacts.
+func artifactsPowerShellFunc() string {
+	return fmt.Sprintf(`function Send-DaisyArtifacts {
+  try {
+    $url = Invoke-RestMethod -Headers @{'Metadata-Flavor'='Google'} -Uri '%[1]s/%[2]s'
+    $paths = Invoke-RestMethod -Headers @{'Metadata-Flavor'='Google'} -Uri '%[1]s/%[3]s'
+  } catch {
+    return
+  }
+  foreach ($p in ($paths -split "`+"`"+`n")) {
+    if (-not $p) { continue }
+    if (-not (Test-Path $p)) {
+      Write-Host "Daisy startup script harness: artifact $p not found"
+      continue
+    }
+    & gsutil -m cp -r $p "$url/"
+    if ($LASTEXITCODE -eq 0) {
+      $hash = -join ([Security.Cryptography.MD5]::Create().ComputeHash([Text.Encoding]::UTF8.GetBytes($p)) | ForEach-Object { $_.ToString('x2') })
+      Invoke-RestMethod -Method PUT -Body "$url/$(Split-Path $p -Leaf)" -Headers @{'Metadata-Flavor'='Google'} -Uri "%[4]s/%[5]s/p$($hash.Substring(0, 16))" | Out-Null
+    }
+  }
+}
+`, metadataAttributesURL, artifactsURLMetadataKey, artifactPathsMetadataKey, guestAttributesURL, ArtifactsNamespace)
+}
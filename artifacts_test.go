@@ -0,0 +1,96 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestArtifactKey(t *testing.T) {
+	// The harness computes it with: printf %s /var/log/syslog | md5sum | cut -c1-16
+	if got, want := artifactKey("/var/log/syslog"), "pf5fdf6ea0ea92860"; got != want {
+		t.Errorf("artifactKey: got %q, want %q", got, want)
+	}
+}
+
+func TestWaitForSignalCollectArtifacts(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	fs := &FakeStorage{}
+	w.Storage = fs
+	w.bucket = "bucket"
+	w.scratchPath = "scratch"
+	fs.Put(ctx, "other", "results/junit.xml", "text/xml", strings.NewReader("<testsuite/>"))
+	s := &Step{name: "wait", w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+
+	dir := "scratch/artifacts/" + testWf + ".wait/i1"
+	var md map[string]string
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetInstanceFn = func(_, _, _ string) (*compute.Instance, error) {
+		return &compute.Instance{Metadata: &compute.Metadata{}}, nil
+	}
+	c.SetInstanceMetadataFn = func(_, _, _ string, got *compute.Metadata) error {
+		md = computeMetataToMap(*got)
+		return nil
+	}
+	c.GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		return &compute.SerialPortOutput{Contents: "failed\n", Next: start + 1}, nil
+	}
+	var queryPath string
+	c.GetGuestAttributesFn = func(_, _, _, qp, _ string) (*compute.GuestAttributes, error) {
+		queryPath = qp
+		return &compute.GuestAttributes{QueryValue: &compute.GuestAttributesValue{Items: []*compute.GuestAttributesEntry{
+			{Namespace: ArtifactsNamespace, Key: artifactKey("/var/log/syslog"), Value: "gs://bucket/" + dir + "/syslog"},
+			{Namespace: ArtifactsNamespace, Key: "u1", Value: "gs://other/results/junit.xml"},
+			{Namespace: ArtifactsNamespace, Key: "u2", Value: "not a URL"},
+		}}}, nil
+	}
+
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: time.Microsecond, SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"failed"}}, CollectArtifacts: []string{"/var/log/syslog", "/missing"}},
+	}
+	// Artifacts are collected on failure too.
+	if err := si.run(ctx, s); err == nil {
+		t.Fatal("expected FailureMatch error")
+	}
+
+	wantMd := map[string]string{artifactPathsMetadataKey: "/var/log/syslog\n/missing", artifactsURLMetadataKey: "gs://bucket/" + dir}
+	if diffRes := diff(md, wantMd, 0); diffRes != "" {
+		t.Errorf("metadata not as expected: (-got +want)\n%s", diffRes)
+	}
+	if queryPath != ArtifactsNamespace+"/" {
+		t.Errorf("guest attributes queried with %q", queryPath)
+	}
+	want := []StepArtifact{
+		{Step: testWf + ".wait", Instance: "i1", URL: "gs://bucket/" + dir + "/syslog"},
+		{Step: testWf + ".wait", Instance: "i1", URL: "gs://bucket/" + dir + "/junit.xml"},
+	}
+	if diffRes := diff(w.Artifacts(), want, 0); diffRes != "" {
+		t.Errorf("artifacts not as expected: (-got +want)\n%s", diffRes)
+	}
+	if got, ok := fs.Object("bucket", dir+"/junit.xml"); !ok || string(got) != "<testsuite/>" {
+		t.Errorf("artifact not copied to the scratch bucket: %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+// computeClient returns the compute client to make API calls on behalf of s
+// with. The audit log attributes its calls to s.
+func (s *Step) computeClient() daisyCompute.Client {
+	return s.w.ComputeClient.WithAuditCaller(getAbsoluteName(s.w) + "." + s.name)
+}
+
+// computeClient returns the compute client to make API calls on behalf of w
+// with, such as during cleanup. The audit log attributes its calls to w.
+func (w *Workflow) computeClient() daisyCompute.Client {
+	return w.ComputeClient.WithAuditCaller(getAbsoluteName(w))
+}
+
+// resourceClient returns the compute client to delete res with. The audit
+// log attributes its calls to the step deleting res, if any, or to w.
+func (w *Workflow) resourceClient(res *Resource) daisyCompute.Client {
+	if res.deleter != nil {
+		return res.deleter.computeClient()
+	}
+	return w.computeClient()
+}
+
+// setupAuditLog makes the compute client record the mutating API calls of
+// the run to AuditLog. A local file is written as calls are made, a GCS
+// object is uploaded at cleanup.
+func (w *Workflow) setupAuditLog() DError {
+	if w.AuditLog == "" || w.parent != nil {
+		return nil
+	}
+
+	if !strings.HasPrefix(w.AuditLog, "gs://") {
+		f, err := os.Create(w.AuditLog)
+		if err != nil {
+			return Errf("error creating audit log: %v", err)
+		}
+		w.ComputeClient.SetAuditRecorder(daisyCompute.NewAuditLog(f))
+		w.addCleanupHook(func() DError {
+			w.ComputeClient.SetAuditRecorder(nil)
+			return newErr("error closing audit log", f.Close())
+		})
+		return nil
+	}
+
+	bkt, obj, err := splitGCSPath(w.AuditLog)
+	if err != nil {
+		return err
+	}
+	if obj == "" {
+		return Errf("AuditLog %q must be the path of an object", w.AuditLog)
+	}
+	var buf bytes.Buffer
+	w.ComputeClient.SetAuditRecorder(daisyCompute.NewAuditLog(&buf))
+	w.addCleanupHook(func() DError {
+		w.ComputeClient.SetAuditRecorder(nil)
+		err := w.storage().Put(context.Background(), bkt, obj, "application/json", &buf)
+		return newErr("error uploading audit log", err)
+	})
+	return nil
+}
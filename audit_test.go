@@ -0,0 +1,90 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestComputeClientCaller(t *testing.T) {
+	w := testWorkflow()
+	var got []string
+	w.ComputeClient.(*daisyCompute.TestClient).WithAuditCallerFn = func(caller string) daisyCompute.Client {
+		got = append(got, caller)
+		return w.ComputeClient
+	}
+	s := &Step{name: "create", w: w}
+	s.computeClient()
+	w.resourceClient(&Resource{deleter: s})
+	w.resourceClient(&Resource{})
+
+	want := []string{w.Name + ".create", w.Name + ".create", w.Name}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("callers do not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func runCleanupHooks(t *testing.T, w *Workflow) {
+	for _, hook := range w.cleanupHooks {
+		if err := hook(); err != nil {
+			t.Errorf("cleanup hook error: %v", err)
+		}
+	}
+}
+
+func TestSetupAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := testWorkflow()
+	w.cleanupHooks = nil
+	w.AuditLog = filepath.Join(dir, "audit.json")
+	if err := w.setupAuditLog(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runCleanupHooks(t, w)
+	if _, err := os.Stat(w.AuditLog); err != nil {
+		t.Errorf("audit log not created: %v", err)
+	}
+
+	fake := &FakeStorage{}
+	w = testWorkflow()
+	w.cleanupHooks = nil
+	w.Storage = fake
+	w.AuditLog = "gs://bkt/logs/audit.json"
+	if err := w.setupAuditLog(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fake.Object("bkt", "logs/audit.json"); ok {
+		t.Error("audit log uploaded before cleanup")
+	}
+	runCleanupHooks(t, w)
+	if _, ok := fake.Object("bkt", "logs/audit.json"); !ok {
+		t.Error("audit log not uploaded at cleanup")
+	}
+
+	w.AuditLog = "gs://bkt"
+	if err := w.setupAuditLog(); err == nil {
+		t.Error("expected error for bucket without object")
+	}
+}
@@ -0,0 +1,110 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxChangeValueLen is the length values are truncated to in changes.
+const maxChangeValueLen = 40
+
+// ResourceChange describes how a step changed an existing resource, such as
+// the metadata keys UpdateInstancesMetadata added.
+type ResourceChange struct {
+	Step     string
+	Resource string
+	// Changes are the changes of the resource, e.g.
+	// `metadata "foo" added: "bar"` or `sizeGb changed: 10 -> 20`.
+	Changes []string
+}
+
+// recordChange logs the changes step s made to resource and adds them to the
+// changes of the run. Nothing is recorded if changes is empty.
+func (w *Workflow) recordChange(s *Step, stepType, resource string, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	for i, c := range changes {
+		changes[i] = w.redact(c)
+	}
+	w.LogStepInfo(s.name, stepType, "Changed %q:\n  %s", resource, strings.Join(changes, "\n  "))
+	root := w.root()
+	root.changesMx.Lock()
+	defer root.changesMx.Unlock()
+	root.changes = append(root.changes, ResourceChange{Step: getAbsoluteName(w) + "." + s.name, Resource: resource, Changes: changes})
+}
+
+// Changes returns the changes the steps of the run made to existing
+// resources, such as updated instance metadata or resized disks.
+func (w *Workflow) Changes() []ResourceChange {
+	root := w.root()
+	root.changesMx.Lock()
+	defer root.changesMx.Unlock()
+	return append([]ResourceChange{}, root.changes...)
+}
+
+// logChanges logs a summary of the changes of the run.
+func (w *Workflow) logChanges() {
+	for _, c := range w.Changes() {
+		w.LogWorkflowInfo("Step %q changed %q: %s", c.Step, c.Resource, strings.Join(c.Changes, "; "))
+	}
+}
+
+// quoteChangeValue quotes v, truncated to maxChangeValueLen.
+func quoteChangeValue(v string) string {
+	if len(v) > maxChangeValueLen {
+		v = v[:maxChangeValueLen] + "..."
+	}
+	return fmt.Sprintf("%q", v)
+}
+
+// mapChanges describes the keys of a map named kind, such as labels or
+// scheduling options, added, changed or removed between before and after,
+// sorted by key. The values are only described if withValues is set, not for
+// maps such as metadata whose values can hold scripts or secrets.
+func mapChanges(kind string, before, after map[string]string, withValues bool) []string {
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inBefore && withValues:
+			changes = append(changes, fmt.Sprintf("%s %q added: %s", kind, k, quoteChangeValue(a)))
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("%s %q added", kind, k))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("%s %q removed", kind, k))
+		case a != b && withValues:
+			changes = append(changes, fmt.Sprintf("%s %q changed: %s -> %s", kind, k, quoteChangeValue(b), quoteChangeValue(a)))
+		case a != b:
+			changes = append(changes, fmt.Sprintf("%s %q changed", kind, k))
+		}
+	}
+	return changes
+}
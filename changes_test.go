@@ -0,0 +1,79 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestMapChanges(t *testing.T) {
+	long := strings.Repeat("a", maxChangeValueLen+1)
+	got := mapChanges("labels",
+		map[string]string{"same": "1", "changed": "old", "removed": "x"},
+		map[string]string{"same": "1", "changed": "new", "added": long}, true)
+	want := []string{
+		fmt.Sprintf(`labels "added" added: %q`, long[:maxChangeValueLen]+"..."),
+		`labels "changed" changed: "old" -> "new"`,
+		`labels "removed" removed`,
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("changes not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	got = mapChanges("metadata", map[string]string{"changed": "old", "removed": "x"}, map[string]string{"changed": "new", "added": "secret"}, false)
+	want = []string{`metadata "added" added`, `metadata "changed" changed`, `metadata "removed" removed`}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("changes without values not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	if got := mapChanges("labels", map[string]string{"a": "b"}, map[string]string{"a": "b"}, true); got != nil {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
+
+func TestUpdateInstancesMetadataRecordsChanges(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+	w.sensitiveValues = []string{"secret"}
+
+	value := "old"
+	w.ComputeClient = &daisyCompute.TestClient{
+		GetInstanceFn: func(_, _, _ string) (*compute.Instance, error) {
+			return &compute.Instance{Metadata: &compute.Metadata{Items: []*compute.MetadataItems{{Key: "key1", Value: &value}}}}, nil
+		},
+		SetInstanceMetadataFn: func(_, _, _ string, _ *compute.Metadata) error { return nil },
+	}
+	sm := &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key1": "new", "key2": "secret"}}}
+	if err := sm.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []ResourceChange{{
+		Step:     getAbsoluteName(w) + ".s",
+		Resource: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance),
+		Changes:  []string{`metadata "key1" changed`, `metadata "key2" added`},
+	}}
+	if diffRes := diff(w.Changes(), want, 0); diffRes != "" {
+		t.Errorf("changes not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
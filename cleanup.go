@@ -0,0 +1,193 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cleanupProgressInterval is how often cleanup logs that it is still running.
+var cleanupProgressInterval = 30 * time.Second
+
+// detachedContext carries the values of its parent but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// detachContext returns a context with the values of ctx that is never
+// canceled. API clients are created with it so that their credentials still
+// work during cleanup once the context passed to Run is canceled.
+func detachContext(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// cancelOnDone cancels w when ctx is done, until stop is called.
+func (w *Workflow) cancelOnDone(ctx context.Context) (stop func()) {
+	stopc := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-stopc:
+			default:
+				w.CancelWithReason("is canceled: " + ctx.Err().Error())
+			}
+		case <-stopc:
+		}
+	}()
+	return func() { close(stopc) }
+}
+
+// runCleanupHooks runs the cleanup hooks of w, logging progress while they
+// run. If they take longer than CleanupTimeout, it logs the resources left
+// and returns without waiting for them.
+func (w *Workflow) runCleanupHooks() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, hook := range w.cleanupHooks {
+			if err := hook(); err != nil {
+				w.LogWorkflowInfo("Error returned from cleanup hook: %s", err)
+			}
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if w.cleanupTimeout > 0 {
+		t := time.NewTimer(w.cleanupTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	ticker := time.NewTicker(cleanupProgressInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			w.LogWorkflowInfo("Workflow %q still cleaning up after %s, %d resources left.", w.Name, time.Since(start).Round(time.Second), len(w.undeletedResources()))
+		case <-timeout:
+			left := w.undeletedResources()
+			if len(left) == 0 {
+				w.LogWorkflowInfo("Workflow %q cleanup did not finish within CleanupTimeout %s.", w.Name, w.CleanupTimeout)
+			} else {
+				w.LogWorkflowInfo("Workflow %q cleanup did not finish within CleanupTimeout %s, resources left: %s", w.Name, w.CleanupTimeout, strings.Join(left, ", "))
+			}
+			return
+		}
+	}
+}
+
+// undeletedResources returns the resources created by w that cleanup should
+// delete and are not deleted yet, as "type name".
+func (w *Workflow) undeletedResources() []string {
+	var left []string
+	for _, r := range w.Resources() {
+		if r.Created && !r.Deleted && !r.External && (!r.NoCleanup || w.forceCleanup) {
+			left = append(left, fmt.Sprintf("%s %q", r.Type, r.Name))
+		}
+	}
+	return left
+}
+
+// InterruptHandler cancels workflows when the process is interrupted, see
+// HandleInterrupts.
+type InterruptHandler struct {
+	c           chan os.Signal
+	stop        chan struct{}
+	stopOnce    sync.Once
+	mx          sync.Mutex
+	interrupted bool
+	ws          []*Workflow
+}
+
+// HandleInterrupts cancels ws when the process receives SIGINT, e.g. Ctrl-C,
+// or SIGTERM, so that Run cleans up the resources of each workflow before
+// returning instead of the process exiting halfway. Progress is written to
+// out. Later signals are reported and otherwise ignored while cleanup runs;
+// set CleanupTimeout to bound it. Call Stop once the workflows are done.
+func HandleInterrupts(out io.Writer, ws ...*Workflow) *InterruptHandler {
+	h := &InterruptHandler{c: make(chan os.Signal, 1), stop: make(chan struct{}), ws: ws}
+	signal.Notify(h.c, os.Interrupt, syscall.SIGTERM)
+	go h.watch(out)
+	return h
+}
+
+// Add cancels w too when the process is interrupted, right away if it
+// already was, e.g. for the workflows of the runs of a Repeat.
+func (h *InterruptHandler) Add(w *Workflow) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.ws = append(h.ws, w)
+	if h.interrupted {
+		w.CancelWithReason("is canceled by an interrupt")
+	}
+}
+
+func (h *InterruptHandler) watch(out io.Writer) {
+	for {
+		select {
+		case sig := <-h.c:
+			h.mx.Lock()
+			first := !h.interrupted
+			h.interrupted = true
+			ws := h.ws
+			h.mx.Unlock()
+			if !first {
+				fmt.Fprintf(out, "\n%s caught, waiting for cleanup to finish...\n", sig)
+				continue
+			}
+			for _, w := range ws {
+				fmt.Fprintf(out, "\n%s caught, canceling %q and cleaning up its resources...\n", sig, w.Name)
+				w.CancelWithReason("is canceled by an interrupt")
+			}
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// Interrupted reports whether the process received a signal since
+// HandleInterrupts.
+func (h *InterruptHandler) Interrupted() bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.interrupted
+}
+
+// Stop stops handling signals. Safe to call multiple times.
+func (h *InterruptHandler) Stop() {
+	h.stopOnce.Do(func() {
+		signal.Stop(h.c)
+		close(h.stop)
+	})
+}
@@ -0,0 +1,135 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+func TestDetachContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "value"))
+	cancel()
+	got := detachContext(ctx)
+	if got.Err() != nil || got.Done() != nil {
+		t.Error("detached context is canceled")
+	}
+	if got.Value(testContextKey{}) != "value" {
+		t.Error("detached context lost the values of its parent")
+	}
+}
+
+func TestCancelOnDone(t *testing.T) {
+	w := testWorkflow()
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := w.cancelOnDone(ctx)
+	defer stop()
+	cancel()
+	select {
+	case <-w.Cancel:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workflow not canceled")
+	}
+	if got, want := w.getCancelReason(), "is canceled: context canceled"; got != want {
+		t.Errorf("cancel reason = %q, want %q", got, want)
+	}
+
+	w = testWorkflow()
+	ctx, cancel = context.WithCancel(context.Background())
+	w.cancelOnDone(ctx)()
+	cancel()
+	select {
+	case <-w.Cancel:
+		t.Error("workflow canceled after stop")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRunCleanupHooks(t *testing.T) {
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	w.disks.m = map[string]*Resource{
+		"d1": {RealName: "d1", creator: s, createdInWorkflow: true},
+		"d2": {RealName: "d2", creator: s, createdInWorkflow: true, deleted: true},
+		"d3": {RealName: "d3", creator: s, createdInWorkflow: true, NoCleanup: true},
+	}
+	block := make(chan struct{})
+	defer close(block)
+	w.cleanupHooks = []func() DError{func() DError {
+		<-block
+		return nil
+	}}
+	w.CleanupTimeout = "10ms"
+	w.cleanupTimeout = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		w.runCleanupHooks()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleanup did not return after CleanupTimeout")
+	}
+
+	var found bool
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		if strings.Contains(e.Message, "did not finish within CleanupTimeout 10ms, resources left: disk \"d1\"") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("timeout not logged with the resources left: %v", w.Logger.(*MockLogger).getEntries())
+	}
+}
+
+func TestHandleInterrupts(t *testing.T) {
+	w1 := testWorkflow()
+	w2 := testWorkflow()
+	var out bytes.Buffer
+	h := HandleInterrupts(&out, w1, w2)
+	if h.Interrupted() {
+		t.Error("Interrupted before any signal")
+	}
+	h.c <- os.Interrupt
+	for _, w := range []*Workflow{w1, w2} {
+		select {
+		case <-w.Cancel:
+		case <-time.After(5 * time.Second):
+			t.Fatal("workflow not canceled")
+		}
+		if got, want := w.getCancelReason(), "is canceled by an interrupt"; got != want {
+			t.Errorf("cancel reason = %q, want %q", got, want)
+		}
+	}
+	// Workflows added after the signal are canceled right away.
+	w3 := testWorkflow()
+	h.Add(w3)
+	if w3.getCancelReason() == "" {
+		t.Error("workflow added after the signal not canceled")
+	}
+	h.Stop()
+	h.Stop()
+	if !h.Interrupted() {
+		t.Error("Interrupted is false after a signal")
+	}
+}
@@ -23,7 +23,6 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/signal"
 	"strings"
 	"sync"
 	"time"
@@ -33,20 +32,33 @@ import (
 )
 
 var (
+	configFile         = flag.String("config", "", "path to a config file of workflow defaults, read instead of $DAISY_CONFIG or /etc/daisy/config and ~/.daisy/config")
 	oauth              = flag.String("oauth", "", "path to oauth json file, overrides what is set in workflow")
 	project            = flag.String("project", "", "project to run in, overrides what is set in workflow")
 	gcsPath            = flag.String("gcs_path", "", "GCS bucket to use, overrides what is set in workflow")
 	zone               = flag.String("zone", "", "zone to run in, overrides what is set in workflow")
+	network            = flag.String("network", "", "network of the instances that set none, overrides what is set in workflow except for IsolatedNetwork")
+	subnetwork         = flag.String("subnetwork", "", "subnetwork of the instances that set no network, overrides what is set in workflow except for IsolatedNetwork")
+	serviceAccount     = flag.String("service_account", "", "service account email of the instances that set none, overrides what is set in workflow")
 	variables          = flag.String("variables", "", "comma separated list of variables, in the form 'key=value'")
+	varFiles           = flag.String("var_file", "", "comma separated list of JSON or YAML files of variables, later files take precedence; -variables and -var: flags override them")
+	varsFromEnv        = flag.String("vars_from_env", "", "set variables from environment variables named with this prefix followed by the variable name; -variables and -var: flags override them")
 	print              = flag.Bool("print", false, "print out the parsed workflow for debugging")
 	printPerf          = flag.Bool("print_perf", false, "print out the performance profile")
 	validate           = flag.Bool("validate", false, "validate the workflow and exit")
+	estimateUsage      = flag.Bool("estimate_usage", false, "validate the workflow, print its estimated peak resource usage and cost and exit")
 	format             = flag.Bool("format_workflow", false, "format the workflow file(s) and exit")
 	defaultTimeout     = flag.String("default_timeout", "", "sets the default timeout for the workflow")
 	ce                 = flag.String("compute_endpoint_override", "", "API endpoint to override default")
 	gcsLogsDisabled    = flag.Bool("disable_gcs_logging", false, "do not stream logs to GCS")
 	cloudLogsDisabled  = flag.Bool("disable_cloud_logging", false, "do not stream logs to Cloud Logging")
 	stdoutLogsDisabled = flag.Bool("disable_stdout_logging", false, "do not display individual workflow logs on stdout")
+	progressFormat     = flag.String("progress_format", "", "set to \"json\" to write progress events to stderr as JSON lines")
+	runOnly            = flag.String("run_only", "", "comma separated list of the steps to run, the others are removed from the workflow")
+	skipSteps          = flag.String("skip_steps", "", "comma separated list of the steps to remove from the workflow, e.g. steps that succeeded in a previous run")
+	matrixFile         = flag.String("matrix", "", "path to a JSON or YAML matrix file of zones and variable values, the workflow runs once for every combination of them")
+	maxCPUs            = flag.Int64("max_cpus", 0, "with -matrix, the total number of CPUs the instances of the running workflows may have, 0 for no limit")
+	maxDisks           = flag.Int("max_disks", 0, "with -matrix, the total number of disks the running workflows may have, 0 for no limit")
 )
 
 const (
@@ -75,11 +87,19 @@ func populateVars(input string) map[string]string {
 	return varMap
 }
 
-func parseWorkflow(ctx context.Context, path string, varMap map[string]string, project, zone, gcsPath, oauth, dTimeout, cEndpoint string, disableGCSLogs, diableCloudLogs, disableStdoutLogs bool) (*daisy.Workflow, error) {
+func parseWorkflow(ctx context.Context, path string, cfg *daisy.Config, varFiles []string, envPrefix string, varMap map[string]string, env daisy.StepEnv, gcsPath, oauth, dTimeout, cEndpoint string, disableGCSLogs, diableCloudLogs, disableStdoutLogs bool) (*daisy.Workflow, error) {
 	w, err := daisy.NewFromFile(path)
 	if err != nil {
 		return nil, err
 	}
+	for _, f := range varFiles {
+		if err := w.AddVarsFromFile(f); err != nil {
+			return nil, err
+		}
+	}
+	if envPrefix != "" {
+		w.PopulateVarsFromEnv(envPrefix)
+	}
 Loop:
 	for k, v := range varMap {
 		for wv := range w.Vars {
@@ -91,17 +111,18 @@ Loop:
 		return nil, fmt.Errorf("unknown workflow Var %q passed to Workflow %q", k, w.Name)
 	}
 
-	if project != "" {
-		w.Project = project
-	} else if w.Project == "" && metadata.OnGCE() {
+	if cfg != nil {
+		cfg.Apply(w)
+	}
+
+	w.OverrideEnv(&env)
+	if w.Project == "" && metadata.OnGCE() {
 		w.Project, err = metadata.ProjectID()
 		if err != nil {
 			return nil, fmt.Errorf("Failed to get GCE project id from metadata: %v", err)
 		}
 	}
-	if zone != "" {
-		w.Zone = zone
-	} else if w.Zone == "" && metadata.OnGCE() {
+	if w.Zone == "" && metadata.OnGCE() {
 		w.Zone, err = metadata.Zone()
 		if err != nil {
 			return nil, fmt.Errorf("Failed to get GCE zone from metadata: %v", err)
@@ -134,6 +155,85 @@ Loop:
 	return w, nil
 }
 
+// prepareWorkflow parses the workflow at path with the flags applied.
+func prepareWorkflow(ctx context.Context, path string, cfg *daisy.Config, varFiles []string, varMap map[string]string) (*daisy.Workflow, error) {
+	env := daisy.StepEnv{Project: *project, Zone: *zone, Network: *network, Subnetwork: *subnetwork, ServiceAccount: *serviceAccount}
+	w, err := parseWorkflow(ctx, path, cfg, varFiles, *varsFromEnv, varMap, env, *gcsPath, *oauth, *defaultTimeout, *ce, *gcsLogsDisabled, *cloudLogsDisabled, *stdoutLogsDisabled)
+	if err != nil {
+		return nil, err
+	}
+	if *progressFormat == "json" {
+		w.SetProgressWriter(os.Stderr)
+	}
+	if *runOnly != "" {
+		if err := w.RunOnly(strings.Split(*runOnly, ",")); err != nil {
+			return nil, err
+		}
+	}
+	if *skipSteps != "" {
+		if err := w.SkipSteps(strings.Split(*skipSteps, ",")); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// runMatrix runs the workflows of runs with runner, prints a line per run
+// and returns the errors of the runs that failed.
+func runMatrix(ctx context.Context, runner *daisy.Runner, runs []*daisy.MatrixRun) []error {
+	ws := make([]*daisy.Workflow, len(runs))
+	for i, r := range runs {
+		ws[i] = r.Workflow
+		fmt.Printf("[Daisy] Running workflow %q (id=%s) for %s\n", r.Workflow.Name, r.Workflow.ID(), r.Label())
+	}
+	for i, err := range runner.Run(ctx, ws...) {
+		runs[i].Err = err
+	}
+
+	var errs []error
+	fmt.Println("\n[Daisy] Matrix results:")
+	for _, r := range runs {
+		if r.Err != nil {
+			fmt.Printf("  FAILED %s: %s\n", r.Workflow.Name, r.Label())
+			errs = append(errs, fmt.Errorf("%s (%s): %v", r.Workflow.Name, r.Label(), r.Err))
+			continue
+		}
+		fmt.Printf("  OK     %s: %s\n", r.Workflow.Name, r.Label())
+	}
+	fmt.Printf("[Daisy] %d of %d runs succeeded.\n", len(runs)-len(errs), len(runs))
+	return errs
+}
+
+// runRepeat runs w, then the workflows newWorkflow creates, as the Repeat of
+// w says, prints the results of the runs and returns the error of the repeat.
+func runRepeat(ctx context.Context, w *daisy.Workflow, newWorkflow func() (*daisy.Workflow, error), interrupts *daisy.InterruptHandler) error {
+	run := 0
+	stats, err := (&daisy.Runner{}).RunRepeat(ctx, w.Repeat, func() (*daisy.Workflow, error) {
+		nw := w
+		if run > 0 {
+			var err error
+			if nw, err = newWorkflow(); err != nil {
+				return nil, err
+			}
+			interrupts.Add(nw)
+		}
+		run++
+		fmt.Printf("[Daisy] Running workflow %q (id=%s), repeat run %d\n", nw.Name, nw.ID(), run)
+		return nw, nil
+	})
+	if stats != nil {
+		fmt.Printf("[Daisy] Workflow %q repeat results: %s\n", w.Name, stats)
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.Repeat.Err(stats); err != nil {
+		return err
+	}
+	fmt.Printf("[Daisy] Workflow %q finished\n", w.Name)
+	return nil
+}
+
 func addFlags(args []string) {
 	for _, arg := range args {
 		if len(arg) <= 1 || arg[0] != '-' {
@@ -195,6 +295,28 @@ func fmtWorkflow(path string) error {
 	return nil
 }
 
+func printResourceUsage(w *daisy.Workflow) {
+	u, err := w.EstimatePeakResourceUsage()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Daisy] Error estimating resource usage of workflow %q: %v\n", w.Name, err)
+		return
+	}
+	fmt.Printf("[Daisy] Estimated peak resource usage of workflow %q:\n", w.Name)
+	fmt.Printf("  Instances:    %d\n", u.Instances)
+	fmt.Printf("  Disks:        %d\n", u.Disks)
+	fmt.Printf("  CPUs:         %d\n", u.CPUs)
+	fmt.Printf("  External IPs: %d\n", u.ExternalIPs)
+	est, err := w.EstimateCost(daisy.CostEstimateOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Daisy] Error estimating cost of workflow %q: %v\n", w.Name, err)
+		return
+	}
+	fmt.Printf("[Daisy] Estimated cost of workflow %q, with each step taking 5 minutes:\n", w.Name)
+	fmt.Printf("  Duration:     %s\n", est.Duration)
+	fmt.Printf("  Resources:    %s\n", est.ResourceHours)
+	fmt.Printf("  Cost:         %.2f USD\n", est.Cost(daisy.DefaultPrices))
+}
+
 func printPerfProfile(workflow *daisy.Workflow) {
 	timeRecords := workflow.GetStepTimeRecords()
 	if len(timeRecords) == 0 {
@@ -213,7 +335,16 @@ func printPerfProfile(workflow *daisy.Workflow) {
 		}
 		fmt.Printf("- %v: %v\n", r.Name, formatDuration(r.EndTime.Sub(r.StartTime)))
 	}
-	fmt.Printf("Total time: %v\n\n", formatDuration(wfEndTime.Sub(wfStartTime)))
+	fmt.Printf("Total time: %v\n", formatDuration(wfEndTime.Sub(wfStartTime)))
+
+	trace := workflow.Trace()
+	if len(trace.CriticalPath) > 0 {
+		fmt.Printf("Critical path: %v\n", strings.Join(trace.CriticalPath, " -> "))
+		for _, st := range trace.Steps {
+			fmt.Printf("- %v: wait %v, work %v\n", st.Name, formatDuration(st.Wait), formatDuration(st.Work))
+		}
+	}
+	fmt.Println()
 }
 
 func formatDuration(d time.Duration) string {
@@ -239,48 +370,104 @@ func main() {
 		return
 	}
 
+	if *progressFormat != "" && *progressFormat != "json" {
+		log.Fatalf("unsupported -progress_format %q, only \"json\" is supported", *progressFormat)
+	}
+
 	ctx := context.Background()
 
 	var ws []*daisy.Workflow
 	varMap := populateVars(*variables)
+	var files []string
+	if *varFiles != "" {
+		files = strings.Split(*varFiles, ",")
+	}
+
+	var cfgFiles []string
+	if *configFile != "" {
+		cfgFiles = []string{*configFile}
+	}
+	cfg, err := daisy.LoadConfig(cfgFiles...)
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
 
+	var matrix *daisy.Matrix
+	if *matrixFile != "" {
+		if matrix, err = daisy.LoadMatrix(*matrixFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var matrixRuns []*daisy.MatrixRun
+	repeats := map[*daisy.Workflow]func() (*daisy.Workflow, error){}
 	for _, path := range flag.Args() {
-		w, err := parseWorkflow(ctx, path, varMap, *project, *zone, *gcsPath, *oauth, *defaultTimeout, *ce, *gcsLogsDisabled, *cloudLogsDisabled, *stdoutLogsDisabled)
+		path := path
+		newWorkflow := func() (*daisy.Workflow, error) {
+			return prepareWorkflow(ctx, path, cfg, files, varMap)
+		}
+		if matrix == nil {
+			w, err := newWorkflow()
+			if err != nil {
+				log.Fatalf("error parsing workflow %q: %v", path, err)
+			}
+			if w.Repeat != nil {
+				repeats[w] = newWorkflow
+			}
+			ws = append(ws, w)
+			continue
+		}
+		runs, err := matrix.Expand(newWorkflow)
 		if err != nil {
 			log.Fatalf("error parsing workflow %q: %v", path, err)
 		}
-		ws = append(ws, w)
+		for _, r := range runs {
+			ws = append(ws, r.Workflow)
+		}
+		matrixRuns = append(matrixRuns, runs...)
 	}
 
-	errors := make(chan error, len(ws))
+	errors := make(chan error, len(ws)+1)
+	interrupts := daisy.HandleInterrupts(os.Stdout, ws...)
 	var wg sync.WaitGroup
 	for _, w := range ws {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		go func(w *daisy.Workflow) {
-			select {
-			case <-c:
-				fmt.Printf("\nCtrl-C caught, sending cancel signal to %q...\n", w.Name)
-				w.CancelWorkflow()
-				errors <- fmt.Errorf("workflow %q was canceled", w.Name)
-			case <-w.Cancel:
-			}
-		}(w)
 		if *print {
 			fmt.Printf("[Daisy] Printing workflow %q\n", w.Name)
 			w.Print(ctx)
 			continue
 		}
-		if *validate {
+		if *validate || *estimateUsage {
 			fmt.Printf("[Daisy] Validating workflow %q\n", w.Name)
-			if err := w.Validate(ctx); err != nil {
-				fmt.Fprintf(os.Stderr, "[Daisy] Error validating workflow %q: %v\n", w.Name, err)
+			err := w.Validate(ctx)
+			report := w.ValidationReport()
+			for _, i := range report.Issues {
+				fmt.Fprintf(os.Stderr, "[Daisy] %s\n", i)
+			}
+			if err != nil {
+				if len(report.Errors()) == 0 {
+					fmt.Fprintf(os.Stderr, "[Daisy] Error validating workflow %q: %v\n", w.Name, err)
+				} else {
+					fmt.Fprintf(os.Stderr, "[Daisy] Workflow %q is invalid\n", w.Name)
+				}
+				continue
+			}
+			if *estimateUsage {
+				printResourceUsage(w)
 			}
 			continue
 		}
+		if matrix != nil {
+			continue
+		}
 		wg.Add(1)
 		go func(w *daisy.Workflow) {
 			defer wg.Done()
+			if newWorkflow, ok := repeats[w]; ok {
+				if err := runRepeat(ctx, w, newWorkflow, interrupts); err != nil {
+					errors <- fmt.Errorf("%s: %v", w.Name, err)
+				}
+				return
+			}
 			if *printPerf {
 				defer printPerfProfile(w)
 			}
@@ -293,6 +480,16 @@ func main() {
 		}(w)
 	}
 	wg.Wait()
+	if matrix != nil && !*print && !*validate && !*estimateUsage {
+		runner := &daisy.Runner{MaxCPUs: *maxCPUs, MaxDisks: *maxDisks}
+		for _, err := range runMatrix(ctx, runner, matrixRuns) {
+			errors <- err
+		}
+	}
+	interrupts.Stop()
+	if interrupts.Interrupted() {
+		errors <- fmt.Errorf("workflows were canceled by an interrupt")
+	}
 
 	select {
 	case err := <-errors:
@@ -18,8 +18,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
 )
 
 func TestPopulateVars(t *testing.T) {
@@ -81,7 +86,7 @@ func TestParseWorkflows(t *testing.T) {
 	oauth := "oauthpath"
 	dTimeout := "10m"
 	endpoint := "endpoint"
-	w, err := parseWorkflow(context.Background(), path, varMap, project, zone, gcsPath, oauth, dTimeout, endpoint, true, true, true)
+	w, err := parseWorkflow(context.Background(), path, nil, nil, "", varMap, daisy.StepEnv{Project: project, Zone: zone}, gcsPath, oauth, dTimeout, endpoint, true, true, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,3 +112,30 @@ func TestParseWorkflows(t *testing.T) {
 		t.Errorf("unexpected vars, want: %v, got: %v", varMap, w.Vars)
 	}
 }
+
+func TestParseWorkflowsVarPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	varFile := filepath.Join(dir, "vars.json")
+	if err := ioutil.WriteFile(varFile, []byte(`{"key1": "file", "key2": "file", "machine_type": "file"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEST_VAR_key1", "env")
+	os.Setenv("TEST_VAR_key2", "env")
+	defer os.Unsetenv("TEST_VAR_key1")
+	defer os.Unsetenv("TEST_VAR_key2")
+
+	varMap := map[string]string{"key1": "flag"}
+	w, err := parseWorkflow(context.Background(), "../test_data/test.wf.json", nil, []string{varFile}, "TEST_VAR_", varMap, daisy.StepEnv{}, "", "", "", "", true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"key1": "flag", "key2": "env", "machine_type": "file"} {
+		if got := w.Vars[k].Value; got != want {
+			t.Errorf("var %q: got %q, want %q", k, got, want)
+		}
+	}
+}
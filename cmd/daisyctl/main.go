@@ -0,0 +1,523 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// daisyctl runs and inspects Daisy workflows:
+//
+//	daisyctl <command> [flags] <workflow file>
+//
+// The commands are run, resume, validate, plan, flatten, render, graph and
+// gc-orphans, see `daisyctl help`.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+// command is a daisyctl subcommand.
+type command struct {
+	name, summary string
+	// run runs the command on the workflow read from the file given.
+	run func(ctx context.Context, w *daisy.Workflow, wf *workflowFlags, out io.Writer) error
+	// progress enables the -progress_format flag.
+	progress bool
+	// orphans enables the -min_age and -delete flags.
+	orphans bool
+	// state enables the -state flag.
+	state bool
+}
+
+var commands = []*command{
+	{name: "run", summary: "run the workflow", run: runWorkflow, progress: true, state: true},
+	{name: "resume", summary: "resume a run recorded with -state that stopped without cleaning up, not running its finished steps again", run: resumeWorkflow, progress: true, state: true},
+	{name: "validate", summary: "validate the workflow", run: validateWorkflow},
+	{name: "plan", summary: "validate the workflow and print its steps in execution order, estimated peak resource usage and cost", run: planWorkflow},
+	{name: "flatten", summary: "print the workflow with its included workflows inlined", run: flattenWorkflow},
+	{name: "render", summary: "print the populated workflow in the canonical form compared with golden files", run: renderWorkflow},
+	{name: "graph", summary: "print the step dependency graph in the Graphviz DOT format", run: graphWorkflow},
+	{name: "gc-orphans", summary: "list, or delete with -delete, the resources left behind by runs of the workflow", run: gcOrphans, orphans: true},
+}
+
+// varsFlag collects repeated -var key=value flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	var s []string
+	for k, val := range v {
+		s = append(s, k+"="+val)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (v varsFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("variable %q is not of the form key=value", s)
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+// workflowFlags are the flags of all commands, overriding workflow fields.
+type workflowFlags struct {
+	project, zone, gcsPath, oauth, defaultTimeout, computeEndpoint string
+	network, subnetwork, serviceAccount                            string
+	config, varFiles, runOnly, skipSteps                           string
+	vars                                                           varsFlag
+	disableGCSLogs, disableCloudLogs, disableStdoutLogs            bool
+	progressFormat                                                 string
+	minAge                                                         time.Duration
+	delete                                                         bool
+	state                                                          string
+}
+
+func newFlagSet(c *command, wf *workflowFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("daisyctl "+c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: daisyctl %s [flags] <workflow file>\n\n%s.\n\nFlags:\n", c.name, strings.ToUpper(c.summary[:1])+c.summary[1:])
+		fs.PrintDefaults()
+	}
+	wf.vars = varsFlag{}
+	fs.StringVar(&wf.config, "config", "", "path to a config file of workflow defaults, read instead of $DAISY_CONFIG or /etc/daisy/config and ~/.daisy/config")
+	fs.StringVar(&wf.project, "project", "", "project to run in, overrides what is set in workflow")
+	fs.StringVar(&wf.zone, "zone", "", "zone to run in, overrides what is set in workflow")
+	fs.StringVar(&wf.network, "network", "", "network of the instances that set none, overrides what is set in workflow except for IsolatedNetwork")
+	fs.StringVar(&wf.subnetwork, "subnetwork", "", "subnetwork of the instances that set no network, overrides what is set in workflow except for IsolatedNetwork")
+	fs.StringVar(&wf.serviceAccount, "service_account", "", "service account email of the instances that set none, overrides what is set in workflow")
+	fs.StringVar(&wf.gcsPath, "gcs_path", "", "GCS bucket to use, overrides what is set in workflow")
+	fs.StringVar(&wf.oauth, "oauth", "", "path to oauth json file, overrides what is set in workflow")
+	fs.StringVar(&wf.defaultTimeout, "default_timeout", "", "sets the default timeout for the workflow")
+	fs.StringVar(&wf.computeEndpoint, "compute_endpoint_override", "", "API endpoint to override default")
+	fs.StringVar(&wf.varFiles, "var_file", "", "comma separated list of JSON or YAML files of variables, later files take precedence; -var flags override them")
+	fs.Var(wf.vars, "var", "variable of the workflow, key=value, can be repeated")
+	fs.StringVar(&wf.runOnly, "run_only", "", "comma separated list of the steps to run, the others are removed from the workflow")
+	fs.StringVar(&wf.skipSteps, "skip_steps", "", "comma separated list of the steps to remove from the workflow, e.g. steps that succeeded in a previous run")
+	fs.BoolVar(&wf.disableGCSLogs, "disable_gcs_logging", false, "do not stream logs to GCS")
+	fs.BoolVar(&wf.disableCloudLogs, "disable_cloud_logging", false, "do not stream logs to Cloud Logging")
+	fs.BoolVar(&wf.disableStdoutLogs, "disable_stdout_logging", false, "do not display individual workflow logs on stdout")
+	if c.progress {
+		fs.StringVar(&wf.progressFormat, "progress_format", "", "set to \"json\" to write progress events to stderr as JSON lines")
+	}
+	if c.state {
+		fs.StringVar(&wf.state, "state", "", "file recording the steps of the run that finished, to resume it if it stops without cleaning up, e.g. on a crash")
+	}
+	if c.orphans {
+		fs.DurationVar(&wf.minAge, "min_age", 24*time.Hour, "only resources created at least this long ago are orphans, so that running workflows are left alone")
+		fs.BoolVar(&wf.delete, "delete", false, "delete the orphans instead of only listing them")
+	}
+	return fs
+}
+
+// readWorkflow reads the workflow at path and applies the config file and the
+// flags to it.
+func readWorkflow(path string, wf *workflowFlags) (*daisy.Workflow, error) {
+	w, err := daisy.NewFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if wf.varFiles != "" {
+		for _, f := range strings.Split(wf.varFiles, ",") {
+			if err := w.AddVarsFromFile(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for k, v := range wf.vars {
+		if _, ok := w.Vars[k]; !ok {
+			return nil, fmt.Errorf("unknown workflow Var %q passed to Workflow %q", k, w.Name)
+		}
+		w.AddVar(k, v)
+	}
+	var cfgFiles []string
+	if wf.config != "" {
+		cfgFiles = []string{wf.config}
+	}
+	cfg, err := daisy.LoadConfig(cfgFiles...)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Apply(w)
+	if wf.runOnly != "" {
+		if err := w.RunOnly(strings.Split(wf.runOnly, ",")); err != nil {
+			return nil, err
+		}
+	}
+	if wf.skipSteps != "" {
+		if err := w.SkipSteps(strings.Split(wf.skipSteps, ",")); err != nil {
+			return nil, err
+		}
+	}
+	w.OverrideEnv(&daisy.StepEnv{Project: wf.project, Zone: wf.zone, Network: wf.network, Subnetwork: wf.subnetwork, ServiceAccount: wf.serviceAccount})
+	for _, o := range []struct {
+		field *string
+		value string
+	}{
+		{&w.GCSPath, wf.gcsPath},
+		{&w.OAuthPath, wf.oauth},
+		{&w.DefaultTimeout, wf.defaultTimeout},
+		{&w.ComputeEndpoint, wf.computeEndpoint},
+	} {
+		if o.value != "" {
+			*o.field = o.value
+		}
+	}
+	if wf.disableGCSLogs {
+		w.DisableGCSLogging()
+	}
+	if wf.disableCloudLogs {
+		w.DisableCloudLogging()
+	}
+	if wf.disableStdoutLogs {
+		w.DisableStdoutLogging()
+	}
+	switch wf.progressFormat {
+	case "":
+	case "json":
+		w.SetProgressWriter(os.Stderr)
+	default:
+		return nil, fmt.Errorf("unsupported -progress_format %q, only \"json\" is supported", wf.progressFormat)
+	}
+	return w, nil
+}
+
+func runWorkflow(ctx context.Context, w *daisy.Workflow, wf *workflowFlags, out io.Writer) error {
+	if wf.state != "" {
+		rs := &runState{Workflow: w.Name, RunID: w.RunID, path: wf.state}
+		if rs.RunID == "" {
+			rs.RunID = w.ID()
+		}
+		if err := trackRunState(w, wf, rs); err != nil {
+			return err
+		}
+	}
+	return startRun(ctx, w, out)
+}
+
+func resumeWorkflow(ctx context.Context, w *daisy.Workflow, wf *workflowFlags, out io.Writer) error {
+	if wf.state == "" {
+		return errors.New("no run state given, set it with -state")
+	}
+	rs, err := readRunState(wf.state)
+	if err != nil {
+		return err
+	}
+	if rs.Workflow != w.Name {
+		return fmt.Errorf("run state %q is of workflow %q, not %q", wf.state, rs.Workflow, w.Name)
+	}
+	if err := w.ResumeSteps(rs.Finished); err != nil {
+		return err
+	}
+	if err := trackRunState(w, wf, rs); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Resuming run %s of workflow %q, finished steps: %s\n", rs.RunID, w.Name, strings.Join(rs.Finished, ", "))
+	return startRun(ctx, w, out)
+}
+
+// trackRunState makes w record its finished steps in rs, and generate the
+// resource names of the run identified by rs.RunID.
+func trackRunState(w *daisy.Workflow, wf *workflowFlags, rs *runState) error {
+	w.DeterministicNames = true
+	w.RunID = rs.RunID
+	if err := rs.save(); err != nil {
+		return fmt.Errorf("failed to write run state: %v", err)
+	}
+	if wf.progressFormat == "json" {
+		w.SetProgressWriter(io.MultiWriter(os.Stderr, rs))
+	} else {
+		w.SetProgressWriter(rs)
+	}
+	return nil
+}
+
+// startRun runs w, printing its ID and outcome to out.
+func startRun(ctx context.Context, w *daisy.Workflow, out io.Writer) error {
+	interrupts := daisy.HandleInterrupts(out, w)
+	defer interrupts.Stop()
+	fmt.Fprintf(out, "[Daisy] Running workflow %q (id=%s)\n", w.Name, w.ID())
+	if err := w.Run(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Workflow %q finished\n", w.Name)
+	return nil
+}
+
+func validateWorkflow(ctx context.Context, w *daisy.Workflow, _ *workflowFlags, out io.Writer) error {
+	err := w.Validate(ctx)
+	report := w.ValidationReport()
+	for _, i := range report.Issues {
+		fmt.Fprintf(out, "[Daisy] %s\n", i)
+	}
+	if err != nil {
+		if len(report.Errors()) > 0 {
+			return fmt.Errorf("workflow %q is invalid", w.Name)
+		}
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Workflow %q is valid\n", w.Name)
+	return nil
+}
+
+func planWorkflow(ctx context.Context, w *daisy.Workflow, _ *workflowFlags, out io.Writer) error {
+	if err := w.Validate(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Steps of workflow %q, by stage; the steps of a stage can run concurrently:\n", w.Name)
+	for i, stage := range stages(w) {
+		var steps []string
+		for _, name := range stage {
+			steps = append(steps, fmt.Sprintf("%s (%s)", name, stepType(w.Steps[name])))
+		}
+		fmt.Fprintf(out, "  %d. %s\n", i+1, strings.Join(steps, ", "))
+	}
+	u, err := w.EstimatePeakResourceUsage()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Estimated peak resource usage of workflow %q:\n", w.Name)
+	fmt.Fprintf(out, "  Instances:    %d\n", u.Instances)
+	fmt.Fprintf(out, "  Disks:        %d\n", u.Disks)
+	fmt.Fprintf(out, "  CPUs:         %d\n", u.CPUs)
+	fmt.Fprintf(out, "  External IPs: %d\n", u.ExternalIPs)
+	est, err := w.EstimateCost(daisy.CostEstimateOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "[Daisy] Estimated cost of workflow %q, with each step taking 5 minutes:\n", w.Name)
+	fmt.Fprintf(out, "  Duration:     %s\n", est.Duration)
+	fmt.Fprintf(out, "  Resources:    %s\n", est.ResourceHours)
+	fmt.Fprintf(out, "  Cost:         %.2f USD\n", est.Cost(daisy.DefaultPrices))
+	return nil
+}
+
+func flattenWorkflow(ctx context.Context, w *daisy.Workflow, _ *workflowFlags, out io.Writer) error {
+	fw, err := daisy.Flatten(w)
+	if err != nil {
+		return err
+	}
+	b, mErr := fw.Marshal(false)
+	if mErr != nil {
+		return mErr
+	}
+	fmt.Fprintln(out, string(b))
+	return nil
+}
+
+func renderWorkflow(ctx context.Context, w *daisy.Workflow, _ *workflowFlags, out io.Writer) error {
+	b, err := w.Render(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, string(b))
+	return nil
+}
+
+func graphWorkflow(ctx context.Context, w *daisy.Workflow, _ *workflowFlags, out io.Writer) error {
+	fmt.Fprintf(out, "digraph %q {\n", w.Name)
+	var names []string
+	for name := range w.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %q [label=%q];\n", name, name+"\n"+stepType(w.Steps[name]))
+	}
+	for _, name := range names {
+		completion := map[string]bool{}
+		for _, dep := range w.Steps[name].DependsOnCompletionOf {
+			completion[dep] = true
+		}
+		var deps []string
+		for _, dep := range w.Dependencies[name] {
+			if !completion[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		for dep := range completion {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			// Dependencies on the completion of steps are dashed.
+			if completion[dep] {
+				fmt.Fprintf(out, "  %q -> %q [style=dashed];\n", dep, name)
+				continue
+			}
+			fmt.Fprintf(out, "  %q -> %q;\n", dep, name)
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return nil
+}
+
+func gcOrphans(ctx context.Context, w *daisy.Workflow, wf *workflowFlags, out io.Writer) error {
+	if w.Project == "" {
+		return errors.New("no project given, set it in the workflow or with -project")
+	}
+	if err := w.PopulateClients(ctx); err != nil {
+		return err
+	}
+	orphans, scopes, err := w.FindOrphans(time.Now().Add(-wf.minAge))
+	if err != nil {
+		return err
+	}
+	for _, s := range scopes {
+		fmt.Fprintf(out, "[Daisy] Warning: %s not listed, its orphans are missing: %s: %s\n", s.Scope, s.Code, s.Message)
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintf(out, "[Daisy] No orphans of workflow %q found in project %q\n", w.Name, w.Project)
+		return nil
+	}
+	var errs []string
+	for _, o := range orphans {
+		if !wf.delete {
+			fmt.Fprintf(out, "[Daisy] Orphan %s, created %s\n", o, o.Created.Format(time.RFC3339))
+			continue
+		}
+		if err := w.DeleteOrphan(o); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		fmt.Fprintf(out, "[Daisy] Deleted orphan %s\n", o)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete orphans:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// stages groups the steps of w by the length of the longest chain of
+// dependencies leading to them, the order they can run in.
+func stages(w *daisy.Workflow) [][]string {
+	depth := map[string]int{}
+	var visit func(name string, seen map[string]bool) int
+	visit = func(name string, seen map[string]bool) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		d := 0
+		for _, dep := range w.Dependencies[name] {
+			if dd := visit(dep, seen) + 1; dd > d {
+				d = dd
+			}
+		}
+		depth[name] = d
+		return d
+	}
+	var stages [][]string
+	for name := range w.Steps {
+		d := visit(name, map[string]bool{})
+		for len(stages) <= d {
+			stages = append(stages, nil)
+		}
+		stages[d] = append(stages[d], name)
+	}
+	for _, s := range stages {
+		sort.Strings(s)
+	}
+	return stages
+}
+
+// stepType returns the type of s, the name of its step field that is set.
+func stepType(s *daisy.Step) string {
+	if s == nil {
+		return "unknown"
+	}
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Name == "Env" || f.Type.Kind() != reflect.Ptr {
+			continue
+		}
+		if !v.Field(i).IsNil() {
+			return f.Name
+		}
+	}
+	return "unknown"
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: daisyctl <command> [flags] <workflow file>\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nUse \"daisyctl <command> -h\" for the flags of a command.")
+}
+
+// errUsage is returned for invalid command lines, after printing the usage.
+var errUsage = errors.New("invalid usage")
+
+// run runs the command line args, without the program name.
+func run(ctx context.Context, args []string, out, errOut io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(out)
+		if len(args) == 0 {
+			return errUsage
+		}
+		return nil
+	}
+	var c *command
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			c = cmd
+		}
+	}
+	if c == nil {
+		fmt.Fprintf(errOut, "unknown command %q\n\n", args[0])
+		usage(errOut)
+		return errUsage
+	}
+
+	wf := &workflowFlags{}
+	fs := newFlagSet(c, wf)
+	fs.SetOutput(errOut)
+	if err := fs.Parse(args[1:]); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	w, err := readWorkflow(fs.Arg(0), wf)
+	if err != nil {
+		return err
+	}
+	return c.run(ctx, w, wf, out)
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintf(os.Stderr, "[Daisy] Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
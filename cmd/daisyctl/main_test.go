@@ -0,0 +1,143 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+const testWorkflowPath = "../../test_data/test.wf.json"
+
+func TestRunCommandLine(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"no command", nil, []string{"Commands:"}, true},
+		{"help", []string{"help"}, []string{"graph", "flatten", "gc-orphans", "resume"}, false},
+		{"unknown command", []string{"frobnicate", testWorkflowPath}, nil, true},
+		{"no workflow", []string{"graph"}, nil, true},
+		{"unknown var", []string{"graph", "-var", "nope=1", testWorkflowPath}, nil, true},
+		{"bad progress format", []string{"run", "-progress_format", "xml", testWorkflowPath}, nil, true},
+		{"resume without state", []string{"resume", testWorkflowPath}, nil, true},
+		{"resume missing state", []string{"resume", "-state", "/dne/state.json", testWorkflowPath}, nil, true},
+		{"graph", []string{"graph", testWorkflowPath}, []string{`digraph "some-name" {`, `"postinstall" -> "postinstall-stopped";`, `label="create-disks\nCreateDisks"`}, false},
+		{"graph of some steps", []string{"graph", "-run_only", "create-disks,bootstrap-stopped", "../../test_data/test_sub.wf.json"}, []string{`"create-disks" -> "bootstrap-stopped";`}, false},
+		{"skip unknown step", []string{"graph", "-skip_steps", "nope", "../../test_data/test_sub.wf.json"}, nil, true},
+		{"render", []string{"render", "../../test_data/TestRender.parent.wf.json"}, []string{`"RealName": "disk-render-${ID}"`}, false},
+		{"flatten", []string{"flatten", "-project", "other-project", "../../test_data/test_sub.wf.json"}, []string{`"Project": "other-project"`}, false},
+	}
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		err := run(ctx, tt.args, &out, &errOut)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: output does not contain %q:\n%s", tt.desc, want, out.String())
+			}
+		}
+	}
+}
+
+func TestReadWorkflow(t *testing.T) {
+	wf := &workflowFlags{project: "p", zone: "z", vars: varsFlag{"key1": "value1"}, disableGCSLogs: true}
+	w, err := readWorkflow(testWorkflowPath, wf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Project != "p" || w.Zone != "z" || w.GCSPath != "gs://some-bucket/images" {
+		t.Errorf("flags not applied as expected: project %q, zone %q, GCS path %q", w.Project, w.Zone, w.GCSPath)
+	}
+	if got := w.Vars["key1"].Value; got != "value1" {
+		t.Errorf("got var key1 %q, want %q", got, "value1")
+	}
+}
+
+func TestVarsFlag(t *testing.T) {
+	v := varsFlag{}
+	for _, s := range []string{"a=1", "b=x=y"} {
+		if err := v.Set(s); err != nil {
+			t.Errorf("unexpected error for %q: %v", s, err)
+		}
+	}
+	if err := v.Set("novalue"); err == nil {
+		t.Error("expected error for variable without value")
+	}
+	if got := v.String(); got != "a=1,b=x=y" {
+		t.Errorf("got %q, want %q", got, "a=1,b=x=y")
+	}
+}
+
+func TestStages(t *testing.T) {
+	w := daisy.New()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		w.NewStep(name)
+	}
+	w.Dependencies = map[string][]string{"b": {"a"}, "c": {"a"}, "d": {"b", "c"}}
+	want := [][]string{{"a"}, {"b", "c"}, {"d"}}
+	if got := stages(w); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stages %v, want %v", got, want)
+	}
+}
+
+func TestRunState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	rs := &runState{Workflow: "wf", RunID: "abcde", path: path}
+	events := strings.Join([]string{
+		`{"stage":"step-started","workflow":"wf","step":"a"}`,
+		`{"stage":"step-finished","workflow":"wf","step":"a"}`,
+		`{"stage":"step-finished","workflow":"wf.inc","step":"b"}`,
+		`{"stage":"step-failed","workflow":"wf","step":"c"}`,
+		`{"stage":"step-finished","workflow":"wf","step":"a"}`,
+	}, "\n") + "\n"
+	if _, err := rs.Write([]byte(events)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRunState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Workflow != "wf" || got.RunID != "abcde" || !reflect.DeepEqual(got.Finished, []string{"a"}) {
+		t.Errorf("unexpected run state %+v", got)
+	}
+
+	w, err := readWorkflow(testWorkflowPath, &workflowFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumeWorkflow(context.Background(), w, &workflowFlags{state: path}, ioutil.Discard); err == nil || !strings.Contains(err.Error(), "not \"some-name\"") {
+		t.Errorf("expected error resuming the run of another workflow, got %v", err)
+	}
+}
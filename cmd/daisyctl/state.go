@@ -0,0 +1,86 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+// runState is the state of a run recorded with -state, to resume it.
+type runState struct {
+	Workflow string
+	// RunID of the run, which uses DeterministicNames so that the resumed
+	// run generates the same resource names.
+	RunID string
+	// Finished are the steps of the workflow that finished.
+	Finished []string `json:",omitempty"`
+
+	path string
+}
+
+// readRunState reads the run state recorded in path.
+func readRunState(path string) (*runState, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rs := &runState{path: path}
+	if err := json.Unmarshal(b, rs); err != nil {
+		return nil, fmt.Errorf("failed to read run state %q: %v", path, err)
+	}
+	return rs, nil
+}
+
+// save writes rs to its file, replacing it.
+func (rs *runState) save() error {
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := rs.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, rs.path)
+}
+
+// Write records the steps of the workflow that finish, from the JSON lines
+// progress events in p.
+func (rs *runState) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		var e daisy.ProgressEvent
+		if json.Unmarshal(line, &e) != nil || e.Stage != daisy.ProgressStepFinished || e.Workflow != rs.Workflow {
+			continue
+		}
+		found := false
+		for _, s := range rs.Finished {
+			found = found || s == e.Step
+		}
+		if found {
+			continue
+		}
+		rs.Finished = append(rs.Finished, e.Step)
+		if err := rs.save(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
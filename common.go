@@ -16,6 +16,7 @@ package daisy
 
 import (
 	"context"
+	"crypto/sha256"
 	"math/rand"
 	"os"
 	"os/user"
@@ -83,12 +84,24 @@ func minInt(x int, ys ...int) int {
 	return x
 }
 
+const nameLetters = "bdghjlmnpqrstvwxyz0123456789"
+
 func randString(n int) string {
 	gen := rand.New(rand.NewSource(time.Now().UnixNano()))
-	letters := "bdghjlmnpqrstvwxyz0123456789"
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[gen.Int63()%int64(len(letters))]
+		b[i] = nameLetters[gen.Int63()%int64(len(nameLetters))]
+	}
+	return string(b)
+}
+
+// hashString returns a string of length n (at most 32) drawn from the same
+// alphabet as randString, derived from the sha256 hash of parts.
+func hashString(n int, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	b := make([]byte, minInt(n, len(sum)))
+	for i := range b {
+		b[i] = nameLetters[int(sum[i])%len(nameLetters)]
 	}
 	return string(b)
 }
@@ -106,6 +119,23 @@ func strLitPtr(s string) *string {
 	return &s
 }
 
+var invalidNameCharsRgx = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName turns s, e.g. a step name, into a resource name: lower case
+// letters, digits and hyphens, starting with a letter.
+func resourceName(s string) string {
+	name := strings.TrimLeft(invalidNameCharsRgx.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "step-" + name
+	}
+	return name
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func strOr(s string, ss ...string) string {
 	ss = append([]string{s}, ss...)
 	for _, st := range ss {
@@ -74,6 +74,40 @@ func TestMinInt(t *testing.T) {
 	}
 }
 
+func TestResourceName(t *testing.T) {
+	tests := []struct {
+		desc, s, want string
+	}{
+		{"valid case", "boot-test", "boot-test"},
+		{"upper case", "Boot-Test", "boot-test"},
+		{"invalid chars case", "boot_test.1", "boot-test-1"},
+		{"leading digit case", "1-boot", "step-1-boot"},
+		{"leading invalid char case", "_boot", "boot"},
+	}
+
+	for _, tt := range tests {
+		if got := resourceName(tt.s); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		desc, s, want string
+	}{
+		{"plain case", "gs://bucket/disk.vmdk", "'gs://bucket/disk.vmdk'"},
+		{"space case", "gs://bucket/my disk.vmdk", "'gs://bucket/my disk.vmdk'"},
+		{"quote case", "gs://bucket/it's.vmdk", `'gs://bucket/it'\''s.vmdk'`},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.s); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.desc, got, tt.want)
+		}
+	}
+}
+
 func TestHasVariableDeclaration(t *testing.T) {
 	tests := []struct {
 		desc string
@@ -104,6 +138,20 @@ func TestRandString(t *testing.T) {
 	}
 }
 
+func TestHashString(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		if l := len(hashString(i, "a", "b")); l != i {
+			t.Fatalf("wrong string length: %d != %d", l, i)
+		}
+	}
+	if hashString(5, "a", "b") != hashString(5, "a", "b") {
+		t.Error("hashString is not stable for the same input")
+	}
+	if hashString(5, "ab") == hashString(5, "a", "b") {
+		t.Error("hashString should not collide on part boundaries")
+	}
+}
+
 func TestStrIn(t *testing.T) {
 	ss := []string{"hello", "world", "my", "name", "is", "daisy"}
 
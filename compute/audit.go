@@ -0,0 +1,161 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a mutating API call made by a client.
+type AuditRecord struct {
+	Time time.Time
+	// Caller is the label set with WithAuditCaller, such as the workflow step
+	// that made the call.
+	Caller string `json:",omitempty"`
+	Method string
+	// URL is the resource URL of the call, without query parameters.
+	URL string
+	// RequestHash is the hex encoded SHA-256 hash of the request body.
+	RequestHash string
+	// Status is the HTTP status code of the response, or 0 if there was none.
+	Status int    `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// AuditRecorder records the mutating API calls of a client.
+type AuditRecorder interface {
+	Record(r AuditRecord) error
+}
+
+type auditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewAuditLog returns an AuditRecorder that writes records to w as JSON,
+// one per line.
+func NewAuditLog(w io.Writer) AuditRecorder {
+	return &auditLog{enc: json.NewEncoder(w)}
+}
+
+func (l *auditLog) Record(r AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(r)
+}
+
+// auditState holds the recorder of a client. It is shared by the copies of a
+// client returned by WithAuditCaller.
+type auditState struct {
+	mu       sync.Mutex
+	recorder AuditRecorder
+}
+
+func (a *auditState) get() AuditRecorder {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.recorder
+}
+
+// auditTransport records the mutating requests sent through it.
+type auditTransport struct {
+	base   http.RoundTripper
+	audit  *auditState
+	caller string
+}
+
+// mutating reports whether req changes resources. Operation polling is
+// excluded, it only waits for the calls that are recorded.
+func mutating(req *http.Request) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return false
+	}
+	return !strings.Contains(req.URL.Path, "/operations/")
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	recorder := t.audit.get()
+	if recorder == nil || !mutating(req) {
+		return base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	u := *req.URL
+	u.RawQuery = ""
+	r := AuditRecord{
+		Time:        time.Now(),
+		Caller:      t.caller,
+		Method:      req.Method,
+		URL:         u.String(),
+		RequestHash: hex.EncodeToString(sum[:]),
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Status = resp.StatusCode
+	}
+	// Failing to record must not fail the call, the call has been made.
+	recorder.Record(r)
+	return resp, err
+}
+
+// SetAuditRecorder makes the client record its mutating API calls, and those
+// of the copies returned by WithAuditCaller, to r. A nil r stops recording.
+func (c *client) SetAuditRecorder(r AuditRecorder) {
+	c.audit.mu.Lock()
+	defer c.audit.mu.Unlock()
+	c.audit.recorder = r
+}
+
+// WithAuditCaller returns a client whose recorded API calls are attributed to
+// caller. If no recorder is set, the client itself is returned.
+func (c *client) WithAuditCaller(caller string) Client {
+	if c.audit.get() == nil {
+		return c.i
+	}
+	cc := *c
+	if err := cc.newServices(caller); err != nil {
+		// The services were created the same way before, so this is not
+		// expected. Fall back to unattributed calls.
+		return c.i
+	}
+	cc.i = &cc
+	return &cc
+}
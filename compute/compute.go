@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -32,91 +34,143 @@ import (
 	"google.golang.org/api/transport"
 )
 
-// Client is a client for interacting with Google Cloud Compute.
-type Client interface {
+// InstanceService manages instances.
+type InstanceService interface {
 	AttachDisk(project, zone, instance string, d *compute.AttachedDisk) error
 	DetachDisk(project, zone, instance, disk string) error
-	CreateDisk(project, zone string, d *compute.Disk) error
-	CreateDiskAlpha(project, zone string, d *computeAlpha.Disk) error
-	CreateDiskBeta(project, zone string, d *computeBeta.Disk) error
-	CreateForwardingRule(project, region string, fr *compute.ForwardingRule) error
-	CreateFirewallRule(project string, i *compute.Firewall) error
-	CreateImage(project string, i *compute.Image) error
-	CreateImageAlpha(project string, i *computeAlpha.Image) error
-	CreateImageBeta(project string, i *computeBeta.Image) error
 	CreateInstance(project, zone string, i *compute.Instance) error
 	CreateInstanceAlpha(project, zone string, i *computeAlpha.Instance) error
 	CreateInstanceBeta(project, zone string, i *computeBeta.Instance) error
-	CreateNetwork(project string, n *compute.Network) error
-	CreateSnapshot(project, zone, disk string, s *compute.Snapshot) error
-	CreateSubnetwork(project, region string, n *compute.Subnetwork) error
-	CreateTargetInstance(project, zone string, ti *compute.TargetInstance) error
-	DeleteDisk(project, zone, name string) error
-	DeleteForwardingRule(project, region, name string) error
-	DeleteFirewallRule(project, name string) error
-	DeleteImage(project, name string) error
 	DeleteInstance(project, zone, name string) error
 	StartInstance(project, zone, name string) error
 	StopInstance(project, zone, name string) error
-	DeleteNetwork(project, name string) error
-	DeleteSubnetwork(project, region, name string) error
-	DeleteTargetInstance(project, zone, name string) error
-	DeprecateImage(project, name string, deprecationstatus *compute.DeprecationStatus) error
-	DeprecateImageAlpha(project, name string, deprecationstatus *computeAlpha.DeprecationStatus) error
-	GetMachineType(project, zone, machineType string) (*compute.MachineType, error)
-	GetProject(project string) (*compute.Project, error)
+	ResetInstance(project, zone, name string) error
+	SimulateMaintenanceEvent(project, zone, name string) error
+	SetScheduling(project, zone, name string, s *compute.Scheduling) error
 	GetSerialPortOutput(project, zone, name string, port, start int64) (*compute.SerialPortOutput, error)
-	GetZone(project, zone string) (*compute.Zone, error)
 	GetInstance(project, zone, name string) (*compute.Instance, error)
 	GetInstanceAlpha(project, zone, name string) (*computeAlpha.Instance, error)
 	GetInstanceBeta(project, zone, name string) (*computeBeta.Instance, error)
+	GetGuestAttributes(project, zone, name, queryPath, variableKey string) (*compute.GuestAttributes, error)
+	InstanceStatus(project, zone, name string) (string, error)
+	InstanceStopped(project, zone, name string) (bool, error)
+	AggregatedListInstances(project string, opts ...ListCallOption) ([]*compute.Instance, error)
+	AggregatedListInstancesWithStatus(project string, opts ...ListCallOption) ([]*compute.Instance, []ScopeStatus, error)
+	ListInstances(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error)
+	SetInstanceMetadata(project, zone, name string, md *compute.Metadata) error
+	SetDiskAutoDelete(project, zone, instance string, autoDelete bool, deviceName string) error
+}
+
+// DiskService manages disks and their snapshots.
+type DiskService interface {
+	CreateDisk(project, zone string, d *compute.Disk) error
+	CreateDiskAlpha(project, zone string, d *computeAlpha.Disk) error
+	CreateDiskBeta(project, zone string, d *computeBeta.Disk) error
+	DeleteDisk(project, zone, name string) error
 	GetDisk(project, zone, name string) (*compute.Disk, error)
 	GetDiskAlpha(project, zone, name string) (*computeAlpha.Disk, error)
 	GetDiskBeta(project, zone, name string) (*computeBeta.Disk, error)
-	GetForwardingRule(project, region, name string) (*compute.ForwardingRule, error)
-	GetFirewallRule(project, name string) (*compute.Firewall, error)
-	GetGuestAttributes(project, zone, name, queryPath, variableKey string) (*compute.GuestAttributes, error)
+	AggregatedListDisks(project string, opts ...ListCallOption) ([]*compute.Disk, error)
+	AggregatedListDisksWithStatus(project string, opts ...ListCallOption) ([]*compute.Disk, []ScopeStatus, error)
+	ListDisks(project, zone string, opts ...ListCallOption) ([]*compute.Disk, error)
+	ResizeDisk(project, zone, disk string, drr *compute.DisksResizeRequest) error
+	CreateSnapshot(project, zone, disk string, s *compute.Snapshot) error
+	GetSnapshot(project, name string) (*compute.Snapshot, error)
+	ListSnapshots(project string, opts ...ListCallOption) ([]*compute.Snapshot, error)
+	DeleteSnapshot(project, name string) error
+}
+
+// ImageService manages images and machine images.
+type ImageService interface {
+	CreateImage(project string, i *compute.Image) error
+	CreateImageAlpha(project string, i *computeAlpha.Image) error
+	CreateImageBeta(project string, i *computeBeta.Image) error
+	DeleteImage(project, name string) error
+	DeprecateImage(project, name string, deprecationstatus *compute.DeprecationStatus) error
+	DeprecateImageAlpha(project, name string, deprecationstatus *computeAlpha.DeprecationStatus) error
 	GetImage(project, name string) (*compute.Image, error)
 	GetImageAlpha(project, name string) (*computeAlpha.Image, error)
 	GetImageBeta(project, name string) (*computeBeta.Image, error)
 	GetImageFromFamily(project, family string) (*compute.Image, error)
-	GetLicense(project, name string) (*compute.License, error)
+	GetImageFromFamilies(projects []string, family string) (*compute.Image, string, error)
+	ListImages(project string, opts ...ListCallOption) ([]*compute.Image, error)
+	ListImagesAlpha(project string, opts ...ListCallOption) ([]*computeAlpha.Image, error)
+	ListMachineImages(project string, opts ...ListCallOption) ([]*compute.MachineImage, error)
+	DeleteMachineImage(project, name string) error
+	CreateMachineImage(project string, i *compute.MachineImage) error
+	GetMachineImage(project, name string) (*compute.MachineImage, error)
+}
+
+// NetworkService manages networks, subnetworks, firewall rules, forwarding
+// rules and target instances.
+type NetworkService interface {
+	CreateForwardingRule(project, region string, fr *compute.ForwardingRule) error
+	CreateFirewallRule(project string, i *compute.Firewall) error
+	CreateNetwork(project string, n *compute.Network) error
+	CreateSubnetwork(project, region string, n *compute.Subnetwork) error
+	CreateTargetInstance(project, zone string, ti *compute.TargetInstance) error
+	DeleteForwardingRule(project, region, name string) error
+	DeleteFirewallRule(project, name string) error
+	DeleteNetwork(project, name string) error
+	DeleteSubnetwork(project, region, name string) error
+	DeleteTargetInstance(project, zone, name string) error
+	GetForwardingRule(project, region, name string) (*compute.ForwardingRule, error)
+	GetFirewallRule(project, name string) (*compute.Firewall, error)
 	GetNetwork(project, name string) (*compute.Network, error)
 	GetSubnetwork(project, region, name string) (*compute.Subnetwork, error)
 	GetTargetInstance(project, zone, name string) (*compute.TargetInstance, error)
-	InstanceStatus(project, zone, name string) (string, error)
-	InstanceStopped(project, zone, name string) (bool, error)
-	ListMachineTypes(project, zone string, opts ...ListCallOption) ([]*compute.MachineType, error)
-	ListLicenses(project string, opts ...ListCallOption) ([]*compute.License, error)
-	ListZones(project string, opts ...ListCallOption) ([]*compute.Zone, error)
-	ListRegions(project string, opts ...ListCallOption) ([]*compute.Region, error)
-	AggregatedListInstances(project string, opts ...ListCallOption) ([]*compute.Instance, error)
-	ListInstances(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error)
-	AggregatedListDisks(project string, opts ...ListCallOption) ([]*compute.Disk, error)
-	ListDisks(project, zone string, opts ...ListCallOption) ([]*compute.Disk, error)
 	ListForwardingRules(project, zone string, opts ...ListCallOption) ([]*compute.ForwardingRule, error)
 	ListFirewallRules(project string, opts ...ListCallOption) ([]*compute.Firewall, error)
-	ListImages(project string, opts ...ListCallOption) ([]*compute.Image, error)
-	ListImagesAlpha(project string, opts ...ListCallOption) ([]*computeAlpha.Image, error)
-	GetSnapshot(project, name string) (*compute.Snapshot, error)
-	ListSnapshots(project string, opts ...ListCallOption) ([]*compute.Snapshot, error)
-	DeleteSnapshot(project, name string) error
 	ListNetworks(project string, opts ...ListCallOption) ([]*compute.Network, error)
 	AggregatedListSubnetworks(project string, opts ...ListCallOption) ([]*compute.Subnetwork, error)
+	AggregatedListSubnetworksWithStatus(project string, opts ...ListCallOption) ([]*compute.Subnetwork, []ScopeStatus, error)
 	ListSubnetworks(project, region string, opts ...ListCallOption) ([]*compute.Subnetwork, error)
 	ListTargetInstances(project, zone string, opts ...ListCallOption) ([]*compute.TargetInstance, error)
-	ResizeDisk(project, zone, disk string, drr *compute.DisksResizeRequest) error
-	SetInstanceMetadata(project, zone, name string, md *compute.Metadata) error
+}
+
+// ProjectService reads projects and the zones, regions, machine types,
+// accelerator types, disk types and licenses available to them.
+type ProjectService interface {
+	GetMachineType(project, zone, machineType string) (*compute.MachineType, error)
+	GetProject(project string) (*compute.Project, error)
+	GetZone(project, zone string) (*compute.Zone, error)
+	GetZoneRegion(project, zone string) (string, error)
+	ResolveZone(project string, prefs ZonePreferences) (string, error)
+	GetLicense(project, name string) (*compute.License, error)
+	ListMachineTypes(project, zone string, opts ...ListCallOption) ([]*compute.MachineType, error)
+	ListAcceleratorTypes(project, zone string, opts ...ListCallOption) ([]*compute.AcceleratorType, error)
+	ListDiskTypes(project, zone string, opts ...ListCallOption) ([]*compute.DiskType, error)
+	ListLicenses(project string, opts ...ListCallOption) ([]*compute.License, error)
+	ListZones(project string, opts ...ListCallOption) ([]*compute.Zone, error)
+	ListRegions(project string, opts ...ListCallOption) ([]*compute.Region, error)
 	SetCommonInstanceMetadata(project string, md *compute.Metadata) error
-	SetDiskAutoDelete(project, zone, instance string, autoDelete bool, deviceName string) error
-	ListMachineImages(project string, opts ...ListCallOption) ([]*compute.MachineImage, error)
-	DeleteMachineImage(project, name string) error
-	CreateMachineImage(project string, i *compute.MachineImage) error
-	GetMachineImage(project, name string) (*compute.MachineImage, error)
+}
 
+// OperationWaiter retries API calls returning operations and waits for the
+// operations to complete.
+type OperationWaiter interface {
 	Retry(f func(opts ...googleapi.CallOption) (*compute.Operation, error), opts ...googleapi.CallOption) (op *compute.Operation, err error)
 	RetryBeta(f func(opts ...googleapi.CallOption) (*computeBeta.Operation, error), opts ...googleapi.CallOption) (op *computeBeta.Operation, err error)
+	SetOperationPollInterval(d time.Duration)
+}
+
+// Client is a client for interacting with Google Cloud Compute. Code that
+// only needs part of it, and its test fakes, can use one of the interfaces
+// it is made of instead, such as InstanceService.
+type Client interface {
+	InstanceService
+	DiskService
+	ImageService
+	NetworkService
+	ProjectService
+	OperationWaiter
+
 	BasePath() string
+	SetAuditRecorder(r AuditRecorder)
+	SetRetryBudget(b *RetryBudget)
+	SetHooks(h *Hooks)
+	APIUsage() []APIUsage
+	WithAuditCaller(caller string) Client
 }
 
 // A ListCallOption is an option for a Google Compute API *ListCall.
@@ -145,6 +199,10 @@ func (o OrderBy) listCallOptionApply(i interface{}) interface{} {
 		return c.OrderBy(string(o))
 	case *compute.MachineTypesListCall:
 		return c.OrderBy(string(o))
+	case *compute.AcceleratorTypesListCall:
+		return c.OrderBy(string(o))
+	case *compute.DiskTypesListCall:
+		return c.OrderBy(string(o))
 	case *compute.ZonesListCall:
 		return c.OrderBy(string(o))
 	case *compute.InstancesListCall:
@@ -186,6 +244,10 @@ func (o Filter) listCallOptionApply(i interface{}) interface{} {
 		return c.Filter(string(o))
 	case *compute.MachineTypesListCall:
 		return c.Filter(string(o))
+	case *compute.AcceleratorTypesListCall:
+		return c.Filter(string(o))
+	case *compute.DiskTypesListCall:
+		return c.Filter(string(o))
 	case *compute.ZonesListCall:
 		return c.Filter(string(o))
 	case *compute.InstancesListCall:
@@ -206,6 +268,50 @@ func (o Filter) listCallOptionApply(i interface{}) interface{} {
 	return i
 }
 
+// ReturnPartialSuccess sets the optional parameter "returnPartialSuccess" of
+// aggregated lists: scopes that cannot be reached are reported as unreachable
+// instead of failing the whole call.
+type ReturnPartialSuccess bool
+
+func (o ReturnPartialSuccess) listCallOptionApply(i interface{}) interface{} {
+	switch c := i.(type) {
+	case *compute.InstancesAggregatedListCall:
+		return c.ReturnPartialSuccess(bool(o))
+	case *compute.DisksAggregatedListCall:
+		return c.ReturnPartialSuccess(bool(o))
+	case *compute.SubnetworksAggregatedListCall:
+		return c.ReturnPartialSuccess(bool(o))
+	}
+	return i
+}
+
+// ScopeStatus reports a scope of an aggregated list, such as
+// "zones/us-central1-a", whose resources may be missing from the results.
+type ScopeStatus struct {
+	Scope string
+	// Code is the warning code of the scope, or "UNREACHABLE" for scopes
+	// skipped by ReturnPartialSuccess.
+	Code    string
+	Message string
+}
+
+// scopeStatus returns the status of a scope that returned a warning, or nil
+// if the warning doesn't mean resources may be missing.
+func scopeStatus(scope, code, message string) *ScopeStatus {
+	if code == "" || code == "NO_RESULTS_ON_PAGE" {
+		return nil
+	}
+	return &ScopeStatus{Scope: scope, Code: code, Message: message}
+}
+
+func unreachableScopes(scopes []string) []ScopeStatus {
+	var ss []ScopeStatus
+	for _, scope := range scopes {
+		ss = append(ss, ScopeStatus{Scope: scope, Code: "UNREACHABLE", Message: "scope could not be reached"})
+	}
+	return ss
+}
+
 type clientImpl interface {
 	Client
 	zoneOperationsWait(project, zone, name string) error
@@ -216,16 +322,36 @@ type clientImpl interface {
 type client struct {
 	i        clientImpl
 	hc       *http.Client
+	ep       string
 	raw      *compute.Service
 	rawBeta  *computeBeta.Service
 	rawAlpha *computeAlpha.Service
+
+	zoneCache *zoneCache
+	audit     *auditState
+	retry     *retryState
+	hooks     *hooksState
+	// opPoll is the interval between polls of pending operations, in
+	// nanoseconds, shared by the copies of the client.
+	opPoll *int64
+	usage  *usageState
 }
 
 // shouldRetryWithWait returns true if the HTTP response / error indicates
-// that the request should be attempted again.
+// that the request should be attempted again, after waiting.
 func shouldRetryWithWait(tripper http.RoundTripper, err error, multiplier int) bool {
+	d, ok := retryWait(tripper, err, multiplier)
+	if ok {
+		time.Sleep(d)
+	}
+	return ok
+}
+
+// retryWait returns whether the HTTP response / error indicates that the
+// request should be attempted again, and how long to wait before.
+func retryWait(tripper http.RoundTripper, err error, multiplier int) (time.Duration, bool) {
 	if err == nil {
-		return false
+		return 0, false
 	}
 	tkValid := true
 	trans, ok := tripper.(*oauth2.Transport)
@@ -246,7 +372,7 @@ func shouldRetryWithWait(tripper http.RoundTripper, err error, multiplier int) b
 		retry = true
 	case !ok && tkValid:
 		// Not a googleapi.Error and the token is still valid.
-		return false
+		return 0, false
 	case apiErr.Code >= 500 && apiErr.Code <= 599:
 		retry = true
 	case apiErr.Code >= 429:
@@ -261,12 +387,10 @@ func shouldRetryWithWait(tripper http.RoundTripper, err error, multiplier int) b
 		retry = true
 	}
 	if !retry {
-		return false
+		return 0, false
 	}
 
-	sleep := (time.Duration(rand.Intn(1000))*time.Millisecond + 1*time.Second) * time.Duration(multiplier)
-	time.Sleep(sleep)
-	return true
+	return (time.Duration(rand.Intn(1000))*time.Millisecond + 1*time.Second) * time.Duration(multiplier), true
 }
 
 // NewClient creates a new Google Cloud Compute client.
@@ -287,32 +411,51 @@ func NewClient(ctx context.Context, opts ...option.ClientOption) (Client, error)
 	if err != nil {
 		return nil, fmt.Errorf("error creating HTTP API client: %v", err)
 	}
+	c := &client{hc: hc, ep: ep, zoneCache: newZoneCache(), audit: &auditState{}, retry: &retryState{}, hooks: &hooksState{}, opPoll: new(int64), usage: &usageState{}}
+	if err := c.newServices(""); err != nil {
+		return nil, err
+	}
+	c.i = c
+
+	return c, nil
+}
+
+// newServices creates the API services of c. Their requests are sent through
+// an auditTransport, which attributes recorded calls to caller, a
+// hooksTransport, a budgetTransport, a usageTransport and, for clients
+// authorized by a RefreshingTokenSource, an authRetryTransport.
+func (c *client) newServices(caller string) error {
+	base := c.hc.Transport
+	if ts := tokenSource(base); ts != nil {
+		base = &authRetryTransport{base: base, tokens: ts}
+	}
+	ut := &usageTransport{base: base, usage: c.usage}
+	bt := &budgetTransport{base: ut, retry: c.retry}
+	ht := &hooksTransport{base: bt, hooks: c.hooks}
+	hc := &http.Client{Transport: &auditTransport{base: ht, audit: c.audit, caller: caller}}
 	rawService, err := compute.New(hc)
 	if err != nil {
-		return nil, fmt.Errorf("compute client: %v", err)
+		return fmt.Errorf("compute client: %v", err)
 	}
-	if ep != "" {
-		rawService.BasePath = ep
+	if c.ep != "" {
+		rawService.BasePath = c.ep
 	}
 	rawBetaService, err := computeBeta.New(hc)
 	if err != nil {
-		return nil, fmt.Errorf("beta compute client: %v", err)
+		return fmt.Errorf("beta compute client: %v", err)
 	}
-	if ep != "" {
-		rawBetaService.BasePath = ep
+	if c.ep != "" {
+		rawBetaService.BasePath = c.ep
 	}
 	rawAlphaService, err := computeAlpha.New(hc)
 	if err != nil {
-		return nil, fmt.Errorf("alpha compute client: %v", err)
+		return fmt.Errorf("alpha compute client: %v", err)
 	}
-	if ep != "" {
-		rawAlphaService.BasePath = ep
+	if c.ep != "" {
+		rawAlphaService.BasePath = c.ep
 	}
-
-	c := &client{hc: hc, raw: rawService, rawBeta: rawBetaService, rawAlpha: rawAlphaService}
-	c.i = c
-
-	return c, nil
+	c.raw, c.rawBeta, c.rawAlpha = rawService, rawBetaService, rawAlphaService
+	return nil
 }
 
 // BasePath returns the base path for this client.
@@ -352,6 +495,24 @@ func (c *client) globalOperationsWait(project, name string) error {
 	})
 }
 
+// defaultOperationPollInterval is the interval between polls of pending
+// operations.
+const defaultOperationPollInterval = 1 * time.Second
+
+// SetOperationPollInterval sets the interval between polls of pending
+// operations for the client, and the copies returned by WithAuditCaller. 0
+// restores the default of 1s.
+func (c *client) SetOperationPollInterval(d time.Duration) {
+	atomic.StoreInt64(c.opPoll, int64(d))
+}
+
+func (c *client) operationPollInterval() time.Duration {
+	if d := time.Duration(atomic.LoadInt64(c.opPoll)); d > 0 {
+		return d
+	}
+	return defaultOperationPollInterval
+}
+
 // OperationErrorCodeFormat is the format of operation error code.
 var OperationErrorCodeFormat = "Code: %s"
 
@@ -366,17 +527,11 @@ func (c *client) operationsWaitHelper(project, name string, getOperation operati
 
 		switch op.Status {
 		case "PENDING", "RUNNING":
-			time.Sleep(1 * time.Second)
+			time.Sleep(c.operationPollInterval())
 			continue
 		case "DONE":
 			if op.Error != nil {
-				var operrs string
-				for _, operr := range op.Error.Errors {
-					operrs = operrs + fmt.Sprintf(
-						fmt.Sprintf("\n%v\n%v", OperationErrorCodeFormat, operationErrorMessageFormat),
-						operr.Code, operr.Message)
-				}
-				return fmt.Errorf("operation failed %+v: %s", op, operrs)
+				return newOperationError(op)
 			}
 		default:
 			return fmt.Errorf("unknown operation status %q: %+v", op.Status, op)
@@ -394,7 +549,7 @@ func (c *client) Retry(f func(opts ...googleapi.CallOption) (*compute.Operation,
 		if err == nil {
 			return op, nil
 		}
-		if !shouldRetryWithWait(c.hc.Transport, err, i) {
+		if !c.shouldRetry(callOperation(f), err, i, i) {
 			return nil, err
 		}
 	}
@@ -410,7 +565,7 @@ func (c *client) RetryBeta(f func(opts ...googleapi.CallOption) (*computeBeta.Op
 		if err == nil {
 			return op, nil
 		}
-		if !shouldRetryWithWait(c.hc.Transport, err, i) {
+		if !c.shouldRetry(callOperation(f), err, i, i) {
 			return nil, err
 		}
 	}
@@ -426,7 +581,7 @@ func (c *client) RetryAlpha(f func(opts ...googleapi.CallOption) (*computeAlpha.
 		if err == nil {
 			return op, nil
 		}
-		if !shouldRetryWithWait(c.hc.Transport, err, i) {
+		if !c.shouldRetry(callOperation(f), err, i, i) {
 			return nil, err
 		}
 	}
@@ -805,6 +960,38 @@ func (c *client) StopInstance(project, zone, name string) error {
 	return c.i.zoneOperationsWait(project, zone, op.Name)
 }
 
+// ResetInstance resets a GCE instance, like pressing its reset button.
+func (c *client) ResetInstance(project, zone, name string) error {
+	op, err := c.Retry(c.raw.Instances.Reset(project, zone, name).Do)
+	if err != nil {
+		return err
+	}
+
+	return c.i.zoneOperationsWait(project, zone, op.Name)
+}
+
+// SimulateMaintenanceEvent simulates a host maintenance event on a GCE
+// instance, which is live migrated or terminated as its scheduling says.
+func (c *client) SimulateMaintenanceEvent(project, zone, name string) error {
+	op, err := c.Retry(c.raw.Instances.SimulateMaintenanceEvent(project, zone, name).Do)
+	if err != nil {
+		return err
+	}
+
+	return c.i.zoneOperationsWait(project, zone, op.Name)
+}
+
+// SetScheduling sets the scheduling options of a GCE instance, e.g. whether
+// it is live migrated or terminated on host maintenance.
+func (c *client) SetScheduling(project, zone, name string, s *compute.Scheduling) error {
+	op, err := c.Retry(c.raw.Instances.SetScheduling(project, zone, name, s).Do)
+	if err != nil {
+		return err
+	}
+
+	return c.i.zoneOperationsWait(project, zone, op.Name)
+}
+
 // DeleteNetwork deletes a GCE network.
 func (c *client) DeleteNetwork(project, name string) error {
 	op, err := c.Retry(c.raw.Networks.Delete(project, name).Do)
@@ -857,7 +1044,7 @@ func (c *client) DeprecateImageAlpha(project, name string, deprecationstatus *co
 // GetMachineType gets a GCE MachineType.
 func (c *client) GetMachineType(project, zone, machineType string) (*compute.MachineType, error) {
 	mt, err := c.raw.MachineTypes.Get(project, zone, machineType).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("machineTypes.get", err, 1, 2) {
 		return c.raw.MachineTypes.Get(project, zone, machineType).Do()
 	}
 	return mt, err
@@ -872,7 +1059,7 @@ func (c *client) ListMachineTypes(project, zone string, opts ...ListCallOption)
 		call = opt.listCallOptionApply(call).(*compute.MachineTypesListCall)
 	}
 	for mtl, err := call.PageToken(pt).Do(); ; mtl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("machineTypes.list", err, 1, 2) {
 			mtl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -887,10 +1074,58 @@ func (c *client) ListMachineTypes(project, zone string, opts ...ListCallOption)
 	}
 }
 
+// ListAcceleratorTypes gets a list of GCE AcceleratorTypes available in a zone.
+func (c *client) ListAcceleratorTypes(project, zone string, opts ...ListCallOption) ([]*compute.AcceleratorType, error) {
+	var ats []*compute.AcceleratorType
+	var pt string
+	call := c.raw.AcceleratorTypes.List(project, zone)
+	for _, opt := range opts {
+		call = opt.listCallOptionApply(call).(*compute.AcceleratorTypesListCall)
+	}
+	for atl, err := call.PageToken(pt).Do(); ; atl, err = call.PageToken(pt).Do() {
+		if c.shouldRetry("acceleratorTypes.list", err, 1, 2) {
+			atl, err = call.PageToken(pt).Do()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ats = append(ats, atl.Items...)
+
+		if atl.NextPageToken == "" {
+			return ats, nil
+		}
+		pt = atl.NextPageToken
+	}
+}
+
+// ListDiskTypes gets a list of GCE DiskTypes available in a zone.
+func (c *client) ListDiskTypes(project, zone string, opts ...ListCallOption) ([]*compute.DiskType, error) {
+	var dts []*compute.DiskType
+	var pt string
+	call := c.raw.DiskTypes.List(project, zone)
+	for _, opt := range opts {
+		call = opt.listCallOptionApply(call).(*compute.DiskTypesListCall)
+	}
+	for dtl, err := call.PageToken(pt).Do(); ; dtl, err = call.PageToken(pt).Do() {
+		if c.shouldRetry("diskTypes.list", err, 1, 2) {
+			dtl, err = call.PageToken(pt).Do()
+		}
+		if err != nil {
+			return nil, err
+		}
+		dts = append(dts, dtl.Items...)
+
+		if dtl.NextPageToken == "" {
+			return dts, nil
+		}
+		pt = dtl.NextPageToken
+	}
+}
+
 // GetProject gets a GCE Project.
 func (c *client) GetProject(project string) (*compute.Project, error) {
 	p, err := c.raw.Projects.Get(project).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("projects.get", err, 1, 2) {
 		return c.raw.Projects.Get(project).Do()
 	}
 	return p, err
@@ -899,7 +1134,7 @@ func (c *client) GetProject(project string) (*compute.Project, error) {
 // GetSerialPortOutput gets the serial port output of a GCE instance.
 func (c *client) GetSerialPortOutput(project, zone, name string, port, start int64) (*compute.SerialPortOutput, error) {
 	sp, err := c.raw.Instances.GetSerialPortOutput(project, zone, name).Start(start).Port(port).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.getSerialPortOutput", err, 1, 2) {
 		return c.raw.Instances.GetSerialPortOutput(project, zone, name).Start(start).Port(port).Do()
 	}
 	return sp, err
@@ -908,7 +1143,7 @@ func (c *client) GetSerialPortOutput(project, zone, name string, port, start int
 // GetZone gets a GCE Zone.
 func (c *client) GetZone(project, zone string) (*compute.Zone, error) {
 	z, err := c.raw.Zones.Get(project, zone).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("zones.get", err, 1, 2) {
 		return c.raw.Zones.Get(project, zone).Do()
 	}
 	return z, err
@@ -923,7 +1158,7 @@ func (c *client) ListZones(project string, opts ...ListCallOption) ([]*compute.Z
 		call = opt.listCallOptionApply(call).(*compute.ZonesListCall)
 	}
 	for zl, err := call.PageToken(pt).Do(); ; zl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("zones.list", err, 1, 2) {
 			zl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -947,7 +1182,7 @@ func (c *client) ListRegions(project string, opts ...ListCallOption) ([]*compute
 		call = opt.listCallOptionApply(call).(*compute.RegionsListCall)
 	}
 	for rl, err := call.PageToken(pt).Do(); ; rl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("regions.list", err, 1, 2) {
 			rl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -965,7 +1200,7 @@ func (c *client) ListRegions(project string, opts ...ListCallOption) ([]*compute
 // GetInstance gets a GCE Instance using GA API.
 func (c *client) GetInstance(project, zone, name string) (*compute.Instance, error) {
 	i, err := c.raw.Instances.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.get", err, 1, 2) {
 		return c.raw.Instances.Get(project, zone, name).Do()
 	}
 	return i, err
@@ -974,7 +1209,7 @@ func (c *client) GetInstance(project, zone, name string) (*compute.Instance, err
 // GetInstanceAlpha gets a GCE Instance using Alpha API.
 func (c *client) GetInstanceAlpha(project, zone, name string) (*computeAlpha.Instance, error) {
 	i, err := c.rawAlpha.Instances.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.get", err, 1, 2) {
 		return c.rawAlpha.Instances.Get(project, zone, name).Do()
 	}
 	return i, err
@@ -983,32 +1218,49 @@ func (c *client) GetInstanceAlpha(project, zone, name string) (*computeAlpha.Ins
 // GetInstanceBeta gets a GCE Instance using Beta API.
 func (c *client) GetInstanceBeta(project, zone, name string) (*computeBeta.Instance, error) {
 	i, err := c.rawBeta.Instances.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.get", err, 1, 2) {
 		return c.rawBeta.Instances.Get(project, zone, name).Do()
 	}
 	return i, err
 }
 
-// AggregatedListInstances gets an aggregated list of GCE Instances.
+// AggregatedListInstances gets an aggregated list of GCE Instances. Scopes that
+// return warnings are skipped; use AggregatedListInstancesWithStatus to find out
+// which.
 func (c *client) AggregatedListInstances(project string, opts ...ListCallOption) ([]*compute.Instance, error) {
+	is, _, err := c.AggregatedListInstancesWithStatus(project, opts...)
+	return is, err
+}
+
+// AggregatedListInstancesWithStatus gets an aggregated list of GCE Instances and the
+// status of the scopes whose instances may be missing from it.
+func (c *client) AggregatedListInstancesWithStatus(project string, opts ...ListCallOption) ([]*compute.Instance, []ScopeStatus, error) {
 	var is []*compute.Instance
+	var ss []ScopeStatus
 	var pt string
 	call := c.raw.Instances.AggregatedList(project)
 	for _, opt := range opts {
 		call = opt.listCallOptionApply(call).(*compute.InstancesAggregatedListCall)
 	}
 	for ial, err := call.PageToken(pt).Do(); ; ial, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("instances.aggregatedList", err, 1, 2) {
 			ial, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		for _, isl := range ial.Items {
+		for scope, isl := range ial.Items {
 			is = append(is, isl.Instances...)
+			if isl.Warning != nil {
+				if st := scopeStatus(scope, isl.Warning.Code, isl.Warning.Message); st != nil {
+					ss = append(ss, *st)
+				}
+			}
 		}
+		ss = append(ss, unreachableScopes(ial.Unreachables)...)
 		if ial.NextPageToken == "" {
-			return is, nil
+			sort.Slice(ss, func(i, j int) bool { return ss[i].Scope < ss[j].Scope })
+			return is, ss, nil
 		}
 		pt = ial.NextPageToken
 	}
@@ -1023,7 +1275,7 @@ func (c *client) ListInstances(project, zone string, opts ...ListCallOption) ([]
 		call = opt.listCallOptionApply(call).(*compute.InstancesListCall)
 	}
 	for il, err := call.PageToken(pt).Do(); ; il, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("instances.list", err, 1, 2) {
 			il, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1041,7 +1293,7 @@ func (c *client) ListInstances(project, zone string, opts ...ListCallOption) ([]
 // GetDisk gets a GCE Disk.
 func (c *client) GetDisk(project, zone, name string) (*compute.Disk, error) {
 	d, err := c.raw.Disks.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("disks.get", err, 1, 2) {
 		return c.raw.Disks.Get(project, zone, name).Do()
 	}
 	return d, err
@@ -1050,7 +1302,7 @@ func (c *client) GetDisk(project, zone, name string) (*compute.Disk, error) {
 // GetDiskAlpha gets a GCE Disk.
 func (c *client) GetDiskAlpha(project, zone, name string) (*computeAlpha.Disk, error) {
 	d, err := c.rawAlpha.Disks.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("disks.get", err, 1, 2) {
 		return c.rawAlpha.Disks.Get(project, zone, name).Do()
 	}
 	return d, err
@@ -1059,32 +1311,49 @@ func (c *client) GetDiskAlpha(project, zone, name string) (*computeAlpha.Disk, e
 // GetDiskBeta gets a GCE Disk.
 func (c *client) GetDiskBeta(project, zone, name string) (*computeBeta.Disk, error) {
 	d, err := c.rawBeta.Disks.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("disks.get", err, 1, 2) {
 		return c.rawBeta.Disks.Get(project, zone, name).Do()
 	}
 	return d, err
 }
 
-// AggregatedListDisks gets an aggregated list of GCE Disks.
+// AggregatedListDisks gets an aggregated list of GCE Disks. Scopes that
+// return warnings are skipped; use AggregatedListDisksWithStatus to find out
+// which.
 func (c *client) AggregatedListDisks(project string, opts ...ListCallOption) ([]*compute.Disk, error) {
+	is, _, err := c.AggregatedListDisksWithStatus(project, opts...)
+	return is, err
+}
+
+// AggregatedListDisksWithStatus gets an aggregated list of GCE Disks and the
+// status of the scopes whose disks may be missing from it.
+func (c *client) AggregatedListDisksWithStatus(project string, opts ...ListCallOption) ([]*compute.Disk, []ScopeStatus, error) {
 	var is []*compute.Disk
+	var ss []ScopeStatus
 	var pt string
 	call := c.raw.Disks.AggregatedList(project)
 	for _, opt := range opts {
 		call = opt.listCallOptionApply(call).(*compute.DisksAggregatedListCall)
 	}
 	for ial, err := call.PageToken(pt).Do(); ; ial, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("disks.aggregatedList", err, 1, 2) {
 			ial, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		for _, isl := range ial.Items {
+		for scope, isl := range ial.Items {
 			is = append(is, isl.Disks...)
+			if isl.Warning != nil {
+				if st := scopeStatus(scope, isl.Warning.Code, isl.Warning.Message); st != nil {
+					ss = append(ss, *st)
+				}
+			}
 		}
+		ss = append(ss, unreachableScopes(ial.Unreachables)...)
 		if ial.NextPageToken == "" {
-			return is, nil
+			sort.Slice(ss, func(i, j int) bool { return ss[i].Scope < ss[j].Scope })
+			return is, ss, nil
 		}
 		pt = ial.NextPageToken
 	}
@@ -1099,7 +1368,7 @@ func (c *client) ListDisks(project, zone string, opts ...ListCallOption) ([]*com
 		call = opt.listCallOptionApply(call).(*compute.DisksListCall)
 	}
 	for dl, err := call.PageToken(pt).Do(); ; dl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("disks.list", err, 1, 2) {
 			dl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1117,7 +1386,7 @@ func (c *client) ListDisks(project, zone string, opts ...ListCallOption) ([]*com
 // GetForwardingRule gets a GCE ForwardingRule.
 func (c *client) GetForwardingRule(project, region, name string) (*compute.ForwardingRule, error) {
 	n, err := c.raw.ForwardingRules.Get(project, region, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("forwardingRules.get", err, 1, 2) {
 		return c.raw.ForwardingRules.Get(project, region, name).Do()
 	}
 	return n, err
@@ -1132,7 +1401,7 @@ func (c *client) ListForwardingRules(project, region string, opts ...ListCallOpt
 		call = opt.listCallOptionApply(call).(*compute.ForwardingRulesListCall)
 	}
 	for frl, err := call.PageToken(pt).Do(); ; frl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("forwardingRules.list", err, 1, 2) {
 			frl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1150,7 +1419,7 @@ func (c *client) ListForwardingRules(project, region string, opts ...ListCallOpt
 // GetFirewallRule gets a GCE FirewallRule.
 func (c *client) GetFirewallRule(project, name string) (*compute.Firewall, error) {
 	i, err := c.raw.Firewalls.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("firewalls.get", err, 1, 2) {
 		return c.raw.Firewalls.Get(project, name).Do()
 	}
 	return i, err
@@ -1165,7 +1434,7 @@ func (c *client) ListFirewallRules(project string, opts ...ListCallOption) ([]*c
 		call = opt.listCallOptionApply(call).(*compute.FirewallsListCall)
 	}
 	for il, err := call.PageToken(pt).Do(); ; il, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("firewalls.list", err, 1, 2) {
 			il, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1183,7 +1452,7 @@ func (c *client) ListFirewallRules(project string, opts ...ListCallOption) ([]*c
 // GetImage gets a GCE Image.
 func (c *client) GetImage(project, name string) (*compute.Image, error) {
 	i, err := c.raw.Images.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("images.get", err, 1, 2) {
 		return c.raw.Images.Get(project, name).Do()
 	}
 	return i, err
@@ -1192,7 +1461,7 @@ func (c *client) GetImage(project, name string) (*compute.Image, error) {
 // GetImageAlpha gets a GCE Image using Alpha API
 func (c *client) GetImageAlpha(project, name string) (*computeAlpha.Image, error) {
 	i, err := c.rawAlpha.Images.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("images.get", err, 1, 2) {
 		return c.rawAlpha.Images.Get(project, name).Do()
 	}
 	return i, err
@@ -1201,7 +1470,7 @@ func (c *client) GetImageAlpha(project, name string) (*computeAlpha.Image, error
 // GetImageBeta gets a GCE Image using Beta API
 func (c *client) GetImageBeta(project, name string) (*computeBeta.Image, error) {
 	i, err := c.rawBeta.Images.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("images.get", err, 1, 2) {
 		return c.rawBeta.Images.Get(project, name).Do()
 	}
 	return i, err
@@ -1210,12 +1479,35 @@ func (c *client) GetImageBeta(project, name string) (*computeBeta.Image, error)
 // GetImageFromFamily gets a GCE Image from an image family.
 func (c *client) GetImageFromFamily(project, family string) (*compute.Image, error) {
 	i, err := c.raw.Images.GetFromFamily(project, family).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("images.getFromFamily", err, 1, 2) {
 		return c.raw.Images.GetFromFamily(project, family).Do()
 	}
 	return i, err
 }
 
+// GetImageFromFamilies gets a GCE Image from an image family, looking the
+// family up in projects in order, e.g. an internal mirror before the public
+// image project. It returns the image and the project it was found in. A
+// project that doesn't have the family, or that can't be read, is skipped.
+func (c *client) GetImageFromFamilies(projects []string, family string) (*compute.Image, string, error) {
+	if len(projects) == 0 {
+		return nil, "", fmt.Errorf("no project given to look image family %q up in", family)
+	}
+	var errs []string
+	for _, project := range projects {
+		i, err := c.i.GetImageFromFamily(project, family)
+		if err == nil {
+			return i, project, nil
+		}
+		apiErr, ok := err.(*googleapi.Error)
+		if !ok || (apiErr.Code != http.StatusNotFound && apiErr.Code != http.StatusForbidden) {
+			return nil, "", err
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", project, err))
+	}
+	return nil, "", fmt.Errorf("image family %q not found in any project: %s", family, strings.Join(errs, "; "))
+}
+
 // ListImages gets a list of GCE Images.
 func (c *client) ListImages(project string, opts ...ListCallOption) ([]*compute.Image, error) {
 	var is []*compute.Image
@@ -1225,7 +1517,7 @@ func (c *client) ListImages(project string, opts ...ListCallOption) ([]*compute.
 		call = opt.listCallOptionApply(call).(*compute.ImagesListCall)
 	}
 	for il, err := call.PageToken(pt).Do(); ; il, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("images.list", err, 1, 2) {
 			il, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1250,7 +1542,7 @@ func (c *client) ListImagesAlpha(project string, opts ...ListCallOption) ([]*com
 		call = opt.listCallOptionApply(call).(*computeAlpha.ImagesListCall)
 	}
 	for il, err := call.PageToken(pt).Do(); ; il, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("images.list", err, 1, 2) {
 			il, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1288,7 +1580,7 @@ func (c *client) CreateSnapshot(project, zone, disk string, s *compute.Snapshot)
 // GetSnapshot gets a GCE Snapshot.
 func (c *client) GetSnapshot(project, name string) (*compute.Snapshot, error) {
 	n, err := c.raw.Snapshots.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("snapshots.get", err, 1, 2) {
 		return c.raw.Snapshots.Get(project, name).Do()
 	}
 	return n, err
@@ -1313,7 +1605,7 @@ func (c *client) ListSnapshots(project string, opts ...ListCallOption) ([]*compu
 		call = opt.listCallOptionApply(call).(*compute.SnapshotsListCall)
 	}
 	for sl, err := call.PageToken(pt).Do(); ; sl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("snapshots.list", err, 1, 2) {
 			sl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1331,7 +1623,7 @@ func (c *client) ListSnapshots(project string, opts ...ListCallOption) ([]*compu
 // GetNetwork gets a GCE Network.
 func (c *client) GetNetwork(project, name string) (*compute.Network, error) {
 	n, err := c.raw.Networks.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("networks.get", err, 1, 2) {
 		return c.raw.Networks.Get(project, name).Do()
 	}
 	return n, err
@@ -1346,7 +1638,7 @@ func (c *client) ListNetworks(project string, opts ...ListCallOption) ([]*comput
 		call = opt.listCallOptionApply(call).(*compute.NetworksListCall)
 	}
 	for nl, err := call.PageToken(pt).Do(); ; nl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("networks.list", err, 1, 2) {
 			nl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1364,34 +1656,51 @@ func (c *client) ListNetworks(project string, opts ...ListCallOption) ([]*comput
 // GetSubnetwork gets a GCE subnetwork.
 func (c *client) GetSubnetwork(project, region, name string) (*compute.Subnetwork, error) {
 	n, err := c.raw.Subnetworks.Get(project, region, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("subnetworks.get", err, 1, 2) {
 		return c.raw.Subnetworks.Get(project, region, name).Do()
 	}
 	return n, err
 }
 
-// AggregatedListSubnetworks gets an aggregated list of GCE Subnetworks.
+// AggregatedListSubnetworks gets an aggregated list of GCE Subnetworks. Scopes that
+// return warnings are skipped; use AggregatedListSubnetworksWithStatus to find out
+// which.
 func (c *client) AggregatedListSubnetworks(project string, opts ...ListCallOption) ([]*compute.Subnetwork, error) {
-	var ss []*compute.Subnetwork
+	sns, _, err := c.AggregatedListSubnetworksWithStatus(project, opts...)
+	return sns, err
+}
+
+// AggregatedListSubnetworksWithStatus gets an aggregated list of GCE Subnetworks and the
+// status of the scopes whose subnetworks may be missing from it.
+func (c *client) AggregatedListSubnetworksWithStatus(project string, opts ...ListCallOption) ([]*compute.Subnetwork, []ScopeStatus, error) {
+	var sns []*compute.Subnetwork
+	var ss []ScopeStatus
 	var pt string
 	call := c.raw.Subnetworks.AggregatedList(project)
 	for _, opt := range opts {
 		call = opt.listCallOptionApply(call).(*compute.SubnetworksAggregatedListCall)
 	}
-	for sal, err := call.PageToken(pt).Do(); ; sal, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
-			sal, err = call.PageToken(pt).Do()
+	for snal, err := call.PageToken(pt).Do(); ; snal, err = call.PageToken(pt).Do() {
+		if c.shouldRetry("subnetworks.aggregatedList", err, 1, 2) {
+			snal, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		for _, sl := range sal.Items {
-			ss = append(ss, sl.Subnetworks...)
+		for scope, snl := range snal.Items {
+			sns = append(sns, snl.Subnetworks...)
+			if snl.Warning != nil {
+				if st := scopeStatus(scope, snl.Warning.Code, snl.Warning.Message); st != nil {
+					ss = append(ss, *st)
+				}
+			}
 		}
-		if sal.NextPageToken == "" {
-			return ss, nil
+		ss = append(ss, unreachableScopes(snal.Unreachables)...)
+		if snal.NextPageToken == "" {
+			sort.Slice(ss, func(i, j int) bool { return ss[i].Scope < ss[j].Scope })
+			return sns, ss, nil
 		}
-		pt = sal.NextPageToken
+		pt = snal.NextPageToken
 	}
 }
 
@@ -1404,7 +1713,7 @@ func (c *client) ListSubnetworks(project, region string, opts ...ListCallOption)
 		call = opt.listCallOptionApply(call).(*compute.SubnetworksListCall)
 	}
 	for nl, err := call.PageToken(pt).Do(); ; nl, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("subnetworks.list", err, 1, 2) {
 			nl, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1422,7 +1731,7 @@ func (c *client) ListSubnetworks(project, region string, opts ...ListCallOption)
 // GetTargetInstance gets a GCE TargetInstance.
 func (c *client) GetTargetInstance(project, zone, name string) (*compute.TargetInstance, error) {
 	n, err := c.raw.TargetInstances.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("targetInstances.get", err, 1, 2) {
 		return c.raw.TargetInstances.Get(project, zone, name).Do()
 	}
 	return n, err
@@ -1437,7 +1746,7 @@ func (c *client) ListTargetInstances(project, zone string, opts ...ListCallOptio
 		call = opt.listCallOptionApply(call).(*compute.TargetInstancesListCall)
 	}
 	for til, err := call.PageToken(pt).Do(); ; til, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("targetInstances.list", err, 1, 2) {
 			til, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1455,7 +1764,7 @@ func (c *client) ListTargetInstances(project, zone string, opts ...ListCallOptio
 // GetLicense gets a GCE License.
 func (c *client) GetLicense(project, name string) (*compute.License, error) {
 	l, err := c.raw.Licenses.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("licenses.get", err, 1, 2) {
 		return c.raw.Licenses.Get(project, name).Do()
 	}
 	return l, err
@@ -1470,7 +1779,7 @@ func (c *client) ListLicenses(project string, opts ...ListCallOption) ([]*comput
 		call = opt.listCallOptionApply(call).(*compute.LicensesListCall)
 	}
 	for ll, err := call.PageToken(pt).Do(); ; ll, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("licenses.list", err, 1, 2) {
 			ll, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1488,7 +1797,7 @@ func (c *client) ListLicenses(project string, opts ...ListCallOption) ([]*comput
 // InstanceStatus returns an instances Status.
 func (c *client) InstanceStatus(project, zone, name string) (string, error) {
 	is, err := c.raw.Instances.Get(project, zone, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.get", err, 1, 2) {
 		is, err = c.raw.Instances.Get(project, zone, name).Do()
 	}
 
@@ -1553,7 +1862,7 @@ func (c *client) GetGuestAttributes(project, zone, name, queryPath, variableKey
 		call = call.VariableKey(variableKey)
 	}
 	a, err := call.Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("instances.getGuestAttributes", err, 1, 2) {
 		return call.Do()
 	}
 	return a, err
@@ -1568,7 +1877,7 @@ func (c *client) ListMachineImages(project string, opts ...ListCallOption) ([]*c
 		call = opt.listCallOptionApply(call).(*compute.MachineImagesListCall)
 	}
 	for il, err := call.PageToken(pt).Do(); ; il, err = call.PageToken(pt).Do() {
-		if shouldRetryWithWait(c.hc.Transport, err, 2) {
+		if c.shouldRetry("machineImages.list", err, 1, 2) {
 			il, err = call.PageToken(pt).Do()
 		}
 		if err != nil {
@@ -1617,7 +1926,7 @@ func (c *client) CreateMachineImage(project string, mi *compute.MachineImage) er
 // GetMachineImage gets a GCE Machine Image.
 func (c *client) GetMachineImage(project, name string) (*compute.MachineImage, error) {
 	i, err := c.raw.MachineImages.Get(project, name).Do()
-	if shouldRetryWithWait(c.hc.Transport, err, 2) {
+	if c.shouldRetry("machineImages.get", err, 1, 2) {
 		return c.raw.MachineImages.Get(project, name).Do()
 	}
 	return i, err
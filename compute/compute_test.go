@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/kylelemons/godebug/pretty"
 	computeAlpha "google.golang.org/api/compute/v0.alpha"
@@ -485,3 +486,416 @@ func TestDetachDisk(t *testing.T) {
 		t.Fatalf("error running DetachDisk: %v", err)
 	}
 }
+
+func TestGetZoneRegion(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	calls := 0
+	c.GetZoneFn = func(project, zone string) (*compute.Zone, error) {
+		calls++
+		return &compute.Zone{Name: zone, Region: "https://www.googleapis.com/compute/v1/projects/p/regions/us-west1"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		region, err := c.GetZoneRegion(testProject, "us-west1-b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if region != "us-west1" {
+			t.Errorf("got region %q, want %q", region, "us-west1")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("got %d GetZone calls, want 1", calls)
+	}
+}
+
+func TestResolveZone(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	c.ListZonesFn = func(project string, opts ...ListCallOption) ([]*compute.Zone, error) {
+		return []*compute.Zone{
+			{Name: "us-west1-c", Region: "regions/us-west1", Status: "UP", AvailableCpuPlatforms: []string{"Intel Skylake"}},
+			{Name: "us-west1-b", Region: "regions/us-west1", Status: "UP"},
+			{Name: "us-west1-a", Region: "regions/us-west1", Status: "DOWN", AvailableCpuPlatforms: []string{"Intel Skylake"}},
+			{Name: "us-east1-b", Region: "regions/us-east1", Status: "UP", AvailableCpuPlatforms: []string{"Intel Skylake"}},
+		}, nil
+	}
+	c.GetMachineTypeFn = func(project, zone, machineType string) (*compute.MachineType, error) {
+		if machineType == "n2-standard-2" && zone == "us-east1-b" {
+			return nil, &googleapi.Error{Code: http.StatusNotFound}
+		}
+		return &compute.MachineType{Name: machineType}, nil
+	}
+	c.ListAcceleratorTypesFn = func(project, zone string, opts ...ListCallOption) ([]*compute.AcceleratorType, error) {
+		if zone == "us-west1-b" {
+			return []*compute.AcceleratorType{{Name: "nvidia-tesla-t4"}}, nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		desc    string
+		prefs   ZonePreferences
+		want    string
+		wantErr bool
+	}{
+		{"no constraints", ZonePreferences{}, "us-east1-b", false},
+		{"preferred zone", ZonePreferences{Zones: []string{"us-west1-b"}}, "us-west1-b", false},
+		{"preferred zone down", ZonePreferences{Zones: []string{"us-west1-a"}}, "us-east1-b", false},
+		{"region", ZonePreferences{Region: "us-west1"}, "us-west1-b", false},
+		{"machine type", ZonePreferences{MachineType: "n2-standard-2"}, "us-west1-b", false},
+		{"accelerator", ZonePreferences{AcceleratorType: "nvidia-tesla-t4"}, "us-west1-b", false},
+		{"cpu platform", ZonePreferences{Region: "us-west1", MinCPUPlatform: "Intel Skylake"}, "us-west1-c", false},
+		{"no match", ZonePreferences{AcceleratorType: "nvidia-tesla-t4", MinCPUPlatform: "Intel Skylake"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := c.ResolveZone(testProject, tt.prefs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error state, wantErr=%t, err: %v", tt.desc, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got zone %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestGetImageFromFamilies(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	var tried []string
+	c.GetImageFromFamilyFn = func(project, family string) (*compute.Image, error) {
+		tried = append(tried, project)
+		switch project {
+		case "mirror":
+			return nil, &googleapi.Error{Code: http.StatusNotFound}
+		case "restricted":
+			return nil, &googleapi.Error{Code: http.StatusForbidden}
+		case "broken":
+			return nil, &googleapi.Error{Code: http.StatusInternalServerError}
+		}
+		return &compute.Image{Name: family + "-v1"}, nil
+	}
+
+	tests := []struct {
+		desc        string
+		projects    []string
+		wantProject string
+		wantTried   []string
+		wantErr     bool
+	}{
+		{"first project", []string{"public", "mirror"}, "public", []string{"public"}, false},
+		{"fallback", []string{"mirror", "restricted", "public"}, "public", []string{"mirror", "restricted", "public"}, false},
+		{"not found anywhere", []string{"mirror", "restricted"}, "", []string{"mirror", "restricted"}, true},
+		{"other error", []string{"broken", "public"}, "", []string{"broken"}, true},
+		{"no projects", nil, "", nil, true},
+	}
+	for _, tt := range tests {
+		tried = nil
+		img, project, err := c.GetImageFromFamilies(tt.projects, "debian-11")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error state, wantErr=%t, err: %v", tt.desc, tt.wantErr, err)
+		}
+		if project != tt.wantProject {
+			t.Errorf("%s: got project %q, want %q", tt.desc, project, tt.wantProject)
+		}
+		if !tt.wantErr && img.Name != "debian-11-v1" {
+			t.Errorf("%s: got image %q, want %q", tt.desc, img.Name, "debian-11-v1")
+		}
+		if diff := pretty.Compare(tried, tt.wantTried); diff != "" {
+			t.Errorf("%s: projects tried not as expected, diff: %s", tt.desc, diff)
+		}
+	}
+}
+
+func TestAggregatedListInstancesWithStatus(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.String() == fmt.Sprintf("/projects/%s/aggregated/instances?alt=json&pageToken=&prettyPrint=false&returnPartialSuccess=true", testProject) {
+			fmt.Fprint(w, `{
+				"items": {
+					"zones/a": {"instances": [{"name": "i1"}]},
+					"zones/b": {"warning": {"code": "NO_RESULTS_ON_PAGE", "message": "empty"}},
+					"zones/c": {"warning": {"code": "UNREACHABLE", "message": "down"}}
+				},
+				"unreachables": ["zones/d"]
+			}`)
+		} else {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "URL and Method not recognized:", r.Method, r.URL)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	is, ss, err := c.AggregatedListInstancesWithStatus(testProject, ReturnPartialSuccess(true))
+	if err != nil {
+		t.Fatalf("error running AggregatedListInstancesWithStatus: %v", err)
+	}
+	if len(is) != 1 || is[0].Name != "i1" {
+		t.Errorf("unexpected instances: %+v", is)
+	}
+	want := []ScopeStatus{
+		{Scope: "zones/c", Code: "UNREACHABLE", Message: "down"},
+		{Scope: "zones/d", Code: "UNREACHABLE", Message: "scope could not be reached"},
+	}
+	if diff := pretty.Compare(ss, want); diff != "" {
+		t.Errorf("scope status does not match expectation: (-got +want)\n%s", diff)
+	}
+}
+
+func TestAuditRecorder(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/disks?alt=json&prettyPrint=false", testProject, testZone) {
+			fmt.Fprint(w, `{}`)
+		} else if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/operations//wait?alt=json&prettyPrint=false", testProject, testZone) {
+			fmt.Fprint(w, `{"Status":"DONE"}`)
+		} else if r.Method == "GET" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/disks/%s?alt=json&prettyPrint=false", testProject, testZone, testDisk) {
+			fmt.Fprint(w, `{}`)
+		} else {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "URL and Method not recognized:", r.Method, r.URL)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	if got := c.client.WithAuditCaller("step"); got != Client(c) {
+		t.Error("WithAuditCaller without a recorder should return the client itself")
+	}
+
+	var buf bytes.Buffer
+	c.SetAuditRecorder(NewAuditLog(&buf))
+	ac := c.client.WithAuditCaller("step")
+	if err := ac.CreateDisk(testProject, testZone, &compute.Disk{Name: testDisk}); err != nil {
+		t.Fatalf("error running CreateDisk: %v", err)
+	}
+	if _, err := ac.GetDisk(testProject, testZone, testDisk); err != nil {
+		t.Fatalf("error running GetDisk: %v", err)
+	}
+
+	var records []AuditRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1: %+v", len(records), records)
+	}
+	r := records[0]
+	wantURL := fmt.Sprintf("%s/projects/%s/zones/%s/disks", svr.URL, testProject, testZone)
+	if r.Caller != "step" || r.Method != "POST" || r.URL != wantURL || r.Status != 200 || len(r.RequestHash) != 64 {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/disks?alt=json&prettyPrint=false", testProject, testZone) {
+			fmt.Fprint(w, `{"name": "op"}`)
+		} else if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/operations/op/wait?alt=json&prettyPrint=false", testProject, testZone) {
+			fmt.Fprint(w, `{"name": "op", "targetLink": "disk-link", "status": "DONE", "error": {"errors": [
+				{"code": "QUOTA_EXCEEDED", "message": "Quota 'SSD_TOTAL_GB' exceeded.  Limit: 500.0 in region us-central1."},
+				{"code": "RESOURCE_OPERATION_RATE_EXCEEDED", "location": "disk", "message": "slow down"}
+			]}}`)
+		} else {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "URL and Method not recognized:", r.Method, r.URL)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	err = c.CreateDisk(testProject, testZone, &compute.Disk{Name: testDisk})
+	oe, ok := err.(*OperationError)
+	if !ok {
+		t.Fatalf("expected *OperationError, got %T: %v", err, err)
+	}
+	want := &OperationError{
+		Operation:  "op",
+		TargetLink: "disk-link",
+		Errors: []OperationErrorDetail{
+			{Code: "QUOTA_EXCEEDED", Message: "Quota 'SSD_TOTAL_GB' exceeded.  Limit: 500.0 in region us-central1.", QuotaMetric: "SSD_TOTAL_GB", QuotaLimit: "500.0", QuotaScope: "region us-central1"},
+			{Code: "RESOURCE_OPERATION_RATE_EXCEEDED", Location: "disk", Message: "slow down"},
+		},
+	}
+	if diff := pretty.Compare(oe, want); diff != "" {
+		t.Errorf("operation error does not match expectation: (-got +want)\n%s", diff)
+	}
+	if got, want := oe.Summary(), "QUOTA_EXCEEDED: SSD_TOTAL_GB in region us-central1; RESOURCE_OPERATION_RATE_EXCEEDED"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if !oe.HasCode("QUOTA_EXCEEDED") || oe.HasCode("NOT_FOUND") {
+		t.Error("unexpected HasCode result")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var requests int
+	fail := true
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	var opened int
+	b := &RetryBudget{MaxRetries: 1, MaxConsecutiveFailures: 3, OnOpen: func() { opened++ }}
+	// Spend the only retry, so failed calls are not retried.
+	b.spend()
+	c.SetRetryBudget(b)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetDisk(testProject, testZone, testDisk); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+	if !b.Open() || opened != 1 {
+		t.Errorf("circuit breaker not opened once: open=%t opened=%d", b.Open(), opened)
+	}
+
+	_, err = c.GetDisk(testProject, testZone, testDisk)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got error %v, want %v", err, ErrCircuitOpen)
+	}
+	if requests != 3 {
+		t.Errorf("API called while the circuit breaker is open")
+	}
+
+	fail = false
+	c.SetRetryBudget(nil)
+	if _, err := c.GetDisk(testProject, testZone, testDisk); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if requests != 4 {
+		t.Errorf("API not called after removing the retry budget")
+	}
+}
+
+func TestSetOperationPollInterval(t *testing.T) {
+	var waits int
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/instances/%s/start?alt=json&prettyPrint=false", testProject, testZone, testInstance) {
+			fmt.Fprint(w, `{"name": "op"}`)
+		} else if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/operations/op/wait?alt=json&prettyPrint=false", testProject, testZone) {
+			waits++
+			if waits < 3 {
+				fmt.Fprint(w, `{"name": "op", "status": "RUNNING"}`)
+				return
+			}
+			fmt.Fprint(w, `{"name": "op", "status": "DONE"}`)
+		} else {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "URL and Method not recognized:", r.Method, r.URL)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	c.SetOperationPollInterval(time.Millisecond)
+	start := time.Now()
+	if err := c.StartInstance(testProject, testZone, testInstance); err != nil {
+		t.Fatalf("error running Start: %v", err)
+	}
+	if waits != 3 {
+		t.Errorf("got %d operation waits, want 3", waits)
+	}
+	if d := time.Since(start); d >= 2*defaultOperationPollInterval {
+		t.Errorf("operation polled at the default interval, took %s", d)
+	}
+}
+
+func TestAPIUsage(t *testing.T) {
+	var rateLimited bool
+	svr, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/instances/%s/start?alt=json&prettyPrint=false", testProject, testZone, testInstance) {
+			fmt.Fprint(w, `{"name": "op"}`)
+		} else if r.Method == "POST" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/operations/op/wait?alt=json&prettyPrint=false", testProject, testZone) {
+			fmt.Fprint(w, `{"name": "op", "status": "DONE"}`)
+		} else if r.Method == "GET" && r.URL.String() == fmt.Sprintf("/projects/%s/zones/%s/instances/%s?alt=json&prettyPrint=false", testProject, testZone, testInstance) {
+			if !rateLimited {
+				rateLimited = true
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		} else {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "URL and Method not recognized:", r.Method, r.URL)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svr.Close()
+
+	if err := c.StartInstance(testProject, testZone, testInstance); err != nil {
+		t.Fatalf("error running Start: %v", err)
+	}
+	if _, err := c.GetInstance(testProject, testZone, testInstance); err != nil {
+		t.Fatalf("error running GetInstance: %v", err)
+	}
+	want := []APIUsage{
+		{Project: testProject, Method: "instances.get", Calls: 2, RateLimited: 1},
+		{Project: testProject, Method: "instances.start", Calls: 1},
+		{Project: testProject, Method: "operations.wait", Calls: 1},
+	}
+	if diff := pretty.Compare(c.APIUsage(), want); diff != "" {
+		t.Errorf("API usage does not match expectation: (-got +want)\n%s", diff)
+	}
+}
+
+func TestAPIMethod(t *testing.T) {
+	tests := []struct {
+		method, path, wantProject, wantMethod string
+	}{
+		{"GET", "/compute/v1/projects/p", "p", "projects.get"},
+		{"POST", "/compute/v1/projects/p/setCommonInstanceMetadata", "p", "projects.setCommonInstanceMetadata"},
+		{"GET", "/compute/v1/projects/p/zones", "p", "zones.list"},
+		{"GET", "/compute/v1/projects/p/zones/z", "p", "zones.get"},
+		{"POST", "/compute/v1/projects/p/zones/z/instances", "p", "instances.insert"},
+		{"GET", "/compute/v1/projects/p/zones/z/instances", "p", "instances.list"},
+		{"DELETE", "/compute/v1/projects/p/zones/z/instances/i", "p", "instances.delete"},
+		{"GET", "/compute/v1/projects/p/zones/z/instances/i/serialPort", "p", "instances.serialPort"},
+		{"GET", "/compute/v1/projects/p/aggregated/disks", "p", "disks.aggregatedList"},
+		{"GET", "/compute/v1/projects/p/regions/r/subnetworks/s", "p", "subnetworks.get"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "https://compute.googleapis.com"+tt.path, nil)
+		if project, method := apiMethod(req); project != tt.wantProject || method != tt.wantMethod {
+			t.Errorf("%s %s: got (%q, %q), want (%q, %q)", tt.method, tt.path, project, method, tt.wantProject, tt.wantMethod)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Hooks are functions called on the API calls of a client, and of the copies
+// returned by WithAuditCaller, e.g. to implement metrics, logging or custom
+// backoffs. Unset hooks are not called. Hooks are called concurrently by
+// concurrent API calls.
+type Hooks struct {
+	// OnRequest is called before an API request is sent, retries included.
+	OnRequest func(r Request)
+	// OnError is called when an API request fails, with the error or, for an
+	// HTTP error status, a *googleapi.Error holding the status code.
+	OnError func(r Request, err error)
+	// OnRetry is called before a failed API call is retried. It returns how
+	// long to wait before retrying, 0 to wait the default r.Delay.
+	OnRetry func(r RetryInfo) time.Duration
+}
+
+// Request is an API request.
+type Request struct {
+	// Project of the request, if any.
+	Project string
+	// Method is the API method, e.g. "instances.insert", as in APIUsage.
+	Method string
+	// HTTPMethod and URL of the request.
+	HTTPMethod, URL string
+}
+
+// RetryInfo is a failed API call about to be retried.
+type RetryInfo struct {
+	// Operation is the API method retried, e.g. "instances.attachDisk", if
+	// known.
+	Operation string
+	// Attempt is the number of the attempt that failed, from 1.
+	Attempt int
+	// Err is the error of the failed attempt.
+	Err error
+	// Delay is the default wait before retrying.
+	Delay time.Duration
+}
+
+// hooksState holds the hooks of a client. It is shared by the copies of a
+// client returned by WithAuditCaller.
+type hooksState struct {
+	mu    sync.Mutex
+	hooks *Hooks
+}
+
+func (h *hooksState) get() *Hooks {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hooks
+}
+
+// SetHooks sets the hooks called on the API calls of the client, and of the
+// copies returned by WithAuditCaller. A nil h removes them.
+func (c *client) SetHooks(h *Hooks) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.hooks = h
+}
+
+// hooksTransport calls the OnRequest and OnError hooks.
+type hooksTransport struct {
+	base  http.RoundTripper
+	hooks *hooksState
+}
+
+func (t *hooksTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	h := t.hooks.get()
+	if h == nil || (h.OnRequest == nil && h.OnError == nil) {
+		return base.RoundTrip(req)
+	}
+	project, method := apiMethod(req)
+	r := Request{Project: project, Method: method, HTTPMethod: req.Method, URL: req.URL.String()}
+	if h.OnRequest != nil {
+		h.OnRequest(r)
+	}
+	resp, err := base.RoundTrip(req)
+	if h.OnError != nil {
+		switch {
+		case err != nil:
+			h.OnError(r, err)
+		case resp.StatusCode >= 400:
+			h.OnError(r, &googleapi.Error{Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Header: resp.Header})
+		}
+	}
+	return resp, err
+}
+
+// retryDelay returns how long to wait before retrying the failed attempt
+// of operation: the OnRetry hook decides, if set, else delay.
+func (c *client) retryDelay(operation string, err error, attempt int, delay time.Duration) time.Duration {
+	if c.hooks == nil {
+		return delay
+	}
+	h := c.hooks.get()
+	if h == nil || h.OnRetry == nil {
+		return delay
+	}
+	if d := h.OnRetry(RetryInfo{Operation: operation, Attempt: attempt, Err: err, Delay: delay}); d > 0 {
+		return d
+	}
+	return delay
+}
+
+// services are the names of the services of the compute API, e.g.
+// "ZoneOperations", longest first.
+var services = func() []string {
+	var ss []string
+	t := reflect.TypeOf(compute.Service{})
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Type.Kind() == reflect.Ptr && strings.HasSuffix(f.Type.Elem().Name(), "Service") {
+			ss = append(ss, f.Name)
+		}
+	}
+	sort.Slice(ss, func(i, j int) bool { return len(ss[i]) > len(ss[j]) })
+	return ss
+}()
+
+// callOperation returns the API method of f, the Do method of an API call
+// such as (*InstancesAttachDiskCall).Do, e.g. "instances.attachDisk", or ""
+// if f is not one.
+func callOperation(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	// e.g. google.golang.org/api/compute/v1.(*InstancesAttachDiskCall).Do-fm
+	name := fn.Name()
+	i := strings.Index(name, ".(*")
+	j := strings.Index(name, "Call).Do")
+	if i == -1 || j < i {
+		return ""
+	}
+	call := name[i+len(".(*") : j]
+	for _, s := range services {
+		if strings.HasPrefix(call, s) && len(call) > len(s) {
+			return lowerFirst(s) + "." + lowerFirst(call[len(s):])
+		}
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
@@ -0,0 +1,116 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	_, c, err := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/attachDisk") {
+			mu.Lock()
+			attempts++
+			n := attempts
+			mu.Unlock()
+			if n == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintln(w, "unavailable")
+				return
+			}
+		}
+		fmt.Fprintln(w, `{"name": "op", "status": "DONE"}`)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	var errs []int
+	var retries []RetryInfo
+	c.SetHooks(&Hooks{
+		OnRequest: func(r Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r.Project+" "+r.Method)
+		},
+		OnError: func(r Request, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if apiErr, ok := err.(*googleapi.Error); ok {
+				errs = append(errs, apiErr.Code)
+			}
+		},
+		OnRetry: func(r RetryInfo) time.Duration {
+			mu.Lock()
+			defer mu.Unlock()
+			retries = append(retries, r)
+			return time.Millisecond
+		},
+	})
+
+	if err := c.AttachDisk("p", "z", "i", &compute.AttachedDisk{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantRequests := []string{"p instances.attachDisk", "p instances.attachDisk", "p operations.wait"}
+	if fmt.Sprint(requests) != fmt.Sprint(wantRequests) {
+		t.Errorf("got requests %q, want %q", requests, wantRequests)
+	}
+	if len(errs) != 1 || errs[0] != http.StatusServiceUnavailable {
+		t.Errorf("got errors %v, want [503]", errs)
+	}
+	if len(retries) != 1 || retries[0].Operation != "instances.attachDisk" || retries[0].Attempt != 1 || retries[0].Delay < time.Second {
+		t.Errorf("got retries %+v, want one of instances.attachDisk attempt 1 with the default delay", retries)
+	}
+
+	c.SetHooks(nil)
+	requests = nil
+	if _, err := c.GetZone("p", "z"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("hooks called after being removed: %q", requests)
+	}
+}
+
+func TestCallOperation(t *testing.T) {
+	svc := &compute.Service{}
+	svc.Instances = compute.NewInstancesService(svc)
+	svc.ZoneOperations = compute.NewZoneOperationsService(svc)
+	tests := []struct {
+		desc string
+		f    interface{}
+		want string
+	}{
+		{"instances", svc.Instances.AttachDisk("p", "z", "i", nil).Do, "instances.attachDisk"},
+		{"zone operations", svc.ZoneOperations.Wait("p", "z", "op").Do, "zoneOperations.wait"},
+		{"func", func(_ ...googleapi.CallOption) (*compute.Operation, error) { return nil, nil }, ""},
+	}
+	for _, tt := range tests {
+		if got := callOperation(tt.f); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
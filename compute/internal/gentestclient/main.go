@@ -0,0 +1,293 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// gentestclient generates the TestClient of the compute package from the
+// methods of an interface: a XxxFn override field for each method Xxx, and
+// a method Xxx recording the call, then calling XxxFn if set or the real
+// implementation. It is run by go generate in the compute package:
+//
+//	go run ./internal/gentestclient -src compute.go -iface clientImpl -out test_client_gen.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	src   = flag.String("src", "compute.go", "file defining the interface")
+	iface = flag.String("iface", "clientImpl", "interface whose methods TestClient overrides, embedded interfaces of the same file included")
+	out   = flag.String("out", "test_client_gen.go", "file to write")
+)
+
+const header = `//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Code generated by gentestclient. DO NOT EDIT.
+
+`
+
+// defaults replaces the call of the real implementation of some methods.
+var defaults = map[string]string{
+	// The copy must keep using the overrides of c.
+	"WithAuditCaller": "return c",
+}
+
+var versionRgx = regexp.MustCompile(`^v[0-9]+(\.[a-z0-9]+)?$`)
+
+type param struct {
+	name, typ string
+	variadic  bool
+}
+
+type method struct {
+	name    string
+	params  []param
+	results string
+}
+
+func main() {
+	flag.Parse()
+	code, err := generate(*src, *iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the TestClient code for the interface named iface of the
+// file src.
+func generate(src, iface string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, src, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := map[string]*ast.InterfaceType{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok {
+			if it, ok := ts.Type.(*ast.InterfaceType); ok {
+				ifaces[ts.Name.Name] = it
+			}
+		}
+		return true
+	})
+	pkgs := map[string]bool{}
+	ms, err := methods(fset, ifaces, iface, pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	fmt.Fprintf(&b, "package %s\n\n", f.Name.Name)
+	std, other, err := importSpecs(f, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "import (\n\t%s\n\n\t%s\n)\n\n", strings.Join(std, "\n\t"), strings.Join(other, "\n\t"))
+
+	b.WriteString("// TestClient is a Client with overrideable methods: XxxFn, if set, is called\n")
+	b.WriteString("// instead of the real implementation of Xxx. Calls of the methods of Client\n")
+	b.WriteString("// are recorded, see Calls.\n")
+	b.WriteString("type TestClient struct {\n\tclient\n\n")
+	for _, m := range ms {
+		fmt.Fprintf(&b, "\t%sFn func(%s) %s\n", m.name, m.signature(), m.results)
+	}
+	b.WriteString("\n\tcallsMx sync.Mutex\n\tcalls []TestClientCall\n}\n")
+
+	for _, m := range ms {
+		var args []string
+		var recorded []string
+		for _, p := range m.params {
+			recorded = append(recorded, p.name)
+			if p.variadic {
+				args = append(args, p.name+"...")
+			} else {
+				args = append(args, p.name)
+			}
+		}
+		call := strings.Join(args, ", ")
+		ret := "return "
+		if m.results == "" {
+			ret = ""
+		}
+
+		fmt.Fprintf(&b, "\n// %s uses the override method %sFn or the real implementation.\n", m.name, m.name)
+		fmt.Fprintf(&b, "func (c *TestClient) %s(%s) %s {\n", m.name, m.signature(), m.results)
+		if ast.IsExported(m.name) {
+			fmt.Fprintf(&b, "\tc.record(%s)\n", strings.Join(append([]string{strconv.Quote(m.name)}, recorded...), ", "))
+		}
+		fmt.Fprintf(&b, "\tif c.%sFn != nil {\n\t\t%sc.%sFn(%s)\n", m.name, ret, m.name, call)
+		if ret == "" {
+			b.WriteString("\t\treturn\n")
+		}
+		b.WriteString("\t}\n")
+		if d, ok := defaults[m.name]; ok {
+			fmt.Fprintf(&b, "\t%s\n", d)
+		} else {
+			fmt.Fprintf(&b, "\t%sc.client.%s(%s)\n", ret, m.name, call)
+		}
+		b.WriteString("}\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+// methods returns the methods of the interface named name, those of the
+// interfaces it embeds first, and records the packages their types use in
+// pkgs.
+func methods(fset *token.FileSet, ifaces map[string]*ast.InterfaceType, name string, pkgs map[string]bool) ([]method, error) {
+	it, ok := ifaces[name]
+	if !ok {
+		return nil, fmt.Errorf("no interface %q", name)
+	}
+	var ms []method
+	for _, f := range it.Methods.List {
+		switch t := f.Type.(type) {
+		case *ast.Ident:
+			embedded, err := methods(fset, ifaces, t.Name, pkgs)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, embedded...)
+		case *ast.FuncType:
+			ast.Inspect(t, func(n ast.Node) bool {
+				if se, ok := n.(*ast.SelectorExpr); ok {
+					if id, ok := se.X.(*ast.Ident); ok {
+						pkgs[id.Name] = true
+					}
+				}
+				return true
+			})
+			m := method{name: f.Names[0].Name}
+			for _, p := range t.Params.List {
+				typ := p.Type
+				variadic := false
+				if e, ok := typ.(*ast.Ellipsis); ok {
+					typ, variadic = e.Elt, true
+				}
+				names := p.Names
+				if len(names) == 0 {
+					names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("arg%d", len(m.params)))}
+				}
+				for _, n := range names {
+					m.params = append(m.params, param{n.Name, nodeString(fset, typ), variadic})
+				}
+			}
+			if t.Results != nil {
+				var rs []string
+				for _, r := range t.Results.List {
+					typ := nodeString(fset, r.Type)
+					if len(r.Names) == 0 {
+						rs = append(rs, typ)
+					}
+					for _, n := range r.Names {
+						rs = append(rs, n.Name+" "+typ)
+					}
+				}
+				m.results = strings.Join(rs, ", ")
+				if len(rs) > 1 || len(t.Results.List[0].Names) > 0 {
+					m.results = "(" + m.results + ")"
+				}
+			}
+			ms = append(ms, m)
+		default:
+			return nil, fmt.Errorf("interface %q: unsupported method %s", name, nodeString(fset, f.Type))
+		}
+	}
+	return ms, nil
+}
+
+// signature returns the parameters of m, those of the same type grouped.
+func (m method) signature() string {
+	var ps []string
+	for i, p := range m.params {
+		switch {
+		case p.variadic:
+			ps = append(ps, p.name+" ..."+p.typ)
+		case i+1 < len(m.params) && !m.params[i+1].variadic && m.params[i+1].typ == p.typ:
+			ps = append(ps, p.name)
+		default:
+			ps = append(ps, p.name+" "+p.typ)
+		}
+	}
+	return strings.Join(ps, ", ")
+}
+
+// importSpecs returns the imports of f of the packages in pkgs, and sync,
+// named when the package name is not the last element of the import path:
+// those of the standard library first.
+func importSpecs(f *ast.File, pkgs map[string]bool) (std, other []string, err error) {
+	std = []string{strconv.Quote("sync")}
+	for _, i := range f.Imports {
+		p, err := strconv.Unquote(i.Path.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := path.Base(p)
+		if versionRgx.MatchString(name) {
+			name = path.Base(path.Dir(p))
+		}
+		if i.Name != nil {
+			name = i.Name.Name
+		}
+		if !pkgs[name] || p == "sync" {
+			continue
+		}
+		spec := strconv.Quote(p)
+		if name != path.Base(p) {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	return std, other, nil
+}
+
+func nodeString(fset *token.FileSet, n ast.Node) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, fset, n)
+	return b.String()
+}
@@ -0,0 +1,35 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGeneratedTestClientUpToDate(t *testing.T) {
+	got, err := ioutil.ReadFile("../../test_client_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := generate("../../compute.go", "clientImpl")
+	if err != nil {
+		t.Fatalf("error generating: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("test_client_gen.go is out of date, run go generate in the compute package")
+	}
+}
@@ -0,0 +1,103 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// quotaMessageRgx matches the message of QUOTA_EXCEEDED operation errors,
+// e.g. "Quota 'SSD_TOTAL_GB' exceeded.  Limit: 500.0 in region us-central1.".
+var quotaMessageRgx = regexp.MustCompile(`Quota '(?P<metric>[^']+)' exceeded\.\s+Limit: (?P<limit>[0-9.]+)(?: in (?P<scope>(?:region|zone) [a-z0-9-]+))?`)
+
+// OperationErrorDetail is one of the errors of a failed operation.
+type OperationErrorDetail struct {
+	Code     string
+	Location string
+	Message  string
+
+	// Set for QUOTA_EXCEEDED errors whose message could be parsed.
+	QuotaMetric string
+	QuotaLimit  string
+	// QuotaScope is the region or zone of the quota, e.g.
+	// "region us-central1", empty for global quotas.
+	QuotaScope string
+}
+
+// Summary describes the error by its code and, for quota errors, the quota
+// that is exceeded, e.g. "QUOTA_EXCEEDED: SSD_TOTAL_GB in region us-central1". It
+// doesn't include the message, which may name user resources.
+func (d OperationErrorDetail) Summary() string {
+	if d.QuotaMetric == "" {
+		return d.Code
+	}
+	s := fmt.Sprintf("%s: %s", d.Code, d.QuotaMetric)
+	if d.QuotaScope != "" {
+		s += " in " + d.QuotaScope
+	}
+	return s
+}
+
+// OperationError is returned when an operation finishes with errors.
+type OperationError struct {
+	Operation  string
+	TargetLink string
+	Errors     []OperationErrorDetail
+}
+
+func newOperationError(op *compute.Operation) *OperationError {
+	e := &OperationError{Operation: op.Name, TargetLink: op.TargetLink}
+	for _, operr := range op.Error.Errors {
+		d := OperationErrorDetail{Code: operr.Code, Location: operr.Location, Message: operr.Message}
+		if m := quotaMessageRgx.FindStringSubmatch(operr.Message); operr.Code == "QUOTA_EXCEEDED" && m != nil {
+			d.QuotaMetric, d.QuotaLimit, d.QuotaScope = m[1], m[2], m[3]
+		}
+		e.Errors = append(e.Errors, d)
+	}
+	return e
+}
+
+func (e *OperationError) Error() string {
+	var operrs string
+	for _, d := range e.Errors {
+		operrs = operrs + fmt.Sprintf(
+			fmt.Sprintf("\n%v\n%v", OperationErrorCodeFormat, operationErrorMessageFormat),
+			d.Code, d.Message)
+	}
+	return fmt.Sprintf("operation %q on %q failed: %s%s", e.Operation, e.TargetLink, e.Summary(), operrs)
+}
+
+// Summary joins the summaries of the errors of the operation.
+func (e *OperationError) Summary() string {
+	var s []string
+	for _, d := range e.Errors {
+		s = append(s, d.Summary())
+	}
+	return strings.Join(s, "; ")
+}
+
+// HasCode reports whether one of the errors of the operation has code.
+func (e *OperationError) HasCode(code string) bool {
+	for _, d := range e.Errors {
+		if d.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for the API calls made after the circuit
+// breaker of a RetryBudget opened.
+var ErrCircuitOpen = errors.New("the compute API is persistently failing, not calling it anymore")
+
+// RetryBudget limits the retries of the API calls of the clients it is set
+// on, and stops calling the API once it is persistently failing, instead of
+// every caller retrying on its own.
+type RetryBudget struct {
+	// MaxRetries is the total number of retries allowed, 0 means no limit.
+	// Once spent, failed calls are not retried.
+	MaxRetries int
+	// MaxConsecutiveFailures opens the circuit breaker once that many API
+	// calls in a row failed with a server error, a rate limit or no response.
+	// Calls made while the circuit is open fail with ErrCircuitOpen. 0
+	// disables the circuit breaker.
+	MaxConsecutiveFailures int
+	// OnOpen, if set, is called when the circuit breaker opens.
+	OnOpen func()
+
+	mu       sync.Mutex
+	retries  int
+	failures int
+	open     bool
+}
+
+// exhausted reports whether no retry is left.
+func (b *RetryBudget) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.MaxRetries > 0 && b.retries >= b.MaxRetries
+}
+
+func (b *RetryBudget) spend() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retries++
+}
+
+// Open reports whether the circuit breaker is open.
+func (b *RetryBudget) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// record records the outcome of an API call.
+func (b *RetryBudget) record(resp *http.Response, err error) {
+	failed := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	b.mu.Lock()
+	if !failed {
+		b.failures = 0
+		b.mu.Unlock()
+		return
+	}
+	b.failures++
+	opened := !b.open && b.MaxConsecutiveFailures > 0 && b.failures >= b.MaxConsecutiveFailures
+	if opened {
+		b.open = true
+	}
+	b.mu.Unlock()
+	if opened && b.OnOpen != nil {
+		b.OnOpen()
+	}
+}
+
+// retryState holds the retry budget of a client. It is shared by the copies
+// of a client returned by WithAuditCaller.
+type retryState struct {
+	mu     sync.Mutex
+	budget *RetryBudget
+}
+
+func (r *retryState) get() *RetryBudget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.budget
+}
+
+// budgetTransport fails requests while the circuit breaker of the retry
+// budget is open and records the outcome of the others.
+type budgetTransport struct {
+	base  http.RoundTripper
+	retry *retryState
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	b := t.retry.get()
+	if b == nil {
+		return base.RoundTrip(req)
+	}
+	if b.Open() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+	resp, err := base.RoundTrip(req)
+	b.record(resp, err)
+	return resp, err
+}
+
+// SetRetryBudget limits the retries of the client, and of the copies returned
+// by WithAuditCaller, to b. A nil b removes the limits.
+func (c *client) SetRetryBudget(b *RetryBudget) {
+	c.retry.mu.Lock()
+	defer c.retry.mu.Unlock()
+	c.retry.budget = b
+}
+
+// shouldRetry is shouldRetryWithWait within the retry budget of c, for the
+// failed attempt of operation, waiting as the OnRetry hook of c decides.
+func (c *client) shouldRetry(operation string, err error, attempt, multiplier int) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	b := c.retry.get()
+	if b != nil && (b.Open() || b.exhausted()) {
+		return false
+	}
+	d, ok := retryWait(c.hc.Transport, err, multiplier)
+	if !ok {
+		return false
+	}
+	time.Sleep(c.retryDelay(operation, err, attempt, d))
+	if b != nil {
+		b.spend()
+	}
+	return true
+}
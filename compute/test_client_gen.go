@@ -0,0 +1,1059 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Code generated by gentestclient. DO NOT EDIT.
+
+package compute
+
+import (
+	"sync"
+	"time"
+
+	computeAlpha "google.golang.org/api/compute/v0.alpha"
+	computeBeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// TestClient is a Client with overrideable methods: XxxFn, if set, is called
+// instead of the real implementation of Xxx. Calls of the methods of Client
+// are recorded, see Calls.
+type TestClient struct {
+	client
+
+	AttachDiskFn                          func(project, zone, instance string, d *compute.AttachedDisk) error
+	DetachDiskFn                          func(project, zone, instance, disk string) error
+	CreateInstanceFn                      func(project, zone string, i *compute.Instance) error
+	CreateInstanceAlphaFn                 func(project, zone string, i *computeAlpha.Instance) error
+	CreateInstanceBetaFn                  func(project, zone string, i *computeBeta.Instance) error
+	DeleteInstanceFn                      func(project, zone, name string) error
+	StartInstanceFn                       func(project, zone, name string) error
+	StopInstanceFn                        func(project, zone, name string) error
+	ResetInstanceFn                       func(project, zone, name string) error
+	SimulateMaintenanceEventFn            func(project, zone, name string) error
+	SetSchedulingFn                       func(project, zone, name string, s *compute.Scheduling) error
+	GetSerialPortOutputFn                 func(project, zone, name string, port, start int64) (*compute.SerialPortOutput, error)
+	GetInstanceFn                         func(project, zone, name string) (*compute.Instance, error)
+	GetInstanceAlphaFn                    func(project, zone, name string) (*computeAlpha.Instance, error)
+	GetInstanceBetaFn                     func(project, zone, name string) (*computeBeta.Instance, error)
+	GetGuestAttributesFn                  func(project, zone, name, queryPath, variableKey string) (*compute.GuestAttributes, error)
+	InstanceStatusFn                      func(project, zone, name string) (string, error)
+	InstanceStoppedFn                     func(project, zone, name string) (bool, error)
+	AggregatedListInstancesFn             func(project string, opts ...ListCallOption) ([]*compute.Instance, error)
+	AggregatedListInstancesWithStatusFn   func(project string, opts ...ListCallOption) ([]*compute.Instance, []ScopeStatus, error)
+	ListInstancesFn                       func(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error)
+	SetInstanceMetadataFn                 func(project, zone, name string, md *compute.Metadata) error
+	SetDiskAutoDeleteFn                   func(project, zone, instance string, autoDelete bool, deviceName string) error
+	CreateDiskFn                          func(project, zone string, d *compute.Disk) error
+	CreateDiskAlphaFn                     func(project, zone string, d *computeAlpha.Disk) error
+	CreateDiskBetaFn                      func(project, zone string, d *computeBeta.Disk) error
+	DeleteDiskFn                          func(project, zone, name string) error
+	GetDiskFn                             func(project, zone, name string) (*compute.Disk, error)
+	GetDiskAlphaFn                        func(project, zone, name string) (*computeAlpha.Disk, error)
+	GetDiskBetaFn                         func(project, zone, name string) (*computeBeta.Disk, error)
+	AggregatedListDisksFn                 func(project string, opts ...ListCallOption) ([]*compute.Disk, error)
+	AggregatedListDisksWithStatusFn       func(project string, opts ...ListCallOption) ([]*compute.Disk, []ScopeStatus, error)
+	ListDisksFn                           func(project, zone string, opts ...ListCallOption) ([]*compute.Disk, error)
+	ResizeDiskFn                          func(project, zone, disk string, drr *compute.DisksResizeRequest) error
+	CreateSnapshotFn                      func(project, zone, disk string, s *compute.Snapshot) error
+	GetSnapshotFn                         func(project, name string) (*compute.Snapshot, error)
+	ListSnapshotsFn                       func(project string, opts ...ListCallOption) ([]*compute.Snapshot, error)
+	DeleteSnapshotFn                      func(project, name string) error
+	CreateImageFn                         func(project string, i *compute.Image) error
+	CreateImageAlphaFn                    func(project string, i *computeAlpha.Image) error
+	CreateImageBetaFn                     func(project string, i *computeBeta.Image) error
+	DeleteImageFn                         func(project, name string) error
+	DeprecateImageFn                      func(project, name string, deprecationstatus *compute.DeprecationStatus) error
+	DeprecateImageAlphaFn                 func(project, name string, deprecationstatus *computeAlpha.DeprecationStatus) error
+	GetImageFn                            func(project, name string) (*compute.Image, error)
+	GetImageAlphaFn                       func(project, name string) (*computeAlpha.Image, error)
+	GetImageBetaFn                        func(project, name string) (*computeBeta.Image, error)
+	GetImageFromFamilyFn                  func(project, family string) (*compute.Image, error)
+	GetImageFromFamiliesFn                func(projects []string, family string) (*compute.Image, string, error)
+	ListImagesFn                          func(project string, opts ...ListCallOption) ([]*compute.Image, error)
+	ListImagesAlphaFn                     func(project string, opts ...ListCallOption) ([]*computeAlpha.Image, error)
+	ListMachineImagesFn                   func(project string, opts ...ListCallOption) ([]*compute.MachineImage, error)
+	DeleteMachineImageFn                  func(project, name string) error
+	CreateMachineImageFn                  func(project string, i *compute.MachineImage) error
+	GetMachineImageFn                     func(project, name string) (*compute.MachineImage, error)
+	CreateForwardingRuleFn                func(project, region string, fr *compute.ForwardingRule) error
+	CreateFirewallRuleFn                  func(project string, i *compute.Firewall) error
+	CreateNetworkFn                       func(project string, n *compute.Network) error
+	CreateSubnetworkFn                    func(project, region string, n *compute.Subnetwork) error
+	CreateTargetInstanceFn                func(project, zone string, ti *compute.TargetInstance) error
+	DeleteForwardingRuleFn                func(project, region, name string) error
+	DeleteFirewallRuleFn                  func(project, name string) error
+	DeleteNetworkFn                       func(project, name string) error
+	DeleteSubnetworkFn                    func(project, region, name string) error
+	DeleteTargetInstanceFn                func(project, zone, name string) error
+	GetForwardingRuleFn                   func(project, region, name string) (*compute.ForwardingRule, error)
+	GetFirewallRuleFn                     func(project, name string) (*compute.Firewall, error)
+	GetNetworkFn                          func(project, name string) (*compute.Network, error)
+	GetSubnetworkFn                       func(project, region, name string) (*compute.Subnetwork, error)
+	GetTargetInstanceFn                   func(project, zone, name string) (*compute.TargetInstance, error)
+	ListForwardingRulesFn                 func(project, zone string, opts ...ListCallOption) ([]*compute.ForwardingRule, error)
+	ListFirewallRulesFn                   func(project string, opts ...ListCallOption) ([]*compute.Firewall, error)
+	ListNetworksFn                        func(project string, opts ...ListCallOption) ([]*compute.Network, error)
+	AggregatedListSubnetworksFn           func(project string, opts ...ListCallOption) ([]*compute.Subnetwork, error)
+	AggregatedListSubnetworksWithStatusFn func(project string, opts ...ListCallOption) ([]*compute.Subnetwork, []ScopeStatus, error)
+	ListSubnetworksFn                     func(project, region string, opts ...ListCallOption) ([]*compute.Subnetwork, error)
+	ListTargetInstancesFn                 func(project, zone string, opts ...ListCallOption) ([]*compute.TargetInstance, error)
+	GetMachineTypeFn                      func(project, zone, machineType string) (*compute.MachineType, error)
+	GetProjectFn                          func(project string) (*compute.Project, error)
+	GetZoneFn                             func(project, zone string) (*compute.Zone, error)
+	GetZoneRegionFn                       func(project, zone string) (string, error)
+	ResolveZoneFn                         func(project string, prefs ZonePreferences) (string, error)
+	GetLicenseFn                          func(project, name string) (*compute.License, error)
+	ListMachineTypesFn                    func(project, zone string, opts ...ListCallOption) ([]*compute.MachineType, error)
+	ListAcceleratorTypesFn                func(project, zone string, opts ...ListCallOption) ([]*compute.AcceleratorType, error)
+	ListDiskTypesFn                       func(project, zone string, opts ...ListCallOption) ([]*compute.DiskType, error)
+	ListLicensesFn                        func(project string, opts ...ListCallOption) ([]*compute.License, error)
+	ListZonesFn                           func(project string, opts ...ListCallOption) ([]*compute.Zone, error)
+	ListRegionsFn                         func(project string, opts ...ListCallOption) ([]*compute.Region, error)
+	SetCommonInstanceMetadataFn           func(project string, md *compute.Metadata) error
+	RetryFn                               func(f func(opts ...googleapi.CallOption) (*compute.Operation, error), opts ...googleapi.CallOption) (op *compute.Operation, err error)
+	RetryBetaFn                           func(f func(opts ...googleapi.CallOption) (*computeBeta.Operation, error), opts ...googleapi.CallOption) (op *computeBeta.Operation, err error)
+	SetOperationPollIntervalFn            func(d time.Duration)
+	BasePathFn                            func() string
+	SetAuditRecorderFn                    func(r AuditRecorder)
+	SetRetryBudgetFn                      func(b *RetryBudget)
+	SetHooksFn                            func(h *Hooks)
+	APIUsageFn                            func() []APIUsage
+	WithAuditCallerFn                     func(caller string) Client
+	zoneOperationsWaitFn                  func(project, zone, name string) error
+	regionOperationsWaitFn                func(project, region, name string) error
+	globalOperationsWaitFn                func(project, name string) error
+
+	callsMx sync.Mutex
+	calls   []TestClientCall
+}
+
+// AttachDisk uses the override method AttachDiskFn or the real implementation.
+func (c *TestClient) AttachDisk(project, zone, instance string, d *compute.AttachedDisk) error {
+	c.record("AttachDisk", project, zone, instance, d)
+	if c.AttachDiskFn != nil {
+		return c.AttachDiskFn(project, zone, instance, d)
+	}
+	return c.client.AttachDisk(project, zone, instance, d)
+}
+
+// DetachDisk uses the override method DetachDiskFn or the real implementation.
+func (c *TestClient) DetachDisk(project, zone, instance, disk string) error {
+	c.record("DetachDisk", project, zone, instance, disk)
+	if c.DetachDiskFn != nil {
+		return c.DetachDiskFn(project, zone, instance, disk)
+	}
+	return c.client.DetachDisk(project, zone, instance, disk)
+}
+
+// CreateInstance uses the override method CreateInstanceFn or the real implementation.
+func (c *TestClient) CreateInstance(project, zone string, i *compute.Instance) error {
+	c.record("CreateInstance", project, zone, i)
+	if c.CreateInstanceFn != nil {
+		return c.CreateInstanceFn(project, zone, i)
+	}
+	return c.client.CreateInstance(project, zone, i)
+}
+
+// CreateInstanceAlpha uses the override method CreateInstanceAlphaFn or the real implementation.
+func (c *TestClient) CreateInstanceAlpha(project, zone string, i *computeAlpha.Instance) error {
+	c.record("CreateInstanceAlpha", project, zone, i)
+	if c.CreateInstanceAlphaFn != nil {
+		return c.CreateInstanceAlphaFn(project, zone, i)
+	}
+	return c.client.CreateInstanceAlpha(project, zone, i)
+}
+
+// CreateInstanceBeta uses the override method CreateInstanceBetaFn or the real implementation.
+func (c *TestClient) CreateInstanceBeta(project, zone string, i *computeBeta.Instance) error {
+	c.record("CreateInstanceBeta", project, zone, i)
+	if c.CreateInstanceBetaFn != nil {
+		return c.CreateInstanceBetaFn(project, zone, i)
+	}
+	return c.client.CreateInstanceBeta(project, zone, i)
+}
+
+// DeleteInstance uses the override method DeleteInstanceFn or the real implementation.
+func (c *TestClient) DeleteInstance(project, zone, name string) error {
+	c.record("DeleteInstance", project, zone, name)
+	if c.DeleteInstanceFn != nil {
+		return c.DeleteInstanceFn(project, zone, name)
+	}
+	return c.client.DeleteInstance(project, zone, name)
+}
+
+// StartInstance uses the override method StartInstanceFn or the real implementation.
+func (c *TestClient) StartInstance(project, zone, name string) error {
+	c.record("StartInstance", project, zone, name)
+	if c.StartInstanceFn != nil {
+		return c.StartInstanceFn(project, zone, name)
+	}
+	return c.client.StartInstance(project, zone, name)
+}
+
+// StopInstance uses the override method StopInstanceFn or the real implementation.
+func (c *TestClient) StopInstance(project, zone, name string) error {
+	c.record("StopInstance", project, zone, name)
+	if c.StopInstanceFn != nil {
+		return c.StopInstanceFn(project, zone, name)
+	}
+	return c.client.StopInstance(project, zone, name)
+}
+
+// ResetInstance uses the override method ResetInstanceFn or the real implementation.
+func (c *TestClient) ResetInstance(project, zone, name string) error {
+	c.record("ResetInstance", project, zone, name)
+	if c.ResetInstanceFn != nil {
+		return c.ResetInstanceFn(project, zone, name)
+	}
+	return c.client.ResetInstance(project, zone, name)
+}
+
+// SimulateMaintenanceEvent uses the override method SimulateMaintenanceEventFn or the real implementation.
+func (c *TestClient) SimulateMaintenanceEvent(project, zone, name string) error {
+	c.record("SimulateMaintenanceEvent", project, zone, name)
+	if c.SimulateMaintenanceEventFn != nil {
+		return c.SimulateMaintenanceEventFn(project, zone, name)
+	}
+	return c.client.SimulateMaintenanceEvent(project, zone, name)
+}
+
+// SetScheduling uses the override method SetSchedulingFn or the real implementation.
+func (c *TestClient) SetScheduling(project, zone, name string, s *compute.Scheduling) error {
+	c.record("SetScheduling", project, zone, name, s)
+	if c.SetSchedulingFn != nil {
+		return c.SetSchedulingFn(project, zone, name, s)
+	}
+	return c.client.SetScheduling(project, zone, name, s)
+}
+
+// GetSerialPortOutput uses the override method GetSerialPortOutputFn or the real implementation.
+func (c *TestClient) GetSerialPortOutput(project, zone, name string, port, start int64) (*compute.SerialPortOutput, error) {
+	c.record("GetSerialPortOutput", project, zone, name, port, start)
+	if c.GetSerialPortOutputFn != nil {
+		return c.GetSerialPortOutputFn(project, zone, name, port, start)
+	}
+	return c.client.GetSerialPortOutput(project, zone, name, port, start)
+}
+
+// GetInstance uses the override method GetInstanceFn or the real implementation.
+func (c *TestClient) GetInstance(project, zone, name string) (*compute.Instance, error) {
+	c.record("GetInstance", project, zone, name)
+	if c.GetInstanceFn != nil {
+		return c.GetInstanceFn(project, zone, name)
+	}
+	return c.client.GetInstance(project, zone, name)
+}
+
+// GetInstanceAlpha uses the override method GetInstanceAlphaFn or the real implementation.
+func (c *TestClient) GetInstanceAlpha(project, zone, name string) (*computeAlpha.Instance, error) {
+	c.record("GetInstanceAlpha", project, zone, name)
+	if c.GetInstanceAlphaFn != nil {
+		return c.GetInstanceAlphaFn(project, zone, name)
+	}
+	return c.client.GetInstanceAlpha(project, zone, name)
+}
+
+// GetInstanceBeta uses the override method GetInstanceBetaFn or the real implementation.
+func (c *TestClient) GetInstanceBeta(project, zone, name string) (*computeBeta.Instance, error) {
+	c.record("GetInstanceBeta", project, zone, name)
+	if c.GetInstanceBetaFn != nil {
+		return c.GetInstanceBetaFn(project, zone, name)
+	}
+	return c.client.GetInstanceBeta(project, zone, name)
+}
+
+// GetGuestAttributes uses the override method GetGuestAttributesFn or the real implementation.
+func (c *TestClient) GetGuestAttributes(project, zone, name, queryPath, variableKey string) (*compute.GuestAttributes, error) {
+	c.record("GetGuestAttributes", project, zone, name, queryPath, variableKey)
+	if c.GetGuestAttributesFn != nil {
+		return c.GetGuestAttributesFn(project, zone, name, queryPath, variableKey)
+	}
+	return c.client.GetGuestAttributes(project, zone, name, queryPath, variableKey)
+}
+
+// InstanceStatus uses the override method InstanceStatusFn or the real implementation.
+func (c *TestClient) InstanceStatus(project, zone, name string) (string, error) {
+	c.record("InstanceStatus", project, zone, name)
+	if c.InstanceStatusFn != nil {
+		return c.InstanceStatusFn(project, zone, name)
+	}
+	return c.client.InstanceStatus(project, zone, name)
+}
+
+// InstanceStopped uses the override method InstanceStoppedFn or the real implementation.
+func (c *TestClient) InstanceStopped(project, zone, name string) (bool, error) {
+	c.record("InstanceStopped", project, zone, name)
+	if c.InstanceStoppedFn != nil {
+		return c.InstanceStoppedFn(project, zone, name)
+	}
+	return c.client.InstanceStopped(project, zone, name)
+}
+
+// AggregatedListInstances uses the override method AggregatedListInstancesFn or the real implementation.
+func (c *TestClient) AggregatedListInstances(project string, opts ...ListCallOption) ([]*compute.Instance, error) {
+	c.record("AggregatedListInstances", project, opts)
+	if c.AggregatedListInstancesFn != nil {
+		return c.AggregatedListInstancesFn(project, opts...)
+	}
+	return c.client.AggregatedListInstances(project, opts...)
+}
+
+// AggregatedListInstancesWithStatus uses the override method AggregatedListInstancesWithStatusFn or the real implementation.
+func (c *TestClient) AggregatedListInstancesWithStatus(project string, opts ...ListCallOption) ([]*compute.Instance, []ScopeStatus, error) {
+	c.record("AggregatedListInstancesWithStatus", project, opts)
+	if c.AggregatedListInstancesWithStatusFn != nil {
+		return c.AggregatedListInstancesWithStatusFn(project, opts...)
+	}
+	return c.client.AggregatedListInstancesWithStatus(project, opts...)
+}
+
+// ListInstances uses the override method ListInstancesFn or the real implementation.
+func (c *TestClient) ListInstances(project, zone string, opts ...ListCallOption) ([]*compute.Instance, error) {
+	c.record("ListInstances", project, zone, opts)
+	if c.ListInstancesFn != nil {
+		return c.ListInstancesFn(project, zone, opts...)
+	}
+	return c.client.ListInstances(project, zone, opts...)
+}
+
+// SetInstanceMetadata uses the override method SetInstanceMetadataFn or the real implementation.
+func (c *TestClient) SetInstanceMetadata(project, zone, name string, md *compute.Metadata) error {
+	c.record("SetInstanceMetadata", project, zone, name, md)
+	if c.SetInstanceMetadataFn != nil {
+		return c.SetInstanceMetadataFn(project, zone, name, md)
+	}
+	return c.client.SetInstanceMetadata(project, zone, name, md)
+}
+
+// SetDiskAutoDelete uses the override method SetDiskAutoDeleteFn or the real implementation.
+func (c *TestClient) SetDiskAutoDelete(project, zone, instance string, autoDelete bool, deviceName string) error {
+	c.record("SetDiskAutoDelete", project, zone, instance, autoDelete, deviceName)
+	if c.SetDiskAutoDeleteFn != nil {
+		return c.SetDiskAutoDeleteFn(project, zone, instance, autoDelete, deviceName)
+	}
+	return c.client.SetDiskAutoDelete(project, zone, instance, autoDelete, deviceName)
+}
+
+// CreateDisk uses the override method CreateDiskFn or the real implementation.
+func (c *TestClient) CreateDisk(project, zone string, d *compute.Disk) error {
+	c.record("CreateDisk", project, zone, d)
+	if c.CreateDiskFn != nil {
+		return c.CreateDiskFn(project, zone, d)
+	}
+	return c.client.CreateDisk(project, zone, d)
+}
+
+// CreateDiskAlpha uses the override method CreateDiskAlphaFn or the real implementation.
+func (c *TestClient) CreateDiskAlpha(project, zone string, d *computeAlpha.Disk) error {
+	c.record("CreateDiskAlpha", project, zone, d)
+	if c.CreateDiskAlphaFn != nil {
+		return c.CreateDiskAlphaFn(project, zone, d)
+	}
+	return c.client.CreateDiskAlpha(project, zone, d)
+}
+
+// CreateDiskBeta uses the override method CreateDiskBetaFn or the real implementation.
+func (c *TestClient) CreateDiskBeta(project, zone string, d *computeBeta.Disk) error {
+	c.record("CreateDiskBeta", project, zone, d)
+	if c.CreateDiskBetaFn != nil {
+		return c.CreateDiskBetaFn(project, zone, d)
+	}
+	return c.client.CreateDiskBeta(project, zone, d)
+}
+
+// DeleteDisk uses the override method DeleteDiskFn or the real implementation.
+func (c *TestClient) DeleteDisk(project, zone, name string) error {
+	c.record("DeleteDisk", project, zone, name)
+	if c.DeleteDiskFn != nil {
+		return c.DeleteDiskFn(project, zone, name)
+	}
+	return c.client.DeleteDisk(project, zone, name)
+}
+
+// GetDisk uses the override method GetDiskFn or the real implementation.
+func (c *TestClient) GetDisk(project, zone, name string) (*compute.Disk, error) {
+	c.record("GetDisk", project, zone, name)
+	if c.GetDiskFn != nil {
+		return c.GetDiskFn(project, zone, name)
+	}
+	return c.client.GetDisk(project, zone, name)
+}
+
+// GetDiskAlpha uses the override method GetDiskAlphaFn or the real implementation.
+func (c *TestClient) GetDiskAlpha(project, zone, name string) (*computeAlpha.Disk, error) {
+	c.record("GetDiskAlpha", project, zone, name)
+	if c.GetDiskAlphaFn != nil {
+		return c.GetDiskAlphaFn(project, zone, name)
+	}
+	return c.client.GetDiskAlpha(project, zone, name)
+}
+
+// GetDiskBeta uses the override method GetDiskBetaFn or the real implementation.
+func (c *TestClient) GetDiskBeta(project, zone, name string) (*computeBeta.Disk, error) {
+	c.record("GetDiskBeta", project, zone, name)
+	if c.GetDiskBetaFn != nil {
+		return c.GetDiskBetaFn(project, zone, name)
+	}
+	return c.client.GetDiskBeta(project, zone, name)
+}
+
+// AggregatedListDisks uses the override method AggregatedListDisksFn or the real implementation.
+func (c *TestClient) AggregatedListDisks(project string, opts ...ListCallOption) ([]*compute.Disk, error) {
+	c.record("AggregatedListDisks", project, opts)
+	if c.AggregatedListDisksFn != nil {
+		return c.AggregatedListDisksFn(project, opts...)
+	}
+	return c.client.AggregatedListDisks(project, opts...)
+}
+
+// AggregatedListDisksWithStatus uses the override method AggregatedListDisksWithStatusFn or the real implementation.
+func (c *TestClient) AggregatedListDisksWithStatus(project string, opts ...ListCallOption) ([]*compute.Disk, []ScopeStatus, error) {
+	c.record("AggregatedListDisksWithStatus", project, opts)
+	if c.AggregatedListDisksWithStatusFn != nil {
+		return c.AggregatedListDisksWithStatusFn(project, opts...)
+	}
+	return c.client.AggregatedListDisksWithStatus(project, opts...)
+}
+
+// ListDisks uses the override method ListDisksFn or the real implementation.
+func (c *TestClient) ListDisks(project, zone string, opts ...ListCallOption) ([]*compute.Disk, error) {
+	c.record("ListDisks", project, zone, opts)
+	if c.ListDisksFn != nil {
+		return c.ListDisksFn(project, zone, opts...)
+	}
+	return c.client.ListDisks(project, zone, opts...)
+}
+
+// ResizeDisk uses the override method ResizeDiskFn or the real implementation.
+func (c *TestClient) ResizeDisk(project, zone, disk string, drr *compute.DisksResizeRequest) error {
+	c.record("ResizeDisk", project, zone, disk, drr)
+	if c.ResizeDiskFn != nil {
+		return c.ResizeDiskFn(project, zone, disk, drr)
+	}
+	return c.client.ResizeDisk(project, zone, disk, drr)
+}
+
+// CreateSnapshot uses the override method CreateSnapshotFn or the real implementation.
+func (c *TestClient) CreateSnapshot(project, zone, disk string, s *compute.Snapshot) error {
+	c.record("CreateSnapshot", project, zone, disk, s)
+	if c.CreateSnapshotFn != nil {
+		return c.CreateSnapshotFn(project, zone, disk, s)
+	}
+	return c.client.CreateSnapshot(project, zone, disk, s)
+}
+
+// GetSnapshot uses the override method GetSnapshotFn or the real implementation.
+func (c *TestClient) GetSnapshot(project, name string) (*compute.Snapshot, error) {
+	c.record("GetSnapshot", project, name)
+	if c.GetSnapshotFn != nil {
+		return c.GetSnapshotFn(project, name)
+	}
+	return c.client.GetSnapshot(project, name)
+}
+
+// ListSnapshots uses the override method ListSnapshotsFn or the real implementation.
+func (c *TestClient) ListSnapshots(project string, opts ...ListCallOption) ([]*compute.Snapshot, error) {
+	c.record("ListSnapshots", project, opts)
+	if c.ListSnapshotsFn != nil {
+		return c.ListSnapshotsFn(project, opts...)
+	}
+	return c.client.ListSnapshots(project, opts...)
+}
+
+// DeleteSnapshot uses the override method DeleteSnapshotFn or the real implementation.
+func (c *TestClient) DeleteSnapshot(project, name string) error {
+	c.record("DeleteSnapshot", project, name)
+	if c.DeleteSnapshotFn != nil {
+		return c.DeleteSnapshotFn(project, name)
+	}
+	return c.client.DeleteSnapshot(project, name)
+}
+
+// CreateImage uses the override method CreateImageFn or the real implementation.
+func (c *TestClient) CreateImage(project string, i *compute.Image) error {
+	c.record("CreateImage", project, i)
+	if c.CreateImageFn != nil {
+		return c.CreateImageFn(project, i)
+	}
+	return c.client.CreateImage(project, i)
+}
+
+// CreateImageAlpha uses the override method CreateImageAlphaFn or the real implementation.
+func (c *TestClient) CreateImageAlpha(project string, i *computeAlpha.Image) error {
+	c.record("CreateImageAlpha", project, i)
+	if c.CreateImageAlphaFn != nil {
+		return c.CreateImageAlphaFn(project, i)
+	}
+	return c.client.CreateImageAlpha(project, i)
+}
+
+// CreateImageBeta uses the override method CreateImageBetaFn or the real implementation.
+func (c *TestClient) CreateImageBeta(project string, i *computeBeta.Image) error {
+	c.record("CreateImageBeta", project, i)
+	if c.CreateImageBetaFn != nil {
+		return c.CreateImageBetaFn(project, i)
+	}
+	return c.client.CreateImageBeta(project, i)
+}
+
+// DeleteImage uses the override method DeleteImageFn or the real implementation.
+func (c *TestClient) DeleteImage(project, name string) error {
+	c.record("DeleteImage", project, name)
+	if c.DeleteImageFn != nil {
+		return c.DeleteImageFn(project, name)
+	}
+	return c.client.DeleteImage(project, name)
+}
+
+// DeprecateImage uses the override method DeprecateImageFn or the real implementation.
+func (c *TestClient) DeprecateImage(project, name string, deprecationstatus *compute.DeprecationStatus) error {
+	c.record("DeprecateImage", project, name, deprecationstatus)
+	if c.DeprecateImageFn != nil {
+		return c.DeprecateImageFn(project, name, deprecationstatus)
+	}
+	return c.client.DeprecateImage(project, name, deprecationstatus)
+}
+
+// DeprecateImageAlpha uses the override method DeprecateImageAlphaFn or the real implementation.
+func (c *TestClient) DeprecateImageAlpha(project, name string, deprecationstatus *computeAlpha.DeprecationStatus) error {
+	c.record("DeprecateImageAlpha", project, name, deprecationstatus)
+	if c.DeprecateImageAlphaFn != nil {
+		return c.DeprecateImageAlphaFn(project, name, deprecationstatus)
+	}
+	return c.client.DeprecateImageAlpha(project, name, deprecationstatus)
+}
+
+// GetImage uses the override method GetImageFn or the real implementation.
+func (c *TestClient) GetImage(project, name string) (*compute.Image, error) {
+	c.record("GetImage", project, name)
+	if c.GetImageFn != nil {
+		return c.GetImageFn(project, name)
+	}
+	return c.client.GetImage(project, name)
+}
+
+// GetImageAlpha uses the override method GetImageAlphaFn or the real implementation.
+func (c *TestClient) GetImageAlpha(project, name string) (*computeAlpha.Image, error) {
+	c.record("GetImageAlpha", project, name)
+	if c.GetImageAlphaFn != nil {
+		return c.GetImageAlphaFn(project, name)
+	}
+	return c.client.GetImageAlpha(project, name)
+}
+
+// GetImageBeta uses the override method GetImageBetaFn or the real implementation.
+func (c *TestClient) GetImageBeta(project, name string) (*computeBeta.Image, error) {
+	c.record("GetImageBeta", project, name)
+	if c.GetImageBetaFn != nil {
+		return c.GetImageBetaFn(project, name)
+	}
+	return c.client.GetImageBeta(project, name)
+}
+
+// GetImageFromFamily uses the override method GetImageFromFamilyFn or the real implementation.
+func (c *TestClient) GetImageFromFamily(project, family string) (*compute.Image, error) {
+	c.record("GetImageFromFamily", project, family)
+	if c.GetImageFromFamilyFn != nil {
+		return c.GetImageFromFamilyFn(project, family)
+	}
+	return c.client.GetImageFromFamily(project, family)
+}
+
+// GetImageFromFamilies uses the override method GetImageFromFamiliesFn or the real implementation.
+func (c *TestClient) GetImageFromFamilies(projects []string, family string) (*compute.Image, string, error) {
+	c.record("GetImageFromFamilies", projects, family)
+	if c.GetImageFromFamiliesFn != nil {
+		return c.GetImageFromFamiliesFn(projects, family)
+	}
+	return c.client.GetImageFromFamilies(projects, family)
+}
+
+// ListImages uses the override method ListImagesFn or the real implementation.
+func (c *TestClient) ListImages(project string, opts ...ListCallOption) ([]*compute.Image, error) {
+	c.record("ListImages", project, opts)
+	if c.ListImagesFn != nil {
+		return c.ListImagesFn(project, opts...)
+	}
+	return c.client.ListImages(project, opts...)
+}
+
+// ListImagesAlpha uses the override method ListImagesAlphaFn or the real implementation.
+func (c *TestClient) ListImagesAlpha(project string, opts ...ListCallOption) ([]*computeAlpha.Image, error) {
+	c.record("ListImagesAlpha", project, opts)
+	if c.ListImagesAlphaFn != nil {
+		return c.ListImagesAlphaFn(project, opts...)
+	}
+	return c.client.ListImagesAlpha(project, opts...)
+}
+
+// ListMachineImages uses the override method ListMachineImagesFn or the real implementation.
+func (c *TestClient) ListMachineImages(project string, opts ...ListCallOption) ([]*compute.MachineImage, error) {
+	c.record("ListMachineImages", project, opts)
+	if c.ListMachineImagesFn != nil {
+		return c.ListMachineImagesFn(project, opts...)
+	}
+	return c.client.ListMachineImages(project, opts...)
+}
+
+// DeleteMachineImage uses the override method DeleteMachineImageFn or the real implementation.
+func (c *TestClient) DeleteMachineImage(project, name string) error {
+	c.record("DeleteMachineImage", project, name)
+	if c.DeleteMachineImageFn != nil {
+		return c.DeleteMachineImageFn(project, name)
+	}
+	return c.client.DeleteMachineImage(project, name)
+}
+
+// CreateMachineImage uses the override method CreateMachineImageFn or the real implementation.
+func (c *TestClient) CreateMachineImage(project string, i *compute.MachineImage) error {
+	c.record("CreateMachineImage", project, i)
+	if c.CreateMachineImageFn != nil {
+		return c.CreateMachineImageFn(project, i)
+	}
+	return c.client.CreateMachineImage(project, i)
+}
+
+// GetMachineImage uses the override method GetMachineImageFn or the real implementation.
+func (c *TestClient) GetMachineImage(project, name string) (*compute.MachineImage, error) {
+	c.record("GetMachineImage", project, name)
+	if c.GetMachineImageFn != nil {
+		return c.GetMachineImageFn(project, name)
+	}
+	return c.client.GetMachineImage(project, name)
+}
+
+// CreateForwardingRule uses the override method CreateForwardingRuleFn or the real implementation.
+func (c *TestClient) CreateForwardingRule(project, region string, fr *compute.ForwardingRule) error {
+	c.record("CreateForwardingRule", project, region, fr)
+	if c.CreateForwardingRuleFn != nil {
+		return c.CreateForwardingRuleFn(project, region, fr)
+	}
+	return c.client.CreateForwardingRule(project, region, fr)
+}
+
+// CreateFirewallRule uses the override method CreateFirewallRuleFn or the real implementation.
+func (c *TestClient) CreateFirewallRule(project string, i *compute.Firewall) error {
+	c.record("CreateFirewallRule", project, i)
+	if c.CreateFirewallRuleFn != nil {
+		return c.CreateFirewallRuleFn(project, i)
+	}
+	return c.client.CreateFirewallRule(project, i)
+}
+
+// CreateNetwork uses the override method CreateNetworkFn or the real implementation.
+func (c *TestClient) CreateNetwork(project string, n *compute.Network) error {
+	c.record("CreateNetwork", project, n)
+	if c.CreateNetworkFn != nil {
+		return c.CreateNetworkFn(project, n)
+	}
+	return c.client.CreateNetwork(project, n)
+}
+
+// CreateSubnetwork uses the override method CreateSubnetworkFn or the real implementation.
+func (c *TestClient) CreateSubnetwork(project, region string, n *compute.Subnetwork) error {
+	c.record("CreateSubnetwork", project, region, n)
+	if c.CreateSubnetworkFn != nil {
+		return c.CreateSubnetworkFn(project, region, n)
+	}
+	return c.client.CreateSubnetwork(project, region, n)
+}
+
+// CreateTargetInstance uses the override method CreateTargetInstanceFn or the real implementation.
+func (c *TestClient) CreateTargetInstance(project, zone string, ti *compute.TargetInstance) error {
+	c.record("CreateTargetInstance", project, zone, ti)
+	if c.CreateTargetInstanceFn != nil {
+		return c.CreateTargetInstanceFn(project, zone, ti)
+	}
+	return c.client.CreateTargetInstance(project, zone, ti)
+}
+
+// DeleteForwardingRule uses the override method DeleteForwardingRuleFn or the real implementation.
+func (c *TestClient) DeleteForwardingRule(project, region, name string) error {
+	c.record("DeleteForwardingRule", project, region, name)
+	if c.DeleteForwardingRuleFn != nil {
+		return c.DeleteForwardingRuleFn(project, region, name)
+	}
+	return c.client.DeleteForwardingRule(project, region, name)
+}
+
+// DeleteFirewallRule uses the override method DeleteFirewallRuleFn or the real implementation.
+func (c *TestClient) DeleteFirewallRule(project, name string) error {
+	c.record("DeleteFirewallRule", project, name)
+	if c.DeleteFirewallRuleFn != nil {
+		return c.DeleteFirewallRuleFn(project, name)
+	}
+	return c.client.DeleteFirewallRule(project, name)
+}
+
+// DeleteNetwork uses the override method DeleteNetworkFn or the real implementation.
+func (c *TestClient) DeleteNetwork(project, name string) error {
+	c.record("DeleteNetwork", project, name)
+	if c.DeleteNetworkFn != nil {
+		return c.DeleteNetworkFn(project, name)
+	}
+	return c.client.DeleteNetwork(project, name)
+}
+
+// DeleteSubnetwork uses the override method DeleteSubnetworkFn or the real implementation.
+func (c *TestClient) DeleteSubnetwork(project, region, name string) error {
+	c.record("DeleteSubnetwork", project, region, name)
+	if c.DeleteSubnetworkFn != nil {
+		return c.DeleteSubnetworkFn(project, region, name)
+	}
+	return c.client.DeleteSubnetwork(project, region, name)
+}
+
+// DeleteTargetInstance uses the override method DeleteTargetInstanceFn or the real implementation.
+func (c *TestClient) DeleteTargetInstance(project, zone, name string) error {
+	c.record("DeleteTargetInstance", project, zone, name)
+	if c.DeleteTargetInstanceFn != nil {
+		return c.DeleteTargetInstanceFn(project, zone, name)
+	}
+	return c.client.DeleteTargetInstance(project, zone, name)
+}
+
+// GetForwardingRule uses the override method GetForwardingRuleFn or the real implementation.
+func (c *TestClient) GetForwardingRule(project, region, name string) (*compute.ForwardingRule, error) {
+	c.record("GetForwardingRule", project, region, name)
+	if c.GetForwardingRuleFn != nil {
+		return c.GetForwardingRuleFn(project, region, name)
+	}
+	return c.client.GetForwardingRule(project, region, name)
+}
+
+// GetFirewallRule uses the override method GetFirewallRuleFn or the real implementation.
+func (c *TestClient) GetFirewallRule(project, name string) (*compute.Firewall, error) {
+	c.record("GetFirewallRule", project, name)
+	if c.GetFirewallRuleFn != nil {
+		return c.GetFirewallRuleFn(project, name)
+	}
+	return c.client.GetFirewallRule(project, name)
+}
+
+// GetNetwork uses the override method GetNetworkFn or the real implementation.
+func (c *TestClient) GetNetwork(project, name string) (*compute.Network, error) {
+	c.record("GetNetwork", project, name)
+	if c.GetNetworkFn != nil {
+		return c.GetNetworkFn(project, name)
+	}
+	return c.client.GetNetwork(project, name)
+}
+
+// GetSubnetwork uses the override method GetSubnetworkFn or the real implementation.
+func (c *TestClient) GetSubnetwork(project, region, name string) (*compute.Subnetwork, error) {
+	c.record("GetSubnetwork", project, region, name)
+	if c.GetSubnetworkFn != nil {
+		return c.GetSubnetworkFn(project, region, name)
+	}
+	return c.client.GetSubnetwork(project, region, name)
+}
+
+// GetTargetInstance uses the override method GetTargetInstanceFn or the real implementation.
+func (c *TestClient) GetTargetInstance(project, zone, name string) (*compute.TargetInstance, error) {
+	c.record("GetTargetInstance", project, zone, name)
+	if c.GetTargetInstanceFn != nil {
+		return c.GetTargetInstanceFn(project, zone, name)
+	}
+	return c.client.GetTargetInstance(project, zone, name)
+}
+
+// ListForwardingRules uses the override method ListForwardingRulesFn or the real implementation.
+func (c *TestClient) ListForwardingRules(project, zone string, opts ...ListCallOption) ([]*compute.ForwardingRule, error) {
+	c.record("ListForwardingRules", project, zone, opts)
+	if c.ListForwardingRulesFn != nil {
+		return c.ListForwardingRulesFn(project, zone, opts...)
+	}
+	return c.client.ListForwardingRules(project, zone, opts...)
+}
+
+// ListFirewallRules uses the override method ListFirewallRulesFn or the real implementation.
+func (c *TestClient) ListFirewallRules(project string, opts ...ListCallOption) ([]*compute.Firewall, error) {
+	c.record("ListFirewallRules", project, opts)
+	if c.ListFirewallRulesFn != nil {
+		return c.ListFirewallRulesFn(project, opts...)
+	}
+	return c.client.ListFirewallRules(project, opts...)
+}
+
+// ListNetworks uses the override method ListNetworksFn or the real implementation.
+func (c *TestClient) ListNetworks(project string, opts ...ListCallOption) ([]*compute.Network, error) {
+	c.record("ListNetworks", project, opts)
+	if c.ListNetworksFn != nil {
+		return c.ListNetworksFn(project, opts...)
+	}
+	return c.client.ListNetworks(project, opts...)
+}
+
+// AggregatedListSubnetworks uses the override method AggregatedListSubnetworksFn or the real implementation.
+func (c *TestClient) AggregatedListSubnetworks(project string, opts ...ListCallOption) ([]*compute.Subnetwork, error) {
+	c.record("AggregatedListSubnetworks", project, opts)
+	if c.AggregatedListSubnetworksFn != nil {
+		return c.AggregatedListSubnetworksFn(project, opts...)
+	}
+	return c.client.AggregatedListSubnetworks(project, opts...)
+}
+
+// AggregatedListSubnetworksWithStatus uses the override method AggregatedListSubnetworksWithStatusFn or the real implementation.
+func (c *TestClient) AggregatedListSubnetworksWithStatus(project string, opts ...ListCallOption) ([]*compute.Subnetwork, []ScopeStatus, error) {
+	c.record("AggregatedListSubnetworksWithStatus", project, opts)
+	if c.AggregatedListSubnetworksWithStatusFn != nil {
+		return c.AggregatedListSubnetworksWithStatusFn(project, opts...)
+	}
+	return c.client.AggregatedListSubnetworksWithStatus(project, opts...)
+}
+
+// ListSubnetworks uses the override method ListSubnetworksFn or the real implementation.
+func (c *TestClient) ListSubnetworks(project, region string, opts ...ListCallOption) ([]*compute.Subnetwork, error) {
+	c.record("ListSubnetworks", project, region, opts)
+	if c.ListSubnetworksFn != nil {
+		return c.ListSubnetworksFn(project, region, opts...)
+	}
+	return c.client.ListSubnetworks(project, region, opts...)
+}
+
+// ListTargetInstances uses the override method ListTargetInstancesFn or the real implementation.
+func (c *TestClient) ListTargetInstances(project, zone string, opts ...ListCallOption) ([]*compute.TargetInstance, error) {
+	c.record("ListTargetInstances", project, zone, opts)
+	if c.ListTargetInstancesFn != nil {
+		return c.ListTargetInstancesFn(project, zone, opts...)
+	}
+	return c.client.ListTargetInstances(project, zone, opts...)
+}
+
+// GetMachineType uses the override method GetMachineTypeFn or the real implementation.
+func (c *TestClient) GetMachineType(project, zone, machineType string) (*compute.MachineType, error) {
+	c.record("GetMachineType", project, zone, machineType)
+	if c.GetMachineTypeFn != nil {
+		return c.GetMachineTypeFn(project, zone, machineType)
+	}
+	return c.client.GetMachineType(project, zone, machineType)
+}
+
+// GetProject uses the override method GetProjectFn or the real implementation.
+func (c *TestClient) GetProject(project string) (*compute.Project, error) {
+	c.record("GetProject", project)
+	if c.GetProjectFn != nil {
+		return c.GetProjectFn(project)
+	}
+	return c.client.GetProject(project)
+}
+
+// GetZone uses the override method GetZoneFn or the real implementation.
+func (c *TestClient) GetZone(project, zone string) (*compute.Zone, error) {
+	c.record("GetZone", project, zone)
+	if c.GetZoneFn != nil {
+		return c.GetZoneFn(project, zone)
+	}
+	return c.client.GetZone(project, zone)
+}
+
+// GetZoneRegion uses the override method GetZoneRegionFn or the real implementation.
+func (c *TestClient) GetZoneRegion(project, zone string) (string, error) {
+	c.record("GetZoneRegion", project, zone)
+	if c.GetZoneRegionFn != nil {
+		return c.GetZoneRegionFn(project, zone)
+	}
+	return c.client.GetZoneRegion(project, zone)
+}
+
+// ResolveZone uses the override method ResolveZoneFn or the real implementation.
+func (c *TestClient) ResolveZone(project string, prefs ZonePreferences) (string, error) {
+	c.record("ResolveZone", project, prefs)
+	if c.ResolveZoneFn != nil {
+		return c.ResolveZoneFn(project, prefs)
+	}
+	return c.client.ResolveZone(project, prefs)
+}
+
+// GetLicense uses the override method GetLicenseFn or the real implementation.
+func (c *TestClient) GetLicense(project, name string) (*compute.License, error) {
+	c.record("GetLicense", project, name)
+	if c.GetLicenseFn != nil {
+		return c.GetLicenseFn(project, name)
+	}
+	return c.client.GetLicense(project, name)
+}
+
+// ListMachineTypes uses the override method ListMachineTypesFn or the real implementation.
+func (c *TestClient) ListMachineTypes(project, zone string, opts ...ListCallOption) ([]*compute.MachineType, error) {
+	c.record("ListMachineTypes", project, zone, opts)
+	if c.ListMachineTypesFn != nil {
+		return c.ListMachineTypesFn(project, zone, opts...)
+	}
+	return c.client.ListMachineTypes(project, zone, opts...)
+}
+
+// ListAcceleratorTypes uses the override method ListAcceleratorTypesFn or the real implementation.
+func (c *TestClient) ListAcceleratorTypes(project, zone string, opts ...ListCallOption) ([]*compute.AcceleratorType, error) {
+	c.record("ListAcceleratorTypes", project, zone, opts)
+	if c.ListAcceleratorTypesFn != nil {
+		return c.ListAcceleratorTypesFn(project, zone, opts...)
+	}
+	return c.client.ListAcceleratorTypes(project, zone, opts...)
+}
+
+// ListDiskTypes uses the override method ListDiskTypesFn or the real implementation.
+func (c *TestClient) ListDiskTypes(project, zone string, opts ...ListCallOption) ([]*compute.DiskType, error) {
+	c.record("ListDiskTypes", project, zone, opts)
+	if c.ListDiskTypesFn != nil {
+		return c.ListDiskTypesFn(project, zone, opts...)
+	}
+	return c.client.ListDiskTypes(project, zone, opts...)
+}
+
+// ListLicenses uses the override method ListLicensesFn or the real implementation.
+func (c *TestClient) ListLicenses(project string, opts ...ListCallOption) ([]*compute.License, error) {
+	c.record("ListLicenses", project, opts)
+	if c.ListLicensesFn != nil {
+		return c.ListLicensesFn(project, opts...)
+	}
+	return c.client.ListLicenses(project, opts...)
+}
+
+// ListZones uses the override method ListZonesFn or the real implementation.
+func (c *TestClient) ListZones(project string, opts ...ListCallOption) ([]*compute.Zone, error) {
+	c.record("ListZones", project, opts)
+	if c.ListZonesFn != nil {
+		return c.ListZonesFn(project, opts...)
+	}
+	return c.client.ListZones(project, opts...)
+}
+
+// ListRegions uses the override method ListRegionsFn or the real implementation.
+func (c *TestClient) ListRegions(project string, opts ...ListCallOption) ([]*compute.Region, error) {
+	c.record("ListRegions", project, opts)
+	if c.ListRegionsFn != nil {
+		return c.ListRegionsFn(project, opts...)
+	}
+	return c.client.ListRegions(project, opts...)
+}
+
+// SetCommonInstanceMetadata uses the override method SetCommonInstanceMetadataFn or the real implementation.
+func (c *TestClient) SetCommonInstanceMetadata(project string, md *compute.Metadata) error {
+	c.record("SetCommonInstanceMetadata", project, md)
+	if c.SetCommonInstanceMetadataFn != nil {
+		return c.SetCommonInstanceMetadataFn(project, md)
+	}
+	return c.client.SetCommonInstanceMetadata(project, md)
+}
+
+// Retry uses the override method RetryFn or the real implementation.
+func (c *TestClient) Retry(f func(opts ...googleapi.CallOption) (*compute.Operation, error), opts ...googleapi.CallOption) (op *compute.Operation, err error) {
+	c.record("Retry", f, opts)
+	if c.RetryFn != nil {
+		return c.RetryFn(f, opts...)
+	}
+	return c.client.Retry(f, opts...)
+}
+
+// RetryBeta uses the override method RetryBetaFn or the real implementation.
+func (c *TestClient) RetryBeta(f func(opts ...googleapi.CallOption) (*computeBeta.Operation, error), opts ...googleapi.CallOption) (op *computeBeta.Operation, err error) {
+	c.record("RetryBeta", f, opts)
+	if c.RetryBetaFn != nil {
+		return c.RetryBetaFn(f, opts...)
+	}
+	return c.client.RetryBeta(f, opts...)
+}
+
+// SetOperationPollInterval uses the override method SetOperationPollIntervalFn or the real implementation.
+func (c *TestClient) SetOperationPollInterval(d time.Duration) {
+	c.record("SetOperationPollInterval", d)
+	if c.SetOperationPollIntervalFn != nil {
+		c.SetOperationPollIntervalFn(d)
+		return
+	}
+	c.client.SetOperationPollInterval(d)
+}
+
+// BasePath uses the override method BasePathFn or the real implementation.
+func (c *TestClient) BasePath() string {
+	c.record("BasePath")
+	if c.BasePathFn != nil {
+		return c.BasePathFn()
+	}
+	return c.client.BasePath()
+}
+
+// SetAuditRecorder uses the override method SetAuditRecorderFn or the real implementation.
+func (c *TestClient) SetAuditRecorder(r AuditRecorder) {
+	c.record("SetAuditRecorder", r)
+	if c.SetAuditRecorderFn != nil {
+		c.SetAuditRecorderFn(r)
+		return
+	}
+	c.client.SetAuditRecorder(r)
+}
+
+// SetRetryBudget uses the override method SetRetryBudgetFn or the real implementation.
+func (c *TestClient) SetRetryBudget(b *RetryBudget) {
+	c.record("SetRetryBudget", b)
+	if c.SetRetryBudgetFn != nil {
+		c.SetRetryBudgetFn(b)
+		return
+	}
+	c.client.SetRetryBudget(b)
+}
+
+// SetHooks uses the override method SetHooksFn or the real implementation.
+func (c *TestClient) SetHooks(h *Hooks) {
+	c.record("SetHooks", h)
+	if c.SetHooksFn != nil {
+		c.SetHooksFn(h)
+		return
+	}
+	c.client.SetHooks(h)
+}
+
+// APIUsage uses the override method APIUsageFn or the real implementation.
+func (c *TestClient) APIUsage() []APIUsage {
+	c.record("APIUsage")
+	if c.APIUsageFn != nil {
+		return c.APIUsageFn()
+	}
+	return c.client.APIUsage()
+}
+
+// WithAuditCaller uses the override method WithAuditCallerFn or the real implementation.
+func (c *TestClient) WithAuditCaller(caller string) Client {
+	c.record("WithAuditCaller", caller)
+	if c.WithAuditCallerFn != nil {
+		return c.WithAuditCallerFn(caller)
+	}
+	return c
+}
+
+// zoneOperationsWait uses the override method zoneOperationsWaitFn or the real implementation.
+func (c *TestClient) zoneOperationsWait(project, zone, name string) error {
+	if c.zoneOperationsWaitFn != nil {
+		return c.zoneOperationsWaitFn(project, zone, name)
+	}
+	return c.client.zoneOperationsWait(project, zone, name)
+}
+
+// regionOperationsWait uses the override method regionOperationsWaitFn or the real implementation.
+func (c *TestClient) regionOperationsWait(project, region, name string) error {
+	if c.regionOperationsWaitFn != nil {
+		return c.regionOperationsWaitFn(project, region, name)
+	}
+	return c.client.regionOperationsWait(project, region, name)
+}
+
+// globalOperationsWait uses the override method globalOperationsWaitFn or the real implementation.
+func (c *TestClient) globalOperationsWait(project, name string) error {
+	if c.globalOperationsWaitFn != nil {
+		return c.globalOperationsWaitFn(project, name)
+	}
+	return c.client.globalOperationsWait(project, name)
+}
@@ -17,6 +17,7 @@ package compute
 import (
 	"fmt"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"google.golang.org/api/compute/v1"
@@ -54,6 +55,9 @@ func TestTestClient(t *testing.T) {
 		{"create subnetwork", func() { c.CreateSubnetwork("a", "b", &compute.Subnetwork{}) }, "/projects/a/regions/b/subnetworks?alt=json&prettyPrint=false"},
 		{"instances start", func() { c.StartInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c/start?alt=json&prettyPrint=false"},
 		{"instances stop", func() { c.StopInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c/stop?alt=json&prettyPrint=false"},
+		{"instances reset", func() { c.ResetInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c/reset?alt=json&prettyPrint=false"},
+		{"instances simulate maintenance event", func() { c.SimulateMaintenanceEvent("a", "b", "c") }, "/projects/a/zones/b/instances/c/simulateMaintenanceEvent?alt=json&prettyPrint=false"},
+		{"instances set scheduling", func() { c.SetScheduling("a", "b", "c", nil) }, "/projects/a/zones/b/instances/c/setScheduling?alt=json&prettyPrint=false"},
 		{"delete disk", func() { c.DeleteDisk("a", "b", "c") }, "/projects/a/zones/b/disks/c?alt=json&prettyPrint=false"},
 		{"delete firewall rule", func() { c.DeleteFirewallRule("a", "b") }, "/projects/a/global/firewalls/b?alt=json&prettyPrint=false"},
 		{"delete image", func() { c.DeleteImage("a", "b") }, "/projects/a/global/images/b?alt=json&prettyPrint=false"},
@@ -65,12 +69,15 @@ func TestTestClient(t *testing.T) {
 		{"get project", func() { c.GetProject("a") }, "/projects/a?alt=json&prettyPrint=false"},
 		{"get machine type", func() { c.GetMachineType("a", "b", "c") }, "/projects/a/zones/b/machineTypes/c?alt=json&prettyPrint=false"},
 		{"list machine types", func() { c.ListMachineTypes("a", "b", listOpts...) }, "/projects/a/zones/b/machineTypes?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
+		{"list accelerator types", func() { c.ListAcceleratorTypes("a", "b", listOpts...) }, "/projects/a/zones/b/acceleratorTypes?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
+		{"list disk types", func() { c.ListDiskTypes("a", "b", listOpts...) }, "/projects/a/zones/b/diskTypes?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get firewall rule", func() { c.GetFirewallRule("a", "b") }, "/projects/a/global/firewalls/b?alt=json&prettyPrint=false"},
 		{"list firewall rules", func() { c.ListFirewallRules("a", listOpts...) }, "/projects/a/global/firewalls?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get zone", func() { c.GetZone("a", "b") }, "/projects/a/zones/b?alt=json&prettyPrint=false"},
 		{"list zones", func() { c.ListZones("a", listOpts...) }, "/projects/a/zones?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get instance", func() { c.GetInstance("a", "b", "c") }, "/projects/a/zones/b/instances/c?alt=json&prettyPrint=false"},
 		{"aggregated list instances", func() { c.AggregatedListInstances("a", listOpts...) }, "/projects/a/aggregated/instances?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
+		{"aggregated list instances with status", func() { c.AggregatedListInstancesWithStatus("a", listOpts...) }, "/projects/a/aggregated/instances?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"list instances", func() { c.ListInstances("a", "b", listOpts...) }, "/projects/a/zones/b/instances?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get image from family", func() { c.GetImageFromFamily("a", "b") }, "/projects/a/global/images/family/b?alt=json&prettyPrint=false"},
 		{"get image", func() { c.GetImage("a", "b") }, "/projects/a/global/images/b?alt=json&prettyPrint=false"},
@@ -80,9 +87,11 @@ func TestTestClient(t *testing.T) {
 		{"list networks", func() { c.ListNetworks("a", listOpts...) }, "/projects/a/global/networks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get subnetwork", func() { c.GetSubnetwork("a", "b", "c") }, "/projects/a/regions/b/subnetworks/c?alt=json&prettyPrint=false"},
 		{"aggregated list subnetworks", func() { c.AggregatedListSubnetworks("a", listOpts...) }, "/projects/a/aggregated/subnetworks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
+		{"aggregated list subnetworks with status", func() { c.AggregatedListSubnetworksWithStatus("a", listOpts...) }, "/projects/a/aggregated/subnetworks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"list subnetworks", func() { c.ListSubnetworks("a", "b", listOpts...) }, "/projects/a/regions/b/subnetworks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"get disk", func() { c.GetDisk("a", "b", "c") }, "/projects/a/zones/b/disks/c?alt=json&prettyPrint=false"},
 		{"aggregated list disks", func() { c.AggregatedListDisks("a", listOpts...) }, "/projects/a/aggregated/disks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
+		{"aggregated list disks with status", func() { c.AggregatedListDisksWithStatus("a", listOpts...) }, "/projects/a/aggregated/disks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"list disks", func() { c.ListDisks("a", "b", listOpts...) }, "/projects/a/zones/b/disks?alt=json&filter=foo&orderBy=foo&pageToken=&prettyPrint=false"},
 		{"instance status", func() { c.InstanceStatus("a", "b", "c") }, "/projects/a/zones/b/instances/c?alt=json&prettyPrint=false"},
 		{"instance stopped", func() { c.InstanceStopped("a", "b", "c") }, "/projects/a/zones/b/instances/c?alt=json&prettyPrint=false"},
@@ -136,6 +145,9 @@ func TestTestClient(t *testing.T) {
 	c.CreateSubnetworkFn = func(_, _ string, _ *compute.Subnetwork) error { fakeCalled = true; return nil }
 	c.StartInstanceFn = func(_, _, _ string) error { fakeCalled = true; return nil }
 	c.StopInstanceFn = func(_, _, _ string) error { fakeCalled = true; return nil }
+	c.ResetInstanceFn = func(_, _, _ string) error { fakeCalled = true; return nil }
+	c.SimulateMaintenanceEventFn = func(_, _, _ string) error { fakeCalled = true; return nil }
+	c.SetSchedulingFn = func(_, _, _ string, _ *compute.Scheduling) error { fakeCalled = true; return nil }
 	c.DeleteDiskFn = func(_, _, _ string) error { fakeCalled = true; return nil }
 	c.DeleteFirewallRuleFn = func(_, _ string) error { fakeCalled = true; return nil }
 	c.DeleteImageFn = func(_, _ string) error { fakeCalled = true; return nil }
@@ -163,6 +175,10 @@ func TestTestClient(t *testing.T) {
 		fakeCalled = true
 		return nil, nil
 	}
+	c.AggregatedListInstancesWithStatusFn = func(_ string, _ ...ListCallOption) ([]*compute.Instance, []ScopeStatus, error) {
+		fakeCalled = true
+		return nil, nil, nil
+	}
 	c.ListInstancesFn = func(_, _ string, _ ...ListCallOption) ([]*compute.Instance, error) {
 		fakeCalled = true
 		return nil, nil
@@ -172,6 +188,10 @@ func TestTestClient(t *testing.T) {
 		fakeCalled = true
 		return nil, nil
 	}
+	c.AggregatedListDisksWithStatusFn = func(_ string, _ ...ListCallOption) ([]*compute.Disk, []ScopeStatus, error) {
+		fakeCalled = true
+		return nil, nil, nil
+	}
 	c.ListDisksFn = func(_, _ string, _ ...ListCallOption) ([]*compute.Disk, error) {
 		fakeCalled = true
 		return nil, nil
@@ -193,6 +213,10 @@ func TestTestClient(t *testing.T) {
 		fakeCalled = true
 		return nil, nil
 	}
+	c.AggregatedListSubnetworksWithStatusFn = func(_ string, _ ...ListCallOption) ([]*compute.Subnetwork, []ScopeStatus, error) {
+		fakeCalled = true
+		return nil, nil, nil
+	}
 	c.ListSubnetworksFn = func(_, _ string, _ ...ListCallOption) ([]*compute.Subnetwork, error) {
 		fakeCalled = true
 		return nil, nil
@@ -202,6 +226,14 @@ func TestTestClient(t *testing.T) {
 		fakeCalled = true
 		return nil, nil
 	}
+	c.ListAcceleratorTypesFn = func(_, _ string, _ ...ListCallOption) ([]*compute.AcceleratorType, error) {
+		fakeCalled = true
+		return nil, nil
+	}
+	c.ListDiskTypesFn = func(_, _ string, _ ...ListCallOption) ([]*compute.DiskType, error) {
+		fakeCalled = true
+		return nil, nil
+	}
 	c.InstanceStatusFn = func(_, _, _ string) (string, error) { fakeCalled = true; return "", nil }
 	c.InstanceStoppedFn = func(_, _, _ string) (bool, error) { fakeCalled = true; return false, nil }
 	c.SetInstanceMetadataFn = func(_, _, _ string, _ *compute.Metadata) error { fakeCalled = true; return nil }
@@ -221,3 +253,78 @@ func TestTestClient(t *testing.T) {
 	wantRealCalled = false
 	runTests()
 }
+
+func TestTestClientCalls(t *testing.T) {
+	_, c, _ := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	c.GetDiskFn = func(_, _, _ string) (*compute.Disk, error) { return nil, nil }
+	c.InstanceStatusFn = func(_, _, _ string) (string, error) { return "RUNNING", nil }
+
+	opts := []ListCallOption{Filter("foo")}
+	c.GetDisk("p", "z", "d")
+	c.InstanceStopped("p", "z", "i")
+	c.ListDisks("p", "z", opts...)
+
+	want := []TestClientCall{
+		{"GetDisk", []interface{}{"p", "z", "d"}},
+		{"InstanceStopped", []interface{}{"p", "z", "i"}},
+		{"InstanceStatus", []interface{}{"p", "z", "i"}},
+		{"ListDisks", []interface{}{"p", "z", opts}},
+	}
+	if got := c.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+	if got, want := c.CallsTo("InstanceStatus"), [][]interface{}{{"p", "z", "i"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got InstanceStatus calls %v, want %v", got, want)
+	}
+
+	c.ResetCalls()
+	if got := c.Calls(); len(got) != 0 {
+		t.Errorf("got calls %v after ResetCalls", got)
+	}
+}
+
+type fakeT struct {
+	errs []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func TestTestClientAssertions(t *testing.T) {
+	_, c, _ := NewTestClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	c.DeleteDiskFn = func(_, _, _ string) error { return nil }
+	c.DeleteDisk("p", "z", "d1")
+	c.DeleteDisk("p", "z", "d2")
+
+	tests := []struct {
+		desc    string
+		assert  func(ft TestingT) bool
+		wantErr bool
+	}{
+		{"called", func(ft TestingT) bool { return c.AssertCalled(ft, "DeleteDisk") }, false},
+		{"called with args", func(ft TestingT) bool { return c.AssertCalled(ft, "DeleteDisk", "p", "z", "d2") }, false},
+		{"not called with args", func(ft TestingT) bool { return c.AssertCalled(ft, "DeleteDisk", "p", "z", "d3") }, true},
+		{"not called", func(ft TestingT) bool { return c.AssertCalled(ft, "DeleteImage") }, true},
+		{"assert not called", func(ft TestingT) bool { return c.AssertNotCalled(ft, "DeleteImage") }, false},
+		{"assert not called, called", func(ft TestingT) bool { return c.AssertNotCalled(ft, "DeleteDisk") }, true},
+	}
+	for _, tt := range tests {
+		ft := &fakeT{}
+		ok := tt.assert(ft)
+		if ok == tt.wantErr || (len(ft.errs) > 0) != tt.wantErr {
+			t.Errorf("%s: got %t and errors %q, want error: %t", tt.desc, ok, ft.errs, tt.wantErr)
+		}
+	}
+
+	got := c.CallsMatching("DeleteDisk", func(args []interface{}) bool { return args[2] == "d1" })
+	if want := []TestClientCall{{"DeleteDisk", []interface{}{"p", "z", "d1"}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+}
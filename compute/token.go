@@ -0,0 +1,120 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultRefreshMargin is how long before they expire a RefreshingTokenSource
+// created by the workflow refreshes tokens.
+const DefaultRefreshMargin = 5 * time.Minute
+
+// RefreshingTokenSource caches the tokens of another source and refreshes
+// them a margin before they expire, rather than seconds before as
+// oauth2.ReuseTokenSource does, so that tokens don't expire during long
+// requests or operation waits. A client created with
+// option.WithTokenSource of a RefreshingTokenSource also refreshes the token
+// and retries once when a request is rejected with 401 Unauthorized.
+//
+// The token is only refreshed as early as the source allows: a source that
+// caches tokens itself keeps returning the cached token until it considers
+// it expired.
+type RefreshingTokenSource struct {
+	src    oauth2.TokenSource
+	margin time.Duration
+
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+// NewRefreshingTokenSource returns a RefreshingTokenSource refreshing the
+// tokens of src margin before they expire.
+func NewRefreshingTokenSource(src oauth2.TokenSource, margin time.Duration) *RefreshingTokenSource {
+	return &RefreshingTokenSource{src: src, margin: margin}
+}
+
+// Token returns the cached token, or a new token from the source if the
+// cached one expires within the margin. If getting a new token fails, the
+// cached token is returned as long as it is valid.
+func (s *RefreshingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok != nil && (s.tok.Expiry.IsZero() || time.Until(s.tok.Expiry) > s.margin) {
+		return s.tok, nil
+	}
+	tok, err := s.src.Token()
+	if err != nil {
+		if s.tok.Valid() {
+			return s.tok, nil
+		}
+		return nil, err
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// Invalidate drops the cached token, so that the next call to Token gets a
+// new one from the source.
+func (s *RefreshingTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.tok = nil
+	s.mu.Unlock()
+}
+
+// tokenSource returns the RefreshingTokenSource the requests sent through rt
+// are authorized with, if any.
+func tokenSource(rt http.RoundTripper) *RefreshingTokenSource {
+	if t, ok := rt.(*oauth2.Transport); ok {
+		if ts, ok := t.Source.(*RefreshingTokenSource); ok {
+			return ts
+		}
+	}
+	return nil
+}
+
+// authRetryTransport resends requests rejected with 401 Unauthorized once,
+// with a new token from tokens.
+type authRetryTransport struct {
+	base   http.RoundTripper
+	tokens *RefreshingTokenSource
+}
+
+func (t *authRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// The body of the request was consumed, it can only be resent if it can
+	// be read again.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	t.tokens.Invalidate()
+	return t.base.RoundTrip(retry)
+}
@@ -0,0 +1,132 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+// testTokenSource returns tokens "t1", "t2", ... expiring after expiry, or
+// err if set.
+type testTokenSource struct {
+	mu     sync.Mutex
+	n      int
+	expiry time.Duration
+	err    error
+}
+
+func (s *testTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.n++
+	return &oauth2.Token{AccessToken: fmt.Sprintf("t%d", s.n), Expiry: time.Now().Add(s.expiry)}, nil
+}
+
+func TestRefreshingTokenSource(t *testing.T) {
+	tests := []struct {
+		desc      string
+		expiry    time.Duration
+		wantFirst string
+		wantNext  string
+	}{
+		{"outside margin case", time.Hour, "t1", "t1"},
+		{"within margin case", 2 * time.Minute, "t1", "t2"},
+	}
+	for _, tt := range tests {
+		src := &testTokenSource{expiry: tt.expiry}
+		ts := NewRefreshingTokenSource(src, 5*time.Minute)
+		for i, want := range []string{tt.wantFirst, tt.wantNext} {
+			tok, err := ts.Token()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+			}
+			if tok.AccessToken != want {
+				t.Errorf("%s: call %d got token %q, want %q", tt.desc, i, tok.AccessToken, want)
+			}
+		}
+	}
+
+	// Keeps the valid cached token if the refresh fails.
+	src := &testTokenSource{expiry: 2 * time.Minute}
+	ts := NewRefreshingTokenSource(src, 5*time.Minute)
+	ts.Token()
+	src.err = errors.New("error")
+	if tok, err := ts.Token(); err != nil || tok.AccessToken != "t1" {
+		t.Errorf("got %v, %v, want the cached token", tok, err)
+	}
+	ts.Invalidate()
+	if _, err := ts.Token(); err == nil {
+		t.Error("expected error once the cached token is invalidated")
+	}
+}
+
+func TestAuthRetryTransport(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer t2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"error": {"code": 401, "message": "unauthorized"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"name": "p"}`)
+	}))
+	defer svr.Close()
+
+	ts := NewRefreshingTokenSource(&testTokenSource{expiry: time.Hour}, 5*time.Minute)
+	c, err := NewClient(context.Background(), option.WithTokenSource(ts), option.WithEndpoint(svr.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.GetProject("p")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name != "p" || calls != 2 {
+		t.Errorf("got project %q after %d calls, want \"p\" after 2 calls", p.Name, calls)
+	}
+
+	// Not retried a second time.
+	calls = 0
+	ts = NewRefreshingTokenSource(&testTokenSource{expiry: time.Hour}, 5*time.Minute)
+	ts.tok = &oauth2.Token{AccessToken: "t0", Expiry: time.Now().Add(time.Hour)}
+	c, err = NewClient(context.Background(), option.WithTokenSource(ts), option.WithEndpoint(svr.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.src.(*testTokenSource).n = 2
+	if _, err := c.GetProject("p"); err == nil {
+		t.Error("expected error")
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want 2", calls)
+	}
+}
@@ -0,0 +1,152 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// APIUsage counts the API calls a client made to a method in a project.
+// Retries are counted as calls, as they count against quotas.
+type APIUsage struct {
+	Project string
+	// Method is the API method, e.g. "instances.insert".
+	Method string
+	Calls  int
+	// RateLimited is the number of calls rejected with 429 Too Many Requests.
+	RateLimited int
+}
+
+// usageState holds the API usage of a client. It is shared by the copies of
+// a client returned by WithAuditCaller.
+type usageState struct {
+	mu sync.Mutex
+	// usage is keyed by project and method, separated by a space.
+	usage map[string]*APIUsage
+}
+
+func (u *usageState) record(project, method string, rateLimited bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.usage == nil {
+		u.usage = map[string]*APIUsage{}
+	}
+	k := project + " " + method
+	a, ok := u.usage[k]
+	if !ok {
+		a = &APIUsage{Project: project, Method: method}
+		u.usage[k] = a
+	}
+	a.Calls++
+	if rateLimited {
+		a.RateLimited++
+	}
+}
+
+// apiMethod returns the project and the API method of a request, derived
+// from its URL, e.g. "instances.insert" for a POST to
+// projects/p/zones/z/instances.
+func apiMethod(req *http.Request) (project, method string) {
+	i := strings.Index(req.URL.Path, "projects/")
+	if i < 0 {
+		return "", "unknown"
+	}
+	segs := strings.Split(strings.Trim(req.URL.Path[i:], "/"), "/")[1:]
+	if len(segs) > 0 {
+		project, segs = segs[0], segs[1:]
+	}
+
+	// Drop the scope of the resource.
+	var scoped, aggregated bool
+	switch {
+	case len(segs) > 2 && (segs[0] == "zones" || segs[0] == "regions"):
+		segs, scoped = segs[2:], true
+	case len(segs) > 1 && segs[0] == "global":
+		segs, scoped = segs[1:], true
+	case len(segs) > 1 && segs[0] == "aggregated":
+		segs, scoped, aggregated = segs[1:], true, true
+	}
+
+	byMethod := func() string {
+		switch req.Method {
+		case http.MethodGet:
+			return "get"
+		case http.MethodDelete:
+			return "delete"
+		case http.MethodPatch:
+			return "patch"
+		case http.MethodPut:
+			return "update"
+		}
+		return strings.ToLower(req.Method)
+	}
+	switch {
+	case len(segs) == 0:
+		return project, "projects." + byMethod()
+	case !scoped && segs[0] != "zones" && segs[0] != "regions":
+		// A method of the project, e.g. setCommonInstanceMetadata.
+		return project, "projects." + segs[0]
+	case aggregated:
+		return project, segs[0] + ".aggregatedList"
+	case len(segs) == 1 && req.Method == http.MethodPost:
+		return project, segs[0] + ".insert"
+	case len(segs) == 1:
+		return project, segs[0] + ".list"
+	case len(segs) == 2:
+		return project, segs[0] + "." + byMethod()
+	}
+	return project, segs[0] + "." + segs[len(segs)-1]
+}
+
+// usageTransport counts the requests sent through it.
+type usageTransport struct {
+	base  http.RoundTripper
+	usage *usageState
+}
+
+func (t *usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	project, method := apiMethod(req)
+	t.usage.record(project, method, err == nil && resp.StatusCode == http.StatusTooManyRequests)
+	return resp, err
+}
+
+// APIUsage returns the API calls made by the client, and the copies returned
+// by WithAuditCaller, sorted by project and method.
+func (c *client) APIUsage() []APIUsage {
+	if c.usage == nil {
+		return nil
+	}
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	var us []APIUsage
+	for _, u := range c.usage.usage {
+		us = append(us, *u)
+	}
+	sort.Slice(us, func(i, j int) bool {
+		if us[i].Project != us[j].Project {
+			return us[i].Project < us[j].Project
+		}
+		return us[i].Method < us[j].Method
+	})
+	return us
+}
@@ -0,0 +1,196 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package compute
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// ZonePreferences are the constraints ResolveZone picks a zone by. Empty
+// fields are not constrained.
+type ZonePreferences struct {
+	// Zones are tried first, in order, before the other zones of the project.
+	Zones []string
+	// Region restricts the candidates to the zones of a region.
+	Region string
+	// MachineType must be available in the zone.
+	MachineType string
+	// AcceleratorType must be available in the zone.
+	AcceleratorType string
+	// MinCPUPlatform must be available in the zone.
+	MinCPUPlatform string
+}
+
+// String describes the preferences for error messages.
+func (p ZonePreferences) String() string {
+	var s []string
+	if p.Region != "" {
+		s = append(s, fmt.Sprintf("region %q", p.Region))
+	}
+	if p.MachineType != "" {
+		s = append(s, fmt.Sprintf("machine type %q", p.MachineType))
+	}
+	if p.AcceleratorType != "" {
+		s = append(s, fmt.Sprintf("accelerator type %q", p.AcceleratorType))
+	}
+	if p.MinCPUPlatform != "" {
+		s = append(s, fmt.Sprintf("CPU platform %q", p.MinCPUPlatform))
+	}
+	if len(s) == 0 {
+		return "no constraints"
+	}
+	return strings.Join(s, ", ")
+}
+
+// zoneCache caches zone lookups, which don't change during the life of a
+// client. It is shared by copies of a client.
+type zoneCache struct {
+	mu      sync.Mutex
+	regions map[string]string
+	zones   map[string][]*compute.Zone
+}
+
+func newZoneCache() *zoneCache {
+	return &zoneCache{regions: map[string]string{}, zones: map[string][]*compute.Zone{}}
+}
+
+// GetZoneRegion returns the name of the region of a zone. Results are cached.
+func (c *client) GetZoneRegion(project, zone string) (string, error) {
+	c.zoneCache.mu.Lock()
+	region, ok := c.zoneCache.regions[project+"/"+zone]
+	c.zoneCache.mu.Unlock()
+	if ok {
+		return region, nil
+	}
+
+	z, err := c.i.GetZone(project, zone)
+	if err != nil {
+		return "", err
+	}
+	region = path.Base(z.Region)
+	c.zoneCache.mu.Lock()
+	c.zoneCache.regions[project+"/"+zone] = region
+	c.zoneCache.mu.Unlock()
+	return region, nil
+}
+
+// listZones lists the zones of a project that are up. Results are cached.
+func (c *client) listZones(project string) ([]*compute.Zone, error) {
+	c.zoneCache.mu.Lock()
+	defer c.zoneCache.mu.Unlock()
+	if zs, ok := c.zoneCache.zones[project]; ok {
+		return zs, nil
+	}
+
+	zs, err := c.i.ListZones(project)
+	if err != nil {
+		return nil, err
+	}
+	var up []*compute.Zone
+	for _, z := range zs {
+		c.zoneCache.regions[project+"/"+z.Name] = path.Base(z.Region)
+		if z.Status == "UP" {
+			up = append(up, z)
+		}
+	}
+	sort.Slice(up, func(i, j int) bool { return up[i].Name < up[j].Name })
+	c.zoneCache.zones[project] = up
+	return up, nil
+}
+
+// zoneMatches reports whether zone z satisfies the machine type, accelerator
+// and CPU platform preferences.
+func (c *client) zoneMatches(project string, z *compute.Zone, prefs ZonePreferences) (bool, error) {
+	if prefs.MinCPUPlatform != "" && !containsString(z.AvailableCpuPlatforms, prefs.MinCPUPlatform) {
+		return false, nil
+	}
+	if prefs.MachineType != "" {
+		if _, err := c.i.GetMachineType(project, z.Name, prefs.MachineType); err != nil {
+			if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	if prefs.AcceleratorType != "" {
+		ats, err := c.i.ListAcceleratorTypes(project, z.Name)
+		if err != nil {
+			return false, err
+		}
+		for _, at := range ats {
+			if at.Name == prefs.AcceleratorType {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// ResolveZone picks a zone of project that is up and satisfies prefs. The
+// preferred zones are tried first, then the other zones in name order.
+func (c *client) ResolveZone(project string, prefs ZonePreferences) (string, error) {
+	zs, err := c.listZones(project)
+	if err != nil {
+		return "", err
+	}
+	byName := map[string]*compute.Zone{}
+	for _, z := range zs {
+		byName[z.Name] = z
+	}
+	var candidates []*compute.Zone
+	for _, name := range prefs.Zones {
+		if z, ok := byName[name]; ok {
+			candidates = append(candidates, z)
+			delete(byName, name)
+		}
+	}
+	for _, z := range zs {
+		if _, ok := byName[z.Name]; ok {
+			candidates = append(candidates, z)
+		}
+	}
+
+	for _, z := range candidates {
+		if prefs.Region != "" && path.Base(z.Region) != prefs.Region {
+			continue
+		}
+		ok, err := c.zoneMatches(project, z, prefs)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return z.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no zone of project %q matches %s", project, prefs)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// ConfigPathEnv names a config file to read instead of the
+	// DefaultConfigPaths.
+	ConfigPathEnv = "DAISY_CONFIG"
+	// SystemConfigPath is the system wide config file.
+	SystemConfigPath = "/etc/daisy/config"
+)
+
+// configEnv maps the environment variables overriding config file values to
+// the values they override.
+var configEnv = []struct {
+	env   string
+	field func(c *Config) *string
+}{
+	{"DAISY_PROJECT", func(c *Config) *string { return &c.Project }},
+	{"DAISY_ZONE", func(c *Config) *string { return &c.Zone }},
+	{"DAISY_OAUTH", func(c *Config) *string { return &c.OAuthPath }},
+	{"DAISY_COMPUTE_ENDPOINT", func(c *Config) *string { return &c.ComputeEndpoint }},
+	{"DAISY_STORAGE_ENDPOINT", func(c *Config) *string { return &c.StorageEndpoint }},
+	{"DAISY_QUOTA_PROJECT", func(c *Config) *string { return &c.QuotaProject }},
+	{"DAISY_REQUEST_REASON", func(c *Config) *string { return &c.RequestReason }},
+	{"DAISY_USER_AGENT_SUFFIX", func(c *Config) *string { return &c.UserAgentSuffix }},
+}
+
+// Config holds defaults for the workflows of a user or system, read from a
+// JSON config file by LoadConfig. Values set by a workflow take precedence
+// over its Config, and explicit values, such as command line flags, are
+// expected to be set on the workflow after Config.Apply.
+type Config struct {
+	// Default Workflow.Project, can be overridden by DAISY_PROJECT.
+	Project string `json:",omitempty"`
+	// Default Workflow.Zone, can be overridden by DAISY_ZONE.
+	Zone string `json:",omitempty"`
+	// Default Workflow.OAuthPath, can be overridden by DAISY_OAUTH.
+	OAuthPath string `json:",omitempty"`
+	// Default Workflow.ComputeEndpoint, can be overridden by
+	// DAISY_COMPUTE_ENDPOINT.
+	ComputeEndpoint string `json:",omitempty"`
+	// Default Workflow.StorageEndpoint, can be overridden by
+	// DAISY_STORAGE_ENDPOINT.
+	StorageEndpoint string `json:",omitempty"`
+	// Default Workflow.QuotaProject, can be overridden by DAISY_QUOTA_PROJECT.
+	QuotaProject string `json:",omitempty"`
+	// Default Workflow.RequestReason, can be overridden by
+	// DAISY_REQUEST_REASON.
+	RequestReason string `json:",omitempty"`
+	// Default Workflow.UserAgentSuffix, can be overridden by
+	// DAISY_USER_AGENT_SUFFIX.
+	UserAgentSuffix string `json:",omitempty"`
+	// Labels added to the disks, forwarding rules, images, instances and
+	// snapshots workflows create, unless they set the same label.
+	Labels map[string]string `json:",omitempty"`
+	// Default Workflow.PollingIntervals, each interval applies unless the
+	// workflow sets it.
+	PollingIntervals *PollingIntervals `json:",omitempty"`
+}
+
+// DefaultConfigPaths returns the config files LoadConfig reads when
+// DAISY_CONFIG is not set: SystemConfigPath, then ~/.daisy/config.
+func DefaultConfigPaths() []string {
+	paths := []string{SystemConfigPath}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".daisy", "config"))
+	}
+	return paths
+}
+
+// LoadConfig reads the config files in paths, values of later files taking
+// precedence, then applies the DAISY_PROJECT, DAISY_ZONE, DAISY_OAUTH,
+// DAISY_COMPUTE_ENDPOINT, DAISY_STORAGE_ENDPOINT, DAISY_QUOTA_PROJECT,
+// DAISY_REQUEST_REASON and DAISY_USER_AGENT_SUFFIX environment variables.
+// Missing files are skipped. A relative OAuthPath is relative to the file
+// setting it. If no paths are given, the file named by DAISY_CONFIG is read,
+// which must exist, or else the DefaultConfigPaths.
+func LoadConfig(paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		if p, ok := os.LookupEnv(ConfigPathEnv); ok {
+			if _, err := os.Stat(p); err != nil {
+				return nil, fmt.Errorf("config file %q set by %s: %v", p, ConfigPathEnv, err)
+			}
+			paths = []string{p}
+		} else {
+			paths = DefaultConfigPaths()
+		}
+	}
+
+	c := &Config{}
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %q: %v", p, err)
+		}
+		var fc Config
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&fc); err != nil {
+			return nil, JSONError(p, data, err)
+		}
+		if fc.OAuthPath != "" && !filepath.IsAbs(fc.OAuthPath) {
+			fc.OAuthPath = filepath.Join(filepath.Dir(p), fc.OAuthPath)
+		}
+		c.merge(&fc)
+	}
+	for _, e := range configEnv {
+		if v, ok := os.LookupEnv(e.env); ok {
+			*e.field(c) = v
+		}
+	}
+
+	for k, v := range c.Labels {
+		if !labelKeyRgx.MatchString(k) {
+			return nil, fmt.Errorf("invalid config label key %q", k)
+		}
+		if !labelValueRgx.MatchString(v) {
+			return nil, fmt.Errorf("invalid value %q of config label %q", v, k)
+		}
+	}
+	return c, nil
+}
+
+// merge sets the values set in o on c.
+func (c *Config) merge(o *Config) {
+	for _, e := range configEnv {
+		if v := *e.field(o); v != "" {
+			*e.field(c) = v
+		}
+	}
+	for k, v := range o.Labels {
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		c.Labels[k] = v
+	}
+	if o.PollingIntervals != nil {
+		pi := *o.PollingIntervals
+		if c.PollingIntervals != nil {
+			mergePollingIntervals(&pi, c.PollingIntervals)
+		}
+		c.PollingIntervals = &pi
+	}
+}
+
+// mergePollingIntervals sets the intervals set in src and unset in dst on
+// dst.
+func mergePollingIntervals(dst, src *PollingIntervals) {
+	for _, f := range []struct{ dst, src *string }{
+		{&dst.SerialOutput, &src.SerialOutput},
+		{&dst.GuestAttributes, &src.GuestAttributes},
+		{&dst.Operations, &src.Operations},
+		{&dst.InstanceStatus, &src.InstanceStatus},
+		{&dst.Default, &src.Default},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+}
+
+// Apply sets the values of c on w where w does not set them.
+func (c *Config) Apply(w *Workflow) {
+	for _, f := range []struct{ dst, src *string }{
+		{&w.Project, &c.Project},
+		{&w.Zone, &c.Zone},
+		{&w.OAuthPath, &c.OAuthPath},
+		{&w.ComputeEndpoint, &c.ComputeEndpoint},
+		{&w.StorageEndpoint, &c.StorageEndpoint},
+		{&w.QuotaProject, &c.QuotaProject},
+		{&w.RequestReason, &c.RequestReason},
+		{&w.UserAgentSuffix, &c.UserAgentSuffix},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	if c.PollingIntervals != nil {
+		if w.PollingIntervals == nil {
+			w.PollingIntervals = &PollingIntervals{}
+		}
+		mergePollingIntervals(w.PollingIntervals, c.PollingIntervals)
+	}
+	if len(c.Labels) > 0 {
+		w.defaultLabels = map[string]string{}
+		for k, v := range c.Labels {
+			w.defaultLabels[k] = v
+		}
+	}
+}
+
+// addDefaultLabels adds the labels of the Config applied to w to the
+// resources w and its nested workflows create, unless they set them.
+func (w *Workflow) addDefaultLabels() {
+	if len(w.defaultLabels) == 0 {
+		return
+	}
+	for _, t := range w.labelTargets() {
+		for k, v := range w.defaultLabels {
+			if _, ok := (*t.labels)[k]; ok {
+				continue
+			}
+			if *t.labels == nil {
+				*t.labels = map[string]string{}
+			}
+			(*t.labels)[k] = v
+		}
+	}
+}
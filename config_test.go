@@ -0,0 +1,111 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	system := filepath.Join(dir, "system")
+	user := filepath.Join(dir, "user")
+	if err := ioutil.WriteFile(system, []byte(`{"Project": "system", "Zone": "system", "OAuthPath": "creds.json", "Labels": {"team": "system", "env": "ci"}, "PollingIntervals": {"SerialOutput": "1m", "Operations": "5s", "Default": "20s"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(user, []byte(`{"Zone": "user", "Labels": {"team": "user"}, "PollingIntervals": {"SerialOutput": "30s"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("DAISY_PROJECT", "env")
+	defer os.Unsetenv("DAISY_PROJECT")
+
+	got, err := LoadConfig(system, filepath.Join(dir, "dne"), user)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	want := &Config{
+		Project:          "env",
+		Zone:             "user",
+		OAuthPath:        filepath.Join(dir, "creds.json"),
+		Labels:           map[string]string{"team": "user", "env": "ci"},
+		PollingIntervals: &PollingIntervals{SerialOutput: "30s", Operations: "5s", Default: "20s"},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("config not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	for _, data := range []string{
+		`{"Unknown": "field"}`,
+		`{"Labels": {"Bad": "v"}}`,
+		`{"Project": `,
+	} {
+		if err := ioutil.WriteFile(user, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(user); err == nil {
+			t.Errorf("expected error loading %s", data)
+		}
+	}
+
+	os.Setenv(ConfigPathEnv, filepath.Join(dir, "dne"))
+	defer os.Unsetenv(ConfigPathEnv)
+	if _, err := LoadConfig(); err == nil {
+		t.Errorf("expected error for missing %s file", ConfigPathEnv)
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	c := &Config{
+		Project:          "config",
+		Zone:             "config",
+		StorageEndpoint:  "endpoint",
+		QuotaProject:     "quota",
+		Labels:           map[string]string{"k": "config", "team": "images"},
+		PollingIntervals: &PollingIntervals{SerialOutput: "1m", Operations: "5s"},
+	}
+	w := modifyTestWorkflow()
+	w.Zone = ""
+	w.PollingIntervals = &PollingIntervals{SerialOutput: "30s"}
+	c.Apply(w)
+
+	if w.Project != testProject {
+		t.Errorf("Project: got %q, want %q", w.Project, testProject)
+	}
+	if w.Zone != "config" {
+		t.Errorf("Zone: got %q, want %q", w.Zone, "config")
+	}
+	if w.StorageEndpoint != "endpoint" {
+		t.Errorf("StorageEndpoint: got %q, want %q", w.StorageEndpoint, "endpoint")
+	}
+	if w.QuotaProject != "quota" {
+		t.Errorf("QuotaProject: got %q, want %q", w.QuotaProject, "quota")
+	}
+	if diffRes := diff(w.PollingIntervals, &PollingIntervals{SerialOutput: "30s", Operations: "5s"}, 0); diffRes != "" {
+		t.Errorf("PollingIntervals not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	w.addDefaultLabels()
+	want := map[string]string{"k": "v", "team": "images"}
+	if diffRes := diff((*w.Steps["disks"].CreateDisks)[0].Labels, want, 0); diffRes != "" {
+		t.Errorf("labels not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
@@ -0,0 +1,321 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// hoursPerMonth converts monthly disk prices to hourly ones.
+const hoursPerMonth = 730
+
+// Prices are the unit prices used to tell the cost of workflow runs, in a
+// currency of the caller's choosing.
+type Prices struct {
+	CPUHour      float64
+	MemoryGBHour float64
+	// DiskGBHour is the price of a GB of disk for an hour by disk type, e.g.
+	// "pd-ssd". Disk types not listed are priced as "pd-standard".
+	DiskGBHour     map[string]float64
+	ExternalIPHour float64
+	EgressGB       float64
+}
+
+// DefaultPrices are rough on-demand prices of N1 instances, persistent disks,
+// external IPs and internet egress in us-central1, in USD.
+var DefaultPrices = Prices{
+	CPUHour:      0.031611,
+	MemoryGBHour: 0.004237,
+	DiskGBHour: map[string]float64{
+		"pd-standard": 0.04 / hoursPerMonth,
+		"pd-balanced": 0.10 / hoursPerMonth,
+		"pd-ssd":      0.17 / hoursPerMonth,
+		"pd-extreme":  0.125 / hoursPerMonth,
+	},
+	ExternalIPHour: 0.004,
+	EgressGB:       0.12,
+}
+
+// ResourceHours are the resources a workflow run uses over time.
+type ResourceHours struct {
+	CPUHours      float64
+	MemoryGBHours float64
+	// DiskGBHours are by disk type, e.g. "pd-ssd".
+	DiskGBHours     map[string]float64
+	ExternalIPHours float64
+	EgressGB        float64
+}
+
+// Cost returns the cost of h at prices p.
+func (h ResourceHours) Cost(p Prices) float64 {
+	cost := h.CPUHours*p.CPUHour + h.MemoryGBHours*p.MemoryGBHour + h.ExternalIPHours*p.ExternalIPHour + h.EgressGB*p.EgressGB
+	for t, gbHours := range h.DiskGBHours {
+		price, ok := p.DiskGBHour[t]
+		if !ok {
+			price = p.DiskGBHour["pd-standard"]
+		}
+		cost += gbHours * price
+	}
+	return cost
+}
+
+func (h ResourceHours) String() string {
+	var types []string
+	for t := range h.DiskGBHours {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	s := fmt.Sprintf("%.2f CPU-hours, %.2f GB-hours of memory", h.CPUHours, h.MemoryGBHours)
+	for _, t := range types {
+		s += fmt.Sprintf(", %.2f GB-hours of %s", h.DiskGBHours[t], t)
+	}
+	s += fmt.Sprintf(", %.2f external IP-hours", h.ExternalIPHours)
+	if h.EgressGB > 0 {
+		s += fmt.Sprintf(", %.2f GB of egress", h.EgressGB)
+	}
+	return s
+}
+
+// addInstance adds an instance of machine type mt, nil if unknown, with
+// externalIPs external IPs, alive for d.
+func (h *ResourceHours) addInstance(mt *compute.MachineType, externalIPs int, d time.Duration) {
+	if mt != nil {
+		h.CPUHours += float64(mt.GuestCpus) * d.Hours()
+		h.MemoryGBHours += float64(mt.MemoryMb) / 1024 * d.Hours()
+	}
+	h.ExternalIPHours += float64(externalIPs) * d.Hours()
+}
+
+// addDisk adds a disk, as described by info, alive for d.
+func (h *ResourceHours) addDisk(info diskInfo, d time.Duration) {
+	if h.DiskGBHours == nil {
+		h.DiskGBHours = map[string]float64{}
+	}
+	h.DiskGBHours[info.diskType] += float64(info.sizeGb) * d.Hours()
+}
+
+// defaultDiskSizeGb is the size assumed for disks created without a size,
+// those of most public images.
+const defaultDiskSizeGb = 10
+
+// diskInfo is what resource estimates need of a disk definition.
+type diskInfo struct {
+	sizeGb   int64
+	diskType string
+}
+
+// diskInfos indexes the disk definitions of w and of its nested workflows by
+// their registry resource.
+func diskInfos(w *Workflow) map[*Resource]diskInfo {
+	disks := map[*Resource]diskInfo{}
+	var collect func(w *Workflow)
+	collect = func(w *Workflow) {
+		for _, s := range w.Steps {
+			switch {
+			case s.CreateDisks != nil:
+				for _, d := range *s.CreateDisks {
+					info := diskInfo{sizeGb: d.Disk.SizeGb, diskType: path.Base(d.Type)}
+					if info.sizeGb == 0 {
+						info.sizeGb = defaultDiskSizeGb
+					}
+					if d.Type == "" {
+						info.diskType = "pd-standard"
+					}
+					disks[&d.Resource] = info
+				}
+			case nestedWorkflow(s) != nil:
+				collect(nestedWorkflow(s))
+			}
+		}
+	}
+	collect(w)
+	return disks
+}
+
+// defaultStepDuration is the duration of steps when CostEstimateOptions has
+// none for them.
+const defaultStepDuration = 5 * time.Minute
+
+// CostEstimateOptions are the assumptions of a cost estimate.
+type CostEstimateOptions struct {
+	// StepDurations are the durations of steps by the names of their
+	// TimeRecords, e.g. "step" or "included-workflow.step", see StepDurations.
+	StepDurations map[string]time.Duration
+	// DefaultStepDuration is the duration of the other steps, 5 minutes if
+	// unset.
+	DefaultStepDuration time.Duration
+	// EgressGB is the internet egress of the run.
+	EgressGB float64
+}
+
+// CostEstimate is the estimated resource usage of a workflow run.
+type CostEstimate struct {
+	ResourceHours
+	// Duration is the estimated duration of the run.
+	Duration time.Duration
+}
+
+// StepDurations returns the durations of the steps of a run, from its time
+// records, to estimate the cost of the next runs.
+func StepDurations(records []TimeRecord) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for _, r := range records {
+		durations[r.Name] = r.EndTime.Sub(r.StartTime)
+	}
+	return durations
+}
+
+// timeRecordName returns the name of the TimeRecord of s.
+func timeRecordName(s *Step) string {
+	name := s.name
+	for w := s.w; w != nil && w.parent != nil; w = w.parent {
+		name = w.Name + "." + name
+	}
+	return name
+}
+
+// EstimateCost estimates the resources the workflow uses for a run, from the
+// machine types of its instances and the sizes and types of its disks, as for
+// EstimatePeakResourceUsage but with steps taking the durations of opts.
+// Disks created without a size are assumed to be 10GB. The workflow must have
+// been validated.
+func (w *Workflow) EstimateCost(opts CostEstimateOptions) (*CostEstimate, DError) {
+	if opts.DefaultStepDuration == 0 {
+		opts.DefaultStepDuration = defaultStepDuration
+	}
+	// Schedule in seconds.
+	length := func(s *Step) int {
+		d, ok := opts.StepDurations[timeRecordName(s)]
+		if !ok {
+			d = opts.DefaultStepDuration
+		}
+		return int(d.Seconds())
+	}
+	slots := map[*Step]stepSlot{}
+	total := scheduleSteps(w, 0, length, slots)
+	lifetime := func(res *Resource) time.Duration {
+		end := total
+		if res.deleter != nil {
+			end = slots[res.deleter].end
+		}
+		return time.Duration(end-slots[res.creator].start) * time.Second
+	}
+
+	est := &CostEstimate{Duration: time.Duration(total) * time.Second}
+	est.EgressGB = opts.EgressGB
+	instances := instanceInfos(w)
+	machineTypes := map[string]*compute.MachineType{}
+	for _, res := range w.instances.m {
+		if res.creator == nil {
+			continue
+		}
+		info := instances[res]
+		mt, err := w.lookupMachineType(info.machineType, machineTypes)
+		if err != nil {
+			return nil, err
+		}
+		est.addInstance(mt, info.externalIPs, lifetime(res))
+	}
+	disks := diskInfos(w)
+	for _, res := range w.disks.m {
+		if info, ok := disks[res]; ok && res.creator != nil {
+			est.addDisk(info, lifetime(res))
+		}
+	}
+	return est, nil
+}
+
+// ResourceHours returns the resources used by the instances and disks the run
+// created, from their creation to their deletion, or to now for those not
+// deleted. Instances are accounted for while stopped too. Called after Run,
+// it tells what the run used.
+func (w *Workflow) ResourceHours() (ResourceHours, DError) {
+	var h ResourceHours
+	now := time.Now()
+	lifetime := func(res *Resource) time.Duration {
+		if res.deleted {
+			return res.deletedAt.Sub(res.createdAt)
+		}
+		return now.Sub(res.createdAt)
+	}
+
+	instances := instanceInfos(w)
+	disks := diskInfos(w)
+	machineTypes := map[string]*compute.MachineType{}
+	seen := map[*baseResourceRegistry]bool{}
+	var add func(w *Workflow) DError
+	add = func(w *Workflow) DError {
+		if w.instances != nil && !seen[&w.instances.baseResourceRegistry] {
+			seen[&w.instances.baseResourceRegistry] = true
+			for _, res := range w.instances.created() {
+				info := instances[res]
+				mt, err := w.lookupMachineType(info.machineType, machineTypes)
+				if err != nil {
+					return err
+				}
+				h.addInstance(mt, info.externalIPs, lifetime(res))
+			}
+		}
+		if w.disks != nil && !seen[&w.disks.baseResourceRegistry] {
+			seen[&w.disks.baseResourceRegistry] = true
+			for _, res := range w.disks.created() {
+				if info, ok := disks[res]; ok {
+					h.addDisk(info, lifetime(res))
+				}
+			}
+		}
+		for _, s := range w.Steps {
+			if child := nestedWorkflow(s); child != nil {
+				if err := add(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return h, add(w)
+}
+
+// created returns the resources of r the workflow created.
+func (r *baseResourceRegistry) created() []*Resource {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var rs []*Resource
+	for _, res := range r.m {
+		if res.createdInWorkflow {
+			rs = append(rs, res)
+		}
+	}
+	return rs
+}
+
+// logResourceHours logs the resources used by the run and their cost at
+// DefaultPrices, to track the cost of builds.
+func (w *Workflow) logResourceHours() {
+	if w.ComputeClient == nil {
+		return
+	}
+	h, err := w.ResourceHours()
+	if err != nil {
+		w.LogWorkflowInfo("Error computing the resources used by the run: %v", err)
+		return
+	}
+	w.LogWorkflowInfo("Resources used by the run: %s, about %.2f USD at DefaultPrices.", h, h.Cost(DefaultPrices))
+}
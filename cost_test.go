@@ -0,0 +1,127 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+// costTestWorkflow returns a workflow where step a creates instance i1, with
+// 4 CPUs, 15GB of memory and an external IP, b then creates disk d1, a 100GB
+// pd-ssd, and c then deletes i1.
+func costTestWorkflow() (*Workflow, *Instance, *Disk) {
+	w := testWorkflow()
+	c, _ := newTestGCEClient()
+	c.GetMachineTypeFn = func(_, _, mt string) (*compute.MachineType, error) {
+		if mt == "n1-standard-4" {
+			return &compute.MachineType{GuestCpus: 4, MemoryMb: 15360}, nil
+		}
+		return nil, errors.New("bad machinetype")
+	}
+	w.ComputeClient = c
+
+	i1 := &Instance{Instance: compute.Instance{
+		MachineType:       fmt.Sprintf("projects/%s/zones/%s/machineTypes/n1-standard-4", testProject, testZone),
+		NetworkInterfaces: []*compute.NetworkInterface{{AccessConfigs: []*compute.AccessConfig{{}}}},
+	}}
+	d1 := &Disk{Disk: compute.Disk{SizeGb: 100, Type: fmt.Sprintf("projects/%s/zones/%s/diskTypes/pd-ssd", testProject, testZone)}}
+	a := &Step{name: "a", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i1}}}
+	b := &Step{name: "b", w: w, CreateDisks: &CreateDisks{d1}}
+	c2 := &Step{name: "c", w: w, DeleteResources: &DeleteResources{Instances: []string{"i1"}}}
+	w.Steps = map[string]*Step{"a": a, "b": b, "c": c2}
+	w.Dependencies = map[string][]string{"b": {"a"}, "c": {"b"}}
+
+	i1.creator, i1.deleter = a, c2
+	d1.creator = b
+	w.instances.m = map[string]*Resource{"i1": &i1.Resource}
+	w.disks.m = map[string]*Resource{"d1": &d1.Resource}
+	return w, i1, d1
+}
+
+// roundHours rounds the values of h to 2 decimals, to compare them.
+func roundHours(h ResourceHours) ResourceHours {
+	r := func(f float64) float64 { return math.Round(f*100) / 100 }
+	h.CPUHours, h.MemoryGBHours, h.ExternalIPHours, h.EgressGB = r(h.CPUHours), r(h.MemoryGBHours), r(h.ExternalIPHours), r(h.EgressGB)
+	for t, v := range h.DiskGBHours {
+		h.DiskGBHours[t] = r(v)
+	}
+	return h
+}
+
+func TestEstimateCost(t *testing.T) {
+	w, _, _ := costTestWorkflow()
+
+	// a takes [0m, 10m), b [10m, 30m) and c [30m, 60m).
+	got, err := w.EstimateCost(CostEstimateOptions{
+		StepDurations:       StepDurations([]TimeRecord{{Name: "a", StartTime: time.Unix(0, 0), EndTime: time.Unix(600, 0)}, {Name: "b", StartTime: time.Unix(600, 0), EndTime: time.Unix(1800, 0)}}),
+		DefaultStepDuration: 30 * time.Minute,
+		EgressGB:            2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got.ResourceHours = roundHours(got.ResourceHours)
+	want := &CostEstimate{
+		ResourceHours: ResourceHours{CPUHours: 4, MemoryGBHours: 15, DiskGBHours: map[string]float64{"pd-ssd": 83.33}, ExternalIPHours: 1, EgressGB: 2},
+		Duration:      time.Hour,
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("cost estimate does not match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	w.ComputeClient.(*daisyCompute.TestClient).GetMachineTypeFn = func(_, _, _ string) (*compute.MachineType, error) {
+		return nil, errors.New("error")
+	}
+	if _, err := w.EstimateCost(CostEstimateOptions{}); err == nil {
+		t.Error("expected error from machine type lookup")
+	}
+}
+
+func TestResourceHours(t *testing.T) {
+	w, i1, d1 := costTestWorkflow()
+	start := time.Now().Add(-2 * time.Hour)
+	i1.createdInWorkflow, i1.createdAt = true, start
+	i1.deleted, i1.deletedAt = true, start.Add(30*time.Minute)
+	d1.createdInWorkflow, d1.createdAt = true, start
+
+	got, err := w.ResourceHours()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ResourceHours{CPUHours: 2, MemoryGBHours: 7.5, DiskGBHours: map[string]float64{"pd-ssd": 200}, ExternalIPHours: 0.5}
+	if diffRes := diff(roundHours(got), want, 0); diffRes != "" {
+		t.Errorf("resource hours do not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func TestResourceHoursCost(t *testing.T) {
+	h := ResourceHours{CPUHours: 1, MemoryGBHours: 2, DiskGBHours: map[string]float64{"pd-ssd": 10, "other": 100}, ExternalIPHours: 3, EgressGB: 4}
+	p := Prices{CPUHour: 1, MemoryGBHour: 0.5, DiskGBHour: map[string]float64{"pd-standard": 0.01, "pd-ssd": 0.1}, ExternalIPHour: 0.1, EgressGB: 0.25}
+	// 1 + 1 + 1 (pd-ssd) + 1 (other, as pd-standard) + 0.3 + 1.
+	if got := h.Cost(p); math.Abs(got-5.3) > 1e-9 {
+		t.Errorf("cost: got %v, want 5.3", got)
+	}
+	if got, want := h.String(), "1.00 CPU-hours, 2.00 GB-hours of memory, 100.00 GB-hours of other, 10.00 GB-hours of pd-ssd, 3.00 external IP-hours, 4.00 GB of egress"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package daisytest runs Daisy workflows against an in-memory fake of the
+// Compute Engine API, so that workflow authors can test their workflows
+// without a project:
+//
+//	h := daisytest.New()
+//	defer h.Close()
+//	h.Server.AddImage("debian-cloud", &compute.Image{Name: "debian-11", Family: "debian-11"})
+//	h.Server.SetSerialOutput("bootstrap", 1, "BuildSuccess")
+//	w, err := h.NewWorkflow("build.wf.json")
+//	...
+//	if err := w.Run(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+//	h.MatchSnapshot(t, "testdata/build.calls")
+package daisytest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/option"
+)
+
+// UpdateSnapshotsEnv is the environment variable that makes MatchSnapshot
+// write the snapshot files instead of comparing them, when set to 1.
+const UpdateSnapshotsEnv = "DAISYTEST_UPDATE_SNAPSHOTS"
+
+// testRunID is the RunID of the workflows set up by a Harness, so that the
+// names they generate are the same every run.
+const testRunID = "daisytest"
+
+// testPollingInterval is how often workflows set up by a Harness poll the
+// Server, unless they set their own PollingIntervals.
+const testPollingInterval = "10ms"
+
+// Harness runs workflows against a Server and records the mutating API calls
+// they make.
+type Harness struct {
+	Server *Server
+	// Storage holds the GCS objects of the workflows, such as their logs.
+	Storage *daisy.FakeStorage
+
+	mx    sync.Mutex
+	calls []daisyCompute.AuditRecord
+}
+
+// New returns a Harness with a new Server. Close it when done.
+func New() *Harness {
+	return &Harness{Server: NewServer(), Storage: &daisy.FakeStorage{}}
+}
+
+// Close shuts the Server down.
+func (h *Harness) Close() {
+	h.Server.Close()
+}
+
+// Record implements daisyCompute.AuditRecorder.
+func (h *Harness) Record(r daisyCompute.AuditRecord) error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.calls = append(h.calls, r)
+	return nil
+}
+
+// NewWorkflow reads the workflow in file and sets it up to run against the
+// Server.
+func (h *Harness) NewWorkflow(file string) (*daisy.Workflow, error) {
+	w, err := daisy.NewFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Setup(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Setup sets w up to run against the Server: w uses the Server and Storage,
+// polls them often, generates the same resource names every run and only
+// logs to Storage. Project, Zone and GCSPath are set if w has none.
+func (h *Harness) Setup(w *daisy.Workflow) error {
+	ctx := context.Background()
+	cc, err := daisyCompute.NewClient(ctx, option.WithEndpoint(h.Server.URL+"/"), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		return err
+	}
+	cc.SetAuditRecorder(h)
+	// Storage is used instead, StorageClient only needs to be set so that no
+	// credentials are looked for.
+	sc, err := storage.NewClient(ctx, option.WithEndpoint(h.Server.URL+"/storage/v1/"), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		return err
+	}
+	w.ComputeClient = cc
+	w.StorageClient = sc
+	w.Storage = h.Storage
+
+	if w.Project == "" {
+		w.Project = "test-project"
+	}
+	if w.Zone == "" {
+		w.Zone = h.Server.Zones[0]
+	}
+	if w.GCSPath == "" {
+		w.GCSPath = "gs://daisytest"
+	}
+	w.DeterministicNames = true
+	if w.RunID == "" {
+		w.RunID = testRunID
+	}
+	if w.PollingIntervals == nil {
+		w.PollingIntervals = &daisy.PollingIntervals{
+			SerialOutput:    testPollingInterval,
+			GuestAttributes: testPollingInterval,
+			Operations:      testPollingInterval,
+			InstanceStatus:  testPollingInterval,
+		}
+	}
+	w.DisableCloudLogging()
+	w.DisableStdoutLogging()
+	return nil
+}
+
+// Calls returns the mutating API calls made so far, in the order they were
+// made.
+func (h *Harness) Calls() []daisyCompute.AuditRecord {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return append([]daisyCompute.AuditRecord(nil), h.calls...)
+}
+
+// Snapshot returns the mutating API calls made so far, one per line as
+// "caller METHOD path", where caller is the workflow step that made the call
+// and path is relative to the API. The calls are sorted by caller and then by
+// path, as the calls of concurrent steps, or of one step on several resources,
+// are made in no set order.
+func (h *Harness) Snapshot() string {
+	var lines []string
+	for _, c := range h.Calls() {
+		p := strings.TrimPrefix(c.URL, h.Server.URL+"/")
+		lines = append(lines, fmt.Sprintf("%s %s %s", c.Caller, c.Method, p))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// MatchSnapshot fails t if Snapshot differs from the content of file. With
+// UpdateSnapshotsEnv set to 1, file is written with Snapshot instead.
+func (h *Harness) MatchSnapshot(t testing.TB, file string) {
+	t.Helper()
+	got := h.Snapshot()
+	if os.Getenv(UpdateSnapshotsEnv) == "1" {
+		if err := ioutil.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatalf("error writing snapshot: %v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading snapshot, run with %s=1 to write it: %v", UpdateSnapshotsEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("API calls do not match snapshot %s, run with %s=1 to update it:\ngot:\n%s\nwant:\n%s", file, UpdateSnapshotsEnv, got, want)
+	}
+}
@@ -0,0 +1,123 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisytest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestHarness(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc, output string
+		wantErr      string
+		wantImages   []string
+	}{
+		{"success", "booting\nBuildSuccess\n", "", []string{"image"}},
+		{"failure", "booting\nBuildFailed: no space left\n", "BuildFailed", nil},
+	}
+	for _, tt := range tests {
+		h := New()
+		h.Server.AddImage("debian-cloud", &compute.Image{Name: "debian-11-v1", Family: "debian-11"})
+		h.Server.SetSerialOutput("bootstrap", 1, tt.output)
+		w, err := h.NewWorkflow("testdata/build.wf.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Run(ctx)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.desc, err, tt.wantErr)
+		}
+
+		var images []string
+		for _, i := range h.Server.Images("test-project") {
+			images = append(images, i.Name)
+		}
+		if strings.Join(images, ",") != strings.Join(tt.wantImages, ",") {
+			t.Errorf("%s: got images %q, want %q", tt.desc, images, tt.wantImages)
+		}
+		// Everything else is cleaned up.
+		if ds, is := h.Server.Disks("test-project", "us-central1-a"), h.Server.Instances("test-project", "us-central1-a"); len(ds) > 0 || len(is) > 0 {
+			t.Errorf("%s: resources left: %d disks, %d instances", tt.desc, len(ds), len(is))
+		}
+		h.MatchSnapshot(t, "testdata/build."+tt.desc+".calls")
+		h.Close()
+	}
+}
+
+func TestServerImageFamily(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddImage("p", &compute.Image{Name: "v1", Family: "f"})
+	s.AddImage("p", &compute.Image{Name: "v2", Family: "f"})
+	s.AddImage("p", &compute.Image{Name: "v3", Family: "f", Deprecated: &compute.DeprecationStatus{State: "DEPRECATED"}})
+	s.AddImage("p", &compute.Image{Name: "other", Family: "g"})
+	c, err := daisyCompute.NewClient(context.Background(), option.WithEndpoint(s.URL+"/"), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := c.GetImageFromFamily("p", "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Name != "v2" {
+		t.Errorf("got image %q from family, want %q", i.Name, "v2")
+	}
+	if _, err := c.GetImageFromFamily("p", "h"); err == nil {
+		t.Error("got no error for an unknown family")
+	}
+}
+
+func TestServerScheduling(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddInstance("p", "z", &compute.Instance{Name: "i", Status: "RUNNING"})
+	c, err := daisyCompute.NewClient(context.Background(), option.WithEndpoint(s.URL+"/"), option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances are live migrated by default.
+	if err := c.SimulateMaintenanceEvent("p", "z", "i"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := c.InstanceStatus("p", "z", "i"); status != "RUNNING" {
+		t.Errorf("got status %q after a migration, want RUNNING", status)
+	}
+
+	if err := c.SetScheduling("p", "z", "i", &compute.Scheduling{OnHostMaintenance: "TERMINATE"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SimulateMaintenanceEvent("p", "z", "i"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := c.InstanceStatus("p", "z", "i"); status != "TERMINATED" {
+		t.Errorf("got status %q after a maintenance event, want TERMINATED", status)
+	}
+	if err := c.ResetInstance("p", "z", "i"); err != nil {
+		t.Errorf("unexpected error resetting instance: %v", err)
+	}
+}
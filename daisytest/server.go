@@ -0,0 +1,617 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// defaultZones are the zones a Server lists if Zones is not set.
+var defaultZones = []string{"us-central1-a", "us-central1-b", "us-central1-c", "us-central1-f", "us-east1-b", "us-west1-b", "europe-west1-b"}
+
+// predefinedMachineTypes are the machine types a Server lists in every zone.
+// Other machine types can still be read, as custom machine types.
+var predefinedMachineTypes = []string{"e2-medium", "e2-standard-2", "e2-standard-4", "e2-standard-8", "n1-standard-1", "n1-standard-2", "n1-standard-4", "n1-standard-8", "n2-standard-2", "n2-standard-4", "n2-standard-8"}
+
+// diskTypes are the disk types a Server lists in every zone.
+var diskTypes = []string{"pd-balanced", "pd-extreme", "pd-ssd", "pd-standard"}
+
+// readyStatus is the status of resources once created, by collection.
+var readyStatus = map[string]string{
+	"disks":         "READY",
+	"images":        "READY",
+	"instances":     "RUNNING",
+	"machineImages": "READY",
+	"snapshots":     "READY",
+}
+
+// Server is an in-memory fake of the Compute Engine API. Resources are
+// created, read, listed and deleted as by the real API, and operations are
+// done as soon as they are created. Every project has a default network.
+//
+// Instances run until stopped and print the serial port output set with
+// SetSerialOutput. Fields of resources that GCE computes, other than their
+// status, are not filled in.
+type Server struct {
+	// URL is the base URL of the API, to use as compute endpoint.
+	URL string
+	// Zones are the zones listed in every project, each in the region named
+	// after it. Set them before running a workflow.
+	Zones []string
+
+	ts  *httptest.Server
+	mx  sync.Mutex
+	seq int
+	// resources are the created resources as JSON objects, by resource path,
+	// such as projects/p/zones/z/disks/d.
+	resources       map[string]map[string]interface{}
+	serialOutputs   map[string]map[int64]string
+	guestAttributes map[string]map[string]string
+}
+
+// NewServer starts a Server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		Zones:           defaultZones,
+		resources:       map[string]map[string]interface{}{},
+		serialOutputs:   map[string]map[int64]string{},
+		guestAttributes: map[string]map[string]string{},
+	}
+	s.ts = httptest.NewServer(s)
+	s.URL = s.ts.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// nameMatches reports whether name is the name of a resource named pattern in
+// a workflow: pattern itself, or pattern followed by the generated suffix.
+func nameMatches(pattern, name string) bool {
+	return name == pattern || strings.HasPrefix(name, pattern+"-")
+}
+
+// SetSerialOutput sets the output of serial port port of the instances named
+// instance in a workflow, replacing any previous output. Instances started
+// later print it too.
+func (s *Server) SetSerialOutput(instance string, port int64, output string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.serialOutputs[instance] == nil {
+		s.serialOutputs[instance] = map[int64]string{}
+	}
+	s.serialOutputs[instance][port] = output
+}
+
+// SetGuestAttribute sets the guest attribute key, namespace/key, of the
+// instances named instance in a workflow.
+func (s *Server) SetGuestAttribute(instance, key, value string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.guestAttributes[instance] == nil {
+		s.guestAttributes[instance] = map[string]string{}
+	}
+	s.guestAttributes[instance][key] = value
+}
+
+// AddDisk adds a disk that exists before the workflow runs.
+func (s *Server) AddDisk(project, zone string, d *compute.Disk) error {
+	return s.add(path.Join("projects", project, "zones", zone, "disks"), d)
+}
+
+// AddImage adds an image that exists before the workflow runs, such as the
+// source image of a disk.
+func (s *Server) AddImage(project string, i *compute.Image) error {
+	return s.add(path.Join("projects", project, "global/images"), i)
+}
+
+// AddInstance adds an instance that exists before the workflow runs.
+func (s *Server) AddInstance(project, zone string, i *compute.Instance) error {
+	return s.add(path.Join("projects", project, "zones", zone, "instances"), i)
+}
+
+// AddNetwork adds a network that exists before the workflow runs.
+func (s *Server) AddNetwork(project string, n *compute.Network) error {
+	return s.add(path.Join("projects", project, "global/networks"), n)
+}
+
+// Disks returns the disks of zone.
+func (s *Server) Disks(project, zone string) []*compute.Disk {
+	var ds []*compute.Disk
+	s.list(path.Join("projects", project, "zones", zone, "disks"), &ds)
+	return ds
+}
+
+// Images returns the images of project.
+func (s *Server) Images(project string) []*compute.Image {
+	var is []*compute.Image
+	s.list(path.Join("projects", project, "global/images"), &is)
+	return is
+}
+
+// Instances returns the instances of zone.
+func (s *Server) Instances(project, zone string) []*compute.Instance {
+	var is []*compute.Instance
+	s.list(path.Join("projects", project, "zones", zone, "instances"), &is)
+	return is
+}
+
+// Networks returns the networks of project, other than the default
+// network.
+func (s *Server) Networks(project string) []*compute.Network {
+	var ns []*compute.Network
+	s.list(path.Join("projects", project, "global/networks"), &ns)
+	return ns
+}
+
+// Snapshots returns the snapshots of project.
+func (s *Server) Snapshots(project string) []*compute.Snapshot {
+	var ss []*compute.Snapshot
+	s.list(path.Join("projects", project, "global/snapshots"), &ss)
+	return ss
+}
+
+func (s *Server) add(collection string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.insert(collection, obj)
+}
+
+// list decodes the resources of collection into out, a pointer to a slice.
+func (s *Server) list(collection string, out interface{}) {
+	s.mx.Lock()
+	b, _ := json.Marshal(s.items(collection))
+	s.mx.Unlock()
+	json.Unmarshal(b, out)
+}
+
+// items returns the resources of collection, sorted by name.
+func (s *Server) items(collection string) []map[string]interface{} {
+	var names []string
+	for p := range s.resources {
+		if path.Dir(p) == collection {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	items := []map[string]interface{}{}
+	for _, n := range names {
+		items = append(items, s.resources[n])
+	}
+	return items
+}
+
+// insert creates obj in collection. s.mx must be held.
+func (s *Server) insert(collection string, obj map[string]interface{}) error {
+	name, _ := obj["name"].(string)
+	if name == "" {
+		return fmt.Errorf("resource of %s has no name", collection)
+	}
+	p := path.Join(collection, name)
+	if _, ok := s.resources[p]; ok {
+		return fmt.Errorf("resource %s already exists", p)
+	}
+	s.seq++
+	obj["id"] = strconv.Itoa(s.seq)
+	obj["selfLink"] = s.URL + "/" + p
+	// Sequential timestamps order resources by creation, as image families
+	// need.
+	obj["creationTimestamp"] = time.Unix(int64(s.seq), 0).UTC().Format(time.RFC3339)
+	kind := path.Base(collection)
+	if st, ok := readyStatus[kind]; ok {
+		obj["status"] = st
+	}
+	if kind == "disks" && obj["sizeGb"] == nil {
+		obj["sizeGb"] = "10"
+	}
+	s.resources[p] = obj
+
+	if kind == "instances" {
+		// Disks with InitializeParams are created with the instance.
+		disks, _ := obj["disks"].([]interface{})
+		for _, d := range disks {
+			ad, _ := d.(map[string]interface{})
+			ip, ok := ad["initializeParams"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			dn, _ := ip["diskName"].(string)
+			if dn == "" {
+				dn = name
+			}
+			disk := map[string]interface{}{"name": dn, "sourceImage": ip["sourceImage"]}
+			if size, ok := ip["diskSizeGb"]; ok {
+				disk["sizeGb"] = size
+			}
+			if err := s.insert(path.Dir(collection)+"/disks", disk); err != nil {
+				return err
+			}
+			ad["source"] = s.URL + "/" + path.Join(path.Dir(collection), "disks", dn)
+			delete(ad, "initializeParams")
+		}
+	}
+	return nil
+}
+
+// remove deletes the resource at p. s.mx must be held.
+func (s *Server) remove(p string) bool {
+	obj, ok := s.resources[p]
+	if !ok {
+		return false
+	}
+	delete(s.resources, p)
+	if path.Base(path.Dir(p)) == "instances" {
+		disks, _ := obj["disks"].([]interface{})
+		for _, d := range disks {
+			ad, _ := d.(map[string]interface{})
+			if auto, _ := ad["autoDelete"].(bool); auto {
+				src, _ := ad["source"].(string)
+				delete(s.resources, strings.TrimPrefix(src, s.URL+"/"))
+			}
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	msg := fmt.Sprintf(format, a...)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "message": msg}})
+}
+
+// operation writes a done operation on the resource at target.
+func (s *Server) operation(w http.ResponseWriter, target string) {
+	s.seq++
+	writeJSON(w, map[string]interface{}{
+		"kind":       "compute#operation",
+		"name":       fmt.Sprintf("operation-%d", s.seq),
+		"status":     "DONE",
+		"targetLink": s.URL + "/" + target,
+	})
+}
+
+func regionOf(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// machineType returns machine type name, with the CPUs and memory its name
+// implies.
+func machineType(name string) map[string]interface{} {
+	cpus, memory := 2, 4096
+	parts := strings.Split(name, "-")
+	if len(parts) >= 3 && (strings.HasPrefix(name, "custom-") || strings.Contains(name, "-custom-")) {
+		cpus, _ = strconv.Atoi(parts[len(parts)-2])
+		memory, _ = strconv.Atoi(parts[len(parts)-1])
+	} else if n, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		cpus, memory = n, n*3840
+	}
+	return map[string]interface{}{"name": name, "guestCpus": cpus, "memoryMb": memory}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	p := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(p, "/")
+	if len(parts) < 2 || parts[0] != "projects" {
+		writeError(w, http.StatusNotFound, "%s not found", p)
+		return
+	}
+	project := parts[1]
+	for _, part := range parts {
+		if part == "operations" {
+			writeJSON(w, map[string]interface{}{"kind": "compute#operation", "name": path.Base(strings.TrimSuffix(p, "/wait")), "status": "DONE"})
+			return
+		}
+	}
+
+	// Scope of the collection: the project, a zone or a region.
+	var scope, rest []string
+	switch {
+	case len(parts) == 2:
+		writeJSON(w, map[string]interface{}{"name": project})
+		return
+	case parts[2] == "zones" && len(parts) <= 4:
+		s.serveZones(w, project, parts[3:])
+		return
+	case parts[2] == "regions" && len(parts) <= 4:
+		s.serveRegions(w, project, parts[3:])
+		return
+	case parts[2] == "global":
+		scope, rest = parts[:3], parts[3:]
+	case parts[2] == "zones" || parts[2] == "regions":
+		scope, rest = parts[:4], parts[4:]
+	default:
+		scope, rest = parts[:2], parts[2:]
+	}
+	if len(rest) == 0 {
+		writeError(w, http.StatusNotFound, "%s not found", p)
+		return
+	}
+	collection := path.Join(append(scope, rest[0])...)
+
+	switch rest[0] {
+	case "machineTypes":
+		if len(rest) == 1 {
+			var items []map[string]interface{}
+			for _, mt := range predefinedMachineTypes {
+				items = append(items, machineType(mt))
+			}
+			writeJSON(w, map[string]interface{}{"items": items})
+		} else {
+			writeJSON(w, machineType(rest[1]))
+		}
+		return
+	case "diskTypes":
+		if len(rest) == 1 {
+			var items []map[string]interface{}
+			for _, dt := range diskTypes {
+				items = append(items, map[string]interface{}{"name": dt, "selfLink": s.URL + "/" + path.Join(collection, dt)})
+			}
+			writeJSON(w, map[string]interface{}{"items": items})
+		} else {
+			writeJSON(w, map[string]interface{}{"name": rest[1], "selfLink": s.URL + "/" + p})
+		}
+		return
+	}
+
+	switch {
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		items := s.items(collection)
+		if rest[0] == "networks" {
+			items = append([]map[string]interface{}{s.defaultNetwork(project)}, items...)
+		}
+		writeJSON(w, map[string]interface{}{"items": items})
+	case len(rest) == 1 && r.Method == http.MethodPost:
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			writeError(w, http.StatusBadRequest, "bad request body: %v", err)
+			return
+		}
+		if err := s.insert(collection, obj); err != nil {
+			writeError(w, http.StatusConflict, "%v", err)
+			return
+		}
+		s.operation(w, path.Join(collection, obj["name"].(string)))
+	case len(rest) == 2 && r.Method == http.MethodGet:
+		if rest[0] == "networks" && rest[1] == "default" {
+			writeJSON(w, s.defaultNetwork(project))
+			return
+		}
+		obj, ok := s.resources[p]
+		if !ok {
+			writeError(w, http.StatusNotFound, "%s not found", p)
+			return
+		}
+		writeJSON(w, obj)
+	case len(rest) == 2 && r.Method == http.MethodDelete:
+		if !s.remove(p) {
+			writeError(w, http.StatusNotFound, "%s not found", p)
+			return
+		}
+		s.operation(w, p)
+	case len(rest) == 3 && rest[0] == "images" && rest[1] == "family":
+		s.serveImageFamily(w, collection, rest[2])
+	case len(rest) == 3:
+		s.serveAction(w, r, collection, rest[1], rest[2])
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", p)
+	}
+}
+
+func (s *Server) defaultNetwork(project string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                  "default",
+		"autoCreateSubnetworks": true,
+		"selfLink":              s.URL + "/" + path.Join("projects", project, "global/networks/default"),
+	}
+}
+
+func (s *Server) zone(project, zone string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     zone,
+		"status":   "UP",
+		"region":   s.URL + "/" + path.Join("projects", project, "regions", regionOf(zone)),
+		"selfLink": s.URL + "/" + path.Join("projects", project, "zones", zone),
+	}
+}
+
+func (s *Server) serveZones(w http.ResponseWriter, project string, rest []string) {
+	if len(rest) == 0 {
+		var items []map[string]interface{}
+		for _, z := range s.Zones {
+			items = append(items, s.zone(project, z))
+		}
+		writeJSON(w, map[string]interface{}{"items": items})
+		return
+	}
+	for _, z := range s.Zones {
+		if z == rest[0] {
+			writeJSON(w, s.zone(project, z))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "zone %s not found", rest[0])
+}
+
+func (s *Server) serveRegions(w http.ResponseWriter, project string, rest []string) {
+	var regions []string
+	seen := map[string]bool{}
+	for _, z := range s.Zones {
+		if r := regionOf(z); !seen[r] {
+			seen[r] = true
+			regions = append(regions, r)
+		}
+	}
+	region := func(r string) map[string]interface{} {
+		return map[string]interface{}{"name": r, "status": "UP", "selfLink": s.URL + "/" + path.Join("projects", project, "regions", r)}
+	}
+	if len(rest) == 0 {
+		var items []map[string]interface{}
+		for _, r := range regions {
+			items = append(items, region(r))
+		}
+		writeJSON(w, map[string]interface{}{"items": items})
+		return
+	}
+	if !seen[rest[0]] {
+		writeError(w, http.StatusNotFound, "region %s not found", rest[0])
+		return
+	}
+	writeJSON(w, region(rest[0]))
+}
+
+// serveImageFamily writes the latest image of family that is not
+// deprecated.
+func (s *Server) serveImageFamily(w http.ResponseWriter, collection, family string) {
+	var latest map[string]interface{}
+	for _, i := range s.items(collection) {
+		if i["family"] != family || i["deprecated"] != nil {
+			continue
+		}
+		if latest == nil || i["creationTimestamp"].(string) > latest["creationTimestamp"].(string) {
+			latest = i
+		}
+	}
+	if latest == nil {
+		writeError(w, http.StatusNotFound, "image family %s not found", family)
+		return
+	}
+	writeJSON(w, latest)
+}
+
+// serveAction serves the custom methods of resources, such as stopping an
+// instance. Methods that are not emulated succeed without changing the
+// resource.
+func (s *Server) serveAction(w http.ResponseWriter, r *http.Request, collection, name, action string) {
+	p := path.Join(collection, name)
+	obj, ok := s.resources[p]
+	if !ok {
+		writeError(w, http.StatusNotFound, "%s not found", p)
+		return
+	}
+	var body map[string]interface{}
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch action {
+	case "serialPort":
+		port, _ := strconv.ParseInt(r.URL.Query().Get("port"), 10, 64)
+		if port == 0 {
+			port = 1
+		}
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		out := s.instanceOutput(name, port)
+		if start > int64(len(out)) {
+			start = int64(len(out))
+		}
+		writeJSON(w, map[string]interface{}{"contents": out[start:], "start": strconv.FormatInt(start, 10), "next": strconv.Itoa(len(out))})
+		return
+	case "getGuestAttributes":
+		key := r.URL.Query().Get("variableKey")
+		for pattern, attrs := range s.guestAttributes {
+			if v, ok := attrs[key]; ok && nameMatches(pattern, name) {
+				writeJSON(w, map[string]interface{}{"variableKey": key, "variableValue": v})
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "guest attribute %s of %s not found", key, p)
+		return
+	case "start":
+		obj["status"] = "RUNNING"
+	case "stop":
+		obj["status"] = "TERMINATED"
+	case "simulateMaintenanceEvent":
+		// Instances are live migrated unless their scheduling says otherwise.
+		if sc, _ := obj["scheduling"].(map[string]interface{}); sc["onHostMaintenance"] == "TERMINATE" {
+			obj["status"] = "TERMINATED"
+		}
+	case "setScheduling":
+		obj["scheduling"] = body
+	case "setMetadata":
+		obj["metadata"] = body
+	case "setLabels":
+		obj["labels"] = body["labels"]
+	case "attachDisk":
+		disks, _ := obj["disks"].([]interface{})
+		obj["disks"] = append(disks, body)
+	case "detachDisk":
+		dev := r.URL.Query().Get("deviceName")
+		disks, _ := obj["disks"].([]interface{})
+		var kept []interface{}
+		for _, d := range disks {
+			if ad, _ := d.(map[string]interface{}); ad["deviceName"] != dev {
+				kept = append(kept, d)
+			}
+		}
+		obj["disks"] = kept
+	case "resize":
+		obj["sizeGb"] = body["sizeGb"]
+	case "deprecate":
+		obj["deprecated"] = body
+	case "createSnapshot":
+		body["sourceDisk"] = obj["selfLink"]
+		project := strings.Split(collection, "/")[1]
+		if err := s.insert(path.Join("projects", project, "global/snapshots"), body); err != nil {
+			writeError(w, http.StatusConflict, "%v", err)
+			return
+		}
+	}
+	s.operation(w, p)
+}
+
+// instanceOutput returns the serial port output of the instance. s.mx must
+// be held.
+func (s *Server) instanceOutput(name string, port int64) string {
+	for pattern, outputs := range s.serialOutputs {
+		if nameMatches(pattern, name) {
+			return outputs[port]
+		}
+	}
+	return ""
+}
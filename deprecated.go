@@ -0,0 +1,104 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// deprecatedField is a deprecated field of the workflow schema. Setting it
+// still works, but adds a warning to the validation report.
+type deprecatedField struct {
+	// typ is the struct type declaring the field. Step types are fields of
+	// Step.
+	typ reflect.Type
+	// name is the name of the field.
+	name string
+	// hint tells what to use instead.
+	hint string
+}
+
+// deprecatedFields are the deprecated fields of the workflow schema. To
+// deprecate a step type, add the field of Step naming it.
+var deprecatedFields = []deprecatedField{
+	{reflect.TypeOf(compute.Network{}), "IPv4Range", "it creates a legacy network, use subnetworks instead"},
+}
+
+func deprecationHint(typ reflect.Type, name string) (string, bool) {
+	for _, d := range deprecatedFields {
+		if d.typ == typ && d.name == name {
+			return d.hint, true
+		}
+	}
+	return "", false
+}
+
+// warnDeprecated adds a warning for each deprecated field set by the steps of
+// w and of its nested workflows.
+func (w *Workflow) warnDeprecated() {
+	var names []string
+	for name := range w.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := w.Steps[name]
+		warnDeprecatedFields(s, reflect.ValueOf(s).Elem(), "")
+	}
+}
+
+// warnDeprecatedFields adds a warning for each deprecated field set in v,
+// found at the JSON path path of step s.
+func warnDeprecatedFields(s *Step, v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if nested, ok := v.Interface().(*Workflow); ok {
+			nested.warnDeprecated()
+			return
+		}
+		warnDeprecatedFields(s, v.Elem(), path)
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			warnDeprecatedFields(s, v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			fv := v.Field(i)
+			fpath := path
+			if !f.Anonymous {
+				fpath = f.Name
+				if path != "" {
+					fpath = path + "." + f.Name
+				}
+			}
+			if hint, ok := deprecationHint(t, f.Name); ok && !fv.IsZero() {
+				s.warnf(fpath, "%s is deprecated: %s", f.Name, hint)
+			}
+			warnDeprecatedFields(s, fv, fpath)
+		}
+	}
+}
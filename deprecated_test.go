@@ -0,0 +1,63 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestWarnDeprecated(t *testing.T) {
+	defer func(fs []deprecatedField) { deprecatedFields = fs }(deprecatedFields)
+	deprecatedFields = append(deprecatedFields,
+		deprecatedField{reflect.TypeOf(Step{}), "DeleteResources", "use NoCleanup=false instead"},
+		deprecatedField{reflect.TypeOf(Disk{}), "SizeGb", "use compute.Disk.SizeGb instead"},
+	)
+
+	ctx := context.Background()
+	w := testWorkflow()
+	sw := w.NewSubWorkflow()
+	sw.Steps = map[string]*Step{
+		"nested-net": {w: sw, CreateNetworks: &CreateNetworks{{Network: compute.Network{Name: "net", IPv4Range: "10.0.0.0/24"}}}},
+	}
+	w.Steps = map[string]*Step{
+		"disks": {w: w, CreateDisks: &CreateDisks{
+			{Disk: compute.Disk{Name: "d1", SourceImage: "i"}},
+			{Disk: compute.Disk{Name: "d2", SourceImage: "i"}, SizeGb: "10"},
+		}},
+		"delete": {w: w, DeleteResources: &DeleteResources{Disks: []string{"d1"}}},
+		"net":    {w: w, CreateNetworks: &CreateNetworks{{Network: compute.Network{Name: "net"}}}},
+		"sub":    {w: w, SubWorkflow: &SubWorkflow{Workflow: sw}},
+	}
+	w.Dependencies = map[string][]string{"delete": {"disks"}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := w.ValidationReport().Issues
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	want := []ValidationIssue{
+		{Severity: SeverityWarning, Step: "delete", Path: "Steps.delete.DeleteResources", Message: "DeleteResources is deprecated: use NoCleanup=false instead"},
+		{Severity: SeverityWarning, Step: "disks", Path: "Steps.disks.CreateDisks[1].SizeGb", Message: "SizeGb is deprecated: use compute.Disk.SizeGb instead"},
+		{Severity: SeverityWarning, Step: "nested-net", Path: "Steps.sub.SubWorkflow.Workflow.Steps.nested-net.CreateNetworks[0].IPv4Range", Message: "IPv4Range is deprecated: it creates a legacy network, use subnetworks instead"},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("deprecation warnings do not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
@@ -150,7 +150,7 @@ func (dr *diskRegistry) init() {
 
 func (dr *diskRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(diskURLRgx, res.link)
-	err := dr.w.ComputeClient.DeleteDisk(m["project"], m["zone"], m["disk"])
+	err := dr.w.resourceClient(res).DeleteDisk(m["project"], m["zone"], m["disk"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete disk", err)
 	}
@@ -17,6 +17,8 @@ package daisy
 import (
 	"fmt"
 	"strings"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 )
 
 const (
@@ -53,6 +55,19 @@ type DError interface {
 	CausedByErrType(t string) bool
 }
 
+// OperationErrorer is implemented by the errors that can be caused by failed
+// compute operations, as the default DError implementation. Check for it with
+// a type assertion:
+//
+//	if oe, ok := err.(daisy.OperationErrorer); ok {
+//		details := oe.OperationErrors()
+//	}
+type OperationErrorer interface {
+	// OperationErrors returns the errors of the failed compute operations
+	// that caused the error, such as exceeded quotas.
+	OperationErrors() []daisyCompute.OperationErrorDetail
+}
+
 // addErrs adds an error to a DError.
 // The DError can be nil. If both the DError and errors are nil, a nil DError is returned.
 // If DError is nil, but errors are not nil, a new DError is instantiated, the errors are added,
@@ -97,6 +112,11 @@ func newErr(anonymizedErrMsg string, e error) DError {
 	if dE, ok := e.(*dErrImpl); ok {
 		return dE
 	}
+	if oe, ok := e.(*daisyCompute.OperationError); ok {
+		// Error codes and quota names are safe, and the first thing users
+		// need to see.
+		anonymizedErrMsg = fmt.Sprintf("%s: %s", anonymizedErrMsg, oe.Summary())
+	}
 	return &dErrImpl{errs: []error{e}, errsType: []string{""}, anonymizedErrs: []string{anonymizedErrMsg}}
 }
 
@@ -208,3 +228,13 @@ func (e *dErrImpl) CausedByErrType(t string) bool {
 	}
 	return false
 }
+
+func (e *dErrImpl) OperationErrors() []daisyCompute.OperationErrorDetail {
+	var ds []daisyCompute.OperationErrorDetail
+	for _, err := range e.errs {
+		if oe, ok := err.(*daisyCompute.OperationError); ok {
+			ds = append(ds, oe.Errors...)
+		}
+	}
+	return ds
+}
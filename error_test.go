@@ -18,6 +18,8 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 )
 
 func TestAddErrs(t *testing.T) {
@@ -147,3 +149,24 @@ func TestNestedAnonymizedDErrorMessage(t *testing.T) {
 	}
 
 }
+
+func TestOperationErrors(t *testing.T) {
+	detail := daisyCompute.OperationErrorDetail{Code: "QUOTA_EXCEEDED", Message: "Quota 'CPUS' exceeded.", QuotaMetric: "CPUS", QuotaScope: "region r"}
+	oe := &daisyCompute.OperationError{Operation: "op", Errors: []daisyCompute.OperationErrorDetail{detail}}
+	e := typedErr(apiError, "failed to create instance", oe)
+	e = addErrs(e, Errf("other error"))
+
+	if want := "APIError: failed to create instance: QUOTA_EXCEEDED: CPUS in region r"; e.AnonymizedErrs()[0] != want {
+		t.Errorf("got anonymized error %q, want %q", e.AnonymizedErrs()[0], want)
+	}
+	oer, ok := e.(OperationErrorer)
+	if !ok {
+		t.Fatalf("%T does not implement OperationErrorer", e)
+	}
+	if got := oer.OperationErrors(); len(got) != 1 || got[0] != detail {
+		t.Errorf("got operation errors %+v, want %+v", got, detail)
+	}
+	if !strings.Contains(e.Error(), "Quota 'CPUS' exceeded.") {
+		t.Errorf("error does not include the operation error message: %v", e)
+	}
+}
@@ -0,0 +1,132 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// maxObjectBytes is the maximum size of a GCS object, 5 TiB.
+const maxObjectBytes = 5 << 40
+
+// dualRegions are the regions of the predefined GCS dual-regions.
+var dualRegions = map[string][]string{
+	"ASIA1": {"asia-northeast1", "asia-northeast2"},
+	"EUR4":  {"europe-north1", "europe-west4"},
+	"NAM4":  {"us-central1", "us-east1"},
+}
+
+// multiRegionPrefixes are the prefixes of the regions of the GCS
+// multi-regions.
+var multiRegionPrefixes = map[string]string{
+	"ASIA": "asia-",
+	"EU":   "europe-",
+	"US":   "us-",
+}
+
+// ExportEstimate is the estimated size of the file a disk is exported to.
+type ExportEstimate struct {
+	Disk string
+	// SizeBytes is the provisioned size of the disk.
+	SizeBytes int64
+	// UsedBytes is the space used on the file systems of the disk, as reported
+	// by an InspectDisk step, or 0 if unknown.
+	UsedBytes int64
+	// UsedIncomplete is set if UsedBytes misses file systems the InspectDisk
+	// step could not mount, e.g. on LVM.
+	UsedIncomplete bool
+}
+
+// Bytes returns the estimated size of the exported file: the used space if
+// known for all the file systems, otherwise the size of the disk, an upper
+// bound as unused space is compressed away.
+func (e *ExportEstimate) Bytes() int64 {
+	if e.UsedBytes > 0 && !e.UsedIncomplete {
+		return e.UsedBytes
+	}
+	return e.SizeBytes
+}
+
+// EstimateExportSize estimates the size of the file disk is exported to. If
+// inspectStep is the name of an InspectDisk step of the workflow that
+// inspected the disk, the space it found used refines the estimate.
+func (w *Workflow) EstimateExportSize(project, zone, disk, inspectStep string) (*ExportEstimate, DError) {
+	d, err := w.ComputeClient.GetDisk(project, zone, disk)
+	if err != nil {
+		return nil, typedErr(apiError, "failed to get disk", err)
+	}
+	e := &ExportEstimate{Disk: disk, SizeBytes: d.SizeGb << 30}
+	if inspectStep != "" {
+		if used, err := strconv.ParseInt(w.GetSerialConsoleOutputValue(inspectStep+"-used-bytes"), 10, 64); err == nil {
+			e.UsedBytes = used
+			e.UsedIncomplete = w.GetSerialConsoleOutputValue(inspectStep+"-used-bytes-incomplete") == "true"
+		}
+	}
+	return e, nil
+}
+
+// bucketLocationIncludes reports whether the location of a bucket, a region,
+// dual-region or multi-region, includes region.
+func bucketLocationIncludes(location, region string) bool {
+	location = strings.ToUpper(location)
+	if location == strings.ToUpper(region) {
+		return true
+	}
+	for _, r := range dualRegions[location] {
+		if r == region {
+			return true
+		}
+	}
+	prefix, ok := multiRegionPrefixes[location]
+	return ok && strings.HasPrefix(region, prefix)
+}
+
+// ValidateExportDestination checks, before launching export workers, that the
+// file estimated by e can be uploaded to dest, a GCS path: the bucket must
+// exist and the file must fit in a GCS object. A warning is logged if the
+// bucket is not in the region of zone, where the disk is, as exports across
+// regions are slower and incur egress charges.
+func (w *Workflow) ValidateExportDestination(ctx context.Context, project, zone, dest string, e *ExportEstimate) DError {
+	bkt, _, dErr := splitGCSPath(dest)
+	if dErr != nil {
+		return dErr
+	}
+	attrs, err := w.storage().BucketAttrs(ctx, bkt)
+	if err == storage.ErrBucketNotExist {
+		return Errf("export destination bucket %q does not exist", bkt)
+	} else if err != nil {
+		return Errf("error reading bucket %q: %v", bkt, err)
+	}
+
+	if e.Bytes() > maxObjectBytes {
+		if e.UsedBytes > 0 && !e.UsedIncomplete {
+			return Errf("disk %q is estimated to export to %d bytes, more than the %d bytes a GCS object can hold", e.Disk, e.Bytes(), int64(maxObjectBytes))
+		}
+		w.LogWorkflowInfo("WARNING: disk %q is %d bytes, the export may not fit in a GCS object of at most %d bytes.", e.Disk, e.SizeBytes, int64(maxObjectBytes))
+	}
+
+	region, err := w.ComputeClient.GetZoneRegion(project, zone)
+	if err != nil {
+		return typedErr(apiError, "failed to get zone region", err)
+	}
+	if !bucketLocationIncludes(attrs.Location, region) {
+		w.LogWorkflowInfo("WARNING: export destination bucket %q is in %q, not in region %q of disk %q; the export will be slower and incur egress charges.", bkt, attrs.Location, region, e.Disk)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestEstimateExportSize(t *testing.T) {
+	tests := []struct {
+		desc, inspectStep, used, incomplete string
+		want                                ExportEstimate
+		wantBytes                           int64
+	}{
+		{"disk size only", "", "", "", ExportEstimate{Disk: testDisk, SizeBytes: 10 << 30}, 10 << 30},
+		{"inspected", "inspect", "12345", "false", ExportEstimate{Disk: testDisk, SizeBytes: 10 << 30, UsedBytes: 12345}, 12345},
+		{"inspected incompletely", "inspect", "12345", "true", ExportEstimate{Disk: testDisk, SizeBytes: 10 << 30, UsedBytes: 12345, UsedIncomplete: true}, 10 << 30},
+		{"inspection without result", "inspect", "", "", ExportEstimate{Disk: testDisk, SizeBytes: 10 << 30}, 10 << 30},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.ComputeClient = &daisyCompute.TestClient{GetDiskFn: func(_, _, _ string) (*compute.Disk, error) {
+			return &compute.Disk{SizeGb: 10}, nil
+		}}
+		if tt.used != "" {
+			w.AddSerialConsoleOutputValue("inspect-used-bytes", tt.used)
+			w.AddSerialConsoleOutputValue("inspect-used-bytes-incomplete", tt.incomplete)
+		}
+		got, err := w.EstimateExportSize(testProject, testZone, testDisk, tt.inspectStep)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if diffRes := diff(*got, tt.want, 0); diffRes != "" {
+			t.Errorf("%s: estimate not as expected: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+		if got := got.Bytes(); got != tt.wantBytes {
+			t.Errorf("%s: got %d bytes, want %d", tt.desc, got, tt.wantBytes)
+		}
+	}
+}
+
+func TestBucketLocationIncludes(t *testing.T) {
+	tests := []struct {
+		location, region string
+		want             bool
+	}{
+		{"US-CENTRAL1", "us-central1", true},
+		{"us-east1", "us-central1", false},
+		{"NAM4", "us-east1", true},
+		{"NAM4", "us-west1", false},
+		{"US", "us-west1", true},
+		{"EU", "us-west1", false},
+	}
+	for _, tt := range tests {
+		if got := bucketLocationIncludes(tt.location, tt.region); got != tt.want {
+			t.Errorf("bucketLocationIncludes(%q, %q) = %t, want %t", tt.location, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestValidateExportDestination(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc        string
+		dest        string
+		estimate    ExportEstimate
+		wantErr     bool
+		wantWarning string
+	}{
+		{"same region", "gs://regional/disk.tar.gz", ExportEstimate{SizeBytes: 10 << 30}, false, ""},
+		{"multi-region", "gs://us/disk.tar.gz", ExportEstimate{SizeBytes: 10 << 30}, false, ""},
+		{"other region", "gs://europe/disk.tar.gz", ExportEstimate{SizeBytes: 10 << 30}, false, "egress"},
+		{"no bucket", "gs://missing/disk.tar.gz", ExportEstimate{SizeBytes: 10 << 30}, true, ""},
+		{"bad path", "disk.tar.gz", ExportEstimate{SizeBytes: 10 << 30}, true, ""},
+		{"too large", "gs://regional/disk.tar.gz", ExportEstimate{SizeBytes: 8 << 40, UsedBytes: 6 << 40}, true, ""},
+		{"maybe too large", "gs://regional/disk.tar.gz", ExportEstimate{SizeBytes: 8 << 40}, false, "may not fit"},
+		{"maybe too large, inspected incompletely", "gs://regional/disk.tar.gz", ExportEstimate{SizeBytes: 8 << 40, UsedBytes: 1 << 40, UsedIncomplete: true}, false, "may not fit"},
+		{"fits once inspected", "gs://regional/disk.tar.gz", ExportEstimate{SizeBytes: 8 << 40, UsedBytes: 1 << 40}, false, ""},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.Storage = &FakeStorage{Buckets: map[string]*storage.BucketAttrs{
+			"regional": {Location: "US-CENTRAL1"},
+			"us":       {Location: "US"},
+			"europe":   {Location: "EUROPE-WEST1"},
+		}}
+		w.ComputeClient = &daisyCompute.TestClient{GetZoneRegionFn: func(_, _ string) (string, error) { return "us-central1", nil }}
+		err := w.ValidateExportDestination(ctx, testProject, testZone, tt.dest, &tt.estimate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		var warnings []string
+		for _, e := range w.Logger.(*MockLogger).getEntries() {
+			if strings.Contains(e.Message, "WARNING") {
+				warnings = append(warnings, e.Message)
+			}
+		}
+		if tt.wantWarning == "" && len(warnings) > 0 {
+			t.Errorf("%s: unexpected warnings: %v", tt.desc, warnings)
+		}
+		if tt.wantWarning != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning)) {
+			t.Errorf("%s: got warnings %v, want one containing %q", tt.desc, warnings, tt.wantWarning)
+		}
+	}
+}
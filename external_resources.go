@@ -0,0 +1,88 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ExternalResources declares existing GCE resources a workflow uses but does
+// not create, as maps of the name steps refer to them by to their partial
+// URL, e.g. {"Instances": {"vm": "zones/z/instances/vm"}}. URLs without a
+// project are in the workflow project.
+//
+// The resources must exist when the workflow is validated. Steps can use them
+// as resources created by the workflow, e.g. to wait for a signal of an
+// instance, but cannot delete them, and cleanup leaves them.
+type ExternalResources struct {
+	Disks     map[string]string `json:",omitempty"`
+	Images    map[string]string `json:",omitempty"`
+	Instances map[string]string `json:",omitempty"`
+}
+
+// registerExternalResources checks that the ExternalResources of w exist and
+// registers them under their names.
+func (w *Workflow) registerExternalResources() DError {
+	if w.ExternalResources == nil {
+		return nil
+	}
+	var errs DError
+	for _, e := range []struct {
+		r    *baseResourceRegistry
+		urls map[string]string
+		rgx  *regexp.Regexp
+	}{
+		{&w.disks.baseResourceRegistry, w.ExternalResources.Disks, diskURLRgx},
+		{&w.images.baseResourceRegistry, w.ExternalResources.Images, imageURLRgx},
+		{&w.instances.baseResourceRegistry, w.ExternalResources.Instances, instanceURLRgx},
+	} {
+		var names []string
+		for name := range e.urls {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			errs = addErrs(errs, e.r.regExternal(name, e.urls[name], e.rgx))
+		}
+	}
+	return errs
+}
+
+// regExternal registers the existing resource at url, read-only, as name.
+func (r *baseResourceRegistry) regExternal(name, url string, rgx *regexp.Regexp) DError {
+	if name == "" {
+		return Errf("external %s %q: no name given", r.typeName, url)
+	}
+	if !rgx.MatchString(url) {
+		return Errf("external %s %q: %q is not a partial URL of a %s", r.typeName, name, url, r.typeName)
+	}
+	url = extendPartialURL(url, r.w.Project)
+	if exists, err := r.w.resourceExists(url); err != nil {
+		return Errf("external %s %q: resource lookup error: %v", r.typeName, name, err)
+	} else if !exists {
+		return typedErrf(r.typeName+resourceDNEError, "external %s %q: %s does not exist", r.typeName, name, url)
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if _, ok := r.m[name]; ok {
+		return Errf("external %s %q: name already registered", r.typeName, name)
+	}
+	parts := strings.Split(url, "/")
+	r.m[name] = &Resource{RealName: parts[len(parts)-1], link: url, NoCleanup: true, daisyName: name, external: true}
+	return nil
+}
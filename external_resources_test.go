@@ -0,0 +1,78 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestRegisterExternalResources(t *testing.T) {
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).ListInstancesFn = func(_, _ string, _ ...daisyCompute.ListCallOption) ([]*compute.Instance, error) {
+		return []*compute.Instance{{Name: testInstance}}, nil
+	}
+	w.ExternalResources = &ExternalResources{
+		Disks:     map[string]string{"d": fmt.Sprintf("zones/%s/disks/%s", testZone, testDisk)},
+		Images:    map[string]string{"i": fmt.Sprintf("projects/%s/global/images/%s", testProject, testImage)},
+		Instances: map[string]string{"vm": fmt.Sprintf("zones/%s/instances/%s", testZone, testInstance)},
+	}
+	if err := w.registerExternalResources(); err != nil {
+		t.Fatalf("error registering external resources: %v", err)
+	}
+	want := []RegisteredResource{
+		{Type: "disk", Name: "d", RealName: testDisk, Link: fmt.Sprintf("projects/%s/zones/%s/disks/%s", testProject, testZone, testDisk), NoCleanup: true, External: true},
+		{Type: "image", Name: "i", RealName: testImage, Link: fmt.Sprintf("projects/%s/global/images/%s", testProject, testImage), NoCleanup: true, External: true},
+		{Type: "instance", Name: "vm", RealName: testInstance, Link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance), NoCleanup: true, External: true},
+	}
+	if diffRes := diff(w.Resources(), want, 0); diffRes != "" {
+		t.Errorf("resources not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	s, _ := w.NewStep("s")
+	if _, err := w.instances.regUse("vm", s); err != nil {
+		t.Errorf("error using external instance: %v", err)
+	}
+	if err := (&DeleteResources{Disks: []string{"d"}}).validate(context.Background(), s); err == nil {
+		t.Error("expected error deleting external disk")
+	}
+
+	tests := []struct {
+		desc string
+		er   *ExternalResources
+	}{
+		{"does not exist", &ExternalResources{Disks: map[string]string{"d": fmt.Sprintf("zones/%s/disks/dne", testZone)}}},
+		{"wrong type", &ExternalResources{Disks: map[string]string{"d": fmt.Sprintf("zones/%s/instances/%s", testZone, testInstance)}}},
+		{"no name", &ExternalResources{Images: map[string]string{"": "global/images/" + testImage}}},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.ExternalResources = tt.er
+		if err := w.registerExternalResources(); err == nil {
+			t.Errorf("%s: expected error", tt.desc)
+		}
+	}
+
+	w = testWorkflow()
+	w.ExternalResources = &ExternalResources{Disks: map[string]string{"d": fmt.Sprintf("zones/%s/disks/%s", testZone, testDisk)}}
+	w.disks.m["d"] = &Resource{}
+	if err := w.registerExternalResources(); err == nil {
+		t.Error("expected error for a name already registered")
+	}
+}
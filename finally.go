@@ -0,0 +1,66 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import "sort"
+
+// finallyStep is the name of the step running the Finally steps of a
+// workflow.
+const finallyStep = "finally"
+
+// Finally holds steps run once the other steps of a workflow finished,
+// whether they succeeded or failed, or the workflow was canceled, e.g. to
+// upload logs, post notifications or clean up beyond the resources Daisy
+// deletes. They run before those resources are deleted.
+type Finally struct {
+	// Steps and Dependencies as in a workflow. The steps can use the
+	// resources of the workflow.
+	Steps        map[string]*Step
+	Dependencies map[string][]string `json:",omitempty"`
+	// Time the Finally steps have to finish, together. Defaults to the
+	// workflow DefaultTimeout.
+	Timeout string `json:",omitempty"`
+}
+
+// addFinally adds a step running the Finally steps of w, as an included
+// workflow, once the other steps finished. It is started even if w is
+// canceled, and its steps are only canceled at cleanup.
+func (w *Workflow) addFinally() DError {
+	if _, ok := w.Steps[finallyStep]; ok {
+		return Errf("Finally: step %q already exists", finallyStep)
+	}
+	var deps []string
+	for name := range w.Steps {
+		deps = append(deps, name)
+	}
+	sort.Strings(deps)
+
+	fw := New()
+	fw.workflowDir = w.workflowDir
+	fw.Steps = w.Finally.Steps
+	fw.Dependencies = w.Finally.Dependencies
+	w.finally = fw
+	s, _ := w.NewStep(finallyStep)
+	s.Timeout = w.Finally.Timeout
+	s.IncludeWorkflow = &IncludeWorkflow{Workflow: fw}
+	s.DependsOnCompletionOf = deps
+	s.AlwaysRun = true
+	s.runOnCancel = true
+	w.addCleanupHook(func() DError {
+		fw.CancelWorkflow()
+		return nil
+	})
+	return nil
+}
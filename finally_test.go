@@ -0,0 +1,111 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAddFinally(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.Steps = map[string]*Step{
+		"a": {testType: &mockStep{}},
+		"b": {testType: &mockStep{}},
+	}
+	w.Finally = &Finally{Steps: map[string]*Step{"upload": {testType: &mockStep{}}}, Timeout: "5m"}
+	if err := w.populate(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, ok := w.Steps[finallyStep]
+	if !ok {
+		t.Fatal("Finally step not added")
+	}
+	if diffRes := diff(s.DependsOnCompletionOf, []string{"a", "b"}, 0); diffRes != "" {
+		t.Errorf("Finally step dependencies not as expected: (-got +want)\n%s", diffRes)
+	}
+	if !s.AlwaysRun || !s.runOnCancel || s.timeout != 5*time.Minute {
+		t.Errorf("Finally step not set up: %+v", s)
+	}
+	if s.IncludeWorkflow.Workflow.Cancel == w.Cancel {
+		t.Error("Finally steps share the Cancel channel of the workflow")
+	}
+
+	w = testWorkflow()
+	w.Steps = map[string]*Step{finallyStep: {testType: &mockStep{}}}
+	w.Finally = &Finally{Steps: map[string]*Step{"upload": {testType: &mockStep{}}}}
+	if err := w.populate(ctx); err == nil {
+		t.Error("expected error for an existing finally step")
+	}
+
+	w = testWorkflow()
+	iw := New()
+	iw.Finally = &Finally{Steps: map[string]*Step{"upload": {testType: &mockStep{}}}}
+	w.Steps = map[string]*Step{"include": {IncludeWorkflow: &IncludeWorkflow{Workflow: iw}}}
+	if err := w.populate(ctx); err == nil {
+		t.Error("expected error for Finally in an included workflow")
+	}
+}
+
+func TestFinallyRun(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc    string
+		run     func(w *Workflow) func(context.Context, *Step) DError
+		wantErr bool
+	}{
+		{"success case", func(*Workflow) func(context.Context, *Step) DError { return nil }, false},
+		{"failure case", func(*Workflow) func(context.Context, *Step) DError {
+			return func(context.Context, *Step) DError { return Errf("failure") }
+		}, true},
+		{"cancel case", func(w *Workflow) func(context.Context, *Step) DError {
+			return func(context.Context, *Step) DError {
+				w.CancelWorkflow()
+				return nil
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.Steps = map[string]*Step{
+			"a": {testType: &mockStep{runImpl: tt.run(w)}},
+			"b": {testType: &mockStep{}},
+		}
+		w.Dependencies = map[string][]string{"b": {"a"}}
+		var ran int32
+		w.Finally = &Finally{Steps: map[string]*Step{"upload": {testType: &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+			select {
+			case <-s.w.Cancel:
+				return Errf("Finally step canceled")
+			default:
+			}
+			atomic.AddInt32(&ran, 1)
+			return nil
+		}}}}}
+		if err := w.populate(ctx); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		err := w.run(ctx)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if ran != 1 {
+			t.Errorf("%s: Finally step ran %d times, want 1", tt.desc, ran)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// fingerprintLabel is the label FingerprintLabel adds, set to the first
+// fingerprintLabelLen characters of the fingerprint.
+const (
+	fingerprintLabel    = "daisy-fingerprint"
+	fingerprintLabelLen = 32
+)
+
+// fingerprintExcluded are the workflow fields that tell where and how a run
+// happens rather than what it does, left out of fingerprints so that runs in
+// different projects can be compared.
+var fingerprintExcluded = []string{
+	"Project", "Zone", "GCSPath", "OAuthPath", "RunID", "AuditLog", "PollingIntervals",
+	"ComputeEndpoint", "StorageEndpoint", "QuotaProject", "RequestReason", "UserAgentSuffix", "SerialLog", "Repeat",
+}
+
+// Fingerprint returns the hex SHA-256 hash of the definition of w: its
+// fields, steps and Vars, with its included and sub workflows, and the
+// content of their Sources, read from GCS for gs:// sources. Two runs with the
+// same fingerprint ran identical definitions. The project, zone, GCS path,
+// credentials, endpoints and other settings of the run environment are left
+// out, as are the values of Sensitive vars.
+//
+// The fingerprint is computed once, before w is populated: Validate and Run
+// compute it, later calls return the same value.
+func (w *Workflow) Fingerprint(ctx context.Context) (string, DError) {
+	if w.fingerprint != "" {
+		return w.fingerprint, nil
+	}
+	if w.populated() {
+		return "", Errf("cannot fingerprint workflow %q once populated", w.Name)
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return "", newErr("failed to marshal workflow", err)
+	}
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return "", newErr("failed to marshal workflow", err)
+	}
+	if err := w.canonicalize(ctx, m); err != nil {
+		return "", err
+	}
+	// Maps are marshaled with sorted keys.
+	b, err = json.Marshal(m)
+	if err != nil {
+		return "", newErr("failed to marshal workflow", err)
+	}
+	sum := sha256.Sum256(b)
+	w.fingerprint = hex.EncodeToString(sum[:])
+	return w.fingerprint, nil
+}
+
+// canonicalize rewrites m, the JSON object of w, to the form fingerprints
+// hash, recursing into the included and sub workflows of w.
+func (w *Workflow) canonicalize(ctx context.Context, m map[string]interface{}) DError {
+	for _, f := range fingerprintExcluded {
+		delete(m, f)
+	}
+	if vars, ok := m["Vars"].(map[string]interface{}); ok {
+		for k, v := range w.Vars {
+			if v.Sensitive {
+				vars[k] = "<sensitive>"
+			}
+		}
+	}
+	if len(w.Sources) > 0 {
+		digests := map[string]interface{}{}
+		for k, src := range w.Sources {
+			d, err := w.sourceDigest(ctx, src)
+			if err != nil {
+				return Errf("failed to fingerprint source %q: %v", k, err)
+			}
+			digests[k] = d
+		}
+		m["Sources"] = digests
+	}
+
+	steps, _ := m["Steps"].(map[string]interface{})
+	for name, s := range w.Steps {
+		sm, _ := steps[name].(map[string]interface{})
+		if sm == nil {
+			continue
+		}
+		for _, nested := range []struct {
+			key string
+			w   *Workflow
+		}{
+			{"IncludeWorkflow", includedWorkflow(s)},
+			{"SubWorkflow", subWorkflow(s)},
+		} {
+			nm, _ := sm[nested.key].(map[string]interface{})
+			if nm == nil || nested.w == nil {
+				continue
+			}
+			wm, _ := nm["Workflow"].(map[string]interface{})
+			if wm == nil {
+				continue
+			}
+			// The path of the workflow file does not matter, its content does.
+			delete(nm, "Path")
+			if err := nested.w.canonicalize(ctx, wm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// populated returns whether w was populated, setting its autovars.
+func (w *Workflow) populated() bool {
+	_, ok := w.autovars["ID"]
+	return ok
+}
+
+func includedWorkflow(s *Step) *Workflow {
+	if s.IncludeWorkflow == nil {
+		return nil
+	}
+	return s.IncludeWorkflow.Workflow
+}
+
+func subWorkflow(s *Step) *Workflow {
+	if s.SubWorkflow == nil {
+		return nil
+	}
+	return s.SubWorkflow.Workflow
+}
+
+// sourceDigest returns a digest of the content of the source at src: the
+// SHA-256 hash of a local file, the CRC32C of a GCS object, or for
+// directories and GCS prefixes the hash of the names and digests of the files
+// in them.
+func (w *Workflow) sourceDigest(ctx context.Context, src string) (string, error) {
+	if src == "" {
+		return "", nil
+	}
+	if bkt, obj, err := splitGCSPath(src); err == nil {
+		if obj == "" || strings.HasSuffix(obj, "/") {
+			return w.gcsPrefixDigest(ctx, bkt, obj)
+		}
+		attrs, err := w.storage().Attrs(ctx, bkt, obj)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("crc32c:%08x", attrs.CRC32C), nil
+	}
+
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(w.workflowDir, src)
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return fileDigest(src)
+	}
+	var lines []string
+	if err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		d, err := fileDigest(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		lines = append(lines, filepath.ToSlash(rel)+" "+d)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return listDigest(lines), nil
+}
+
+func (w *Workflow) gcsPrefixDigest(ctx context.Context, bkt, prefix string) (string, error) {
+	var lines []string
+	it := w.StorageClient.Bucket(bkt).Objects(ctx, &storage.Query{Prefix: prefix})
+	for attrs, err := it.Next(); err != iterator.Done; attrs, err = it.Next() {
+		if err != nil {
+			return "", err
+		}
+		// Empty objects are not uploaded, see recursiveGCS.
+		if attrs.Size == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s crc32c:%08x", strings.TrimPrefix(attrs.Name, prefix), attrs.CRC32C))
+	}
+	return listDigest(lines), nil
+}
+
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func listDigest(lines []string) string {
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// addFingerprintLabel adds the fingerprint label to the resources w and its
+// nested workflows create, unless they set it.
+func (w *Workflow) addFingerprintLabel() {
+	v := w.fingerprint
+	if len(v) > fingerprintLabelLen {
+		v = v[:fingerprintLabelLen]
+	}
+	for _, t := range w.labelTargets() {
+		if _, ok := (*t.labels)[fingerprintLabel]; ok {
+			continue
+		}
+		if *t.labels == nil {
+			*t.labels = map[string]string{}
+		}
+		(*t.labels)[fingerprintLabel] = v
+	}
+}
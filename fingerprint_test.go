@@ -0,0 +1,134 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "startup.sh"), []byte("echo hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newWorkflow := func() *Workflow {
+		w := testWorkflow()
+		w.workflowDir = dir
+		w.Sources = map[string]string{"startup.sh": "startup.sh"}
+		w.Vars = map[string]Var{"os": {Value: "debian-11"}, "password": {Value: "secret", Sensitive: true}}
+		w.Steps = map[string]*Step{
+			"create-disks": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "disk"}}}},
+		}
+		iw := New()
+		iw.workflowDir = dir
+		iw.Steps = map[string]*Step{
+			"create-disks": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "included-disk"}}}},
+		}
+		w.Steps["include"] = &Step{IncludeWorkflow: &IncludeWorkflow{Path: "include.wf.json", Workflow: iw}}
+		return w
+	}
+	want, err := newWorkflow().Fingerprint(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(want) != 64 {
+		t.Errorf("fingerprint %q is not a hex SHA-256 hash", want)
+	}
+
+	tests := []struct {
+		desc   string
+		modify func(w *Workflow)
+		same   bool
+	}{
+		{"project case", func(w *Workflow) { w.Project = "other"; w.Zone = "other" }, true},
+		{"include path case", func(w *Workflow) { w.Steps["include"].IncludeWorkflow.Path = "other.wf.json" }, true},
+		{"sensitive var case", func(w *Workflow) { w.Vars["password"] = Var{Value: "other", Sensitive: true} }, true},
+		{"var case", func(w *Workflow) { w.Vars["os"] = Var{Value: "rhel-8"} }, false},
+		{"step case", func(w *Workflow) { (*w.Steps["create-disks"].CreateDisks)[0].Name = "other" }, false},
+		{"included step case", func(w *Workflow) {
+			(*w.Steps["include"].IncludeWorkflow.Workflow.Steps["create-disks"].CreateDisks)[0].Name = "other"
+		}, false},
+		{"source case", func(w *Workflow) {
+			if err := ioutil.WriteFile(filepath.Join(dir, "other.sh"), []byte("echo other"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			w.Sources["startup.sh"] = "other.sh"
+		}, false},
+	}
+	for _, tt := range tests {
+		w := newWorkflow()
+		tt.modify(w)
+		got, err := w.Fingerprint(ctx)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			continue
+		}
+		if (got == want) != tt.same {
+			t.Errorf("%s: got fingerprint %q, want same: %v", tt.desc, got, tt.same)
+		}
+	}
+
+	w := newWorkflow()
+	w.Sources["missing.sh"] = "missing.sh"
+	if _, err := w.Fingerprint(ctx); err == nil {
+		t.Error("expected error for a missing source")
+	}
+
+	w = newWorkflow()
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Fingerprint(ctx); err == nil {
+		t.Error("expected error for a populated workflow")
+	}
+}
+
+func TestFingerprintLabel(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.FingerprintLabel = true
+	w.Steps = map[string]*Step{
+		"create-disks": {CreateDisks: &CreateDisks{
+			{Disk: compute.Disk{Name: "disk", SizeGb: 10}},
+			{Disk: compute.Disk{Name: "labeled", SizeGb: 10, Labels: map[string]string{fingerprintLabel: "mine"}}},
+		}},
+	}
+	if err := w.Validate(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fp, _ := w.Fingerprint(ctx)
+	if w.autovars["FINGERPRINT"] != fp {
+		t.Errorf("FINGERPRINT autovar = %q, want %q", w.autovars["FINGERPRINT"], fp)
+	}
+	disks := *w.Steps["create-disks"].CreateDisks
+	if got := disks[0].Labels[fingerprintLabel]; got != fp[:fingerprintLabelLen] {
+		t.Errorf("label = %q, want %q", got, fp[:fingerprintLabelLen])
+	}
+	if got := disks[1].Labels[fingerprintLabel]; got != "mine" {
+		t.Errorf("label set by the disk = %q, want %q", got, "mine")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 
 	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 	"google.golang.org/api/compute/v1"
@@ -68,11 +69,30 @@ func (fir *FirewallRule) validate(ctx context.Context, s *Step) DError {
 		errs = addErrs(errs, Errf("%s: Network not set", pre))
 	}
 
-	// Register creation.
-	errs = addErrs(errs, s.w.firewallRules.regCreate(fir.daisyName, &fir.Resource, s, false))
+	// Register creation. Stale firewall rules of a reclaimed network are dealt
+	// with when running.
+	errs = addErrs(errs, s.w.firewallRules.regCreate(fir.daisyName, &fir.Resource, s, s.w.networkReclaimMode(fir.Network) != ""))
 	return errs
 }
 
+// allowsAnyIngress reports whether fir allows ingress traffic on all ports of
+// a protocol from any source.
+func (fir *FirewallRule) allowsAnyIngress() bool {
+	if fir.Direction != "" && fir.Direction != "INGRESS" {
+		return false
+	}
+	if !strIn("0.0.0.0/0", fir.SourceRanges) && !strIn("::/0", fir.SourceRanges) {
+		return false
+	}
+	for _, a := range fir.Allowed {
+		p := strings.ToLower(a.IPProtocol)
+		if p == "all" || (strIn(p, []string{"tcp", "udp", "sctp"}) && len(a.Ports) == 0) {
+			return true
+		}
+	}
+	return false
+}
+
 type firewallRuleConnection struct {
 	connector, disconnector *Step
 }
@@ -93,7 +113,7 @@ func newFirewallRuleRegistry(w *Workflow) *firewallRuleRegistry {
 
 func (frr *firewallRuleRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(firewallRuleURLRegex, res.link)
-	err := frr.w.ComputeClient.DeleteFirewallRule(m["project"], m["firewallRule"])
+	err := frr.w.resourceClient(res).DeleteFirewallRule(m["project"], m["firewallRule"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete firewall", err)
 	}
@@ -0,0 +1,275 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Flatten returns a single self-contained workflow equivalent to w, with the
+// steps of IncludeWorkflow and SubWorkflow steps inlined. Inlined steps are
+// named "<include step>-<step>", the vars and the ${NAME} and ${WFDIR}
+// autovars of included workflows are substituted, and their Sources are
+// merged, with relative paths rewritten relative to the directory of w.
+// Steps depending on an include step depend on the last steps of the included
+// workflow instead. Inlined steps default to the Timeout of their include
+// step, and can't run longer than it. The Labels of included workflows are
+// added to the resources of their inlined steps. Included workflows with
+// Finally steps can't be inlined.
+//
+// w must not have been populated, as when read by NewFromFile. Resources of
+// SubWorkflows are not renamed, in the flattened workflow they share the
+// namespace of the other steps.
+func Flatten(w *Workflow) (*Workflow, DError) {
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, newErr("failed to copy workflow", err)
+	}
+	fw := New()
+	if err := json.Unmarshal(b, fw); err != nil {
+		return nil, newErr("failed to copy workflow", err)
+	}
+	fw.workflowDir = w.workflowDir
+	fw.Steps = map[string]*Step{}
+	fw.Dependencies = map[string][]string{}
+	f := &flattener{fw: fw, dir: w.workflowDir}
+	if _, err := f.flatten(w, "", "", nil, strings.NewReplacer(), nil); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+type flattener struct {
+	fw *Workflow
+	// dir is the directory of the flattened workflow.
+	dir string
+}
+
+// flatten adds the steps of src to the flattened workflow, prefixing their
+// names with prefix, running replacer on them and making them inherit
+// timeout and env. Steps of src without dependencies depend on deps. Returns
+// the names of the steps that finish src.
+func (f *flattener) flatten(src *Workflow, prefix, timeout string, env *StepEnv, replacer *strings.Replacer, deps []string) ([]string, DError) {
+	exits := map[string][]string{}
+	visiting := map[string]bool{}
+	var add func(name string) ([]string, DError)
+	add = func(name string) ([]string, DError) {
+		if e, ok := exits[name]; ok {
+			return e, nil
+		}
+		if visiting[name] {
+			return nil, Errf("dependency cycle at step %q", prefix+name)
+		}
+		visiting[name] = true
+
+		stepDeps := deps
+		srcDeps := dedupe(append(append([]string{}, src.Dependencies[name]...), src.Steps[name].DependsOnCompletionOf...))
+		if len(srcDeps) > 0 {
+			stepDeps = nil
+			for _, d := range srcDeps {
+				if _, ok := src.Steps[d]; !ok {
+					return nil, Errf("step %q depends on unknown step %q", prefix+name, prefix+d)
+				}
+				e, err := add(d)
+				if err != nil {
+					return nil, err
+				}
+				stepDeps = append(stepDeps, e...)
+			}
+		}
+
+		e, err := f.flattenStep(src.Steps[name], prefix, name, timeout, env, replacer, stepDeps)
+		if err != nil {
+			return nil, err
+		}
+		if cs, ok := f.fw.Steps[prefix+name]; ok && len(cs.DependsOnCompletionOf) > 0 {
+			var completion []string
+			for _, d := range src.Steps[name].DependsOnCompletionOf {
+				completion = append(completion, exits[d]...)
+			}
+			cs.DependsOnCompletionOf = dedupe(completion)
+		}
+		exits[name] = e
+		return e, nil
+	}
+
+	var names []string
+	for name := range src.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dependedOn := map[string]bool{}
+	for _, ds := range src.Dependencies {
+		for _, d := range ds {
+			dependedOn[d] = true
+		}
+	}
+	var last []string
+	for _, name := range names {
+		e, err := add(name)
+		if err != nil {
+			return nil, err
+		}
+		if !dependedOn[name] {
+			last = append(last, e...)
+		}
+	}
+
+	for k, v := range src.Sources {
+		v = replacer.Replace(v)
+		if _, _, err := splitGCSPath(v); err != nil && v != "" && !filepath.IsAbs(v) && src.workflowDir != f.dir {
+			v = filepath.Join(src.workflowDir, v)
+			if rel, err := filepath.Rel(f.dir, v); err == nil && f.dir != "" {
+				v = rel
+			}
+		}
+		if old, ok := f.fw.Sources[k]; ok && old != v {
+			return nil, Errf("source %q already exists in workflow", k)
+		}
+		if f.fw.Sources == nil {
+			f.fw.Sources = map[string]string{}
+		}
+		f.fw.Sources[k] = v
+	}
+	for k, v := range src.SourceSHA256 {
+		if f.fw.SourceSHA256 == nil {
+			f.fw.SourceSHA256 = map[string]string{}
+		}
+		f.fw.SourceSHA256[k] = v
+	}
+	return dedupe(last), nil
+}
+
+// flattenStep adds s, named prefix+stepName, to the flattened workflow,
+// inlining it if it is an IncludeWorkflow or SubWorkflow step. Returns the
+// names of the steps that finish s.
+func (f *flattener) flattenStep(s *Step, prefix, stepName, timeout string, env *StepEnv, replacer *strings.Replacer, deps []string) ([]string, DError) {
+	name := prefix + stepName
+	var child *Workflow
+	var vars map[string]string
+	var kind string
+	switch {
+	case s.IncludeWorkflow != nil:
+		child, vars, kind = s.IncludeWorkflow.Workflow, s.IncludeWorkflow.Vars, "IncludeWorkflow"
+	case s.SubWorkflow != nil:
+		child, vars, kind = s.SubWorkflow.Workflow, s.SubWorkflow.Vars, "SubWorkflow"
+	}
+
+	if s.Repeat != nil && child != nil {
+		return nil, Errf("%s %q cannot be inlined, it has a Repeat", kind, name)
+	}
+	if child != nil && child.Finally != nil {
+		return nil, Errf("%s %q cannot be inlined, it has Finally steps", kind, name)
+	}
+	if child == nil {
+		if kind != "" {
+			return nil, Errf("%s %q does not have a workflow", kind, name)
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, newErr(fmt.Sprintf("failed to copy step %q", name), err)
+		}
+		cs := &Step{}
+		if err := json.Unmarshal(b, cs); err != nil {
+			return nil, newErr(fmt.Sprintf("failed to copy step %q", name), err)
+		}
+		substitute(reflect.ValueOf(cs).Elem(), replacer)
+		cs.Timeout = strOr(cs.Timeout, timeout)
+		cs.Env = cs.Env.inherit(env)
+		f.fw.Steps[name] = cs
+		if len(deps) > 0 {
+			f.fw.Dependencies[name] = dedupe(deps)
+		}
+		return []string{name}, nil
+	}
+
+	values := map[string]string{}
+	for k, v := range child.Vars {
+		values[k] = v.Value
+	}
+	for k, v := range vars {
+		if _, ok := child.Vars[k]; !ok {
+			return nil, Errf("unknown workflow Var %q passed to %s %q", k, kind, name)
+		}
+		values[k] = replacer.Replace(v)
+	}
+	// As when run, ${NAME} is the name of the include step in its own workflow.
+	replacements := []string{"${NAME}", stepName, "${WFDIR}", child.workflowDir}
+	for k, v := range values {
+		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
+	}
+
+	childEnv := s.Env.inherit(env)
+	if childEnv != nil {
+		substitute(reflect.ValueOf(childEnv).Elem(), replacer)
+	}
+	before := map[string]bool{}
+	for n := range f.fw.Steps {
+		before[n] = true
+	}
+	childTimeout := replacer.Replace(strOr(s.Timeout, timeout))
+	childReplacer := strings.NewReplacer(replacements...)
+	e, err := f.flatten(child, name+"-", childTimeout, childEnv, childReplacer, deps)
+	if err != nil {
+		return nil, err
+	}
+	inlined := &Workflow{Name: name, Steps: map[string]*Step{}}
+	for n, st := range f.fw.Steps {
+		if !before[n] {
+			inlined.Steps[n] = st
+		}
+	}
+
+	// The include step times out the whole included workflow, none of its
+	// steps can run longer.
+	limit := strOr(childTimeout, f.fw.DefaultTimeout, defaultTimeout)
+	if l, err := time.ParseDuration(limit); err == nil {
+		for _, st := range inlined.Steps {
+			if d, err := time.ParseDuration(st.Timeout); err == nil && d > l {
+				st.Timeout = limit
+			}
+		}
+	}
+	if len(child.Labels) > 0 {
+		inlined.Labels = map[string]string{}
+		for k, v := range child.Labels {
+			inlined.Labels[childReplacer.Replace(k)] = childReplacer.Replace(v)
+		}
+		if err := inlined.addWorkflowLabels(); err != nil {
+			return nil, err
+		}
+	}
+	if len(e) == 0 {
+		return deps, nil
+	}
+	return e, nil
+}
+
+// dedupe returns ss without duplicates, keeping the first occurrences.
+func dedupe(ss []string) []string {
+	var out []string
+	for _, s := range ss {
+		if !strIn(s, out) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestFlatten(t *testing.T) {
+	child := New()
+	child.workflowDir = "/wf/child"
+	child.Vars = map[string]Var{"disk": {Value: "default"}}
+	child.Sources = map[string]string{"script": "script.sh"}
+	child.Steps = map[string]*Step{
+		"create": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "${disk}", Description: "${NAME}"}}}},
+		"delete": {DeleteResources: &DeleteResources{Disks: []string{"${disk}"}}},
+	}
+	child.Dependencies = map[string][]string{"delete": {"create"}}
+
+	w := New()
+	w.workflowDir = "/wf"
+	w.Vars = map[string]Var{"name": {Value: "d"}}
+	w.Sources = map[string]string{"file": "file.txt"}
+	w.Steps = map[string]*Step{
+		"first": {DeleteResources: &DeleteResources{Disks: []string{"x"}}},
+		"inc":   {Timeout: "1h", Env: &StepEnv{Zone: "${name}-zone"}, IncludeWorkflow: &IncludeWorkflow{Vars: map[string]string{"disk": "${name}"}, Workflow: child}},
+		"last":  {DeleteResources: &DeleteResources{Disks: []string{"y"}}},
+	}
+	w.Dependencies = map[string][]string{"inc": {"first"}, "last": {"inc"}}
+
+	fw, err := Flatten(w)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for name := range fw.Steps {
+		names = append(names, name)
+	}
+	for _, want := range []string{"first", "inc-create", "inc-delete", "last"} {
+		if !strIn(want, names) {
+			t.Errorf("step %q not in flattened steps %q", want, names)
+		}
+	}
+	if len(names) != 4 {
+		t.Errorf("want 4 flattened steps, got %q", names)
+	}
+	wantDeps := map[string][]string{
+		"inc-create": {"first"},
+		"inc-delete": {"inc-create"},
+		"last":       {"inc-delete"},
+	}
+	if !reflect.DeepEqual(fw.Dependencies, wantDeps) {
+		t.Errorf("got dependencies %v, want %v", fw.Dependencies, wantDeps)
+	}
+	d := (*fw.Steps["inc-create"].CreateDisks)[0]
+	if d.Name != "${name}" || d.Description != "inc" {
+		t.Errorf("included vars not substituted: %+v", d.Disk)
+	}
+	if fw.Steps["inc-create"].Timeout != "1h" {
+		t.Errorf("included step timeout: got %q, want %q", fw.Steps["inc-create"].Timeout, "1h")
+	}
+	if env := fw.Steps["inc-create"].Env; env == nil || env.Zone != "${name}-zone" {
+		t.Errorf("included step does not inherit the include step Env: %+v", env)
+	}
+	if env := fw.Steps["first"].Env; env != nil {
+		t.Errorf("unexpected Env for step %q: %+v", "first", env)
+	}
+	wantSources := map[string]string{"file": "file.txt", "script": "child/script.sh"}
+	if !reflect.DeepEqual(fw.Sources, wantSources) {
+		t.Errorf("got sources %v, want %v", fw.Sources, wantSources)
+	}
+	if w.Steps["inc"].IncludeWorkflow.Workflow.Steps["create"].CreateDisks == nil || (*child.Steps["create"].CreateDisks)[0].Name != "${disk}" {
+		t.Error("Flatten modified the original workflow")
+	}
+
+	w.Steps["inc"].IncludeWorkflow.Vars["unknown"] = "foo"
+	if _, err := Flatten(w); err == nil {
+		t.Error("expected error for unknown var")
+	}
+}
+
+func TestFlattenNested(t *testing.T) {
+	inner := New()
+	inner.Labels = map[string]string{"inner": "${NAME}"}
+	inner.Steps = map[string]*Step{
+		"create": {Timeout: "2h", CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "d", Description: "${NAME}"}}}},
+	}
+	outer := New()
+	outer.Labels = map[string]string{"outer": "o"}
+	outer.Steps = map[string]*Step{
+		"nested": {IncludeWorkflow: &IncludeWorkflow{Workflow: inner}},
+	}
+	w := New()
+	w.Steps = map[string]*Step{
+		"inc":   {Timeout: "1h", IncludeWorkflow: &IncludeWorkflow{Workflow: outer}},
+		"other": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "other"}}}},
+	}
+
+	fw, err := Flatten(w)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, ok := fw.Steps["inc-nested-create"]
+	if !ok {
+		t.Fatalf("step %q not in flattened steps", "inc-nested-create")
+	}
+	d := (*s.CreateDisks)[0]
+	if d.Description != "nested" {
+		t.Errorf("${NAME}: got %q, want %q", d.Description, "nested")
+	}
+	if s.Timeout != "1h" {
+		t.Errorf("nested step timeout: got %q, want %q", s.Timeout, "1h")
+	}
+	wantLabels := map[string]string{"inner": "nested", "outer": "o"}
+	if !reflect.DeepEqual(d.Labels, wantLabels) {
+		t.Errorf("got labels %v, want %v", d.Labels, wantLabels)
+	}
+	if l := (*fw.Steps["other"].CreateDisks)[0].Labels; l != nil {
+		t.Errorf("unexpected labels on a step not included: %v", l)
+	}
+
+	outer.Finally = &Finally{Steps: map[string]*Step{"f": {DeleteResources: &DeleteResources{}}}}
+	if _, err := Flatten(w); err == nil {
+		t.Error("expected error for included workflow with Finally steps")
+	}
+}
@@ -54,7 +54,7 @@ func (fr *ForwardingRule) populate(ctx context.Context, s *Step) DError {
 	if targetInstanceURLRegex.MatchString(fr.Target) {
 		fr.Target = extendPartialURL(fr.Target, fr.Project)
 	} else {
-		fr.Target = fmt.Sprintf("projects/%s/zones/%s/targetInstances/%s", fr.Project, s.w.Zone, fr.Target)
+		fr.Target = fmt.Sprintf("projects/%s/zones/%s/targetInstances/%s", fr.Project, s.zone(), fr.Target)
 	}
 
 	fr.Description = strOr(fr.Description, defaultDescription("ForwardingRule", s.w.Name, s.w.username))
@@ -101,7 +101,7 @@ func newForwardingRuleRegistry(w *Workflow) *forwardingRuleRegistry {
 
 func (tir *forwardingRuleRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(forwardingRuleURLRegex, res.link)
-	err := tir.w.ComputeClient.DeleteForwardingRule(m["project"], m["region"], m["forwardingRule"])
+	err := tir.w.resourceClient(res).DeleteForwardingRule(m["project"], m["region"], m["forwardingRule"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete forwarding rule", err)
 	}
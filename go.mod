@@ -16,4 +16,5 @@ require (
 	google.golang.org/api v0.66.0
 	google.golang.org/genproto v0.0.0-20220201184016-50beb8ab5c44
 	google.golang.org/grpc v1.40.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,122 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	godebugDiff "github.com/kylelemons/godebug/diff"
+)
+
+// UpdateGoldenEnv is the environment variable that makes CompareGolden
+// write the golden files instead of comparing them, when set to 1.
+const UpdateGoldenEnv = "DAISY_UPDATE_GOLDEN"
+
+// Render populates w, as Validate does but without reading GCE or GCS, and
+// returns it in a canonical form to compare with golden files: Marshal(true)
+// with the values that change every run, such as the workflow IDs, the time,
+// the user and the directories, replaced by the autovars they come from, e.g.
+// ${ID}. If w has no GCSPath, the default scratch bucket of the project is
+// assumed. w only logs to its Logger, if set, and must not be run afterwards.
+func (w *Workflow) Render(ctx context.Context) ([]byte, DError) {
+	w.externalLogging = false
+	w.gcsLoggingDisabled = true
+	w.stdoutLoggingDisabled = true
+	if w.GCSPath == "" {
+		var replacements []string
+		for k, v := range w.Vars {
+			replacements = append(replacements, fmt.Sprintf("${%s}", k), v.Value)
+		}
+		w.GCSPath = "gs://" + daisyBktName(strings.NewReplacer(replacements...).Replace(w.Project))
+	}
+	if err := w.populate(ctx); err != nil {
+		return nil, err
+	}
+	b, err := w.Marshal(true)
+	if err != nil {
+		return nil, newErr("failed to marshal workflow", err)
+	}
+	return []byte(w.normalizer().Replace(string(b))), nil
+}
+
+// normalizer returns a Replacer of the values of the autovars that change
+// every run, in w and its nested workflows, by the autovars.
+func (w *Workflow) normalizer() *strings.Replacer {
+	values := map[string]string{}
+	var add func(w *Workflow)
+	add = func(w *Workflow) {
+		for _, k := range []string{"ID", "DATE", "DATETIME", "TIMESTAMP", "USERNAME", "WFDIR", "CWD"} {
+			// Values too short to be told apart from other text, such as a
+			// one letter user name, are kept.
+			if v := w.autovars[k]; len(v) >= 3 {
+				values[v] = "${" + k + "}"
+			}
+		}
+		// The scratch path has its own time format.
+		if t, err := time.Parse("20060102150405", w.autovars["DATETIME"]); err == nil {
+			values[t.Format("20060102-15:04:05")] = "${DATETIME}"
+		}
+		for _, s := range w.Steps {
+			if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow != nil {
+				add(s.IncludeWorkflow.Workflow)
+			}
+			if s.SubWorkflow != nil && s.SubWorkflow.Workflow != nil {
+				add(s.SubWorkflow.Workflow)
+			}
+		}
+	}
+	add(w)
+
+	// Longer values first, so that a value containing another, such as the
+	// working directory containing the workflow directory, is replaced whole.
+	var vs []string
+	for v := range values {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		if len(vs[i]) != len(vs[j]) {
+			return len(vs[i]) > len(vs[j])
+		}
+		return vs[i] < vs[j]
+	})
+	var oldnew []string
+	for _, v := range vs {
+		oldnew = append(oldnew, v, values[v])
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// CompareGolden returns an error with a line diff if got differs from the
+// content of the golden file. With UpdateGoldenEnv set to 1, the file is
+// written with got instead.
+func CompareGolden(got []byte, file string) error {
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		return ioutil.WriteFile(file, got, 0644)
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading golden file, set %s=1 to write it: %v", UpdateGoldenEnv, err)
+	}
+	if string(got) == string(want) {
+		return nil
+	}
+	return fmt.Errorf("differs from golden file %s, set %s=1 to update it: (-got,+want)\n%s", file, UpdateGoldenEnv, godebugDiff.Diff(string(got), string(want)))
+}
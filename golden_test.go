@@ -0,0 +1,81 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	// Rendering twice, with different IDs and times, gives the same result.
+	var renders []string
+	for i := 0; i < 2; i++ {
+		w, err := NewFromFile("test_data/TestRender.parent.wf.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := w.Render(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{w.id, w.username, w.workflowDir} {
+			if strings.Contains(string(got), v) {
+				t.Errorf("rendered workflow contains %q:\n%s", v, got)
+			}
+		}
+		renders = append(renders, string(got))
+	}
+	if renders[0] != renders[1] {
+		t.Errorf("renders differ:\n%s\n%s", renders[0], renders[1])
+	}
+	if err := CompareGolden([]byte(renders[0]), "test_data/TestRender.golden.json"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	golden := filepath.Join(td, "golden.json")
+	ioutil.WriteFile(golden, []byte("a\nb\n"), 0600)
+
+	if err := CompareGolden([]byte("a\nb\n"), golden); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = CompareGolden([]byte("a\nc\n"), golden)
+	if err == nil || !strings.Contains(err.Error(), "-c\n+b") {
+		t.Errorf("got error %v, want a diff", err)
+	}
+	if err := CompareGolden(nil, filepath.Join(td, "missing.json")); err == nil {
+		t.Error("got no error for a missing golden file")
+	}
+
+	os.Setenv(UpdateGoldenEnv, "1")
+	defer os.Unsetenv(UpdateGoldenEnv)
+	if err := CompareGolden([]byte("c\n"), golden); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(golden); string(b) != "c\n" {
+		t.Errorf("golden file not updated: %q", b)
+	}
+}
@@ -0,0 +1,179 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	// GuestAttributeShellMetadataKey is the instance metadata key holding the
+	// shell guest attribute helper when InstanceBase.GuestAttributeHelpers is set.
+	GuestAttributeShellMetadataKey = "daisy-guest-attributes-sh"
+	// GuestAttributePowerShellMetadataKey is the instance metadata key holding
+	// the PowerShell guest attribute helper when
+	// InstanceBase.GuestAttributeHelpers is set.
+	GuestAttributePowerShellMetadataKey = "daisy-guest-attributes-ps1"
+
+	// HeartbeatNamespace and HeartbeatKey name the guest attribute guests
+	// update periodically while they work, with the current Unix time, so
+	// that a WaitForInstancesSignal HeartbeatTimeout can tell a hung guest
+	// from a busy one.
+	HeartbeatNamespace = "daisy"
+	HeartbeatKey       = "heartbeat"
+	// HeartbeatIntervalSeconds is how often the guest helpers and the startup
+	// script harness update the heartbeat.
+	HeartbeatIntervalSeconds = 30
+
+	guestAttributesURL    = "http://metadata.google.internal/computeMetadata/v1/instance/guest-attributes"
+	metadataAttributesURL = "http://metadata.google.internal/computeMetadata/v1/instance/attributes"
+)
+
+// guestAttrNameRgx matches the guest attribute namespaces and keys
+// GuestAttributeDefaults can set, which are written into the guest helpers.
+var guestAttrNameRgx = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// GuestAttributeDefaults sets the guest attribute that GuestAttribute signals
+// of WaitForInstancesSignal steps watch unless they set their own, and that
+// the guest attribute helpers write by default, for fleets using another
+// convention than daisy/DaisyResult. Included and sub workflows inherit each
+// field their GuestAttributeDefaults does not set.
+type GuestAttributeDefaults struct {
+	// Defaults to "daisy".
+	Namespace string `json:",omitempty"`
+	// Defaults to "DaisyResult".
+	KeyName string `json:",omitempty"`
+}
+
+func (w *Workflow) validateGuestAttributeDefaults() DError {
+	gd := w.GuestAttributeDefaults
+	if gd == nil {
+		return nil
+	}
+	if gd.Namespace != "" && !guestAttrNameRgx.MatchString(gd.Namespace) {
+		return Errf("GuestAttributeDefaults.Namespace must only contain letters, digits, '_' and '-': %q", gd.Namespace)
+	}
+	if gd.KeyName != "" && !guestAttrNameRgx.MatchString(gd.KeyName) {
+		return Errf("GuestAttributeDefaults.KeyName must only contain letters, digits, '_' and '-': %q", gd.KeyName)
+	}
+	return nil
+}
+
+// guestAttributeDefaults returns the GuestAttributeDefaults of w, with each
+// field unset taken from the closest parent that sets it, or its default.
+func (w *Workflow) guestAttributeDefaults() GuestAttributeDefaults {
+	var c GuestAttributeDefaults
+	for ; w != nil; w = w.parent {
+		if w.GuestAttributeDefaults == nil {
+			continue
+		}
+		c.Namespace = strOr(c.Namespace, w.GuestAttributeDefaults.Namespace)
+		c.KeyName = strOr(c.KeyName, w.GuestAttributeDefaults.KeyName)
+	}
+	c.Namespace = strOr(c.Namespace, defaultGuestAttrNamespace)
+	c.KeyName = strOr(c.KeyName, defaultGuestAttrKeyName)
+	return c
+}
+
+// GuestAttributeShellScript returns a shell snippet defining daisy_report,
+// which writes a value to a guest attribute watched by a GuestAttribute
+// WaitForInstancesSignal, and daisy_heartbeat, which updates the heartbeat
+// guest attribute in the background until the calling shell exits, and
+// daisy_artifact, which announces the GCS URL of an artifact for
+// CollectArtifacts.
+// Usage: daisy_report VALUE [KEY [NAMESPACE]], daisy_heartbeat,
+// daisy_artifact URL.
+// Guests can load it with:
+//
+//	eval "$(curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/attributes/daisy-guest-attributes-sh)"
+func GuestAttributeShellScript() string {
+	return guestAttributeShellScript(defaultGuestAttrNamespace, defaultGuestAttrKeyName)
+}
+
+// guestAttributeShellScript is GuestAttributeShellScript with daisy_report
+// writing key in namespace by default.
+func guestAttributeShellScript(namespace, key string) string {
+	// Avoid ${} expansions, they would be taken for unresolved workflow vars.
+	return fmt.Sprintf(`daisy_report() {
+  key=$2
+  ns=$3
+  [ -n "$key" ] || key=%s
+  [ -n "$ns" ] || ns=%s
+  curl -sf -X PUT --data "$1" -H 'Metadata-Flavor: Google' "%[3]s/$ns/$key"
+}
+daisy_artifact() {
+  daisy_report "$1" "u$(printf %%s "$1" | md5sum | cut -c1-16)" %[5]s
+}
+%[4]s`, key, namespace, guestAttributesURL, heartbeatShellFunc(), ArtifactsNamespace)
+}
+
+// heartbeatShellFunc returns the shell definition of daisy_heartbeat.
+func heartbeatShellFunc() string {
+	return fmt.Sprintf(`daisy_heartbeat() {
+  (
+    while kill -0 $$ 2>/dev/null; do
+      curl -sf -X PUT --data "$(date +%%s)" -H 'Metadata-Flavor: Google' "%s/%s/%s" >/dev/null
+      sleep %d
+    done
+  ) &
+}
+`, guestAttributesURL, HeartbeatNamespace, HeartbeatKey, HeartbeatIntervalSeconds)
+}
+
+// GuestAttributePowerShellScript returns a PowerShell snippet defining
+// Write-DaisyResult, which writes a value to a guest attribute watched by a
+// GuestAttribute WaitForInstancesSignal, and Start-DaisyHeartbeat, which
+// starts a job updating the heartbeat guest attribute, and
+// Write-DaisyArtifact, which announces the GCS URL of an artifact for
+// CollectArtifacts.
+// Usage: Write-DaisyResult -Value VALUE [-Key KEY] [-Namespace NAMESPACE],
+// Start-DaisyHeartbeat, Write-DaisyArtifact -URL URL.
+// Guests can load it with:
+//
+//	Invoke-Expression (Invoke-RestMethod -Headers @{'Metadata-Flavor'='Google'} -Uri http://metadata.google.internal/computeMetadata/v1/instance/attributes/daisy-guest-attributes-ps1)
+func GuestAttributePowerShellScript() string {
+	return guestAttributePowerShellScript(defaultGuestAttrNamespace, defaultGuestAttrKeyName)
+}
+
+// guestAttributePowerShellScript is GuestAttributePowerShellScript with
+// Write-DaisyResult writing key in namespace by default.
+func guestAttributePowerShellScript(namespace, key string) string {
+	return fmt.Sprintf(`function Write-DaisyResult {
+  param([string]$Value, [string]$Key = '%s', [string]$Namespace = '%s')
+  Invoke-RestMethod -Method PUT -Body $Value -Headers @{'Metadata-Flavor'='Google'} -Uri "%[3]s/$Namespace/$Key"
+}
+function Write-DaisyArtifact {
+  param([string]$URL)
+  Write-DaisyResult -Value $URL -Key ('u' + [guid]::NewGuid().ToString('N').Substring(0, 16)) -Namespace '%[5]s'
+}
+%[4]s`, key, namespace, guestAttributesURL, heartbeatPowerShellFunc(), ArtifactsNamespace)
+}
+
+// heartbeatPowerShellFunc returns the PowerShell definition of
+// Start-DaisyHeartbeat.
+func heartbeatPowerShellFunc() string {
+	return fmt.Sprintf(`function Start-DaisyHeartbeat {
+  Start-Job -ScriptBlock {
+    while ($true) {
+      try {
+        Invoke-RestMethod -Method PUT -Body ([DateTimeOffset]::UtcNow.ToUnixTimeSeconds()) -Headers @{'Metadata-Flavor'='Google'} -Uri '%s/%s/%s' | Out-Null
+      } catch {}
+      Start-Sleep -Seconds %d
+    }
+  } | Out-Null
+}
+`, guestAttributesURL, HeartbeatNamespace, HeartbeatKey, HeartbeatIntervalSeconds)
+}
@@ -0,0 +1,97 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestGuestAttributeScripts(t *testing.T) {
+	tests := []struct {
+		desc   string
+		script string
+		want   []string
+	}{
+		{"shell", GuestAttributeShellScript(), []string{"daisy_report()", "key=DaisyResult", "ns=daisy", guestAttributesURL + "/$ns/$key", "Metadata-Flavor: Google", "daisy_heartbeat()", guestAttributesURL + "/daisy/heartbeat", "daisy_artifact()"}},
+		{"powershell", GuestAttributePowerShellScript(), []string{"function Write-DaisyResult", "$Key = 'DaisyResult'", "$Namespace = 'daisy'", guestAttributesURL + "/$Namespace/$Key", "function Start-DaisyHeartbeat", guestAttributesURL + "/daisy/heartbeat", "function Write-DaisyArtifact"}},
+	}
+	for _, tt := range tests {
+		if strings.Contains(tt.script, "${") {
+			t.Errorf("%s: script would be taken for an unresolved var: %q", tt.desc, tt.script)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(tt.script, want) {
+				t.Errorf("%s: script %q does not contain %q", tt.desc, tt.script, want)
+			}
+		}
+	}
+}
+
+func TestGuestAttributeDefaults(t *testing.T) {
+	w := testWorkflow()
+	if got, want := w.guestAttributeDefaults(), (GuestAttributeDefaults{Namespace: "daisy", KeyName: "DaisyResult"}); got != want {
+		t.Errorf("got defaults %+v, want %+v", got, want)
+	}
+
+	// Sub workflows inherit each field they do not set.
+	w.GuestAttributeDefaults = &GuestAttributeDefaults{Namespace: "fleet", KeyName: "Result"}
+	sw := w.NewSubWorkflow()
+	sw.GuestAttributeDefaults = &GuestAttributeDefaults{KeyName: "BuildResult"}
+	sw.Logger, sw.ComputeClient = w.Logger, w.ComputeClient
+	if got, want := sw.guestAttributeDefaults(), (GuestAttributeDefaults{Namespace: "fleet", KeyName: "BuildResult"}); got != want {
+		t.Errorf("got sub workflow defaults %+v, want %+v", got, want)
+	}
+	ga := &GuestAttribute{}
+	w.ComputeClient.(*daisyCompute.TestClient).GetGuestAttributesFn = func(_, _, _, _, key string) (*compute.GuestAttributes, error) {
+		if key != "fleet/BuildResult" {
+			return nil, fmt.Errorf("unexpected key %q", key)
+		}
+		return &compute.GuestAttributes{VariableKey: key, VariableValue: "done"}, nil
+	}
+	defer func(d time.Duration) { guestAttributeMinInterval = d }(guestAttributeMinInterval)
+	guestAttributeMinInterval = time.Millisecond
+	if err := waitForGuestAttribute(&Step{name: "wait", w: sw}, testProject, testZone, "i", ga, time.Millisecond, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	script := guestAttributeShellScript("fleet", "BuildResult")
+	for _, want := range []string{"key=BuildResult", "ns=fleet"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script %q does not contain %q", script, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		desc    string
+		gd      *GuestAttributeDefaults
+		wantErr bool
+	}{
+		{"unset case", nil, false},
+		{"valid case", &GuestAttributeDefaults{Namespace: "my-fleet", KeyName: "Build_Result"}, false},
+		{"slash in namespace case", &GuestAttributeDefaults{Namespace: "a/b"}, true},
+		{"shell in key case", &GuestAttributeDefaults{KeyName: "$(reboot)"}, true},
+	} {
+		w := testWorkflow()
+		w.GuestAttributeDefaults = tt.gd
+		if err := w.validateGuestAttributeDefaults(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+	}
+}
@@ -188,7 +188,7 @@ func (i *Image) create(cc daisyCompute.Client) error {
 }
 
 func (i *Image) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
 }
 
 func (i *Image) delete(cc daisyCompute.Client) error {
@@ -263,7 +263,7 @@ func (i *ImageBeta) create(cc daisyCompute.Client) error {
 }
 
 func (i *ImageBeta) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
 }
 
 func (i *ImageBeta) delete(cc daisyCompute.Client) error {
@@ -338,7 +338,7 @@ func (i *ImageAlpha) create(cc daisyCompute.Client) error {
 }
 
 func (i *ImageAlpha) markCreatedInWorkflow() {
-	i.createdInWorkflow = true
+	i.markCreated()
 }
 
 func (i *ImageAlpha) delete(cc daisyCompute.Client) error {
@@ -393,7 +393,9 @@ func (ib *ImageBase) populate(ctx context.Context, ii ImageInterface, s *Step) D
 	if ii.hasRawDisk() {
 		if s.w.sourceExists(ii.getRawDiskSource()) {
 			ii.setRawDiskSource(s.w.getSourceGCSAPIPath(ii.getRawDiskSource()))
-		} else if p, err := getGCSAPIPath(ii.getRawDiskSource()); err == nil {
+		} else if src, err := s.w.stageGCSInput(ii.getRawDiskSource()); err != nil {
+			errs = addErrs(errs, err)
+		} else if p, err := getGCSAPIPath(src); err == nil {
 			ii.setRawDiskSource(p)
 		} else {
 			errs = addErrs(errs, Errf("bad value for RawDisk.Source: %q", ii.getRawDiskSource()))
@@ -432,7 +434,7 @@ func (ib *ImageBase) validate(ctx context.Context, ii ImageInterface, licenses [
 
 		// Check if this image object is created by this workflow, otherwise check if object exists.
 		if !strIn(path.Join(sBkt, sObj), s.w.objects.created) && !strings.HasPrefix(sObj, s.w.outsPath) {
-			if _, err := s.w.StorageClient.Bucket(sBkt).Object(sObj).Attrs(ctx); err != nil {
+			if _, err := s.w.storage().Attrs(ctx, sBkt, sObj); err != nil {
 				errs = addErrs(errs, Errf("error reading object %s/%s: %v", sBkt, sObj, err))
 			}
 		}
@@ -479,7 +481,7 @@ func newImageRegistry(w *Workflow) *imageRegistry {
 
 func (ir *imageRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(imageURLRgx, res.link)
-	err := ir.w.ComputeClient.DeleteImage(m["project"], m["image"])
+	err := ir.w.resourceClient(res).DeleteImage(m["project"], m["image"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete image", err)
 	}
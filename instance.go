@@ -74,8 +74,8 @@ type InstanceInterface interface {
 	getMachineType() string
 	setMachineType(machineType string)
 	populateDisks(w *Workflow) DError
-	populateNetworks() DError
-	populateScopes() DError
+	populateNetworks(env StepEnv) DError
+	populateScopes(env StepEnv) DError
 	initializeComputeMetadata()
 	appendComputeMetadata(key string, value *string)
 	validateNetworks(s *Step) (errs DError)
@@ -100,6 +100,10 @@ type InstanceBase struct {
 	// StartupScript is the Sources path to a startup script to use in this step.
 	// This will be automatically mapped to the appropriate metadata key.
 	StartupScript string `json:",omitempty"`
+	// StartupScriptHarness runs StartupScript through a harness that retries
+	// package manager commands and reports the result on the serial console
+	// with StartupScriptSuccessMatch or StartupScriptFailureMatch.
+	StartupScriptHarness bool `json:",omitempty"`
 	// RetryWhenExternalIPDenied indicates whether to retry CreateInstances when
 	// it fails due to external IP denied by organization IP.
 	RetryWhenExternalIPDenied bool `json:",omitempty"`
@@ -108,6 +112,14 @@ type InstanceBase struct {
 	OverWrite bool `json:",omitempty"`
 	// Serial port to log to GCS bucket, defaults to 1
 	SerialPortsToLog []int64 `json:",omitempty"`
+	// GuestAttributeHelpers enables guest attributes and adds shell and
+	// PowerShell helpers for reporting results to guest attributes to the
+	// instance metadata.
+	GuestAttributeHelpers bool `json:",omitempty"`
+	// OpsAgentLogHelpers adds a shell helper configuring the Ops Agent for
+	// OpsAgentLog signals to the instance metadata, see
+	// OpsAgentLogShellScript.
+	OpsAgentLogHelpers bool `json:",omitempty"`
 }
 
 // Instance is used to create a GCE instance using GA API.
@@ -355,8 +367,8 @@ func (ib *InstanceBase) populate(ctx context.Context, ii InstanceInterface, s *S
 	errs = addErrs(errs, ii.populateDisks(s.w))
 	errs = addErrs(errs, ib.populateMachineType(ii))
 	errs = addErrs(errs, ib.populateMetadata(ii, s.w))
-	errs = addErrs(errs, ii.populateNetworks())
-	errs = addErrs(errs, ii.populateScopes())
+	errs = addErrs(errs, ii.populateNetworks(s.env()))
+	errs = addErrs(errs, ii.populateScopes(s.env()))
 	ib.link = fmt.Sprintf("projects/%s/zones/%s/instances/%s", ib.Project, ii.getZone(), ii.getName())
 
 	if machineImageURLRgx.MatchString(ii.getSourceMachineImage()) {
@@ -509,8 +521,34 @@ func (ib *InstanceBase) populateMetadata(ii InstanceInterface, w *Workflow) DErr
 			return Errf("bad value for StartupScript, source not found: %s", ib.StartupScript)
 		}
 		ib.StartupScript = "gs://" + path.Join(w.bucket, w.sourcesPath, ib.StartupScript)
-		ii.getMetadata()["startup-script-url"] = ib.StartupScript
-		ii.getMetadata()["windows-startup-script-url"] = ib.StartupScript
+		if ib.StartupScriptHarness {
+			ii.getMetadata()[startupScriptURLMetadataKey] = ib.StartupScript
+			ii.getMetadata()["startup-script"] = startupScriptHarness()
+			ii.getMetadata()["windows-startup-script-ps1"] = windowsStartupScriptHarness()
+		} else {
+			ii.getMetadata()["startup-script-url"] = ib.StartupScript
+			ii.getMetadata()["windows-startup-script-url"] = ib.StartupScript
+		}
+	} else if ib.StartupScriptHarness {
+		return Errf("StartupScriptHarness is set but no StartupScript was given")
+	}
+	for _, k := range []string{"startup-script-url", "windows-startup-script-url", "shutdown-script-url", "windows-shutdown-script-url"} {
+		if v, ok := ii.getMetadata()[k]; ok {
+			staged, err := w.stageGCSInput(v)
+			if err != nil {
+				return err
+			}
+			ii.getMetadata()[k] = staged
+		}
+	}
+	if ib.GuestAttributeHelpers {
+		ii.getMetadata()["enable-guest-attributes"] = "TRUE"
+		gd := w.guestAttributeDefaults()
+		ii.getMetadata()[GuestAttributeShellMetadataKey] = guestAttributeShellScript(gd.Namespace, gd.KeyName)
+		ii.getMetadata()[GuestAttributePowerShellMetadataKey] = guestAttributePowerShellScript(gd.Namespace, gd.KeyName)
+	}
+	if ib.OpsAgentLogHelpers {
+		ii.getMetadata()[OpsAgentLogShellMetadataKey] = OpsAgentLogShellScript()
 	}
 	for k, v := range ii.getMetadata() {
 		vCopy := v
@@ -519,7 +557,7 @@ func (ib *InstanceBase) populateMetadata(ii InstanceInterface, w *Workflow) DErr
 	return nil
 }
 
-func (i *Instance) populateNetworks() DError {
+func (i *Instance) populateNetworks(env StepEnv) DError {
 	defaultAcs := []*compute.AccessConfig{{Type: defaultAccessConfigType}}
 
 	if i.NetworkInterfaces == nil {
@@ -531,6 +569,10 @@ func (i *Instance) populateNetworks() DError {
 		}
 
 		// Only set deafult if no subnetwork or network set.
+		if n.Subnetwork == "" && (n.Network == "" || env.replaceDefaultNetwork && isDefaultNetwork(n.Network)) {
+			n.Network = env.Network
+			n.Subnetwork = env.Subnetwork
+		}
 		if n.Subnetwork == "" {
 			n.Network = strOr(n.Network, "global/networks/default")
 		}
@@ -547,7 +589,7 @@ func (i *Instance) populateNetworks() DError {
 	return nil
 }
 
-func (i *InstanceBeta) populateNetworks() DError {
+func (i *InstanceBeta) populateNetworks(env StepEnv) DError {
 	defaultAcs := []*computeBeta.AccessConfig{{Type: defaultAccessConfigType}}
 
 	if i.NetworkInterfaces == nil {
@@ -559,6 +601,10 @@ func (i *InstanceBeta) populateNetworks() DError {
 		}
 
 		// Only set deafult if no subnetwork or network set.
+		if n.Subnetwork == "" && (n.Network == "" || env.replaceDefaultNetwork && isDefaultNetwork(n.Network)) {
+			n.Network = env.Network
+			n.Subnetwork = env.Subnetwork
+		}
 		if n.Subnetwork == "" {
 			n.Network = strOr(n.Network, "global/networks/default")
 		}
@@ -575,22 +621,22 @@ func (i *InstanceBeta) populateNetworks() DError {
 	return nil
 }
 
-func (i *Instance) populateScopes() DError {
+func (i *Instance) populateScopes(env StepEnv) DError {
 	if i.Scopes == nil {
 		i.Scopes = append(i.Scopes, "https://www.googleapis.com/auth/devstorage.read_only")
 	}
 	if i.ServiceAccounts == nil {
-		i.ServiceAccounts = []*compute.ServiceAccount{{Email: "default", Scopes: i.Scopes}}
+		i.ServiceAccounts = []*compute.ServiceAccount{{Email: strOr(env.ServiceAccount, "default"), Scopes: i.Scopes}}
 	}
 	return nil
 }
 
-func (i *InstanceBeta) populateScopes() DError {
+func (i *InstanceBeta) populateScopes(env StepEnv) DError {
 	if i.Scopes == nil {
 		i.Scopes = append(i.Scopes, "https://www.googleapis.com/auth/devstorage.read_only")
 	}
 	if i.ServiceAccounts == nil {
-		i.ServiceAccounts = []*computeBeta.ServiceAccount{{Email: "default", Scopes: i.Scopes}}
+		i.ServiceAccounts = []*computeBeta.ServiceAccount{{Email: strOr(env.ServiceAccount, "default"), Scopes: i.Scopes}}
 	}
 	return nil
 }
@@ -829,7 +875,7 @@ func (ir *instanceRegistry) deleteFn(res *Resource) DError {
 		}
 	}
 	// Proceed to instance deletion
-	err := ir.w.ComputeClient.DeleteInstance(m["project"], m["zone"], m["instance"])
+	err := ir.w.resourceClient(res).DeleteInstance(m["project"], m["zone"], m["instance"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete instance", err)
 	}
@@ -838,7 +884,7 @@ func (ir *instanceRegistry) deleteFn(res *Resource) DError {
 
 func (ir *instanceRegistry) startFn(res *Resource) DError {
 	m := NamedSubexp(instanceURLRgx, res.link)
-	err := ir.w.ComputeClient.StartInstance(m["project"], m["zone"], m["instance"])
+	err := ir.w.computeClient().StartInstance(m["project"], m["zone"], m["instance"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to start instance", err)
 	}
@@ -847,7 +893,7 @@ func (ir *instanceRegistry) startFn(res *Resource) DError {
 
 func (ir *instanceRegistry) stopFn(res *Resource) DError {
 	m := NamedSubexp(instanceURLRgx, res.link)
-	err := ir.w.ComputeClient.StopInstance(m["project"], m["zone"], m["instance"])
+	err := ir.w.computeClient().StopInstance(m["project"], m["zone"], m["instance"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to stop instance", err)
 	}
@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 
 	computeBeta "google.golang.org/api/compute/v0.beta"
@@ -265,15 +266,33 @@ func TestInstancePopulateMetadata(t *testing.T) {
 	}
 
 	tests := []struct {
-		desc          string
-		md            map[string]string
-		startupScript string
-		wantMd        map[string]string
-		shouldErr     bool
+		desc             string
+		md               map[string]string
+		startupScript    string
+		harness          bool
+		guestAttrHelpers bool
+		wantMd           map[string]string
+		// wantScripts are strings the scripts in wantMd must contain.
+		wantScripts map[string][]string
+		shouldErr   bool
 	}{
-		{"defaults case", nil, "", map[string]string{}, false},
-		{"startup script case", nil, "file", map[string]string{"startup-script-url": filePath, "windows-startup-script-url": filePath}, false},
-		{"bad startup script case", nil, "foo", nil, true},
+		{"defaults case", nil, "", false, false, map[string]string{}, nil, false},
+		{"startup script case", nil, "file", false, false, map[string]string{"startup-script-url": filePath, "windows-startup-script-url": filePath}, nil, false},
+		{"bad startup script case", nil, "foo", false, false, nil, nil, true},
+		{"startup script harness case", nil, "file", true, false, map[string]string{
+			startupScriptURLMetadataKey:  filePath,
+			"startup-script":             startupScriptHarness(),
+			"windows-startup-script-ps1": windowsStartupScriptHarness(),
+		}, map[string][]string{
+			"startup-script":             {"#!/bin/bash", startupScriptURLMetadataKey, StartupScriptSuccessMatch, StartupScriptFailureMatch, "apt-get() { daisy_retry apt-get", "seq 1 5", "\ndaisy_heartbeat\n", "\ndaisy_upload_artifacts\n", artifactsURLMetadataKey, artifactPathsMetadataKey},
+			"windows-startup-script-ps1": {startupScriptURLMetadataKey, StartupScriptSuccessMatch, StartupScriptFailureMatch, "\nStart-DaisyHeartbeat\n", "\nSend-DaisyArtifacts\n", artifactsURLMetadataKey, artifactPathsMetadataKey},
+		}, false},
+		{"startup script harness without startup script case", nil, "", true, false, nil, nil, true},
+		{"guest attribute helpers case", nil, "", false, true, map[string]string{
+			"enable-guest-attributes":           "TRUE",
+			GuestAttributeShellMetadataKey:      GuestAttributeShellScript(),
+			GuestAttributePowerShellMetadataKey: GuestAttributePowerShellScript(),
+		}, nil, false},
 	}
 	compFactory := func(items []*compute.MetadataItems) func(i, j int) bool {
 		return func(i, j int) bool { return items[i].Key < items[j].Key }
@@ -298,6 +317,18 @@ func TestInstancePopulateMetadata(t *testing.T) {
 	}
 
 	for _, tt := range tests {
+		for k, parts := range tt.wantScripts {
+			script := tt.wantMd[k]
+			// Scripts with ${} would be taken for unresolved workflow vars.
+			if strings.Contains(script, "${") {
+				t.Errorf("%s: metadata %q would be taken for an unresolved var: %q", tt.desc, k, script)
+			}
+			for _, want := range parts {
+				if !strings.Contains(script, want) {
+					t.Errorf("%s: metadata %q: script %q does not contain %q", tt.desc, k, script, want)
+				}
+			}
+		}
 		wantMd := getWantMd(tt.wantMd)
 		wantMdBeta := getWantMdBeta(tt.wantMd)
 		if tt.wantMd != nil {
@@ -305,12 +336,12 @@ func TestInstancePopulateMetadata(t *testing.T) {
 			sort.Slice(wantMdBeta.Items, compFactoryBeta(wantMdBeta.Items))
 		}
 
-		i := Instance{InstanceBase: InstanceBase{StartupScript: tt.startupScript}, Metadata: tt.md}
+		i := Instance{InstanceBase: InstanceBase{StartupScript: tt.startupScript, StartupScriptHarness: tt.harness, GuestAttributeHelpers: tt.guestAttrHelpers}, Metadata: tt.md}
 		err := (&i.InstanceBase).populateMetadata(&i, w)
 		sort.Slice(i.Instance.Metadata.Items, compFactory(i.Instance.Metadata.Items))
 		assertTest(tt.shouldErr, err, tt.desc, i.Instance.Metadata, wantMd)
 
-		iBeta := Instance{InstanceBase: InstanceBase{StartupScript: tt.startupScript}, Metadata: tt.md}
+		iBeta := Instance{InstanceBase: InstanceBase{StartupScript: tt.startupScript, StartupScriptHarness: tt.harness, GuestAttributeHelpers: tt.guestAttrHelpers}, Metadata: tt.md}
 		err = (&iBeta.InstanceBase).populateMetadata(&iBeta, w)
 		sort.Slice(iBeta.Instance.Metadata.Items, compFactory(iBeta.Instance.Metadata.Items))
 		assertTest(tt.shouldErr, err, tt.desc+" beta", iBeta.Instance.Metadata, wantMdBeta)
@@ -388,10 +419,10 @@ func TestInstancePopulateNetworks(t *testing.T) {
 
 	for _, tt := range tests {
 		i := &Instance{Instance: compute.Instance{NetworkInterfaces: tt.input}, InstanceBase: InstanceBase{Resource: Resource{Project: testProject}}}
-		assertTest(i.populateNetworks(), tt.desc, i.NetworkInterfaces, tt.want)
+		assertTest(i.populateNetworks(StepEnv{}), tt.desc, i.NetworkInterfaces, tt.want)
 
 		iBeta := &InstanceBeta{Instance: computeBeta.Instance{NetworkInterfaces: tt.inputBeta}, InstanceBase: InstanceBase{Resource: Resource{Project: testProject}}}
-		assertTest(iBeta.populateNetworks(), tt.desc, iBeta.NetworkInterfaces, tt.wantBeta)
+		assertTest(iBeta.populateNetworks(StepEnv{}), tt.desc, iBeta.NetworkInterfaces, tt.wantBeta)
 	}
 }
 
@@ -411,7 +442,7 @@ func TestInstancePopulateScopes(t *testing.T) {
 
 	for _, tt := range tests {
 		i := &Instance{InstanceBase: InstanceBase{Scopes: tt.input}, Instance: compute.Instance{ServiceAccounts: tt.inputSas}}
-		err := i.populateScopes()
+		err := i.populateScopes(StepEnv{})
 		if err == nil {
 			if tt.shouldErr {
 				t.Errorf("%s: should have returned an error", tt.desc)
@@ -423,7 +454,7 @@ func TestInstancePopulateScopes(t *testing.T) {
 		}
 
 		iBeta := &InstanceBeta{InstanceBase: InstanceBase{Scopes: tt.input}, Instance: computeBeta.Instance{ServiceAccounts: tt.inputSasBeta}}
-		err = iBeta.populateScopes()
+		err = iBeta.populateScopes(StepEnv{})
 		if err == nil {
 			if tt.shouldErr {
 				t.Errorf("%s: should have returned an error", tt.desc+" beta")
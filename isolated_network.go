@@ -0,0 +1,118 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	isolatedNetworkStep    = "isolated-network"
+	isolatedSubnetworkStep = "isolated-subnetwork"
+	isolatedFirewallStep   = "isolated-firewall"
+
+	// IsolatedNetworkName and IsolatedSubnetworkName are the names of the
+	// network and subnetwork created for IsolatedNetwork workflows, steps can
+	// refer to them like to any network created in the workflow.
+	IsolatedNetworkName    = "isolated-network"
+	IsolatedSubnetworkName = "isolated-subnetwork"
+	isolatedFirewallName   = "isolated-allow-internal"
+	isolatedNetworkRange   = "10.128.0.0/20"
+)
+
+// isDefaultNetwork reports whether network names the default network.
+func isDefaultNetwork(network string) bool {
+	if network == "default" {
+		return true
+	}
+	m := NamedSubexp(networkURLRegex, network)
+	return m != nil && m["network"] == "default"
+}
+
+// addIsolatedNetwork adds steps creating the network, subnetwork and
+// firewall rule of an IsolatedNetwork workflow, makes the other steps depend
+// on them, and makes instances use the subnetwork by default.
+func (w *Workflow) addIsolatedNetwork() DError {
+	for _, name := range []string{isolatedNetworkStep, isolatedSubnetworkStep, isolatedFirewallStep} {
+		if _, ok := w.Steps[name]; ok {
+			return Errf("IsolatedNetwork: step %q already exists", name)
+		}
+	}
+	var roots []string
+	for name := range w.Steps {
+		if len(w.Dependencies[name]) == 0 {
+			roots = append(roots, name)
+		}
+	}
+
+	autoCreate := false
+	network, _ := w.NewStep(isolatedNetworkStep)
+	network.CreateNetworks = &CreateNetworks{{
+		Network:               compute.Network{Name: IsolatedNetworkName},
+		AutoCreateSubnetworks: &autoCreate,
+	}}
+	subnetwork, _ := w.NewStep(isolatedSubnetworkStep)
+	subnetwork.CreateSubnetworks = &CreateSubnetworks{{
+		Subnetwork: compute.Subnetwork{Name: IsolatedSubnetworkName, Network: IsolatedNetworkName, IpCidrRange: isolatedNetworkRange},
+	}}
+	firewall, _ := w.NewStep(isolatedFirewallStep)
+	firewall.CreateFirewallRules = &CreateFirewallRules{{
+		Firewall: compute.Firewall{
+			Name:         isolatedFirewallName,
+			Network:      IsolatedNetworkName,
+			SourceRanges: []string{isolatedNetworkRange},
+			Allowed:      []*compute.FirewallAllowed{{IPProtocol: "tcp"}, {IPProtocol: "udp"}, {IPProtocol: "icmp"}},
+		},
+	}}
+	w.AddDependency(subnetwork, network)
+	w.AddDependency(firewall, network)
+	for _, name := range roots {
+		w.Dependencies[name] = []string{isolatedSubnetworkStep, isolatedFirewallStep}
+	}
+
+	w.env.Network = IsolatedNetworkName
+	w.env.Subnetwork = IsolatedSubnetworkName
+	w.env.replaceDefaultNetwork = true
+	return nil
+}
+
+// registerIsolatedNetwork registers the isolated network and subnetwork of
+// the parent of w in the registries of w, a SubWorkflow whose instances use
+// them by default, as resources w uses but does not create or delete.
+func (w *Workflow) registerIsolatedNetwork() {
+	p := w.parent
+	if p == nil || p.networks == w.networks || w.env.Network != IsolatedNetworkName {
+		return
+	}
+	for _, r := range []struct {
+		parent, child *baseResourceRegistry
+		name          string
+	}{
+		{&p.networks.baseResourceRegistry, &w.networks.baseResourceRegistry, IsolatedNetworkName},
+		{&p.subnetworks.baseResourceRegistry, &w.subnetworks.baseResourceRegistry, IsolatedSubnetworkName},
+	} {
+		r.parent.mx.Lock()
+		res, ok := r.parent.m[r.name]
+		r.parent.mx.Unlock()
+		if !ok {
+			continue
+		}
+		r.child.mx.Lock()
+		if _, ok := r.child.m[r.name]; !ok {
+			r.child.m[r.name] = &Resource{Project: res.Project, RealName: res.RealName, link: res.link, NoCleanup: true, daisyName: r.name, external: true}
+		}
+		r.child.mx.Unlock()
+	}
+}
@@ -0,0 +1,119 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestIsolatedNetwork(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.IsolatedNetwork = true
+	w.Steps = map[string]*Step{
+		"create": {CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{
+			Name: "i",
+			NetworkInterfaces: []*compute.NetworkInterface{
+				{},
+				{Network: "global/networks/default"},
+				{Network: "other"},
+			},
+		}}}}},
+		"delete": {DeleteResources: &DeleteResources{Instances: []string{"i"}}},
+	}
+	w.Dependencies = map[string][]string{"delete": {"create"}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{isolatedNetworkStep, isolatedSubnetworkStep, isolatedFirewallStep} {
+		if _, ok := w.Steps[name]; !ok {
+			t.Errorf("step %q not added", name)
+		}
+	}
+	deps := w.Dependencies["create"]
+	sort.Strings(deps)
+	if want := []string{isolatedFirewallStep, isolatedSubnetworkStep}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("got dependencies %q, want %q", deps, want)
+	}
+	if want := []string{"create"}; !reflect.DeepEqual(w.Dependencies["delete"], want) {
+		t.Errorf("got dependencies %q, want %q", w.Dependencies["delete"], want)
+	}
+
+	nics := w.Steps["create"].CreateInstances.Instances[0].NetworkInterfaces
+	for i, want := range []string{IsolatedSubnetworkName, IsolatedSubnetworkName, ""} {
+		if nics[i].Subnetwork != want {
+			t.Errorf("network interface %d: got subnetwork %q, want %q", i, nics[i].Subnetwork, want)
+		}
+	}
+	if nics[2].Network != "other" {
+		t.Errorf("network interface 2: got network %q, want %q", nics[2].Network, "other")
+	}
+
+	w = testWorkflow()
+	w.IsolatedNetwork = true
+	w.Steps = map[string]*Step{isolatedNetworkStep: {WaitForInstancesSignal: &WaitForInstancesSignal{}}}
+	if err := w.populate(ctx); err == nil {
+		t.Error("expected error for conflicting step name")
+	}
+}
+
+func TestIsolatedNetworkSubWorkflow(t *testing.T) {
+	ctx := context.Background()
+	sw := New()
+	sw.Steps = map[string]*Step{
+		"create": {CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{
+			Name:              "i",
+			MachineType:       testMachineType,
+			Disks:             []*compute.AttachedDisk{{Boot: true, InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: fmt.Sprintf("projects/%s/global/images/%s", testProject, testImage)}}},
+			NetworkInterfaces: []*compute.NetworkInterface{{}},
+		}}}}},
+	}
+	w := testWorkflow()
+	w.IsolatedNetwork = true
+	w.Steps = map[string]*Step{"sub": {SubWorkflow: &SubWorkflow{Workflow: sw}}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.validate(ctx); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	for _, r := range []*baseResourceRegistry{&sw.networks.baseResourceRegistry, &sw.subnetworks.baseResourceRegistry} {
+		name := IsolatedNetworkName
+		parent := w.networks.m
+		if r.typeName == "subnetwork" {
+			name = IsolatedSubnetworkName
+			parent = w.subnetworks.m
+		}
+		res, ok := r.m[name]
+		if !ok {
+			t.Errorf("%s %q not registered in the SubWorkflow", r.typeName, name)
+			continue
+		}
+		if res.link != parent[name].link || !res.NoCleanup || res.creator != nil {
+			t.Errorf("%s %q: unexpected SubWorkflow resource %+v", r.typeName, name, res)
+		}
+	}
+	if got := sw.Steps["create"].CreateInstances.Instances[0].NetworkInterfaces[0].Subnetwork; got != IsolatedSubnetworkName {
+		t.Errorf("got subnetwork %q, want %q", got, IsolatedSubnetworkName)
+	}
+}
@@ -0,0 +1,76 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// KMSClient signs with Cloud KMS asymmetric keys.
+type KMSClient interface {
+	// GetPublicKey returns the public key of the crypto key version name.
+	GetPublicKey(name string) (*cloudkms.PublicKey, error)
+	// AsymmetricSign signs a digest with the crypto key version name.
+	AsymmetricSign(name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error)
+}
+
+type kmsClient struct {
+	opts []option.ClientOption
+
+	mx  sync.Mutex
+	svc *cloudkms.Service
+}
+
+// NewKMSClient creates a KMSClient using the Cloud KMS API. The service is
+// created on first use, so that workflows not signing anything do not need
+// access to the API.
+func NewKMSClient(opts ...option.ClientOption) KMSClient {
+	return &kmsClient{opts: opts}
+}
+
+func (c *kmsClient) service() (*cloudkms.Service, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.svc == nil {
+		svc, err := cloudkms.NewService(context.Background(), c.opts...)
+		if err != nil {
+			return nil, err
+		}
+		c.svc = svc
+	}
+	return c.svc, nil
+}
+
+// GetPublicKey returns the public key of the crypto key version name.
+func (c *kmsClient) GetPublicKey(name string) (*cloudkms.PublicKey, error) {
+	svc, err := c.service()
+	if err != nil {
+		return nil, err
+	}
+	return svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(name).Do()
+}
+
+// AsymmetricSign signs a digest with the crypto key version name.
+func (c *kmsClient) AsymmetricSign(name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error) {
+	svc, err := c.service()
+	if err != nil {
+		return nil, err
+	}
+	return svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(name, req).Do()
+}
@@ -0,0 +1,78 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"sort"
+	"strings"
+)
+
+// addWorkflowLabels adds the Labels of w and of its nested workflows to the
+// resources each of them creates. A resource setting a label to another value
+// is an error.
+func (w *Workflow) addWorkflowLabels() DError {
+	var errs DError
+	keys := make([]string, 0, len(w.Labels))
+	for k, v := range w.Labels {
+		if !labelKeyRgx.MatchString(k) {
+			errs = addErrs(errs, Errf("invalid label key %q", k))
+		} else if !labelValueRgx.MatchString(v) {
+			errs = addErrs(errs, Errf("invalid value %q of label %q", v, k))
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if errs == nil && len(keys) > 0 {
+		for _, t := range w.labelTargets() {
+			for _, k := range keys {
+				if old, ok := (*t.labels)[k]; ok && old != w.Labels[k] {
+					errs = addErrs(errs, Errf("%s sets label %s=%s, workflow %q sets %s=%s", t.name, k, old, w.Name, k, w.Labels[k]))
+					continue
+				}
+				if *t.labels == nil {
+					*t.labels = map[string]string{}
+				}
+				(*t.labels)[k] = w.Labels[k]
+			}
+		}
+	}
+	for _, s := range w.Steps {
+		if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow != nil {
+			errs = addErrs(errs, s.IncludeWorkflow.Workflow.addWorkflowLabels())
+		}
+		if s.SubWorkflow != nil && s.SubWorkflow.Workflow != nil {
+			errs = addErrs(errs, s.SubWorkflow.Workflow.addWorkflowLabels())
+		}
+	}
+	return errs
+}
+
+// checkRequiredLabels checks that every resource w and its nested workflows
+// create has the RequiredLabels.
+func (w *Workflow) checkRequiredLabels() DError {
+	var errs DError
+	for _, t := range w.labelTargets() {
+		var missing []string
+		for _, k := range w.RequiredLabels {
+			if _, ok := (*t.labels)[k]; !ok {
+				missing = append(missing, k)
+			}
+		}
+		if len(missing) > 0 {
+			errs = addErrs(errs, Errf("%s is missing required labels %s", t.name, strings.Join(missing, ", ")))
+		}
+	}
+	return errs
+}
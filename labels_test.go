@@ -0,0 +1,103 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"sort"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// labelsTestWorkflow returns a workflow creating an instance with a boot disk
+// and including a workflow creating an image.
+func labelsTestWorkflow() (w *Workflow, i *Instance, img *Image) {
+	w = testWorkflow()
+	child := testWorkflow()
+	child.Name = "child"
+	img = &Image{Image: compute.Image{Name: "img"}}
+	child.Steps = map[string]*Step{
+		"create-image": {name: "create-image", w: child, CreateImages: &CreateImages{Images: []*Image{img}}},
+	}
+	i = &Instance{Instance: compute.Instance{Name: "vm", Disks: []*compute.AttachedDisk{
+		{InitializeParams: &compute.AttachedDiskInitializeParams{DiskName: "vm-boot", Labels: map[string]string{"os": "debian"}}},
+	}}}
+	w.Steps = map[string]*Step{
+		"create-vm": {name: "create-vm", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i}}},
+		"include":   {name: "include", w: w, IncludeWorkflow: &IncludeWorkflow{Workflow: child}},
+	}
+	child.parent = w
+	return w, i, img
+}
+
+func TestAddWorkflowLabels(t *testing.T) {
+	w, i, img := labelsTestWorkflow()
+	w.Labels = map[string]string{"cost-center": "cc-123"}
+	w.Steps["include"].IncludeWorkflow.Workflow.Labels = map[string]string{"team": "images"}
+	if err := w.addWorkflowLabels(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		what      string
+		got, want map[string]string
+	}{
+		{"instance", i.Labels, map[string]string{"cost-center": "cc-123"}},
+		{"boot disk", i.Disks[0].InitializeParams.Labels, map[string]string{"cost-center": "cc-123", "os": "debian"}},
+		{"image", img.Labels, map[string]string{"cost-center": "cc-123", "team": "images"}},
+	} {
+		if diffRes := diff(tt.got, tt.want, 0); diffRes != "" {
+			t.Errorf("%s: labels not as expected: (-got,+want)\n%s", tt.what, diffRes)
+		}
+	}
+
+	for _, labels := range []map[string]string{
+		{"os": "windows"},
+		{"Bad": "v"},
+		{"k": "Bad"},
+	} {
+		w, _, _ := labelsTestWorkflow()
+		w.Labels = labels
+		if err := w.addWorkflowLabels(); err == nil {
+			t.Errorf("expected error adding %v", labels)
+		}
+	}
+}
+
+func TestCheckRequiredLabels(t *testing.T) {
+	w, i, img := labelsTestWorkflow()
+	w.RequiredLabels = []string{"cost-center", "team"}
+	i.Labels = map[string]string{"cost-center": "cc-123", "team": "images"}
+	img.Labels = map[string]string{"team": "images"}
+
+	err := w.checkRequiredLabels()
+	if err == nil {
+		t.Fatal("expected error for missing labels")
+	}
+	var got []string
+	for _, e := range err.errors() {
+		got = append(got, e.Error())
+	}
+	want := []string{`disk "vm-boot" is missing required labels cost-center, team`, `image "img" is missing required labels cost-center`}
+	sort.Strings(got)
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("errors not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	i.Disks[0].InitializeParams.Labels = map[string]string{"cost-center": "cc-123", "team": "images"}
+	img.Labels["cost-center"] = "cc-123"
+	if err := w.checkRequiredLabels(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -60,7 +60,7 @@ func (w *Workflow) createLogger(ctx context.Context) {
 	l := newDaisyLogger(!w.stdoutLoggingDisabled)
 
 	if !w.gcsLoggingDisabled {
-		gcsLogger := NewGCSLogger(ctx, w.StorageClient, w.bucket, path.Join(w.logsPath, "daisy.log"))
+		gcsLogger := &GCSLogger{storage: w.storage(), bucket: w.bucket, object: path.Join(w.logsPath, "daisy.log"), ctx: ctx}
 		l.gcsLogWriter = &syncedWriter{buf: bufio.NewWriter(gcsLogger)}
 		periodicFlush(func() { l.gcsLogWriter.Flush() })
 	}
@@ -128,6 +128,7 @@ func (w *Workflow) logEntry(e *LogEntry) {
 		}
 		rw = rw.parent
 	}
+	e.Message = w.redact(e.Message)
 
 	w.Logger.WriteLogEntry(e)
 }
@@ -249,7 +250,7 @@ func (l *syncedWriter) Flush() error {
 
 // GCSLogger is a logger that writes to a GCS object.
 type GCSLogger struct {
-	client         *storage.Client
+	storage        Storage
 	bucket, object string
 	buf            *bytes.Buffer
 	ctx            context.Context
@@ -257,7 +258,7 @@ type GCSLogger struct {
 
 // NewGCSLogger creates a new GCSLogger.
 func NewGCSLogger(ctx context.Context, client *storage.Client, bucket, object string) *GCSLogger {
-	return &GCSLogger{client: client, bucket: bucket, object: object, ctx: ctx}
+	return &GCSLogger{storage: NewGCSStorage(client), bucket: bucket, object: object, ctx: ctx}
 }
 
 func (l *GCSLogger) Write(b []byte) (int, error) {
@@ -265,12 +266,7 @@ func (l *GCSLogger) Write(b []byte) (int, error) {
 		l.buf = new(bytes.Buffer)
 	}
 	l.buf.Write(b)
-	wc := l.client.Bucket(l.bucket).Object(l.object).NewWriter(l.ctx)
-	wc.ContentType = "text/plain"
-	if _, err := wc.Write(l.buf.Bytes()); err != nil {
-		return 0, err
-	}
-	if err := wc.Close(); err != nil {
+	if err := l.storage.Put(l.ctx, l.bucket, l.object, "text/plain", bytes.NewReader(l.buf.Bytes())); err != nil {
 		return 0, err
 	}
 	return len(b), nil
@@ -102,7 +102,7 @@ func newMachineImageRegistry(w *Workflow) *machineImageRegistry {
 
 func (ir *machineImageRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(machineImageURLRgx, res.link)
-	err := ir.w.ComputeClient.DeleteMachineImage(m["project"], m["machineImage"])
+	err := ir.w.resourceClient(res).DeleteMachineImage(m["project"], m["machineImage"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete machine image", err)
 	}
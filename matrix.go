@@ -0,0 +1,178 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matrix expands a workflow template into a run for every combination of
+// its values, e.g. every OS, zone and machine type an image is built for.
+type Matrix struct {
+	// Zones the workflow runs in. Empty keeps the zone of the workflow.
+	Zones []string `json:",omitempty"`
+	// Vars maps workflow vars to the values they take.
+	Vars map[string][]string `json:",omitempty"`
+}
+
+// MatrixRun is a run of a Matrix.
+type MatrixRun struct {
+	// Zone and Vars are the values of the run.
+	Zone string
+	Vars map[string]string
+	// Workflow is the workflow of the run.
+	Workflow *Workflow
+	// Err is the error of the run, nil if it succeeded or did not run yet.
+	Err DError
+}
+
+// Label describes the values of r, e.g. "zone=us-central1-a, os=debian-11".
+func (r *MatrixRun) Label() string {
+	var l []string
+	if r.Zone != "" {
+		l = append(l, "zone="+r.Zone)
+	}
+	var vars []string
+	for k, v := range r.Vars {
+		vars = append(vars, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(vars)
+	return strings.Join(append(l, vars...), ", ")
+}
+
+// MatrixReport holds the runs of a Matrix, in the order of Matrix.Expand.
+type MatrixReport struct {
+	Runs []*MatrixRun
+}
+
+// Failed returns the runs that failed.
+func (r *MatrixReport) Failed() []*MatrixRun {
+	var failed []*MatrixRun
+	for _, run := range r.Runs {
+		if run.Err != nil {
+			failed = append(failed, run)
+		}
+	}
+	return failed
+}
+
+// LoadMatrix reads a Matrix from a JSON or YAML file. Files with a .yaml or
+// .yml extension are read as YAML, others as JSON.
+func LoadMatrix(file string) (*Matrix, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matrix file %q: %v", file, err)
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse matrix file %q: %v", file, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse matrix file %q: %v", file, err)
+		}
+	}
+	m := &Matrix{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, JSONError(file, data, err)
+	}
+	return m, nil
+}
+
+// Expand creates the runs of m, one for every combination of its zones and
+// var values, with workflows created by newWorkflow and their zone and vars
+// set. Zones vary slowest, then vars in the order of their names. All the
+// vars of m must be declared by the workflows.
+func (m *Matrix) Expand(newWorkflow func() (*Workflow, error)) ([]*MatrixRun, error) {
+	var names []string
+	for k, vs := range m.Vars {
+		if len(vs) == 0 {
+			return nil, fmt.Errorf("matrix Var %q has no values", k)
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	zones := m.Zones
+	if len(zones) == 0 {
+		zones = []string{""}
+	}
+
+	var runs []*MatrixRun
+	for _, z := range zones {
+		combos := []map[string]string{{}}
+		for _, k := range names {
+			var next []map[string]string
+			for _, c := range combos {
+				for _, v := range m.Vars[k] {
+					nc := map[string]string{k: v}
+					for ck, cv := range c {
+						nc[ck] = cv
+					}
+					next = append(next, nc)
+				}
+			}
+			combos = next
+		}
+		for _, c := range combos {
+			run := &MatrixRun{Zone: z, Vars: c}
+			w, err := newWorkflow()
+			if err != nil {
+				return nil, fmt.Errorf("error creating workflow for %s: %v", run.Label(), err)
+			}
+			for k, v := range c {
+				if _, ok := w.Vars[k]; !ok {
+					return nil, fmt.Errorf("unknown workflow Var %q in matrix of Workflow %q", k, w.Name)
+				}
+				w.AddVar(k, v)
+			}
+			if z != "" {
+				w.Zone = z
+			}
+			run.Workflow = w
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// RunMatrix expands m with newWorkflow and runs the workflows within the
+// budget of r. The error is that of the expansion, the errors of the runs
+// are in the report.
+func (r *Runner) RunMatrix(ctx context.Context, m *Matrix, newWorkflow func() (*Workflow, error)) (*MatrixReport, error) {
+	runs, err := m.Expand(newWorkflow)
+	if err != nil {
+		return nil, err
+	}
+	ws := make([]*Workflow, len(runs))
+	for i, run := range runs {
+		ws[i] = run.Workflow
+	}
+	for i, err := range r.Run(ctx, ws...) {
+		runs[i].Err = err
+	}
+	return &MatrixReport{Runs: runs}, nil
+}
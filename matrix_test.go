@@ -0,0 +1,138 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMatrix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	want := &Matrix{Zones: []string{"us-central1-a", "europe-west1-b"}, Vars: map[string][]string{"os": {"debian-11", "rhel-8"}}}
+
+	tests := []struct {
+		file, data string
+		wantErr    bool
+	}{
+		{"matrix.json", `{"Zones": ["us-central1-a", "europe-west1-b"], "Vars": {"os": ["debian-11", "rhel-8"]}}`, false},
+		{"matrix.yaml", "Zones: [us-central1-a, europe-west1-b]\nVars:\n  os:\n  - debian-11\n  - rhel-8\n", false},
+		{"unknown.json", `{"Zone": ["us-central1-a"]}`, true},
+		{"scalar.yml", "Vars:\n  os: debian-11\n", true},
+	}
+	for _, tt := range tests {
+		f := filepath.Join(dir, tt.file)
+		if err := ioutil.WriteFile(f, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadMatrix(f)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.file, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if diffRes := diff(got, want, 0); diffRes != "" {
+			t.Errorf("%s: matrix not as expected: (-got +want)\n%s", tt.file, diffRes)
+		}
+	}
+}
+
+func TestMatrixExpand(t *testing.T) {
+	newWorkflow := func() (*Workflow, error) {
+		w := testWorkflow()
+		w.Vars = map[string]Var{"os": {}, "machine_type": {Value: "n1-standard-1"}}
+		return w, nil
+	}
+	m := &Matrix{Zones: []string{"z1", "z2"}, Vars: map[string][]string{"os": {"debian", "rhel"}, "machine_type": {"n2"}}}
+	runs, err := m.Expand(newWorkflow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, r := range runs {
+		if r.Workflow.Zone != r.Zone || r.Workflow.Vars["os"].Value != r.Vars["os"] {
+			t.Errorf("%s: workflow has zone %q and os %q", r.Label(), r.Workflow.Zone, r.Workflow.Vars["os"].Value)
+		}
+		got = append(got, r.Label())
+	}
+	want := []string{
+		"zone=z1, machine_type=n2, os=debian",
+		"zone=z1, machine_type=n2, os=rhel",
+		"zone=z2, machine_type=n2, os=debian",
+		"zone=z2, machine_type=n2, os=rhel",
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("runs not as expected: (-got +want)\n%s", diffRes)
+	}
+
+	tests := []struct {
+		desc        string
+		m           *Matrix
+		newWorkflow func() (*Workflow, error)
+	}{
+		{"no values case", &Matrix{Vars: map[string][]string{"os": {}}}, newWorkflow},
+		{"undeclared var case", &Matrix{Vars: map[string][]string{"arch": {"arm64"}}}, newWorkflow},
+		{"workflow error case", &Matrix{Zones: []string{"z1"}}, func() (*Workflow, error) { return nil, errors.New("error") }},
+	}
+	for _, tt := range tests {
+		if _, err := tt.m.Expand(tt.newWorkflow); err == nil {
+			t.Errorf("%s: expected error", tt.desc)
+		}
+	}
+}
+
+func TestRunnerRunMatrix(t *testing.T) {
+	ctx := context.Background()
+	mockRun := func(int) func(context.Context, *Step) DError {
+		return func(_ context.Context, s *Step) DError {
+			if s.w.Vars["os"].Value == "bad" {
+				return Errf("failure")
+			}
+			return nil
+		}
+	}
+	newWorkflow := func() (*Workflow, error) {
+		w := testTraverseWorkflow(mockRun)
+		w.Vars = map[string]Var{"os": {}}
+		return w, nil
+	}
+
+	r := &Runner{MaxCPUs: 8}
+	report, err := r.RunMatrix(ctx, &Matrix{Vars: map[string][]string{"os": {"good", "bad"}}}, newWorkflow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(report.Runs))
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Label() != "os=bad" {
+		t.Errorf("unexpected failed runs: %v", failed)
+	}
+
+	if _, err := r.RunMatrix(ctx, &Matrix{Vars: map[string][]string{"arch": {"arm64"}}}, newWorkflow); err == nil {
+		t.Error("expected error for an undeclared var")
+	}
+}
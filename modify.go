@@ -0,0 +1,366 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	labelKeyRgx   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValueRgx = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// PostValidateModifier changes a workflow after it is validated and before
+// it runs. The changes must be made through m, which only offers changes
+// that keep the workflow valid.
+type PostValidateModifier func(m *Modifier) error
+
+// Modifier changes a validated workflow for the PostValidateModifiers given
+// to RunWithModifiers.
+type Modifier struct {
+	w *Workflow
+}
+
+// applyModifiers calls modifiers on w, checking that they did not change the
+// steps or dependencies of w.
+func (w *Workflow) applyModifiers(modifiers []PostValidateModifier) DError {
+	if len(modifiers) == 0 {
+		return nil
+	}
+	shape := w.shape()
+	m := &Modifier{w: w}
+	for _, mod := range modifiers {
+		if err := mod(m); err != nil {
+			return Errf("modifier failed: %v", err)
+		}
+	}
+	if w.shape() != shape {
+		return Errf("steps or dependencies of workflow %q were modified after validation", w.Name)
+	}
+	return nil
+}
+
+// shape describes the steps of w and of its nested workflows, and their
+// dependencies.
+func (w *Workflow) shape() string {
+	var names []string
+	for n := range w.Steps {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		s := w.Steps[n]
+		fmt.Fprintf(&b, "%s%q;", n, w.Dependencies[n])
+		if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow != nil {
+			fmt.Fprintf(&b, "{%s}", s.IncludeWorkflow.Workflow.shape())
+		}
+		if s.SubWorkflow != nil && s.SubWorkflow.Workflow != nil {
+			fmt.Fprintf(&b, "{%s}", s.SubWorkflow.Workflow.shape())
+		}
+	}
+	return b.String()
+}
+
+// SetVar sets var name to value, replacing its previous value in the step
+// fields that referenced the var before substitution, not in the steps of
+// nested workflows. As the workflow is not validated again, the var must not
+// name resources, the project or the zone; use it for values such as metadata
+// or descriptions. A field changed by its step after the substitution is an
+// error, and then nothing is changed.
+func (m *Modifier) SetVar(name, value string) error {
+	w := m.w
+	v, ok := w.Vars[name]
+	if !ok {
+		return fmt.Errorf("unknown var %q", name)
+	}
+	if v.Value == "" {
+		return fmt.Errorf("var %q has no value to replace", name)
+	}
+	if strings.Contains(w.Project, v.Value) || strings.Contains(w.Zone, v.Value) {
+		return fmt.Errorf("var %q is used in the project or zone", name)
+	}
+	for _, r := range w.resourceRegistries() {
+		for daisyName, res := range r.m {
+			if strings.Contains(daisyName, v.Value) || strings.Contains(res.RealName, v.Value) {
+				return fmt.Errorf("var %q is used in the name of %s %q", name, r.typeName, daisyName)
+			}
+		}
+	}
+
+	ref := fmt.Sprintf("${%s}", name)
+	current := w.varReplacer("", "")
+	updated := w.varReplacer(name, value)
+	var uses []varUse
+	for _, u := range w.varUses {
+		if !strings.Contains(u.template, ref) && !strings.Contains(u.key, ref) {
+			continue
+		}
+		if strings.Contains(u.key, ref) {
+			return fmt.Errorf("var %q is used in the map key %q", name, u.key)
+		}
+		if u.get(current) != current.Replace(u.template) {
+			return fmt.Errorf("var %q is used in %q, which was changed after substitution", name, u.template)
+		}
+		uses = append(uses, u)
+	}
+	for _, u := range uses {
+		u.set(current, updated.Replace(u.template))
+	}
+	w.setVarValue(name, value)
+	return nil
+}
+
+// varUse is a string of a step that referenced vars before substitution:
+// either a string field or the value at key of a map of strings.
+type varUse struct {
+	template string
+	field    reflect.Value
+	m        reflect.Value
+	key      string
+}
+
+func (u varUse) get(r *strings.Replacer) string {
+	if u.field.IsValid() {
+		return u.field.String()
+	}
+	v := u.m.MapIndex(reflect.ValueOf(r.Replace(u.key)).Convert(u.m.Type().Key()))
+	if !v.IsValid() {
+		return ""
+	}
+	return v.String()
+}
+
+func (u varUse) set(r *strings.Replacer, s string) {
+	if u.field.IsValid() {
+		u.field.SetString(s)
+		return
+	}
+	key := reflect.ValueOf(r.Replace(u.key)).Convert(u.m.Type().Key())
+	u.m.SetMapIndex(key, reflect.ValueOf(s).Convert(u.m.Type().Elem()))
+}
+
+// varReplacer returns a replacer of the autovars and vars of w, with var name
+// set to value if name is not empty.
+func (w *Workflow) varReplacer(name, value string) *strings.Replacer {
+	var replacements []string
+	for k, v := range w.autovars {
+		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
+	}
+	for k, v := range w.Vars {
+		if k == name {
+			replacements = append(replacements, fmt.Sprintf("${%s}", k), value)
+			continue
+		}
+		replacements = append(replacements, fmt.Sprintf("${%s}", k), v.Value)
+	}
+	return strings.NewReplacer(replacements...)
+}
+
+// recordVarUses records the strings of the steps of w that reference vars,
+// before they are substituted, for Modifier.SetVar.
+func (w *Workflow) recordVarUses() {
+	w.varUses = nil
+	for _, s := range w.Steps {
+		w.recordVarUsesIn(reflect.ValueOf(s).Elem())
+	}
+}
+
+func (w *Workflow) recordVarUsesIn(v reflect.Value) {
+	if !v.CanSet() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		if _, ok := v.Interface().(*Workflow); ok {
+			return
+		}
+		w.recordVarUsesIn(v.Elem())
+	case reflect.String:
+		if hasVariableDeclaration(v.String()) {
+			w.varUses = append(w.varUses, varUse{template: v.String(), field: v})
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			w.recordVarUsesIn(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			w.recordVarUsesIn(v.Field(i))
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			k, e := iter.Key().String(), iter.Value()
+			switch e.Kind() {
+			case reflect.String:
+				if hasVariableDeclaration(k) || hasVariableDeclaration(e.String()) {
+					w.varUses = append(w.varUses, varUse{template: e.String(), m: v, key: k})
+				}
+			case reflect.Ptr:
+				if !e.IsNil() {
+					w.recordVarUsesIn(e.Elem())
+				}
+			}
+		}
+	}
+}
+
+// SetStepTimeout sets the timeout of step name of the workflow.
+func (m *Modifier) SetStepTimeout(name string, timeout time.Duration) error {
+	s, ok := m.w.Steps[name]
+	if !ok {
+		return fmt.Errorf("unknown step %q", name)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("timeout of step %q must be positive: %s", name, timeout)
+	}
+	s.Timeout = timeout.String()
+	s.timeout = timeout
+	return nil
+}
+
+// AddLabels adds labels to the disks, forwarding rules, images, instances and
+// snapshots the workflow and its nested workflows create. A label a resource
+// already has with another value is an error, and then no label is added.
+func (m *Modifier) AddLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !labelKeyRgx.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if !labelValueRgx.MatchString(v) {
+			return fmt.Errorf("invalid value %q of label %q", v, k)
+		}
+	}
+	targets := m.w.labelTargets()
+	for _, t := range targets {
+		for k, v := range labels {
+			if old, ok := (*t.labels)[k]; ok && old != v {
+				return fmt.Errorf("%s already has label %s=%s", t.name, k, old)
+			}
+		}
+	}
+	for _, t := range targets {
+		if *t.labels == nil {
+			*t.labels = map[string]string{}
+		}
+		for k, v := range labels {
+			(*t.labels)[k] = v
+		}
+	}
+	return nil
+}
+
+// labelTarget is the labels of a resource created by a workflow.
+type labelTarget struct {
+	name   string
+	labels *map[string]string
+}
+
+// labelTargets returns the labels of the resources created by w and its
+// nested workflows.
+func (w *Workflow) labelTargets() []labelTarget {
+	var ts []labelTarget
+	add := func(kind, name string, labels *map[string]string) {
+		ts = append(ts, labelTarget{fmt.Sprintf("%s %q", kind, name), labels})
+	}
+	for _, s := range w.Steps {
+		if s.CreateDisks != nil {
+			for _, d := range *s.CreateDisks {
+				add("disk", d.Name, &d.Labels)
+			}
+		}
+		if s.CreateImages != nil {
+			for _, i := range s.CreateImages.Images {
+				add("image", i.Name, &i.Labels)
+			}
+			for _, i := range s.CreateImages.ImagesBeta {
+				add("image", i.Name, &i.Labels)
+			}
+			for _, i := range s.CreateImages.ImagesAlpha {
+				add("image", i.Name, &i.Labels)
+			}
+		}
+		if s.CreateInstances != nil {
+			for _, i := range s.CreateInstances.Instances {
+				add("instance", i.Name, &i.Labels)
+				for _, d := range i.Disks {
+					if d.InitializeParams != nil && NamedSubexp(diskTypeURLRgx, d.InitializeParams.DiskType)["disktype"] != "local-ssd" {
+						add("disk", d.InitializeParams.DiskName, &d.InitializeParams.Labels)
+					}
+				}
+			}
+			for _, i := range s.CreateInstances.InstancesBeta {
+				add("instance", i.Name, &i.Labels)
+				for _, d := range i.Disks {
+					if d.InitializeParams != nil && NamedSubexp(diskTypeURLRgx, d.InitializeParams.DiskType)["disktype"] != "local-ssd" {
+						add("disk", d.InitializeParams.DiskName, &d.InitializeParams.Labels)
+					}
+				}
+			}
+		}
+		if s.ImportDisk != nil {
+			add("disk", s.ImportDisk.Disk.Name, &s.ImportDisk.Disk.Labels)
+		}
+		if s.CloneInstance != nil {
+			add("instance", s.CloneInstance.Instance.Name, &s.CloneInstance.Instance.Labels)
+		}
+		if s.CreateForwardingRules != nil {
+			for _, fr := range *s.CreateForwardingRules {
+				add("forwarding rule", fr.Name, &fr.Labels)
+			}
+		}
+		if s.CreateSnapshots != nil {
+			for _, ss := range *s.CreateSnapshots {
+				add("snapshot", ss.Name, &ss.Labels)
+			}
+		}
+		if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow != nil {
+			ts = append(ts, s.IncludeWorkflow.Workflow.labelTargets()...)
+		}
+		if s.SubWorkflow != nil && s.SubWorkflow.Workflow != nil {
+			ts = append(ts, s.SubWorkflow.Workflow.labelTargets()...)
+		}
+	}
+	return ts
+}
+
+// resourceRegistries returns the registries of the GCE resources of w.
+func (w *Workflow) resourceRegistries() []*baseResourceRegistry {
+	return []*baseResourceRegistry{
+		&w.disks.baseResourceRegistry,
+		&w.forwardingRules.baseResourceRegistry,
+		&w.firewallRules.baseResourceRegistry,
+		&w.images.baseResourceRegistry,
+		&w.machineImages.baseResourceRegistry,
+		&w.instances.baseResourceRegistry,
+		&w.networks.baseResourceRegistry,
+		&w.subnetworks.baseResourceRegistry,
+		&w.targetInstances.baseResourceRegistry,
+		&w.snapshots.baseResourceRegistry,
+	}
+}
@@ -0,0 +1,175 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// modifyTestWorkflow returns a workflow with var v set to "value", step a and
+// step disks, creating disk "d" described by v and depending on a. The vars
+// of the steps are substituted as by populate.
+func modifyTestWorkflow() *Workflow {
+	w := testWorkflow()
+	w.Vars = map[string]Var{"v": {Value: "value"}}
+	w.Steps = map[string]*Step{
+		"a": {name: "a", w: w, testType: &mockStep{}},
+		"disks": {name: "disks", w: w, CreateDisks: &CreateDisks{
+			{Disk: compute.Disk{Name: "d", Description: "a ${v} disk", Labels: map[string]string{"k": "v"}}},
+		}},
+	}
+	w.Dependencies = map[string][]string{"disks": {"a"}}
+	w.recordVarUses()
+	substitute(reflect.ValueOf(w).Elem(), w.varReplacer("", ""))
+	return w
+}
+
+func TestApplyModifiers(t *testing.T) {
+	tests := []struct {
+		desc    string
+		mod     PostValidateModifier
+		wantErr bool
+	}{
+		{"set timeout", func(m *Modifier) error { return m.SetStepTimeout("a", time.Minute) }, false},
+		{"modifier error", func(m *Modifier) error { return errors.New("fail") }, true},
+		{"step added", func(m *Modifier) error {
+			m.w.Steps["b"] = &Step{name: "b", w: m.w, testType: &mockStep{}}
+			return nil
+		}, true},
+		{"dependency removed", func(m *Modifier) error {
+			delete(m.w.Dependencies, "disks")
+			return nil
+		}, true},
+	}
+	for _, tt := range tests {
+		w := modifyTestWorkflow()
+		if err := w.applyModifiers([]PostValidateModifier{tt.mod}); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+	}
+}
+
+func TestModifierSetStepTimeout(t *testing.T) {
+	w := modifyTestWorkflow()
+	m := &Modifier{w: w}
+	if err := m.SetStepTimeout("a", time.Minute); err != nil {
+		t.Fatalf("error setting timeout: %v", err)
+	}
+	if s := w.Steps["a"]; s.timeout != time.Minute || s.Timeout != "1m0s" {
+		t.Errorf("timeout not set: got %q (%s)", s.Timeout, s.timeout)
+	}
+	if err := m.SetStepTimeout("b", time.Minute); err == nil {
+		t.Error("expected error for unknown step")
+	}
+	if err := m.SetStepTimeout("a", 0); err == nil {
+		t.Error("expected error for zero timeout")
+	}
+}
+
+func TestModifierSetVar(t *testing.T) {
+	w := modifyTestWorkflow()
+	m := &Modifier{w: w}
+	if err := m.SetVar("v", "other"); err != nil {
+		t.Fatalf("error setting var: %v", err)
+	}
+	if got := w.Vars["v"].Value; got != "other" {
+		t.Errorf("var not set: got %q", got)
+	}
+	d := (*w.Steps["disks"].CreateDisks)[0]
+	if d.Description != "a other disk" {
+		t.Errorf("var not replaced in steps: got %q", d.Description)
+	}
+
+	metadataWorkflow := func(metadata map[string]string) *Workflow {
+		w := modifyTestWorkflow()
+		w.Steps["metadata"] = &Step{name: "metadata", w: w, UpdateInstancesMetadata: &UpdateInstancesMetadata{
+			{Instance: "i", Metadata: metadata},
+		}}
+		w.recordVarUses()
+		substitute(reflect.ValueOf(w).Elem(), w.varReplacer("", ""))
+		return w
+	}
+	w = metadataWorkflow(map[string]string{"${v}-key": "x"})
+	if err := (&Modifier{w: w}).SetVar("v", "other"); err == nil {
+		t.Error("expected error for var used in a map key")
+	}
+	w = metadataWorkflow(map[string]string{"k": "${v}"})
+	if err := (&Modifier{w: w}).SetVar("v", "other"); err != nil {
+		t.Fatalf("error setting var: %v", err)
+	}
+	if got := (*w.Steps["metadata"].UpdateInstancesMetadata)[0].Metadata["k"]; got != "other" {
+		t.Errorf("var not replaced in metadata: got %q", got)
+	}
+
+	// Only the strings that referenced the var are replaced.
+	w = modifyTestWorkflow()
+	d = (*w.Steps["disks"].CreateDisks)[0]
+	d.Description += ", value-11"
+	d.SourceImageId = "value-11"
+	if err := (&Modifier{w: w}).SetVar("v", "other"); err == nil {
+		t.Error("expected error for a var use changed after substitution")
+	}
+	w = modifyTestWorkflow()
+	d = (*w.Steps["disks"].CreateDisks)[0]
+	d.SourceImageId = "value-11"
+	if err := (&Modifier{w: w}).SetVar("v", "other"); err != nil {
+		t.Fatalf("error setting var: %v", err)
+	}
+	if d.SourceImageId != "value-11" || d.Description != "a other disk" {
+		t.Errorf("unexpected strings after SetVar: %q, %q", d.SourceImageId, d.Description)
+	}
+	if err := m.SetVar("unknown", "x"); err == nil {
+		t.Error("expected error for unknown var")
+	}
+
+	w = modifyTestWorkflow()
+	w.disks.m = map[string]*Resource{"value-disk": {RealName: "value-disk-abcdef"}}
+	if err := (&Modifier{w: w}).SetVar("v", "other"); err == nil {
+		t.Error("expected error for var used in a resource name")
+	}
+	if got := w.Vars["v"].Value; got != "value" {
+		t.Errorf("var set despite error: got %q", got)
+	}
+}
+
+func TestModifierAddLabels(t *testing.T) {
+	w := modifyTestWorkflow()
+	m := &Modifier{w: w}
+	if err := m.AddLabels(map[string]string{"k": "v", "team": "images"}); err != nil {
+		t.Fatalf("error adding labels: %v", err)
+	}
+	want := map[string]string{"k": "v", "team": "images"}
+	if diffRes := diff((*w.Steps["disks"].CreateDisks)[0].Labels, want, 0); diffRes != "" {
+		t.Errorf("labels not as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	for _, labels := range []map[string]string{
+		{"k": "other"},
+		{"Bad": "v"},
+		{"k": "Bad"},
+	} {
+		if err := m.AddLabels(labels); err == nil {
+			t.Errorf("expected error adding %v", labels)
+		}
+	}
+	if diffRes := diff((*w.Steps["disks"].CreateDisks)[0].Labels, want, 0); diffRes != "" {
+		t.Errorf("labels changed despite errors: (-got,+want)\n%s", diffRes)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
 	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 	"google.golang.org/api/compute/v1"
@@ -41,6 +43,18 @@ func (w *Workflow) networkExists(project, network string) (bool, DError) {
 type Network struct {
 	compute.Network
 	AutoCreateSubnetworks *bool `json:"autoCreateSubnetworks,omitempty"`
+	// ReclaimStale sets what to do if the network already exists, e.g. left
+	// over from a crashed run reusing its name: "DELETE" deletes it along with
+	// its firewall rules and subnetworks, "ADOPT" uses it, and the firewall
+	// rules and subnetworks created on it that already exist, as if created by
+	// this workflow. Only resources created by Daisy are reclaimed.
+	ReclaimStale string `json:",omitempty"`
+	// ReclaimStaleMinAge is how old a network must be to be deleted by
+	// ReclaimStale "DELETE", defaults to 1h. Younger networks may belong to a
+	// workflow still running.
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	ReclaimStaleMinAge string `json:",omitempty"`
+	reclaimStaleMinAge time.Duration
 	Resource
 }
 
@@ -56,6 +70,18 @@ func (n *Network) populate(ctx context.Context, s *Step) DError {
 	n.Description = strOr(n.Description, defaultDescription("Network", s.w.Name, s.w.username))
 	n.link = fmt.Sprintf("projects/%s/global/networks/%s", n.Project, n.Name)
 
+	n.ReclaimStale = strings.ToUpper(n.ReclaimStale)
+	n.reclaimStale = n.ReclaimStale
+	if n.ReclaimStaleMinAge != "" {
+		d, err := time.ParseDuration(n.ReclaimStaleMinAge)
+		if err != nil || d < 0 {
+			errs = addErrs(errs, Errf("ReclaimStaleMinAge must be a non negative duration: %q", n.ReclaimStaleMinAge))
+		}
+		n.reclaimStaleMinAge = d
+	} else if n.ReclaimStale == reclaimDelete {
+		n.reclaimStaleMinAge = defaultReclaimStaleMinAge
+	}
+
 	if n.AutoCreateSubnetworks != nil {
 		n.Network.AutoCreateSubnetworks = *n.AutoCreateSubnetworks
 		n.Network.ForceSendFields = []string{"AutoCreateSubnetworks"}
@@ -78,8 +104,13 @@ func (n *Network) validate(ctx context.Context, s *Step) DError {
 		errs = addErrs(errs, Errf("%s: RoutingConfig %q not one of %v", pre, n.RoutingConfig.RoutingMode, modes))
 	}
 
-	// Register creation.
-	errs = addErrs(errs, s.w.networks.regCreate(n.daisyName, &n.Resource, s, false))
+	reclaimModes := []string{reclaimDelete, reclaimAdopt}
+	if n.ReclaimStale != "" && !strIn(n.ReclaimStale, reclaimModes) {
+		errs = addErrs(errs, Errf("%s: ReclaimStale %q not one of %v", pre, n.ReclaimStale, reclaimModes))
+	}
+
+	// Register creation. A stale network is dealt with when running.
+	errs = addErrs(errs, s.w.networks.regCreate(n.daisyName, &n.Resource, s, n.ReclaimStale != ""))
 	return errs
 }
 
@@ -103,7 +134,7 @@ func newNetworkRegistry(w *Workflow) *networkRegistry {
 
 func (nr *networkRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(networkURLRegex, res.link)
-	err := nr.w.ComputeClient.DeleteNetwork(m["project"], m["network"])
+	err := nr.w.resourceClient(res).DeleteNetwork(m["project"], m["network"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete network", err)
 	}
@@ -0,0 +1,242 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/logadmin"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const (
+	// OpsAgentLogLabel is the label the Ops Agent helper adds to the log
+	// entries of the guest, set to the instance name, so that an OpsAgentLog
+	// WaitForInstancesSignal can find them.
+	OpsAgentLogLabel = "daisy-signal"
+	// OpsAgentLogFile is the file the Ops Agent helper sends to Cloud Logging.
+	OpsAgentLogFile = "/var/log/daisy-signal.log"
+	// OpsAgentLogShellMetadataKey is the instance metadata key holding the
+	// shell Ops Agent helper when InstanceBase.OpsAgentLogHelpers is set.
+	OpsAgentLogShellMetadataKey = "daisy-ops-agent-sh"
+
+	opsAgentConfigFile = "/etc/google-cloud-ops-agent/config.yaml"
+)
+
+// opsAgentLogMinInterval is the minimum interval between Cloud Logging reads
+// of an OpsAgentLog signal, the read quota is 60 requests/minute per project.
+var opsAgentLogMinInterval = 10 * time.Second
+
+// OpsAgentLog describes text signal strings that will be written to the log
+// entries the Ops Agent of the instance sends to Cloud Logging, for images
+// where the serial console is disabled. Only entries with the OpsAgentLogLabel
+// label set to the instance name are read, see OpsAgentLogShellScript.
+// A StatusMatch will print out the matching entry from the StatusMatch onward.
+// This step will not complete until an entry matches SuccessMatch or
+// FailureMatch. A match with FailureMatch will cause the step to fail.
+type OpsAgentLog struct {
+	SuccessMatch string         `json:",omitempty"`
+	FailureMatch FailureMatches `json:",omitempty"`
+	StatusMatch  string         `json:",omitempty"`
+}
+
+// LogMessage is the text of a Cloud Logging entry.
+type LogMessage struct {
+	Timestamp time.Time
+	Text      string
+}
+
+// LogReader reads log entries from Cloud Logging.
+type LogReader interface {
+	// ReadLogs returns the log entries of project matching filter, oldest
+	// first.
+	ReadLogs(project, filter string) ([]LogMessage, error)
+}
+
+type logReader struct {
+	opts []option.ClientOption
+
+	mx      sync.Mutex
+	clients map[string]*logadmin.Client
+}
+
+// NewLogReader creates a LogReader using the Cloud Logging API. Clients are
+// created as projects are read.
+func NewLogReader(opts ...option.ClientOption) LogReader {
+	return &logReader{opts: opts, clients: map[string]*logadmin.Client{}}
+}
+
+// ReadLogs returns the log entries of project matching filter, oldest first.
+// The text of an entry is its text payload, or the message field of its JSON
+// payload.
+func (r *logReader) ReadLogs(project, filter string) ([]LogMessage, error) {
+	ctx := context.Background()
+	r.mx.Lock()
+	c, ok := r.clients[project]
+	if !ok {
+		var err error
+		if c, err = logadmin.NewClient(ctx, project, r.opts...); err != nil {
+			r.mx.Unlock()
+			return nil, err
+		}
+		r.clients[project] = c
+	}
+	r.mx.Unlock()
+
+	var msgs []LogMessage
+	it := c.Entries(ctx, logadmin.Filter(filter))
+	for {
+		e, err := it.Next()
+		if err == iterator.Done {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, LogMessage{Timestamp: e.Timestamp, Text: logEntryText(e)})
+	}
+}
+
+func logEntryText(e *logging.Entry) string {
+	switch p := e.Payload.(type) {
+	case string:
+		return p
+	case *structpb.Struct:
+		return p.GetFields()["message"].GetStringValue()
+	}
+	return fmt.Sprint(e.Payload)
+}
+
+// OpsAgentLogShellScript returns a shell snippet defining daisy_ops_agent,
+// which configures the Ops Agent to send OpsAgentLogFile to Cloud Logging with
+// the OpsAgentLogLabel label, and daisy_log, which appends its arguments to
+// OpsAgentLogFile. daisy_ops_agent replaces the Ops Agent configuration.
+// Usage: daisy_ops_agent, daisy_log MESSAGE.
+// Guests can load it with:
+//
+//	eval "$(curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/attributes/daisy-ops-agent-sh)"
+func OpsAgentLogShellScript() string {
+	// Avoid ${} expansions, they would be taken for unresolved workflow vars.
+	return fmt.Sprintf(`daisy_ops_agent() {
+  name=$(curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/name)
+  touch %[1]s
+  cat > %[2]s <<EOF
+logging:
+  receivers:
+    daisy_signal:
+      type: files
+      include_paths: [%[1]s]
+  processors:
+    daisy_signal:
+      type: modify_fields
+      fields:
+        labels."%[3]s":
+          static_value: $name
+  service:
+    pipelines:
+      daisy_signal:
+        receivers: [daisy_signal]
+        processors: [daisy_signal]
+EOF
+  systemctl restart google-cloud-ops-agent
+}
+daisy_log() {
+  echo "$*" >> %[1]s
+}
+`, OpsAgentLogFile, opsAgentConfigFile, OpsAgentLogLabel)
+}
+
+// opsAgentLogFilter returns the Cloud Logging filter of the entries of
+// instance name newer than since.
+func opsAgentLogFilter(name string, since time.Time) string {
+	return fmt.Sprintf(`resource.type="gce_instance" AND labels.%q=%q AND timestamp>%q`, OpsAgentLogLabel, name, since.UTC().Format(time.RFC3339Nano))
+}
+
+// waitForOpsAgentLog watches the Ops Agent log entries of an instance until a
+// match. It returns nil when done is closed.
+func waitForOpsAgentLog(s *Step, project, zone, name string, ol *OpsAgentLog, interval time.Duration, done <-chan struct{}) DError {
+	w := s.w
+	msg := fmt.Sprintf("Instance %q: watching Ops Agent logs", name)
+	if ol.SuccessMatch != "" {
+		msg += fmt.Sprintf(", SuccessMatch: %q", ol.SuccessMatch)
+	}
+	if len(ol.FailureMatch) > 0 {
+		msg += fmt.Sprintf(", FailureMatch: %q", ol.FailureMatch)
+	}
+	if ol.StatusMatch != "" {
+		msg += fmt.Sprintf(", StatusMatch: %q", ol.StatusMatch)
+	}
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", msg+".")
+	if w.LogReader == nil {
+		return Errf("WaitForInstancesSignal: instance %q: no LogReader to read Ops Agent logs", name)
+	}
+	if interval < opsAgentLogMinInterval {
+		interval = opsAgentLogMinInterval
+	}
+
+	// Entries older than the instance are of a previous instance of the same
+	// name.
+	var since time.Time
+	if i, err := w.ComputeClient.GetInstance(project, zone, name); err != nil {
+		return Errf("WaitForInstancesSignal: instance %q: error getting instance: %v", name, err)
+	} else if since, err = time.Parse(time.RFC3339, i.CreationTimestamp); err != nil {
+		return Errf("WaitForInstancesSignal: instance %q: error parsing creation time %q: %v", name, i.CreationTimestamp, err)
+	}
+
+	tick := time.Tick(interval)
+	var errs int
+	for {
+		select {
+		case <-s.w.Cancel:
+			return nil
+		case <-done:
+			return nil
+		case <-tick:
+			msgs, err := w.LogReader.ReadLogs(project, opsAgentLogFilter(name, since))
+			if err != nil {
+				// Permit up to 3 consecutive errors reading the logs.
+				if errs++; errs < 3 {
+					continue
+				}
+				return Errf("WaitForInstancesSignal: instance %q: error reading Ops Agent logs: %v", name, err)
+			}
+			errs = 0
+			for _, m := range msgs {
+				since = m.Timestamp
+				for _, fm := range ol.FailureMatch {
+					if i := strings.Index(m.Text, fm); i != -1 {
+						return Errf("WaitForInstancesSignal FailureMatch found for %q: %q", name, strings.TrimSpace(m.Text[i:]))
+					}
+				}
+				if ol.SuccessMatch != "" && strings.Contains(m.Text, ol.SuccessMatch) {
+					w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: SuccessMatch found in Ops Agent logs: %q", name, strings.TrimSpace(m.Text))
+					return nil
+				}
+				if ol.StatusMatch != "" {
+					if i := strings.Index(m.Text, ol.StatusMatch); i != -1 {
+						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: StatusMatch found: %q", name, strings.TrimSpace(m.Text[i:]))
+					}
+				}
+			}
+		}
+	}
+}
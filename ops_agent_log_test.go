@@ -0,0 +1,121 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+type fakeLogReader struct {
+	msgs    []LogMessage
+	err     error
+	filters []string
+}
+
+func (r *fakeLogReader) ReadLogs(project, filter string) ([]LogMessage, error) {
+	r.filters = append(r.filters, filter)
+	return r.msgs, r.err
+}
+
+func TestWaitForOpsAgentLog(t *testing.T) {
+	defer func(d time.Duration) { opsAgentLogMinInterval = d }(opsAgentLogMinInterval)
+	opsAgentLogMinInterval = time.Millisecond
+
+	created := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	logged := created.Add(time.Minute)
+	tests := []struct {
+		desc    string
+		msgs    []LogMessage
+		err     error
+		ol      *OpsAgentLog
+		wantErr bool
+	}{
+		{"success", []LogMessage{{logged, "starting"}, {logged, "BuildSuccess: done"}}, nil, &OpsAgentLog{SuccessMatch: "BuildSuccess", StatusMatch: "starting"}, false},
+		{"failure", []LogMessage{{logged, "BuildFailed: oops"}, {logged, "BuildSuccess"}}, nil, &OpsAgentLog{SuccessMatch: "BuildSuccess", FailureMatch: FailureMatches{"BuildFailed"}}, true},
+		{"read errors", nil, errors.New("fail"), &OpsAgentLog{SuccessMatch: "BuildSuccess"}, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.ComputeClient.(*daisyCompute.TestClient).GetInstanceFn = func(_, _, name string) (*compute.Instance, error) {
+			return &compute.Instance{Name: name, CreationTimestamp: created.Format(time.RFC3339)}, nil
+		}
+		lr := &fakeLogReader{msgs: tt.msgs, err: tt.err}
+		w.LogReader = lr
+		s := &Step{name: "wait", w: w}
+		err := waitForOpsAgentLog(s, testProject, testZone, testInstance, tt.ol, time.Millisecond, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		want := opsAgentLogFilter(testInstance, created)
+		if len(lr.filters) == 0 || lr.filters[0] != want {
+			t.Errorf("%s: got filters %q, want first filter %q", tt.desc, lr.filters, want)
+		}
+	}
+}
+
+func TestOpsAgentLogFilter(t *testing.T) {
+	got := opsAgentLogFilter("vm", time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC))
+	want := `resource.type="gce_instance" AND labels."daisy-signal"="vm" AND timestamp>"2022-01-02T03:04:05.000000006Z"`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWaitForInstancesSignalOpsAgentLog(t *testing.T) {
+	defer func(d time.Duration) { opsAgentLogMinInterval = d }(opsAgentLogMinInterval)
+	opsAgentLogMinInterval = time.Millisecond
+
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).GetInstanceFn = func(_, _, name string) (*compute.Instance, error) {
+		return &compute.Instance{Name: name, CreationTimestamp: "2022-01-02T03:04:05Z"}, nil
+	}
+	w.LogReader = &fakeLogReader{msgs: []LogMessage{{time.Now(), "BuildSuccess"}}}
+	s, _ := w.NewStep("s")
+	link := fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)
+	ws := &WaitForInstancesSignal{{Name: link, interval: time.Millisecond, OpsAgentLog: &OpsAgentLog{SuccessMatch: "BuildSuccess"}}}
+	if err := ws.validate(context.Background(), s); err != nil {
+		t.Fatalf("error validating: %v", err)
+	}
+	if err := ws.run(context.Background(), s); err != nil {
+		t.Errorf("error running: %v", err)
+	}
+
+	ws = &WaitForInstancesSignal{{Name: link, OpsAgentLog: &OpsAgentLog{StatusMatch: "status"}}}
+	if err := ws.validate(context.Background(), s); err == nil {
+		t.Error("expected error for OpsAgentLog without SuccessMatch or FailureMatch")
+	}
+}
+
+func TestInstancePopulateMetadataOpsAgentLogHelpers(t *testing.T) {
+	w := testWorkflow()
+	i := Instance{InstanceBase: InstanceBase{OpsAgentLogHelpers: true}}
+	if err := (&i.InstanceBase).populateMetadata(&i, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := i.Metadata[OpsAgentLogShellMetadataKey]; got != OpsAgentLogShellScript() {
+		t.Errorf("metadata %q: got %q, want the Ops Agent helper", OpsAgentLogShellMetadataKey, got)
+	}
+	if strings.Contains(OpsAgentLogShellScript(), "${") {
+		t.Error("Ops Agent helper must not contain ${} expansions")
+	}
+}
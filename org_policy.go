@@ -0,0 +1,270 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+)
+
+const (
+	vmExternalIPAccessConstraint          = "constraints/compute.vmExternalIpAccess"
+	requireShieldedVMConstraint           = "constraints/compute.requireShieldedVm"
+	trustedImageProjectsConstraint        = "constraints/compute.trustedImageProjects"
+	restrictSharedVpcSubnetworkConstraint = "constraints/compute.restrictSharedVpcSubnetworks"
+)
+
+// OrgPolicyClient looks up the organization policies in effect for a project.
+type OrgPolicyClient interface {
+	GetEffectiveOrgPolicy(project, constraint string) (*cloudresourcemanager.OrgPolicy, error)
+}
+
+type orgPolicyClient struct {
+	svc *cloudresourcemanager.Service
+}
+
+// NewOrgPolicyClient creates an OrgPolicyClient using the Cloud Resource
+// Manager API.
+func NewOrgPolicyClient(ctx context.Context, opts ...option.ClientOption) (OrgPolicyClient, error) {
+	svc, err := cloudresourcemanager.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &orgPolicyClient{svc: svc}, nil
+}
+
+// GetEffectiveOrgPolicy gets the policy of constraint in effect for project.
+func (c *orgPolicyClient) GetEffectiveOrgPolicy(project, constraint string) (*cloudresourcemanager.OrgPolicy, error) {
+	req := &cloudresourcemanager.GetEffectiveOrgPolicyRequest{Constraint: constraint}
+	return c.svc.Projects.GetEffectiveOrgPolicy("projects/"+project, req).Do()
+}
+
+// walkSteps calls f on every step of w and of the workflows its steps run.
+// s.w is the workflow of s, whose registries resolve the names s uses.
+func walkSteps(w *Workflow, f func(s *Step)) {
+	for _, s := range w.Steps {
+		f(s)
+		if child := nestedWorkflow(s); child != nil {
+			walkSteps(child, f)
+		}
+	}
+}
+
+// policyValueMatches reports whether value matches a list policy value,
+// which may have an "is:" or "under:" prefix. known is false for "under:"
+// values naming an organization or folder, as the resource hierarchy of
+// value is not looked up.
+func policyValueMatches(policyValue, value string) (match, known bool) {
+	if v := strings.TrimPrefix(policyValue, "under:"); v != policyValue {
+		if strings.HasPrefix(v, "organizations/") || strings.HasPrefix(v, "folders/") {
+			return false, false
+		}
+		return value == v || strings.HasPrefix(value, v+"/"), true
+	}
+	return strings.TrimPrefix(policyValue, "is:") == value, true
+}
+
+// listPolicyAllows reports whether policy p allows value. known is false if
+// that depends on policy values that cannot be resolved.
+func listPolicyAllows(p *cloudresourcemanager.OrgPolicy, value string) (allowed, known bool) {
+	if p == nil || p.ListPolicy == nil {
+		return true, true
+	}
+	lp := p.ListPolicy
+	switch lp.AllValues {
+	case "DENY":
+		return false, true
+	case "ALLOW":
+		return true, true
+	}
+	known = true
+	for _, v := range lp.DeniedValues {
+		match, ok := policyValueMatches(v, value)
+		if match {
+			return false, true
+		}
+		known = known && ok
+	}
+	if len(lp.AllowedValues) == 0 {
+		return true, known
+	}
+	allowedKnown := true
+	for _, v := range lp.AllowedValues {
+		match, ok := policyValueMatches(v, value)
+		if match {
+			return true, known
+		}
+		allowedKnown = allowedKnown && ok
+	}
+	if !allowedKnown {
+		return true, false
+	}
+	return false, true
+}
+
+// orgPolicyChecker checks planned resources against the organization
+// policies of their projects.
+type orgPolicyChecker struct {
+	w        *Workflow
+	policies map[string]*cloudresourcemanager.OrgPolicy
+}
+
+// policy returns the policy of constraint in effect for project, or nil if
+// it cannot be read. Lookups are cached.
+func (c *orgPolicyChecker) policy(project, constraint string) *cloudresourcemanager.OrgPolicy {
+	key := project + "/" + constraint
+	if p, ok := c.policies[key]; ok {
+		return p
+	}
+	p, err := c.w.OrgPolicyClient.GetEffectiveOrgPolicy(project, constraint)
+	if err != nil {
+		c.w.LogWorkflowInfo("WARNING: cannot check org policy %s of project %q: %v", constraint, project, err)
+		p = nil
+	}
+	c.policies[key] = p
+	return p
+}
+
+// allows reports whether the policy of constraint in effect for project
+// allows value. Values the policy may or may not allow are allowed with a
+// warning.
+func (c *orgPolicyChecker) allows(project, constraint, value string) bool {
+	allowed, known := listPolicyAllows(c.policy(project, constraint), value)
+	if !known {
+		c.w.LogWorkflowInfo("WARNING: cannot check %q against org policy %s of project %q, which names organizations or folders", value, constraint, project)
+		return true
+	}
+	return allowed
+}
+
+// subnetworkLink returns the partial URL of subnetwork sn used in w, or "" if
+// unknown.
+func subnetworkLink(w *Workflow, sn string) string {
+	if res, ok := w.subnetworks.get(sn); ok {
+		sn = res.link
+	}
+	if !subnetworkURLRegex.MatchString(sn) {
+		return ""
+	}
+	return sn
+}
+
+// checkImage checks image, used in w, against the trustedImageProjects
+// policy of project.
+func (c *orgPolicyChecker) checkImage(w *Workflow, project, what, image string) DError {
+	ip := w.imageProject(image, project)
+	if image == "" || ip == "" {
+		return nil
+	}
+	if !c.allows(project, trustedImageProjectsConstraint, "projects/"+ip) {
+		return Errf("%s: image %q is from project %q, which the org policy %s of project %q does not trust. Use an image from a trusted project or ask an organization policy administrator to add %q to the constraint.", what, image, ip, trustedImageProjectsConstraint, project, "projects/"+ip)
+	}
+	return nil
+}
+
+type plannedInstance struct {
+	link, project string
+	externalIP    bool
+	secureBoot    bool
+	images        []string
+	subnetworks   []string
+}
+
+// checkInstance checks instance i, created in w.
+func (c *orgPolicyChecker) checkInstance(w *Workflow, i plannedInstance) DError {
+	what := fmt.Sprintf("instance %q", i.link)
+	var errs DError
+	if i.externalIP && !c.allows(i.project, vmExternalIPAccessConstraint, i.link) {
+		errs = addErrs(errs, Errf("%s: the org policy %s of project %q does not allow external IPs. Set \"AccessConfigs\": [] on the network interfaces of the instance and reach the internet through Cloud NAT if needed.", what, vmExternalIPAccessConstraint, i.project))
+	}
+	if !i.secureBoot {
+		if p := c.policy(i.project, requireShieldedVMConstraint); p != nil && p.BooleanPolicy != nil && p.BooleanPolicy.Enforced {
+			errs = addErrs(errs, Errf("%s: the org policy %s of project %q requires Shielded VMs. Boot from a UEFI image and set \"ShieldedInstanceConfig\": {\"EnableSecureBoot\": true}.", what, requireShieldedVMConstraint, i.project))
+		}
+	}
+	for _, image := range i.images {
+		errs = addErrs(errs, c.checkImage(w, i.project, what, image))
+	}
+	for _, sn := range i.subnetworks {
+		if link := subnetworkLink(w, sn); link != "" && NamedSubexp(subnetworkURLRegex, link)["project"] != i.project {
+			if !c.allows(i.project, restrictSharedVpcSubnetworkConstraint, link) {
+				errs = addErrs(errs, Errf("%s: the org policy %s of project %q does not allow Shared VPC subnetwork %q. Use an allowed subnetwork or ask an organization policy administrator to add it to the constraint.", what, restrictSharedVpcSubnetworkConstraint, i.project, link))
+			}
+		}
+	}
+	return errs
+}
+
+func planInstance(i *Instance) plannedInstance {
+	pi := plannedInstance{link: i.link, project: i.Project}
+	pi.secureBoot = i.ShieldedInstanceConfig != nil && i.ShieldedInstanceConfig.EnableSecureBoot
+	for _, n := range i.NetworkInterfaces {
+		pi.externalIP = pi.externalIP || len(n.AccessConfigs) > 0
+		if n.Subnetwork != "" {
+			pi.subnetworks = append(pi.subnetworks, n.Subnetwork)
+		}
+	}
+	for _, d := range i.Disks {
+		if d.InitializeParams != nil {
+			pi.images = append(pi.images, d.InitializeParams.SourceImage)
+		}
+	}
+	return pi
+}
+
+func planInstanceBeta(i *InstanceBeta) plannedInstance {
+	pi := plannedInstance{link: i.link, project: i.Project}
+	pi.secureBoot = i.ShieldedInstanceConfig != nil && i.ShieldedInstanceConfig.EnableSecureBoot
+	for _, n := range i.NetworkInterfaces {
+		pi.externalIP = pi.externalIP || len(n.AccessConfigs) > 0
+		if n.Subnetwork != "" {
+			pi.subnetworks = append(pi.subnetworks, n.Subnetwork)
+		}
+	}
+	for _, d := range i.Disks {
+		if d.InitializeParams != nil {
+			pi.images = append(pi.images, d.InitializeParams.SourceImage)
+		}
+	}
+	return pi
+}
+
+// checkOrgPolicies checks the instances and disks the workflow creates
+// against commonly hit organization policy constraints of their projects.
+// Policies that cannot be read are skipped with a warning.
+func (w *Workflow) checkOrgPolicies() DError {
+	c := &orgPolicyChecker{w: w, policies: map[string]*cloudresourcemanager.OrgPolicy{}}
+	var errs DError
+	walkSteps(w, func(s *Step) {
+		switch {
+		case s.CreateInstances != nil:
+			for _, i := range s.CreateInstances.Instances {
+				errs = addErrs(errs, c.checkInstance(s.w, planInstance(i)))
+			}
+			for _, i := range s.CreateInstances.InstancesBeta {
+				errs = addErrs(errs, c.checkInstance(s.w, planInstanceBeta(i)))
+			}
+		case s.CreateDisks != nil:
+			for _, d := range *s.CreateDisks {
+				errs = addErrs(errs, c.checkImage(s.w, d.Project, fmt.Sprintf("disk %q", d.Name), d.SourceImage))
+			}
+		}
+	})
+	return errs
+}
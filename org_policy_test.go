@@ -0,0 +1,133 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+)
+
+type fakeOrgPolicyClient map[string]*cloudresourcemanager.OrgPolicy
+
+func (c fakeOrgPolicyClient) GetEffectiveOrgPolicy(project, constraint string) (*cloudresourcemanager.OrgPolicy, error) {
+	if p, ok := c[constraint]; ok {
+		return p, nil
+	}
+	return nil, errors.New("permission denied")
+}
+
+func TestListPolicyAllows(t *testing.T) {
+	tests := []struct {
+		desc  string
+		lp    *cloudresourcemanager.ListPolicy
+		value string
+		want  bool
+		known bool
+	}{
+		{"no list policy", nil, "projects/p", true, true},
+		{"deny all", &cloudresourcemanager.ListPolicy{AllValues: "DENY"}, "projects/p", false, true},
+		{"allow all", &cloudresourcemanager.ListPolicy{AllValues: "ALLOW"}, "projects/p", true, true},
+		{"allowed", &cloudresourcemanager.ListPolicy{AllowedValues: []string{"is:projects/p"}}, "projects/p", true, true},
+		{"not allowed", &cloudresourcemanager.ListPolicy{AllowedValues: []string{"projects/q"}}, "projects/p", false, true},
+		{"denied", &cloudresourcemanager.ListPolicy{DeniedValues: []string{"projects/p"}}, "projects/p", false, true},
+		{"allowed under", &cloudresourcemanager.ListPolicy{AllowedValues: []string{"under:projects/host"}}, "projects/host/regions/r/subnetworks/s", true, true},
+		{"allowed under organization", &cloudresourcemanager.ListPolicy{AllowedValues: []string{"projects/q", "under:organizations/1"}}, "projects/p", true, false},
+		{"allowed under folder", &cloudresourcemanager.ListPolicy{AllowedValues: []string{"under:folders/1", "projects/p"}}, "projects/p", true, true},
+		{"denied under folder", &cloudresourcemanager.ListPolicy{DeniedValues: []string{"under:folders/1"}}, "projects/p", true, false},
+		{"denied and allowed under folder", &cloudresourcemanager.ListPolicy{DeniedValues: []string{"projects/p"}, AllowedValues: []string{"under:folders/1"}}, "projects/p", false, true},
+	}
+	for _, tt := range tests {
+		got, known := listPolicyAllows(&cloudresourcemanager.OrgPolicy{ListPolicy: tt.lp}, tt.value)
+		if got != tt.want || known != tt.known {
+			t.Errorf("%s: got %t, known %t, want %t, known %t", tt.desc, got, known, tt.want, tt.known)
+		}
+	}
+}
+
+func TestCheckOrgPolicies(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.Steps = map[string]*Step{
+		"create": {CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{
+			Name:  "i",
+			Disks: []*compute.AttachedDisk{{InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: "projects/debian-cloud/global/images/family/debian-11"}}},
+		}}}}},
+		"disk": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "d", SourceImage: "projects/my-images/global/images/i"}}}},
+	}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	w.OrgPolicyClient = fakeOrgPolicyClient{}
+	if err := w.checkOrgPolicies(); err != nil {
+		t.Errorf("unexpected error when policies cannot be read: %v", err)
+	}
+
+	w.OrgPolicyClient = fakeOrgPolicyClient{
+		vmExternalIPAccessConstraint:   {ListPolicy: &cloudresourcemanager.ListPolicy{AllValues: "DENY"}},
+		requireShieldedVMConstraint:    {BooleanPolicy: &cloudresourcemanager.BooleanPolicy{Enforced: true}},
+		trustedImageProjectsConstraint: {ListPolicy: &cloudresourcemanager.ListPolicy{AllowedValues: []string{"projects/my-images"}}},
+	}
+	err := w.checkOrgPolicies()
+	if err == nil {
+		t.Fatal("expected org policy violations")
+	}
+	for _, want := range []string{vmExternalIPAccessConstraint, requireShieldedVMConstraint, trustedImageProjectsConstraint, `"AccessConfigs": []`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "my-images") && strings.Contains(err.Error(), `disk "`) {
+		t.Errorf("unexpected violation for trusted image: %v", err)
+	}
+
+	// Images trusted through the resource hierarchy are not violations.
+	w.OrgPolicyClient = fakeOrgPolicyClient{
+		trustedImageProjectsConstraint: {ListPolicy: &cloudresourcemanager.ListPolicy{AllowedValues: []string{"under:organizations/1"}}},
+	}
+	if err := w.checkOrgPolicies(); err != nil {
+		t.Errorf("unexpected error for images trusted under an organization: %v", err)
+	}
+}
+
+func TestCheckOrgPoliciesSubWorkflow(t *testing.T) {
+	ctx := context.Background()
+	sw := New()
+	sw.Steps = map[string]*Step{
+		"create": {CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{
+			Name:  "i",
+			Disks: []*compute.AttachedDisk{{InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: "img"}}},
+		}}}}},
+	}
+	w := testWorkflow()
+	w.Steps = map[string]*Step{"sub": {SubWorkflow: &SubWorkflow{Workflow: sw}}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The image is known to the registry of the SubWorkflow only.
+	sw.images.m = map[string]*Resource{"img": {link: "projects/untrusted/global/images/img"}}
+
+	w.OrgPolicyClient = fakeOrgPolicyClient{
+		trustedImageProjectsConstraint: {ListPolicy: &cloudresourcemanager.ListPolicy{AllowedValues: []string{"projects/my-images"}}},
+	}
+	if err := w.checkOrgPolicies(); err == nil || !strings.Contains(err.Error(), `"untrusted"`) {
+		t.Errorf("expected violation for the SubWorkflow image, got %v", err)
+	}
+}
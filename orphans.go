@@ -0,0 +1,202 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+// generatedNameRgx matches the suffix Daisy appends to the names it
+// generates, see Workflow.genName.
+var generatedNameRgx = regexp.MustCompile(fmt.Sprintf("-[%s]{5}$", nameLetters))
+
+// Orphan is a resource created by a run of a workflow and left behind, e.g.
+// by a run that crashed before cleaning up.
+type Orphan struct {
+	// Type is "instance", "disk", "subnetwork" or "network".
+	Type string
+	Name string
+	// Scope is the zone of instances and disks, the region of subnetworks.
+	Scope   string
+	Created time.Time
+}
+
+func (o *Orphan) String() string {
+	if o.Scope == "" {
+		return fmt.Sprintf("%s %q", o.Type, o.Name)
+	}
+	return fmt.Sprintf("%s %q in %s", o.Type, o.Name, o.Scope)
+}
+
+// keptNames returns the names of the resources w creates and keeps, with
+// NoCleanup.
+func (w *Workflow) keptNames() []string {
+	var names []string
+	add := func(name string, r Resource) {
+		if r.NoCleanup && name != "" {
+			names = append(names, name)
+		}
+	}
+	for _, s := range w.Steps {
+		if s.CreateDisks != nil {
+			for _, d := range *s.CreateDisks {
+				add(d.Name, d.Resource)
+			}
+		}
+		if s.CreateInstances != nil {
+			for _, i := range s.CreateInstances.Instances {
+				add(i.Name, i.Resource)
+			}
+			for _, i := range s.CreateInstances.InstancesBeta {
+				add(i.Name, i.Resource)
+			}
+		}
+		if s.CreateNetworks != nil {
+			for _, n := range *s.CreateNetworks {
+				add(n.Name, n.Resource)
+			}
+		}
+		if s.CreateSubnetworks != nil {
+			for _, sn := range *s.CreateSubnetworks {
+				add(sn.Name, sn.Resource)
+			}
+		}
+	}
+	return names
+}
+
+// orphanFilter returns a func reporting whether a resource, given its name,
+// description and creation timestamp, is an orphan of w created before
+// before, and its creation time.
+func (w *Workflow) orphanFilter(before time.Time) func(name, description, created string) (time.Time, bool) {
+	var keptPrefixes []string
+	for _, n := range w.keptNames() {
+		prefix := strings.ToLower(fmt.Sprintf("%s-%s-", n, w.Name))
+		if len(prefix) > 56 {
+			prefix = prefix[0:56]
+		}
+		keptPrefixes = append(keptPrefixes, prefix)
+	}
+	desc := fmt.Sprintf(" created by Daisy in workflow %q on behalf of ", w.Name)
+	return func(name, description, created string) (time.Time, bool) {
+		if !strings.Contains(description, desc) || !generatedNameRgx.MatchString(name) {
+			return time.Time{}, false
+		}
+		for _, p := range keptPrefixes {
+			if strings.HasPrefix(name, p) {
+				return time.Time{}, false
+			}
+		}
+		t, err := time.Parse(time.RFC3339, created)
+		if err != nil || !t.Before(before) {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+}
+
+// FindOrphans lists the instances, disks, subnetworks and networks of
+// w.Project left behind by runs of w created before before: the resources
+// described as created by Daisy in a workflow named w.Name, with a generated
+// name. The resources w keeps with NoCleanup are not orphans, nor are those
+// with an exact name, which can't be told apart from resources created
+// outside of Daisy. The orphans are returned in the order to delete them. The
+// zones and regions that could not be listed are returned too, their orphans
+// are missing.
+func (w *Workflow) FindOrphans(before time.Time) ([]*Orphan, []daisyCompute.ScopeStatus, error) {
+	c := w.computeClient()
+	isOrphan := w.orphanFilter(before)
+	var orphans []*Orphan
+	var scopes []daisyCompute.ScopeStatus
+	add := func(typ, name, scope, description, created string) {
+		if t, ok := isOrphan(name, description, created); ok {
+			orphans = append(orphans, &Orphan{Type: typ, Name: name, Scope: scope, Created: t})
+		}
+	}
+	partial := daisyCompute.ReturnPartialSuccess(true)
+
+	is, st, err := c.AggregatedListInstancesWithStatus(w.Project, partial)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list instances: %v", err)
+	}
+	scopes = append(scopes, st...)
+	for _, i := range is {
+		add("instance", i.Name, path.Base(i.Zone), i.Description, i.CreationTimestamp)
+	}
+	ds, st, err := c.AggregatedListDisksWithStatus(w.Project, partial)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list disks: %v", err)
+	}
+	scopes = append(scopes, st...)
+	for _, d := range ds {
+		add("disk", d.Name, path.Base(d.Zone), d.Description, d.CreationTimestamp)
+	}
+	sns, st, err := c.AggregatedListSubnetworksWithStatus(w.Project, partial)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list subnetworks: %v", err)
+	}
+	scopes = append(scopes, st...)
+	for _, sn := range sns {
+		add("subnetwork", sn.Name, path.Base(sn.Region), sn.Description, sn.CreationTimestamp)
+	}
+	ns, err := c.ListNetworks(w.Project)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+	for _, n := range ns {
+		add("network", n.Name, "", n.Description, n.CreationTimestamp)
+	}
+	return orphans, scopes, nil
+}
+
+// DeleteOrphan deletes o, found by FindOrphans. Networks are deleted with the
+// firewall rules and subnetworks on them, as with ReclaimStale "DELETE".
+// Orphans already deleted, e.g. disks auto-deleted with their instance, are
+// not an error.
+func (w *Workflow) DeleteOrphan(o *Orphan) error {
+	c := w.computeClient()
+	var err error
+	switch o.Type {
+	case "instance":
+		err = c.DeleteInstance(w.Project, o.Scope, o.Name)
+	case "disk":
+		err = c.DeleteDisk(w.Project, o.Scope, o.Name)
+	case "subnetwork":
+		err = c.DeleteSubnetwork(w.Project, o.Scope, o.Name)
+	case "network":
+		n, gErr := c.GetNetwork(w.Project, o.Name)
+		if isNotFound(gErr) {
+			return nil
+		} else if gErr != nil {
+			return fmt.Errorf("failed to get network %q: %v", o.Name, gErr)
+		}
+		if dErr := deleteStaleNetwork(c, w.LogWorkflowInfo, w.Project, n); dErr != nil {
+			return dErr
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown orphan type %q", o.Type)
+	}
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %v", o, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"github.com/kylelemons/godebug/pretty"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestFindOrphans(t *testing.T) {
+	w := testWorkflow()
+	w.Steps = map[string]*Step{"create-disks": {CreateDisks: &CreateDisks{
+		{Disk: compute.Disk{Name: "kept"}, Resource: Resource{NoCleanup: true}},
+	}}}
+	desc := func(typ, wf string) string {
+		return fmt.Sprintf("%s created by Daisy in workflow %q on behalf of someone.", typ, wf)
+	}
+	now := time.Now()
+	old := now.Add(-48 * time.Hour).Format(time.RFC3339)
+	recent := now.Format(time.RFC3339)
+	zone := "https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-a"
+	unreachable := daisyCompute.ScopeStatus{Scope: "zones/us-east1-b", Code: "UNREACHABLE"}
+	w.ComputeClient = &daisyCompute.TestClient{
+		AggregatedListInstancesWithStatusFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Instance, []daisyCompute.ScopeStatus, error) {
+			return []*compute.Instance{
+				{Name: "vm-" + testWf + "-bdg12", Zone: zone, Description: desc("Instance", testWf), CreationTimestamp: old},
+				{Name: "running-" + testWf + "-bdg12", Zone: zone, Description: desc("Instance", testWf), CreationTimestamp: recent},
+				{Name: "vm-other-bdg12", Zone: zone, Description: desc("Instance", "other"), CreationTimestamp: old},
+				{Name: "exact", Zone: zone, Description: desc("Instance", testWf), CreationTimestamp: old},
+			}, []daisyCompute.ScopeStatus{unreachable}, nil
+		},
+		AggregatedListDisksWithStatusFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Disk, []daisyCompute.ScopeStatus, error) {
+			return []*compute.Disk{
+				{Name: "disk-" + testWf + "-bdg12", Zone: zone, Description: desc("Disk", testWf), CreationTimestamp: old},
+				{Name: "kept-" + testWf + "-bdg12", Zone: zone, Description: desc("Disk", testWf), CreationTimestamp: old},
+				{Name: "user-disk-bdg12", Zone: zone, CreationTimestamp: old},
+			}, nil, nil
+		},
+		AggregatedListSubnetworksWithStatusFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Subnetwork, []daisyCompute.ScopeStatus, error) {
+			return []*compute.Subnetwork{
+				{Name: "sn-" + testWf + "-bdg12", Region: "regions/us-central1", Description: desc("Subnetwork", testWf), CreationTimestamp: old},
+			}, nil, nil
+		},
+		ListNetworksFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Network, error) {
+			return []*compute.Network{
+				{Name: "net-" + testWf + "-bdg12", Description: desc("Network", testWf), CreationTimestamp: old},
+			}, nil
+		},
+	}
+
+	orphans, scopes, err := w.FindOrphans(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range orphans {
+		got = append(got, o.String())
+	}
+	want := []string{
+		fmt.Sprintf("instance %q in us-central1-a", "vm-"+testWf+"-bdg12"),
+		fmt.Sprintf("disk %q in us-central1-a", "disk-"+testWf+"-bdg12"),
+		fmt.Sprintf("subnetwork %q in us-central1", "sn-"+testWf+"-bdg12"),
+		fmt.Sprintf("network %q", "net-"+testWf+"-bdg12"),
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("unexpected orphans, diff: %s", diff)
+	}
+	if diff := pretty.Compare(scopes, []daisyCompute.ScopeStatus{unreachable}); diff != "" {
+		t.Errorf("unexpected scopes, diff: %s", diff)
+	}
+}
+
+func TestDeleteOrphan(t *testing.T) {
+	w := testWorkflow()
+	var deleted []string
+	netLink := fmt.Sprintf("projects/%s/global/networks/net", testProject)
+	w.ComputeClient = &daisyCompute.TestClient{
+		DeleteInstanceFn: func(_, zone, name string) error { deleted = append(deleted, "instance "+zone+"/"+name); return nil },
+		DeleteDiskFn: func(_, _, _ string) error {
+			// Deleted with its instance.
+			return &googleapi.Error{Code: http.StatusNotFound}
+		},
+		GetNetworkFn: func(_, name string) (*compute.Network, error) {
+			return &compute.Network{Name: name, SelfLink: netLink}, nil
+		},
+		ListFirewallRulesFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Firewall, error) {
+			return []*compute.Firewall{{Name: "fr", Network: netLink, Description: "Firewall created by Daisy in workflow \"wf\" on behalf of someone."}}, nil
+		},
+		DeleteFirewallRuleFn: func(_, name string) error { deleted = append(deleted, "firewall "+name); return nil },
+		DeleteNetworkFn:      func(_, name string) error { deleted = append(deleted, "network "+name); return nil },
+	}
+
+	for _, o := range []*Orphan{
+		{Type: "instance", Name: "vm", Scope: "z"},
+		{Type: "disk", Name: "disk", Scope: "z"},
+		{Type: "network", Name: "net"},
+	} {
+		if err := w.DeleteOrphan(o); err != nil {
+			t.Errorf("unexpected error deleting %s: %v", o, err)
+		}
+	}
+	want := []string{"instance z/vm", "firewall fr", "network net"}
+	if diff := pretty.Compare(deleted, want); diff != "" {
+		t.Errorf("unexpected deletions, diff: %s", diff)
+	}
+	if err := w.DeleteOrphan(&Orphan{Type: "image", Name: "img"}); err == nil {
+		t.Error("expected error for unknown orphan type")
+	}
+}
@@ -0,0 +1,122 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ChunkName returns the name of the i-th chunk of file name, following the
+// OVF convention of a nine digit, zero padded suffix.
+func ChunkName(name string, i int) string {
+	return fmt.Sprintf("%s.%09d", name, i)
+}
+
+// ChunkWriter splits the data written to it into files of at most ChunkSize
+// bytes, named as returned by ChunkName, for targets that can't handle large
+// files. The file written for a disk is referenced by an ovf:File element
+// with ovf:chunkSize set to ChunkSize.
+type ChunkWriter struct {
+	// Name is the file name the chunk names are derived from.
+	Name string
+	// ChunkSize is the maximum size of each chunk, in bytes.
+	ChunkSize int64
+	// Create opens a writer for the named chunk, for example a GCS object
+	// writer.
+	Create func(name string) (io.WriteCloser, error)
+	// Manifest, if set, records the digest of each chunk.
+	Manifest *Manifest
+
+	chunks  []string
+	cur     io.WriteCloser
+	curName string
+	curHash hash.Hash
+	written int64
+}
+
+// Write implements io.Writer.
+func (c *ChunkWriter) Write(p []byte) (int, error) {
+	if c.ChunkSize <= 0 {
+		return 0, errors.New("chunk size must be positive")
+	}
+	var n int
+	for len(p) > 0 {
+		if c.cur == nil || c.written == c.ChunkSize {
+			if err := c.next(); err != nil {
+				return n, err
+			}
+		}
+		b := p
+		if rem := c.ChunkSize - c.written; int64(len(b)) > rem {
+			b = b[:rem]
+		}
+		m, err := c.cur.Write(b)
+		if c.curHash != nil {
+			c.curHash.Write(b[:m])
+		}
+		n += m
+		c.written += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (c *ChunkWriter) next() error {
+	if err := c.closeCurrent(); err != nil {
+		return err
+	}
+	name := ChunkName(c.Name, len(c.chunks))
+	w, err := c.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating chunk %q: %v", name, err)
+	}
+	c.cur, c.curName, c.written = w, name, 0
+	if c.Manifest != nil {
+		c.curHash = c.Manifest.NewHash()
+	}
+	c.chunks = append(c.chunks, name)
+	return nil
+}
+
+func (c *ChunkWriter) closeCurrent() error {
+	if c.cur == nil {
+		return nil
+	}
+	err := c.cur.Close()
+	c.cur = nil
+	if err != nil {
+		return fmt.Errorf("error closing chunk %q: %v", c.curName, err)
+	}
+	if c.curHash != nil {
+		c.Manifest.AddDigest(c.curName, c.curHash.Sum(nil))
+	}
+	return nil
+}
+
+// Close closes the last chunk.
+func (c *ChunkWriter) Close() error {
+	return c.closeCurrent()
+}
+
+// Chunks returns the names of the chunks written so far.
+func (c *ChunkWriter) Chunks() []string {
+	return c.chunks
+}
@@ -0,0 +1,91 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bufCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestChunkWriter(t *testing.T) {
+	files := map[string]*bufCloser{}
+	m, err := NewManifest(SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ChunkWriter{
+		Name:      "disk.vmdk",
+		ChunkSize: 4,
+		Create: func(name string) (io.WriteCloser, error) {
+			files[name] = &bufCloser{}
+			return files[name], nil
+		},
+		Manifest: m,
+	}
+	for _, s := range []string{"abc", "defgh", "ij"} {
+		if _, err := c.Write([]byte(s)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"disk.vmdk.000000000": "abcd",
+		"disk.vmdk.000000001": "efgh",
+		"disk.vmdk.000000002": "ij",
+	}
+	wantChunks := []string{"disk.vmdk.000000000", "disk.vmdk.000000001", "disk.vmdk.000000002"}
+	if !reflect.DeepEqual(c.Chunks(), wantChunks) {
+		t.Errorf("unexpected chunks: %v", c.Chunks())
+	}
+	for name, content := range want {
+		f, ok := files[name]
+		if !ok {
+			t.Errorf("chunk %q not created", name)
+			continue
+		}
+		if f.String() != content || !f.closed {
+			t.Errorf("chunk %q: got %q, closed=%t, want %q", name, f.String(), f.closed, content)
+		}
+		if _, ok := m.Digest(name); !ok {
+			t.Errorf("chunk %q not in manifest", name)
+		}
+	}
+	if got := strings.Count(string(m.Bytes()), "\n"); got != 3 {
+		t.Errorf("expected 3 manifest entries, got %d", got)
+	}
+}
+
+func TestChunkWriterInvalidSize(t *testing.T) {
+	c := &ChunkWriter{Name: "disk.vmdk"}
+	if _, err := c.Write([]byte("a")); err == nil {
+		t.Error("expected error for zero chunk size")
+	}
+}
@@ -0,0 +1,500 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Namespaces of the elements and attributes of OVF 1.0 descriptors.
+const (
+	ovfNamespace  = "http://schemas.dmtf.org/ovf/envelope/1"
+	rasdNamespace = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData"
+	vssdNamespace = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData"
+	vmwNamespace  = "http://www.vmware.com/schema/ovf"
+)
+
+// CIM resource types of virtual hardware items.
+const (
+	resourceTypeOther    = 1
+	resourceTypeCPU      = 3
+	resourceTypeMemory   = 4
+	resourceTypeEthernet = 10
+	resourceTypeDisk     = 17
+)
+
+// Envelope is the subset of an OVF descriptor needed to import a package.
+type Envelope struct {
+	XMLName       xml.Name       `xml:"Envelope"`
+	References    []File         `xml:"References>File"`
+	Disks         []VirtualDisk  `xml:"DiskSection>Disk"`
+	VirtualSystem *VirtualSystem `xml:"VirtualSystem"`
+}
+
+// File is a file of an OVF package.
+type File struct {
+	ID        string `xml:"id,attr"`
+	Href      string `xml:"href,attr"`
+	Size      int64  `xml:"size,attr"`
+	ChunkSize int64  `xml:"chunkSize,attr"`
+}
+
+// VirtualDisk is a disk of the DiskSection of an OVF descriptor.
+type VirtualDisk struct {
+	DiskID                  string `xml:"diskId,attr"`
+	FileRef                 string `xml:"fileRef,attr"`
+	Capacity                string `xml:"capacity,attr"`
+	CapacityAllocationUnits string `xml:"capacityAllocationUnits,attr"`
+	Format                  string `xml:"format,attr"`
+}
+
+// VirtualSystem is the virtual machine described by an OVF descriptor.
+type VirtualSystem struct {
+	ID              string                  `xml:"id,attr"`
+	Name            string                  `xml:"Name"`
+	OperatingSystem *OperatingSystemSection `xml:"OperatingSystemSection"`
+	Items           []Item                  `xml:"VirtualHardwareSection>Item"`
+	// Configs are the vmw:Config extensions of the VirtualHardwareSection.
+	Configs  []Config         `xml:"VirtualHardwareSection>Config"`
+	Products []ProductSection `xml:"ProductSection"`
+}
+
+// Config is a vmw:Config extension of a VirtualHardwareSection, a key-value
+// hint for the virtualization platform, e.g. key "firmware" and value "efi".
+type Config struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ProductSection describes the software of a virtual system and its
+// properties, e.g. vApp properties.
+type ProductSection struct {
+	Class      string     `xml:"class,attr"`
+	Instance   string     `xml:"instance,attr"`
+	Product    string     `xml:"Product"`
+	Properties []Property `xml:"Property"`
+}
+
+// Property is a property of a ProductSection.
+type Property struct {
+	Key              string `xml:"key,attr"`
+	Type             string `xml:"type,attr"`
+	Value            string `xml:"value,attr"`
+	UserConfigurable bool   `xml:"userConfigurable,attr"`
+}
+
+// OperatingSystemSection is the guest OS declared by an OVF descriptor.
+type OperatingSystemSection struct {
+	ID          int    `xml:"id,attr"`
+	OSType      string `xml:"osType,attr"`
+	Description string `xml:"Description"`
+}
+
+// Item is a virtual hardware item.
+type Item struct {
+	ResourceType    int    `xml:"ResourceType"`
+	VirtualQuantity int64  `xml:"VirtualQuantity"`
+	AllocationUnits string `xml:"AllocationUnits"`
+	ResourceSubType string `xml:"ResourceSubType"`
+	HostResource    string `xml:"HostResource"`
+	AddressOnParent string `xml:"AddressOnParent"`
+}
+
+// Config returns the value of the vmw:Config extension key of vs.
+func (vs *VirtualSystem) Config(key string) (string, bool) {
+	for _, c := range vs.Configs {
+		if c.Key == key {
+			return c.Value, true
+		}
+	}
+	return "", false
+}
+
+// Properties returns the values of the properties of the ProductSections of
+// vs, keyed by their full OVF name, "class.key.instance" with the class and
+// instance omitted when empty.
+func (vs *VirtualSystem) Properties() map[string]string {
+	props := map[string]string{}
+	for _, p := range vs.Products {
+		for _, prop := range p.Properties {
+			name := prop.Key
+			if p.Class != "" {
+				name = p.Class + "." + name
+			}
+			if p.Instance != "" {
+				name += "." + p.Instance
+			}
+			props[name] = prop.Value
+		}
+	}
+	return props
+}
+
+// ParseDescriptor parses the OVF descriptor read from r.
+func ParseDescriptor(r io.Reader) (*Envelope, error) {
+	var e Envelope
+	if err := xml.NewDecoder(r).Decode(&e); err != nil {
+		return nil, fmt.Errorf("error parsing OVF descriptor: %v", err)
+	}
+	if e.VirtualSystem == nil {
+		return nil, errors.New("OVF descriptor has no VirtualSystem, VirtualSystemCollection is not supported")
+	}
+	return &e, nil
+}
+
+// elementNames are the rasd:ElementName of the hardware items of each
+// resource type.
+var elementNames = map[int]string{
+	resourceTypeOther:    "Other",
+	resourceTypeCPU:      "Virtual CPUs",
+	resourceTypeMemory:   "Memory",
+	resourceTypeEthernet: "Network adapter",
+	resourceTypeDisk:     "Hard disk",
+}
+
+// descriptorEncoder encodes the elements of an OVF descriptor, keeping the
+// first error.
+type descriptorEncoder struct {
+	enc *xml.Encoder
+	err error
+}
+
+// start starts element name with the attributes attrs, given as name and
+// value pairs. Attributes with an empty value are left out.
+func (d *descriptorEncoder) start(name string, attrs ...string) {
+	se := xml.StartElement{Name: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			se.Attr = append(se.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+		}
+	}
+	if d.err == nil {
+		d.err = d.enc.EncodeToken(se)
+	}
+}
+
+func (d *descriptorEncoder) end(name string) {
+	if d.err == nil {
+		d.err = d.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// element encodes element name holding text, left out if text is empty.
+func (d *descriptorEncoder) element(name, text string) {
+	if text == "" {
+		return
+	}
+	d.start(name)
+	if d.err == nil {
+		d.err = d.enc.EncodeToken(xml.CharData(text))
+	}
+	d.end(name)
+}
+
+// number formats n, empty if zero so that the attribute or element is left
+// out.
+func number(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// MarshalXML encodes e as an OVF 1.0 descriptor: the ovf, rasd, vssd and vmw
+// namespaces are declared on the Envelope, and the elements and attributes
+// are prefixed with theirs. The Info elements OVF requires in each section,
+// and the rasd:InstanceID and rasd:ElementName of hardware items, are
+// generated.
+func (e *Envelope) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	d := &descriptorEncoder{enc: enc}
+	d.start("Envelope", "xmlns", ovfNamespace, "xmlns:ovf", ovfNamespace, "xmlns:rasd", rasdNamespace, "xmlns:vssd", vssdNamespace, "xmlns:vmw", vmwNamespace)
+	d.start("References")
+	for _, f := range e.References {
+		d.start("File", "ovf:id", f.ID, "ovf:href", f.Href, "ovf:size", number(f.Size), "ovf:chunkSize", number(f.ChunkSize))
+		d.end("File")
+	}
+	d.end("References")
+	d.start("DiskSection")
+	d.element("Info", "Virtual disk information")
+	for _, vd := range e.Disks {
+		d.start("Disk", "ovf:diskId", vd.DiskID, "ovf:fileRef", vd.FileRef, "ovf:capacity", vd.Capacity, "ovf:capacityAllocationUnits", vd.CapacityAllocationUnits, "ovf:format", vd.Format)
+		d.end("Disk")
+	}
+	d.end("DiskSection")
+
+	if vs := e.VirtualSystem; vs != nil {
+		d.start("VirtualSystem", "ovf:id", vs.ID)
+		d.element("Info", "A virtual machine")
+		d.element("Name", vs.Name)
+		if os := vs.OperatingSystem; os != nil {
+			d.start("OperatingSystemSection", "ovf:id", strconv.Itoa(os.ID), "vmw:osType", os.OSType)
+			d.element("Info", "The kind of installed guest operating system")
+			d.element("Description", os.Description)
+			d.end("OperatingSystemSection")
+		}
+		d.start("VirtualHardwareSection")
+		d.element("Info", "Virtual hardware requirements")
+		for i, it := range vs.Items {
+			name, ok := elementNames[it.ResourceType]
+			if !ok {
+				name = "Item"
+			}
+			// The rasd elements are in the alphabetical order of their schema.
+			d.start("Item")
+			d.element("rasd:AddressOnParent", it.AddressOnParent)
+			d.element("rasd:AllocationUnits", it.AllocationUnits)
+			d.element("rasd:ElementName", name)
+			d.element("rasd:HostResource", it.HostResource)
+			d.element("rasd:InstanceID", strconv.Itoa(i+1))
+			d.element("rasd:ResourceSubType", it.ResourceSubType)
+			d.element("rasd:ResourceType", strconv.Itoa(it.ResourceType))
+			d.element("rasd:VirtualQuantity", number(it.VirtualQuantity))
+			d.end("Item")
+		}
+		for _, c := range vs.Configs {
+			d.start("vmw:Config", "ovf:required", "false", "vmw:key", c.Key, "vmw:value", c.Value)
+			d.end("vmw:Config")
+		}
+		d.end("VirtualHardwareSection")
+		for _, p := range vs.Products {
+			d.start("ProductSection", "ovf:class", p.Class, "ovf:instance", p.Instance)
+			d.element("Info", "Information about the installed software")
+			d.element("Product", p.Product)
+			for _, prop := range p.Properties {
+				d.start("Property", "ovf:key", prop.Key, "ovf:type", prop.Type, "ovf:value", prop.Value, "ovf:userConfigurable", strconv.FormatBool(prop.UserConfigurable))
+				d.end("Property")
+			}
+			d.end("ProductSection")
+		}
+		d.end("VirtualSystem")
+	}
+	d.end("Envelope")
+	return d.err
+}
+
+// WriteDescriptor validates e and writes it to w as an OVF descriptor. An
+// invalid descriptor is not written, so that it fails the export rather
+// than the import on the destination hypervisor.
+func WriteDescriptor(w io.Writer, e *Envelope) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(e); err != nil {
+		return fmt.Errorf("error writing OVF descriptor: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Validate checks the structure of e: required attributes, unique ids and
+// references between files, disks and hardware items. It reports every
+// problem found, located by element, so malformed descriptors are caught
+// before they are used.
+func (e *Envelope) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	files := map[string]bool{}
+	for i, f := range e.References {
+		loc := fmt.Sprintf("References/File[%d]", i+1)
+		switch {
+		case f.ID == "":
+			add("%s: missing ovf:id", loc)
+		case files[f.ID]:
+			add("%s: duplicate ovf:id %q", loc, f.ID)
+		}
+		files[f.ID] = true
+		if f.Href == "" {
+			add("%s: missing ovf:href", loc)
+		}
+		if f.Size < 0 || f.ChunkSize < 0 {
+			add("%s: negative ovf:size or ovf:chunkSize", loc)
+		}
+	}
+
+	disks := map[string]bool{}
+	for i, d := range e.Disks {
+		loc := fmt.Sprintf("DiskSection/Disk[%d]", i+1)
+		switch {
+		case d.DiskID == "":
+			add("%s: missing ovf:diskId", loc)
+		case disks[d.DiskID]:
+			add("%s: duplicate ovf:diskId %q", loc, d.DiskID)
+		}
+		disks[d.DiskID] = true
+		if d.FileRef != "" && !files[d.FileRef] {
+			add("%s: ovf:fileRef %q not found in References", loc, d.FileRef)
+		}
+		if _, err := strconv.ParseInt(d.Capacity, 10, 64); err != nil {
+			add("%s: invalid ovf:capacity %q", loc, d.Capacity)
+		}
+		if _, err := parseAllocationUnits(d.CapacityAllocationUnits); err != nil {
+			add("%s: %v", loc, err)
+		}
+	}
+
+	vs := e.VirtualSystem
+	if vs == nil {
+		add("Envelope: missing VirtualSystem")
+	} else {
+		if vs.ID == "" {
+			add("VirtualSystem: missing ovf:id")
+		}
+		for i, it := range vs.Items {
+			loc := fmt.Sprintf("VirtualSystem/VirtualHardwareSection/Item[%d]", i+1)
+			if it.ResourceType <= 0 {
+				add("%s: missing rasd:ResourceType", loc)
+			}
+			if it.ResourceType == resourceTypeDisk {
+				id := it.HostResource[strings.LastIndex(it.HostResource, "/")+1:]
+				if !strings.HasPrefix(it.HostResource, "ovf:/disk/") || !disks[id] {
+					add("%s: rasd:HostResource %q is not a disk of the DiskSection", loc, it.HostResource)
+				}
+			}
+		}
+		for i, p := range vs.Products {
+			keys := map[string]bool{}
+			for j, prop := range p.Properties {
+				loc := fmt.Sprintf("VirtualSystem/ProductSection[%d]/Property[%d]", i+1, j+1)
+				switch {
+				case prop.Key == "":
+					add("%s: missing ovf:key", loc)
+				case keys[prop.Key]:
+					add("%s: duplicate ovf:key %q", loc, prop.Key)
+				}
+				keys[prop.Key] = true
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid OVF descriptor: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// DiskFile is a disk of the virtual system and the file holding its content.
+type DiskFile struct {
+	File
+	CapacityBytes int64
+	Format        string
+}
+
+// Hardware is the virtual hardware of an OVF virtual system.
+type Hardware struct {
+	CPUs     int64
+	MemoryMB int64
+	// Disks in the order they are declared, the first one is the boot disk.
+	Disks []DiskFile
+	NICs  int
+	// Firmware is "efi" or "bios" as declared by the "firmware" vmw:Config
+	// extension, empty if not declared.
+	Firmware string
+	// SecureBoot is set if the EFI firmware has secure boot enabled.
+	SecureBoot bool
+	// VTPM is set if the virtual system has a virtual TPM.
+	VTPM bool
+}
+
+// parseAllocationUnits returns the number of bytes of the units given in
+// the "byte * 2^N" notation used by OVF. An empty string means bytes.
+func parseAllocationUnits(s string) (int64, error) {
+	s = strings.Replace(s, " ", "", -1)
+	if s == "" || s == "byte" {
+		return 1, nil
+	}
+	if !strings.HasPrefix(s, "byte*2^") {
+		return 0, fmt.Errorf("unsupported allocation units %q", s)
+	}
+	exp, err := strconv.Atoi(strings.TrimPrefix(s, "byte*2^"))
+	if err != nil || exp < 0 || exp > 62 {
+		return 0, fmt.Errorf("unsupported allocation units %q", s)
+	}
+	return 1 << uint(exp), nil
+}
+
+// Hardware summarizes the virtual hardware of the virtual system of e.
+func (e *Envelope) Hardware() (*Hardware, error) {
+	files := map[string]File{}
+	for _, f := range e.References {
+		files[f.ID] = f
+	}
+	disks := map[string]VirtualDisk{}
+	for _, d := range e.Disks {
+		disks[d.DiskID] = d
+	}
+
+	hw := &Hardware{}
+	if fw, ok := e.VirtualSystem.Config(firmwareConfigKey); ok {
+		hw.Firmware = strings.ToLower(fw)
+	}
+	if sb, ok := e.VirtualSystem.Config(secureBootConfigKey); ok {
+		hw.SecureBoot = strings.EqualFold(sb, "true")
+	}
+	for _, it := range e.VirtualSystem.Items {
+		switch it.ResourceType {
+		case resourceTypeCPU:
+			hw.CPUs += it.VirtualQuantity
+		case resourceTypeMemory:
+			units, err := parseAllocationUnits(it.AllocationUnits)
+			if err != nil {
+				return nil, err
+			}
+			hw.MemoryMB += it.VirtualQuantity * units / (1 << 20)
+		case resourceTypeEthernet:
+			hw.NICs++
+		case resourceTypeOther:
+			if it.ResourceSubType == vtpmResourceSubType {
+				hw.VTPM = true
+			}
+		case resourceTypeDisk:
+			// HostResource is of the form "ovf:/disk/<diskId>".
+			id := it.HostResource[strings.LastIndex(it.HostResource, "/")+1:]
+			d, ok := disks[id]
+			if !ok {
+				return nil, fmt.Errorf("disk %q not found in DiskSection", it.HostResource)
+			}
+			f, ok := files[d.FileRef]
+			if !ok {
+				return nil, fmt.Errorf("file %q of disk %q not found in References", d.FileRef, id)
+			}
+			units, err := parseAllocationUnits(d.CapacityAllocationUnits)
+			if err != nil {
+				return nil, err
+			}
+			capacity, err := strconv.ParseInt(d.Capacity, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid capacity %q of disk %q", d.Capacity, id)
+			}
+			hw.Disks = append(hw.Disks, DiskFile{File: f, CapacityBytes: capacity * units, Format: d.Format})
+		}
+	}
+	if len(hw.Disks) == 0 {
+		return nil, errors.New("OVF virtual system has no disks")
+	}
+	return hw, nil
+}
@@ -0,0 +1,278 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData">
+  <References>
+    <File ovf:id="file1" ovf:href="vm-disk1.vmdk" ovf:size="1000"/>
+    <File ovf:id="file2" ovf:href="vm-disk2.vmdk" ovf:size="2000" ovf:chunkSize="1000"/>
+  </References>
+  <DiskSection>
+    <Disk ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:capacity="20" ovf:capacityAllocationUnits="byte * 2^30" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+    <Disk ovf:diskId="vmdisk2" ovf:fileRef="file2" ovf:capacity="1048576"/>
+  </DiskSection>
+  <VirtualSystem ovf:id="vm">
+    <Name>vm</Name>
+    <OperatingSystemSection ovf:id="96" vmw:osType="debian10_64Guest" xmlns:vmw="http://www.vmware.com/schema/ovf">
+      <Description>Debian GNU/Linux 10 (64-bit)</Description>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Item><rasd:ResourceType>3</rasd:ResourceType><rasd:VirtualQuantity>3</rasd:VirtualQuantity></Item>
+      <Item><rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits><rasd:ResourceType>4</rasd:ResourceType><rasd:VirtualQuantity>4096</rasd:VirtualQuantity></Item>
+      <Item><rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource><rasd:ResourceType>17</rasd:ResourceType></Item>
+      <Item><rasd:HostResource>ovf:/disk/vmdisk2</rasd:HostResource><rasd:ResourceType>17</rasd:ResourceType></Item>
+      <Item><rasd:ResourceType>10</rasd:ResourceType></Item>
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="efi" xmlns:vmw="http://www.vmware.com/schema/ovf"/>
+    </VirtualHardwareSection>
+    <ProductSection ovf:class="com.example.app">
+      <Product>App</Product>
+      <Property ovf:key="port" ovf:type="int" ovf:value="8080" ovf:userConfigurable="true"/>
+    </ProductSection>
+    <ProductSection>
+      <Property ovf:key="env" ovf:type="string" ovf:value="prod"/>
+    </ProductSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+func TestParseDescriptor(t *testing.T) {
+	e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.VirtualSystem.Name != "vm" {
+		t.Errorf("unexpected name %q", e.VirtualSystem.Name)
+	}
+	if os := e.VirtualSystem.OperatingSystem; os == nil || os.ID != 96 || os.OSType != "debian10_64Guest" {
+		t.Errorf("unexpected operating system %+v", os)
+	}
+
+	hw, err := e.Hardware()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &Hardware{
+		CPUs:     3,
+		MemoryMB: 4096,
+		NICs:     1,
+		Firmware: "efi",
+		Disks: []DiskFile{
+			{File: File{ID: "file1", Href: "vm-disk1.vmdk", Size: 1000}, CapacityBytes: 20 << 30, Format: "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"},
+			{File: File{ID: "file2", Href: "vm-disk2.vmdk", Size: 2000, ChunkSize: 1000}, CapacityBytes: 1 << 20},
+		},
+	}
+	if !reflect.DeepEqual(hw, want) {
+		t.Errorf("unexpected hardware:\n%+v\nwant:\n%+v", hw, want)
+	}
+
+	wantProps := map[string]string{"com.example.app.port": "8080", "env": "prod"}
+	if got := e.VirtualSystem.Properties(); !reflect.DeepEqual(got, wantProps) {
+		t.Errorf("unexpected properties %v, want %v", got, wantProps)
+	}
+	if p := e.VirtualSystem.Products[0]; p.Product != "App" || !p.Properties[0].UserConfigurable {
+		t.Errorf("unexpected product section %+v", p)
+	}
+	if _, ok := e.VirtualSystem.Config("nested-hv"); ok {
+		t.Error("unexpected value for undeclared vmw:Config key")
+	}
+
+	if _, err := ParseDescriptor(strings.NewReader("<Envelope></Envelope>")); err == nil {
+		t.Error("expected error for descriptor without VirtualSystem")
+	}
+	if _, err := ParseDescriptor(strings.NewReader("not xml")); err == nil {
+		t.Error("expected error for invalid descriptor")
+	}
+}
+
+const testMarshalledDescriptor = `<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf">
+  <References>
+    <File ovf:id="file1" ovf:href="vm-disk1.vmdk" ovf:size="1000" ovf:chunkSize="500"></File>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:capacity="20" ovf:capacityAllocationUnits="byte * 2^30" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"></Disk>
+  </DiskSection>
+  <VirtualSystem ovf:id="vm">
+    <Info>A virtual machine</Info>
+    <Name>vm</Name>
+    <OperatingSystemSection ovf:id="96" vmw:osType="debian10_64Guest">
+      <Info>The kind of installed guest operating system</Info>
+      <Description>Debian GNU/Linux 10 (64-bit)</Description>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <Item>
+        <rasd:ElementName>Virtual CPUs</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>2</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:ElementName>Memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>4096</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard disk</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:ElementName>Network adapter</rasd:ElementName>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="efi"></vmw:Config>
+    </VirtualHardwareSection>
+    <ProductSection ovf:class="com.example.app">
+      <Info>Information about the installed software</Info>
+      <Product>App</Product>
+      <Property ovf:key="port" ovf:type="int" ovf:value="8080" ovf:userConfigurable="true"></Property>
+    </ProductSection>
+  </VirtualSystem>
+</Envelope>`
+
+func TestMarshalDescriptor(t *testing.T) {
+	e := &Envelope{
+		References: []File{{ID: "file1", Href: "vm-disk1.vmdk", Size: 1000, ChunkSize: 500}},
+		Disks:      []VirtualDisk{{DiskID: "vmdisk1", FileRef: "file1", Capacity: "20", CapacityAllocationUnits: "byte * 2^30", Format: "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"}},
+		VirtualSystem: &VirtualSystem{
+			ID:              "vm",
+			Name:            "vm",
+			OperatingSystem: &OperatingSystemSection{ID: 96, OSType: "debian10_64Guest", Description: "Debian GNU/Linux 10 (64-bit)"},
+			Items: []Item{
+				{ResourceType: resourceTypeCPU, VirtualQuantity: 2},
+				{ResourceType: resourceTypeMemory, VirtualQuantity: 4096, AllocationUnits: "byte * 2^20"},
+				{ResourceType: resourceTypeDisk, HostResource: "ovf:/disk/vmdisk1", AddressOnParent: "0"},
+				{ResourceType: resourceTypeEthernet},
+			},
+			Configs:  []Config{{Key: firmwareConfigKey, Value: "efi"}},
+			Products: []ProductSection{{Class: "com.example.app", Product: "App", Properties: []Property{{Key: "port", Type: "int", Value: "8080", UserConfigurable: true}}}},
+		},
+	}
+	b, err := xml.MarshalIndent(e, "", "  ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != testMarshalledDescriptor {
+		t.Errorf("unexpected descriptor:\n%s\nwant:\n%s", b, testMarshalledDescriptor)
+	}
+
+	// The descriptor parses back to e.
+	got, err := ParseDescriptor(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got.XMLName = xml.Name{}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("descriptor parsed to:\n%+v\nwant:\n%+v", got, e)
+	}
+}
+
+func TestParseAllocationUnits(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"byte", 1, false},
+		{"byte * 2^20", 1 << 20, false},
+		{"byte*2^30", 1 << 30, false},
+		{"MegaBytes", 0, true},
+		{"byte * 2^x", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAllocationUnits(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAllocationUnits(%q) = %d, %v; want %d, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Validate(); err != nil {
+		t.Errorf("unexpected error for valid descriptor: %v", err)
+	}
+
+	e.References = append(e.References, File{ID: "file1"})
+	e.Disks[1].FileRef = "missing"
+	e.Disks[1].Capacity = "big"
+	e.VirtualSystem.Items[2].HostResource = "ovf:/disk/nope"
+	e.VirtualSystem.Products[0].Properties = append(e.VirtualSystem.Products[0].Properties, Property{Key: "port"})
+	err = e.Validate()
+	if err == nil {
+		t.Fatal("expected error for invalid descriptor")
+	}
+	for _, want := range []string{
+		`References/File[3]: duplicate ovf:id "file1"`,
+		"References/File[3]: missing ovf:href",
+		`DiskSection/Disk[2]: ovf:fileRef "missing" not found in References`,
+		`DiskSection/Disk[2]: invalid ovf:capacity "big"`,
+		`VirtualSystem/VirtualHardwareSection/Item[3]: rasd:HostResource "ovf:/disk/nope" is not a disk of the DiskSection`,
+		`VirtualSystem/ProductSection[1]/Property[2]: duplicate ovf:key "port"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+}
+
+func TestWriteDescriptor(t *testing.T) {
+	e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteDescriptor(&buf, e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header+"<Envelope ") {
+		t.Errorf("descriptor does not start with the XML header: %q", buf.String())
+	}
+	got, err := ParseDescriptor(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the written descriptor: %v", err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("written descriptor parsed to:\n%+v\nwant:\n%+v", got, e)
+	}
+
+	e.Disks[0].Capacity = "big"
+	buf.Reset()
+	if err := WriteDescriptor(&buf, e); err == nil || !strings.Contains(err.Error(), `invalid ovf:capacity "big"`) {
+		t.Errorf("got error %v, want the invalid capacity", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("invalid descriptor written: %q", buf.String())
+	}
+}
@@ -0,0 +1,113 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"fmt"
+	"strconv"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// vmw:Config keys and hardware item subtypes describing the firmware.
+const (
+	firmwareConfigKey   = "firmware"
+	secureBootConfigKey = "bootOptions.efiSecureBootEnabled"
+	vtpmResourceSubType = "vmware.vtpm"
+)
+
+// Guest OS features of GCE disks.
+const (
+	uefiCompatible = "UEFI_COMPATIBLE"
+	secureBoot     = "SECURE_BOOT"
+)
+
+func hasGuestOSFeature(features []*compute.GuestOsFeature, feature string) bool {
+	for _, f := range features {
+		if f != nil && f.Type == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// FirmwareHardware returns the vmw:Config extensions and hardware items of
+// a virtual system booting from a disk with the guest OS features features:
+// an EFI firmware for UEFI_COMPATIBLE disks, with secure boot and a virtual
+// TPM for SECURE_BOOT ones. Without them, hypervisors default to BIOS and
+// UEFI disks don't boot. Nothing is returned for BIOS disks.
+func FirmwareHardware(features []*compute.GuestOsFeature) ([]Config, []Item) {
+	if !hasGuestOSFeature(features, uefiCompatible) {
+		return nil, nil
+	}
+	configs := []Config{{Key: firmwareConfigKey, Value: "efi"}}
+	if !hasGuestOSFeature(features, secureBoot) {
+		return configs, nil
+	}
+	configs = append(configs, Config{Key: secureBootConfigKey, Value: "true"})
+	return configs, []Item{{ResourceType: resourceTypeOther, ResourceSubType: vtpmResourceSubType}}
+}
+
+// NewEnvelope returns the descriptor of a virtual system named name with the
+// CPUs, memory, NICs and disks of hw, for exporting it. The first disk boots.
+// The firmware elements follow features, the guest OS features of the boot
+// disk, see FirmwareHardware. The firmware fields of hw are not used. Disks
+// without a file ID get one.
+func NewEnvelope(name string, hw *Hardware, features []*compute.GuestOsFeature) *Envelope {
+	e := &Envelope{VirtualSystem: &VirtualSystem{ID: name, Name: name}}
+	vs := e.VirtualSystem
+	vs.Items = append(vs.Items,
+		Item{ResourceType: resourceTypeCPU, VirtualQuantity: hw.CPUs},
+		Item{ResourceType: resourceTypeMemory, VirtualQuantity: hw.MemoryMB, AllocationUnits: "byte * 2^20"})
+	for i, d := range hw.Disks {
+		f := d.File
+		if f.ID == "" {
+			f.ID = fmt.Sprintf("file%d", i+1)
+		}
+		id := fmt.Sprintf("vmdisk%d", i+1)
+		e.References = append(e.References, f)
+		e.Disks = append(e.Disks, VirtualDisk{DiskID: id, FileRef: f.ID, Capacity: strconv.FormatInt(d.CapacityBytes, 10), CapacityAllocationUnits: "byte", Format: d.Format})
+		vs.Items = append(vs.Items, Item{ResourceType: resourceTypeDisk, HostResource: "ovf:/disk/" + id, AddressOnParent: strconv.Itoa(i)})
+	}
+	for i := 0; i < hw.NICs; i++ {
+		vs.Items = append(vs.Items, Item{ResourceType: resourceTypeEthernet})
+	}
+	configs, items := FirmwareHardware(features)
+	vs.Configs = configs
+	vs.Items = append(vs.Items, items...)
+	return e
+}
+
+// guestOSFeatures returns the guest OS features of the boot disk of a GCE
+// instance matching the firmware of hw.
+func guestOSFeatures(hw *Hardware) []*compute.GuestOsFeature {
+	if hw.Firmware != "efi" {
+		return nil
+	}
+	features := []*compute.GuestOsFeature{{Type: uefiCompatible}}
+	if hw.SecureBoot {
+		features = append(features, &compute.GuestOsFeature{Type: secureBoot})
+	}
+	return features
+}
+
+// shieldedInstanceConfig returns the shielded VM options of a GCE instance
+// matching the firmware of hw, nil if it doesn't need any.
+func shieldedInstanceConfig(hw *Hardware) *compute.ShieldedInstanceConfig {
+	if hw.Firmware != "efi" || (!hw.SecureBoot && !hw.VTPM) {
+		return nil
+	}
+	return &compute.ShieldedInstanceConfig{EnableSecureBoot: hw.SecureBoot, EnableVtpm: hw.VTPM}
+}
@@ -0,0 +1,121 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestFirmwareHardware(t *testing.T) {
+	tests := []struct {
+		desc           string
+		features       []string
+		wantHW         Hardware
+		wantShielded   *compute.ShieldedInstanceConfig
+		wantGuestFeats []string
+	}{
+		{"bios", nil, Hardware{}, nil, nil},
+		{"uefi", []string{"UEFI_COMPATIBLE"}, Hardware{Firmware: "efi"}, nil, []string{"UEFI_COMPATIBLE"}},
+		{
+			"secure boot",
+			[]string{"UEFI_COMPATIBLE", "SECURE_BOOT", "GVNIC"},
+			Hardware{Firmware: "efi", SecureBoot: true, VTPM: true},
+			&compute.ShieldedInstanceConfig{EnableSecureBoot: true, EnableVtpm: true},
+			[]string{"UEFI_COMPATIBLE", "SECURE_BOOT"},
+		},
+	}
+	for _, tt := range tests {
+		var features []*compute.GuestOsFeature
+		for _, f := range tt.features {
+			features = append(features, &compute.GuestOsFeature{Type: f})
+		}
+		configs, items := FirmwareHardware(features)
+
+		// What an export emits is what an import reads.
+		e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.VirtualSystem.Configs = configs
+		e.VirtualSystem.Items = append(e.VirtualSystem.Items, items...)
+		hw, err := e.Hardware()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if hw.Firmware != tt.wantHW.Firmware || hw.SecureBoot != tt.wantHW.SecureBoot || hw.VTPM != tt.wantHW.VTPM {
+			t.Errorf("%s: got firmware %q, secure boot %t, vTPM %t, want %+v", tt.desc, hw.Firmware, hw.SecureBoot, hw.VTPM, tt.wantHW)
+		}
+		if got := shieldedInstanceConfig(hw); !reflect.DeepEqual(got, tt.wantShielded) {
+			t.Errorf("%s: got shielded instance config %+v, want %+v", tt.desc, got, tt.wantShielded)
+		}
+		var gotFeats []string
+		for _, f := range guestOSFeatures(hw) {
+			gotFeats = append(gotFeats, f.Type)
+		}
+		if !reflect.DeepEqual(gotFeats, tt.wantGuestFeats) {
+			t.Errorf("%s: got guest OS features %v, want %v", tt.desc, gotFeats, tt.wantGuestFeats)
+		}
+	}
+}
+
+func TestNewEnvelope(t *testing.T) {
+	hw := &Hardware{
+		CPUs:     2,
+		MemoryMB: 8192,
+		NICs:     1,
+		Disks: []DiskFile{
+			{File: File{Href: "vm-disk1.vmdk", Size: 1000}, CapacityBytes: 20 << 30, Format: "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"},
+			{File: File{ID: "data", Href: "vm-disk2.vmdk", Size: 2000}, CapacityBytes: 100 << 30},
+		},
+	}
+	tests := []struct {
+		desc     string
+		features []string
+		wantHW   Hardware
+	}{
+		{"bios", nil, Hardware{}},
+		{"secure boot", []string{"UEFI_COMPATIBLE", "SECURE_BOOT"}, Hardware{Firmware: "efi", SecureBoot: true, VTPM: true}},
+	}
+	for _, tt := range tests {
+		var features []*compute.GuestOsFeature
+		for _, f := range tt.features {
+			features = append(features, &compute.GuestOsFeature{Type: f})
+		}
+		var buf bytes.Buffer
+		if err := WriteDescriptor(&buf, NewEnvelope("vm", hw, features)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		e, err := ParseDescriptor(&buf)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		got, err := e.Hardware()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		want := *hw
+		want.Disks = []DiskFile{hw.Disks[0], hw.Disks[1]}
+		want.Disks[0].ID = "file1"
+		want.Firmware, want.SecureBoot, want.VTPM = tt.wantHW.Firmware, tt.wantHW.SecureBoot, tt.wantHW.VTPM
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("%s: exported hardware read back as:\n%+v\nwant:\n%+v", tt.desc, got, &want)
+		}
+	}
+}
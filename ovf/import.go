@@ -0,0 +1,312 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	defaultImportWorkerImage  = "projects/debian-cloud/global/images/family/" + defaultImportWorkerFamily
+	defaultImportWorkerFamily = "debian-11"
+	importSuccessMatch        = "OVFImport: success"
+	importFailureMatch        = "OVFImport: failed:"
+	importDeviceName          = "ovf-disk-%d"
+	minDiskSizeGb             = 10
+	slicedDownloadThreshold   = "150M"
+	gib                       = 1 << 30
+)
+
+// ImportOptions configures the workflow built by ImportWorkflow.
+type ImportOptions struct {
+	// PackageDir is the GCS directory holding the extracted package files,
+	// "gs://bucket/path".
+	PackageDir string
+	// InstanceName is the name of the imported instance, disks are named
+	// after it.
+	InstanceName string
+	// MachineType overrides the machine type picked from the descriptor.
+	MachineType string
+	// WorkerImage is the image of the instance converting the disks,
+	// defaults to the latest Debian 11 image.
+	WorkerImage string
+	// WorkerMachineType is the machine type of the workers, defaults to the
+	// Daisy default. Larger machine types get more network bandwidth.
+	WorkerMachineType string
+	// WorkerDiskType is the type of the worker boot disks, which hold the
+	// downloaded disk files, e.g. "pd-ssd". Defaults to the Daisy default.
+	WorkerDiskType string
+	// Workers is the number of workers converting the disks in parallel,
+	// each converting every Workers-th disk. Defaults to 1, converting the
+	// disks one after the other.
+	Workers int
+	// SlicedDownloads downloads each disk file that is not split into
+	// chunks with parallel ranged requests, which is faster for large files
+	// on workers with enough bandwidth.
+	SlicedDownloads bool
+}
+
+// WorkerImageFrom returns the partial URL of the latest image of family,
+// defaulting to the Debian 11 family, from the first of projects that has
+// it, e.g. an internal mirror before "debian-cloud". Use it to set
+// ImportOptions.WorkerImage where public images can't be used.
+func WorkerImageFrom(c daisyCompute.Client, family string, projects ...string) (string, error) {
+	if family == "" {
+		family = defaultImportWorkerFamily
+	}
+	img, project, err := c.GetImageFromFamilies(projects, family)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("projects/%s/global/images/%s", project, img.Name), nil
+}
+
+// machineFamily holds the custom machine type limits of a machine family.
+type machineFamily struct {
+	name     string
+	maxCPUs  int64
+	maxMemMB int64
+	// cpuStep returns what the vCPU count must be a multiple of for sizes of
+	// at least cpus vCPUs.
+	cpuStep func(cpus int64) int64
+}
+
+// machineFamilies are the families MachineTypeFor picks from, in order of
+// preference. Both allow 0.5 to 8 GB of memory per vCPU, in multiples of
+// 256 MB.
+var machineFamilies = []machineFamily{
+	{name: "e2", maxCPUs: 32, maxMemMB: 128 << 10, cpuStep: func(int64) int64 { return 2 }},
+	{name: "n2", maxCPUs: 80, maxMemMB: 640 << 10, cpuStep: func(cpus int64) int64 {
+		if cpus > 32 {
+			return 4
+		}
+		return 2
+	}},
+}
+
+// size returns the custom machine type size of f closest to the CPUs and
+// memory of hw, and whether hw fits in f.
+func (f machineFamily) size(hw *Hardware) (cpus, mem int64, fits bool) {
+	cpus = hw.CPUs
+	if cpus < 2 {
+		cpus = 2
+	}
+	step := f.cpuStep(cpus)
+	cpus = (cpus + step - 1) / step * step
+	fits = cpus <= f.maxCPUs
+	if !fits {
+		cpus = f.maxCPUs
+	}
+	mem = hw.MemoryMB
+	if min := cpus * 512; mem < min {
+		mem = min
+	}
+	if max := cpus * 8192; mem > max {
+		mem = max
+	}
+	mem = (mem + 255) / 256 * 256
+	if mem > f.maxMemMB {
+		mem, fits = f.maxMemMB, false
+	}
+	return cpus, mem, fits
+}
+
+// MachineTypeFor returns a custom machine type with at least the CPUs and
+// memory of hw, adjusted to the custom machine type constraints. It is an E2
+// machine type if hw fits, with up to 32 vCPUs and 128 GB, an N2 one
+// otherwise. hw larger than the largest N2 custom machine type gets that.
+func MachineTypeFor(hw *Hardware) string {
+	var f machineFamily
+	var cpus, mem int64
+	for _, f = range machineFamilies {
+		var fits bool
+		if cpus, mem, fits = f.size(hw); fits {
+			break
+		}
+	}
+	return fmt.Sprintf("%s-custom-%d-%d", f.name, cpus, mem)
+}
+
+func diskSizeGb(bytes int64) int64 {
+	gb := (bytes + gib - 1) / gib
+	if gb < minDiskSizeGb {
+		gb = minDiskSizeGb
+	}
+	return gb
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// importScript downloads the disk files of hw at indexes from dir and
+// converts them onto the disks attached with the matching importDeviceName.
+// Avoid ${} expansions, they would be taken for unresolved workflow vars.
+func importScript(dir string, hw *Hardware, indexes []int, sliced bool) string {
+	var b strings.Builder
+	b.WriteString(`#!/bin/bash
+exec >/dev/console 2>&1
+fail() { echo "` + importFailureMatch + ` $1"; exit 1; }
+apt-get -q update && apt-get -q -y install qemu-utils || fail "installing qemu-utils"
+mkdir -p /ovf
+`)
+	fmt.Fprintf(&b, "dir=%s\n", shellQuote(dir))
+	for _, i := range indexes {
+		d := hw.Disks[i]
+		local := fmt.Sprintf("/ovf/disk-%d", i)
+		fmt.Fprintf(&b, "href=%s\n", shellQuote(d.Href))
+		if d.ChunkSize > 0 {
+			fmt.Fprintf(&b, "gsutil -q cat \"$dir/$href.*\" > %s || fail \"downloading $href\"\n", local)
+		} else if sliced {
+			fmt.Fprintf(&b, "gsutil -q -o 'GSUtil:sliced_object_download_threshold=%s' cp \"$dir/$href\" %s || fail \"downloading $href\"\n", slicedDownloadThreshold, local)
+		} else {
+			fmt.Fprintf(&b, "gsutil -q cp \"$dir/$href\" %s || fail \"downloading $href\"\n", local)
+		}
+		fmt.Fprintf(&b, "qemu-img convert -O raw %s /dev/disk/by-id/google-%s || fail \"converting $href\"\n", local, fmt.Sprintf(importDeviceName, i))
+		fmt.Fprintf(&b, "rm -f %s\n", local)
+	}
+	b.WriteString(`echo "` + importSuccessMatch + `"` + "\n")
+	return b.String()
+}
+
+// ImportWorkflow builds a workflow that imports the OVF package described by
+// e, whose files were uploaded to opts.PackageDir. The workflow creates a disk
+// per virtual disk, converts the disk files onto them with worker instances,
+// and creates an instance matching the virtual hardware, booting with UEFI,
+// secure boot and a virtual TPM if the descriptor declares them. The disks and
+// the instance keep their exact names and are left when the workflow ends. The
+// caller
+// sets the workflow project, zone and GCS path.
+func ImportWorkflow(e *Envelope, opts ImportOptions) (*daisy.Workflow, error) {
+	if !strings.HasPrefix(opts.PackageDir, "gs://") {
+		return nil, fmt.Errorf("package directory %q is not a GCS path", opts.PackageDir)
+	}
+	if opts.InstanceName == "" {
+		return nil, errors.New("no instance name given")
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	hw, err := e.Hardware()
+	if err != nil {
+		return nil, err
+	}
+	dir := strings.TrimSuffix(opts.PackageDir, "/")
+	workerImage := opts.WorkerImage
+	if workerImage == "" {
+		workerImage = defaultImportWorkerImage
+	}
+	machineType := opts.MachineType
+	if machineType == "" {
+		machineType = MachineTypeFor(hw)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(hw.Disks) {
+		workers = len(hw.Disks)
+	}
+
+	w := daisy.New()
+	w.Name = "import-ovf"
+	createDisks, _ := w.NewStep("create-disks")
+	createDisks.CreateDisks = &daisy.CreateDisks{}
+	workerNames := make([]string, workers)
+	workerIndexes := make([][]int, workers)
+	workerDisks := make([][]*compute.AttachedDisk, workers)
+	scratch := make([]int64, workers)
+	for n := range workerNames {
+		workerNames[n] = opts.InstanceName + "-ovf-worker"
+		if workers > 1 {
+			workerNames[n] += fmt.Sprintf("-%d", n)
+		}
+		workerDisks[n] = []*compute.AttachedDisk{{AutoDelete: true}}
+	}
+	instanceDisks := []*compute.AttachedDisk{}
+	for i, d := range hw.Disks {
+		name := fmt.Sprintf("%s-disk-%d", opts.InstanceName, i)
+		disk := &daisy.Disk{
+			Disk:     compute.Disk{Name: name},
+			Resource: daisy.Resource{NoCleanup: true, ExactName: true},
+			SizeGb:   strconv.FormatInt(diskSizeGb(d.CapacityBytes), 10),
+		}
+		if i == 0 {
+			disk.GuestOsFeatures = guestOSFeatures(hw)
+		}
+		*createDisks.CreateDisks = append(*createDisks.CreateDisks, disk)
+		n := i % workers
+		workerIndexes[n] = append(workerIndexes[n], i)
+		workerDisks[n] = append(workerDisks[n], &compute.AttachedDisk{Source: name, DeviceName: fmt.Sprintf(importDeviceName, i)})
+		instanceDisks = append(instanceDisks, &compute.AttachedDisk{Source: name, Boot: i == 0})
+		size := d.Size
+		if size == 0 {
+			size = d.CapacityBytes
+		}
+		scratch[n] += size
+	}
+
+	createWorker, _ := w.NewStep("create-worker")
+	createWorker.CreateInstances = &daisy.CreateInstances{}
+	waitWorker, _ := w.NewStep("wait-worker")
+	waitWorker.WaitForInstancesSignal = &daisy.WaitForInstancesSignal{}
+	for n, name := range workerNames {
+		// The worker boot disk holds every disk file the worker downloads.
+		workerDisks[n][0].InitializeParams = &compute.AttachedDiskInitializeParams{
+			SourceImage: workerImage,
+			DiskSizeGb:  diskSizeGb(scratch[n]) + minDiskSizeGb,
+			DiskType:    opts.WorkerDiskType,
+		}
+		createWorker.CreateInstances.Instances = append(createWorker.CreateInstances.Instances, &daisy.Instance{
+			Instance: compute.Instance{Name: name, MachineType: opts.WorkerMachineType, Disks: workerDisks[n]},
+			Metadata: map[string]string{"startup-script": importScript(dir, hw, workerIndexes[n], opts.SlicedDownloads)},
+		})
+		*waitWorker.WaitForInstancesSignal = append(*waitWorker.WaitForInstancesSignal, &daisy.InstanceSignal{
+			Name: name,
+			SerialOutput: &daisy.SerialOutput{
+				Port:         1,
+				SuccessMatch: importSuccessMatch,
+				FailureMatch: daisy.FailureMatches{importFailureMatch},
+			},
+		})
+	}
+	deleteWorker, _ := w.NewStep("delete-worker")
+	deleteWorker.DeleteResources = &daisy.DeleteResources{Instances: workerNames}
+	createInstance, _ := w.NewStep("create-instance")
+	createInstance.CreateInstances = &daisy.CreateInstances{Instances: []*daisy.Instance{{
+		Instance: compute.Instance{
+			Name:                   opts.InstanceName,
+			MachineType:            machineType,
+			Disks:                  instanceDisks,
+			ShieldedInstanceConfig: shieldedInstanceConfig(hw),
+		},
+		InstanceBase: daisy.InstanceBase{Resource: daisy.Resource{NoCleanup: true, ExactName: true}},
+	}}}
+
+	w.AddDependency(createWorker, createDisks)
+	w.AddDependency(waitWorker, createWorker)
+	w.AddDependency(deleteWorker, waitWorker)
+	w.AddDependency(createInstance, deleteWorker)
+	return w, nil
+}
@@ -0,0 +1,184 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestMachineTypeFor(t *testing.T) {
+	tests := []struct {
+		cpus, mem int64
+		want      string
+	}{
+		{1, 512, "e2-custom-2-1024"},
+		{3, 4096, "e2-custom-4-4096"},
+		{2, 1000, "e2-custom-2-1024"},
+		{2, 100000, "e2-custom-2-16384"},
+		{32, 0, "e2-custom-32-16384"},
+		{16, 200000, "e2-custom-16-131072"},
+		{20, 200000, "n2-custom-20-163840"},
+		{34, 0, "n2-custom-36-18432"},
+		{64, 262144, "n2-custom-64-262144"},
+		{100, 0, "n2-custom-80-40960"},
+	}
+	for _, tt := range tests {
+		if got := MachineTypeFor(&Hardware{CPUs: tt.cpus, MemoryMB: tt.mem}); got != tt.want {
+			t.Errorf("MachineTypeFor(%d, %d) = %q, want %q", tt.cpus, tt.mem, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerImageFrom(t *testing.T) {
+	var gotProjects []string
+	var gotFamily string
+	c := &daisyCompute.TestClient{GetImageFromFamiliesFn: func(projects []string, family string) (*compute.Image, string, error) {
+		gotProjects, gotFamily = projects, family
+		return &compute.Image{Name: "debian-11-v20220101"}, "mirror", nil
+	}}
+	got, err := WorkerImageFrom(c, "", "mirror", "debian-cloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/mirror/global/images/debian-11-v20220101"; got != want {
+		t.Errorf("got image %q, want %q", got, want)
+	}
+	if gotFamily != "debian-11" || !reflect.DeepEqual(gotProjects, []string{"mirror", "debian-cloud"}) {
+		t.Errorf("looked family %q up in %v, want %q in [mirror debian-cloud]", gotFamily, gotProjects, "debian-11")
+	}
+}
+
+func TestImportWorkflow(t *testing.T) {
+	e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportWorkflow(e, ImportOptions{PackageDir: "/local", InstanceName: "vm"}); err == nil {
+		t.Error("expected error for non GCS package directory")
+	}
+	if _, err := ImportWorkflow(e, ImportOptions{PackageDir: "gs://bucket/vm"}); err == nil {
+		t.Error("expected error for missing instance name")
+	}
+
+	w, err := ImportWorkflow(e, ImportOptions{PackageDir: "gs://bucket/vm/", InstanceName: "vm"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantDeps := map[string][]string{
+		"create-worker":   {"create-disks"},
+		"wait-worker":     {"create-worker"},
+		"delete-worker":   {"wait-worker"},
+		"create-instance": {"delete-worker"},
+	}
+	if !reflect.DeepEqual(w.Dependencies, wantDeps) {
+		t.Errorf("unexpected dependencies: %v", w.Dependencies)
+	}
+
+	disks := *w.Steps["create-disks"].CreateDisks
+	if len(disks) != 2 || disks[0].Name != "vm-disk-0" || disks[0].SizeGb != "20" || disks[1].SizeGb != "10" {
+		t.Errorf("unexpected disks: %+v, %+v", disks[0], disks[1])
+	}
+	for _, d := range disks {
+		if !d.NoCleanup || !d.ExactName {
+			t.Errorf("disk %q should be kept with its exact name: NoCleanup=%t, ExactName=%t", d.Name, d.NoCleanup, d.ExactName)
+		}
+	}
+	if f := disks[0].GuestOsFeatures; len(f) != 1 || f[0].Type != "UEFI_COMPATIBLE" || disks[1].GuestOsFeatures != nil {
+		t.Errorf("only the boot disk of an EFI virtual system should be UEFI compatible: %+v, %+v", disks[0].GuestOsFeatures, disks[1].GuestOsFeatures)
+	}
+
+	worker := w.Steps["create-worker"].CreateInstances.Instances[0]
+	script := worker.Metadata["startup-script"]
+	for _, want := range []string{
+		"dir='gs://bucket/vm'",
+		"href='vm-disk1.vmdk'",
+		`gsutil -q cp "$dir/$href" /ovf/disk-0`,
+		"href='vm-disk2.vmdk'",
+		`gsutil -q cat "$dir/$href.*" > /ovf/disk-1`,
+		"/dev/disk/by-id/google-ovf-disk-1",
+		importSuccessMatch,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("startup script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "${") {
+		t.Error("startup script contains ${}, which would be taken for a workflow var")
+	}
+	if len(worker.Disks) != 3 || worker.Disks[2].DeviceName != "ovf-disk-1" {
+		t.Errorf("unexpected worker disks: %+v", worker.Disks)
+	}
+
+	inst := w.Steps["create-instance"].CreateInstances.Instances[0]
+	if inst.MachineType != "e2-custom-4-4096" || len(inst.Disks) != 2 || !inst.Disks[0].Boot || inst.Disks[1].Boot {
+		t.Errorf("unexpected instance: %+v", inst.Instance)
+	}
+	if !inst.NoCleanup || !inst.ExactName {
+		t.Errorf("instance should be kept with its exact name: NoCleanup=%t, ExactName=%t", inst.NoCleanup, inst.ExactName)
+	}
+	if worker.NoCleanup {
+		t.Error("worker should be cleaned up")
+	}
+}
+
+func TestImportWorkflowWorkerOptions(t *testing.T) {
+	e, err := ParseDescriptor(strings.NewReader(testDescriptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := ImportWorkflow(e, ImportOptions{
+		PackageDir:        "gs://bucket/vm",
+		InstanceName:      "vm",
+		WorkerMachineType: "n2-standard-8",
+		WorkerDiskType:    "pd-ssd",
+		Workers:           4,
+		SlicedDownloads:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// There are only two disks to convert, one per worker.
+	workers := w.Steps["create-worker"].CreateInstances.Instances
+	if len(workers) != 2 {
+		t.Fatalf("got %d workers, want 2", len(workers))
+	}
+	for n, worker := range workers {
+		if want := fmt.Sprintf("vm-ovf-worker-%d", n); worker.Name != want {
+			t.Errorf("got worker name %q, want %q", worker.Name, want)
+		}
+		if worker.MachineType != "n2-standard-8" || worker.Disks[0].InitializeParams.DiskType != "pd-ssd" {
+			t.Errorf("worker %d: unexpected machine type %q or disk type %q", n, worker.MachineType, worker.Disks[0].InitializeParams.DiskType)
+		}
+		if len(worker.Disks) != 2 || worker.Disks[1].DeviceName != fmt.Sprintf(importDeviceName, n) {
+			t.Errorf("worker %d: unexpected disks: %+v", n, worker.Disks)
+		}
+	}
+	if script := workers[0].Metadata["startup-script"]; !strings.Contains(script, "sliced_object_download_threshold") || strings.Contains(script, "disk-1") {
+		t.Errorf("unexpected script for worker 0:\n%s", script)
+	}
+	if got := len(*w.Steps["wait-worker"].WaitForInstancesSignal); got != 2 {
+		t.Errorf("waiting for %d workers, want 2", got)
+	}
+	if got := w.Steps["delete-worker"].DeleteResources.Instances; !reflect.DeepEqual(got, []string{"vm-ovf-worker-0", "vm-ovf-worker-1"}) {
+		t.Errorf("unexpected workers deleted: %v", got)
+	}
+}
@@ -0,0 +1,135 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Manifest digest algorithms.
+const (
+	SHA1   = "SHA1"
+	SHA256 = "SHA256"
+)
+
+// Manifest is an OVF manifest (.mf) file listing the digests of the files of
+// an OVF package. Manifest is safe for concurrent use.
+type Manifest struct {
+	algorithm string
+	hash      crypto.Hash
+	mx        sync.Mutex
+	digests   map[string][]byte
+}
+
+// NewManifest creates an empty Manifest using algorithm, SHA1 or SHA256.
+func NewManifest(algorithm string) (*Manifest, error) {
+	h, err := hashFor(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{algorithm: algorithm, hash: h, digests: map[string][]byte{}}, nil
+}
+
+func hashFor(algorithm string) (crypto.Hash, error) {
+	switch algorithm {
+	case SHA1:
+		return crypto.SHA1, nil
+	case SHA256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("unsupported manifest algorithm %q, must be %q or %q", algorithm, SHA1, SHA256)
+}
+
+// NewHash returns a hash to compute a digest for AddDigest while a file is
+// being written.
+func (m *Manifest) NewHash() hash.Hash {
+	if m.hash == crypto.SHA1 {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// Add reads r to the end and records its digest for file name.
+func (m *Manifest) Add(name string, r io.Reader) error {
+	h := m.NewHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("error computing digest of %q: %v", name, err)
+	}
+	m.AddDigest(name, h.Sum(nil))
+	return nil
+}
+
+// AddDigest records digest for file name.
+func (m *Manifest) AddDigest(name string, digest []byte) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.digests[name] = digest
+}
+
+// Digest returns the digest recorded for file name.
+func (m *Manifest) Digest(name string) ([]byte, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	d, ok := m.digests[name]
+	return d, ok
+}
+
+// Bytes returns the content of the manifest file, one "ALG(name)= digest"
+// line per file, sorted by file name.
+func (m *Manifest) Bytes() []byte {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	var names []string
+	for name := range m.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s(%s)= %s\n", m.algorithm, name, hex.EncodeToString(m.digests[name]))
+	}
+	return b.Bytes()
+}
+
+// Sign returns the content of the certificate (.cert) file of an OVF package
+// whose manifest file is named manifestName: the signature of manifest by
+// signer, followed by the PEM encoded certificate of the signing key.
+// signer can be backed by a local key or by a KMS.
+func Sign(manifestName string, manifest []byte, algorithm string, signer crypto.Signer, certPEM []byte) ([]byte, error) {
+	h, err := hashFor(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	hasher := h.New()
+	hasher.Write(manifest)
+	sig, err := signer.Sign(rand.Reader, hasher.Sum(nil), h)
+	if err != nil {
+		return nil, fmt.Errorf("error signing manifest: %v", err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s(%s)= %s\n", algorithm, manifestName, hex.EncodeToString(sig))
+	b.Write(certPEM)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	if _, err := NewManifest("MD5"); err == nil {
+		t.Error("expected error for unsupported algorithm")
+	}
+
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{SHA1, "SHA1(disk.vmdk)= 0a4d55a8d778e5022fab701977c5d840bbc486d0\nSHA1(vm.ovf)= 86f7e437faa5a7fce15d1ddcb9eaeaea377667b8\n"},
+		{SHA256, "SHA256(disk.vmdk)= a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e\nSHA256(vm.ovf)= ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb\n"},
+	}
+	for _, tt := range tests {
+		m, err := NewManifest(tt.algorithm)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.algorithm, err)
+		}
+		if err := m.Add("vm.ovf", strings.NewReader("a")); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.algorithm, err)
+		}
+		h := m.NewHash()
+		h.Write([]byte("Hello World"))
+		m.AddDigest("disk.vmdk", h.Sum(nil))
+		if got := string(m.Bytes()); got != tt.want {
+			t.Errorf("%s: unexpected manifest:\n%s\nwant:\n%s", tt.algorithm, got, tt.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := []byte("SHA256(vm.ovf)= abc\n")
+	cert := []byte("-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n")
+	got, err := Sign("vm.mf", manifest, SHA256, key, cert)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.SplitN(string(got), "\n", 2)
+	prefix := "SHA256(vm.mf)= "
+	if !strings.HasPrefix(lines[0], prefix) {
+		t.Fatalf("unexpected signature line %q", lines[0])
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(lines[0], prefix))
+	if err != nil {
+		t.Fatalf("bad signature encoding: %v", err)
+	}
+	digest := sha256.Sum256(manifest)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if lines[1] != string(cert) {
+		t.Errorf("certificate not appended, got %q", lines[1])
+	}
+}
@@ -0,0 +1,159 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package ovf provides building blocks for exporting GCE disks to, and
+// importing them from, OVF packages.
+package ovf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OperatingSystem is the content of an OVF OperatingSystemSection.
+type OperatingSystem struct {
+	// ID is the CIM_OperatingSystem OSType value.
+	ID int
+	// Description is the CIM name of ID.
+	Description string
+	// VMwareOSType is the vmw:osType attribute used by vSphere.
+	VMwareOSType string
+}
+
+var (
+	otherOS   = OperatingSystem{1, "Other", "otherGuest"}
+	other64OS = OperatingSystem{102, "Other 64-Bit", "otherGuest64"}
+	linuxOS   = OperatingSystem{36, "LINUX", "otherLinuxGuest"}
+	linux64OS = OperatingSystem{101, "Linux 64-Bit", "otherLinux64Guest"}
+)
+
+// osEntry maps an inspected distro and version prefix to its OS.
+type osEntry struct {
+	distro, version string
+	os32, os64      OperatingSystem
+}
+
+// Entries are matched in order, so more specific versions come first.
+// CIM has no ids for Windows Server releases after 2012 R2, vSphere relies
+// on vmw:osType for those.
+var osEntries = []osEntry{
+	{"windows", "2008r2", OperatingSystem{}, OperatingSystem{103, "Microsoft Windows Server 2008 R2", "windows7Server64Guest"}},
+	{"windows", "2008", OperatingSystem{76, "Microsoft Windows Server 2008", "winLonghornGuest"}, OperatingSystem{77, "Microsoft Windows Server 2008 64-Bit", "winLonghorn64Guest"}},
+	{"windows", "2012r2", OperatingSystem{}, OperatingSystem{115, "Microsoft Windows Server 2012 R2", "windows8Server64Guest"}},
+	{"windows", "2012", OperatingSystem{}, OperatingSystem{112, "Microsoft Windows Server 2012", "windows8Server64Guest"}},
+	{"windows", "2016", OperatingSystem{}, OperatingSystem{1, "Other", "windows9Server64Guest"}},
+	{"windows", "2019", OperatingSystem{}, OperatingSystem{1, "Other", "windows2019srv_64Guest"}},
+	{"windows", "2022", OperatingSystem{}, OperatingSystem{1, "Other", "windows2019srvNext_64Guest"}},
+	{"windows", "7", OperatingSystem{105, "Microsoft Windows 7", "windows7Guest"}, OperatingSystem{105, "Microsoft Windows 7", "windows7_64Guest"}},
+	{"windows", "", otherOS, OperatingSystem{102, "Other 64-Bit", "windows9_64Guest"}},
+	{"rhel", "6", OperatingSystem{79, "RedHat Enterprise Linux", "rhel6Guest"}, OperatingSystem{80, "RedHat Enterprise Linux 64-Bit", "rhel6_64Guest"}},
+	{"rhel", "7", OperatingSystem{79, "RedHat Enterprise Linux", "rhel7Guest"}, OperatingSystem{80, "RedHat Enterprise Linux 64-Bit", "rhel7_64Guest"}},
+	{"rhel", "8", OperatingSystem{79, "RedHat Enterprise Linux", "rhel8Guest"}, OperatingSystem{80, "RedHat Enterprise Linux 64-Bit", "rhel8_64Guest"}},
+	{"rhel", "", OperatingSystem{79, "RedHat Enterprise Linux", "rhel7Guest"}, OperatingSystem{80, "RedHat Enterprise Linux 64-Bit", "rhel7_64Guest"}},
+	{"centos", "6", OperatingSystem{106, "CentOS 32-bit", "centos6Guest"}, OperatingSystem{107, "CentOS 64-bit", "centos6_64Guest"}},
+	{"centos", "7", OperatingSystem{106, "CentOS 32-bit", "centos7Guest"}, OperatingSystem{107, "CentOS 64-bit", "centos7_64Guest"}},
+	{"centos", "8", OperatingSystem{106, "CentOS 32-bit", "centos8Guest"}, OperatingSystem{107, "CentOS 64-bit", "centos8_64Guest"}},
+	{"centos", "", OperatingSystem{106, "CentOS 32-bit", "centosGuest"}, OperatingSystem{107, "CentOS 64-bit", "centos64Guest"}},
+	{"ol", "", OperatingSystem{108, "Oracle Linux 32-bit", "oracleLinuxGuest"}, OperatingSystem{109, "Oracle Linux 64-bit", "oracleLinux64Guest"}},
+	{"sles", "", OperatingSystem{84, "SLES", "slesGuest"}, OperatingSystem{85, "SLES 64-Bit", "sles64Guest"}},
+	{"opensuse", "", OperatingSystem{82, "SUSE", "suseGuest"}, OperatingSystem{83, "SUSE 64-Bit", "suse64Guest"}},
+	{"ubuntu", "", OperatingSystem{93, "Ubuntu", "ubuntuGuest"}, OperatingSystem{94, "Ubuntu 64-Bit", "ubuntu64Guest"}},
+	{"debian", "10", OperatingSystem{95, "Debian", "debian10Guest"}, OperatingSystem{96, "Debian 64-Bit", "debian10_64Guest"}},
+	{"debian", "11", OperatingSystem{95, "Debian", "debian11Guest"}, OperatingSystem{96, "Debian 64-Bit", "debian11_64Guest"}},
+	{"debian", "9", OperatingSystem{95, "Debian", "debian9Guest"}, OperatingSystem{96, "Debian 64-Bit", "debian9_64Guest"}},
+	{"debian", "", OperatingSystem{95, "Debian", "debian10Guest"}, OperatingSystem{96, "Debian 64-Bit", "debian10_64Guest"}},
+}
+
+// windowsReleases maps the build numbers InspectDisk reports for Windows,
+// CurrentBuildNumber, to the Windows Server releases of osEntries. Client
+// releases share these builds, e.g. 7601 is Windows 7 SP1 too, they are
+// taken as the server release.
+var windowsReleases = map[string]string{
+	"6001":  "2008",
+	"6002":  "2008",
+	"6003":  "2008",
+	"7600":  "2008r2",
+	"7601":  "2008r2",
+	"9200":  "2012",
+	"9600":  "2012r2",
+	"14393": "2016",
+	"17763": "2019",
+	"20348": "2022",
+}
+
+// OperatingSystemFor returns the OperatingSystemSection content for an
+// inspected disk. distro is the os-release ID of a Linux distribution, or
+// "windows", and version its version, e.g. "7.9", or for Windows the release,
+// e.g. "2012r2", or the build number, e.g. "9600". Unknown distros map to
+// generic Linux or Other values.
+func OperatingSystemFor(distro, version string, is64Bit bool) OperatingSystem {
+	distro = strings.ToLower(distro)
+	version = strings.ToLower(strings.Replace(version, " ", "", -1))
+	if r, ok := windowsReleases[version]; ok && distro == "windows" {
+		version = r
+	}
+	for _, e := range osEntries {
+		if e.distro != distro || !strings.HasPrefix(version, e.version) {
+			continue
+		}
+		if is64Bit {
+			return e.os64
+		}
+		if e.os32.ID != 0 {
+			return e.os32
+		}
+	}
+	switch {
+	case distro == "" || distro == "unknown" || distro == "windows":
+		if is64Bit {
+			return other64OS
+		}
+		return otherOS
+	case is64Bit:
+		return linux64OS
+	}
+	return linuxOS
+}
+
+// OperatingSystemForOverride returns the OperatingSystemSection content for a
+// user provided override, either a vmw:osType such as "rhel7_64Guest" or a
+// CIM OSType id.
+func OperatingSystemForOverride(override string) (OperatingSystem, error) {
+	var id int
+	if _, err := fmt.Sscanf(override, "%d", &id); err == nil && fmt.Sprint(id) == override {
+		for _, os := range allOperatingSystems() {
+			if os.ID == id {
+				return OperatingSystem{ID: id, Description: os.Description}, nil
+			}
+		}
+		return OperatingSystem{}, fmt.Errorf("unknown CIM OSType id %d", id)
+	}
+	for _, os := range allOperatingSystems() {
+		if strings.EqualFold(os.VMwareOSType, override) {
+			return os, nil
+		}
+	}
+	return OperatingSystem{}, fmt.Errorf("unknown OS type %q", override)
+}
+
+func allOperatingSystems() []OperatingSystem {
+	all := []OperatingSystem{otherOS, other64OS, linuxOS, linux64OS}
+	for _, e := range osEntries {
+		if e.os32.ID != 0 {
+			all = append(all, e.os32)
+		}
+		all = append(all, e.os64)
+	}
+	return all
+}
@@ -0,0 +1,79 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import "testing"
+
+func TestOperatingSystemFor(t *testing.T) {
+	tests := []struct {
+		distro, version string
+		is64Bit         bool
+		wantID          int
+		wantOSType      string
+	}{
+		{"windows", "2008 R2", true, 103, "windows7Server64Guest"},
+		{"windows", "2008", false, 76, "winLonghornGuest"},
+		{"windows", "2012r2", true, 115, "windows8Server64Guest"},
+		{"windows", "2019", true, 1, "windows2019srv_64Guest"},
+		{"windows", "unknown", true, 102, "windows9_64Guest"},
+		// Build numbers, as reported by InspectDisk.
+		{"windows", "6003", false, 76, "winLonghornGuest"},
+		{"windows", "7601", true, 103, "windows7Server64Guest"},
+		{"windows", "9200", true, 112, "windows8Server64Guest"},
+		{"windows", "9600", true, 115, "windows8Server64Guest"},
+		{"windows", "14393", true, 1, "windows9Server64Guest"},
+		{"windows", "17763", true, 1, "windows2019srv_64Guest"},
+		{"windows", "20348", true, 1, "windows2019srvNext_64Guest"},
+		{"windows", "19045", true, 102, "windows9_64Guest"},
+		{"windows", "unknown", false, 1, "otherGuest"},
+		{"rhel", "7.9", true, 80, "rhel7_64Guest"},
+		{"centos", "8", false, 106, "centos8Guest"},
+		{"ubuntu", "20.04", true, 94, "ubuntu64Guest"},
+		{"debian", "11", true, 96, "debian11_64Guest"},
+		{"Debian", "12", true, 96, "debian10_64Guest"},
+		{"arch", "", true, 101, "otherLinux64Guest"},
+		{"arch", "", false, 36, "otherLinuxGuest"},
+		{"unknown", "unknown", true, 102, "otherGuest64"},
+	}
+	for _, tt := range tests {
+		got := OperatingSystemFor(tt.distro, tt.version, tt.is64Bit)
+		if got.ID != tt.wantID || got.VMwareOSType != tt.wantOSType {
+			t.Errorf("OperatingSystemFor(%q, %q, %v) = %+v, want id %d, osType %q", tt.distro, tt.version, tt.is64Bit, got, tt.wantID, tt.wantOSType)
+		}
+	}
+}
+
+func TestOperatingSystemForOverride(t *testing.T) {
+	tests := []struct {
+		override  string
+		wantID    int
+		shouldErr bool
+	}{
+		{"rhel7_64Guest", 80, false},
+		{"UBUNTU64GUEST", 94, false},
+		{"107", 107, false},
+		{"9999", 0, true},
+		{"bogusGuest", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := OperatingSystemForOverride(tt.override)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("OperatingSystemForOverride(%q): unexpected error result: %v", tt.override, err)
+		}
+		if got.ID != tt.wantID {
+			t.Errorf("OperatingSystemForOverride(%q) = %+v, want id %d", tt.override, got, tt.wantID)
+		}
+	}
+}
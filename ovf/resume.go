@@ -0,0 +1,97 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+// ExportMarkerSuffix is appended to the name of an exported object to name
+// its marker object.
+const ExportMarkerSuffix = ".exported"
+
+// ExportMarker records that a file, typically a disk, was fully exported to
+// Object, so that an export interrupted after some of the disks of an
+// instance can resume without exporting them again.
+type ExportMarker struct {
+	Object string
+	CRC32C uint32
+	MD5    []byte `json:",omitempty"`
+	// Digest is the manifest digest of the file, if the Checksummer computed
+	// one.
+	Digest []byte `json:",omitempty"`
+}
+
+// WriteExportMarker records that object of bucket was exported with the
+// checksums computed by c. Write it once the object is verified.
+func WriteExportMarker(ctx context.Context, s daisy.Storage, bucket, object string, c *Checksummer) error {
+	sums := c.Checksums()
+	m := ExportMarker{Object: object, CRC32C: sums.CRC32C, MD5: sums.MD5}
+	if c.digest != nil {
+		m.Digest = c.digest.Sum(nil)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, bucket, object+ExportMarkerSuffix, "application/json", bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("error writing export marker of gs://%s/%s: %v", bucket, object, err)
+	}
+	return nil
+}
+
+// Exported reports whether object of bucket was exported by a previous run:
+// its marker exists and the object still has the checksums recorded in it.
+// A resumed export skips the file if so. If m is not nil, the digest recorded
+// in the marker is added to m as name, and files exported without a digest
+// are reported as not exported.
+func Exported(ctx context.Context, s daisy.Storage, bucket, object string, m *Manifest, name string) (bool, error) {
+	var buf bytes.Buffer
+	if err := daisy.DownloadObject(ctx, s, bucket, object+ExportMarkerSuffix, &buf); err == storage.ErrObjectNotExist {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var marker ExportMarker
+	if err := json.Unmarshal(buf.Bytes(), &marker); err != nil {
+		return false, fmt.Errorf("error reading export marker of gs://%s/%s: %v", bucket, object, err)
+	}
+	if marker.Object != object {
+		return false, nil
+	}
+
+	attrs, err := s.Attrs(ctx, bucket, object)
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error getting attributes of gs://%s/%s: %v", bucket, object, err)
+	}
+	if VerifyChecksums(attrs, Checksums{CRC32C: marker.CRC32C, MD5: marker.MD5}) != nil {
+		return false, nil
+	}
+	if m != nil {
+		if marker.Digest == nil {
+			return false, nil
+		}
+		m.AddDigest(name, marker.Digest)
+	}
+	return true, nil
+}
@@ -0,0 +1,82 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	daisy "github.com/GoogleCloudPlatform/compute-daisy"
+)
+
+func TestExported(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc         string
+		marker       bool
+		digest       bool
+		overwrite    string
+		withManifest bool
+		want         bool
+	}{
+		{"exported", true, true, "", true, true},
+		{"no marker", false, true, "", true, false},
+		{"object changed", true, true, "other content", false, false},
+		{"no digest for manifest", true, false, "", true, false},
+		{"no digest needed", true, false, "", false, true},
+	}
+	for _, tt := range tests {
+		s := &daisy.FakeStorage{}
+		data := "disk content"
+		var m *Manifest
+		if tt.digest {
+			m, _ = NewManifest(SHA256)
+		}
+		c := NewChecksummer(m)
+		if err := s.Put(ctx, "bkt", "disk-1.vmdk", "", io.TeeReader(strings.NewReader(data), c)); err != nil {
+			t.Fatal(err)
+		}
+		if tt.marker {
+			if err := WriteExportMarker(ctx, s, "bkt", "disk-1.vmdk", c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.overwrite != "" {
+			s.Put(ctx, "bkt", "disk-1.vmdk", "", strings.NewReader(tt.overwrite))
+		}
+
+		var resumed *Manifest
+		if tt.withManifest {
+			resumed, _ = NewManifest(SHA256)
+		}
+		got, err := Exported(ctx, s, "bkt", "disk-1.vmdk", resumed, "disk-1.vmdk")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got exported %t, want %t", tt.desc, got, tt.want)
+		}
+		if got && resumed != nil {
+			want := sha256.Sum256([]byte(data))
+			if d, ok := resumed.Digest("disk-1.vmdk"); !ok || !bytes.Equal(d, want[:]) {
+				t.Errorf("%s: got manifest digest %x, want %x", tt.desc, d, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"hash/crc32"
+
+	"cloud.google.com/go/storage"
+)
+
+// Checksums of an exported file, as computed by the writer.
+type Checksums struct {
+	CRC32C uint32
+	MD5    []byte
+}
+
+// Checksummer computes the checksums GCS keeps for objects, and the manifest
+// digest, of the data written to it. Use it with an io.MultiWriter next to
+// the object writer.
+type Checksummer struct {
+	crc    hash.Hash32
+	md5    hash.Hash
+	digest hash.Hash
+}
+
+// NewChecksummer creates a Checksummer. m, if not nil, sets the manifest
+// digest algorithm.
+func NewChecksummer(m *Manifest) *Checksummer {
+	c := &Checksummer{crc: crc32.New(crc32.MakeTable(crc32.Castagnoli)), md5: md5.New()}
+	if m != nil {
+		c.digest = m.NewHash()
+	}
+	return c
+}
+
+// Write implements io.Writer.
+func (c *Checksummer) Write(p []byte) (int, error) {
+	c.crc.Write(p)
+	c.md5.Write(p)
+	if c.digest != nil {
+		c.digest.Write(p)
+	}
+	return len(p), nil
+}
+
+// Checksums returns the checksums of the data written so far.
+func (c *Checksummer) Checksums() Checksums {
+	return Checksums{CRC32C: c.crc.Sum32(), MD5: c.md5.Sum(nil)}
+}
+
+// VerifyChecksums compares sums with the checksums GCS computed for an
+// object. MD5 is not available for composite objects and is only checked
+// when present.
+func VerifyChecksums(attrs *storage.ObjectAttrs, sums Checksums) error {
+	if attrs.CRC32C != sums.CRC32C {
+		return fmt.Errorf("CRC32C mismatch for gs://%s/%s: computed %08x, GCS has %08x", attrs.Bucket, attrs.Name, sums.CRC32C, attrs.CRC32C)
+	}
+	if len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, sums.MD5) {
+		return fmt.Errorf("MD5 mismatch for gs://%s/%s: computed %x, GCS has %x", attrs.Bucket, attrs.Name, sums.MD5, attrs.MD5)
+	}
+	return nil
+}
+
+// VerifyObject checks the checksums computed by c while writing the object
+// against the ones computed by GCS, and records the file digest as name in
+// m if they match. m can be nil.
+func VerifyObject(ctx context.Context, obj *storage.ObjectHandle, c *Checksummer, m *Manifest, name string) error {
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting attributes of gs://%s/%s: %v", obj.BucketName(), obj.ObjectName(), err)
+	}
+	if err := VerifyChecksums(attrs, c.Checksums()); err != nil {
+		return err
+	}
+	if m != nil && c.digest != nil {
+		m.AddDigest(name, c.digest.Sum(nil))
+	}
+	return nil
+}
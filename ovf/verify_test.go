@@ -0,0 +1,51 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ovf
+
+import (
+	"crypto/md5"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	data := "disk content"
+	c := NewChecksummer(nil)
+	if _, err := io.Copy(c, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	crc := crc32.Checksum([]byte(data), crc32.MakeTable(crc32.Castagnoli))
+	sum := md5.Sum([]byte(data))
+
+	tests := []struct {
+		desc    string
+		attrs   *storage.ObjectAttrs
+		wantErr bool
+	}{
+		{"match", &storage.ObjectAttrs{CRC32C: crc, MD5: sum[:]}, false},
+		{"composite object without MD5", &storage.ObjectAttrs{CRC32C: crc}, false},
+		{"CRC32C mismatch", &storage.ObjectAttrs{CRC32C: crc + 1, MD5: sum[:]}, true},
+		{"MD5 mismatch", &storage.ObjectAttrs{CRC32C: crc, MD5: []byte("bad")}, true},
+	}
+	for _, tt := range tests {
+		if err := VerifyChecksums(tt.attrs, c.Checksums()); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+)
+
+// Policy decides whether a workflow may run, e.g. to deny external IPs,
+// enforce labels or cap machine sizes for an organization. An evaluator such
+// as OPA can implement it by evaluating the JSON of the workflow.
+type Policy interface {
+	// Evaluate inspects w, populated and with the steps of its nested
+	// workflows, before it is validated. It rejects w by returning an error,
+	// and may change w, e.g. to add labels or replace a machine type; the
+	// changed workflow is then validated.
+	Evaluate(ctx context.Context, w *Workflow) error
+}
+
+// PolicyFunc is a Policy implemented by a function.
+type PolicyFunc func(ctx context.Context, w *Workflow) error
+
+// Evaluate calls f.
+func (f PolicyFunc) Evaluate(ctx context.Context, w *Workflow) error {
+	return f(ctx, w)
+}
+
+// AddPolicies adds policies the workflow must comply with. They are evaluated
+// in order by Validate, so by Run, each seeing the changes of the previous
+// ones. The workflow is rejected if any of them returns an error.
+func (w *Workflow) AddPolicies(policies ...Policy) {
+	w.policies = append(w.policies, policies...)
+}
+
+// evaluatePolicies evaluates the policies of w, returning the errors of all
+// the policies rejecting it.
+func (w *Workflow) evaluatePolicies(ctx context.Context) DError {
+	var errs DError
+	for _, p := range w.policies {
+		if err := p.Evaluate(ctx, w); err != nil {
+			errs = addErrs(errs, Errf("workflow rejected by policy: %v", err))
+		}
+	}
+	return errs
+}
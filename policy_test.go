@@ -0,0 +1,131 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// denyExternalIPs rejects workflows creating instances with external IPs.
+var denyExternalIPs = PolicyFunc(func(ctx context.Context, w *Workflow) error {
+	var denied []string
+	walkSteps(w, func(s *Step) {
+		if s.CreateInstances == nil {
+			return
+		}
+		for _, i := range s.CreateInstances.Instances {
+			for _, ni := range i.NetworkInterfaces {
+				if len(ni.AccessConfigs) > 0 {
+					denied = append(denied, i.daisyName)
+				}
+			}
+		}
+	})
+	if len(denied) > 0 {
+		return fmt.Errorf("instances %q have external IPs", denied)
+	}
+	return nil
+})
+
+// requireTeamLabel labels the instances of workflows with a team label.
+var requireTeamLabel = PolicyFunc(func(ctx context.Context, w *Workflow) error {
+	for _, t := range w.labelTargets() {
+		if *t.labels == nil {
+			*t.labels = map[string]string{}
+		}
+		if _, ok := (*t.labels)["team"]; !ok {
+			(*t.labels)["team"] = "images"
+		}
+	}
+	return nil
+})
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc       string
+		externalIP bool
+		policies   []Policy
+		wantErrs   []string
+		wantLabels map[string]string
+	}{
+		{"no policies", true, nil, nil, nil},
+		{"allowed", false, []Policy{denyExternalIPs}, nil, nil},
+		{"mutated", false, []Policy{requireTeamLabel, denyExternalIPs}, nil, map[string]string{"team": "images"}},
+		{"denied", true, []Policy{denyExternalIPs, requireTeamLabel}, []string{`instances ["i"] have external IPs`}, map[string]string{"team": "images"}},
+		{"all rejections", true, []Policy{denyExternalIPs, PolicyFunc(func(context.Context, *Workflow) error { return errors.New("no") })}, []string{`instances ["i"] have external IPs`, "no"}, nil},
+	}
+
+	for _, tt := range tests {
+		w := testWorkflow()
+		i := &Instance{Instance: compute.Instance{Name: "i", Disks: []*compute.AttachedDisk{{Source: "d"}}}}
+		if !tt.externalIP {
+			i.NetworkInterfaces = []*compute.NetworkInterface{{Network: "default", AccessConfigs: []*compute.AccessConfig{}}}
+		}
+		w.Steps = map[string]*Step{
+			"create": {w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i}}},
+		}
+		if err := w.populate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		w.AddPolicies(tt.policies...)
+		var evaluated bool
+		w.AddPolicies(PolicyFunc(func(context.Context, *Workflow) error { evaluated = true; return nil }))
+
+		err := w.evaluatePolicies(ctx)
+		if !evaluated {
+			t.Errorf("%s: policies not all evaluated", tt.desc)
+		}
+		var gotErrs []string
+		if err != nil {
+			for _, e := range err.errors() {
+				gotErrs = append(gotErrs, strings.TrimPrefix(e.Error(), "workflow rejected by policy: "))
+			}
+		}
+		if diffRes := diff(gotErrs, tt.wantErrs, 0); diffRes != "" {
+			t.Errorf("%s: policy errors do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+		if diffRes := diff(i.Labels, tt.wantLabels, 0); diffRes != "" {
+			t.Errorf("%s: labels do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
+
+func TestValidateEvaluatesPolicies(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	var validated bool
+	w.Steps = map[string]*Step{
+		"s": {w: w, testType: &mockStep{validateImpl: func(context.Context, *Step) DError { validated = true; return nil }}},
+	}
+	w.AddPolicies(PolicyFunc(func(context.Context, *Workflow) error { return errors.New("denied") }))
+
+	err := w.Validate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "workflow rejected by policy: denied") {
+		t.Errorf("want policy error, got: %v", err)
+	}
+	if validated {
+		t.Error("rejected workflow should not be validated")
+	}
+	if got := w.ValidationReport().Errors(); len(got) != 1 {
+		t.Errorf("want the policy error in the validation report, got: %v", got)
+	}
+}
@@ -0,0 +1,113 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// PollingIntervalEnvPrefix prefixes the environment variables overriding
+// the PollingIntervals of a workflow, e.g.
+// DAISY_POLLING_INTERVAL_SERIAL_OUTPUT=30s.
+const PollingIntervalEnvPrefix = "DAISY_POLLING_INTERVAL_"
+
+// PollingIntervals sets how often the compute API is polled while waiting,
+// to slow polling down for large fleets or speed it up in tests. Each must
+// be parsable by https://golang.org/pkg/time/#ParseDuration. Unset intervals
+// keep their defaults.
+type PollingIntervals struct {
+	// Reading serial port output in WaitForInstancesSignal and
+	// ResetWindowsPassword steps.
+	SerialOutput string `json:",omitempty"`
+	// Reading guest attributes in WaitForInstancesSignal steps.
+	GuestAttributes string `json:",omitempty"`
+	// Waiting for pending operations.
+	Operations string `json:",omitempty"`
+	// Checking whether instances stopped in WaitForInstancesSignal steps.
+	InstanceStatus string `json:",omitempty"`
+	// Polls of SerialOutput, GuestAttributes and InstanceStatus unless they
+	// are set. Defaults to 10s.
+	Default string `json:",omitempty"`
+
+	serialOutput, guestAttributes, operations, instanceStatus, fallback time.Duration
+}
+
+// populatePollingIntervals applies the environment overrides to the
+// PollingIntervals of the workflow and parses them.
+func (w *Workflow) populatePollingIntervals() DError {
+	if w.PollingIntervals == nil {
+		if !pollingIntervalEnvSet() {
+			return nil
+		}
+		w.PollingIntervals = &PollingIntervals{}
+	}
+	pi := w.PollingIntervals
+	fields := []struct {
+		name, env string
+		value     *string
+		d         *time.Duration
+	}{
+		{"SerialOutput", "SERIAL_OUTPUT", &pi.SerialOutput, &pi.serialOutput},
+		{"GuestAttributes", "GUEST_ATTRIBUTES", &pi.GuestAttributes, &pi.guestAttributes},
+		{"Operations", "OPERATIONS", &pi.Operations, &pi.operations},
+		{"InstanceStatus", "INSTANCE_STATUS", &pi.InstanceStatus, &pi.instanceStatus},
+		{"Default", "DEFAULT", &pi.Default, &pi.fallback},
+	}
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(PollingIntervalEnvPrefix + f.env); ok {
+			*f.value = v
+		}
+		if *f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(*f.value)
+		if err != nil {
+			return Errf("failed to parse PollingIntervals.%s: %v", f.name, err)
+		}
+		if d <= 0 {
+			return Errf("PollingIntervals.%s must be positive: %s", f.name, *f.value)
+		}
+		*f.d = d
+	}
+	for _, d := range []*time.Duration{&pi.serialOutput, &pi.guestAttributes, &pi.instanceStatus} {
+		if *d == 0 {
+			*d = pi.fallback
+		}
+	}
+
+	if pi.operations > 0 && w.ComputeClient != nil {
+		w.ComputeClient.SetOperationPollInterval(pi.operations)
+	}
+	return nil
+}
+
+func pollingIntervalEnvSet() bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, PollingIntervalEnvPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollingIntervals returns the parsed PollingIntervals of the root workflow.
+func (w *Workflow) pollingIntervals() PollingIntervals {
+	if pi := w.root().PollingIntervals; pi != nil {
+		return *pi
+	}
+	return PollingIntervals{}
+}
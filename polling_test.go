@@ -0,0 +1,115 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestPopulatePollingIntervals(t *testing.T) {
+	tests := []struct {
+		desc    string
+		pi      *PollingIntervals
+		env     map[string]string
+		want    PollingIntervals
+		wantErr bool
+	}{
+		{"unset", nil, nil, PollingIntervals{}, false},
+		{
+			"config",
+			&PollingIntervals{SerialOutput: "30s", Operations: "5s"},
+			nil,
+			PollingIntervals{SerialOutput: "30s", Operations: "5s", serialOutput: 30 * time.Second, operations: 5 * time.Second},
+			false,
+		},
+		{
+			"env overrides config",
+			&PollingIntervals{SerialOutput: "30s"},
+			map[string]string{"DAISY_POLLING_INTERVAL_SERIAL_OUTPUT": "1ms"},
+			PollingIntervals{SerialOutput: "1ms", serialOutput: time.Millisecond},
+			false,
+		},
+		{
+			"env only",
+			nil,
+			map[string]string{"DAISY_POLLING_INTERVAL_INSTANCE_STATUS": "1m"},
+			PollingIntervals{InstanceStatus: "1m", instanceStatus: time.Minute},
+			false,
+		},
+		{
+			"default",
+			&PollingIntervals{Default: "30s", GuestAttributes: "1m"},
+			nil,
+			PollingIntervals{Default: "30s", GuestAttributes: "1m", fallback: 30 * time.Second, serialOutput: 30 * time.Second, guestAttributes: time.Minute, instanceStatus: 30 * time.Second},
+			false,
+		},
+		{
+			"env default",
+			nil,
+			map[string]string{"DAISY_POLLING_INTERVAL_DEFAULT": "1m"},
+			PollingIntervals{Default: "1m", fallback: time.Minute, serialOutput: time.Minute, guestAttributes: time.Minute, instanceStatus: time.Minute},
+			false,
+		},
+		{"bad duration", &PollingIntervals{GuestAttributes: "often"}, nil, PollingIntervals{GuestAttributes: "often"}, true},
+		{"not positive", &PollingIntervals{Operations: "0s"}, nil, PollingIntervals{Operations: "0s"}, true},
+	}
+
+	for _, tt := range tests {
+		for k, v := range tt.env {
+			os.Setenv(k, v)
+		}
+		w := testWorkflow()
+		w.PollingIntervals = tt.pi
+		var gotOpInterval time.Duration
+		w.ComputeClient.(*daisyCompute.TestClient).SetOperationPollIntervalFn = func(d time.Duration) { gotOpInterval = d }
+
+		err := w.populatePollingIntervals()
+		for k := range tt.env {
+			os.Unsetenv(k)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if diffRes := diff(w.pollingIntervals(), tt.want, 0); diffRes != "" {
+			t.Errorf("%s: PollingIntervals not populated as expected: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+		if !tt.wantErr && gotOpInterval != tt.want.operations {
+			t.Errorf("%s: operation poll interval set to %s, want %s", tt.desc, gotOpInterval, tt.want.operations)
+		}
+	}
+}
+
+func TestInstanceSignalPollInterval(t *testing.T) {
+	tests := []struct {
+		desc     string
+		interval time.Duration
+		workflow time.Duration
+		want     time.Duration
+	}{
+		{"default", 0, 0, 10 * time.Second},
+		{"workflow", 0, time.Minute, time.Minute},
+		{"signal", time.Second, time.Minute, time.Second},
+	}
+	for _, tt := range tests {
+		is := &InstanceSignal{interval: tt.interval}
+		if got := is.pollInterval(tt.workflow); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Stages of ProgressEvents.
+const (
+	ProgressStepStarted  = "step-started"
+	ProgressStepFinished = "step-finished"
+	ProgressStepFailed   = "step-failed"
+	// ProgressStatus events carry a line of serial port output matching the
+	// StatusMatch of a WaitForInstancesSignal step.
+	ProgressStatus = "status"
+	// ProgressExport events report how far an ExportImage step is in
+	// exporting its image.
+	ProgressExport = "export"
+)
+
+// ProgressEvent is an event of a run, for UIs and wrappers to show progress.
+type ProgressEvent struct {
+	Time     time.Time `json:"time"`
+	Stage    string    `json:"stage"`
+	Workflow string    `json:"workflow"`
+	Step     string    `json:"step,omitempty"`
+	StepType string    `json:"stepType,omitempty"`
+	// Percent is the share of the steps of Workflow that finished, or of the
+	// export for ProgressExport events.
+	Percent  int    `json:"percent"`
+	Instance string `json:"instance,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Disk is the image being exported and Bytes the bytes of the exported
+	// file written so far, for ProgressExport events.
+	Disk  string `json:"disk,omitempty"`
+	Bytes int64  `json:"bytes,omitempty"`
+}
+
+// SetProgressWriter makes the workflow, and the workflows it includes or
+// runs, write their ProgressEvents to wr as JSON lines.
+func (w *Workflow) SetProgressWriter(wr io.Writer) {
+	w.progressWriter = wr
+}
+
+// emitProgress writes an event of step s of w, setting its time, workflow
+// and, except for ProgressExport events, percent. Events are dropped if no
+// progress writer is set.
+func (w *Workflow) emitProgress(s *Step, e ProgressEvent) {
+	root := w.root()
+	if root.progressWriter == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Workflow = getAbsoluteName(w)
+	e.Step = s.name
+
+	w.progressMx.Lock()
+	if e.Stage == ProgressStepFinished {
+		w.stepsFinished++
+	}
+	if e.Stage != ProgressExport && len(w.Steps) > 0 {
+		e.Percent = w.stepsFinished * 100 / len(w.Steps)
+	}
+	w.progressMx.Unlock()
+
+	e.Message = w.redact(e.Message)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	root.progressMx.Lock()
+	defer root.progressMx.Unlock()
+	root.progressWriter.Write(append(data, '\n'))
+}
@@ -0,0 +1,60 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProgressEvents(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	var buf bytes.Buffer
+	w.SetProgressWriter(&buf)
+	w.sensitiveValues = []string{"secret"}
+	ok := &Step{name: "ok", w: w, testType: &mockStep{}}
+	failing := &Step{name: "failing", w: w, testType: &mockStep{runImpl: func(context.Context, *Step) DError {
+		return Errf("bad secret")
+	}}}
+	w.Steps = map[string]*Step{"ok": ok, "failing": failing}
+
+	ok.run(ctx)
+	failing.run(ctx)
+
+	var got []ProgressEvent
+	for _, ln := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e ProgressEvent
+		if err := json.Unmarshal([]byte(ln), &e); err != nil {
+			t.Fatalf("invalid progress event %q: %v", ln, err)
+		}
+		if e.Time.IsZero() || e.Workflow != testWf {
+			t.Errorf("event missing time or workflow: %q", ln)
+		}
+		got = append(got, ProgressEvent{Stage: e.Stage, Step: e.Step, StepType: e.StepType, Percent: e.Percent, Message: e.Message})
+	}
+	want := []ProgressEvent{
+		{Stage: ProgressStepStarted, Step: "ok", StepType: "mockStep"},
+		{Stage: ProgressStepFinished, Step: "ok", StepType: "mockStep", Percent: 50},
+		{Stage: ProgressStepStarted, Step: "failing", StepType: "mockStep", Percent: 50},
+		{Stage: ProgressStepFailed, Step: "failing", StepType: "mockStep", Percent: 50, Message: "step \"failing\" run error: bad " + redactedValue},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("progress events not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
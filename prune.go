@@ -0,0 +1,161 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"sort"
+	"strings"
+)
+
+// RunOnly prunes w to the steps named, to iterate on some steps of a workflow
+// without running the others. Call it before Validate or Run. See SkipSteps.
+func (w *Workflow) RunOnly(names []string) DError {
+	if err := w.checkStepNames(names); err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, n := range names {
+		keep[n] = true
+	}
+	return w.prune(keep)
+}
+
+// SkipSteps removes the steps named from w, to rerun a workflow without the
+// steps that already succeeded. Call it before Validate or Run.
+//
+// The order of the remaining steps is kept: a step that depended on a removed
+// step depends on the dependencies of the removed step instead. Resources
+// that removed steps would have created must exist when w runs, e.g. created
+// by a previous run with NoCleanup and ExactName set.
+func (w *Workflow) SkipSteps(names []string) DError {
+	if err := w.checkStepNames(names); err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for n := range w.Steps {
+		keep[n] = true
+	}
+	for _, n := range names {
+		delete(keep, n)
+	}
+	return w.prune(keep)
+}
+
+func (w *Workflow) checkStepNames(names []string) DError {
+	var unknown []string
+	for _, n := range names {
+		if _, ok := w.Steps[n]; !ok {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) > 0 {
+		return Errf("workflow %q has no step %s", w.Name, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// prune removes the steps of w not in keep, making the steps kept depend on
+// the closest steps kept that they depended on, directly or through removed
+// steps.
+func (w *Workflow) prune(keep map[string]bool) DError {
+	if len(keep) == 0 {
+		return Errf("no step of workflow %q left to run", w.Name)
+	}
+	w.addCompletionDependencies()
+	for s, deps := range w.Dependencies {
+		if _, ok := w.Steps[s]; !ok {
+			return Errf("dependencies reference non existent step %q: %q:%q", s, s, deps)
+		}
+		for _, dep := range deps {
+			if _, ok := w.Steps[dep]; !ok {
+				return Errf("dependencies reference non existent step %q: %q:%q", dep, s, deps)
+			}
+		}
+	}
+
+	// keptDeps returns the closest kept steps name depends on.
+	memo := map[string][]string{}
+	visiting := map[string]bool{}
+	var keptDeps func(name string) ([]string, DError)
+	keptDeps = func(name string) ([]string, DError) {
+		if deps, ok := memo[name]; ok {
+			return deps, nil
+		}
+		if visiting[name] {
+			return nil, Errf("cyclic dependency on step %q", name)
+		}
+		visiting[name] = true
+		seen := map[string]bool{}
+		var deps []string
+		for _, dep := range w.Dependencies[name] {
+			next := []string{dep}
+			if !keep[dep] {
+				var err DError
+				if next, err = keptDeps(dep); err != nil {
+					return nil, err
+				}
+			}
+			for _, d := range next {
+				if !seen[d] {
+					seen[d] = true
+					deps = append(deps, d)
+				}
+			}
+		}
+		sort.Strings(deps)
+		visiting[name] = false
+		memo[name] = deps
+		return deps, nil
+	}
+
+	pruned := map[string][]string{}
+	for name := range keep {
+		deps, err := keptDeps(name)
+		if err != nil {
+			return err
+		}
+		if strIn(name, deps) {
+			return Errf("cyclic dependency on step %q", name)
+		}
+		if len(deps) > 0 {
+			pruned[name] = deps
+		}
+	}
+	// A step depending on the completion of a removed step depends on the
+	// completion of the closest steps kept instead.
+	for name := range keep {
+		s := w.Steps[name]
+		var completion []string
+		for _, d := range s.DependsOnCompletionOf {
+			if keep[d] {
+				completion = append(completion, d)
+				continue
+			}
+			deps, err := keptDeps(d)
+			if err != nil {
+				return err
+			}
+			completion = append(completion, deps...)
+		}
+		s.DependsOnCompletionOf = dedupe(completion)
+	}
+	for name := range w.Steps {
+		if !keep[name] {
+			delete(w.Steps, name)
+		}
+	}
+	w.Dependencies = pruned
+	return nil
+}
@@ -0,0 +1,109 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"sort"
+	"testing"
+)
+
+// pruneTestWorkflow returns a workflow with steps a -> b -> c -> d and
+// a -> e -> d.
+func pruneTestWorkflow() *Workflow {
+	w := testWorkflow()
+	for _, n := range []string{"a", "b", "c", "d", "e"} {
+		w.Steps[n] = &Step{name: n, w: w, testType: &mockStep{}}
+	}
+	w.Dependencies = map[string][]string{
+		"b": {"a"},
+		"c": {"b"},
+		"d": {"c", "e"},
+		"e": {"a"},
+	}
+	return w
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		desc      string
+		only      []string
+		skip      []string
+		wantSteps []string
+		wantDeps  map[string][]string
+		wantErr   bool
+	}{
+		{"run only one step", []string{"c"}, nil, []string{"c"}, map[string][]string{}, false},
+		{"run only keeps order", []string{"a", "d"}, nil, []string{"a", "d"}, map[string][]string{"d": {"a"}}, false},
+		{"skip first step", nil, []string{"a"}, []string{"b", "c", "d", "e"}, map[string][]string{"c": {"b"}, "d": {"c", "e"}}, false},
+		{"skip middle steps", nil, []string{"b", "c"}, []string{"a", "d", "e"}, map[string][]string{"d": {"a", "e"}, "e": {"a"}}, false},
+		{"run only unknown step", []string{"f"}, nil, nil, nil, true},
+		{"skip unknown step", nil, []string{"a", "f"}, nil, nil, true},
+		{"skip all steps", nil, []string{"a", "b", "c", "d", "e"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		w := pruneTestWorkflow()
+		var err DError
+		if tt.only != nil {
+			err = w.RunOnly(tt.only)
+		} else {
+			err = w.SkipSteps(tt.skip)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+		var steps []string
+		for n := range w.Steps {
+			steps = append(steps, n)
+		}
+		sort.Strings(steps)
+		if diffRes := diff(steps, tt.wantSteps, 0); diffRes != "" {
+			t.Errorf("%s: steps not as expected: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+		if diffRes := diff(w.Dependencies, tt.wantDeps, 0); diffRes != "" {
+			t.Errorf("%s: dependencies not as expected: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
+
+func TestPruneCompletionDependencies(t *testing.T) {
+	w := pruneTestWorkflow()
+	w.Steps["f"] = &Step{name: "f", w: w, testType: &mockStep{}, DependsOnCompletionOf: []string{"b", "d"}}
+	if err := w.SkipSteps([]string{"d"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diffRes := diff(w.Dependencies["f"], []string{"b", "c", "e"}, 0); diffRes != "" {
+		t.Errorf("dependencies not as expected: (-got,+want)\n%s", diffRes)
+	}
+	if diffRes := diff(w.Steps["f"].DependsOnCompletionOf, []string{"b", "c", "e"}, 0); diffRes != "" {
+		t.Errorf("completion dependencies not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
+
+func TestPruneCycle(t *testing.T) {
+	w := pruneTestWorkflow()
+	w.Dependencies["a"] = []string{"d"}
+	if err := w.RunOnly([]string{"a"}); err == nil {
+		t.Error("got no error for a cycle through removed steps to a kept step")
+	}
+
+	w = pruneTestWorkflow()
+	w.Dependencies["b"] = []string{"a", "c"}
+	if err := w.SkipSteps([]string{"b", "c"}); err == nil {
+		t.Error("got no error for a cycle of removed steps")
+	}
+}
@@ -0,0 +1,220 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Values of Network.ReclaimStale.
+const (
+	reclaimDelete = "DELETE"
+	reclaimAdopt  = "ADOPT"
+)
+
+// defaultReclaimStaleMinAge is the default Network.ReclaimStaleMinAge.
+const defaultReclaimStaleMinAge = time.Hour
+
+// createdByDaisy reports whether description is the default description of
+// the resources Daisy creates.
+func createdByDaisy(description string) bool {
+	return strings.Contains(description, " created by Daisy in workflow ")
+}
+
+func isNotFound(err error) bool {
+	gErr, ok := err.(*googleapi.Error)
+	return ok && gErr.Code == http.StatusNotFound
+}
+
+func isAlreadyExists(err error) bool {
+	gErr, ok := err.(*googleapi.Error)
+	return ok && gErr.Code == http.StatusConflict
+}
+
+// partialURL trims the scheme, host and API version from a resource URL.
+func partialURL(url string) string {
+	if i := strings.Index(url, "projects/"); i >= 0 {
+		return url[i:]
+	}
+	return url
+}
+
+// networkReclaimMode returns the ReclaimStale mode of network, a Daisy name,
+// if the workflow creates it.
+func (w *Workflow) networkReclaimMode(network string) string {
+	if res, ok := w.networks.get(network); ok {
+		return res.reclaimStale
+	}
+	return ""
+}
+
+// staleNetwork returns the network n is created as if it already exists, or
+// nil if it doesn't. It fails if the network was not created by Daisy.
+func (n *Network) staleNetwork(s *Step) (*compute.Network, DError) {
+	existing, err := s.computeClient().GetNetwork(n.Project, n.Name)
+	if isNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, typedErr(apiError, "failed to get network", err)
+	}
+	if !createdByDaisy(existing.Description) {
+		return nil, Errf("network %q already exists and was not created by Daisy, not reclaiming it", n.Name)
+	}
+	return existing, nil
+}
+
+// deleteStaleNetwork deletes network, left over from a prior run, and the
+// firewall rules and subnetworks on it. It fails without deleting anything if
+// one of them was not created by Daisy. The deletions are logged with logf.
+func deleteStaleNetwork(c daisyCompute.Client, logf func(format string, a ...interface{}), project string, network *compute.Network) DError {
+	frs, err := c.ListFirewallRules(project)
+	if err != nil {
+		return typedErr(apiError, "failed to list firewall rules", err)
+	}
+	var staleFrs []*compute.Firewall
+	for _, fr := range frs {
+		if fr.Network != network.SelfLink {
+			continue
+		}
+		if !createdByDaisy(fr.Description) {
+			return Errf("cannot reclaim network %q: firewall rule %q on it was not created by Daisy", network.Name, fr.Name)
+		}
+		staleFrs = append(staleFrs, fr)
+	}
+	var staleSns []*compute.Subnetwork
+	for _, link := range network.Subnetworks {
+		m := NamedSubexp(subnetworkURLRegex, partialURL(link))
+		sn, err := c.GetSubnetwork(strOr(m["project"], project), m["region"], m["subnetwork"])
+		if isNotFound(err) {
+			continue
+		} else if err != nil {
+			return typedErr(apiError, "failed to get subnetwork", err)
+		}
+		if !createdByDaisy(sn.Description) {
+			return Errf("cannot reclaim network %q: subnetwork %q on it was not created by Daisy", network.Name, sn.Name)
+		}
+		staleSns = append(staleSns, sn)
+	}
+
+	for _, fr := range staleFrs {
+		logf("Deleting stale firewall rule %q.", fr.Name)
+		if err := c.DeleteFirewallRule(project, fr.Name); err != nil && !isNotFound(err) {
+			return newErr("failed to delete stale firewall rule", err)
+		}
+	}
+	for _, sn := range staleSns {
+		logf("Deleting stale subnetwork %q.", sn.Name)
+		if err := c.DeleteSubnetwork(project, NamedSubexp(subnetworkURLRegex, partialURL(sn.SelfLink))["region"], sn.Name); err != nil && !isNotFound(err) {
+			return newErr("failed to delete stale subnetwork", err)
+		}
+	}
+	logf("Deleting stale network %q.", network.Name)
+	if err := c.DeleteNetwork(project, network.Name); err != nil && !isNotFound(err) {
+		return newErr("failed to delete stale network", err)
+	}
+	return nil
+}
+
+// reclaim deals with the network n is created as if it already exists,
+// according to n.ReclaimStale. It reports whether the network was adopted,
+// and so must not be created.
+func (n *Network) reclaim(s *Step) (bool, DError) {
+	existing, err := n.staleNetwork(s)
+	if err != nil || existing == nil {
+		return false, err
+	}
+	if n.ReclaimStale == reclaimAdopt {
+		s.w.LogStepInfo(s.name, "CreateNetworks", "Adopting stale network %q.", n.Name)
+		return true, nil
+	}
+	// A network created recently may be used by a workflow still running.
+	created, tErr := time.Parse(time.RFC3339, existing.CreationTimestamp)
+	if tErr != nil {
+		return false, Errf("cannot reclaim network %q: bad creation timestamp %q: %v", n.Name, existing.CreationTimestamp, tErr)
+	}
+	if age := time.Since(created); age < n.reclaimStaleMinAge {
+		return false, Errf("network %q already exists and was created %s ago, less than ReclaimStaleMinAge %s: not deleting it", n.Name, age.Round(time.Second), n.reclaimStaleMinAge)
+	}
+	logf := func(format string, a ...interface{}) { s.w.LogStepInfo(s.name, "CreateNetworks", format, a...) }
+	return false, deleteStaleNetwork(s.computeClient(), logf, n.Project, existing)
+}
+
+// adopt uses the existing firewall rule fir is created as, if it was created
+// by Daisy on the same network.
+func (fir *FirewallRule) adopt(s *Step) DError {
+	existing, err := s.computeClient().GetFirewallRule(fir.Project, fir.Name)
+	if err != nil {
+		return typedErr(apiError, "failed to get firewall rule", err)
+	}
+	if !createdByDaisy(existing.Description) || partialURL(existing.Network) != partialURL(fir.Network) {
+		return Errf("firewall rule %q already exists and is not a stale firewall rule of network %q", fir.Name, fir.Network)
+	}
+	s.w.LogStepInfo(s.name, "CreateFirewallRules", "Adopting stale firewall rule %q.", fir.Name)
+	return nil
+}
+
+// errForeignCollision is the error creating a resource whose name is used by
+// a resource not created by this workflow.
+func errForeignCollision(resourceType, name string) DError {
+	return Errf("%s %q already exists and was not created by this workflow: name collision with foreign resource", resourceType, name)
+}
+
+// adoptOwn uses the existing network n is created as, if it was created by
+// this workflow, e.g. by a prior run of it, as its description tells.
+func (n *Network) adoptOwn(s *Step) DError {
+	existing, err := s.computeClient().GetNetwork(n.Project, n.Name)
+	if err != nil {
+		return typedErr(apiError, "failed to get network", err)
+	}
+	if existing.Description != n.Description {
+		return errForeignCollision("network", n.Name)
+	}
+	s.w.LogStepInfo(s.name, "CreateNetworks", "Adopting existing network %q created by this workflow.", n.Name)
+	return nil
+}
+
+// adoptOwn uses the existing firewall rule fir is created as, if it was
+// created by this workflow on the same network, as its description tells.
+func (fir *FirewallRule) adoptOwn(s *Step) DError {
+	existing, err := s.computeClient().GetFirewallRule(fir.Project, fir.Name)
+	if err != nil {
+		return typedErr(apiError, "failed to get firewall rule", err)
+	}
+	if existing.Description != fir.Description || partialURL(existing.Network) != partialURL(fir.Network) {
+		return errForeignCollision("firewall rule", fir.Name)
+	}
+	s.w.LogStepInfo(s.name, "CreateFirewallRules", "Adopting existing firewall rule %q created by this workflow.", fir.Name)
+	return nil
+}
+
+// adopt uses the existing subnetwork sn is created as, if it was created by
+// Daisy on the same network.
+func (sn *Subnetwork) adopt(s *Step) DError {
+	existing, err := s.computeClient().GetSubnetwork(sn.Project, sn.Region, sn.Name)
+	if err != nil {
+		return typedErr(apiError, "failed to get subnetwork", err)
+	}
+	if !createdByDaisy(existing.Description) || partialURL(existing.Network) != partialURL(sn.Network) {
+		return Errf("subnetwork %q already exists and is not a stale subnetwork of network %q", sn.Name, sn.Network)
+	}
+	s.w.LogStepInfo(s.name, "CreateSubnetworks", "Adopting stale subnetwork %q.", sn.Name)
+	return nil
+}
@@ -0,0 +1,237 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"github.com/kylelemons/godebug/pretty"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestCreateNetworksReclaimStale(t *testing.T) {
+	ctx := context.Background()
+	daisyDesc := "Network created by Daisy in workflow \"old-wf\" on behalf of someone."
+	netLink := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/global/networks/net", testProject)
+	snLink := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/regions/us-central1/subnetworks/sn", testProject)
+	old := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	young := time.Now().Add(-time.Minute).Format(time.RFC3339)
+
+	tests := []struct {
+		desc        string
+		mode        string
+		existing    *compute.Network
+		frDesc      string
+		wantDeleted []string
+		wantCreated bool
+		wantErr     bool
+	}{
+		{"no stale network", "DELETE", nil, daisyDesc, nil, true, false},
+		{"delete", "DELETE", &compute.Network{Name: "net", Description: daisyDesc, SelfLink: netLink, Subnetworks: []string{snLink}, CreationTimestamp: old}, daisyDesc, []string{"firewall fr", "subnetwork us-central1/sn", "network net"}, true, false},
+		{"adopt", "ADOPT", &compute.Network{Name: "net", Description: daisyDesc, SelfLink: netLink}, daisyDesc, nil, false, false},
+		{"network not created by Daisy", "DELETE", &compute.Network{Name: "net", SelfLink: netLink, CreationTimestamp: old}, daisyDesc, nil, false, true},
+		{"firewall rule not created by Daisy", "DELETE", &compute.Network{Name: "net", Description: daisyDesc, SelfLink: netLink, CreationTimestamp: old}, "", nil, false, true},
+		{"network too young to delete", "DELETE", &compute.Network{Name: "net", Description: daisyDesc, SelfLink: netLink, CreationTimestamp: young}, daisyDesc, nil, false, true},
+		{"bad creation timestamp", "DELETE", &compute.Network{Name: "net", Description: daisyDesc, SelfLink: netLink, CreationTimestamp: "bad"}, daisyDesc, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{name: "s", w: w}
+		var deleted []string
+		var created bool
+		w.ComputeClient = &daisyCompute.TestClient{
+			GetNetworkFn: func(_, _ string) (*compute.Network, error) {
+				if tt.existing == nil {
+					return nil, &googleapi.Error{Code: http.StatusNotFound}
+				}
+				return tt.existing, nil
+			},
+			ListFirewallRulesFn: func(_ string, _ ...daisyCompute.ListCallOption) ([]*compute.Firewall, error) {
+				return []*compute.Firewall{
+					{Name: "fr", Network: netLink, Description: tt.frDesc},
+					{Name: "other", Network: "https://www.googleapis.com/compute/v1/projects/p/global/networks/other"},
+				}, nil
+			},
+			GetSubnetworkFn: func(_, region, name string) (*compute.Subnetwork, error) {
+				return &compute.Subnetwork{Name: name, Description: daisyDesc, SelfLink: snLink}, nil
+			},
+			DeleteFirewallRuleFn: func(_, name string) error { deleted = append(deleted, "firewall "+name); return nil },
+			DeleteSubnetworkFn: func(_, region, name string) error {
+				deleted = append(deleted, "subnetwork "+region+"/"+name)
+				return nil
+			},
+			DeleteNetworkFn: func(_, name string) error { deleted = append(deleted, "network "+name); return nil },
+			CreateNetworkFn: func(_ string, _ *compute.Network) error { created = true; return nil },
+		}
+		n := &Network{Network: compute.Network{Name: "net"}, ReclaimStale: tt.mode, Resource: Resource{ExactName: true}}
+		cns := &CreateNetworks{n}
+		cns.populate(ctx, s)
+		err := cns.run(ctx, s)
+		if gotErr := err != nil; gotErr != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if diff := pretty.Compare(deleted, tt.wantDeleted); diff != "" {
+			t.Errorf("%s: unexpected deletions, diff: %s", tt.desc, diff)
+		}
+		if created != tt.wantCreated {
+			t.Errorf("%s: network created: %t, want: %t", tt.desc, created, tt.wantCreated)
+		}
+		if !tt.wantErr && !n.createdInWorkflow {
+			t.Errorf("%s: network not marked as created in workflow", tt.desc)
+		}
+	}
+}
+
+func TestNetworkReclaimStaleValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	n := &Network{Network: compute.Network{Name: "net"}, ReclaimStale: "bogus"}
+	n.populate(ctx, s)
+	if err := n.validate(ctx, s); err == nil {
+		t.Error("expected error for bad ReclaimStale")
+	}
+
+	n = &Network{Network: compute.Network{Name: "net2"}, ReclaimStale: "DELETE", ReclaimStaleMinAge: "bogus"}
+	if err := n.populate(ctx, s); err == nil {
+		t.Error("expected error for bad ReclaimStaleMinAge")
+	}
+}
+
+func TestCreateFirewallRulesAdoptStale(t *testing.T) {
+	ctx := context.Background()
+	daisyDesc := "FirewallRule created by Daisy in workflow \"old-wf\" on behalf of someone."
+	netLink := fmt.Sprintf("projects/%s/global/networks/net", testProject)
+
+	tests := []struct {
+		desc     string
+		existing *compute.Firewall
+		wantErr  bool
+	}{
+		{"stale rule", &compute.Firewall{Description: daisyDesc, Network: "https://www.googleapis.com/compute/v1/" + netLink}, false},
+		{"other network", &compute.Firewall{Description: daisyDesc, Network: "projects/p/global/networks/other"}, true},
+		{"not created by Daisy", &compute.Firewall{Network: netLink}, true},
+	}
+
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{name: "s", w: w}
+		w.networks.m = map[string]*Resource{"net": {link: netLink, reclaimStale: "ADOPT"}}
+		w.ComputeClient = &daisyCompute.TestClient{
+			CreateFirewallRuleFn: func(_ string, _ *compute.Firewall) error {
+				return &googleapi.Error{Code: http.StatusConflict}
+			},
+			GetFirewallRuleFn: func(_, _ string) (*compute.Firewall, error) { return tt.existing, nil },
+		}
+		fir := &FirewallRule{Firewall: compute.Firewall{Name: "fr", Network: "net"}}
+		if err := (&CreateFirewallRules{fir}).run(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if fir.createdInWorkflow == tt.wantErr {
+			t.Errorf("%s: firewall rule created in workflow: %t, want: %t", tt.desc, fir.createdInWorkflow, !tt.wantErr)
+		}
+	}
+}
+
+func TestCreateNetworksAlreadyExists(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc     string
+		existing func(n *Network) *compute.Network
+		wantErr  bool
+	}{
+		{"created by this workflow", func(n *Network) *compute.Network { return &compute.Network{Name: n.Name, Description: n.Description} }, false},
+		{"created by another workflow", func(n *Network) *compute.Network {
+			return &compute.Network{Name: n.Name, Description: "Network created by Daisy in workflow \"other\" on behalf of someone."}
+		}, true},
+		{"foreign", func(n *Network) *compute.Network { return &compute.Network{Name: n.Name} }, true},
+	}
+
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{name: "s", w: w}
+		n := &Network{Network: compute.Network{Name: "net"}, Resource: Resource{ExactName: true}}
+		w.ComputeClient = &daisyCompute.TestClient{
+			CreateNetworkFn: func(_ string, _ *compute.Network) error {
+				return &googleapi.Error{Code: http.StatusConflict}
+			},
+			GetNetworkFn: func(_, _ string) (*compute.Network, error) { return tt.existing(n), nil },
+		}
+		cns := &CreateNetworks{n}
+		cns.populate(ctx, s)
+		err := cns.run(ctx, s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "name collision with foreign resource") {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if n.createdInWorkflow == tt.wantErr {
+			t.Errorf("%s: network created in workflow: %t, want: %t", tt.desc, n.createdInWorkflow, !tt.wantErr)
+		}
+	}
+}
+
+func TestCreateFirewallRulesAlreadyExists(t *testing.T) {
+	ctx := context.Background()
+	netLink := fmt.Sprintf("projects/%s/global/networks/net", testProject)
+
+	tests := []struct {
+		desc     string
+		existing func(fir *FirewallRule) *compute.Firewall
+		wantErr  bool
+	}{
+		{"created by this workflow", func(fir *FirewallRule) *compute.Firewall {
+			return &compute.Firewall{Description: fir.Description, Network: "https://www.googleapis.com/compute/v1/" + netLink}
+		}, false},
+		{"other network", func(fir *FirewallRule) *compute.Firewall {
+			return &compute.Firewall{Description: fir.Description, Network: "projects/p/global/networks/other"}
+		}, true},
+		{"foreign", func(fir *FirewallRule) *compute.Firewall { return &compute.Firewall{Network: netLink} }, true},
+	}
+
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{name: "s", w: w}
+		fir := &FirewallRule{Firewall: compute.Firewall{Name: "fr", Network: netLink}, Resource: Resource{ExactName: true}}
+		w.ComputeClient = &daisyCompute.TestClient{
+			CreateFirewallRuleFn: func(_ string, _ *compute.Firewall) error {
+				return &googleapi.Error{Code: http.StatusConflict}
+			},
+			GetFirewallRuleFn: func(_, _ string) (*compute.Firewall, error) { return tt.existing(fir), nil },
+		}
+		cfrs := &CreateFirewallRules{fir}
+		cfrs.populate(ctx, s)
+		err := cfrs.run(ctx, s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "name collision with foreign resource") {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		if fir.createdInWorkflow == tt.wantErr {
+			t.Errorf("%s: firewall rule created in workflow: %t, want: %t", tt.desc, fir.createdInWorkflow, !tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repeat reruns a workflow or a SubWorkflow step, each run with fresh
+// autonames, e.g. to check that an image boots 100 times in a row. Runs are
+// sequential and stop after Count runs or once Duration passed, whichever
+// comes first. The repeat fails if more than MaxFailures runs failed.
+type Repeat struct {
+	// Number of runs.
+	Count int `json:",omitempty"`
+	// Start no more runs once this much time passed since the first one
+	// started. Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	Duration string `json:",omitempty"`
+	duration time.Duration
+	// Number of runs that may fail.
+	MaxFailures int `json:",omitempty"`
+	// Stop once more than MaxFailures runs failed, rather than doing all the
+	// runs to measure the failure rate.
+	StopOnFailure bool `json:",omitempty"`
+}
+
+func (r *Repeat) populate() DError {
+	if r.Count < 0 {
+		return Errf("Repeat.Count must not be negative: %d", r.Count)
+	}
+	if r.Duration != "" {
+		d, err := time.ParseDuration(r.Duration)
+		if err != nil || d < 0 {
+			return Errf("Repeat.Duration must be a non negative duration: %q", r.Duration)
+		}
+		r.duration = d
+	}
+	if r.Count == 0 && r.duration == 0 {
+		return Errf("Repeat must set Count or Duration")
+	}
+	if r.MaxFailures < 0 {
+		return Errf("Repeat.MaxFailures must not be negative: %d", r.MaxFailures)
+	}
+	return nil
+}
+
+// timeout returns the timeout of all the runs, given the timeout of one:
+// Count runs, or the runs started within Duration.
+func (r *Repeat) timeout(run time.Duration) time.Duration {
+	t := time.Duration(r.Count) * run
+	if r.duration > 0 && (r.Count == 0 || r.duration+run < t) {
+		t = r.duration + run
+	}
+	return t
+}
+
+// RepeatStats aggregates the results of the runs of a Repeat.
+type RepeatStats struct {
+	Runs, Passed, Failed int
+	// FailedRuns are the numbers of the runs that failed, starting at 1.
+	FailedRuns []int
+	// FirstError is the error of the first run that failed.
+	FirstError DError
+	// Durations of the runs.
+	MinDuration, MaxDuration, TotalDuration time.Duration
+}
+
+func (s *RepeatStats) record(d time.Duration, err DError) {
+	s.Runs++
+	if err != nil {
+		s.Failed++
+		s.FailedRuns = append(s.FailedRuns, s.Runs)
+		if s.FirstError == nil {
+			s.FirstError = err
+		}
+	} else {
+		s.Passed++
+	}
+	if s.Runs == 1 || d < s.MinDuration {
+		s.MinDuration = d
+	}
+	if d > s.MaxDuration {
+		s.MaxDuration = d
+	}
+	s.TotalDuration += d
+}
+
+// PassRate returns the fraction of the runs that passed, 0 without runs.
+func (s *RepeatStats) PassRate() float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.Passed) / float64(s.Runs)
+}
+
+// String summarizes s, e.g. "100 runs, 98 passed (98.0%), 2 failed (runs 13,
+// 57), run durations min 1m2s, avg 1m10s, max 2m0s".
+func (s *RepeatStats) String() string {
+	msg := fmt.Sprintf("%d runs, %d passed (%.1f%%), %d failed", s.Runs, s.Passed, 100*s.PassRate(), s.Failed)
+	if s.Failed > 0 {
+		var runs []string
+		for _, r := range s.FailedRuns {
+			runs = append(runs, strconv.Itoa(r))
+		}
+		msg += fmt.Sprintf(" (runs %s)", strings.Join(runs, ", "))
+	}
+	if s.Runs > 0 {
+		avg := s.TotalDuration / time.Duration(s.Runs)
+		msg += fmt.Sprintf(", run durations min %s, avg %s, max %s", s.MinDuration.Round(time.Second), avg.Round(time.Second), s.MaxDuration.Round(time.Second))
+	}
+	return msg
+}
+
+// Err returns the error of the runs of r with stats, nil unless more than
+// MaxFailures runs failed.
+func (r *Repeat) Err(stats *RepeatStats) DError {
+	if stats.Failed <= r.MaxFailures {
+		return nil
+	}
+	return Errf("%d of %d runs failed, more than MaxFailures %d, first failure (run %d): %v", stats.Failed, stats.Runs, r.MaxFailures, stats.FailedRuns[0], stats.FirstError)
+}
+
+// repeat calls run for each run of r, numbered from 1, until r is done or
+// stop returns true.
+func (r *Repeat) repeat(stop func() bool, run func(i int) DError) *RepeatStats {
+	stats := &RepeatStats{}
+	start := time.Now()
+	for i := 1; r.Count == 0 || i <= r.Count; i++ {
+		if r.duration > 0 && i > 1 && time.Since(start) >= r.duration {
+			break
+		}
+		if stop() {
+			break
+		}
+		runStart := time.Now()
+		err := run(i)
+		stats.record(time.Since(runStart), err)
+		if r.StopOnFailure && stats.Failed > r.MaxFailures {
+			break
+		}
+	}
+	return stats
+}
+
+// RunRepeat runs the workflows newWorkflow creates as rep says, within the
+// budget of r, and returns the stats of the runs. Each run uses a new
+// workflow, so resources get fresh autonames. The error is that of
+// newWorkflow or, once a run was canceled, of the canceled run; the errors of
+// the runs are in the stats, see Repeat.Err. Workflows with a Repeat are run
+// this way by the daisy CLI, Run runs them once.
+func (r *Runner) RunRepeat(ctx context.Context, rep *Repeat, newWorkflow func() (*Workflow, error)) (*RepeatStats, error) {
+	if err := rep.populate(); err != nil {
+		return nil, err
+	}
+	var err error
+	stats := rep.repeat(func() bool {
+		return err != nil || ctx.Err() != nil
+	}, func(i int) DError {
+		w, nErr := newWorkflow()
+		if nErr != nil {
+			err = fmt.Errorf("error creating workflow for run %d: %v", i, nErr)
+			return ToDError(err)
+		}
+		rErr := r.Run(ctx, w)[0]
+		if reason := w.getCancelReason(); reason != "" {
+			err = fmt.Errorf("run %d: workflow %q %s", i, w.Name, reason)
+			if rErr == nil {
+				rErr = ToDError(err)
+			}
+		}
+		return rErr
+	})
+	return stats, err
+}
+
+// runRepeat runs the SubWorkflow of st as its Repeat says, each run with a
+// new sub workflow from the definition of st, and records the stats of the
+// runs in the serial-output values "<step>-repeat-runs",
+// "<step>-repeat-passed" and "<step>-repeat-failed" of the workflow.
+func (s *SubWorkflow) runRepeat(ctx context.Context, st *Step) DError {
+	w := st.w
+	stats := st.Repeat.repeat(func() bool {
+		select {
+		case <-w.Cancel:
+			return true
+		default:
+			return false
+		}
+	}, func(i int) DError {
+		sw := s.Workflow
+		if i > 1 {
+			var err DError
+			if sw, err = s.newRepeatWorkflow(ctx, st, i); err != nil {
+				return err
+			}
+		}
+		w.LogStepInfo(st.name, "SubWorkflow", "Repeat run %d started (id=%s)", i, sw.id)
+		err := s.runWorkflow(ctx, st, sw)
+		if err != nil {
+			w.LogStepInfo(st.name, "SubWorkflow", "Repeat run %d failed: %v", i, err)
+		} else {
+			w.LogStepInfo(st.name, "SubWorkflow", "Repeat run %d passed", i)
+		}
+		return err
+	})
+	w.LogStepInfo(st.name, "SubWorkflow", "Repeat results: %s", stats)
+	root := w.root()
+	root.AddSerialConsoleOutputValue(st.name+"-repeat-runs", strconv.Itoa(stats.Runs))
+	root.AddSerialConsoleOutputValue(st.name+"-repeat-passed", strconv.Itoa(stats.Passed))
+	root.AddSerialConsoleOutputValue(st.name+"-repeat-failed", strconv.Itoa(stats.Failed))
+	return st.Repeat.Err(stats)
+}
+
+// newRepeatWorkflow creates, populates and validates a new sub workflow from
+// the definition of s for run i, with fresh autonames.
+func (s *SubWorkflow) newRepeatWorkflow(ctx context.Context, st *Step, i int) (*Workflow, DError) {
+	sw := st.w.NewSubWorkflow()
+	sw.workflowDir = s.Workflow.workflowDir
+	sw.repeatRun = i
+	if err := unmarshalWorkflow(st.name, s.definition, sw); err != nil {
+		return nil, err
+	}
+	if err := s.populateWorkflow(ctx, st, sw); err != nil {
+		return nil, err
+	}
+	if err := sw.validate(ctx); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// repeatKey identifies the runs of the repeated sub workflows w is or is in,
+// so that DeterministicNames differ between runs.
+func (w *Workflow) repeatKey() string {
+	var k string
+	for ; w != nil; w = w.parent {
+		if w.repeatRun > 1 {
+			k += fmt.Sprintf("/%s#%d", w.Name, w.repeatRun)
+		}
+	}
+	return k
+}
@@ -0,0 +1,208 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestRepeatPopulate(t *testing.T) {
+	tests := []struct {
+		desc        string
+		r           Repeat
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{"count case", Repeat{Count: 100}, 1000 * time.Minute, false},
+		{"duration case", Repeat{Duration: "1h"}, 70 * time.Minute, false},
+		{"count shorter than duration case", Repeat{Count: 2, Duration: "1h"}, 20 * time.Minute, false},
+		{"duration shorter than count case", Repeat{Count: 100, Duration: "1h"}, 70 * time.Minute, false},
+		{"unset case", Repeat{}, 0, true},
+		{"negative count case", Repeat{Count: -1}, 0, true},
+		{"bad duration case", Repeat{Duration: "1 hour"}, 0, true},
+		{"negative max failures case", Repeat{Count: 1, MaxFailures: -1}, 0, true},
+	}
+	for _, tt := range tests {
+		err := tt.r.populate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %v", tt.desc, err, tt.wantErr)
+			continue
+		}
+		if err == nil && tt.r.timeout(10*time.Minute) != tt.wantTimeout {
+			t.Errorf("%s: timeout %s, want %s", tt.desc, tt.r.timeout(10*time.Minute), tt.wantTimeout)
+		}
+	}
+}
+
+func TestRepeatStats(t *testing.T) {
+	tests := []struct {
+		desc       string
+		r          Repeat
+		fail       map[int]bool
+		wantRuns   []int
+		wantFailed []int
+		wantErr    bool
+	}{
+		{"all pass case", Repeat{Count: 3}, nil, []int{1, 2, 3}, nil, false},
+		{"failure case", Repeat{Count: 3}, map[int]bool{2: true}, []int{1, 2, 3}, []int{2}, true},
+		{"max failures case", Repeat{Count: 3, MaxFailures: 1}, map[int]bool{2: true}, []int{1, 2, 3}, []int{2}, false},
+		{"stop on failure case", Repeat{Count: 3, StopOnFailure: true}, map[int]bool{2: true}, []int{1, 2}, []int{2}, true},
+		{"stop after max failures case", Repeat{Count: 4, MaxFailures: 1, StopOnFailure: true}, map[int]bool{1: true, 3: true}, []int{1, 2, 3}, []int{1, 3}, true},
+		{"duration case", Repeat{Duration: "1ns"}, nil, []int{1}, nil, false},
+	}
+	for _, tt := range tests {
+		if err := tt.r.populate(); err != nil {
+			t.Fatal(err)
+		}
+		var runs []int
+		stats := tt.r.repeat(func() bool { return false }, func(i int) DError {
+			runs = append(runs, i)
+			if tt.fail[i] {
+				return Errf("run %d failed", i)
+			}
+			return nil
+		})
+		if diffRes := diff(runs, tt.wantRuns, 0); diffRes != "" {
+			t.Errorf("%s: runs do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+		if diffRes := diff(stats.FailedRuns, tt.wantFailed, 0); diffRes != "" {
+			t.Errorf("%s: failed runs do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+		if stats.Runs != len(runs) || stats.Passed+stats.Failed != stats.Runs {
+			t.Errorf("%s: inconsistent stats: %s", tt.desc, stats)
+		}
+		if err := tt.r.Err(stats); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %v", tt.desc, err, tt.wantErr)
+		}
+	}
+
+	stats := &RepeatStats{}
+	stats.record(time.Minute, nil)
+	stats.record(3*time.Minute, Errf("boot failed"))
+	want := "2 runs, 1 passed (50.0%), 1 failed (runs 2), run durations min 1m0s, avg 2m0s, max 3m0s"
+	if got := stats.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunRepeat(t *testing.T) {
+	ctx := context.Background()
+	var mx sync.Mutex
+	ran := 0
+	mockRun := func(context.Context, *Step) DError {
+		mx.Lock()
+		defer mx.Unlock()
+		ran++
+		if ran == 2 {
+			return Errf("boot failed")
+		}
+		return nil
+	}
+	var ws []*Workflow
+	newWorkflow := func() (*Workflow, error) {
+		w := testWorkflow()
+		w.Steps = map[string]*Step{"boot": {testType: &mockStep{runImpl: mockRun}}}
+		ws = append(ws, w)
+		return w, nil
+	}
+	stats, err := (&Runner{}).RunRepeat(ctx, &Repeat{Count: 3}, newWorkflow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Runs != 3 || stats.Failed != 1 || len(ws) != 3 {
+		t.Errorf("unexpected stats %s for %d workflows", stats, len(ws))
+	}
+
+	_, err = (&Runner{}).RunRepeat(ctx, &Repeat{Count: 3}, func() (*Workflow, error) { return nil, errors.New("bad file") })
+	if err == nil || !strings.Contains(err.Error(), "bad file") {
+		t.Errorf("got error %v, want the error of newWorkflow", err)
+	}
+
+	ws = nil
+	stats, err = (&Runner{}).RunRepeat(ctx, &Repeat{Count: 3}, func() (*Workflow, error) {
+		w, _ := newWorkflow()
+		w.CancelWithReason("is canceled by an interrupt")
+		return w, nil
+	})
+	if err == nil || stats.Runs != 1 {
+		t.Errorf("got error %v after %d runs, want an error after the canceled run", err, stats.Runs)
+	}
+}
+
+func TestSubWorkflowRepeat(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.populate(ctx)
+	var disks []string
+	w.ComputeClient.(*daisyCompute.TestClient).CreateDiskFn = func(_, _ string, d *compute.Disk) error {
+		disks = append(disks, d.Name)
+		if len(disks) == 2 {
+			return errors.New("quota exceeded")
+		}
+		return nil
+	}
+	sw := w.NewSubWorkflow()
+	sw.Steps = map[string]*Step{
+		"create-disks": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "disk"}, SizeGb: "10"}}},
+	}
+	s := &Step{
+		name:        "boot-loop",
+		w:           w,
+		Timeout:     "10m",
+		Repeat:      &Repeat{Count: 3, MaxFailures: 1},
+		SubWorkflow: &SubWorkflow{Workflow: sw},
+	}
+	if err := w.populateStep(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.timeout != 30*time.Minute {
+		t.Errorf("timeout %s, want %s", s.timeout, 30*time.Minute)
+	}
+	if err := s.SubWorkflow.validate(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.SubWorkflow.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(disks) != 3 || disks[0] == disks[1] || disks[1] == disks[2] || disks[0] == disks[2] {
+		t.Errorf("disks %q are not 3 disks with fresh names", disks)
+	}
+	for k, want := range map[string]string{"boot-loop-repeat-runs": "3", "boot-loop-repeat-passed": "2", "boot-loop-repeat-failed": "1"} {
+		if got := w.GetSerialConsoleOutputValue(k); got != want {
+			t.Errorf("serial-output value %q = %q, want %q", k, got, want)
+		}
+	}
+
+	sw = w.NewSubWorkflow()
+	sw.Repeat = &Repeat{Count: 2}
+	if err := sw.populate(ctx); err == nil || !strings.Contains(err.Error(), "only supported by top level workflows") {
+		t.Errorf("got error %v, want Repeat to only be supported by top level workflows", err)
+	}
+
+	s.Repeat = &Repeat{Count: 1}
+	s.SubWorkflow = nil
+	s.CreateDisks = &CreateDisks{}
+	if err := w.populateStep(ctx, s); err == nil || !strings.Contains(err.Error(), "only supported by SubWorkflow") {
+		t.Errorf("got error %v, want Repeat to only be supported by SubWorkflow steps", err)
+	}
+}
@@ -0,0 +1,73 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// cloudPlatformScope covers the compute, storage, KMS and resource manager
+// APIs the clients sharing the HTTP client of requestHeadersOptions call.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// requestHeadersTransport sets the X-Goog-User-Project and
+// X-Goog-Request-Reason headers of the requests sent through it, and appends
+// a suffix to their User-Agent.
+type requestHeadersTransport struct {
+	base                                     http.RoundTripper
+	quotaProject, requestReason, agentSuffix string
+}
+
+func (t *requestHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.quotaProject != "" {
+		req.Header.Set("X-Goog-User-Project", t.quotaProject)
+	}
+	if t.requestReason != "" {
+		req.Header.Set("X-Goog-Request-Reason", t.requestReason)
+	}
+	if t.agentSuffix != "" {
+		ua := t.agentSuffix
+		if prev := req.Header.Get("User-Agent"); prev != "" {
+			ua = prev + " " + t.agentSuffix
+		}
+		req.Header.Set("User-Agent", ua)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// requestHeadersOptions returns client options sending the QuotaProject,
+// RequestReason and UserAgentSuffix of w with the API requests of clients
+// created with opts, or opts if w sets none of them.
+func (w *Workflow) requestHeadersOptions(ctx context.Context, opts []option.ClientOption) ([]option.ClientOption, error) {
+	if w.QuotaProject == "" && w.RequestReason == "" && w.UserAgentSuffix == "" {
+		return opts, nil
+	}
+	base := &requestHeadersTransport{
+		base:          http.DefaultTransport,
+		quotaProject:  w.QuotaProject,
+		requestReason: w.RequestReason,
+		agentSuffix:   w.UserAgentSuffix,
+	}
+	trans, err := htransport.NewTransport(ctx, base, append([]option.ClientOption{option.WithScopes(cloudPlatformScope)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: trans})}, nil
+}
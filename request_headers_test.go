@@ -0,0 +1,61 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	var got http.Header
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		fmt.Fprintln(w, `{"name": "p"}`)
+	}))
+	defer svr.Close()
+
+	w := New()
+	w.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	w.ComputeEndpoint = svr.URL
+	w.QuotaProject = "quota-project"
+	w.RequestReason = "ticket-123"
+	w.UserAgentSuffix = "image-pipeline/1.2"
+	if err := w.PopulateClients(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ComputeClient.GetProject("p"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v := got.Get("X-Goog-User-Project"); v != "quota-project" {
+		t.Errorf("X-Goog-User-Project = %q, want %q", v, "quota-project")
+	}
+	if v := got.Get("X-Goog-Request-Reason"); v != "ticket-123" {
+		t.Errorf("X-Goog-Request-Reason = %q, want %q", v, "ticket-123")
+	}
+	if v := got.Get("User-Agent"); !strings.HasPrefix(v, "google-api-go-client/") || !strings.HasSuffix(v, " image-pipeline/1.2") {
+		t.Errorf("User-Agent = %q, want the default one with suffix %q", v, "image-pipeline/1.2")
+	}
+	if v := got.Get("Authorization"); v != "Bearer token" {
+		t.Errorf("Authorization = %q, want %q", v, "Bearer token")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/compute-daisy/compute"
 )
@@ -47,7 +48,21 @@ type Resource struct {
 
 	creator, deleter  *Step
 	createdInWorkflow bool
+	createdAt         time.Time
+	deletedAt         time.Time
 	users             []*Step
+
+	// reclaimStale is the ReclaimStale mode of a network.
+	reclaimStale string
+	// external is set for ExternalResources and for the isolated network
+	// of a parent workflow, which cannot be deleted.
+	external bool
+}
+
+// markCreated records that the workflow created r, now.
+func (r *Resource) markCreated() {
+	r.createdInWorkflow = true
+	r.createdAt = time.Now()
 }
 
 func (r *Resource) populateWithGlobal(ctx context.Context, s *Step, name string) (string, DError) {
@@ -57,12 +72,12 @@ func (r *Resource) populateWithGlobal(ctx context.Context, s *Step, name string)
 
 func (r *Resource) populateWithZone(ctx context.Context, s *Step, name, zone string) (string, string, DError) {
 	errs := r.populateHelper(ctx, s, name)
-	return r.RealName, strOr(zone, s.w.Zone), errs
+	return r.RealName, strOr(zone, s.zone()), errs
 }
 
 func (r *Resource) populateWithRegion(ctx context.Context, s *Step, name, region string) (string, string, DError) {
 	errs := r.populateHelper(ctx, s, name)
-	return r.RealName, strOr(region, getRegionFromZone(s.w.Zone)), errs
+	return r.RealName, strOr(region, getRegionFromZone(s.zone())), errs
 }
 
 func (r *Resource) populateHelper(ctx context.Context, s *Step, name string) DError {
@@ -75,7 +90,7 @@ func (r *Resource) populateHelper(ctx context.Context, s *Step, name string) DEr
 		r.RealName = s.w.genName(name)
 	}
 	r.daisyName = name
-	r.Project = strOr(r.Project, s.w.Project)
+	r.Project = strOr(r.Project, s.project())
 	return errs
 }
 
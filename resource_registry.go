@@ -17,10 +17,78 @@ package daisy
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// RegisteredResource is a read-only view of a GCE resource a workflow knows
+// of: one it creates, or an existing one it uses or deletes.
+type RegisteredResource struct {
+	// Type is the type of the resource, e.g. "disk", "image", "instance" or
+	// "network".
+	Type string
+	// Name is the name of the resource in the workflow, or its URL for
+	// resources the workflow did not create.
+	Name string
+	// RealName is the name of the resource in GCE.
+	RealName string
+	// Link is the URL of the resource, e.g. projects/p/zones/z/disks/d.
+	Link string
+	// Creator is the step that creates the resource, as Workflow.Step, empty
+	// for resources the workflow did not create.
+	Creator string
+	// Created is whether the resource was created by the run. CreatedAt is the
+	// time it was.
+	Created   bool
+	CreatedAt time.Time
+	// Deleted is whether the resource was deleted by the run, including by
+	// cleanup. DeletedAt is the time it was.
+	Deleted   bool
+	DeletedAt time.Time
+	NoCleanup bool
+	// External is whether the resource is one of the ExternalResources of the
+	// workflow.
+	External bool
+}
+
+// Resources returns the resources the registries of w and of its nested
+// workflows know of, sorted by type and name. Called during or after Run, it
+// tells what the run created so far.
+func (w *Workflow) Resources() []RegisteredResource {
+	var rs []RegisteredResource
+	seen := map[*baseResourceRegistry]bool{}
+	var add func(w *Workflow)
+	add = func(w *Workflow) {
+		for _, r := range w.resourceRegistries() {
+			if !seen[r] {
+				seen[r] = true
+				rs = append(rs, r.view()...)
+			}
+		}
+		for _, s := range w.Steps {
+			if s.IncludeWorkflow != nil && s.IncludeWorkflow.Workflow != nil {
+				add(s.IncludeWorkflow.Workflow)
+			}
+			if s.SubWorkflow != nil && s.SubWorkflow.Workflow != nil {
+				add(s.SubWorkflow.Workflow)
+			}
+		}
+	}
+	add(w)
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Type != rs[j].Type {
+			return rs[i].Type < rs[j].Type
+		}
+		if rs[i].Name != rs[j].Name {
+			return rs[i].Name < rs[j].Name
+		}
+		return rs[i].Creator < rs[j].Creator
+	})
+	return rs
+}
+
 type baseResourceRegistry struct {
 	w  *Workflow
 	m  map[string]*Resource
@@ -33,6 +101,32 @@ type baseResourceRegistry struct {
 	urlRgx   *regexp.Regexp
 }
 
+// view returns the resources of r as RegisteredResources.
+func (r *baseResourceRegistry) view() []RegisteredResource {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var rs []RegisteredResource
+	for name, res := range r.m {
+		rr := RegisteredResource{
+			Type:      r.typeName,
+			Name:      name,
+			RealName:  res.RealName,
+			Link:      res.link,
+			Created:   res.createdInWorkflow,
+			CreatedAt: res.createdAt,
+			Deleted:   res.deleted,
+			DeletedAt: res.deletedAt,
+			NoCleanup: res.NoCleanup,
+			External:  res.external,
+		}
+		if res.creator != nil {
+			rr.Creator = getAbsoluteName(res.creator.w) + "." + res.creator.name
+		}
+		rs = append(rs, rr)
+	}
+	return rs
+}
+
 func (r *baseResourceRegistry) init() {
 	r.m = map[string]*Resource{}
 }
@@ -49,6 +143,7 @@ func (r *baseResourceRegistry) cleanup() {
 		wg.Add(1)
 		go func(name string) {
 			defer wg.Done()
+			r.w.LogWorkflowInfo("Cleanup: deleting %s %q.", r.typeName, name)
 			if err := r.delete(name); err != nil && err.etype() != resourceDNEError {
 				fmt.Println(err)
 			}
@@ -79,7 +174,10 @@ func (r *baseResourceRegistry) delete(name string) DError {
 	if err := r.deleteFn(res); err != nil {
 		return err
 	}
+	r.mx.Lock()
 	res.deleted = true
+	res.deletedAt = time.Now()
+	r.mx.Unlock()
 	return nil
 }
 
@@ -134,7 +232,8 @@ func (r *baseResourceRegistry) regCreate(name string, res *Resource, s *Step, ov
 		return Errf("cannot create %s %q; already created by step %q", r.typeName, name, res.creator.name)
 	}
 
-	if !overWrite {
+	// Resources of the steps of a resumed run that finished exist already.
+	if !overWrite && !s.resumed() {
 		if exists, err := r.w.resourceExists(res.link); err != nil {
 			return Errf("cannot create %s %q; resource lookup error: %v", r.typeName, name, err)
 		} else if exists {
@@ -167,6 +266,9 @@ func (r *baseResourceRegistry) regDelete(name string, s *Step) DError {
 		return Errf("missing reference for %s %q", r.typeName, name)
 	}
 
+	if res.external {
+		return Errf("cannot delete %s %q: it is an external resource of the workflow", r.typeName, name)
+	}
 	if res.deleter != nil {
 		return Errf("cannot delete %s %q: already deleted by step %q", r.typeName, name, res.deleter.name)
 	}
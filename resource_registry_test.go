@@ -199,8 +199,11 @@ func TestResourceRegistryDelete(t *testing.T) {
 		}
 	}
 
+	if r.m["foo"].deletedAt.IsZero() {
+		t.Error("deletion time not recorded")
+	}
 	wantM := map[string]*Resource{
-		"foo": {deleted: true, deleteMx: r.m["foo"].deleteMx},
+		"foo": {deleted: true, deletedAt: r.m["foo"].deletedAt, deleteMx: r.m["foo"].deleteMx},
 		"baz": {deleted: false, deleteMx: r.m["baz"].deleteMx},
 	}
 	if diffRes := diff(r.m, wantM, 0); diffRes != "" {
@@ -483,3 +486,31 @@ func TestResourceRegistryRegUse(t *testing.T) {
 		t.Errorf("r2 users list does not match expectation: (-got +want)\n%s", diffRes)
 	}
 }
+
+func TestWorkflowResources(t *testing.T) {
+	w := testWorkflow()
+	s := &Step{name: "create", w: w}
+	created := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.disks.m = map[string]*Resource{
+		"d": {RealName: "d-abcdef", link: "projects/p/zones/z/disks/d-abcdef", creator: s, createdInWorkflow: true, createdAt: created},
+	}
+	w.images.m = map[string]*Resource{
+		"projects/p/global/images/i": {RealName: "i", link: "projects/p/global/images/i", NoCleanup: true},
+	}
+	sw := testWorkflow()
+	sw.Name = "sub"
+	sw.parent = w
+	w.Steps = map[string]*Step{"sub": {name: "sub", w: w, SubWorkflow: &SubWorkflow{Workflow: sw}}}
+	sw.instances.m = map[string]*Resource{
+		"in": {RealName: "in-abcdef", link: "projects/p/zones/z/instances/in-abcdef", creator: &Step{name: "bootstrap", w: sw}, deleted: true},
+	}
+
+	want := []RegisteredResource{
+		{Type: "disk", Name: "d", RealName: "d-abcdef", Link: "projects/p/zones/z/disks/d-abcdef", Creator: testWf + ".create", Created: true, CreatedAt: created},
+		{Type: "image", Name: "projects/p/global/images/i", RealName: "i", Link: "projects/p/global/images/i", NoCleanup: true},
+		{Type: "instance", Name: "in", RealName: "in-abcdef", Link: "projects/p/zones/z/instances/in-abcdef", Creator: testWf + ".sub.bootstrap", Deleted: true},
+	}
+	if diffRes := diff(w.Resources(), want, 0); diffRes != "" {
+		t.Errorf("resources not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
@@ -0,0 +1,114 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"time"
+)
+
+// ResumeSteps makes w resume an earlier run of it that stopped without
+// cleaning up, e.g. because the machine running it crashed: the steps named,
+// the steps of w that finished in that run, are not run again. Record them
+// from the ProgressStepFinished events of the run, see SetProgressWriter.
+//
+// The resources the finished steps created must still exist under the same
+// names: the earlier run must have set DeterministicNames with the same
+// RunID, or the resources have exact names. The finished steps register their
+// resources as when run, so that later steps can use them and cleanup deletes
+// them, and running them checks that the resources exist. Resources of the
+// steps that had not finished must be deleted first. The values the finished
+// steps set when run, such as the serial output vars of
+// WaitForInstancesSignal steps, are not set.
+func (w *Workflow) ResumeSteps(names []string) DError {
+	var steps []string
+	for _, n := range names {
+		// The Finally step is added when w is populated.
+		if n != finallyStep || w.Finally == nil {
+			steps = append(steps, n)
+		}
+	}
+	if err := w.checkStepNames(steps); err != nil {
+		return err
+	}
+	w.resumedSteps = map[string]bool{}
+	for _, n := range names {
+		w.resumedSteps[n] = true
+	}
+	return nil
+}
+
+// LeaveResources makes Run leave the resources the workflow creates instead
+// of deleting them at cleanup, for a later run resuming it to use and delete,
+// see ResumeSteps. Changes to existing resources, such as project metadata,
+// are still reverted.
+func (w *Workflow) LeaveResources() {
+	w.leaveResources = true
+}
+
+// resumed reports whether s, or the step of the workflow being run that
+// includes or runs it, finished in the run resumed.
+func (s *Step) resumed() bool {
+	chain := s.getChain()
+	return len(chain) > 0 && s.w.root().resumedSteps[chain[0].name]
+}
+
+// resume marks the resources s created and deleted in the run resumed as
+// created and deleted by this run, instead of running s again.
+func (s *Step) resume(st string) DError {
+	s.w.LogWorkflowInfo("Step %q (%s) finished in the resumed run, not running it again.", s.name, st)
+	owns := func(o *Step) bool {
+		if o == nil {
+			return false
+		}
+		chain := o.getChain()
+		return len(chain) > 0 && chain[0] == s
+	}
+	var errs DError
+	for _, r := range s.w.resourceRegistries() {
+		r.mx.Lock()
+		m := map[string]*Resource{}
+		for name, res := range r.m {
+			m[name] = res
+		}
+		r.mx.Unlock()
+
+		for name, res := range m {
+			created, deleted := owns(res.creator), owns(res.deleter)
+			if created && !deleted {
+				if exists, err := s.w.resourceExists(res.link); err != nil {
+					errs = addErrs(errs, Errf("cannot resume: %s %q lookup error: %v", r.typeName, name, err))
+					continue
+				} else if !exists {
+					errs = addErrs(errs, Errf("cannot resume: %s %q created by the step does not exist", r.typeName, name))
+					continue
+				}
+			}
+			r.mx.Lock()
+			if created {
+				res.markCreated()
+			}
+			if deleted {
+				res.deleted = true
+				res.deletedAt = time.Now()
+			}
+			r.mx.Unlock()
+		}
+	}
+	if errs != nil {
+		return s.wrapRunError(errs)
+	}
+	s.w.emitProgress(s, ProgressEvent{Stage: ProgressStepFinished, StepType: st})
+	return nil
+}
@@ -0,0 +1,118 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestResumeSteps(t *testing.T) {
+	ctx := context.Background()
+	var ran []int
+	var mx sync.Mutex
+	w := testTraverseWorkflow(func(i int) func(context.Context, *Step) DError {
+		return func(context.Context, *Step) DError {
+			mx.Lock()
+			defer mx.Unlock()
+			ran = append(ran, i)
+			return nil
+		}
+	})
+	if err := w.ResumeSteps([]string{"s0", "dne"}); err == nil {
+		t.Error("expected error for unknown step")
+	}
+	if err := w.ResumeSteps([]string{"s0", "s1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Ints(ran)
+	if fmt.Sprint(ran) != "[2 3 4]" {
+		t.Errorf("got steps %v run, want [2 3 4]", ran)
+	}
+}
+
+func TestResumeStepsResources(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	create := &Step{name: "create", w: w, testType: &mockStep{}}
+	other := &Step{name: "other", w: w, testType: &mockStep{}}
+	w.Steps = map[string]*Step{"create": create, "other": other}
+	w.ComputeClient = &daisyCompute.TestClient{
+		ListDisksFn: func(_, _ string, _ ...daisyCompute.ListCallOption) ([]*compute.Disk, error) {
+			return []*compute.Disk{{Name: "d"}, {Name: "o"}}, nil
+		},
+	}
+	link := func(name string) string {
+		return fmt.Sprintf("projects/%s/zones/%s/disks/%s", testProject, testZone, name)
+	}
+	if err := w.ResumeSteps([]string{"create"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d := &Resource{link: link("d")}
+	if err := w.disks.regCreate("d", d, create, false); err != nil {
+		t.Fatalf("existing resource of a finished step: unexpected error: %v", err)
+	}
+	if err := w.disks.regCreate("o", &Resource{link: link("o")}, other, false); err == nil {
+		t.Error("existing resource of a step not finished: expected error")
+	}
+	if err := create.run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.createdInWorkflow {
+		t.Error("resource of the finished step not marked as created")
+	}
+
+	if err := w.disks.regCreate("gone", &Resource{link: link("gone")}, create, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := create.run(ctx); err == nil {
+		t.Error("expected error for a missing resource of a finished step")
+	}
+}
+
+func TestLeaveResources(t *testing.T) {
+	for _, leave := range []bool{false, true} {
+		w := testWorkflow()
+		var deleted []string
+		w.ComputeClient = &daisyCompute.TestClient{
+			DeleteDiskFn: func(_, _, name string) error {
+				deleted = append(deleted, name)
+				return nil
+			},
+		}
+		create := &Step{name: "create", w: w, testType: &mockStep{}}
+		w.disks.m = map[string]*Resource{"d": {RealName: "d", link: fmt.Sprintf("projects/%s/zones/%s/disks/d", testProject, testZone), creator: create, createdInWorkflow: true}}
+		if leave {
+			w.LeaveResources()
+		}
+		w.cleanup()
+		if leave && len(deleted) > 0 {
+			t.Errorf("resources left: deleted %q", deleted)
+		}
+		if !leave && len(deleted) != 1 {
+			t.Errorf("resources not left: got deleted %q, want %q", deleted, "d")
+		}
+	}
+}
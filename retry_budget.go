@@ -0,0 +1,40 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+const apiFailingCancelReason = "was canceled because the compute API is persistently failing"
+
+// setupRetryBudget limits the compute API retries of the run to
+// MaxAPIRetries and cancels the workflow once MaxConsecutiveAPIFailures
+// calls in a row failed. It returns a func removing the limits, so that
+// cleanup can still delete resources.
+func (w *Workflow) setupRetryBudget() func() {
+	if (w.MaxAPIRetries == 0 && w.MaxConsecutiveAPIFailures == 0) || w.parent != nil {
+		return func() {}
+	}
+	w.ComputeClient.SetRetryBudget(&daisyCompute.RetryBudget{
+		MaxRetries:             w.MaxAPIRetries,
+		MaxConsecutiveFailures: w.MaxConsecutiveAPIFailures,
+		OnOpen: func() {
+			w.LogWorkflowInfo("WARNING: %d compute API calls in a row failed, canceling the workflow.", w.MaxConsecutiveAPIFailures)
+			w.CancelWithReason(apiFailingCancelReason)
+		},
+	})
+	return func() { w.ComputeClient.SetRetryBudget(nil) }
+}
@@ -0,0 +1,52 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestSetupRetryBudget(t *testing.T) {
+	w := testWorkflow()
+	var budget *daisyCompute.RetryBudget
+	var calls int
+	w.ComputeClient.(*daisyCompute.TestClient).SetRetryBudgetFn = func(b *daisyCompute.RetryBudget) {
+		calls++
+		budget = b
+	}
+
+	w.setupRetryBudget()()
+	if calls != 0 {
+		t.Error("retry budget set without limits")
+	}
+
+	w.MaxAPIRetries = 10
+	w.MaxConsecutiveAPIFailures = 5
+	remove := w.setupRetryBudget()
+	if budget == nil || budget.MaxRetries != 10 || budget.MaxConsecutiveFailures != 5 {
+		t.Fatalf("unexpected retry budget: %+v", budget)
+	}
+
+	budget.OnOpen()
+	if !w.isCanceled || w.getCancelReason() != apiFailingCancelReason {
+		t.Errorf("workflow not canceled with reason %q: canceled=%t reason=%q", apiFailingCancelReason, w.isCanceled, w.getCancelReason())
+	}
+	remove()
+	if budget != nil {
+		t.Error("retry budget not removed")
+	}
+}
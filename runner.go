@@ -0,0 +1,201 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+// Runner runs workflows concurrently within a shared resource budget and
+// compute API request rate, e.g. to build many image variants at once.
+//
+// Once validated, a workflow waits until the resources it uses at its peak,
+// as estimated by EstimatePeakResourceUsage, fit in the budget along with
+// those of the workflows running, and gives them back once it finished and
+// cleaned up. Waiting workflows are started in no particular order as
+// resources are given back.
+type Runner struct {
+	// MaxCPUs is the total number of CPUs the instances of the running
+	// workflows may have. 0 means no limit.
+	MaxCPUs int64
+	// MaxDisks is the total number of disks the running workflows may have.
+	// 0 means no limit.
+	MaxDisks int
+	// MaxAPIRequestsPerSecond limits the compute API requests of all the
+	// workflows together, retries and operation polling included. 0 means no
+	// limit.
+	MaxAPIRequestsPerSecond float64
+	// Hooks are set on the compute clients of the workflows, replacing
+	// theirs, with OnRequest called once the request is allowed by
+	// MaxAPIRequestsPerSecond.
+	Hooks *daisyCompute.Hooks
+
+	once    sync.Once
+	mx      sync.Mutex
+	inUse   ResourceUsage
+	changed chan struct{}
+	limiter *rateLimiter
+}
+
+// Run runs ws concurrently and returns their errors, in the order of ws, nil
+// for the workflows that succeeded.
+func (r *Runner) Run(ctx context.Context, ws ...*Workflow) []DError {
+	r.once.Do(func() {
+		r.changed = make(chan struct{})
+		if r.MaxAPIRequestsPerSecond > 0 {
+			r.limiter = &rateLimiter{interval: time.Duration(float64(time.Second) / r.MaxAPIRequestsPerSecond)}
+		}
+	})
+
+	errs := make([]DError, len(ws))
+	var wg sync.WaitGroup
+	for i, w := range ws {
+		wg.Add(1)
+		go func(i int, w *Workflow) {
+			defer wg.Done()
+			errs[i] = r.run(ctx, w)
+		}(i, w)
+	}
+	wg.Wait()
+	return errs
+}
+
+// run runs w once its resources fit in the budget.
+func (r *Runner) run(ctx context.Context, w *Workflow) DError {
+	// Populated first so that validation calls are rate limited too.
+	if err := w.PopulateClients(ctx); err != nil {
+		return Errf("error populating workflow: %v", err)
+	}
+	w.ComputeClient.SetHooks(r.hooks())
+
+	var acquired *ResourceUsage
+	defer func() {
+		if acquired != nil {
+			r.release(*acquired)
+		}
+	}()
+	if r.MaxCPUs == 0 && r.MaxDisks == 0 {
+		return w.Run(ctx)
+	}
+	return w.RunWithModifiers(ctx, func(m *Modifier) error {
+		usage, err := m.w.EstimatePeakResourceUsage()
+		if err != nil {
+			return err
+		}
+		if err := r.acquire(ctx, m.w, usage); err != nil {
+			return err
+		}
+		acquired = &usage
+		return nil
+	})
+}
+
+// hooks returns the hooks to set on the compute clients of the workflows.
+func (r *Runner) hooks() *daisyCompute.Hooks {
+	h := &daisyCompute.Hooks{}
+	if r.Hooks != nil {
+		*h = *r.Hooks
+	}
+	if r.limiter == nil {
+		return h
+	}
+	onRequest := h.OnRequest
+	h.OnRequest = func(req daisyCompute.Request) {
+		r.limiter.wait()
+		if onRequest != nil {
+			onRequest(req)
+		}
+	}
+	return h
+}
+
+// fits reports whether usage fits in the budget along with the resources in
+// use.
+func (r *Runner) fits(usage ResourceUsage) bool {
+	return (r.MaxCPUs == 0 || r.inUse.CPUs+usage.CPUs <= r.MaxCPUs) &&
+		(r.MaxDisks == 0 || r.inUse.Disks+usage.Disks <= r.MaxDisks)
+}
+
+// acquire waits until usage fits in the budget and adds it to the resources
+// in use. It fails if usage can never fit, or if ctx is done or w canceled
+// while waiting.
+func (r *Runner) acquire(ctx context.Context, w *Workflow, usage ResourceUsage) DError {
+	if r.MaxCPUs > 0 && usage.CPUs > r.MaxCPUs {
+		return Errf("workflow uses up to %d CPUs, more than the MaxCPUs %d of the runner", usage.CPUs, r.MaxCPUs)
+	}
+	if r.MaxDisks > 0 && usage.Disks > r.MaxDisks {
+		return Errf("workflow uses up to %d disks, more than the MaxDisks %d of the runner", usage.Disks, r.MaxDisks)
+	}
+	logged := false
+	for {
+		r.mx.Lock()
+		if r.fits(usage) {
+			r.inUse.CPUs += usage.CPUs
+			r.inUse.Disks += usage.Disks
+			r.mx.Unlock()
+			return nil
+		}
+		changed := r.changed
+		if !logged {
+			w.LogWorkflowInfo("Waiting for %d CPUs and %d disks, %d CPUs and %d disks in use by other workflows.", usage.CPUs, usage.Disks, r.inUse.CPUs, r.inUse.Disks)
+			logged = true
+		}
+		r.mx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Errf("workflow not started: %v", ctx.Err())
+		case <-w.Cancel:
+			return Errf("workflow canceled while waiting for resources")
+		}
+	}
+}
+
+// release gives back the resources of usage and wakes up the workflows
+// waiting for resources.
+func (r *Runner) release(usage ResourceUsage) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.inUse.CPUs -= usage.CPUs
+	r.inUse.Disks -= usage.Disks
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// rateLimiter spaces calls to wait by interval.
+type rateLimiter struct {
+	interval time.Duration
+
+	mx   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next call is allowed.
+func (l *rateLimiter) wait() {
+	l.mx.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mx.Unlock()
+	time.Sleep(d)
+}
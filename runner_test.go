@@ -0,0 +1,105 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestRunnerRun(t *testing.T) {
+	ctx := context.Background()
+	var mx sync.Mutex
+	ran := map[*Workflow]int{}
+	mockRun := func(int) func(context.Context, *Step) DError {
+		return func(_ context.Context, s *Step) DError {
+			mx.Lock()
+			defer mx.Unlock()
+			ran[s.w]++
+			return nil
+		}
+	}
+	w1, w2 := testTraverseWorkflow(mockRun), testTraverseWorkflow(mockRun)
+	w2.Steps["s4"].testType = &mockStep{runImpl: func(context.Context, *Step) DError { return Errf("failure") }}
+
+	r := &Runner{MaxCPUs: 8, MaxDisks: 4, MaxAPIRequestsPerSecond: 100}
+	errs := r.Run(ctx, w1, w2)
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if ran[w1] != 5 {
+		t.Errorf("%d steps of the first workflow ran, want 5", ran[w1])
+	}
+	for _, w := range []*Workflow{w1, w2} {
+		w.ComputeClient.(*daisyCompute.TestClient).AssertCalled(t, "SetHooks")
+	}
+	if r.inUse != (ResourceUsage{}) {
+		t.Errorf("resources not given back: %+v", r.inUse)
+	}
+}
+
+func TestRunnerAcquire(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	r := &Runner{MaxCPUs: 8, MaxDisks: 2}
+	r.Run(ctx)
+
+	if err := r.acquire(ctx, w, ResourceUsage{CPUs: 16}); err == nil {
+		t.Error("expected error for more CPUs than MaxCPUs")
+	}
+	if err := r.acquire(ctx, w, ResourceUsage{Disks: 3}); err == nil {
+		t.Error("expected error for more disks than MaxDisks")
+	}
+	if err := r.acquire(ctx, w, ResourceUsage{CPUs: 6, Disks: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acquired := make(chan DError)
+	go func() { acquired <- r.acquire(ctx, w, ResourceUsage{CPUs: 4}) }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired beyond MaxCPUs, error: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	r.release(ResourceUsage{CPUs: 6, Disks: 1})
+	if err := <-acquired; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if want := (ResourceUsage{CPUs: 4}); r.inUse != want {
+		t.Errorf("in use: got %+v, want %+v", r.inUse, want)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	go func() { acquired <- r.acquire(cctx, w, ResourceUsage{CPUs: 8}) }()
+	cancel()
+	if err := <-acquired; err == nil {
+		t.Error("expected error for a canceled context")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{interval: 10 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		l.wait()
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("4 calls took %s, want at least 30ms", d)
+	}
+}
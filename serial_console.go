@@ -0,0 +1,124 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// serialConsoleGateway is the SSH endpoint of the interactive serial
+// consoles of GCE instances.
+const serialConsoleGateway = "ssh-serialport.googleapis.com"
+
+// SerialConsole opens the interactive serial consoles of instances.
+type SerialConsole interface {
+	// Open connects to serial port port of an instance as user, whose SSH
+	// key is the PEM private key key. Reads return the console output and
+	// writes are typed on the console.
+	Open(ctx context.Context, project, zone, instance string, port int64, user string, key []byte) (io.ReadWriteCloser, error)
+}
+
+// sshSerialConsole is a SerialConsole connecting to the serial console
+// gateway with the ssh command. Host keys are checked against the
+// known_hosts file of the user, the key of the gateway is added to it on
+// first use.
+type sshSerialConsole struct{}
+
+type sshConsole struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+	dir string
+}
+
+func (c *sshConsole) Close() error {
+	c.WriteCloser.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return os.RemoveAll(c.dir)
+}
+
+func (sshSerialConsole) Open(ctx context.Context, project, zone, instance string, port int64, user string, key []byte) (io.ReadWriteCloser, error) {
+	dir, err := ioutil.TempDir("", "daisy-serial")
+	if err != nil {
+		return nil, err
+	}
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, key, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	login := fmt.Sprintf("%s.%s.%s.%s.port=%d", project, zone, instance, user, port)
+	cmd := exec.CommandContext(ctx, "ssh", "-i", keyFile, "-p", "9600", "-o", "BatchMode=yes", "-o", "IdentitiesOnly=yes",
+		"-o", "StrictHostKeyChecking=accept-new", login+"@"+serialConsoleGateway)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// Errors of ssh are shown with the console output.
+	r, w := io.Pipe()
+	cmd.Stdout, cmd.Stderr = w, w
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	go func() {
+		w.CloseWithError(cmd.Wait())
+	}()
+	return &sshConsole{Reader: r, WriteCloser: stdin, cmd: cmd, dir: dir}, nil
+}
+
+// serialConsole returns the SerialConsole used by w, the ssh command if
+// SerialConsole is not set.
+func (w *Workflow) serialConsole() SerialConsole {
+	if w.SerialConsole == nil {
+		return sshSerialConsole{}
+	}
+	return w.SerialConsole
+}
+
+// newSSHKey returns a new ECDSA P-256 private key in PEM format and its public
+// key in the authorized_keys format.
+func newSSHKey() ([]byte, string, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	der, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		return nil, "", err
+	}
+	var pub bytes.Buffer
+	for _, f := range [][]byte{[]byte("ecdsa-sha2-nistp256"), []byte("nistp256"), elliptic.Marshal(elliptic.P256(), k.X, k.Y)} {
+		binary.Write(&pub, binary.BigEndian, uint32(len(f)))
+		pub.Write(f)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), "ecdsa-sha2-nistp256 " + base64.StdEncoding.EncodeToString(pub.Bytes()), nil
+}
@@ -0,0 +1,51 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestNewSSHKey(t *testing.T) {
+	key, pub, err := newSSHKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := pem.Decode(key)
+	if b == nil || b.Type != "EC PRIVATE KEY" {
+		t.Fatalf("private key is not a PEM EC key: %q", key)
+	}
+	if _, err := x509.ParseECPrivateKey(b.Bytes); err != nil {
+		t.Errorf("error parsing private key: %v", err)
+	}
+
+	fields := strings.Fields(pub)
+	if len(fields) != 2 || fields[0] != "ecdsa-sha2-nistp256" {
+		t.Fatalf("public key not in the authorized_keys format: %q", pub)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		t.Fatalf("error decoding public key: %v", err)
+	}
+	// Key type, curve name and 65 bytes uncompressed point, each with a
+	// 4 bytes length.
+	if want := 4 + 19 + 4 + 8 + 4 + 65; len(blob) != want {
+		t.Errorf("public key blob is %d bytes, want %d", len(blob), want)
+	}
+}
@@ -0,0 +1,302 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	defaultSerialLogBufferSize = 1 << 20
+	defaultSerialLogMaxSize    = 256 << 20
+
+	// SerialLogSpillDisk spills serial output to a local temporary file.
+	SerialLogSpillDisk = "disk"
+	// SerialLogSpillGCS spills serial output to GCS objects next to the
+	// saved serial output, composed when it is saved.
+	SerialLogSpillGCS = "gcs"
+)
+
+// SerialLog caps what WaitForInstancesSignal steps keep of the serial output
+// they read, saved to the logs of the workflow on a match. Included and sub
+// workflows inherit each field their SerialLog does not set.
+type SerialLog struct {
+	// Bytes of serial output kept in memory per watched port, spilled once
+	// reached. Defaults to 1 MiB.
+	BufferSize int64 `json:",omitempty"`
+	// Where serial output is spilled, "disk" or "gcs". Defaults to "disk".
+	Spill string `json:",omitempty"`
+	// Bytes of serial output saved per watched port. Past it, output is
+	// dropped except for the last BufferSize bytes, saved after a note of
+	// how much was dropped. Defaults to 256 MiB, -1 means no limit.
+	MaxSize int64 `json:",omitempty"`
+}
+
+func (w *Workflow) validateSerialLog() DError {
+	sl := w.SerialLog
+	if sl == nil {
+		return nil
+	}
+	if sl.BufferSize < 0 {
+		return Errf("SerialLog.BufferSize must not be negative: %d", sl.BufferSize)
+	}
+	if sl.MaxSize < -1 {
+		return Errf("SerialLog.MaxSize must be -1 or more: %d", sl.MaxSize)
+	}
+	if sl.Spill != "" && sl.Spill != SerialLogSpillDisk && sl.Spill != SerialLogSpillGCS {
+		return Errf("SerialLog.Spill must be %q or %q: %q", SerialLogSpillDisk, SerialLogSpillGCS, sl.Spill)
+	}
+	return nil
+}
+
+// serialLogConfig returns the SerialLog of w, with each field unset taken
+// from the closest parent that sets it, or its default.
+func (w *Workflow) serialLogConfig() SerialLog {
+	var c SerialLog
+	for ; w != nil; w = w.parent {
+		if w.SerialLog == nil {
+			continue
+		}
+		if c.BufferSize == 0 {
+			c.BufferSize = w.SerialLog.BufferSize
+		}
+		if c.Spill == "" {
+			c.Spill = w.SerialLog.Spill
+		}
+		if c.MaxSize == 0 {
+			c.MaxSize = w.SerialLog.MaxSize
+		}
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = defaultSerialLogBufferSize
+	}
+	if c.Spill == "" {
+		c.Spill = SerialLogSpillDisk
+	}
+	if c.MaxSize == 0 {
+		c.MaxSize = defaultSerialLogMaxSize
+	}
+	return c
+}
+
+// serialLog holds the serial output of a watched port, to be saved to obj
+// in the logs of the workflow. Up to BufferSize bytes are held in memory,
+// then spilled. Once MaxSize bytes were written, only the last BufferSize
+// bytes are held.
+type serialLog struct {
+	w   *Workflow
+	cfg SerialLog
+	obj string
+
+	// buf holds the output not spilled yet.
+	buf     []byte
+	spilled int64
+	file    *os.File
+	// tail holds the last bytes written past MaxSize, overflow counts them.
+	tail     *ringBuffer
+	overflow int64
+	// warn logs a warning, it is called once if spilling fails.
+	warn func(format string, a ...interface{})
+	// held is the output held back from redaction, see redactStream.
+	held string
+}
+
+func newSerialLog(w *Workflow, obj string, warn func(format string, a ...interface{})) *serialLog {
+	return &serialLog{w: w, cfg: w.serialLogConfig(), obj: obj, warn: warn}
+}
+
+func (l *serialLog) spillObject() string { return l.obj + ".spill" }
+func (l *serialLog) partObject() string  { return l.obj + ".part" }
+
+// WriteString appends s to the log, with the values of Sensitive vars
+// replaced.
+func (l *serialLog) WriteString(s string) {
+	s, l.held = l.w.redactStream(l.held, s, false)
+	l.write(s)
+}
+
+// flush writes the output held back from redaction.
+func (l *serialLog) flush() {
+	s, _ := l.w.redactStream(l.held, "", true)
+	l.held = ""
+	l.write(s)
+}
+
+func (l *serialLog) write(s string) {
+	if l.cfg.MaxSize >= 0 {
+		room := l.cfg.MaxSize - l.spilled - int64(len(l.buf))
+		if room < int64(len(s)) {
+			if room > 0 {
+				l.writeHead(s[:room])
+				s = s[room:]
+			}
+			l.writeTail([]byte(s))
+			return
+		}
+	}
+	l.writeHead(s)
+}
+
+func (l *serialLog) writeHead(s string) {
+	l.buf = append(l.buf, s...)
+	if int64(len(l.buf)) >= l.cfg.BufferSize {
+		l.spill()
+	}
+}
+
+func (l *serialLog) writeTail(b []byte) {
+	if l.tail == nil {
+		l.tail = newRingBuffer(int(l.cfg.BufferSize))
+	}
+	l.tail.Write(b)
+	l.overflow += int64(len(b))
+}
+
+// spill moves buf to the spill file or object. If that fails, buf is moved
+// to the tail and nothing more is spilled.
+func (l *serialLog) spill() {
+	if len(l.buf) == 0 {
+		return
+	}
+	if err := l.spillBuf(); err != nil {
+		l.warn("error spilling serial output, only the last %d bytes of it past %d bytes are saved: %v", l.cfg.BufferSize, l.spilled, err)
+		l.cfg.MaxSize = l.spilled
+		buf := l.buf
+		l.buf = nil
+		l.writeTail(buf)
+		return
+	}
+	l.spilled += int64(len(l.buf))
+	l.buf = l.buf[:0]
+}
+
+func (l *serialLog) spillBuf() error {
+	if l.cfg.Spill == SerialLogSpillGCS {
+		ctx := context.Background()
+		s := l.w.storage()
+		if l.spilled == 0 {
+			return s.Put(ctx, l.w.bucket, l.spillObject(), "text/plain", bytes.NewReader(l.buf))
+		}
+		if err := s.Put(ctx, l.w.bucket, l.partObject(), "text/plain", bytes.NewReader(l.buf)); err != nil {
+			return err
+		}
+		return s.Compose(ctx, l.w.bucket, l.spillObject(), l.spillObject(), l.partObject())
+	}
+	if l.file == nil {
+		f, err := ioutil.TempFile("", "daisy-serial-")
+		if err != nil {
+			return err
+		}
+		l.file = f
+	}
+	_, err := l.file.Write(l.buf)
+	return err
+}
+
+// tailReader returns a reader of the output held in memory: buf and, past
+// MaxSize, a note of the bytes dropped followed by the tail.
+func (l *serialLog) tailReader() io.Reader {
+	rs := []io.Reader{bytes.NewReader(l.buf)}
+	if l.tail != nil {
+		if dropped := l.overflow - int64(l.tail.Len()); dropped > 0 {
+			rs = append(rs, strings.NewReader(fmt.Sprintf("\n[daisy: %d bytes of serial output dropped, SerialLog.MaxSize of %d bytes reached]\n", dropped, l.cfg.MaxSize)))
+		}
+		rs = append(rs, bytes.NewReader(l.tail.Bytes()))
+	}
+	return io.MultiReader(rs...)
+}
+
+// save saves all the output held to obj.
+func (l *serialLog) save(ctx context.Context) error {
+	l.flush()
+	s := l.w.storage()
+	switch {
+	case l.spilled == 0:
+		return s.Put(ctx, l.w.bucket, l.obj, "text/plain", l.tailReader())
+	case l.cfg.Spill == SerialLogSpillGCS:
+		if err := s.Put(ctx, l.w.bucket, l.partObject(), "text/plain", l.tailReader()); err != nil {
+			return err
+		}
+		return s.Compose(ctx, l.w.bucket, l.obj, l.spillObject(), l.partObject())
+	default:
+		r := io.MultiReader(io.NewSectionReader(l.file, 0, l.spilled), l.tailReader())
+		return s.Put(ctx, l.w.bucket, l.obj, "text/plain", r)
+	}
+}
+
+// close removes the spill file, if any.
+func (l *serialLog) close() {
+	if l.file != nil {
+		l.file.Close()
+		os.Remove(l.file.Name())
+		l.file = nil
+	}
+}
+
+// ringBuffer holds the last bytes written to it, up to its size.
+type ringBuffer struct {
+	b    []byte
+	pos  int
+	full bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{b: make([]byte, size)}
+}
+
+// Write writes p, overwriting the oldest bytes once full.
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(r.b) == 0 {
+		return n, nil
+	}
+	if len(p) >= len(r.b) {
+		copy(r.b, p[len(p)-len(r.b):])
+		r.pos, r.full = 0, true
+		return n, nil
+	}
+	c := copy(r.b[r.pos:], p)
+	if c < len(p) {
+		copy(r.b, p[c:])
+		r.full = true
+	}
+	r.pos = (r.pos + len(p)) % len(r.b)
+	if r.pos == 0 {
+		r.full = true
+	}
+	return n, nil
+}
+
+// Len returns the number of bytes held.
+func (r *ringBuffer) Len() int {
+	if r.full {
+		return len(r.b)
+	}
+	return r.pos
+}
+
+// Bytes returns the bytes held, oldest first.
+func (r *ringBuffer) Bytes() []byte {
+	if !r.full {
+		return append([]byte{}, r.b[:r.pos]...)
+	}
+	return append(append([]byte{}, r.b[r.pos:]...), r.b[:r.pos]...)
+}
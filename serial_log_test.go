@@ -0,0 +1,169 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		desc   string
+		writes []string
+		want   string
+	}{
+		{"empty case", nil, ""},
+		{"not full case", []string{"ab", "c"}, "abc"},
+		{"exactly full case", []string{"ab", "cd"}, "abcd"},
+		{"wrap case", []string{"abc", "def"}, "cdef"},
+		{"large write case", []string{"a", "bcdefgh"}, "efgh"},
+		{"many writes case", []string{"a", "b", "c", "d", "e", "f"}, "cdef"},
+	}
+	for _, tt := range tests {
+		r := newRingBuffer(4)
+		for _, s := range tt.writes {
+			r.Write([]byte(s))
+		}
+		if got := string(r.Bytes()); got != tt.want || r.Len() != len(tt.want) {
+			t.Errorf("%s: got %q (len %d), want %q", tt.desc, got, r.Len(), tt.want)
+		}
+	}
+}
+
+func TestSerialLog(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc  string
+		cfg   *SerialLog
+		want  string
+		spill bool
+	}{
+		{"in memory case", &SerialLog{BufferSize: 100}, "0123456789abcdefghij", false},
+		{"disk case", &SerialLog{BufferSize: 4}, "0123456789abcdefghij", true},
+		{"gcs case", &SerialLog{BufferSize: 4, Spill: SerialLogSpillGCS}, "0123456789abcdefghij", true},
+		{"no limit case", &SerialLog{BufferSize: 4, MaxSize: -1}, "0123456789abcdefghij", true},
+		{"max size case", &SerialLog{BufferSize: 4, MaxSize: 8}, "01234567\n[daisy: 8 bytes of serial output dropped, SerialLog.MaxSize of 8 bytes reached]\nghij", true},
+		{"gcs max size case", &SerialLog{BufferSize: 4, MaxSize: 8, Spill: SerialLogSpillGCS}, "01234567\n[daisy: 8 bytes of serial output dropped, SerialLog.MaxSize of 8 bytes reached]\nghij", true},
+		{"max size in tail case", &SerialLog{BufferSize: 4, MaxSize: 17}, "0123456789abcdefghij", true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		fs := &FakeStorage{}
+		w.Storage = fs
+		w.bucket = "bucket"
+		w.SerialLog = tt.cfg
+		l := newSerialLog(w, "logs/i-serial-port1-wait.log", func(format string, a ...interface{}) {
+			t.Errorf("%s: unexpected warning: "+format, append([]interface{}{tt.desc}, a...)...)
+		})
+		for _, s := range []string{"012", "3456", "789ab", "cdef", "g", "hij"} {
+			l.WriteString(s)
+		}
+		if int64(len(l.buf)) > tt.cfg.BufferSize || (l.tail != nil && int64(l.tail.Len()) > tt.cfg.BufferSize) {
+			t.Errorf("%s: holding %d bytes, more than BufferSize", tt.desc, len(l.buf))
+		}
+		if (l.spilled > 0) != tt.spill {
+			t.Errorf("%s: spilled %d bytes, want spill: %v", tt.desc, l.spilled, tt.spill)
+		}
+		if err := l.save(ctx); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		}
+		file := l.file
+		l.close()
+		if file != nil {
+			if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+				t.Errorf("%s: spill file %s not removed", tt.desc, file.Name())
+			}
+		}
+		r, err := fs.Get(ctx, "bucket", "logs/i-serial-port1-wait.log", 0)
+		if err != nil {
+			t.Errorf("%s: saved output not found: %v", tt.desc, err)
+			continue
+		}
+		got, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(got) != tt.want {
+			t.Errorf("%s: saved output: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+type failingPutStorage struct {
+	Storage
+}
+
+func (failingPutStorage) Put(ctx context.Context, bucket, object, contentType string, r io.Reader) error {
+	return errors.New("put failed")
+}
+
+func TestSerialLogSpillError(t *testing.T) {
+	w := testWorkflow()
+	w.Storage = failingPutStorage{&FakeStorage{}}
+	w.SerialLog = &SerialLog{BufferSize: 4, Spill: SerialLogSpillGCS}
+	var warnings []string
+	l := newSerialLog(w, "logs/i.log", func(format string, a ...interface{}) {
+		warnings = append(warnings, format)
+	})
+	for _, s := range []string{"0123", "4567", "89"} {
+		l.WriteString(s)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got %d warnings, want 1: %q", len(warnings), warnings)
+	}
+	if got, want := string(l.tail.Bytes()), "6789"; got != want || len(l.buf) != 0 {
+		t.Errorf("tail: got %q, want %q, buf %q", got, want, l.buf)
+	}
+}
+
+func TestSerialLogConfig(t *testing.T) {
+	parent := testWorkflow()
+	parent.SerialLog = &SerialLog{BufferSize: 10, Spill: SerialLogSpillGCS}
+	child := New()
+	child.parent = parent
+	child.SerialLog = &SerialLog{BufferSize: 20}
+	want := SerialLog{BufferSize: 20, Spill: SerialLogSpillGCS, MaxSize: defaultSerialLogMaxSize}
+	if diffRes := diff(child.serialLogConfig(), want, 0); diffRes != "" {
+		t.Errorf("config does not match expectation: (-got +want)\n%s", diffRes)
+	}
+	want = SerialLog{BufferSize: defaultSerialLogBufferSize, Spill: SerialLogSpillDisk, MaxSize: defaultSerialLogMaxSize}
+	if diffRes := diff(New().serialLogConfig(), want, 0); diffRes != "" {
+		t.Errorf("default config does not match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	tests := []struct {
+		desc    string
+		cfg     *SerialLog
+		wantErr string
+	}{
+		{"unset case", nil, ""},
+		{"valid case", &SerialLog{BufferSize: 1, Spill: SerialLogSpillDisk, MaxSize: -1}, ""},
+		{"negative buffer case", &SerialLog{BufferSize: -1}, "BufferSize"},
+		{"negative max case", &SerialLog{MaxSize: -2}, "MaxSize"},
+		{"bad spill case", &SerialLog{Spill: "memory"}, "Spill"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.SerialLog = tt.cfg
+		err := w.validateSerialLog()
+		if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got error %v, want %q", tt.desc, err, tt.wantErr)
+		}
+	}
+}
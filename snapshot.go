@@ -97,7 +97,7 @@ func newSnapshotRegistry(w *Workflow) *snapshotRegistry {
 
 func (sr *snapshotRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(snapshotURLRgx, res.link)
-	err := sr.w.ComputeClient.DeleteSnapshot(m["project"], m["snapshot"])
+	err := sr.w.resourceClient(res).DeleteSnapshot(m["project"], m["snapshot"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete snapshot", err)
 	}
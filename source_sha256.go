@@ -0,0 +1,112 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var sha256Rgx = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// validateSourceSHA256 checks that each SourceSHA256 of w is a hex SHA-256
+// hash of a source of w that is a file or GCS object.
+func (w *Workflow) validateSourceSHA256() DError {
+	var errs DError
+	for _, k := range sortedSourceSHA256(w) {
+		src, ok := w.Sources[k]
+		switch {
+		case !ok:
+			errs = addErrs(errs, Errf("SourceSHA256: workflow %q has no source %q", w.Name, k))
+		case !sha256Rgx.MatchString(w.SourceSHA256[k]):
+			errs = addErrs(errs, Errf("SourceSHA256: %q for source %q is not a lowercase hex SHA-256 hash", w.SourceSHA256[k], k))
+		case strings.HasSuffix(src, "/"):
+			errs = addErrs(errs, Errf("SourceSHA256: source %q is a directory, only files can be pinned", k))
+		}
+	}
+	return errs
+}
+
+// verifySources checks that the sources of w with a SourceSHA256 have that
+// hash, reading local files and downloading GCS objects, before any of them
+// is uploaded.
+func (w *Workflow) verifySources(ctx context.Context) DError {
+	for _, k := range sortedSourceSHA256(w) {
+		src := w.Sources[k]
+		h := sha256.New()
+		if bkt, obj, err := splitGCSPath(src); err == nil {
+			if err := DownloadObject(ctx, w.storage(), bkt, obj, h); err != nil {
+				return Errf("failed to verify source %q: %v", k, err)
+			}
+		} else {
+			if !filepath.IsAbs(src) {
+				src = filepath.Join(w.workflowDir, src)
+			}
+			f, err := os.Open(src)
+			if err != nil {
+				return typedErr(fileIOError, "failed to open local file", err)
+			}
+			fi, err := f.Stat()
+			if err == nil && fi.IsDir() {
+				f.Close()
+				return Errf("failed to verify source %q: %s is a directory", k, src)
+			}
+			if err == nil {
+				_, err = io.Copy(h, f)
+			}
+			f.Close()
+			if err != nil {
+				return Errf("failed to verify source %q: %v", k, err)
+			}
+		}
+		if err := w.checkSourceSHA256(k, h.Sum(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifySourceContent checks that content, read from source k, has the
+// SourceSHA256 of k, if set.
+func (w *Workflow) verifySourceContent(k string, content []byte) DError {
+	if _, ok := w.SourceSHA256[k]; !ok {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return w.checkSourceSHA256(k, sum[:])
+}
+
+func (w *Workflow) checkSourceSHA256(k string, sum []byte) DError {
+	if got := hex.EncodeToString(sum); got != w.SourceSHA256[k] {
+		return Errf("source %q (%s) has SHA-256 %s, want %s: it was modified or is stale", k, w.Sources[k], got, w.SourceSHA256[k])
+	}
+	return nil
+}
+
+func sortedSourceSHA256(w *Workflow) []string {
+	var ks []string
+	for k := range w.SourceSHA256 {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,92 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSourceSHA256(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "local.sh"), []byte("echo local"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs := &FakeStorage{}
+	if err := fs.Put(ctx, "bucket", "gcs.sh", "", bytes.NewReader([]byte("echo gcs"))); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		desc                  string
+		sha256                map[string]string
+		wantValidateErr       string
+		wantVerifyErr         string
+		wantContentErrForKeys []string
+	}{
+		{"matching case", map[string]string{"local.sh": hash("echo local"), "gcs.sh": hash("echo gcs")}, "", "", nil},
+		{"stale local case", map[string]string{"local.sh": hash("echo old")}, "", "was modified or is stale", []string{"local.sh"}},
+		{"tampered GCS case", map[string]string{"gcs.sh": hash("echo evil")}, "", "was modified or is stale", []string{"gcs.sh"}},
+		{"unknown source case", map[string]string{"other.sh": hash("")}, "has no source", "", nil},
+		{"bad hash case", map[string]string{"local.sh": strings.ToUpper(hash("echo local"))}, "not a lowercase hex SHA-256 hash", "", nil},
+		{"directory case", map[string]string{"dir": hash("")}, "only files can be pinned", "", nil},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.workflowDir = dir
+		w.Storage = fs
+		w.Sources = map[string]string{"local.sh": "local.sh", "gcs.sh": "gs://bucket/gcs.sh", "dir": "gs://bucket/dir/"}
+		w.SourceSHA256 = tt.sha256
+
+		err := w.validateSourceSHA256()
+		if tt.wantValidateErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantValidateErr) {
+				t.Errorf("%s: got validation error %v, want %q", tt.desc, err, tt.wantValidateErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected validation error: %v", tt.desc, err)
+		}
+
+		err = w.verifySources(ctx)
+		if (err != nil) != (tt.wantVerifyErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantVerifyErr)) {
+			t.Errorf("%s: got error %v, want %q", tt.desc, err, tt.wantVerifyErr)
+		}
+
+		for _, k := range []string{"local.sh", "gcs.sh"} {
+			_, err := w.sourceContent(ctx, k)
+			if wantErr := strIn(k, tt.wantContentErrForKeys); (err != nil) != wantErr {
+				t.Errorf("%s: source %q content error: %v, want error: %v", tt.desc, k, err, wantErr)
+			}
+		}
+	}
+}
@@ -17,7 +17,6 @@ package daisy
 import (
 	"bytes"
 	"context"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -74,6 +73,52 @@ func (w *Workflow) recursiveGCS(ctx context.Context, bkt, prefix, dst string) DE
 	return nil
 }
 
+// stagedSourcesDir is the Sources directory gs:// inputs are staged to.
+const stagedSourcesDir = "daisy-staged"
+
+// stageGCSInput returns the GCS path to use for the input at p. If the top
+// level workflow has StageGCSInputs set and p is an object in a bucket other
+// than the scratch bucket, p is added to the Sources of the workflow that
+// uploads the sources of w and the path of the staged copy is returned.
+func (w *Workflow) stageGCSInput(p string) (string, DError) {
+	if !w.root().StageGCSInputs {
+		return p, nil
+	}
+	bkt, obj, err := splitGCSPath(p)
+	if err != nil || obj == "" || bkt == w.bucket {
+		return p, nil
+	}
+	src := "gs://" + path.Join(bkt, obj)
+	dst := path.Join(stagedSourcesDir, bkt, obj)
+	staged := "gs://" + path.Join(w.bucket, w.sourcesPath, dst)
+	sw := w.sourcesWorkflow()
+	if v, ok := sw.Sources[dst]; ok {
+		if v != src {
+			return "", Errf("cannot stage %q, source %q already exists", p, dst)
+		}
+		return staged, nil
+	}
+	if sw.Sources == nil {
+		sw.Sources = map[string]string{}
+	}
+	sw.Sources[dst] = src
+	// The copy is made when sources are uploaded, after validation.
+	if err := w.objects.regCreate(path.Join(w.bucket, w.sourcesPath, dst)); err != nil {
+		return "", err
+	}
+	return staged, nil
+}
+
+// sourcesWorkflow returns the workflow uploading the sources of w: the
+// workflow w is included in by IncludeWorkflow steps, which shares the objects
+// registry of w, or w itself.
+func (w *Workflow) sourcesWorkflow() *Workflow {
+	for w.parent != nil && w.parent.objects == w.objects {
+		w = w.parent
+	}
+	return w
+}
+
 func (w *Workflow) sourceExists(s string) bool {
 	_, ok := w.Sources[s]
 	return ok
@@ -90,21 +135,21 @@ func (w *Workflow) sourceContent(ctx context.Context, s string) (string, error)
 			return "", Errf("source %s appears to be a GCS 'bucket'", src)
 
 		}
-		src := w.StorageClient.Bucket(bkt).Object(objPath)
-		r, err := src.NewReader(ctx)
+		attrs, err := w.storage().Attrs(ctx, bkt, objPath)
 		if err != nil {
 			return "", Errf("error reading from file %s/%s: %v", bkt, objPath, err)
 		}
-		defer r.Close()
-
-		if r.Size() > 1024 {
-			return "", Errf("file size is too large %s/%s: %d", bkt, objPath, r.Size())
+		if attrs.Size > 1024 {
+			return "", Errf("file size is too large %s/%s: %d", bkt, objPath, attrs.Size)
 		}
 
 		var buf bytes.Buffer
-		if _, err := io.Copy(&buf, r); err != nil {
+		if err := DownloadObject(ctx, w.storage(), bkt, objPath, &buf); err != nil {
 			return "", Errf("error reading from file %s/%s: %v", bkt, objPath, err)
 		}
+		if err := w.verifySourceContent(s, buf.Bytes()); err != nil {
+			return "", err
+		}
 
 		return buf.String(), nil
 	}
@@ -120,24 +165,26 @@ func (w *Workflow) sourceContent(ctx context.Context, s string) (string, error)
 	if err != nil {
 		return "", newErr("failed to read local file content", err)
 	}
+	if err := w.verifySourceContent(s, d); err != nil {
+		return "", err
+	}
 	return string(d), nil
 }
 
 func (w *Workflow) uploadFile(ctx context.Context, src, obj string) DError {
 	obj = filepath.ToSlash(obj)
-	dstPath := w.StorageClient.Bucket(w.bucket).Object(path.Join(w.sourcesPath, obj))
-	gcs := dstPath.NewWriter(ctx)
 	f, err := os.Open(src)
 	if err != nil {
 		return newErr("failed to open local file for uploading", err)
 	}
-	if _, err := io.Copy(gcs, f); err != nil {
-		return newErr("failed to copy local file to GCS", err)
-	}
-	return newErr("failed to close GCS object", gcs.Close())
+	defer f.Close()
+	return newErr("failed to copy local file to GCS", w.storage().Put(ctx, w.bucket, path.Join(w.sourcesPath, obj), "", f))
 }
 
 func (w *Workflow) uploadSources(ctx context.Context) DError {
+	if err := w.verifySources(ctx); err != nil {
+		return err
+	}
 	for dst, origPath := range w.Sources {
 		if origPath == "" {
 			continue
@@ -21,6 +21,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"google.golang.org/api/compute/v1"
 )
 
 func TestUploadSources(t *testing.T) {
@@ -116,3 +118,99 @@ func TestUploadSources(t *testing.T) {
 		}
 	}
 }
+
+func TestStageGCSInput(t *testing.T) {
+	w := testWorkflow()
+	w.bucket = "scratch"
+	w.sourcesPath = "sources"
+
+	// Staging is off by default.
+	if got, err := w.stageGCSInput("gs://other/script.sh"); err != nil || got != "gs://other/script.sh" {
+		t.Errorf("unexpected result with staging off: %q, %v", got, err)
+	}
+
+	w.StageGCSInputs = true
+	tests := []struct {
+		desc, in, want string
+	}{
+		{"other bucket", "gs://other/dir/script.sh", "gs://scratch/sources/daisy-staged/other/dir/script.sh"},
+		{"same object twice", "gs://other/dir/script.sh", "gs://scratch/sources/daisy-staged/other/dir/script.sh"},
+		{"scratch bucket", "gs://scratch/script.sh", "gs://scratch/script.sh"},
+		{"not GCS", "https://example.com/script.sh", "https://example.com/script.sh"},
+	}
+	for _, tt := range tests {
+		got, err := w.stageGCSInput(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+	want := map[string]string{"daisy-staged/other/dir/script.sh": "gs://other/dir/script.sh"}
+	if !reflect.DeepEqual(w.Sources, want) {
+		t.Errorf("unexpected sources: %v", w.Sources)
+	}
+
+	// Included workflows stage to the top level workflow.
+	iw := New()
+	w.includeWorkflow(iw)
+	iw.bucket = w.bucket
+	iw.sourcesPath = w.sourcesPath
+	if got, err := iw.stageGCSInput("gs://other/disk.tar.gz"); err != nil || got != "gs://scratch/sources/daisy-staged/other/disk.tar.gz" {
+		t.Errorf("unexpected result for included workflow: %q, %v", got, err)
+	}
+	if got, err := iw.stageGCSInput("gs://other/dir/script.sh"); err != nil || got != "gs://scratch/sources/daisy-staged/other/dir/script.sh" {
+		t.Errorf("unexpected result for an object staged by the parent: %q, %v", got, err)
+	}
+	if len(iw.Sources) != 0 || w.Sources["daisy-staged/other/disk.tar.gz"] != "gs://other/disk.tar.gz" {
+		t.Errorf("included workflow should stage to its parent: %v, %v", iw.Sources, w.Sources)
+	}
+}
+
+func TestStageGCSInputIncludeWorkflow(t *testing.T) {
+	ctx := context.Background()
+	create := func(name string) *Step {
+		return &Step{CreateInstances: &CreateInstances{Instances: []*Instance{{
+			Instance: compute.Instance{Name: name, MachineType: testMachineType},
+			Metadata: map[string]string{"startup-script-url": "gs://other/startup.sh"},
+		}}}}
+	}
+	// The parent stages the object before the included workflow does.
+	w := testWorkflow()
+	w.StageGCSInputs = true
+	w.Steps = map[string]*Step{"create": create("parent")}
+	if err := w.populate(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	iw := New()
+	iw.Steps = map[string]*Step{"create": create("child")}
+	s, _ := w.NewStep("include")
+	s.IncludeWorkflow = &IncludeWorkflow{Workflow: iw}
+	if err := w.populateStep(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]string{"daisy-staged/other/startup.sh": "gs://other/startup.sh"}; !reflect.DeepEqual(w.Sources, want) {
+		t.Errorf("got sources %v, want %v", w.Sources, want)
+	}
+}
+
+func TestStageGCSInputMetadata(t *testing.T) {
+	w := testWorkflow()
+	w.StageGCSInputs = true
+	w.bucket = "scratch"
+	w.sourcesPath = "sources"
+	ib := &InstanceBase{}
+	i := &Instance{Metadata: map[string]string{
+		"startup-script-url":  "gs://other/startup.sh",
+		"shutdown-script-url": "gs://scratch/shutdown.sh",
+	}}
+	if err := ib.populateMetadata(i, w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := i.Metadata["startup-script-url"]; got != "gs://scratch/sources/daisy-staged/other/startup.sh" {
+		t.Errorf("startup-script-url not staged: %q", got)
+	}
+	if got := i.Metadata["shutdown-script-url"]; got != "gs://scratch/shutdown.sh" {
+		t.Errorf("shutdown-script-url in the scratch bucket should not be staged: %q", got)
+	}
+}
@@ -0,0 +1,108 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import "fmt"
+
+const (
+	// StartupScriptSuccessMatch is written to the serial console by the
+	// startup script harness when the wrapped script succeeds. Use it as the
+	// SuccessMatch of a WaitForInstancesSignal.
+	StartupScriptSuccessMatch = "DaisySuccess: startup script finished"
+	// StartupScriptFailureMatch is written to the serial console by the
+	// startup script harness when the wrapped script fails. Use it as the
+	// FailureMatch of a WaitForInstancesSignal.
+	StartupScriptFailureMatch = "DaisyFailure: startup script failed"
+
+	// startupScriptURLMetadataKey holds the wrapped script when the harness is
+	// used.
+	startupScriptURLMetadataKey = "daisy-startup-script-url"
+	startupScriptRetries        = 5
+)
+
+// startupScriptHarness returns a shell startup script running the script at
+// daisy-startup-script-url. Package manager commands are retried on failure,
+// the heartbeat guest attribute is updated while the script runs, the
+// CollectArtifacts paths of daisy-artifact-paths are uploaded once it ends,
+// and the result is reported with StartupScriptSuccessMatch or
+// StartupScriptFailureMatch.
+func startupScriptHarness() string {
+	// Avoid ${} expansions, they would be taken for unresolved workflow vars.
+	return fmt.Sprintf(`#!/bin/bash
+exec > >(tee /dev/console) 2>&1
+echo "Daisy startup script harness: starting at $(date -u)"
+
+daisy_retry() {
+  local i
+  for i in $(seq 1 %[1]d); do
+    command "$@" && return 0
+    echo "Daisy startup script harness: '$*' failed, attempt $i/%[1]d"
+    sleep $((i * 5))
+  done
+  return 1
+}
+apt-get() { daisy_retry apt-get "$@"; }
+yum() { daisy_retry yum "$@"; }
+dnf() { daisy_retry dnf "$@"; }
+export -f daisy_retry apt-get yum dnf
+%[5]s%[6]sdaisy_heartbeat
+
+url=$(curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/attributes/%[2]s)
+script=$(mktemp)
+if ! daisy_retry gsutil cp "$url" "$script"; then
+  echo "%[4]s: could not download $url"
+  exit 1
+fi
+chmod +x "$script"
+"$script"
+status=$?
+daisy_upload_artifacts
+if [ $status -eq 0 ]; then
+  echo "%[3]s"
+else
+  echo "%[4]s: exit status $status"
+fi
+exit $status
+`, startupScriptRetries, startupScriptURLMetadataKey, StartupScriptSuccessMatch, StartupScriptFailureMatch, heartbeatShellFunc(), artifactsShellFunc())
+}
+
+// windowsStartupScriptHarness is the PowerShell counterpart of
+// startupScriptHarness.
+func windowsStartupScriptHarness() string {
+	return fmt.Sprintf(`Write-Host "Daisy startup script harness: starting at $(Get-Date)"
+%[4]s%[5]sStart-DaisyHeartbeat
+$url = Invoke-RestMethod -Headers @{'Metadata-Flavor'='Google'} -Uri http://metadata.google.internal/computeMetadata/v1/instance/attributes/%[1]s
+$script = Join-Path $env:TEMP (Split-Path $url -Leaf)
+& gsutil cp $url $script
+if ($LASTEXITCODE -ne 0) {
+  Write-Host "%[3]s: could not download $url"
+  exit 1
+}
+try {
+  & $script
+  $status = $LASTEXITCODE
+} catch {
+  Write-Host $_
+  $status = 1
+}
+Send-DaisyArtifacts
+if (-not $status) {
+  Write-Host "%[2]s"
+  exit 0
+}
+Write-Host "%[3]s: exit status $status"
+exit $status
+`, startupScriptURLMetadataKey, StartupScriptSuccessMatch, StartupScriptFailureMatch, heartbeatPowerShellFunc(), artifactsPowerShellFunc())
+}
@@ -44,6 +44,32 @@ type Step struct {
 	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
 	Timeout string `json:",omitempty"`
 	timeout time.Duration
+	// Time added to Timeout for each GB of the largest source disk or image
+	// of CreateImages, CreateDisks, CreateSnapshots and ExportImage steps, or
+	// of the source file of ImportDisk steps, so the timeout grows with the
+	// amount of data to process.
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	TimeoutPerGb string `json:",omitempty"`
+	timeoutPerGb time.Duration
+	// Steps with a higher priority are started first when the workflow's
+	// MaxConcurrency is reached.
+	Priority int `json:",omitempty"`
+	// Steps this step runs after once they finished, whether they succeeded
+	// or failed, e.g. to collect logs. They are added to the workflow's
+	// Dependencies of the step.
+	DependsOnCompletionOf []string `json:",omitempty"`
+	// Start the step even after another step failed and the workflow starts
+	// no more steps, e.g. to report on the run. Its dependencies must still
+	// succeed, unless they are in DependsOnCompletionOf.
+	AlwaysRun bool `json:",omitempty"`
+	// Start the step even if the workflow is canceled, see Finally.
+	runOnCancel bool
+	// Rerun the step, only supported by SubWorkflow steps. Timeout is that
+	// of each run.
+	Repeat *Repeat `json:",omitempty"`
+	// Env overrides the project, zone, default network and service account
+	// of the step, and of the steps of included and sub workflows.
+	Env *StepEnv `json:",omitempty"`
 	// Only one of the below fields should exist for each instance of Step.
 	AttachDisks               *AttachDisks               `json:",omitempty"`
 	DetachDisks               *DetachDisks               `json:",omitempty"`
@@ -68,6 +94,20 @@ type Step struct {
 	WaitForInstancesSignal    *WaitForInstancesSignal    `json:",omitempty"`
 	WaitForAnyInstancesSignal *WaitForAnyInstancesSignal `json:",omitempty"`
 	UpdateInstancesMetadata   *UpdateInstancesMetadata   `json:",omitempty"`
+	ResetWindowsPassword      *ResetWindowsPassword      `json:",omitempty"`
+	UpdateSSHAccess           *UpdateSSHAccess           `json:",omitempty"`
+	UpdateProjectMetadata     *UpdateProjectMetadata     `json:",omitempty"`
+	SendSerialInput           *SendSerialInput           `json:",omitempty"`
+	TestBootImage             *TestBootImage             `json:",omitempty"`
+	InspectDisk               *InspectDisk               `json:",omitempty"`
+	ExportImage               *ExportImage               `json:",omitempty"`
+	ImportDisk                *ImportDisk                `json:",omitempty"`
+	CloneInstance             *CloneInstance             `json:",omitempty"`
+	SignArtifacts             *SignArtifacts             `json:",omitempty"`
+	InjectFaults              *InjectFaults              `json:",omitempty"`
+	ResetInstances            *ResetInstances            `json:",omitempty"`
+	SimulateMaintenanceEvents *SimulateMaintenanceEvents `json:",omitempty"`
+	UpdateInstancesScheduling *UpdateInstancesScheduling `json:",omitempty"`
 	// Used for unit tests.
 	testType stepImpl
 }
@@ -181,6 +221,62 @@ func (s *Step) stepImpl() (stepImpl, DError) {
 		matchCount++
 		result = s.UpdateInstancesMetadata
 	}
+	if s.ResetWindowsPassword != nil {
+		matchCount++
+		result = s.ResetWindowsPassword
+	}
+	if s.UpdateSSHAccess != nil {
+		matchCount++
+		result = s.UpdateSSHAccess
+	}
+	if s.UpdateProjectMetadata != nil {
+		matchCount++
+		result = s.UpdateProjectMetadata
+	}
+	if s.SendSerialInput != nil {
+		matchCount++
+		result = s.SendSerialInput
+	}
+	if s.TestBootImage != nil {
+		matchCount++
+		result = s.TestBootImage
+	}
+	if s.InspectDisk != nil {
+		matchCount++
+		result = s.InspectDisk
+	}
+	if s.ExportImage != nil {
+		matchCount++
+		result = s.ExportImage
+	}
+	if s.ImportDisk != nil {
+		matchCount++
+		result = s.ImportDisk
+	}
+	if s.CloneInstance != nil {
+		matchCount++
+		result = s.CloneInstance
+	}
+	if s.SignArtifacts != nil {
+		matchCount++
+		result = s.SignArtifacts
+	}
+	if s.InjectFaults != nil {
+		matchCount++
+		result = s.InjectFaults
+	}
+	if s.ResetInstances != nil {
+		matchCount++
+		result = s.ResetInstances
+	}
+	if s.SimulateMaintenanceEvents != nil {
+		matchCount++
+		result = s.SimulateMaintenanceEvents
+	}
+	if s.UpdateInstancesScheduling != nil {
+		matchCount++
+		result = s.UpdateInstancesScheduling
+	}
 	if s.testType != nil {
 		matchCount++
 		result = s.testType
@@ -294,36 +390,93 @@ func (s *Step) run(ctx context.Context) DError {
 	if err != nil {
 		return s.wrapRunError(err)
 	}
-	var st string
-	if t := reflect.TypeOf(impl); t.Kind() == reflect.Ptr {
-		st = t.Elem().Name()
-	} else {
-		st = t.Name()
+	st := stepTypeName(impl)
+	if s.w.resumedSteps[s.name] {
+		return s.resume(st)
 	}
 	s.w.LogWorkflowInfo("Running step %q (%s)", s.name, st)
+	s.w.emitProgress(s, ProgressEvent{Stage: ProgressStepStarted, StepType: st})
 	if err = impl.run(ctx, s); err != nil {
-		return s.wrapRunError(err)
+		err = s.wrapRunError(err)
+		s.w.emitProgress(s, ProgressEvent{Stage: ProgressStepFailed, StepType: st, Message: err.Error()})
+		return err
 	}
 	select {
 	case <-s.w.Cancel:
 		// return an error to indicate a canceled workflow is not 'success'
-		return s.w.onStepCancel(s, st)
+		if !s.runOnCancel {
+			return s.w.onStepCancel(s, st)
+		}
 	default:
-		s.w.LogWorkflowInfo("Step %q (%s) successfully finished.", s.name, st)
 	}
+	s.w.LogWorkflowInfo("Step %q (%s) successfully finished.", s.name, st)
+	s.w.emitProgress(s, ProgressEvent{Stage: ProgressStepFinished, StepType: st})
 	return nil
 }
 
+func stepTypeName(impl stepImpl) string {
+	t := reflect.TypeOf(impl)
+	if t.Kind() == reflect.Ptr {
+		return t.Elem().Name()
+	}
+	return t.Name()
+}
+
+// timeoutWarningTailLines is the number of serial port output lines logged
+// for each instance of a wait step close to its timeout.
+const timeoutWarningTailLines = 10
+
+// warnTimeout logs that s has been running for pct percent of its timeout.
+// For wait steps, the last serial port output lines of the instances waited
+// for are logged too, so it can take as long as the API calls: run it in its
+// own goroutine.
+func (s *Step) warnTimeout(pct int) {
+	impl, err := s.stepImpl()
+	if err != nil {
+		return
+	}
+	st := stepTypeName(impl)
+	s.w.LogStepInfo(s.name, st, "WARNING: step has been running for %d%% of its timeout of %s", pct, s.timeout)
+
+	for _, is := range s.instanceSignals() {
+		var ports []int64
+		seen := map[int64]bool{}
+		for _, so := range is.serialOutputs() {
+			if so != nil && !seen[so.Port] {
+				seen[so.Port] = true
+				ports = append(ports, so.Port)
+			}
+		}
+		if len(ports) == 0 {
+			ports = []int64{1}
+		}
+		for _, port := range ports {
+			tail, err := serialTail(s.w, is.Name, port, timeoutWarningTailLines)
+			if err != nil {
+				s.w.LogStepInfo(s.name, st, "WARNING: could not read serial port %d output of instance %q: %v", port, is.Name, err)
+				continue
+			}
+			s.w.LogStepInfo(s.name, st, "Instance %q serial port %d output tail:\n%s", is.Name, port, tail)
+		}
+	}
+}
+
 func (s *Step) validate(ctx context.Context) DError {
 	s.w.LogWorkflowInfo("Validating step %q", s.name)
 	if !rfc1035Rgx.MatchString(strings.ToLower(s.name)) {
-		return s.wrapValidateError(Errf("step name must start with a letter and only contain letters, numbers, and hyphens"))
+		err := Errf("step name must start with a letter and only contain letters, numbers, and hyphens")
+		s.w.reportValidationError(s, s.jsonPath(), err)
+		return s.wrapValidateError(err)
 	}
 	impl, err := s.stepImpl()
 	if err != nil {
+		s.w.reportValidationError(s, s.jsonPath(), err)
 		return s.wrapValidateError(err)
 	}
 	if err = impl.validate(ctx, s); err != nil {
+		if !s.nestsWorkflow() {
+			s.w.reportValidationError(s, s.jsonPath()+"."+stepTypeName(impl), err)
+		}
 		return s.wrapValidateError(err)
 	}
 	return nil
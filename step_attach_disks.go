@@ -41,7 +41,7 @@ func (a *AttachDisks) populate(ctx context.Context, s *Step) DError {
 			ad.DeviceName = path.Base(ad.Source)
 		}
 		if diskURLRgx.MatchString(ad.Source) {
-			ad.Source = extendPartialURL(ad.Source, s.w.Project)
+			ad.Source = extendPartialURL(ad.Source, s.project())
 		}
 	}
 
@@ -110,7 +110,7 @@ func (a *AttachDisks) run(ctx context.Context, s *Step) DError {
 			}
 
 			w.LogStepInfo(s.name, "AttachDisks", "Attaching disk %q to instance %q.", ad.AttachedDisk.Source, inst)
-			if err := w.ComputeClient.AttachDisk(ad.project, ad.zone, ad.Instance, &ad.AttachedDisk); err != nil {
+			if err := s.computeClient().AttachDisk(ad.project, ad.zone, ad.Instance, &ad.AttachedDisk); err != nil {
 				e <- newErr("failed to attach disk", err)
 				return
 			}
@@ -0,0 +1,82 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// CloneInstance is a Daisy CloneInstance workflow step. It creates a machine
+// image of SourceInstance and creates Instance from it, so the copy has the
+// disks and properties of the source. The machine image is deleted once the
+// copy is created, unless KeepMachineImage is set.
+type CloneInstance struct {
+	// Instance to clone, the name of an instance created in the workflow or a
+	// partial URL.
+	SourceInstance string
+	// Instance to create. Name defaults to the step name, Project and Zone
+	// to the workflow's, so the copy can be created in another zone or
+	// project. Other fields set override the properties of the source,
+	// Disks must not be set.
+	Instance Instance
+	// Name of the machine image, defaults to "<step name>-image".
+	MachineImage string `json:",omitempty"`
+	// Keep the machine image, e.g. for later steps to create more copies.
+	KeepMachineImage bool `json:",omitempty"`
+
+	include *IncludeWorkflow
+}
+
+func (c *CloneInstance) populate(ctx context.Context, s *Step) DError {
+	if c.SourceInstance == "" {
+		return Errf("CloneInstance: no SourceInstance given")
+	}
+	if len(c.Instance.Disks) > 0 {
+		return Errf("CloneInstance: Instance.Disks must not be set, the disks are those of the source")
+	}
+	name := strings.ToLower(s.name)
+	c.Instance.Name = strOr(c.Instance.Name, name)
+	c.MachineImage = strOr(c.MachineImage, name+"-image")
+	c.Instance.SourceMachineImage = c.MachineImage
+
+	iw := New()
+	image, _ := iw.NewStep("create-machine-image")
+	image.CreateMachineImages = &CreateMachineImages{{
+		MachineImage: compute.MachineImage{Name: c.MachineImage, SourceInstance: c.SourceInstance},
+	}}
+	create, _ := iw.NewStep("create-instance")
+	create.CreateInstances = &CreateInstances{Instances: []*Instance{&c.Instance}}
+	iw.AddDependency(create, image)
+	if !c.KeepMachineImage {
+		del, _ := iw.NewStep("delete-machine-image")
+		del.DeleteResources = &DeleteResources{MachineImages: []string{c.MachineImage}}
+		iw.AddDependency(del, create)
+	}
+
+	c.include = &IncludeWorkflow{Workflow: iw}
+	return c.include.populate(ctx, s)
+}
+
+func (c *CloneInstance) validate(ctx context.Context, s *Step) DError {
+	return c.include.validate(ctx, s)
+}
+
+func (c *CloneInstance) run(ctx context.Context, s *Step) DError {
+	s.w.LogStepInfo(s.name, "CloneInstance", "Cloning instance %q to %q.", c.SourceInstance, c.Instance.Name)
+	return c.include.run(ctx, s)
+}
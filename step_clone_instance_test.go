@@ -0,0 +1,71 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestCloneInstancePopulate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc, wantImage string
+		ci              *CloneInstance
+		wantSteps       int
+		shouldErr       bool
+	}{
+		{"defaults case", "clone-image", &CloneInstance{SourceInstance: "vm"}, 3, false},
+		{"keep machine image case", "mi", &CloneInstance{SourceInstance: "vm", MachineImage: "mi", KeepMachineImage: true}, 2, false},
+		{"other zone case", "clone-image", &CloneInstance{SourceInstance: "vm", Instance: Instance{Instance: compute.Instance{Name: "copy", Zone: "us-east1-b"}}}, 3, false},
+		{"no source case", "", &CloneInstance{}, 0, true},
+		{"disks case", "", &CloneInstance{SourceInstance: "vm", Instance: Instance{Instance: compute.Instance{Disks: []*compute.AttachedDisk{{Source: "d"}}}}}, 0, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("clone")
+		s.CloneInstance = tt.ci
+		err := w.populateStep(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		iw := tt.ci.include.Workflow
+		if len(iw.Steps) != tt.wantSteps {
+			t.Errorf("%s: unexpected number of steps: %d", tt.desc, len(iw.Steps))
+		}
+		mi := (*iw.Steps["create-machine-image"].CreateMachineImages)[0]
+		if mi.daisyName != tt.wantImage || mi.SourceInstance != "vm" {
+			t.Errorf("%s: unexpected machine image: %+v", tt.desc, mi)
+		}
+		i := iw.Steps["create-instance"].CreateInstances.Instances[0]
+		if i != &tt.ci.Instance || i.SourceMachineImage != tt.wantImage {
+			t.Errorf("%s: Instance not created from the machine image: %+v", tt.desc, i)
+		}
+		if tt.ci.Instance.Zone == "" {
+			t.Errorf("%s: Instance zone not populated", tt.desc)
+		}
+		if got := nestedWorkflow(s); got != iw {
+			t.Errorf("%s: nestedWorkflow should return the clone workflow", tt.desc)
+		}
+	}
+}
@@ -66,11 +66,11 @@ func (c *CreateDisks) run(ctx context.Context, s *Step) DError {
 			}
 
 			w.LogStepInfo(s.name, "CreateDisks", "Creating disk %q.", cd.Name)
-			if err := w.ComputeClient.CreateDisk(cd.Project, cd.Zone, &cd.Disk); err != nil {
+			if err := s.computeClient().CreateDisk(cd.Project, cd.Zone, &cd.Disk); err != nil {
 				e <- newErr("failed to create disk", err)
 				return
 			}
-			cd.createdInWorkflow = true
+			cd.markCreated()
 		}(d)
 	}
 
@@ -16,6 +16,7 @@ package daisy
 
 import (
 	"context"
+	"fmt"
 	"sync"
 )
 
@@ -32,8 +33,11 @@ func (c *CreateFirewallRules) populate(ctx context.Context, s *Step) DError {
 
 func (c *CreateFirewallRules) validate(ctx context.Context, s *Step) DError {
 	var errs DError
-	for _, fir := range *c {
+	for i, fir := range *c {
 		errs = addErrs(errs, fir.validate(ctx, s))
+		if fir.allowsAnyIngress() {
+			s.warnf(fmt.Sprintf("CreateFirewallRules[%d].SourceRanges", i), "firewall rule %q allows all ports from any source", fir.daisyName)
+		}
 	}
 	return errs
 }
@@ -47,16 +51,25 @@ func (c *CreateFirewallRules) run(ctx context.Context, s *Step) DError {
 		go func(fir *FirewallRule) {
 			defer wg.Done()
 
+			reclaimMode := w.networkReclaimMode(fir.Network)
 			if networkRes, ok := w.networks.get(fir.Network); ok {
 				fir.Network = networkRes.link
 			}
 
 			w.LogStepInfo(s.name, "CreateFirewallRules", "Creating firewall rule %q.", fir.Name)
-			if err := w.ComputeClient.CreateFirewallRule(fir.Project, &fir.Firewall); err != nil {
+			err := s.computeClient().CreateFirewallRule(fir.Project, &fir.Firewall)
+			if isAlreadyExists(err) {
+				if reclaimMode == reclaimAdopt {
+					err = fir.adopt(s)
+				} else {
+					err = fir.adoptOwn(s)
+				}
+			}
+			if err != nil {
 				e <- newErr("failed to create firewall", err)
 				return
 			}
-			fir.createdInWorkflow = true
+			fir.markCreated()
 		}(fir)
 	}
 
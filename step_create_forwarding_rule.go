@@ -48,11 +48,11 @@ func (c *CreateForwardingRules) run(ctx context.Context, s *Step) DError {
 			defer wg.Done()
 
 			w.LogStepInfo(s.name, "CreateForwardingRules", "Creating forwarding-rule %q.", fr.Name)
-			if err := w.ComputeClient.CreateForwardingRule(fr.Project, fr.Region, &fr.ForwardingRule); err != nil {
+			if err := s.computeClient().CreateForwardingRule(fr.Project, fr.Region, &fr.ForwardingRule); err != nil {
 				e <- newErr("failed to create forwarding rules", err)
 				return
 			}
-			fr.createdInWorkflow = true
+			fr.markCreated()
 		}(fr)
 	}
 
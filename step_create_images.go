@@ -52,6 +52,19 @@ func (ci *CreateImages) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalJSON marshals CreateImages as the list UnmarshalJSON reads.
+func (ci *CreateImages) MarshalJSON() ([]byte, error) {
+	switch {
+	case ci.Images != nil:
+		return json.Marshal(ci.Images)
+	case ci.ImagesBeta != nil:
+		return json.Marshal(ci.ImagesBeta)
+	case ci.ImagesAlpha != nil:
+		return json.Marshal(ci.ImagesAlpha)
+	}
+	return json.Marshal(ci.Images)
+}
+
 func imageUsesAlphaFeatures(imagesAlpha []*ImageAlpha) bool {
 	for _, imageAlpha := range imagesAlpha {
 		if imageAlpha != nil && imageAlpha.RolloutOverride != nil && len(imageAlpha.RolloutOverride.DefaultRolloutTime) > 0 {
@@ -125,7 +138,7 @@ func (ci *CreateImages) run(ctx context.Context, s *Step) DError {
 		// Delete existing if OverWrite is true.
 		if overwrite {
 			// Just try to delete it, a 404 here indicates the image doesn't exist.
-			if err := ci.delete(w.ComputeClient); err != nil {
+			if err := ci.delete(s.computeClient()); err != nil {
 				if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != 404 {
 					e <- Errf("error deleting existing image: %v", err)
 					return
@@ -134,7 +147,7 @@ func (ci *CreateImages) run(ctx context.Context, s *Step) DError {
 		}
 
 		w.LogStepInfo(s.name, "CreateImages", "Creating image %q.", ci.getName())
-		if err := ci.create(w.ComputeClient); err != nil {
+		if err := ci.create(s.computeClient()); err != nil {
 			e <- newErr("failed to create images", err)
 			return
 		}
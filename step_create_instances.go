@@ -51,6 +51,14 @@ func (ci *CreateInstances) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// MarshalJSON marshals CreateInstances as the list UnmarshalJSON reads.
+func (ci *CreateInstances) MarshalJSON() ([]byte, error) {
+	if ci.Instances == nil && ci.InstancesBeta != nil {
+		return json.Marshal(ci.InstancesBeta)
+	}
+	return json.Marshal(ci.Instances)
+}
+
 func logSerialOutput(ctx context.Context, s *Step, ii InstanceInterface, ib *InstanceBase, port int64, interval time.Duration) {
 	w := s.w
 	w.stepWait.Add(1)
@@ -60,10 +68,25 @@ func logSerialOutput(ctx context.Context, s *Step, ii InstanceInterface, ib *Ins
 	w.LogStepInfo(s.name, "CreateInstances", "Streaming instance %q serial port %d output to https://storage.cloud.google.com/%s/%s", ii.getName(), port, w.bucket, logsObj)
 	var start int64
 	var buf bytes.Buffer
+	// held is the output held back from redaction, see redactStream.
+	var held string
 	var gcsErr bool
 	var readFromSerial bool
 	var numErr int
 	tick := time.Tick(interval)
+	// save appends contents to the log, and saves it to GCS.
+	save := func(contents string) bool {
+		buf.WriteString(contents)
+		w.Logger.AppendSerialPortLogs(w, ii.getName(), contents)
+		if err := w.storage().Put(ctx, w.bucket, logsObj, "text/plain", bytes.NewReader(buf.Bytes())); err != nil {
+			if !gcsErr {
+				gcsErr = true
+				w.LogStepInfo(s.name, "CreateInstances", "Instance %q: error saving log to GCS: %v", ii.getName(), err)
+			}
+			return false
+		}
+		return true
+	}
 
 Loop:
 	for {
@@ -95,28 +118,23 @@ Loop:
 			readFromSerial = true
 			numErr = 0
 			start = resp.Next
-			buf.WriteString(resp.Contents)
-			w.Logger.AppendSerialPortLogs(w, ii.getName(), resp.Contents)
-			wc := w.StorageClient.Bucket(w.bucket).Object(logsObj).NewWriter(ctx)
-			wc.ContentType = "text/plain"
-			if _, err := wc.Write(buf.Bytes()); err != nil && !gcsErr {
-				gcsErr = true
-				w.LogStepInfo(s.name, "CreateInstances", "Instance %q: error writing log to GCS: %v", ii.getName(), err)
-				continue
-			} else if err != nil { // dont try to close the writer
-				continue
-			}
-			if err := wc.Close(); err != nil && !gcsErr {
-				gcsErr = true
-				w.LogStepInfo(s.name, "CreateInstances", "Instance %q: error saving log to GCS: %v", ii.getName(), err)
+			var contents string
+			contents, held = w.redactStream(held, resp.Contents, false)
+			if !save(contents) {
 				continue
 			}
 
-			if w.isCanceled {
+			select {
+			case <-w.Cancel:
 				break Loop
+			default:
 			}
 		}
 	}
+	if held != "" {
+		contents, _ := w.redactStream(held, "", true)
+		save(contents)
+	}
 
 	w.Logger.WriteSerialPortLogsToCloudLogging(w, ii.getName())
 }
@@ -162,7 +180,7 @@ func (ci *CreateInstances) run(ctx context.Context, s *Step) DError {
 	createInstance := func(ii InstanceInterface, ib *InstanceBase) {
 		// Just try to delete it, a 404 here indicates the instance doesn't exist.
 		if ib.OverWrite {
-			if err := ii.delete(w.ComputeClient, true); err != nil {
+			if err := ii.delete(s.computeClient(), true); err != nil {
 				if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != 404 {
 					eChan <- Errf("error deleting existing instance: %v", err)
 					return
@@ -181,14 +199,14 @@ func (ci *CreateInstances) run(ctx context.Context, s *Step) DError {
 
 		w.LogStepInfo(s.name, "CreateInstances", "Creating instance %q.", ii.getName())
 
-		if err := ii.create(w.ComputeClient); err != nil {
+		if err := ii.create(s.computeClient()); err != nil {
 			// Fallback to no-external-ip mode to workaround organization policy.
 			if ib.RetryWhenExternalIPDenied && isExternalIPDeniedByOrganizationPolicy(err) {
 				w.LogStepInfo(s.name, "CreateInstances", "Falling back to no-external-ip mode "+
 					"for creating instance %v due to the fact that external IP is denied by organization policy.", ii.getName())
 
 				UpdateInstanceNoExternalIP(s)
-				err = ii.create(w.ComputeClient)
+				err = ii.create(s.computeClient())
 			}
 
 			if err != nil {
@@ -197,9 +215,13 @@ func (ci *CreateInstances) run(ctx context.Context, s *Step) DError {
 			}
 		}
 
-		ib.createdInWorkflow = true
+		ib.markCreated()
+		interval := 3 * time.Second
+		if d := s.w.pollingIntervals().serialOutput; d > 0 {
+			interval = d
+		}
 		for _, port := range ib.SerialPortsToLog {
-			go logSerialOutput(ctx, s, ii, ib, port, 3*time.Second)
+			go logSerialOutput(ctx, s, ii, ib, port, interval)
 		}
 	}
 
@@ -16,6 +16,7 @@ package daisy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
@@ -207,3 +208,18 @@ func TestCreateInstancesRun(t *testing.T) {
 		t.Errorf("CreateInstances.run() should have return compute client error: %v != %v", err, createErr)
 	}
 }
+
+func TestCreateInstancesMarshalJSON(t *testing.T) {
+	ci := &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{Name: "i1"}}}}
+	b, err := json.Marshal(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got CreateInstances
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("error unmarshaling %s: %v", b, err)
+	}
+	if len(got.Instances) != 1 || got.Instances[0].Name != "i1" || len(got.InstancesBeta) != 1 || got.InstancesBeta[0].Name != "i1" {
+		t.Errorf("CreateInstances did not round trip through %s", b)
+	}
+}
@@ -60,7 +60,7 @@ func (c *CreateMachineImages) run(ctx context.Context, s *Step) DError {
 			// Delete existing machine image if OverWrite is true.
 			if mi.OverWrite {
 				// Just try to delete it, a 404 here indicates the machine image doesn't exist.
-				if err := w.ComputeClient.DeleteMachineImage(mi.Project, mi.Name); err != nil {
+				if err := s.computeClient().DeleteMachineImage(mi.Project, mi.Name); err != nil {
 					if apiErr, ok := err.(*googleapi.Error); !ok || apiErr.Code != 404 {
 						eChan <- Errf("error deleting existing machine image: %v", err)
 						return
@@ -70,11 +70,11 @@ func (c *CreateMachineImages) run(ctx context.Context, s *Step) DError {
 
 			w.LogStepInfo(s.name, "CreateMachineImages", "Creating machine image %q.", mi.Name)
 
-			if err := w.ComputeClient.CreateMachineImage(mi.Project, &mi.MachineImage); err != nil {
+			if err := s.computeClient().CreateMachineImage(mi.Project, &mi.MachineImage); err != nil {
 				eChan <- newErr("failed to create machine image", err)
 				return
 			}
-			mi.createdInWorkflow = true
+			mi.markCreated()
 		}(ci)
 	}
 
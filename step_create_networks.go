@@ -47,12 +47,28 @@ func (c *CreateNetworks) run(ctx context.Context, s *Step) DError {
 		go func(n *Network) {
 			defer wg.Done()
 
+			if n.ReclaimStale != "" {
+				adopted, err := n.reclaim(s)
+				if err != nil {
+					e <- err
+					return
+				}
+				if adopted {
+					n.markCreated()
+					return
+				}
+			}
+
 			w.LogStepInfo(s.name, "CreateNetworks", "Creating network %q.", n.Name)
-			if err := w.ComputeClient.CreateNetwork(n.Project, &n.Network); err != nil {
+			err := s.computeClient().CreateNetwork(n.Project, &n.Network)
+			if isAlreadyExists(err) {
+				err = n.adoptOwn(s)
+			}
+			if err != nil {
 				e <- newErr("failed to create networks", err)
 				return
 			}
-			n.createdInWorkflow = true
+			n.markCreated()
 		}(n)
 	}
 
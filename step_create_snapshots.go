@@ -59,11 +59,11 @@ func (c *CreateSnapshots) run(ctx context.Context, s *Step) DError {
 
 		m := NamedSubexp(diskURLRgx, ss.SourceDisk)
 		w.LogStepInfo(s.name, "CreateSnapshots", "Creating snapshot %q.", ss.Name)
-		if err := w.ComputeClient.CreateSnapshot(m["project"], m["zone"], m["disk"], &ss.Snapshot); err != nil {
+		if err := s.computeClient().CreateSnapshot(m["project"], m["zone"], m["disk"], &ss.Snapshot); err != nil {
 			e <- newErr("failed to create snapshots", err)
 			return
 		}
-		ss.createdInWorkflow = true
+		ss.markCreated()
 	}
 
 	for _, ss := range *c {
@@ -47,16 +47,21 @@ func (c *CreateSubnetworks) run(ctx context.Context, s *Step) DError {
 		go func(sn *Subnetwork) {
 			defer wg.Done()
 
+			reclaimMode := w.networkReclaimMode(sn.Network)
 			if networkRes, ok := w.networks.get(sn.Network); ok {
 				sn.Network = networkRes.link
 			}
 
 			w.LogStepInfo(s.name, "CreateSubnetworks", "Creating subnetwork %q.", sn.Name)
-			if err := w.ComputeClient.CreateSubnetwork(sn.Project, sn.Region, &sn.Subnetwork); err != nil {
+			err := s.computeClient().CreateSubnetwork(sn.Project, sn.Region, &sn.Subnetwork)
+			if isAlreadyExists(err) && reclaimMode == reclaimAdopt {
+				err = sn.adopt(s)
+			}
+			if err != nil {
 				e <- newErr("failed to create subnetworks", err)
 				return
 			}
-			sn.createdInWorkflow = true
+			sn.markCreated()
 		}(sn)
 	}
 
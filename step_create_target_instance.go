@@ -48,11 +48,11 @@ func (c *CreateTargetInstances) run(ctx context.Context, s *Step) DError {
 			defer wg.Done()
 
 			w.LogStepInfo(s.name, "CreateTargetInstances", "Creating target instance %q.", ti.Name)
-			if err := w.ComputeClient.CreateTargetInstance(ti.Project, ti.Zone, &ti.TargetInstance); err != nil {
+			if err := s.computeClient().CreateTargetInstance(ti.Project, ti.Zone, &ti.TargetInstance); err != nil {
 				e <- newErr("failed to create target instances", err)
 				return
 			}
-			ti.createdInWorkflow = true
+			ti.markCreated()
 		}(ti)
 	}
 
@@ -31,6 +31,7 @@ type DeleteResources struct {
 	Disks         []string `json:",omitempty"`
 	Images        []string `json:",omitempty"`
 	MachineImages []string `json:",omitempty"`
+	Snapshots     []string `json:",omitempty"`
 	Instances     []string `json:",omitempty"`
 	Networks      []string `json:",omitempty"`
 	Subnetworks   []string `json:",omitempty"`
@@ -41,37 +42,42 @@ type DeleteResources struct {
 func (d *DeleteResources) populate(ctx context.Context, s *Step) DError {
 	for i, disk := range d.Disks {
 		if diskURLRgx.MatchString(disk) {
-			d.Disks[i] = extendPartialURL(disk, s.w.Project)
+			d.Disks[i] = extendPartialURL(disk, s.project())
 		}
 	}
 	for i, image := range d.Images {
 		if imageURLRgx.MatchString(image) {
-			d.Images[i] = extendPartialURL(image, s.w.Project)
+			d.Images[i] = extendPartialURL(image, s.project())
 		}
 	}
 	for i, machineImage := range d.MachineImages {
 		if machineImageURLRgx.MatchString(machineImage) {
-			d.MachineImages[i] = extendPartialURL(machineImage, s.w.Project)
+			d.MachineImages[i] = extendPartialURL(machineImage, s.project())
+		}
+	}
+	for i, snapshot := range d.Snapshots {
+		if snapshotURLRgx.MatchString(snapshot) {
+			d.Snapshots[i] = extendPartialURL(snapshot, s.project())
 		}
 	}
 	for i, instance := range d.Instances {
 		if instanceURLRgx.MatchString(instance) {
-			d.Instances[i] = extendPartialURL(instance, s.w.Project)
+			d.Instances[i] = extendPartialURL(instance, s.project())
 		}
 	}
 	for i, network := range d.Networks {
 		if networkURLRegex.MatchString(network) {
-			d.Networks[i] = extendPartialURL(network, s.w.Project)
+			d.Networks[i] = extendPartialURL(network, s.project())
 		}
 	}
 	for i, subnetwork := range d.Subnetworks {
 		if subnetworkURLRegex.MatchString(subnetwork) {
-			d.Subnetworks[i] = extendPartialURL(subnetwork, s.w.Project)
+			d.Subnetworks[i] = extendPartialURL(subnetwork, s.project())
 		}
 	}
 	for i, firewall := range d.Firewalls {
 		if firewallRuleURLRegex.MatchString(firewall) {
-			d.Firewalls[i] = extendPartialURL(firewall, s.w.Project)
+			d.Firewalls[i] = extendPartialURL(firewall, s.project())
 		}
 	}
 	return nil
@@ -171,6 +177,20 @@ func (d *DeleteResources) validate(ctx context.Context, s *Step) DError {
 		}
 	}
 
+	// Snapshot checking.
+	for _, ss := range d.Snapshots {
+		if err := s.w.snapshots.regDelete(ss, s); d.checkError(err, s) != nil {
+			return err
+		}
+	}
+
+	// Firewall checking.
+	for _, f := range d.Firewalls {
+		if err := s.w.firewallRules.regDelete(f, s); d.checkError(err, s) != nil {
+			return err
+		}
+	}
+
 	// Network checking.
 	for _, n := range d.Networks {
 		if err := s.w.networks.regDelete(n, s); d.checkError(err, s) != nil {
@@ -303,6 +323,21 @@ func (d *DeleteResources) run(ctx context.Context, s *Step) DError {
 		}(i)
 	}
 
+	for _, ss := range d.Snapshots {
+		wg.Add(1)
+		go func(ss string) {
+			defer wg.Done()
+			w.LogStepInfo(s.name, "DeleteResources", "Deleting snapshot %q.", ss)
+			if err := w.snapshots.delete(ss); err != nil {
+				if err.etype() == resourceDNEError {
+					w.LogStepInfo(s.name, "DeleteResources", "WARNING: Error deleting snapshot %q: %v", ss, err)
+					return
+				}
+				e <- err
+			}
+		}(ss)
+	}
+
 	for _, p := range d.GCSPaths {
 		wg.Add(1)
 		go func(p string) {
@@ -360,6 +395,7 @@ func (d *DeleteResources) run(ctx context.Context, s *Step) DError {
 			if err := w.firewallRules.delete(n); err != nil {
 				if err.etype() == resourceDNEError {
 					w.LogStepInfo(s.name, "DeleteResources", "WARNING: Error deleting firewall %q: %v", n, err)
+					return
 				}
 				e <- err
 			}
@@ -375,6 +411,7 @@ func (d *DeleteResources) run(ctx context.Context, s *Step) DError {
 			if err := w.subnetworks.delete(sn); err != nil {
 				if err.etype() == resourceDNEError {
 					w.LogStepInfo(s.name, "DeleteResources", "WARNING: Error deleting subnetwork %q: %v", sn, err)
+					return
 				}
 				e <- err
 			}
@@ -394,6 +431,7 @@ func (d *DeleteResources) run(ctx context.Context, s *Step) DError {
 			if err := w.networks.delete(n); err != nil {
 				if err.etype() == resourceDNEError {
 					w.LogStepInfo(s.name, "DeleteResources", "WARNING: Error deleting network %q: %v", n, err)
+					return
 				}
 				e <- err
 			}
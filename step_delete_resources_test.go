@@ -32,6 +32,7 @@ func TestDeleteResourcesPopulate(t *testing.T) {
 		Disks:         []string{"d", "zones/z/disks/d"},
 		Images:        []string{"i", "global/images/i"},
 		MachineImages: []string{"i", "global/machineImages/i"},
+		Snapshots:     []string{"ss", "global/snapshots/ss"},
 		Instances:     []string{"i", "zones/z/instances/i"},
 		Networks:      []string{"n", "global/networks/n"},
 		Firewalls:     []string{"n", "global/firewalls/n"},
@@ -45,6 +46,7 @@ func TestDeleteResourcesPopulate(t *testing.T) {
 		Disks:         []string{"d", fmt.Sprintf("projects/%s/zones/z/disks/d", w.Project)},
 		Images:        []string{"i", fmt.Sprintf("projects/%s/global/images/i", w.Project)},
 		MachineImages: []string{"i", fmt.Sprintf("projects/%s/global/machineImages/i", w.Project)},
+		Snapshots:     []string{"ss", fmt.Sprintf("projects/%s/global/snapshots/ss", w.Project)},
 		Instances:     []string{"i", fmt.Sprintf("projects/%s/zones/z/instances/i", w.Project)},
 		Networks:      []string{"n", fmt.Sprintf("projects/%s/global/networks/n", w.Project)},
 		Firewalls:     []string{"n", fmt.Sprintf("projects/%s/global/firewalls/n", w.Project)},
@@ -65,17 +67,20 @@ func TestDeleteResourcesRun(t *testing.T) {
 	ds := []*Resource{{RealName: "d0", link: "link"}, {RealName: "d1", link: "link"}}
 	ns := []*Resource{{RealName: "n0", link: "link"}, {RealName: "n1", link: "link"}}
 	fs := []*Resource{{RealName: "f0", link: "link"}, {RealName: "f1", link: "link"}}
+	sss := []*Resource{{RealName: "ss0", link: "link"}, {RealName: "ss1", link: "link"}}
 	w.instances.m = map[string]*Resource{"in0": ins[0], "in1": ins[1], "in2": ins[2]}
 	w.images.m = map[string]*Resource{"im0": ims[0], "im1": ims[1]}
 	w.machineImages.m = map[string]*Resource{"mi0": mis[0], "mi1": mis[1]}
 	w.disks.m = map[string]*Resource{"d0": ds[0], "d1": ds[1]}
 	w.networks.m = map[string]*Resource{"n0": ns[0], "n1": ns[1]}
 	w.firewallRules.m = map[string]*Resource{"f0": fs[0], "f1": fs[1]}
+	w.snapshots.m = map[string]*Resource{"ss0": sss[0], "ss1": sss[1]}
 
 	dr := &DeleteResources{
 		Instances:     []string{"in0"},
 		Images:        []string{"im0"},
 		MachineImages: []string{"mi0"},
+		Snapshots:     []string{"ss0"},
 		Disks:         []string{"d0"},
 		Networks:      []string{"n0"},
 		GCSPaths:      []string{"gs://foo/bar"},
@@ -102,6 +107,8 @@ func TestDeleteResourcesRun(t *testing.T) {
 		{ns[1], false},
 		{fs[0], true},
 		{fs[1], false},
+		{sss[0], true},
+		{sss[1], false},
 	}
 	for _, c := range deletedChecks {
 		if c.shouldBeDeleted {
@@ -162,8 +169,9 @@ func TestDeleteResourcesValidate(t *testing.T) {
 	inC, _ := w.NewStep("inCreator")
 	nC, _ := w.NewStep("nCreator")
 	fC, _ := w.NewStep("fCreator")
+	ssC, _ := w.NewStep("ssCreator")
 	s, _ := w.NewStep("s")
-	w.AddDependency(s, dC, imC, miC, inC, nC, fC)
+	w.AddDependency(s, dC, imC, miC, inC, nC, fC, ssC)
 	otherDeleter, _ := w.NewStep("otherDeleter")
 	ds := []*Resource{{RealName: "d0", link: "link", creator: dC}, {RealName: "d1", link: "link", creator: dC}, {RealName: "d2", link: "link", creator: dC}}
 	ims := []*Resource{{RealName: "im0", link: "link", creator: imC}, {RealName: "im1", link: "link", creator: imC}}
@@ -171,12 +179,14 @@ func TestDeleteResourcesValidate(t *testing.T) {
 	ins := []*Resource{{RealName: "in0", link: "link", creator: inC}, {RealName: "in1", link: "link", creator: inC}}
 	ns := []*Resource{{RealName: "n0", link: "link", creator: nC}, {RealName: "n1", link: "link", creator: nC}, {RealName: "n2", link: "link", creator: nC}}
 	fs := []*Resource{{RealName: "f0", link: "link", creator: fC}, {RealName: "f1", link: "link", creator: fC}, {RealName: "f2", link: "link", creator: fC}}
+	sss := []*Resource{{RealName: "ss0", link: "link", creator: ssC}, {RealName: "ss1", link: "link", creator: ssC}}
 	w.instances.m = map[string]*Resource{"in0": ins[0], "in1": ins[1]}
 	w.images.m = map[string]*Resource{"im0": ims[0], "im1": ims[1]}
 	w.machineImages.m = map[string]*Resource{"mi0": mis[0], "mi1": mis[1]}
 	w.disks.m = map[string]*Resource{"d0": ds[0], "d1": ds[1]}
 	w.networks.m = map[string]*Resource{"n0": ns[0], "n1": ns[1]}
 	w.firewallRules.m = map[string]*Resource{"f0": fs[0], "f1": fs[1]}
+	w.snapshots.m = map[string]*Resource{"ss0": sss[0], "ss1": sss[1]}
 	ads := []*compute.AttachedDisk{{Source: "d1"}}
 	inC.CreateInstances = &CreateInstances{
 		Instances: []*Instance{
@@ -206,6 +216,7 @@ func TestDeleteResourcesValidate(t *testing.T) {
 		Disks:         []string{"d0"},
 		Images:        []string{"im0", "projects/foo/global/images/" + testImage, "projects/foo/global/images/family/foo"},
 		MachineImages: []string{"mi0", "projects/test-project/global/machineImages/" + testMachineImage},
+		Snapshots:     []string{"ss0"},
 		Instances:     []string{"in0"},
 		Networks:      []string{"n0"},
 		GCSPaths:      []string{"gs://foo/bar"},
@@ -224,6 +235,11 @@ func TestDeleteResourcesValidate(t *testing.T) {
 	want[8].deleter = s
 
 	CompareResources(got, want)
+	for _, r := range []*Resource{sss[0], fs[0]} {
+		if r.deleter != s {
+			t.Errorf("%q wasn't registered for deletion", r.RealName)
+		}
+	}
 	// Bad cases. Test:
 	// - deleting an already deleted disk/image/instance/machine image (d1 is already deleted from other tests)
 	// - deleting a disk that DNE
@@ -239,6 +255,14 @@ func TestDeleteResourcesValidate(t *testing.T) {
 	if err := (&DeleteResources{MachineImages: []string{"mi1"}}).validate(ctx, s); err == nil {
 		t.Error("DeleteResources should have returned an error when deleting an already deleted machine image")
 	}
+	sss[1].deleter = otherDeleter
+	if err := (&DeleteResources{Snapshots: []string{"ss1"}}).validate(ctx, s); err == nil {
+		t.Error("DeleteResources should have returned an error when deleting an already deleted snapshot")
+	}
+	fs[1].deleter = otherDeleter
+	if err := (&DeleteResources{Firewalls: []string{"f1"}}).validate(ctx, s); err == nil {
+		t.Error("DeleteResources should have returned an error when deleting an already deleted firewall")
+	}
 	if err := (&DeleteResources{Instances: []string{"in1"}}).validate(ctx, s); err == nil {
 		t.Error("DeleteResources should have returned an error when deleting an already deleted instance")
 	}
@@ -40,7 +40,7 @@ type DeprecateImage struct {
 
 func (d *DeprecateImages) populate(ctx context.Context, s *Step) DError {
 	for _, di := range *d {
-		di.Project = strOr(di.Project, s.w.Project)
+		di.Project = strOr(di.Project, s.project())
 	}
 	return nil
 }
@@ -86,10 +86,10 @@ func (d *DeprecateImages) run(ctx context.Context, s *Step) DError {
 			var err error
 			if di.DeprecationStatusAlpha.State != "" {
 				w.LogStepInfo(s.name, "DeprecateImages", "%q --> %q with DefaultRolloutTime %s.", di.Image, di.DeprecationStatusAlpha.State, di.DeprecationStatusAlpha.StateOverride.DefaultRolloutTime)
-				err = w.ComputeClient.DeprecateImageAlpha(di.Project, di.Image, &di.DeprecationStatusAlpha)
+				err = s.computeClient().DeprecateImageAlpha(di.Project, di.Image, &di.DeprecationStatusAlpha)
 			} else {
 				w.LogStepInfo(s.name, "DeprecateImages", "%q --> %q.", di.Image, di.DeprecationStatus.State)
-				err = w.ComputeClient.DeprecateImage(di.Project, di.Image, &di.DeprecationStatus)
+				err = s.computeClient().DeprecateImage(di.Project, di.Image, &di.DeprecationStatus)
 			}
 			if err != nil {
 				e <- newErr("failed to deprecate images", err)
@@ -101,7 +101,7 @@ func (a *DetachDisks) run(ctx context.Context, s *Step) DError {
 			}
 
 			w.LogStepInfo(s.name, "DetachDisks", "Detaching disk %q from instance %q.", dd.DeviceName, inst)
-			if err := w.ComputeClient.DetachDisk(dd.project, dd.zone, dd.Instance, dd.realName); err != nil {
+			if err := s.computeClient().DetachDisk(dd.project, dd.zone, dd.Instance, dd.realName); err != nil {
 				e <- newErr("failed to detach disks", err)
 				return
 			}
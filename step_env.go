@@ -0,0 +1,116 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+// StepEnv overrides the environment a step runs in. Unset fields are
+// inherited: a step inherits from its workflow, and the steps of the workflow
+// of an IncludeWorkflow or SubWorkflow step inherit from that step.
+type StepEnv struct {
+	// Project in which resources are created and looked up.
+	Project string `json:",omitempty"`
+	// Zone in which zonal resources are created and looked up.
+	Zone string `json:",omitempty"`
+	// Network of instance network interfaces that set neither a Network nor
+	// a Subnetwork, defaults to "global/networks/default". Network and
+	// Subnetwork are inherited together: setting either one overrides both.
+	Network string `json:",omitempty"`
+	// Subnetwork of instance network interfaces that set neither a Network
+	// nor a Subnetwork.
+	Subnetwork string `json:",omitempty"`
+	// ServiceAccount is the email of the service account of instances that
+	// set no ServiceAccounts, defaults to "default".
+	ServiceAccount string `json:",omitempty"`
+
+	// replaceDefaultNetwork makes instance network interfaces that name the
+	// default network use Network and Subnetwork instead.
+	replaceDefaultNetwork bool
+}
+
+// env returns the environment of s, with unset fields of s.Env inherited
+// from the workflow.
+func (s *Step) env() StepEnv {
+	env := s.w.env
+	env.Project = s.w.Project
+	env.Zone = s.w.Zone
+	return *s.Env.inherit(&env)
+}
+
+// inherit returns a copy of e with unset fields taken from parent. Either
+// may be nil.
+func (e *StepEnv) inherit(parent *StepEnv) *StepEnv {
+	switch {
+	case e == nil && parent == nil:
+		return nil
+	case e == nil:
+		env := *parent
+		return &env
+	case parent == nil:
+		env := *e
+		return &env
+	}
+	env := &StepEnv{
+		Project:        strOr(e.Project, parent.Project),
+		Zone:           strOr(e.Zone, parent.Zone),
+		ServiceAccount: strOr(e.ServiceAccount, parent.ServiceAccount),
+	}
+	// A subnetwork belongs to a network, mixing the Network of one level
+	// with the Subnetwork of another would name a subnetwork of another
+	// network.
+	net := parent
+	if e.Network != "" || e.Subnetwork != "" {
+		net = e
+	}
+	env.Network = net.Network
+	env.Subnetwork = net.Subnetwork
+	env.replaceDefaultNetwork = net.replaceDefaultNetwork
+	return env
+}
+
+// OverrideEnv makes the set fields of e override the environment of w: its
+// Project and Zone, and the defaults of its instances. Steps with their own
+// Env still override it. Tools apply their flags with it, e.g. -project and
+// -network.
+func (w *Workflow) OverrideEnv(e *StepEnv) {
+	env := w.env
+	env.Project = w.Project
+	env.Zone = w.Zone
+	env = *e.inherit(&env)
+	w.Project = env.Project
+	w.Zone = env.Zone
+	env.Project = ""
+	env.Zone = ""
+	w.env = env
+}
+
+// project returns the project s runs in.
+func (s *Step) project() string {
+	return s.env().Project
+}
+
+// zone returns the zone s runs in.
+func (s *Step) zone() string {
+	return s.env().Zone
+}
+
+// inheritEnv makes the environment of s the environment of the workflow iw
+// run by s.
+func (s *Step) inheritEnv(iw *Workflow) {
+	env := s.env()
+	iw.Project = env.Project
+	iw.Zone = env.Zone
+	env.Project = ""
+	env.Zone = ""
+	iw.env = env
+}
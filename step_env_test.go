@@ -0,0 +1,106 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestStepEnv(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	iw := New()
+	iw.Vars = map[string]Var{"sa": {}}
+	iw.Steps = map[string]*Step{
+		"inner": {
+			Env:             &StepEnv{ServiceAccount: "${sa}"},
+			CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{Name: "inner"}}}},
+		},
+		"inner-disk": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "d", SizeGb: 1}}}},
+	}
+	w.Steps = map[string]*Step{
+		"outer": {
+			Env:             &StepEnv{Zone: "other-zone"},
+			CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{Name: "outer"}}}},
+		},
+		"include": {
+			Env:             &StepEnv{Project: "other-project", Subnetwork: "my-subnet"},
+			IncludeWorkflow: &IncludeWorkflow{Workflow: iw, Vars: map[string]string{"sa": "sa@example.com"}},
+		},
+	}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	outer := w.Steps["outer"].CreateInstances.Instances[0]
+	if outer.Project != testProject || outer.Zone != "other-zone" {
+		t.Errorf("outer instance: got project %q zone %q, want %q %q", outer.Project, outer.Zone, testProject, "other-zone")
+	}
+	if n := outer.NetworkInterfaces[0]; n.Network != "projects/"+testProject+"/global/networks/default" || n.Subnetwork != "" {
+		t.Errorf("outer instance: unexpected network interface %+v", n)
+	}
+	if got := outer.ServiceAccounts[0].Email; got != "default" {
+		t.Errorf("outer instance: got service account %q, want %q", got, "default")
+	}
+
+	inner := iw.Steps["inner"].CreateInstances.Instances[0]
+	if inner.Project != "other-project" || inner.Zone != testZone {
+		t.Errorf("inner instance: got project %q zone %q, want %q %q", inner.Project, inner.Zone, "other-project", testZone)
+	}
+	if n := inner.NetworkInterfaces[0]; n.Network != "" || n.Subnetwork != "my-subnet" {
+		t.Errorf("inner instance: unexpected network interface %+v", n)
+	}
+	if got := inner.ServiceAccounts[0].Email; got != "sa@example.com" {
+		t.Errorf("inner instance: got service account %q, want %q", got, "sa@example.com")
+	}
+	if got := (*iw.Steps["inner-disk"].CreateDisks)[0].Project; got != "other-project" {
+		t.Errorf("inner disk: got project %q, want %q", got, "other-project")
+	}
+}
+
+func TestStepEnvInherit(t *testing.T) {
+	parent := &StepEnv{Project: "p", Network: "net", Subnetwork: "subnet", ServiceAccount: "sa", replaceDefaultNetwork: true}
+	tests := []struct {
+		desc    string
+		e, want *StepEnv
+	}{
+		{"nil", nil, parent},
+		{"empty", &StepEnv{}, parent},
+		{"zone", &StepEnv{Zone: "z"}, &StepEnv{Project: "p", Zone: "z", Network: "net", Subnetwork: "subnet", ServiceAccount: "sa", replaceDefaultNetwork: true}},
+		{"network only", &StepEnv{Network: "other"}, &StepEnv{Project: "p", Network: "other", ServiceAccount: "sa"}},
+		{"subnetwork only", &StepEnv{Subnetwork: "other"}, &StepEnv{Project: "p", Subnetwork: "other", ServiceAccount: "sa"}},
+	}
+	for _, tt := range tests {
+		if got := tt.e.inherit(parent); *got != *tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestOverrideEnv(t *testing.T) {
+	w := testWorkflow()
+	w.env = StepEnv{Network: "net", Subnetwork: "subnet", ServiceAccount: "sa"}
+	w.OverrideEnv(&StepEnv{Zone: "other-zone", Network: "other-net"})
+	if w.Project != testProject || w.Zone != "other-zone" {
+		t.Errorf("got project %q zone %q, want %q %q", w.Project, w.Zone, testProject, "other-zone")
+	}
+	want := StepEnv{Network: "other-net", ServiceAccount: "sa"}
+	if w.env != want {
+		t.Errorf("got env %+v, want %+v", w.env, want)
+	}
+}
@@ -0,0 +1,222 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	exportStatusMatch  = "DaisyExport:"
+	exportSuccessMatch = "DaisyExport: done"
+	exportFailureMatch = "DaisyExport: failed"
+	exportSourceDevice = "daisy-export-source"
+	exportBufferDevice = "daisy-export-buffer"
+
+	defaultExportWorkerImage       = "projects/debian-cloud/global/images/family/debian-11"
+	defaultExportWorkerMachineType = "n1-standard-4"
+)
+
+// exportImageFormats maps the formats an image can be exported to to the
+// qemu-img output format options producing them.
+var exportImageFormats = map[string]string{
+	"vmdk":  "vmdk -o subformat=streamOptimized",
+	"qcow2": "qcow2",
+	"vhdx":  "vhdx",
+	"vhd":   "vpc",
+	"vdi":   "vdi",
+}
+
+// exportImageScript converts the disk created from the exported image to a
+// file on the buffer disk and copies it to GCS. STEP, OUTFMT and DEST are
+// replaced by the step name, the qemu-img output format options and the
+// quoted destination. Avoid ${} expansions, they would be taken for unresolved
+// workflow vars.
+const exportImageScript = `#!/bin/bash
+exec >/dev/console 2>&1
+fail() {
+  echo "DaisyExport: failed: $1"
+  exit 1
+}
+src=/dev/disk/by-id/google-daisy-export-source
+buf=/dev/disk/by-id/google-daisy-export-buffer
+out=/daisy-export/image
+dest=DEST
+if ! command -v qemu-img >/dev/null; then
+  echo "DaisyExport: installing qemu-utils"
+  apt-get update -q && apt-get install -qy qemu-utils || fail "cannot install qemu-utils"
+fi
+mkfs.ext4 -qF $buf || fail "cannot format the buffer disk"
+mkdir -p /daisy-export && mount $buf /daisy-export || fail "cannot mount the buffer disk"
+echo "DaisyExport: converting the image"
+set -o pipefail
+qemu-img convert -O OUTFMT -p $src $out | tr '\r' '\n' | {
+  last=-10
+  while read -r line; do
+    pct=$(echo "$line" | sed -n 's/^ *(\([0-9]*\)\..*/\1/p')
+    if [ -n "$pct" ] && [ "$pct" -ge $((last + 10)) ]; then
+      last=$pct
+      echo "DaisyExport: converted $pct% $(stat -c %s $out 2>/dev/null || echo 0) bytes"
+    fi
+  done
+} || fail "qemu-img convert failed"
+size=$(stat -c %s $out)
+echo "DaisyExport: copying the image to $dest"
+gsutil -q cp $out "$dest" || fail "cannot copy the image to $dest"
+echo "DaisyExport: copied $size bytes"
+echo "DaisyExport: <serial-output key:'STEP-size-bytes' value:'$size'>"
+echo "DaisyExport: done"
+`
+
+// ExportImage is a Daisy ExportImage workflow step. It exports Image to a
+// file in GCS: a worker instance converts a disk created from the image with
+// qemu-img to a buffer disk and copies the result to DestinationURI. The size
+// of the file is recorded as the serial-output value "<step>-size-bytes". The
+// worker and its disks are deleted afterwards. The step emits ProgressExport
+// events as the worker converts and copies the image.
+type ExportImage struct {
+	// Image to export, the name of an image created in the workflow or a
+	// partial URL.
+	Image string
+	// GCS path of the exported file, e.g. gs://bucket/image.vmdk.
+	DestinationURI string
+	// Format of the file: "vmdk" (stream-optimized), "qcow2", "vhdx", "vhd"
+	// or "vdi". Defaults to the extension of DestinationURI.
+	Format string `json:",omitempty"`
+	// Image of the worker instance, defaults to the latest Debian 11 image.
+	WorkerImage string `json:",omitempty"`
+	// Machine type of the worker instance, defaults to n1-standard-4.
+	WorkerMachineType string `json:",omitempty"`
+
+	include *IncludeWorkflow
+	buffer  *Disk
+}
+
+func (e *ExportImage) populate(ctx context.Context, s *Step) DError {
+	if e.Image == "" {
+		return Errf("ExportImage: no Image given")
+	}
+	if _, _, err := splitGCSPath(e.DestinationURI); err != nil {
+		return Errf("ExportImage: bad DestinationURI %q: %v", e.DestinationURI, err)
+	}
+	e.Format = strOr(e.Format, strings.TrimPrefix(path.Ext(e.DestinationURI), "."))
+	outFmt, ok := exportImageFormats[e.Format]
+	if !ok {
+		var formats []string
+		for f := range exportImageFormats {
+			formats = append(formats, f)
+		}
+		sort.Strings(formats)
+		return Errf("ExportImage: unknown Format %q, must be one of %q", e.Format, formats)
+	}
+	e.WorkerImage = strOr(e.WorkerImage, defaultExportWorkerImage)
+	e.WorkerMachineType = strOr(e.WorkerMachineType, defaultExportWorkerMachineType)
+
+	name := strings.ToLower(s.name)
+	source, buffer := name+"-source", name+"-buffer"
+	iw := New()
+	disks, _ := iw.NewStep("create-disks")
+	// The buffer is sized to the image when the step runs.
+	e.buffer = &Disk{Disk: compute.Disk{Name: buffer}, SizeGb: "10"}
+	disks.CreateDisks = &CreateDisks{
+		{Disk: compute.Disk{Name: source, SourceImage: e.Image}},
+		e.buffer,
+	}
+	create, _ := iw.NewStep("create")
+	create.CreateInstances = &CreateInstances{Instances: []*Instance{{
+		Instance: compute.Instance{
+			Name:        name,
+			MachineType: e.WorkerMachineType,
+			Disks: []*compute.AttachedDisk{
+				{AutoDelete: true, InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: e.WorkerImage}},
+				{Source: source, Mode: "READ_ONLY", DeviceName: exportSourceDevice},
+				{Source: buffer, DeviceName: exportBufferDevice},
+			},
+		},
+		Metadata:     map[string]string{"startup-script": strings.NewReplacer("STEP", s.name, "OUTFMT", outFmt, "DEST", shellQuote(e.DestinationURI)).Replace(exportImageScript)},
+		InstanceBase: InstanceBase{Scopes: []string{"https://www.googleapis.com/auth/devstorage.read_write"}},
+	}}}
+	wait, _ := iw.NewStep("wait")
+	wait.WaitForInstancesSignal = &WaitForInstancesSignal{{
+		Name: name,
+		SerialOutput: &SerialOutput{
+			Port:         1,
+			SuccessMatch: exportSuccessMatch,
+			FailureMatch: FailureMatches{exportFailureMatch},
+			StatusMatch:  exportStatusMatch,
+			onStatus:     func(status string) { e.progress(s, status) },
+		},
+	}}
+	del, _ := iw.NewStep("delete")
+	del.DeleteResources = &DeleteResources{Instances: []string{name}, Disks: []string{source, buffer}}
+	iw.AddDependency(create, disks)
+	iw.AddDependency(wait, create)
+	iw.AddDependency(del, wait)
+
+	e.include = &IncludeWorkflow{Workflow: iw}
+	return e.include.populate(ctx, s)
+}
+
+// progress emits the ProgressExport event of a status of the worker,
+// "DaisyExport: converted <percent>% <bytes> bytes" as it converts the image,
+// then "DaisyExport: copied <bytes> bytes". Converting counts for 90% of the
+// export. Other statuses are ignored.
+func (e *ExportImage) progress(s *Step, status string) {
+	var pct, n int64
+	if _, err := fmt.Sscanf(status, exportStatusMatch+" converted %d%% %d bytes", &pct, &n); err == nil {
+		pct = pct * 9 / 10
+	} else if _, err := fmt.Sscanf(status, exportStatusMatch+" copied %d bytes", &n); err == nil {
+		pct = 100
+	} else {
+		return
+	}
+	s.w.emitProgress(s, ProgressEvent{Stage: ProgressExport, StepType: "ExportImage", Disk: e.Image, Percent: int(pct), Bytes: n, Message: status})
+}
+
+func (e *ExportImage) validate(ctx context.Context, s *Step) DError {
+	return e.include.validate(ctx, s)
+}
+
+// bufferSizeGb returns the size of a worker buffer disk holding a virtual disk
+// file of a disk of sizeGb, with room for the format overhead.
+func bufferSizeGb(sizeGb int64) int64 {
+	size := sizeGb + (sizeGb+9)/10
+	if size < 10 {
+		return 10
+	}
+	return size
+}
+
+func (e *ExportImage) run(ctx context.Context, s *Step) DError {
+	size, err := s.w.imageSizeGb(e.Image)
+	if err != nil {
+		return typedErr(apiError, "failed to get image", err)
+	}
+	est := &ExportEstimate{Disk: e.Image, SizeBytes: size << 30}
+	if err := s.w.ValidateExportDestination(ctx, e.buffer.Project, e.buffer.Zone, e.DestinationURI, est); err != nil {
+		return err
+	}
+	e.buffer.Disk.SizeGb = bufferSizeGb(size)
+	// The worker may take as long as the step, whose timeout may have been
+	// scaled with the image size.
+	e.include.Workflow.Steps["wait"].timeout = s.timeout
+	return e.include.run(ctx, s)
+}
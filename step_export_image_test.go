@@ -0,0 +1,131 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportImagePopulate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc       string
+		ei         *ExportImage
+		wantFormat string
+		shouldErr  bool
+	}{
+		{"format from extension case", &ExportImage{Image: testImage, DestinationURI: "gs://bucket/image.vmdk"}, "vmdk", false},
+		{"format case", &ExportImage{Image: testImage, DestinationURI: "gs://bucket/image", Format: "qcow2"}, "qcow2", false},
+		{"quoted destination case", &ExportImage{Image: testImage, DestinationURI: "gs://bucket/my image's.vmdk"}, "vmdk", false},
+		{"unknown format case", &ExportImage{Image: testImage, DestinationURI: "gs://bucket/image.iso"}, "", true},
+		{"bad destination case", &ExportImage{Image: testImage, DestinationURI: "bucket/image.vmdk"}, "", true},
+		{"no image case", &ExportImage{DestinationURI: "gs://bucket/image.vmdk"}, "", true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("export")
+		s.ExportImage = tt.ei
+		err := w.populateStep(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if tt.ei.Format != tt.wantFormat {
+			t.Errorf("%s: unexpected format %q", tt.desc, tt.ei.Format)
+		}
+		iw := tt.ei.include.Workflow
+		source := (*iw.Steps["create-disks"].CreateDisks)[0]
+		if source.SourceImage != testImage {
+			t.Errorf("%s: source disk not created from the image: %+v", tt.desc, source)
+		}
+		i := iw.Steps["create"].CreateInstances.Instances[0]
+		if got := i.Disks[0].InitializeParams.SourceImage; got != defaultExportWorkerImage {
+			t.Errorf("%s: unexpected worker image %q", tt.desc, got)
+		}
+		if d := i.Disks[1]; d.Mode != "READ_ONLY" || d.DeviceName != exportSourceDevice {
+			t.Errorf("%s: source disk not attached as expected: %+v", tt.desc, d)
+		}
+		if d := i.Disks[2]; d.DeviceName != exportBufferDevice {
+			t.Errorf("%s: buffer disk not attached as expected: %+v", tt.desc, d)
+		}
+		script := i.Metadata["startup-script"]
+		for _, want := range []string{"qemu-img convert -O " + exportImageFormats[tt.wantFormat] + " ", "dest=" + shellQuote(tt.ei.DestinationURI) + "\n", `cp $out "$dest"`, "key:'export-size-bytes'"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s: script does not contain %q", tt.desc, want)
+			}
+		}
+		if strings.Contains(script, "${") {
+			t.Errorf("%s: script would be taken for an unresolved var", tt.desc)
+		}
+		if got := nestedWorkflow(s); got != iw {
+			t.Errorf("%s: nestedWorkflow should return the export workflow", tt.desc)
+		}
+	}
+}
+
+func TestBufferSizeGb(t *testing.T) {
+	for _, tt := range []struct{ sizeGb, want int64 }{{1, 10}, {10, 11}, {100, 110}, {2048, 2253}} {
+		if got := bufferSizeGb(tt.sizeGb); got != tt.want {
+			t.Errorf("bufferSizeGb(%d) = %d, want %d", tt.sizeGb, got, tt.want)
+		}
+	}
+}
+
+func TestExportImageProgress(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.populate(ctx)
+	var buf bytes.Buffer
+	w.SetProgressWriter(&buf)
+	s, _ := w.NewStep("export")
+	s.ExportImage = &ExportImage{Image: testImage, DestinationURI: "gs://bucket/image.vmdk"}
+	if err := w.populateStep(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	so := (*s.ExportImage.include.Workflow.Steps["wait"].WaitForInstancesSignal)[0].SerialOutput
+	for _, status := range []string{
+		"DaisyExport: converting the image",
+		"DaisyExport: converted 50% 1024 bytes",
+		"DaisyExport: copying the image to gs://bucket/image.vmdk",
+		"DaisyExport: copied 2048 bytes",
+	} {
+		so.onStatus(status)
+	}
+
+	var got []ProgressEvent
+	for _, ln := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e ProgressEvent
+		if err := json.Unmarshal([]byte(ln), &e); err != nil {
+			t.Fatalf("invalid progress event %q: %v", ln, err)
+		}
+		got = append(got, ProgressEvent{Stage: e.Stage, Step: e.Step, StepType: e.StepType, Percent: e.Percent, Disk: e.Disk, Bytes: e.Bytes})
+	}
+	want := []ProgressEvent{
+		{Stage: ProgressExport, Step: "export", StepType: "ExportImage", Percent: 45, Disk: testImage, Bytes: 1024},
+		{Stage: ProgressExport, Step: "export", StepType: "ExportImage", Percent: 100, Disk: testImage, Bytes: 2048},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("progress events not as expected: (-got,+want)\n%s", diffRes)
+	}
+}
@@ -0,0 +1,163 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	importStatusMatch  = "DaisyImport:"
+	importSuccessMatch = "DaisyImport: done"
+	importFailureMatch = "DaisyImport: failed"
+	importBufferDevice = "daisy-import-buffer"
+	importDestDevice   = "daisy-import-dest"
+)
+
+// importDiskScript copies the virtual disk file to the buffer disk and
+// converts it with qemu-img to the destination disk. SOURCE is replaced by the
+// quoted GCS path of the file. Avoid ${} expansions, they would be taken for
+// unresolved workflow vars.
+const importDiskScript = `#!/bin/bash
+exec >/dev/console 2>&1
+fail() {
+  echo "DaisyImport: failed: $1"
+  exit 1
+}
+buf=/dev/disk/by-id/google-daisy-import-buffer
+dest=/dev/disk/by-id/google-daisy-import-dest
+in=/daisy-import/disk
+source=SOURCE
+if ! command -v qemu-img >/dev/null; then
+  echo "DaisyImport: installing qemu-utils"
+  apt-get update -q && apt-get install -qy qemu-utils || fail "cannot install qemu-utils"
+fi
+mkfs.ext4 -qF $buf || fail "cannot format the buffer disk"
+mkdir -p /daisy-import && mount $buf /daisy-import || fail "cannot mount the buffer disk"
+echo "DaisyImport: copying $source"
+gsutil -q cp "$source" $in || fail "cannot copy $source"
+echo "DaisyImport: converting the disk"
+qemu-img convert -n -O raw $in $dest || fail "qemu-img convert failed"
+sync
+echo "DaisyImport: done"
+`
+
+// ImportDisk is a Daisy ImportDisk workflow step. It creates Disk from the
+// virtual disk file at SourceURI: the format and disk size of the file are
+// read from its headers, then a worker instance copies the file to a buffer
+// disk and converts it with qemu-img to Disk. The worker and the buffer are
+// deleted afterwards, Disk is left for later steps and is not deleted when the
+// workflow ends.
+type ImportDisk struct {
+	// GCS path of the file, e.g. gs://bucket/disk.vmdk. VMDK, QCOW2, VHDX,
+	// VHD, VDI and raw files are supported.
+	SourceURI string
+	// Disk to create. SizeGb defaults to the size of the disk in the file,
+	// SourceImage and SourceSnapshot must not be set.
+	Disk Disk
+	// Image of the worker instance, defaults to the latest Debian 11 image.
+	WorkerImage string `json:",omitempty"`
+	// Machine type of the worker instance, defaults to n1-standard-4.
+	WorkerMachineType string `json:",omitempty"`
+
+	include *IncludeWorkflow
+	buffer  *Disk
+	sizeSet bool
+}
+
+func (i *ImportDisk) populate(ctx context.Context, s *Step) DError {
+	if _, _, err := splitGCSPath(i.SourceURI); err != nil {
+		return Errf("ImportDisk: bad SourceURI %q: %v", i.SourceURI, err)
+	}
+	if i.Disk.Name == "" {
+		return Errf("ImportDisk: no Disk.Name given")
+	}
+	if i.Disk.SourceImage != "" || i.Disk.SourceSnapshot != "" {
+		return Errf("ImportDisk: Disk.SourceImage and Disk.SourceSnapshot must not be set")
+	}
+	i.WorkerImage = strOr(i.WorkerImage, defaultExportWorkerImage)
+	i.WorkerMachineType = strOr(i.WorkerMachineType, defaultExportWorkerMachineType)
+	// The disk and the buffer are sized to the file when the step runs.
+	i.sizeSet = i.Disk.SizeGb != ""
+	i.Disk.SizeGb = strOr(i.Disk.SizeGb, "10")
+	i.Disk.NoCleanup = true
+
+	name := strings.ToLower(s.name)
+	buffer := name + "-buffer"
+	iw := New()
+	disks, _ := iw.NewStep("create-disks")
+	i.buffer = &Disk{Disk: compute.Disk{Name: buffer}, SizeGb: "10"}
+	disks.CreateDisks = &CreateDisks{&i.Disk, i.buffer}
+	create, _ := iw.NewStep("create")
+	create.CreateInstances = &CreateInstances{Instances: []*Instance{{
+		Instance: compute.Instance{
+			Name:        name,
+			MachineType: i.WorkerMachineType,
+			Disks: []*compute.AttachedDisk{
+				{AutoDelete: true, InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: i.WorkerImage}},
+				{Source: buffer, DeviceName: importBufferDevice},
+				{Source: i.Disk.Name, DeviceName: importDestDevice},
+			},
+		},
+		Metadata: map[string]string{"startup-script": strings.NewReplacer("SOURCE", shellQuote(i.SourceURI)).Replace(importDiskScript)},
+	}}}
+	wait, _ := iw.NewStep("wait")
+	wait.WaitForInstancesSignal = &WaitForInstancesSignal{{
+		Name: name,
+		SerialOutput: &SerialOutput{
+			Port:         1,
+			SuccessMatch: importSuccessMatch,
+			FailureMatch: FailureMatches{importFailureMatch},
+			StatusMatch:  importStatusMatch,
+		},
+	}}
+	del, _ := iw.NewStep("delete")
+	del.DeleteResources = &DeleteResources{Instances: []string{name}, Disks: []string{buffer}}
+	iw.AddDependency(create, disks)
+	iw.AddDependency(wait, create)
+	iw.AddDependency(del, wait)
+
+	i.include = &IncludeWorkflow{Workflow: iw}
+	return i.include.populate(ctx, s)
+}
+
+func (i *ImportDisk) validate(ctx context.Context, s *Step) DError {
+	return i.include.validate(ctx, s)
+}
+
+func (i *ImportDisk) run(ctx context.Context, s *Step) DError {
+	vd, err := s.w.InspectVirtualDisk(ctx, i.SourceURI)
+	if err != nil {
+		return err
+	}
+	size := sizeGb(vd.SizeBytes)
+	if size < 10 {
+		size = 10
+	}
+	if !i.sizeSet {
+		i.Disk.Disk.SizeGb = size
+	} else if i.Disk.Disk.SizeGb < size {
+		return Errf("ImportDisk: Disk.SizeGb %d is smaller than the %dGB disk in %q", i.Disk.Disk.SizeGb, size, i.SourceURI)
+	}
+	i.buffer.Disk.SizeGb = bufferSizeGb(sizeGb(vd.FileSizeBytes))
+	s.w.LogStepInfo(s.name, "ImportDisk", "Importing %s file %q of a %dGB disk.", vd.Format, i.SourceURI, size)
+	// The worker may take as long as the step, whose timeout may have been
+	// scaled with the file size.
+	i.include.Workflow.Steps["wait"].timeout = s.timeout
+	return i.include.run(ctx, s)
+}
@@ -0,0 +1,82 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestImportDiskPopulate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc      string
+		id        *ImportDisk
+		wantSize  int64
+		sizeSet   bool
+		shouldErr bool
+	}{
+		{"normal case", &ImportDisk{SourceURI: "gs://bucket/disk.vmdk", Disk: Disk{Disk: compute.Disk{Name: "imported"}}}, 10, false, false},
+		{"size case", &ImportDisk{SourceURI: "gs://bucket/disk.vmdk", Disk: Disk{Disk: compute.Disk{Name: "imported"}, SizeGb: "50"}}, 50, true, false},
+		{"bad source case", &ImportDisk{SourceURI: "bucket/disk.vmdk", Disk: Disk{Disk: compute.Disk{Name: "imported"}}}, 0, false, true},
+		{"no disk name case", &ImportDisk{SourceURI: "gs://bucket/disk.vmdk"}, 0, false, true},
+		{"source image case", &ImportDisk{SourceURI: "gs://bucket/disk.vmdk", Disk: Disk{Disk: compute.Disk{Name: "imported", SourceImage: testImage}}}, 0, false, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("import")
+		s.ImportDisk = tt.id
+		err := w.populateStep(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if tt.id.sizeSet != tt.sizeSet || tt.id.Disk.Disk.SizeGb != tt.wantSize {
+			t.Errorf("%s: unexpected disk size %d, set: %t", tt.desc, tt.id.Disk.Disk.SizeGb, tt.id.sizeSet)
+		}
+		iw := tt.id.include.Workflow
+		if d := (*iw.Steps["create-disks"].CreateDisks)[0]; d != &tt.id.Disk {
+			t.Errorf("%s: Disk not created by the import workflow", tt.desc)
+		}
+		i := iw.Steps["create"].CreateInstances.Instances[0]
+		if d := i.Disks[2]; d.Source != "imported" || d.DeviceName != importDestDevice {
+			t.Errorf("%s: Disk not attached as expected: %+v", tt.desc, d)
+		}
+		script := i.Metadata["startup-script"]
+		if !strings.Contains(script, "source='"+tt.id.SourceURI+"'\n") || !strings.Contains(script, `gsutil -q cp "$source" `) {
+			t.Errorf("%s: script does not copy the quoted source", tt.desc)
+		}
+		if !tt.id.Disk.NoCleanup {
+			t.Errorf("%s: Disk would be deleted when the workflow ends", tt.desc)
+		}
+		if strings.Contains(script, "${") {
+			t.Errorf("%s: script would be taken for an unresolved var", tt.desc)
+		}
+		if got := iw.Steps["delete"].DeleteResources.Disks; len(got) != 1 || got[0] != "import-buffer" {
+			t.Errorf("%s: unexpected disks deleted: %v", tt.desc, got)
+		}
+		if got := nestedWorkflow(s); got != iw {
+			t.Errorf("%s: nestedWorkflow should return the import workflow", tt.desc)
+		}
+	}
+}
@@ -30,6 +30,10 @@ type IncludeWorkflow struct {
 	Path     string
 	Vars     map[string]string `json:",omitempty"`
 	Workflow *Workflow         `json:",omitempty"`
+
+	// workflowName is the name of the included workflow, the step name if
+	// unset. Steps that build their workflow set it to a valid resource name.
+	workflowName string
 }
 
 func (i *IncludeWorkflow) populate(ctx context.Context, s *Step) DError {
@@ -37,7 +41,7 @@ func (i *IncludeWorkflow) populate(ctx context.Context, s *Step) DError {
 	// Workflow could be nil when the parent workflow is constructed manually using Go structs.
 	if i.Path != "" && i.Workflow == nil {
 		var err error
-		if i.Workflow, err = s.w.NewIncludedWorkflowFromFile(i.Path); err != nil {
+		if i.Workflow, err = s.w.newIncludedWorkflowFromFile(ctx, i.Path); err != nil {
 			return newErr("failed to parse duration for step includeworkflow", err)
 		}
 	} else {
@@ -47,15 +51,22 @@ func (i *IncludeWorkflow) populate(ctx context.Context, s *Step) DError {
 		s.w.includeWorkflow(i.Workflow)
 	}
 
+	if i.Workflow.Finally != nil {
+		return Errf("IncludeWorkflow %q: Finally is not supported in included workflows, only in the including workflow", s.name)
+	}
+
 	i.Workflow.id = i.Workflow.parent.id
 	i.Workflow.username = i.Workflow.parent.username
 	i.Workflow.ComputeClient = i.Workflow.parent.ComputeClient
 	i.Workflow.StorageClient = i.Workflow.parent.StorageClient
+	i.Workflow.LogReader = i.Workflow.parent.LogReader
+	i.Workflow.Storage = i.Workflow.parent.Storage
+	i.Workflow.SerialConsole = i.Workflow.parent.SerialConsole
+	i.Workflow.KMSClient = i.Workflow.parent.KMSClient
 	i.Workflow.cloudLoggingClient = i.Workflow.parent.cloudLoggingClient
 	i.Workflow.GCSPath = i.Workflow.parent.GCSPath
 	i.Workflow.Name = i.Workflow.parent.Name
-	i.Workflow.Project = i.Workflow.parent.Project
-	i.Workflow.Zone = i.Workflow.parent.Zone
+	s.inheritEnv(i.Workflow)
 	i.Workflow.DefaultTimeout = i.Workflow.parent.DefaultTimeout
 	i.Workflow.autovars = i.Workflow.parent.autovars
 	i.Workflow.bucket = i.Workflow.parent.bucket
@@ -65,7 +76,7 @@ func (i *IncludeWorkflow) populate(ctx context.Context, s *Step) DError {
 	i.Workflow.outsPath = i.Workflow.parent.outsPath
 	i.Workflow.externalLogging = i.Workflow.parent.externalLogging
 	i.Workflow.Logger = i.Workflow.parent.Logger
-	i.Workflow.Name = s.name
+	i.Workflow.Name = strOr(i.workflowName, s.name)
 	i.Workflow.DefaultTimeout = s.Timeout
 
 	var errs DError
@@ -82,6 +93,7 @@ Loop:
 	if errs != nil {
 		return errs
 	}
+	i.Workflow.registerSensitiveVars()
 
 	var replacements []string
 	for k, v := range i.Workflow.autovars {
@@ -91,6 +103,12 @@ Loop:
 		if k == "WFDIR" {
 			v = i.Workflow.workflowDir
 		}
+		if k == "PROJECT" {
+			v = i.Workflow.Project
+		}
+		if k == "ZONE" {
+			v = i.Workflow.Zone
+		}
 		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
 	}
 	substitute(reflect.ValueOf(i.Workflow).Elem(), strings.NewReplacer(replacements...))
@@ -133,6 +151,12 @@ Loop:
 		}
 		s.w.Sources[k] = v
 	}
+	for k, v := range i.Workflow.SourceSHA256 {
+		if s.w.SourceSHA256 == nil {
+			s.w.SourceSHA256 = map[string]string{}
+		}
+		s.w.SourceSHA256[k] = v
+	}
 
 	return nil
 }
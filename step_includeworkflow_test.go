@@ -17,6 +17,7 @@ package daisy
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -123,6 +124,34 @@ func TestIncludeWorkflowPopulate_SkipsReadingPathWhenWorkflowNil(t *testing.T) {
 	}
 }
 
+func TestIncludeWorkflowPopulateFromGCS(t *testing.T) {
+	ctx := context.Background()
+	s := &FakeStorage{}
+	s.Put(ctx, "bkt", "wf/child.wf.json", "", strings.NewReader(`{"Steps": {"wait": {"Timeout": "1m", "WaitForInstancesSignal": [{"Name": "foo", "SerialOutput": {"Port": 1, "SuccessMatch": "done"}}]}}}`))
+
+	w := testWorkflow()
+	w.Storage = s
+	w.Steps = map[string]*Step{
+		"child": {IncludeWorkflow: &IncludeWorkflow{Path: "gs://bkt/wf/child.wf.json"}},
+	}
+	if err := w.populate(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	iw := w.Steps["child"].IncludeWorkflow.Workflow
+	if iw == nil || iw.Steps["wait"] == nil || iw.Steps["wait"].WaitForInstancesSignal == nil {
+		t.Fatalf("included workflow not read from GCS: %+v", iw)
+	}
+
+	w = testWorkflow()
+	w.Storage = s
+	w.Steps = map[string]*Step{
+		"child": {IncludeWorkflow: &IncludeWorkflow{Path: "gs://bkt/wf/dne.wf.json"}},
+	}
+	if err := w.populate(ctx); err == nil {
+		t.Error("expected error for missing workflow")
+	}
+}
+
 func TestIncludeWorkflowValidate(t *testing.T) {
 	ctx := context.Background()
 	w := testWorkflow()
@@ -0,0 +1,220 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	// FaultReset resets the instance, like pressing its reset button.
+	FaultReset = "reset"
+	// FaultSimulateMaintenance simulates a host maintenance event: the
+	// instance is live migrated or, if its onHostMaintenance scheduling is
+	// TERMINATE, stopped.
+	FaultSimulateMaintenance = "simulate-maintenance"
+	// FaultDetachReattachDisk detaches a disk of the instance and attaches it
+	// back after ReattachAfter.
+	FaultDetachReattachDisk = "detach-reattach-disk"
+
+	defaultReattachAfter = 10 * time.Second
+)
+
+// InjectFaults is a Daisy InjectFaults workflow step.
+type InjectFaults []*Fault
+
+// Fault is a fault injected into an instance, so that image qualification
+// workflows can check that the guest recovers from it, e.g. with a
+// WaitForInstancesSignal step afterwards.
+type Fault struct {
+	// Instance to inject the fault into.
+	Instance string
+	// Type of the fault, see the Fault constants.
+	Type string
+	// Device name of the disk detached by detach-reattach-disk faults. Boot
+	// disks cannot be detached.
+	DeviceName string `json:",omitempty"`
+	// How long the disk of a detach-reattach-disk fault stays detached,
+	// defaults to 10s.
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	ReattachAfter string `json:",omitempty"`
+	reattachAfter time.Duration
+	// Wait this long before injecting the fault, e.g. for the guest to be
+	// under load.
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	Delay string `json:",omitempty"`
+	delay time.Duration
+
+	project, zone, name string
+}
+
+func (f *InjectFaults) populate(ctx context.Context, s *Step) DError {
+	for _, ft := range *f {
+		ft.reattachAfter = defaultReattachAfter
+		if ft.ReattachAfter != "" {
+			d, err := time.ParseDuration(ft.ReattachAfter)
+			if err != nil {
+				return newErr("failed to parse ReattachAfter", err)
+			}
+			ft.reattachAfter = d
+		}
+		if ft.Delay != "" {
+			d, err := time.ParseDuration(ft.Delay)
+			if err != nil {
+				return newErr("failed to parse Delay", err)
+			}
+			ft.delay = d
+		}
+	}
+	return nil
+}
+
+func (f *InjectFaults) validate(ctx context.Context, s *Step) (errs DError) {
+	for _, ft := range *f {
+		switch ft.Type {
+		case FaultReset, FaultSimulateMaintenance:
+			if ft.DeviceName != "" || ft.ReattachAfter != "" {
+				errs = addErrs(errs, Errf("InjectFaults: instance %q: DeviceName and ReattachAfter are only supported by %s faults", ft.Instance, FaultDetachReattachDisk))
+			}
+		case FaultDetachReattachDisk:
+			if ft.DeviceName == "" {
+				errs = addErrs(errs, Errf("InjectFaults: instance %q: %s faults must set DeviceName", ft.Instance, ft.Type))
+			}
+		default:
+			errs = addErrs(errs, Errf("InjectFaults: instance %q: unknown fault Type %q, must be one of %q, %q or %q", ft.Instance, ft.Type, FaultReset, FaultSimulateMaintenance, FaultDetachReattachDisk))
+		}
+		if ft.reattachAfter < 0 || ft.delay < 0 {
+			errs = addErrs(errs, Errf("InjectFaults: instance %q: ReattachAfter and Delay must not be negative", ft.Instance))
+		}
+		ir, err := s.w.instances.regUse(ft.Instance, s)
+		if ir == nil {
+			return addErrs(errs, Errf("cannot inject fault: %v", err))
+		}
+		errs = addErrs(errs, err)
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		ft.project, ft.zone, ft.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	return errs
+}
+
+func (f *InjectFaults) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	for _, ft := range *f {
+		wg.Add(1)
+		go func(ft *Fault) {
+			defer wg.Done()
+			if err := ft.inject(s); err != nil {
+				e <- err
+			}
+		}(ft)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		wg.Wait()
+		return nil
+	}
+}
+
+// inject waits for the Delay of ft, then injects it.
+func (ft *Fault) inject(s *Step) DError {
+	w := s.w
+	if ir, ok := w.instances.get(ft.Instance); ok {
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		ft.project, ft.zone, ft.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	if ft.delay > 0 {
+		select {
+		case <-time.After(ft.delay):
+		case <-w.Cancel:
+			return nil
+		}
+	}
+
+	client := s.computeClient()
+	switch ft.Type {
+	case FaultReset:
+		w.LogStepInfo(s.name, "InjectFaults", "Resetting instance %q.", ft.Instance)
+		if err := client.ResetInstance(ft.project, ft.zone, ft.name); err != nil {
+			return typedErr(apiError, "failed to reset instance", err)
+		}
+	case FaultSimulateMaintenance:
+		w.LogStepInfo(s.name, "InjectFaults", "Simulating a host maintenance event on instance %q.", ft.Instance)
+		if err := client.SimulateMaintenanceEvent(ft.project, ft.zone, ft.name); err != nil {
+			return typedErr(apiError, "failed to simulate maintenance event", err)
+		}
+	case FaultDetachReattachDisk:
+		return ft.detachReattachDisk(s)
+	}
+	return nil
+}
+
+// detachReattachDisk detaches the disk DeviceName of the instance and
+// attaches it back, with the same settings, after ReattachAfter or once the
+// workflow is canceled.
+func (ft *Fault) detachReattachDisk(s *Step) DError {
+	w := s.w
+	client := s.computeClient()
+	inst, err := client.GetInstance(ft.project, ft.zone, ft.name)
+	if err != nil {
+		return typedErr(apiError, "failed to get instance", err)
+	}
+	var ad *compute.AttachedDisk
+	for _, d := range inst.Disks {
+		if d.DeviceName == ft.DeviceName {
+			ad = d
+		}
+	}
+	if ad == nil {
+		return Errf("InjectFaults: instance %q has no disk with device name %q", ft.Instance, ft.DeviceName)
+	}
+	if ad.Boot {
+		return Errf("InjectFaults: disk %q is the boot disk of instance %q, it cannot be detached", ft.DeviceName, ft.Instance)
+	}
+
+	w.LogStepInfo(s.name, "InjectFaults", "Detaching disk %q from instance %q for %s.", ft.DeviceName, ft.Instance, ft.reattachAfter)
+	if err := client.DetachDisk(ft.project, ft.zone, ft.name, ft.DeviceName); err != nil {
+		return typedErr(apiError, "failed to detach disk", err)
+	}
+	select {
+	case <-time.After(ft.reattachAfter):
+	case <-w.Cancel:
+	}
+	w.LogStepInfo(s.name, "InjectFaults", "Attaching disk %q back to instance %q.", ft.DeviceName, ft.Instance)
+	reattach := &compute.AttachedDisk{
+		Source:     ad.Source,
+		DeviceName: ad.DeviceName,
+		Mode:       ad.Mode,
+		Interface:  ad.Interface,
+		AutoDelete: ad.AutoDelete,
+	}
+	if err := client.AttachDisk(ft.project, ft.zone, ft.name, reattach); err != nil {
+		return typedErr(apiError, "failed to attach disk back", err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestInjectFaultsPopulate(t *testing.T) {
+	tests := []struct {
+		desc              string
+		f                 *Fault
+		wantReattachAfter time.Duration
+		wantDelay         time.Duration
+		wantErr           bool
+	}{
+		{"defaults case", &Fault{Type: FaultDetachReattachDisk}, defaultReattachAfter, 0, false},
+		{"durations case", &Fault{Type: FaultDetachReattachDisk, ReattachAfter: "1m", Delay: "30s"}, time.Minute, 30 * time.Second, false},
+		{"bad ReattachAfter case", &Fault{ReattachAfter: "1 minute"}, 0, 0, true},
+		{"bad Delay case", &Fault{Delay: "soon"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s, _ := w.NewStep("s")
+		err := (&InjectFaults{tt.f}).populate(context.Background(), s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %v", tt.desc, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (tt.f.reattachAfter != tt.wantReattachAfter || tt.f.delay != tt.wantDelay) {
+			t.Errorf("%s: got ReattachAfter %s and Delay %s, want %s and %s", tt.desc, tt.f.reattachAfter, tt.f.delay, tt.wantReattachAfter, tt.wantDelay)
+		}
+	}
+}
+
+func TestInjectFaultsValidate(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc    string
+		f       *Fault
+		wantErr string
+	}{
+		{"reset case", &Fault{Instance: "instance1", Type: FaultReset}, ""},
+		{"simulate maintenance case", &Fault{Instance: "instance1", Type: FaultSimulateMaintenance}, ""},
+		{"detach reattach disk case", &Fault{Instance: "instance1", Type: FaultDetachReattachDisk, DeviceName: "data"}, ""},
+		{"unknown type case", &Fault{Instance: "instance1", Type: "unplug"}, "unknown fault Type"},
+		{"no DeviceName case", &Fault{Instance: "instance1", Type: FaultDetachReattachDisk}, "must set DeviceName"},
+		{"DeviceName on reset case", &Fault{Instance: "instance1", Type: FaultReset, DeviceName: "data"}, "only supported by"},
+		{"negative Delay case", &Fault{Instance: "instance1", Type: FaultReset, delay: -time.Second}, "must not be negative"},
+		{"instance DNE case", &Fault{Instance: "dne", Type: FaultReset}, "cannot inject fault"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s, _ := w.NewStep("s")
+		iCreator, _ := w.NewStep("iCreator")
+		iCreator.CreateInstances = &CreateInstances{Instances: []*Instance{{}}}
+		w.AddDependency(s, iCreator)
+		if err := w.instances.regCreate("instance1", &Resource{link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)}, false, iCreator); err != nil {
+			t.Fatal(err)
+		}
+
+		err := (&InjectFaults{tt.f}).validate(ctx, s)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			} else if tt.f.project != testProject || tt.f.zone != testZone || tt.f.name != "i" {
+				t.Errorf("%s: instance resolved to %s/%s/%s", tt.desc, tt.f.project, tt.f.zone, tt.f.name)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want error containing %q", tt.desc, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInjectFaultsRun(t *testing.T) {
+	ctx := context.Background()
+	disks := []*compute.AttachedDisk{
+		{DeviceName: "boot", Boot: true, Source: "projects/p/zones/z/disks/boot"},
+		{DeviceName: "data", Source: "projects/p/zones/z/disks/data", Mode: "READ_WRITE", AutoDelete: true},
+	}
+	tests := []struct {
+		desc      string
+		f         *Fault
+		wantCalls []string
+		wantErr   string
+	}{
+		{"reset case", &Fault{Type: FaultReset}, []string{"reset i"}, ""},
+		{"simulate maintenance case", &Fault{Type: FaultSimulateMaintenance}, []string{"simulate-maintenance i"}, ""},
+		{"detach reattach disk case", &Fault{Type: FaultDetachReattachDisk, DeviceName: "data"}, []string{"detach i data", "attach i data projects/p/zones/z/disks/data READ_WRITE true"}, ""},
+		{"boot disk case", &Fault{Type: FaultDetachReattachDisk, DeviceName: "boot"}, nil, "boot disk"},
+		{"disk DNE case", &Fault{Type: FaultDetachReattachDisk, DeviceName: "dne"}, nil, "no disk with device name"},
+		{"reset error case", &Fault{Type: FaultReset, Instance: "error"}, nil, "APIError"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("s")
+		w.instances.m = map[string]*Resource{
+			"in": {RealName: "i", link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)},
+		}
+		var mx sync.Mutex
+		var calls []string
+		call := func(format string, a ...interface{}) {
+			mx.Lock()
+			defer mx.Unlock()
+			calls = append(calls, fmt.Sprintf(format, a...))
+		}
+		fail := tt.f.Instance == "error"
+		c := w.ComputeClient.(*daisyCompute.TestClient)
+		c.ResetInstanceFn = func(_, _, name string) error {
+			if fail {
+				return fmt.Errorf("error")
+			}
+			call("reset %s", name)
+			return nil
+		}
+		c.SimulateMaintenanceEventFn = func(_, _, name string) error {
+			call("simulate-maintenance %s", name)
+			return nil
+		}
+		c.GetInstanceFn = func(_, _, name string) (*compute.Instance, error) {
+			return &compute.Instance{Name: name, Disks: disks}, nil
+		}
+		c.DetachDiskFn = func(_, _, name, deviceName string) error {
+			call("detach %s %s", name, deviceName)
+			return nil
+		}
+		c.AttachDiskFn = func(_, _, name string, d *compute.AttachedDisk) error {
+			call("attach %s %s %s %s %t", name, d.DeviceName, d.Source, d.Mode, d.AutoDelete)
+			return nil
+		}
+
+		tt.f.Instance = "in"
+		tt.f.reattachAfter = time.Millisecond
+		err := (&InjectFaults{tt.f}).run(ctx, s)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want error containing %q", tt.desc, err, tt.wantErr)
+		}
+		if diffRes := diff(calls, tt.wantCalls, 0); diffRes != "" {
+			t.Errorf("%s: calls do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+	}
+
+	// The disk is attached back right away once the workflow is canceled.
+	w := testWorkflow()
+	w.populate(ctx)
+	s, _ := w.NewStep("s")
+	w.instances.m = map[string]*Resource{
+		"in": {RealName: "i", link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)},
+	}
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetInstanceFn = func(_, _, name string) (*compute.Instance, error) {
+		return &compute.Instance{Name: name, Disks: disks}, nil
+	}
+	detached := make(chan struct{})
+	c.DetachDiskFn = func(_, _, _, _ string) error {
+		close(detached)
+		return nil
+	}
+	attached := make(chan struct{})
+	c.AttachDiskFn = func(_, _, _ string, _ *compute.AttachedDisk) error {
+		close(attached)
+		return nil
+	}
+	go func() {
+		<-detached
+		close(w.Cancel)
+	}()
+	f := &Fault{Instance: "in", Type: FaultDetachReattachDisk, DeviceName: "data", reattachAfter: time.Hour}
+	if err := (&InjectFaults{f}).run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case <-attached:
+	case <-time.After(5 * time.Second):
+		t.Error("disk not attached back after the workflow was canceled")
+	}
+}
@@ -0,0 +1,168 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	inspectStatusMatch  = "DaisyInspect:"
+	inspectSuccessMatch = "DaisyInspect: done"
+	inspectFailureMatch = "DaisyInspect: failed"
+	inspectDeviceName   = "daisy-inspect"
+
+	defaultInspectWorkerImage = "projects/debian-cloud/global/images/family/debian-11"
+)
+
+// inspectDiskScript mounts each partition of the inspected disk read-only,
+// without replaying the journal of a disk that was not cleanly unmounted, and
+// reports what it finds. The Windows build number is read from the registry
+// with hivexget, installed if missing. STEP is replaced by the step name.
+// Avoid ${} expansions, they would be taken for unresolved workflow vars.
+const inspectDiskScript = `#!/bin/bash
+exec >/dev/console 2>&1
+dev=/dev/disk/by-id/google-daisy-inspect
+os=unknown
+version=unknown
+bitness=unknown
+bootloader=bios
+if [ ! -b $dev ]; then
+  echo "DaisyInspect: failed: disk not attached"
+  exit 1
+fi
+if lsblk -nro PARTTYPE $dev | grep -qi c12a7328-f81f-11d2-ba4b-00a0c93ec93b; then
+  bootloader=efi
+fi
+used=0
+incomplete=false
+mnt=$(mktemp -d)
+for part in $(lsblk -nrpo NAME $dev); do
+  case $(blkid -o value -s TYPE $part) in
+    "") continue ;;
+    swap)
+      used=$((used + $(lsblk -bndo SIZE $part)))
+      continue
+      ;;
+    ext3|ext4) opts=ro,noload ;;
+    xfs) opts=ro,norecovery ;;
+    *) opts=ro ;;
+  esac
+  if ! mount -o $opts $part $mnt 2>/dev/null; then
+    # e.g. an LVM physical volume, its used space is unknown.
+    incomplete=true
+    continue
+  fi
+  used=$((used + $(df -B1 --output=used $mnt | tail -1)))
+  if [ "$os" != unknown ]; then
+    umount $mnt
+    continue
+  fi
+  if [ -f $mnt/etc/os-release ]; then
+    os=$(. $mnt/etc/os-release && echo "$ID")
+    version=$(. $mnt/etc/os-release && echo "$VERSION_ID")
+    bitness=32
+    if [ -d $mnt/lib64 ] || [ -d $mnt/usr/lib64 ] || [ -d $mnt/usr/lib/x86_64-linux-gnu ]; then
+      bitness=64
+    fi
+  elif [ -d $mnt/Windows/System32 ]; then
+    os=windows
+    bitness=32
+    if [ -d $mnt/Windows/SysWOW64 ]; then
+      bitness=64
+    fi
+    hive=$mnt/Windows/System32/config/SOFTWARE
+    if [ -f $hive ] && { command -v hivexget >/dev/null || { apt-get -q update && apt-get -q -y install libhivex-bin; } >/dev/null; }; then
+      version=$(hivexget $hive 'Microsoft\Windows NT\CurrentVersion' CurrentBuildNumber 2>/dev/null || echo unknown)
+    fi
+  fi
+  umount $mnt
+done
+echo "DaisyInspect: <serial-output key:'STEP-os' value:'$os'>"
+echo "DaisyInspect: <serial-output key:'STEP-version' value:'$version'>"
+echo "DaisyInspect: <serial-output key:'STEP-bitness' value:'$bitness'>"
+echo "DaisyInspect: <serial-output key:'STEP-bootloader' value:'$bootloader'>"
+echo "DaisyInspect: <serial-output key:'STEP-used-bytes' value:'$used'>"
+echo "DaisyInspect: <serial-output key:'STEP-used-bytes-incomplete' value:'$incomplete'>"
+echo "DaisyInspect: done"
+`
+
+// InspectDisk is a Daisy InspectDisk workflow step. It attaches Disk read-only
+// to a worker instance that detects the installed operating system, and
+// records the results as the serial-output values "<step>-os" (the os-release
+// ID, "windows" or "unknown"), "<step>-version" (the os-release VERSION_ID or
+// the Windows build number), "<step>-bitness" ("32" or
+// "64"), "<step>-bootloader" ("bios" or "efi"), "<step>-used-bytes", the
+// space used on the file systems of the disk, and
+// "<step>-used-bytes-incomplete", "true" if some of them could not be mounted
+// and are missing from it. The worker is deleted afterwards.
+type InspectDisk struct {
+	// Disk to inspect, the name of a disk created in the workflow or a
+	// partial URL.
+	Disk string
+	// Image of the worker instance, defaults to the latest Debian 11 image.
+	WorkerImage string `json:",omitempty"`
+
+	include *IncludeWorkflow
+}
+
+func (i *InspectDisk) populate(ctx context.Context, s *Step) DError {
+	if i.Disk == "" {
+		return Errf("InspectDisk: no Disk given")
+	}
+	i.WorkerImage = strOr(i.WorkerImage, defaultInspectWorkerImage)
+
+	name := resourceName(s.name)
+	iw := New()
+	create, _ := iw.NewStep("create")
+	create.CreateInstances = &CreateInstances{Instances: []*Instance{{
+		Instance: compute.Instance{
+			Name: name,
+			Disks: []*compute.AttachedDisk{
+				{AutoDelete: true, InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: i.WorkerImage}},
+				{Source: i.Disk, Mode: "READ_ONLY", DeviceName: inspectDeviceName},
+			},
+		},
+		Metadata: map[string]string{"startup-script": strings.Replace(inspectDiskScript, "STEP", s.name, -1)},
+	}}}
+	wait, _ := iw.NewStep("wait")
+	wait.WaitForInstancesSignal = &WaitForInstancesSignal{{
+		Name: name,
+		SerialOutput: &SerialOutput{
+			Port:         1,
+			SuccessMatch: inspectSuccessMatch,
+			FailureMatch: FailureMatches{inspectFailureMatch},
+			StatusMatch:  inspectStatusMatch,
+		},
+	}}
+	del, _ := iw.NewStep("delete")
+	del.DeleteResources = &DeleteResources{Instances: []string{name}}
+	iw.AddDependency(wait, create)
+	iw.AddDependency(del, wait)
+
+	i.include = &IncludeWorkflow{Workflow: iw, workflowName: name}
+	return i.include.populate(ctx, s)
+}
+
+func (i *InspectDisk) validate(ctx context.Context, s *Step) DError {
+	return i.include.validate(ctx, s)
+}
+
+func (i *InspectDisk) run(ctx context.Context, s *Step) DError {
+	return i.include.run(ctx, s)
+}
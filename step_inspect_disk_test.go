@@ -0,0 +1,75 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInspectDiskPopulate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc            string
+		id              *InspectDisk
+		wantWorkerImage string
+		shouldErr       bool
+	}{
+		{"default worker case", &InspectDisk{Disk: testDisk}, defaultInspectWorkerImage, false},
+		{"worker image case", &InspectDisk{Disk: testDisk, WorkerImage: testImage}, testImage, false},
+		{"no disk case", &InspectDisk{}, "", true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("inspect")
+		s.InspectDisk = tt.id
+		err := w.populateStep(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		iw := tt.id.include.Workflow
+		i := iw.Steps["create"].CreateInstances.Instances[0]
+		if got := i.Disks[0].InitializeParams.SourceImage; got != tt.wantWorkerImage {
+			t.Errorf("%s: unexpected worker image %q", tt.desc, got)
+		}
+		if d := i.Disks[1]; d.Source != testDisk || d.Mode != "READ_ONLY" || d.DeviceName != inspectDeviceName {
+			t.Errorf("%s: inspected disk not attached as expected: %+v", tt.desc, d)
+		}
+		script := i.Metadata["startup-script"]
+		for _, key := range []string{"inspect-os", "inspect-version", "inspect-bitness", "inspect-bootloader", "inspect-used-bytes", "inspect-used-bytes-incomplete"} {
+			if !strings.Contains(script, "key:'"+key+"'") {
+				t.Errorf("%s: script does not report %q", tt.desc, key)
+			}
+		}
+		for _, opts := range []string{"ro,noload", "ro,norecovery"} {
+			if !strings.Contains(script, opts) {
+				t.Errorf("%s: script does not mount with %q", tt.desc, opts)
+			}
+		}
+		if strings.Contains(script, "${") {
+			t.Errorf("%s: script would be taken for an unresolved var", tt.desc)
+		}
+		if got := nestedWorkflow(s); got != iw {
+			t.Errorf("%s: nestedWorkflow should return the inspection workflow", tt.desc)
+		}
+	}
+}
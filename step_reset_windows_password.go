@@ -0,0 +1,235 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	windowsKeysMetadataKey = "windows-keys"
+	windowsKeysSerialPort  = 4
+)
+
+// ResetWindowsPassword is a Daisy ResetWindowsPassword workflow step.
+type ResetWindowsPassword []*WindowsPasswordReset
+
+// WindowsPasswordReset resets the password of a Windows user on an instance,
+// creating the user if needed. The Windows guest agent must be running on the
+// instance.
+// The generated password is stored as a redacted serial-output value under
+// OutputKey, see Workflow.GetSerialConsoleOutputValue, and redacted like the
+// values of Sensitive vars.
+type WindowsPasswordReset struct {
+	// Instance to reset the password on.
+	Instance string
+	// Windows user name.
+	UserName string
+	// Key to store the password under, defaults to "<Instance>-password".
+	OutputKey string `json:",omitempty"`
+	// Interval to check for the guest agent response (default is 10s).
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	Interval string `json:",omitempty"`
+	interval time.Duration
+
+	project, zone, name string
+}
+
+// windowsKey is the windows-keys metadata entry read by the guest agent.
+type windowsKey struct {
+	UserName string `json:"userName"`
+	Modulus  string `json:"modulus"`
+	Exponent string `json:"exponent"`
+	Email    string `json:"email"`
+	ExpireOn string `json:"expireOn"`
+}
+
+// windowsKeyResponse is written by the guest agent to serial port 4.
+type windowsKeyResponse struct {
+	Modulus           string `json:"modulus"`
+	EncryptedPassword string `json:"encryptedPassword"`
+	ErrorMessage      string `json:"errorMessage"`
+}
+
+func (r *ResetWindowsPassword) populate(ctx context.Context, s *Step) DError {
+	pi := s.w.pollingIntervals()
+	for _, wp := range *r {
+		wp.OutputKey = strOr(wp.OutputKey, wp.Instance+"-password")
+		wp.Interval = strOr(wp.Interval, pi.SerialOutput, pi.Default, defaultInterval)
+		var err error
+		if wp.interval, err = time.ParseDuration(wp.Interval); err != nil {
+			return newErr("failed to parse interval for step ResetWindowsPassword", err)
+		}
+	}
+	return nil
+}
+
+func (r *ResetWindowsPassword) validate(ctx context.Context, s *Step) (errs DError) {
+	for _, wp := range *r {
+		if wp.UserName == "" {
+			errs = addErrs(errs, Errf("Instance %v: UserName must be set to reset a Windows password", wp.Instance))
+		}
+		ir, err := s.w.instances.regUse(wp.Instance, s)
+		if ir == nil {
+			return addErrs(errs, Errf("cannot reset Windows password: %v", err))
+		}
+		errs = addErrs(errs, err)
+	}
+	return errs
+}
+
+func (r *ResetWindowsPassword) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	for _, wp := range *r {
+		wg.Add(1)
+		go func(wp *WindowsPasswordReset) {
+			defer wg.Done()
+			ir, ok := w.instances.get(wp.Instance)
+			if !ok {
+				e <- Errf("unresolved instance %q", wp.Instance)
+				return
+			}
+			m := NamedSubexp(instanceURLRgx, ir.link)
+			wp.project, wp.zone, wp.name = m["project"], m["zone"], m["instance"]
+			w.LogStepInfo(s.name, "ResetWindowsPassword", "Resetting password for user %q on instance %q.", wp.UserName, wp.name)
+			password, err := resetWindowsPassword(s, wp)
+			if err != nil {
+				e <- err
+				return
+			}
+			if password == "" {
+				// The workflow was canceled.
+				return
+			}
+			w.addSensitiveValue(password)
+			w.root().addRedactedOutputValue(wp.OutputKey, password)
+			w.LogStepInfo(s.name, "ResetWindowsPassword", "Password for user %q on instance %q reset, stored as %q.", wp.UserName, wp.name, wp.OutputKey)
+		}(wp)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		wg.Wait()
+		return nil
+	}
+}
+
+// resetWindowsPassword resets the password of wp and returns it, or "" if the
+// workflow is canceled.
+func resetWindowsPassword(s *Step, wp *WindowsPasswordReset) (string, DError) {
+	w := s.w
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", newErr("failed to generate key", err)
+	}
+
+	// The guest agent only looks at serial output written after the key is
+	// added, so note where the output currently ends.
+	out, err := w.ComputeClient.GetSerialPortOutput(wp.project, wp.zone, wp.name, windowsKeysSerialPort, 0)
+	if err != nil {
+		return "", typedErr(apiError, "failed to get serial port output", err)
+	}
+	start := out.Next
+
+	wk := newWindowsKey(key, wp.UserName)
+	if derr := addWindowsKey(s, wp, wk); derr != nil {
+		return "", derr
+	}
+
+	tailString := ""
+	tick := time.Tick(wp.interval)
+	for {
+		select {
+		case <-w.Cancel:
+			return "", nil
+		case <-tick:
+			out, err := w.ComputeClient.GetSerialPortOutput(wp.project, wp.zone, wp.name, windowsKeysSerialPort, start)
+			if err != nil {
+				return "", typedErr(apiError, "failed to get serial port output", err)
+			}
+			start = out.Next
+			lines := strings.Split(tailString+out.Contents, "\n")
+			tailString = lines[len(lines)-1]
+			for _, ln := range lines[:len(lines)-1] {
+				var resp windowsKeyResponse
+				if err := json.Unmarshal([]byte(ln), &resp); err != nil || resp.Modulus != wk.Modulus {
+					continue
+				}
+				if resp.ErrorMessage != "" {
+					return "", Errf("instance %q: error resetting Windows password: %s", wp.name, resp.ErrorMessage)
+				}
+				return decryptWindowsPassword(key, resp.EncryptedPassword)
+			}
+		}
+	}
+}
+
+func newWindowsKey(key *rsa.PrivateKey, userName string) *windowsKey {
+	exp := make([]byte, 4)
+	binary.BigEndian.PutUint32(exp, uint32(key.E))
+	return &windowsKey{
+		UserName: userName,
+		Modulus:  base64.StdEncoding.EncodeToString(key.N.Bytes()),
+		Exponent: base64.StdEncoding.EncodeToString(exp[1:]),
+		ExpireOn: time.Now().Add(5 * time.Minute).UTC().Format(time.RFC3339),
+	}
+}
+
+// addWindowsKey appends wk to the instance windows-keys metadata.
+func addWindowsKey(s *Step, wp *WindowsPasswordReset, wk *windowsKey) DError {
+	b, err := json.Marshal(wk)
+	if err != nil {
+		return newErr("failed to marshal windows key", err)
+	}
+	return updateMetadata(s.computeClient(), wp.project, wp.zone, wp.name, func(md *compute.Metadata) {
+		value := string(b)
+		if keys := metadataValue(md, windowsKeysMetadataKey); keys != "" {
+			value = keys + "\n" + value
+		}
+		setMetadataValue(md, windowsKeysMetadataKey, value)
+	})
+}
+
+func decryptWindowsPassword(key *rsa.PrivateKey, encrypted string) (string, DError) {
+	b, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", newErr("failed to decode encrypted password", err)
+	}
+	password, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, b, nil)
+	if err != nil {
+		return "", newErr("failed to decrypt password", err)
+	}
+	return string(password), nil
+}
@@ -0,0 +1,166 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestResetWindowsPasswordPopulate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+
+	r := &ResetWindowsPassword{{Instance: "i1", UserName: "user"}}
+	if err := r.populate(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &ResetWindowsPassword{{Instance: "i1", UserName: "user", OutputKey: "i1-password", Interval: defaultInterval, interval: 10 * time.Second}}
+	if diffRes := diff(r, want, 0); diffRes != "" {
+		t.Errorf("ResetWindowsPassword not populated as expected: (-got,+want)\n%s", diffRes)
+	}
+
+	r = &ResetWindowsPassword{{Instance: "i1", UserName: "user", Interval: "bad"}}
+	if err := r.populate(ctx, s); err == nil {
+		t.Error("expected error on bad interval")
+	}
+}
+
+func TestResetWindowsPasswordValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+
+	tests := []struct {
+		desc    string
+		r       *ResetWindowsPassword
+		wantErr bool
+	}{
+		{"normal case", &ResetWindowsPassword{{Instance: testInstance, UserName: "user"}}, false},
+		{"no user case", &ResetWindowsPassword{{Instance: testInstance}}, true},
+		{"bad instance case", &ResetWindowsPassword{{Instance: "bad", UserName: "user"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.r.validate(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestResetWindowsPasswordRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+
+	// fakeAgent mimics the guest agent: it answers the last windows-keys entry
+	// on serial port 4.
+	fakeAgent := func(errMsg string) {
+		var mx sync.Mutex
+		var output string
+		c := w.ComputeClient.(*daisyCompute.TestClient)
+		c.GetInstanceFn = func(_, _, _ string) (*compute.Instance, error) {
+			v := `{"userName":"old"}`
+			return &compute.Instance{Metadata: &compute.Metadata{Items: []*compute.MetadataItems{{Key: windowsKeysMetadataKey, Value: &v}}}}, nil
+		}
+		c.SetInstanceMetadataFn = func(_, _, _ string, md *compute.Metadata) error {
+			var value string
+			for _, item := range md.Items {
+				if item.Key == windowsKeysMetadataKey {
+					value = *item.Value
+				}
+			}
+			keys := strings.Split(value, "\n")
+			if len(keys) != 2 {
+				return fmt.Errorf("expected existing key to be kept, got %q", value)
+			}
+			var wk windowsKey
+			if err := json.Unmarshal([]byte(keys[1]), &wk); err != nil {
+				return err
+			}
+			n, _ := base64.StdEncoding.DecodeString(wk.Modulus)
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+			enc, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, []byte("secret"), nil)
+			if err != nil {
+				return err
+			}
+			resp, _ := json.Marshal(windowsKeyResponse{Modulus: wk.Modulus, EncryptedPassword: base64.StdEncoding.EncodeToString(enc), ErrorMessage: errMsg})
+			mx.Lock()
+			output = "unrelated\n" + string(resp) + "\n"
+			mx.Unlock()
+			return nil
+		}
+		c.GetSerialPortOutputFn = func(_, _, _ string, port, start int64) (*compute.SerialPortOutput, error) {
+			if port != windowsKeysSerialPort {
+				return nil, fmt.Errorf("unexpected port %d", port)
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			if int(start) >= len(output) {
+				return &compute.SerialPortOutput{Next: start}, nil
+			}
+			return &compute.SerialPortOutput{Contents: output[start:], Next: int64(len(output))}, nil
+		}
+	}
+
+	fakeAgent("")
+	r := &ResetWindowsPassword{{Instance: testInstance, UserName: "user", OutputKey: "pw", interval: time.Millisecond}}
+	if err := r.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := w.GetSerialConsoleOutputValue("pw"); got != "secret" {
+		t.Errorf("unexpected password: %q", got)
+	}
+	if !w.redactedOutputKeys["pw"] {
+		t.Error("password output value should be redacted")
+	}
+	if got := w.redact("password is secret"); got != "password is "+redactedValue {
+		t.Errorf("password should be redacted, got %q", got)
+	}
+
+	fakeAgent("user does not exist")
+	if err := r.run(ctx, s); err == nil || !strings.Contains(err.Error(), "user does not exist") {
+		t.Errorf("expected agent error, got: %v", err)
+	}
+
+	// Nothing is stored once the workflow is canceled.
+	fakeAgent("")
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		return &compute.SerialPortOutput{Next: start}, nil
+	}
+	close(w.Cancel)
+	r = &ResetWindowsPassword{{Instance: testInstance, UserName: "user", OutputKey: "canceled", interval: time.Millisecond}}
+	if err := r.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := w.serialControlOutputValues["canceled"]; ok {
+		t.Error("password stored after the workflow was canceled")
+	}
+}
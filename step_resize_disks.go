@@ -38,7 +38,7 @@ func (r *ResizeDisks) populate(ctx context.Context, s *Step) DError {
 	var errs DError
 	for _, rd := range *r {
 		if diskURLRgx.MatchString(rd.Name) {
-			rd.Name = extendPartialURL(rd.Name, s.w.Project)
+			rd.Name = extendPartialURL(rd.Name, s.project())
 		}
 		if rd.SizeGb != "" && rd.DisksResizeRequest.SizeGb == 0 {
 			size, err := strconv.ParseInt(rd.SizeGb, 10, 64)
@@ -79,11 +79,22 @@ func (r *ResizeDisks) run(ctx context.Context, s *Step) DError {
 		go func(rd *ResizeDisk) {
 			defer wg.Done()
 
+			// The size before is only needed to describe the change.
+			var before int64
+			if d, err := s.computeClient().GetDisk(s.project(), s.zone(), rd.Name); err == nil {
+				before = d.SizeGb
+			}
+
 			w.LogStepInfo(s.name, "ResizeDisks", "Resizing disk %q to %v GB.", rd.Name, rd.DisksResizeRequest.SizeGb)
-			if err := w.ComputeClient.ResizeDisk(s.w.Project, s.w.Zone, rd.Name, &rd.DisksResizeRequest); err != nil {
+			if err := s.computeClient().ResizeDisk(s.project(), s.zone(), rd.Name, &rd.DisksResizeRequest); err != nil {
 				e <- newErr("failed to resize disk", err)
 				return
 			}
+			change := fmt.Sprintf("sizeGb changed: %d -> %d", before, rd.DisksResizeRequest.SizeGb)
+			if before == 0 {
+				change = fmt.Sprintf("sizeGb changed to %d", rd.DisksResizeRequest.SizeGb)
+			}
+			w.recordChange(s, "ResizeDisks", rd.Name, []string{change})
 		}(rd)
 	}
 
@@ -101,7 +101,8 @@ func TestResizeDisksRun(t *testing.T) {
 	for _, tt := range tests {
 		var gotDrr compute.DisksResizeRequest
 		fake := func(_, _, _ string, drr *compute.DisksResizeRequest) error { gotDrr = *drr; return tt.clientErr }
-		w.ComputeClient = &daisyCompute.TestClient{ResizeDiskFn: fake}
+		getDisk := func(_, _, _ string) (*compute.Disk, error) { return &compute.Disk{SizeGb: 5}, nil }
+		w.ComputeClient = &daisyCompute.TestClient{ResizeDiskFn: fake, GetDiskFn: getDisk}
 		if err := tt.rd.run(ctx, s); err != tt.wantErr {
 			t.Errorf("%s: unexpected error returned, got: %v, want: %v", tt.desc, err, tt.wantErr)
 		}
@@ -0,0 +1,231 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	serialConsoleUser           = "daisy"
+	serialPortEnableMetadataKey = "serial-port-enable"
+)
+
+// SendSerialInput is a Daisy SendSerialInput workflow step.
+type SendSerialInput []*SerialInput
+
+// SerialInput types input on the interactive serial console of an instance,
+// e.g. to select a GRUB menu entry or run commands in an emergency shell.
+// While the input is sent, the console is enabled and a temporary SSH key is
+// added in the instance metadata, both are restored afterwards. Projects
+// using OS Login do not accept metadata SSH keys on the console.
+type SerialInput struct {
+	// Instance to type on.
+	Instance string
+	// Serial port, 1 to 4, defaults to 1.
+	Port int64 `json:",omitempty"`
+	// Input to send, in order.
+	Input []*SerialInputItem
+
+	project, zone, name string
+}
+
+// SerialInputItem is text typed on a serial console once some output is seen.
+type SerialInputItem struct {
+	// Wait for this text in the console output, after the output matched by
+	// the previous items, before typing Text.
+	WaitFor string `json:",omitempty"`
+	// Text to type. Special keys are typed with JSON escapes, e.g. "\r" for
+	// Enter or "\u001b[B" for Down.
+	Text string `json:",omitempty"`
+}
+
+func (c *SendSerialInput) populate(ctx context.Context, s *Step) DError {
+	for _, si := range *c {
+		if si.Port == 0 {
+			si.Port = 1
+		}
+	}
+	return nil
+}
+
+func (c *SendSerialInput) validate(ctx context.Context, s *Step) (errs DError) {
+	for _, si := range *c {
+		if si.Port < 1 || si.Port > 4 {
+			errs = addErrs(errs, Errf("SendSerialInput: instance %q: Port must be 1 to 4, got %d", si.Instance, si.Port))
+		}
+		if len(si.Input) == 0 {
+			errs = addErrs(errs, Errf("SendSerialInput: instance %q: no Input given", si.Instance))
+		}
+		for _, in := range si.Input {
+			if in == nil || (in.WaitFor == "" && in.Text == "") {
+				errs = addErrs(errs, Errf("SendSerialInput: instance %q: Input items must set WaitFor or Text", si.Instance))
+			}
+		}
+		ir, err := s.w.instances.regUse(si.Instance, s)
+		if ir == nil {
+			return addErrs(errs, Errf("cannot send serial input: %v", err))
+		}
+		errs = addErrs(errs, err)
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		si.project, si.zone, si.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	return errs
+}
+
+func (c *SendSerialInput) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, si := range *c {
+		wg.Add(1)
+		go func(si *SerialInput) {
+			defer wg.Done()
+			if err := si.send(ctx, s); err != nil {
+				e <- err
+			}
+		}(si)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		cancel()
+		wg.Wait()
+		return nil
+	}
+}
+
+// send enables the serial console of the instance with a temporary key,
+// types the input and restores the metadata.
+func (si *SerialInput) send(ctx context.Context, s *Step) DError {
+	w := s.w
+	if ir, ok := w.instances.get(si.Instance); ok {
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		si.project, si.zone, si.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	key, pub, err := newSSHKey()
+	if err != nil {
+		return Errf("SendSerialInput: error creating SSH key: %v", err)
+	}
+
+	var added []string
+	var prevEnable string
+	var hadEnable bool
+	if err := updateMetadata(s.computeClient(), si.project, si.zone, si.name, func(md *compute.Metadata) {
+		added, _ = updateSSHKeys(md, []string{fmt.Sprintf("%s:%s %s", serialConsoleUser, pub, serialConsoleUser)}, nil)
+		prevEnable, hadEnable = metadataItem(md, serialPortEnableMetadataKey)
+		setMetadataValue(md, serialPortEnableMetadataKey, metadataValueTrue)
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		err := updateMetadata(s.computeClient(), si.project, si.zone, si.name, func(md *compute.Metadata) {
+			updateSSHKeys(md, nil, added)
+			if hadEnable {
+				setMetadataValue(md, serialPortEnableMetadataKey, prevEnable)
+			} else {
+				deleteMetadataItem(md, serialPortEnableMetadataKey)
+			}
+		})
+		if err != nil {
+			w.LogStepInfo(s.name, "SendSerialInput", "Error restoring the metadata of instance %q: %v", si.name, err)
+		}
+	}()
+
+	console, err := w.serialConsole().Open(ctx, si.project, si.zone, si.name, si.Port, serialConsoleUser, key)
+	if err != nil {
+		return Errf("SendSerialInput: instance %q: error opening serial console: %v", si.name, err)
+	}
+	defer console.Close()
+	w.LogStepInfo(s.name, "SendSerialInput", "Instance %q: typing %d inputs on serial port %d.", si.name, len(si.Input), si.Port)
+	if err := typeSerialInput(ctx, console, si.Input); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return Errf("SendSerialInput: instance %q: %v", si.name, err)
+	}
+	return nil
+}
+
+// typeSerialInput types input on console, waiting for the output each item
+// waits for first.
+func typeSerialInput(ctx context.Context, console io.ReadWriter, input []*SerialInputItem) error {
+	out := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(out)
+		for {
+			b := make([]byte, 4096)
+			n, err := console.Read(b)
+			if n > 0 {
+				select {
+				case out <- b[:n]:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var seen []byte
+	for _, in := range input {
+		for in.WaitFor != "" {
+			if i := bytes.Index(seen, []byte(in.WaitFor)); i >= 0 {
+				seen = seen[i+len(in.WaitFor):]
+				break
+			}
+			select {
+			case b, ok := <-out:
+				if !ok {
+					return fmt.Errorf("console closed while waiting for %q, last output: %q", in.WaitFor, lastBytes(seen, 500))
+				}
+				seen = append(seen, b...)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if _, err := io.WriteString(console, in.Text); err != nil {
+			return fmt.Errorf("error typing on console: %v", err)
+		}
+	}
+	return nil
+}
+
+// lastBytes returns the last n bytes of b.
+func lastBytes(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[len(b)-n:]
+	}
+	return b
+}
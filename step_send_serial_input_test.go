@@ -0,0 +1,151 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+// fakeConsole is a serial console printing the outputs of its script when
+// it is typed their inputs.
+type fakeConsole struct {
+	mx     sync.Mutex
+	script map[string]string
+	typed  string
+	out    chan string
+}
+
+func (c *fakeConsole) Read(b []byte) (int, error) {
+	s, ok := <-c.out
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, s), nil
+}
+
+func (c *fakeConsole) Write(b []byte) (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.typed += string(b)
+	if out, ok := c.script[string(b)]; ok {
+		go func() { c.out <- out }()
+	}
+	return len(b), nil
+}
+
+func (c *fakeConsole) Close() error {
+	return nil
+}
+
+type fakeSerialConsole struct {
+	console *fakeConsole
+	user    string
+}
+
+func (f *fakeSerialConsole) Open(ctx context.Context, project, zone, instance string, port int64, user string, key []byte) (io.ReadWriteCloser, error) {
+	f.user = fmt.Sprintf("%s.%s.%s.%s.port=%d", project, zone, instance, user, port)
+	go func() { f.console.out <- "GNU GRUB\n  Debian\n  Advanced options\n" }()
+	return f.console, nil
+}
+
+func TestSendSerialInputValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+
+	tests := []struct {
+		desc    string
+		c       *SendSerialInput
+		wantErr bool
+	}{
+		{"normal case", &SendSerialInput{{Instance: testInstance, Input: []*SerialInputItem{{WaitFor: "GRUB", Text: "e"}}}}, false},
+		{"bad port case", &SendSerialInput{{Instance: testInstance, Port: 5, Input: []*SerialInputItem{{Text: "e"}}}}, true},
+		{"no input case", &SendSerialInput{{Instance: testInstance}}, true},
+		{"empty item case", &SendSerialInput{{Instance: testInstance, Input: []*SerialInputItem{{}}}}, true},
+		{"bad instance case", &SendSerialInput{{Instance: "bad", Input: []*SerialInputItem{{Text: "e"}}}}, true},
+	}
+	for _, tt := range tests {
+		tt.c.populate(ctx, s)
+		if err := tt.c.validate(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestSendSerialInputRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+
+	md := mapToComputeMetadata(map[string]string{sshKeysMetadataKey: "user:key"})
+	var mdDuringRun map[string]string
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetInstanceFn = func(_, _, _ string) (*compute.Instance, error) {
+		cp := mapToComputeMetadata(computeMetataToMap(md))
+		return &compute.Instance{Metadata: &cp}, nil
+	}
+	c.SetInstanceMetadataFn = func(_, _, _ string, got *compute.Metadata) error {
+		md = *got
+		if mdDuringRun == nil {
+			mdDuringRun = computeMetataToMap(md)
+		}
+		return nil
+	}
+	console := &fakeConsole{out: make(chan string), script: map[string]string{"\u001b[B": "> Advanced options\n", "\r": "Loading Linux\n"}}
+	sc := &fakeSerialConsole{console: console}
+	w.SerialConsole = sc
+
+	step := &SendSerialInput{{Instance: testInstance, Input: []*SerialInputItem{
+		{WaitFor: "Advanced options", Text: "\u001b[B"},
+		{WaitFor: "> Advanced", Text: "\r"},
+		{WaitFor: "Loading Linux"},
+	}}}
+	step.populate(ctx, s)
+	if err := step.validate(ctx, s); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := step.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := fmt.Sprintf("%s.%s.%s.daisy.port=1", testProject, testZone, testInstance); sc.user != want {
+		t.Errorf("unexpected console user %q, want %q", sc.user, want)
+	}
+	if console.typed != "\u001b[B\r" {
+		t.Errorf("unexpected input typed: %q", console.typed)
+	}
+	if mdDuringRun[serialPortEnableMetadataKey] != metadataValueTrue || !strings.Contains(mdDuringRun[sshKeysMetadataKey], "daisy:ecdsa-sha2-nistp256 ") {
+		t.Errorf("serial console not enabled with a key during the run: %v", mdDuringRun)
+	}
+	if diffRes := diff(computeMetataToMap(md), map[string]string{sshKeysMetadataKey: "user:key"}, 0); diffRes != "" {
+		t.Errorf("metadata not restored: (-got +want)\n%s", diffRes)
+	}
+
+	// The console closing before the output waited for is an error.
+	close(console.out)
+	if err := typeSerialInput(ctx, console, []*SerialInputItem{{WaitFor: "login:"}}); err == nil {
+		t.Error("expected error for closed console")
+	}
+}
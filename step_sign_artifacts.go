@@ -0,0 +1,241 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	// Register the hashes of the KMS signing algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+const defaultSignatureSuffix = ".sig"
+
+var kmsKeyVersionRgx = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+/cryptoKeyVersions/[^/]+$`)
+
+// SignArtifacts is a Daisy SignArtifacts workflow step. It signs GCS objects,
+// such as image or OVF manifests and provenance documents, with a Cloud KMS
+// asymmetric signing key and uploads the detached signatures next to them.
+type SignArtifacts struct {
+	// Cloud KMS crypto key version to sign with,
+	// projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/V.
+	// Its algorithm must sign a SHA-256, SHA-384 or SHA-512 digest.
+	KeyVersion string
+	// GCS objects to sign.
+	Artifacts []string
+	// Suffix of the signature objects, written next to the artifacts.
+	// Defaults to ".sig".
+	SignatureSuffix string `json:",omitempty"`
+}
+
+// ArtifactSignature is a detached signature uploaded by a SignArtifacts
+// step, for provenance documents to refer to.
+type ArtifactSignature struct {
+	Step string
+	// Artifact and Signature are the GCS URLs of the signed object and of its
+	// signature.
+	Artifact, Signature string
+	KeyVersion          string
+	// Algorithm is the KMS algorithm of KeyVersion, e.g.
+	// EC_SIGN_P256_SHA256.
+	Algorithm string
+	// Digest is the signed digest of the artifact, e.g. "sha256:<hex>".
+	Digest string
+}
+
+func (sa *SignArtifacts) populate(ctx context.Context, s *Step) DError {
+	sa.SignatureSuffix = strOr(sa.SignatureSuffix, defaultSignatureSuffix)
+	return nil
+}
+
+func (sa *SignArtifacts) validate(ctx context.Context, s *Step) (errs DError) {
+	if !kmsKeyVersionRgx.MatchString(sa.KeyVersion) {
+		errs = addErrs(errs, Errf("SignArtifacts: KeyVersion %q is not a crypto key version, projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/V", sa.KeyVersion))
+	}
+	if len(sa.Artifacts) == 0 {
+		errs = addErrs(errs, Errf("SignArtifacts: no Artifacts given"))
+	}
+	for _, a := range sa.Artifacts {
+		b, o, err := splitGCSPath(a)
+		if err != nil {
+			errs = addErrs(errs, err)
+			continue
+		}
+		if o == "" || strings.HasSuffix(o, "/") {
+			errs = addErrs(errs, Errf("SignArtifacts: %q is not a GCS object", a))
+			continue
+		}
+		errs = addErrs(errs, s.w.objects.regCreate(path.Join(b, o+sa.SignatureSuffix)))
+	}
+	return errs
+}
+
+func (sa *SignArtifacts) run(ctx context.Context, s *Step) DError {
+	w := s.w
+	if w.KMSClient == nil {
+		return Errf("SignArtifacts: no KMSClient to sign with")
+	}
+	pub, err := w.KMSClient.GetPublicKey(sa.KeyVersion)
+	if err != nil {
+		return Errf("SignArtifacts: error getting key version %q: %v", sa.KeyVersion, err)
+	}
+	h, ok := kmsDigestHash(pub.Algorithm)
+	if !ok {
+		return Errf("SignArtifacts: key version %q: algorithm %q does not sign a SHA-2 digest", sa.KeyVersion, pub.Algorithm)
+	}
+
+	var wg sync.WaitGroup
+	e := make(chan DError)
+	for _, a := range sa.Artifacts {
+		wg.Add(1)
+		go func(a string) {
+			defer wg.Done()
+			sig, err := sa.sign(ctx, s, a, h)
+			if err != nil {
+				e <- err
+				return
+			}
+			sig.Algorithm = pub.Algorithm
+			w.LogStepInfo(s.name, "SignArtifacts", "Signed %s (%s), signature: %s", a, sig.Digest, sig.Signature)
+			w.recordSignature(sig)
+		}(a)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		return nil
+	}
+}
+
+// sign signs the digest of artifact a and uploads the signature.
+func (sa *SignArtifacts) sign(ctx context.Context, s *Step, a string, h crypto.Hash) (*ArtifactSignature, DError) {
+	w := s.w
+	b, o, err := splitGCSPath(a)
+	if err != nil {
+		return nil, err
+	}
+	r, rErr := w.storage().Get(ctx, b, o, 0)
+	if rErr != nil {
+		return nil, Errf("SignArtifacts: error reading %s: %v", a, rErr)
+	}
+	hh := h.New()
+	_, cErr := io.Copy(hh, r)
+	r.Close()
+	if cErr != nil {
+		return nil, Errf("SignArtifacts: error reading %s: %v", a, cErr)
+	}
+	digest := hh.Sum(nil)
+
+	sig, err := kmsSign(w.KMSClient, sa.KeyVersion, h, digest)
+	if err != nil {
+		return nil, Errf("SignArtifacts: error signing %s: %v", a, err)
+	}
+	if err := w.storage().Put(ctx, b, o+sa.SignatureSuffix, "application/octet-stream", bytes.NewReader(sig)); err != nil {
+		return nil, Errf("SignArtifacts: error uploading the signature of %s: %v", a, err)
+	}
+	return &ArtifactSignature{
+		Step:       getAbsoluteName(w) + "." + s.name,
+		Artifact:   a,
+		Signature:  fmt.Sprintf("gs://%s/%s", b, o+sa.SignatureSuffix),
+		KeyVersion: sa.KeyVersion,
+		Digest:     fmt.Sprintf("%s:%s", strings.ToLower(strings.ReplaceAll(h.String(), "-", "")), hex.EncodeToString(digest)),
+	}, nil
+}
+
+// kmsDigestHash returns the hash of the digest KMS signing algorithm
+// algorithm signs.
+func kmsDigestHash(algorithm string) (crypto.Hash, bool) {
+	if !strings.Contains(algorithm, "_SIGN_") {
+		return 0, false
+	}
+	switch {
+	case strings.HasSuffix(algorithm, "_SHA256"):
+		return crypto.SHA256, true
+	case strings.HasSuffix(algorithm, "_SHA384"):
+		return crypto.SHA384, true
+	case strings.HasSuffix(algorithm, "_SHA512"):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// kmsSign signs digest, a digest of hash h, with keyVersion. The integrity
+// of the request and of the response are checked with their CRC32C
+// checksums.
+func kmsSign(c KMSClient, keyVersion string, h crypto.Hash, digest []byte) ([]byte, DError) {
+	d := &cloudkms.Digest{}
+	enc := base64.StdEncoding.EncodeToString(digest)
+	switch h {
+	case crypto.SHA256:
+		d.Sha256 = enc
+	case crypto.SHA384:
+		d.Sha384 = enc
+	case crypto.SHA512:
+		d.Sha512 = enc
+	}
+	resp, err := c.AsymmetricSign(keyVersion, &cloudkms.AsymmetricSignRequest{Digest: d, DigestCrc32c: crc32c(digest)})
+	if err != nil {
+		return nil, typedErr(apiError, "failed to sign", err)
+	}
+	if !resp.VerifiedDigestCrc32c || resp.Name != keyVersion {
+		return nil, Errf("request corrupted in transit")
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil || crc32c(sig) != resp.SignatureCrc32c {
+		return nil, Errf("response corrupted in transit")
+	}
+	return sig, nil
+}
+
+func crc32c(b []byte) int64 {
+	return int64(crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+}
+
+// recordSignature adds sig to the signatures of the run.
+func (w *Workflow) recordSignature(sig *ArtifactSignature) {
+	root := w.root()
+	root.signaturesMx.Lock()
+	defer root.signaturesMx.Unlock()
+	root.signatures = append(root.signatures, *sig)
+}
+
+// Signatures returns the signatures the SignArtifacts steps of the run
+// uploaded, e.g. to list them in a provenance document.
+func (w *Workflow) Signatures() []ArtifactSignature {
+	root := w.root()
+	root.signaturesMx.Lock()
+	defer root.signaturesMx.Unlock()
+	return append([]ArtifactSignature{}, root.signatures...)
+}
@@ -0,0 +1,163 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+const testKeyVersion = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+
+// fakeKMSClient signs with a local P-256 key.
+type fakeKMSClient struct {
+	key       *ecdsa.PrivateKey
+	algorithm string
+	corrupt   bool
+}
+
+func (c *fakeKMSClient) GetPublicKey(name string) (*cloudkms.PublicKey, error) {
+	return &cloudkms.PublicKey{Name: name, Algorithm: c.algorithm}, nil
+}
+
+func (c *fakeKMSClient) AsymmetricSign(name string, req *cloudkms.AsymmetricSignRequest) (*cloudkms.AsymmetricSignResponse, error) {
+	digest, err := base64.StdEncoding.DecodeString(req.Digest.Sha256)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest)
+	if err != nil {
+		return nil, err
+	}
+	crc := crc32c(sig)
+	if c.corrupt {
+		crc++
+	}
+	return &cloudkms.AsymmetricSignResponse{
+		Name:                 name,
+		Signature:            base64.StdEncoding.EncodeToString(sig),
+		SignatureCrc32c:      crc,
+		VerifiedDigestCrc32c: req.DigestCrc32c == crc32c(digest),
+	}, nil
+}
+
+func TestSignArtifactsValidate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc    string
+		sa      *SignArtifacts
+		wantErr bool
+	}{
+		{"normal case", &SignArtifacts{KeyVersion: testKeyVersion, Artifacts: []string{"gs://bucket/image.mf"}}, false},
+		{"bad key version case", &SignArtifacts{KeyVersion: "projects/p/locations/global/keyRings/r/cryptoKeys/k", Artifacts: []string{"gs://bucket/image.mf"}}, true},
+		{"no artifacts case", &SignArtifacts{KeyVersion: testKeyVersion}, true},
+		{"bucket case", &SignArtifacts{KeyVersion: testKeyVersion, Artifacts: []string{"gs://bucket/"}}, true},
+		{"directory case", &SignArtifacts{KeyVersion: testKeyVersion, Artifacts: []string{"gs://bucket/dir/"}}, true},
+		{"signed twice case", &SignArtifacts{KeyVersion: testKeyVersion, Artifacts: []string{"gs://bucket/a", "gs://bucket/a"}}, true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{w: w}
+		tt.sa.populate(ctx, s)
+		if err := tt.sa.validate(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestSignArtifactsRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	fs := &FakeStorage{}
+	w.Storage = fs
+	s := &Step{name: "sign", w: w}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kms := &fakeKMSClient{key: key, algorithm: "EC_SIGN_P256_SHA256"}
+	w.KMSClient = kms
+	manifest := "image.tar.gz: sha256=abc\n"
+	fs.Put(ctx, "bucket", "out/image.mf", "text/plain", strings.NewReader(manifest))
+
+	sa := &SignArtifacts{KeyVersion: testKeyVersion, Artifacts: []string{"gs://bucket/out/image.mf"}}
+	sa.populate(ctx, s)
+	if err := sa.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sig, ok := fs.Object("bucket", "out/image.mf.sig")
+	if !ok {
+		t.Fatal("signature not uploaded")
+	}
+	digest := sha256.Sum256([]byte(manifest))
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Error("signature does not verify")
+	}
+	want := []ArtifactSignature{{
+		Step:       testWf + ".sign",
+		Artifact:   "gs://bucket/out/image.mf",
+		Signature:  "gs://bucket/out/image.mf.sig",
+		KeyVersion: testKeyVersion,
+		Algorithm:  "EC_SIGN_P256_SHA256",
+		Digest:     "sha256:" + hex.EncodeToString(digest[:]),
+	}}
+	if diffRes := diff(w.Signatures(), want, 0); diffRes != "" {
+		t.Errorf("signatures not as expected: (-got +want)\n%s", diffRes)
+	}
+
+	kms.corrupt = true
+	if err := sa.run(ctx, s); err == nil {
+		t.Error("expected error for a corrupted response")
+	}
+	kms.corrupt = false
+	sa.Artifacts = []string{"gs://bucket/missing"}
+	if err := sa.run(ctx, s); err == nil {
+		t.Error("expected error for a missing artifact")
+	}
+	kms.algorithm = "RSA_DECRYPT_OAEP_2048_SHA256"
+	if err := sa.run(ctx, s); err == nil || !strings.Contains(err.Error(), "SHA-2 digest") {
+		t.Errorf("expected error for a decryption key, got: %v", err)
+	}
+}
+
+func TestKMSDigestHash(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		want      string
+		ok        bool
+	}{
+		{"EC_SIGN_P256_SHA256", "SHA-256", true},
+		{"EC_SIGN_P384_SHA384", "SHA-384", true},
+		{"RSA_SIGN_PSS_4096_SHA512", "SHA-512", true},
+		{"RSA_SIGN_RAW_PKCS1_2048", "", false},
+		{"RSA_DECRYPT_OAEP_2048_SHA256", "", false},
+	}
+	for _, tt := range tests {
+		h, ok := kmsDigestHash(tt.algorithm)
+		if ok != tt.ok || (ok && h.String() != tt.want) {
+			t.Errorf("%s: got %v, %v, want %s, %v", tt.algorithm, h, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sync"
+)
+
+// SimulateMaintenanceEvents simulates host maintenance events on GCE
+// instances, which are live migrated or terminated as their scheduling says.
+type SimulateMaintenanceEvents struct {
+	Instances []string `json:",omitempty"`
+}
+
+func (st *SimulateMaintenanceEvents) populate(ctx context.Context, s *Step) DError {
+	for i, instance := range st.Instances {
+		if instanceURLRgx.MatchString(instance) {
+			st.Instances[i] = extendPartialURL(instance, s.project())
+		}
+	}
+	return nil
+}
+
+func (st *SimulateMaintenanceEvents) validate(ctx context.Context, s *Step) DError {
+	// Instance checking.
+	for _, i := range st.Instances {
+		if _, err := s.w.instances.regUse(i, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *SimulateMaintenanceEvents) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+
+	for _, i := range st.Instances {
+		wg.Add(1)
+		go func(i string) {
+			defer wg.Done()
+			res, ok := w.instances.get(i)
+			if !ok {
+				e <- Errf("instance %q does not exist in registry", i)
+				return
+			}
+			w.LogStepInfo(s.name, "SimulateMaintenanceEvents", "Simulating a host maintenance event on instance %q.", i)
+			m := NamedSubexp(instanceURLRgx, res.link)
+			if err := s.computeClient().SimulateMaintenanceEvent(m["project"], m["zone"], m["instance"]); err != nil {
+				e <- newErr("failed to simulate maintenance event", err)
+			}
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		wg.Wait()
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestSimulateMaintenanceEventsValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s, _ := w.NewStep("s")
+	iCreator, _ := w.NewStep("iCreator")
+	iCreator.CreateInstances = &CreateInstances{Instances: []*Instance{{}}}
+	w.AddDependency(s, iCreator)
+	if err := w.instances.regCreate("instance1", &Resource{link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)}, false, iCreator); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&SimulateMaintenanceEvents{Instances: []string{"instance1"}}).validate(ctx, s); err != nil {
+		t.Errorf("validation should not have failed: %v", err)
+	}
+
+	if err := (&SimulateMaintenanceEvents{Instances: []string{"dne"}}).validate(ctx, s); err == nil {
+		t.Error("SimulateMaintenanceEvents should have returned an error for an instance that DNE")
+	}
+}
+
+func TestSimulateMaintenanceEventsRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.populate(ctx)
+	s, _ := w.NewStep("s")
+	w.instances.m = map[string]*Resource{
+		"in0": {RealName: "i0", link: fmt.Sprintf("projects/%s/zones/%s/instances/i0", testProject, testZone)},
+		"in1": {RealName: "i1", link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+	var mx sync.Mutex
+	var got []string
+	w.ComputeClient.(*daisyCompute.TestClient).SimulateMaintenanceEventFn = func(project, zone, name string) error {
+		mx.Lock()
+		defer mx.Unlock()
+		got = append(got, fmt.Sprintf("%s/%s/%s", project, zone, name))
+		if name == "error" {
+			return errors.New("error")
+		}
+		return nil
+	}
+
+	if err := (&SimulateMaintenanceEvents{Instances: []string{"in0", "in1"}}).run(ctx, s); err != nil {
+		t.Fatalf("error running SimulateMaintenanceEvents.run(): %v", err)
+	}
+	sort.Strings(got)
+	want := []string{testProject + "/" + testZone + "/i0", testProject + "/" + testZone + "/i1"}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("instances do not match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	w.instances.m["error"] = &Resource{RealName: "error", link: fmt.Sprintf("projects/%s/zones/%s/instances/error", testProject, testZone)}
+	if err := (&SimulateMaintenanceEvents{Instances: []string{"error"}}).run(ctx, s); err == nil {
+		t.Error("SimulateMaintenanceEvents should have returned the error of the API")
+	}
+	if err := (&SimulateMaintenanceEvents{Instances: []string{"dne"}}).run(ctx, s); err == nil {
+		t.Error("SimulateMaintenanceEvents should have returned an error for an instance that DNE")
+	}
+}
@@ -27,7 +27,7 @@ type StopInstances struct {
 func (st *StopInstances) populate(ctx context.Context, s *Step) DError {
 	for i, instance := range st.Instances {
 		if instanceURLRgx.MatchString(instance) {
-			st.Instances[i] = extendPartialURL(instance, s.w.Project)
+			st.Instances[i] = extendPartialURL(instance, s.project())
 		}
 	}
 	return nil
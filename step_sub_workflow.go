@@ -16,6 +16,7 @@ package daisy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
@@ -24,6 +25,10 @@ type SubWorkflow struct {
 	Path     string
 	Vars     map[string]string `json:",omitempty"`
 	Workflow *Workflow         `json:",omitempty"`
+
+	// definition is the JSON of Workflow before it is populated, the
+	// workflow of each run of the Repeat of the step.
+	definition []byte
 }
 
 func (s *SubWorkflow) populate(ctx context.Context, st *Step) DError {
@@ -31,7 +36,7 @@ func (s *SubWorkflow) populate(ctx context.Context, st *Step) DError {
 	// Workflow could be nil when the parent workflow is constructed manually using Go structs.
 	if s.Path != "" && s.Workflow == nil {
 		var err error
-		if s.Workflow, err = st.w.NewSubWorkflowFromFile(s.Path); err != nil {
+		if s.Workflow, err = st.w.newSubWorkflowFromFile(ctx, s.Path); err != nil {
 			return ToDError(err)
 		}
 	}
@@ -40,23 +45,38 @@ func (s *SubWorkflow) populate(ctx context.Context, st *Step) DError {
 		return Errf("SubWorkflow %q does not have a workflow", st.name)
 	}
 
-	s.Workflow.parent = st.w
-	s.Workflow.GCSPath = fmt.Sprintf("gs://%s/%s", s.Workflow.parent.bucket, s.Workflow.parent.scratchPath)
-	s.Workflow.Name = st.name
-	s.Workflow.Project = s.Workflow.parent.Project
-	s.Workflow.Zone = s.Workflow.parent.Zone
-	s.Workflow.OAuthPath = s.Workflow.parent.OAuthPath
-	s.Workflow.ComputeClient = s.Workflow.parent.ComputeClient
-	s.Workflow.StorageClient = s.Workflow.parent.StorageClient
-	s.Workflow.Logger = s.Workflow.parent.Logger
-	s.Workflow.DefaultTimeout = st.Timeout
+	if st.Repeat != nil {
+		var err error
+		if s.definition, err = json.Marshal(s.Workflow); err != nil {
+			return newErr("failed to marshal SubWorkflow", err)
+		}
+	}
+	return s.populateWorkflow(ctx, st, s.Workflow)
+}
+
+// populateWorkflow populates sw, the workflow of s or of a run of its
+// Repeat.
+func (s *SubWorkflow) populateWorkflow(ctx context.Context, st *Step, sw *Workflow) DError {
+	sw.parent = st.w
+	sw.GCSPath = fmt.Sprintf("gs://%s/%s", sw.parent.bucket, sw.parent.scratchPath)
+	sw.Name = st.name
+	st.inheritEnv(sw)
+	sw.OAuthPath = sw.parent.OAuthPath
+	sw.ComputeClient = sw.parent.ComputeClient
+	sw.StorageClient = sw.parent.StorageClient
+	sw.LogReader = sw.parent.LogReader
+	sw.Storage = sw.parent.Storage
+	sw.SerialConsole = sw.parent.SerialConsole
+	sw.KMSClient = sw.parent.KMSClient
+	sw.Logger = sw.parent.Logger
+	sw.DefaultTimeout = st.Timeout
 
 	var errs DError
 Loop:
 	for k, v := range s.Vars {
-		for wv := range s.Workflow.Vars {
+		for wv := range sw.Vars {
 			if k == wv {
-				s.Workflow.AddVar(k, v)
+				sw.AddVar(k, v)
 				continue Loop
 			}
 		}
@@ -66,7 +86,7 @@ Loop:
 		return errs
 	}
 
-	return s.Workflow.populate(ctx)
+	return sw.populate(ctx)
 }
 
 func (s *SubWorkflow) validate(ctx context.Context, st *Step) DError {
@@ -74,15 +94,23 @@ func (s *SubWorkflow) validate(ctx context.Context, st *Step) DError {
 }
 
 func (s *SubWorkflow) run(ctx context.Context, st *Step) DError {
-	if err := s.Workflow.uploadSources(ctx); err != nil {
+	if st.Repeat != nil {
+		return s.runRepeat(ctx, st)
+	}
+	return s.runWorkflow(ctx, st, s.Workflow)
+}
+
+// runWorkflow runs sw, the workflow of s or of a run of its Repeat.
+func (s *SubWorkflow) runWorkflow(ctx context.Context, st *Step, sw *Workflow) DError {
+	if err := sw.uploadSources(ctx); err != nil {
 		return err
 	}
 
 	swCleanup := func() {
-		s.Workflow.LogWorkflowInfo("SubWorkflow %q cleaning up (this may take up to 2 minutes).", s.Workflow.Name)
-		for _, hook := range s.Workflow.cleanupHooks {
+		sw.LogWorkflowInfo("SubWorkflow %q cleaning up (this may take up to 2 minutes).", sw.Name)
+		for _, hook := range sw.cleanupHooks {
 			if err := hook(); err != nil {
-				s.Workflow.LogWorkflowInfo("Error returned from SubWorkflow cleanup hook: %s", err)
+				sw.LogWorkflowInfo("Error returned from SubWorkflow cleanup hook: %s", err)
 			}
 		}
 	}
@@ -97,9 +125,9 @@ func (s *SubWorkflow) run(ctx context.Context, st *Step) DError {
 	})
 
 	// Prerun work has already been done. Just run(), not Run().
-	st.w.LogStepInfo(st.name, "SubWorkflow", "Running subworkflow %q", s.Workflow.Name)
-	if err := s.Workflow.run(ctx); err != nil {
-		s.Workflow.LogStepInfo(st.name, "SubWorkflow", "Error running subworkflow %q: %v", s.Workflow.Name, err)
+	st.w.LogStepInfo(st.name, "SubWorkflow", "Running subworkflow %q", sw.Name)
+	if err := sw.run(ctx); err != nil {
+		sw.LogStepInfo(st.name, "SubWorkflow", "Error running subworkflow %q: %v", sw.Name, err)
 		return err
 	}
 	return nil
@@ -0,0 +1,156 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	bootTestStatusMatch  = "DaisyBootTest:"
+	bootTestSuccessMatch = "DaisyBootTest: ready"
+	bootTestFailureMatch = "DaisyBootTest: failed"
+
+	osFamilyLinux   = "linux"
+	osFamilyWindows = "windows"
+)
+
+// bootTestLinuxScript reports facts about a Linux guest, and fails if the
+// guest agent does not run within a minute. STEP is replaced by the step
+// name. Avoid ${} expansions, they would be taken for unresolved workflow
+// vars.
+const bootTestLinuxScript = `#!/bin/bash
+exec >/dev/console 2>&1
+kernel=$(uname -r)
+os=$(. /etc/os-release && echo "$PRETTY_NAME")
+agent=unknown
+if rpm -q google-guest-agent >/dev/null 2>&1; then
+  agent=$(rpm -q --qf '%{VERSION}-%{RELEASE}' google-guest-agent)
+elif dpkg-query -W google-guest-agent >/dev/null 2>&1; then
+  agent=$(dpkg-query -W google-guest-agent | awk '{print $2}')
+fi
+echo "DaisyBootTest: <serial-output key:'STEP-os' value:'$os'>"
+echo "DaisyBootTest: <serial-output key:'STEP-kernel' value:'$kernel'>"
+echo "DaisyBootTest: <serial-output key:'STEP-agent-version' value:'$agent'>"
+for i in $(seq 30); do
+  systemctl is-active --quiet google-guest-agent && break
+  sleep 2
+done
+if ! systemctl is-active --quiet google-guest-agent; then
+  echo "DaisyBootTest: failed: google-guest-agent is not running"
+  exit 1
+fi
+echo "DaisyBootTest: ready"
+`
+
+// bootTestWindowsScript is the PowerShell counterpart of bootTestLinuxScript.
+const bootTestWindowsScript = `$os = (Get-CimInstance Win32_OperatingSystem).Caption
+$kernel = [Environment]::OSVersion.Version.ToString()
+$agent = 'unknown'
+$agentExe = 'C:\Program Files\Google\Compute Engine\agent\GCEWindowsAgent.exe'
+if (Test-Path $agentExe) {
+  $agent = (Get-Item $agentExe).VersionInfo.ProductVersion
+}
+Write-Host "DaisyBootTest: <serial-output key:'STEP-os' value:'$os'>"
+Write-Host "DaisyBootTest: <serial-output key:'STEP-kernel' value:'$kernel'>"
+Write-Host "DaisyBootTest: <serial-output key:'STEP-agent-version' value:'$agent'>"
+for ($i = 0; $i -lt 30; $i++) {
+  if ((Get-Service GCEAgent -ErrorAction SilentlyContinue).Status -eq 'Running') { break }
+  Start-Sleep -Seconds 2
+}
+if ((Get-Service GCEAgent -ErrorAction SilentlyContinue).Status -ne 'Running') {
+  Write-Host "DaisyBootTest: failed: GCEAgent is not running"
+  exit 1
+}
+Write-Host "DaisyBootTest: ready"
+`
+
+// TestBootImage is a Daisy TestBootImage workflow step. It boots an instance
+// from Image, waits for the guest to report it is ready, failing if the guest
+// agent does not run, records the OS name,
+// kernel version and guest agent version as the serial-output values
+// "<step>-os", "<step>-kernel" and "<step>-agent-version", and deletes the
+// instance.
+type TestBootImage struct {
+	// Image to boot, the name of an image created in the workflow or a
+	// partial URL.
+	Image string
+	// OS family of the image, "linux" (default) or "windows".
+	OSFamily string `json:",omitempty"`
+	// Machine type of the test instance, defaults to n1-standard-1.
+	MachineType string `json:",omitempty"`
+
+	include *IncludeWorkflow
+}
+
+func (t *TestBootImage) populate(ctx context.Context, s *Step) DError {
+	t.OSFamily = strOr(t.OSFamily, osFamilyLinux)
+	if t.OSFamily != osFamilyLinux && t.OSFamily != osFamilyWindows {
+		return Errf("TestBootImage: unknown OSFamily %q, must be %q or %q", t.OSFamily, osFamilyLinux, osFamilyWindows)
+	}
+	if t.Image == "" {
+		return Errf("TestBootImage: no Image given")
+	}
+
+	name := resourceName(s.name)
+	md := map[string]string{}
+	if t.OSFamily == osFamilyWindows {
+		md["windows-startup-script-ps1"] = strings.Replace(bootTestWindowsScript, "STEP", s.name, -1)
+	} else {
+		md["startup-script"] = strings.Replace(bootTestLinuxScript, "STEP", s.name, -1)
+	}
+
+	iw := New()
+	create, _ := iw.NewStep("create")
+	create.CreateInstances = &CreateInstances{Instances: []*Instance{{
+		Instance: compute.Instance{
+			Name:        name,
+			MachineType: t.MachineType,
+			Disks: []*compute.AttachedDisk{{
+				AutoDelete:       true,
+				InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: t.Image},
+			}},
+		},
+		Metadata: md,
+	}}}
+	wait, _ := iw.NewStep("wait")
+	wait.WaitForInstancesSignal = &WaitForInstancesSignal{{
+		Name: name,
+		SerialOutput: &SerialOutput{
+			Port:         1,
+			SuccessMatch: bootTestSuccessMatch,
+			FailureMatch: FailureMatches{bootTestFailureMatch},
+			StatusMatch:  bootTestStatusMatch,
+		},
+	}}
+	del, _ := iw.NewStep("delete")
+	del.DeleteResources = &DeleteResources{Instances: []string{name}}
+	iw.AddDependency(wait, create)
+	iw.AddDependency(del, wait)
+
+	t.include = &IncludeWorkflow{Workflow: iw, workflowName: name}
+	return t.include.populate(ctx, s)
+}
+
+func (t *TestBootImage) validate(ctx context.Context, s *Step) DError {
+	return t.include.validate(ctx, s)
+}
+
+func (t *TestBootImage) run(ctx context.Context, s *Step) DError {
+	return t.include.run(ctx, s)
+}
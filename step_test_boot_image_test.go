@@ -0,0 +1,74 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTestBootImagePopulate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		desc      string
+		tb        *TestBootImage
+		mdKey     string
+		shouldErr bool
+	}{
+		{"linux case", &TestBootImage{Image: testImage, MachineType: testMachineType}, "startup-script", false},
+		{"windows case", &TestBootImage{Image: testImage, OSFamily: "windows"}, "windows-startup-script-ps1", false},
+		{"bad OSFamily case", &TestBootImage{Image: testImage, OSFamily: "bsd"}, "", true},
+		{"no image case", &TestBootImage{}, "", true},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("Boot_Test")
+		s.TestBootImage = tt.tb
+		err := w.populateStep(ctx, s)
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		iw := tt.tb.include.Workflow
+		if iw.parent != w {
+			t.Errorf("%s: boot test workflow should be included in the parent", tt.desc)
+		}
+		for _, name := range []string{"create", "wait", "delete"} {
+			if _, ok := iw.Steps[name]; !ok {
+				t.Errorf("%s: missing step %q", tt.desc, name)
+			}
+		}
+		i := iw.Steps["create"].CreateInstances.Instances[0]
+		if !strings.HasPrefix(i.Name, "boot-test-") || !rfc1035Rgx.MatchString(i.Name) {
+			t.Errorf("%s: unexpected instance name %q", tt.desc, i.Name)
+		}
+		if i.Disks[0].InitializeParams.SourceImage != testImage {
+			t.Errorf("%s: unexpected source image %q", tt.desc, i.Disks[0].InitializeParams.SourceImage)
+		}
+		script := i.Metadata[tt.mdKey]
+		if !strings.Contains(script, "key:'Boot_Test-kernel'") || !strings.Contains(script, bootTestSuccessMatch) || !strings.Contains(script, bootTestFailureMatch) {
+			t.Errorf("%s: unexpected boot test script %q", tt.desc, script)
+		}
+		if got := nestedWorkflow(s); got != iw {
+			t.Errorf("%s: nestedWorkflow should return the boot test workflow", tt.desc)
+		}
+	}
+}
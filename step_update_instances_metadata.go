@@ -18,16 +18,20 @@ import (
 	"context"
 	"sync"
 
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 	"google.golang.org/api/compute/v1"
 )
 
 // UpdateInstancesMetadata is a Daisy UpdateInstancesMetadata workflow step.
 type UpdateInstancesMetadata []*UpdateInstanceMetadata
 
-// UpdateInstanceMetadata is used to update an instance metadata.
+// UpdateInstanceMetadata is used to update an instance metadata. Keys not in
+// Metadata or RemoveKeys are left as they are.
 type UpdateInstanceMetadata struct {
-	// Metadata
+	// Metadata keys to set.
 	Metadata map[string]string `json:"metadata,omitempty"`
+	// Metadata keys to remove.
+	RemoveKeys []string `json:",omitempty"`
 
 	// Instance to attach to.
 	Instance      string
@@ -41,8 +45,13 @@ func (c *UpdateInstancesMetadata) populate(ctx context.Context, s *Step) DError
 
 func (c *UpdateInstancesMetadata) validate(ctx context.Context, s *Step) (errs DError) {
 	for _, sm := range *c {
-		if len(sm.Metadata) == 0 {
-			errs = addErrs(errs, Errf("Instance %v: Metadata must contain at least one value to update", sm.Instance))
+		if len(sm.Metadata) == 0 && len(sm.RemoveKeys) == 0 {
+			errs = addErrs(errs, Errf("Instance %v: Metadata or RemoveKeys must contain at least one value to update", sm.Instance))
+		}
+		for _, k := range sm.RemoveKeys {
+			if _, ok := sm.Metadata[k]; ok {
+				errs = addErrs(errs, Errf("Instance %v: metadata key %q is both set and removed", sm.Instance, k))
+			}
 		}
 
 		ir, err := s.w.instances.regUse(sm.Instance, s)
@@ -75,31 +84,13 @@ func (c *UpdateInstancesMetadata) run(ctx context.Context, s *Step) DError {
 				sm.Instance = instRes.RealName
 			}
 
-			// Get metadata fingerprint and original metadata
-			resp, err := w.ComputeClient.GetInstance(sm.project, sm.zone, sm.Instance)
+			prev, err := patchInstanceMetadata(s.computeClient(), sm.project, sm.zone, sm.Instance, sm.Metadata, sm.RemoveKeys)
 			if err != nil {
-				e <- newErr("failed to get instance data", err)
-				return
-			}
-			metadata := compute.Metadata{}
-			metadata.Fingerprint = resp.Metadata.Fingerprint
-			for k, v := range sm.Metadata {
-				vCopy := v
-				metadata.Items = append(metadata.Items, &compute.MetadataItems{Key: k, Value: &vCopy})
-			}
-
-			for _, item := range resp.Metadata.Items {
-				// Put only keys that were not updated
-				if _, ok := sm.Metadata[item.Key]; !ok {
-					metadata.Items = append(metadata.Items, item)
-				}
-			}
-
-			w.LogStepInfo(s.name, "UpdateInstancesMetadata", "Set Instance %q metadata to %q.", inst, sm.Metadata)
-			if err := w.ComputeClient.SetInstanceMetadata(sm.project, sm.zone, sm.Instance, &metadata); err != nil {
-				e <- newErr("failed to set instance metadata", err)
+				e <- err
 				return
 			}
+			w.LogStepInfo(s.name, "UpdateInstancesMetadata", "Updated Instance %q metadata.", inst)
+			w.recordChange(s, "UpdateInstancesMetadata", inst, metadataChanges(prev, sm.Metadata))
 		}(sm)
 	}
 
@@ -116,3 +107,28 @@ func (c *UpdateInstancesMetadata) run(ctx context.Context, s *Step) DError {
 		return nil
 	}
 }
+
+// SetInstanceMetadataEntries sets the entries given in the metadata of an
+// instance, leaving the other entries as they are. If the metadata changes
+// between reading and setting it, the update is retried on the new metadata.
+func SetInstanceMetadataEntries(c daisyCompute.Client, project, zone, instance string, entries map[string]string) DError {
+	_, err := patchInstanceMetadata(c, project, zone, instance, entries, nil)
+	return err
+}
+
+// DeleteInstanceMetadataEntries removes the entries with the keys given from
+// the metadata of an instance, like SetInstanceMetadataEntries.
+func DeleteInstanceMetadataEntries(c daisyCompute.Client, project, zone, instance string, keys []string) DError {
+	_, err := patchInstanceMetadata(c, project, zone, instance, nil, keys)
+	return err
+}
+
+// patchInstanceMetadata is PatchProjectMetadata for the metadata of an
+// instance.
+func patchInstanceMetadata(c daisyCompute.Client, project, zone, instance string, set map[string]string, remove []string) (map[string]*string, DError) {
+	var prev map[string]*string
+	err := updateMetadata(c, project, zone, instance, func(md *compute.Metadata) {
+		prev = patchMetadata(md, set, remove)
+	})
+	return prev, err
+}
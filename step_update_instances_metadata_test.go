@@ -3,11 +3,13 @@ package daisy
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 
 	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 )
 
 func TestUpdateInstancesMetadataValidate(t *testing.T) {
@@ -24,6 +26,8 @@ func TestUpdateInstancesMetadataValidate(t *testing.T) {
 		{"empty metadata case", &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{}}}, true},
 		{"bad instance case", &UpdateInstancesMetadata{{Instance: "bad", Metadata: map[string]string{"key": "value"}}}, true},
 		{"positive flow case", &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key": "value"}}}, false},
+		{"remove keys case", &UpdateInstancesMetadata{{Instance: testInstance, RemoveKeys: []string{"key"}}}, false},
+		{"set and removed case", &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key": "value"}, RemoveKeys: []string{"key"}}}, true},
 	}
 	for _, tt := range tests {
 		err := tt.sm.validate(ctx, s)
@@ -71,6 +75,7 @@ func TestUpdateInstancesMetadataRun(t *testing.T) {
 		{"blank case", map[string]string{}, map[string]string{}, &UpdateInstancesMetadata{}, false, nil, nil},
 		{"Add metadata case", map[string]string{"orig1": "value1"}, map[string]string{"orig1": "value1", "new1": "value2"}, &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"new1": "value2"}}}, false, nil, nil},
 		{"override metadata case", map[string]string{"key1": "value1"}, map[string]string{"key1": "value2"}, &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key1": "value2"}}}, false, nil, nil},
+		{"remove metadata case", map[string]string{"key1": "value1", "key2": "value2"}, map[string]string{"key1": "value3"}, &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key1": "value3"}, RemoveKeys: []string{"key2", "key3"}}}, false, nil, nil},
 		{"get instance error case", map[string]string{}, map[string]string{}, &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key1": "value1"}}}, true, Errf("error"), nil},
 		{"set metadata error case", map[string]string{}, map[string]string{"key1": "value1"}, &UpdateInstancesMetadata{{Instance: testInstance, Metadata: map[string]string{"key1": "value1"}}}, true, nil, Errf("error")},
 	}
@@ -95,3 +100,44 @@ func TestUpdateInstancesMetadataRun(t *testing.T) {
 		}
 	}
 }
+
+func TestInstanceMetadataEntries(t *testing.T) {
+	md := mapToComputeMetadata(map[string]string{"ssh-keys": "user:key", "enable-oslogin": "FALSE"})
+	md.Fingerprint = "1"
+	var sets int
+	c := &daisyCompute.TestClient{
+		GetInstanceFn: func(_, _, _ string) (*compute.Instance, error) {
+			cp := mapToComputeMetadata(computeMetataToMap(md))
+			cp.Fingerprint = md.Fingerprint
+			return &compute.Instance{Metadata: &cp}, nil
+		},
+		SetInstanceMetadataFn: func(_, _, _ string, got *compute.Metadata) error {
+			sets++
+			if sets == 1 {
+				// The guest changes its metadata meanwhile.
+				setMetadataValue(&md, "guest", "value")
+				md.Fingerprint = "2"
+			}
+			if got.Fingerprint != md.Fingerprint {
+				return &googleapi.Error{Code: http.StatusPreconditionFailed}
+			}
+			md = *got
+			return nil
+		},
+	}
+
+	if err := SetInstanceMetadataEntries(c, testProject, testZone, testInstance, map[string]string{"enable-oslogin": "TRUE"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"ssh-keys": "user:key", "enable-oslogin": "TRUE", "guest": "value"}
+	if diffRes := diff(computeMetataToMap(md), want, 0); diffRes != "" {
+		t.Errorf("metadata not as expected after set: (-got +want)\n%s", diffRes)
+	}
+	if err := DeleteInstanceMetadataEntries(c, testProject, testZone, testInstance, []string{"enable-oslogin"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	delete(want, "enable-oslogin")
+	if diffRes := diff(computeMetataToMap(md), want, 0); diffRes != "" {
+		t.Errorf("metadata not as expected after delete: (-got +want)\n%s", diffRes)
+	}
+}
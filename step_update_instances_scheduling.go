@@ -0,0 +1,134 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// UpdateInstancesScheduling is a Daisy UpdateInstancesScheduling workflow step.
+type UpdateInstancesScheduling []*UpdateInstanceScheduling
+
+// UpdateInstanceScheduling is used to update the scheduling options of an
+// instance. Options left unset are left as they are.
+type UpdateInstanceScheduling struct {
+	// What happens to the instance on host maintenance, MIGRATE or TERMINATE.
+	OnHostMaintenance string `json:",omitempty"`
+	// Whether the instance is restarted when it is terminated by Compute
+	// Engine, not by a user.
+	AutomaticRestart *bool `json:",omitempty"`
+
+	// Instance to update.
+	Instance            string
+	project, zone, name string
+}
+
+func (c *UpdateInstancesScheduling) populate(ctx context.Context, s *Step) DError {
+	return nil
+}
+
+func (c *UpdateInstancesScheduling) validate(ctx context.Context, s *Step) (errs DError) {
+	for _, us := range *c {
+		switch us.OnHostMaintenance {
+		case "", "MIGRATE", "TERMINATE":
+		default:
+			errs = addErrs(errs, Errf("Instance %v: OnHostMaintenance must be MIGRATE or TERMINATE, got %q", us.Instance, us.OnHostMaintenance))
+		}
+		if us.OnHostMaintenance == "" && us.AutomaticRestart == nil {
+			errs = addErrs(errs, Errf("Instance %v: OnHostMaintenance or AutomaticRestart must be set", us.Instance))
+		}
+
+		ir, err := s.w.instances.regUse(us.Instance, s)
+		if ir == nil {
+			// Return now, the rest of this function can't be run without ir.
+			return addErrs(errs, Errf("cannot set scheduling: %v", err))
+		}
+		errs = addErrs(errs, err)
+
+		// Set instance project, zone and name.
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		us.project, us.zone, us.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	return errs
+}
+
+func (c *UpdateInstancesScheduling) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	for _, us := range *c {
+		wg.Add(1)
+		go func(us *UpdateInstanceScheduling) {
+			defer wg.Done()
+
+			inst := us.Instance
+			if instRes, ok := w.instances.get(us.Instance); ok {
+				inst = instRes.link
+				instance := NamedSubexp(instanceURLRgx, instRes.link)
+				us.project, us.zone, us.name = instance["project"], instance["zone"], instance["instance"]
+			}
+
+			// SetScheduling replaces all the options, so the options left unset
+			// are kept from the current scheduling.
+			i, err := s.computeClient().GetInstance(us.project, us.zone, us.name)
+			if err != nil {
+				e <- newErr("failed to get instance", err)
+				return
+			}
+			sc := &compute.Scheduling{}
+			if i.Scheduling != nil {
+				copied := *i.Scheduling
+				sc = &copied
+			}
+			before, after := map[string]string{}, map[string]string{}
+			if us.OnHostMaintenance != "" {
+				before["onHostMaintenance"] = sc.OnHostMaintenance
+				sc.OnHostMaintenance = us.OnHostMaintenance
+				after["onHostMaintenance"] = sc.OnHostMaintenance
+			}
+			if us.AutomaticRestart != nil {
+				if sc.AutomaticRestart != nil {
+					before["automaticRestart"] = strconv.FormatBool(*sc.AutomaticRestart)
+				}
+				sc.AutomaticRestart = us.AutomaticRestart
+				after["automaticRestart"] = strconv.FormatBool(*sc.AutomaticRestart)
+			}
+
+			w.LogStepInfo(s.name, "UpdateInstancesScheduling", "Updating instance %q scheduling.", inst)
+			if err := s.computeClient().SetScheduling(us.project, us.zone, us.name, sc); err != nil {
+				e <- newErr("failed to set scheduling", err)
+				return
+			}
+			w.recordChange(s, "UpdateInstancesScheduling", inst, mapChanges("scheduling", before, after, true))
+		}(us)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		wg.Wait()
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestUpdateInstancesSchedulingValidate(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc    string
+		us      *UpdateInstanceScheduling
+		wantErr string
+	}{
+		{"on host maintenance case", &UpdateInstanceScheduling{Instance: "instance1", OnHostMaintenance: "TERMINATE"}, ""},
+		{"automatic restart case", &UpdateInstanceScheduling{Instance: "instance1", AutomaticRestart: func() *bool { b := false; return &b }()}, ""},
+		{"nothing to update case", &UpdateInstanceScheduling{Instance: "instance1"}, "must be set"},
+		{"bad on host maintenance case", &UpdateInstanceScheduling{Instance: "instance1", OnHostMaintenance: "RESTART"}, "must be MIGRATE or TERMINATE"},
+		{"instance DNE case", &UpdateInstanceScheduling{Instance: "dne", OnHostMaintenance: "MIGRATE"}, "cannot set scheduling"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s, _ := w.NewStep("s")
+		iCreator, _ := w.NewStep("iCreator")
+		iCreator.CreateInstances = &CreateInstances{Instances: []*Instance{{}}}
+		w.AddDependency(s, iCreator)
+		if err := w.instances.regCreate("instance1", &Resource{link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)}, false, iCreator); err != nil {
+			t.Fatal(err)
+		}
+
+		err := (&UpdateInstancesScheduling{tt.us}).validate(ctx, s)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			} else if tt.us.project != testProject || tt.us.zone != testZone || tt.us.name != "i" {
+				t.Errorf("%s: instance resolved to %s/%s/%s", tt.desc, tt.us.project, tt.us.zone, tt.us.name)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want error containing %q", tt.desc, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUpdateInstancesSchedulingRun(t *testing.T) {
+	ctx := context.Background()
+	yes, no := true, false
+	tests := []struct {
+		desc        string
+		current     *compute.Scheduling
+		us          *UpdateInstanceScheduling
+		want        *compute.Scheduling
+		wantChanges []string
+	}{
+		{
+			"on host maintenance case",
+			&compute.Scheduling{OnHostMaintenance: "MIGRATE", AutomaticRestart: &yes},
+			&UpdateInstanceScheduling{OnHostMaintenance: "TERMINATE"},
+			&compute.Scheduling{OnHostMaintenance: "TERMINATE", AutomaticRestart: &yes},
+			[]string{`scheduling "onHostMaintenance" changed: "MIGRATE" -> "TERMINATE"`},
+		},
+		{
+			"automatic restart case",
+			&compute.Scheduling{OnHostMaintenance: "MIGRATE", AutomaticRestart: &yes},
+			&UpdateInstanceScheduling{AutomaticRestart: &no},
+			&compute.Scheduling{OnHostMaintenance: "MIGRATE", AutomaticRestart: &no},
+			[]string{`scheduling "automaticRestart" changed: "true" -> "false"`},
+		},
+		{
+			"no scheduling case",
+			nil,
+			&UpdateInstanceScheduling{OnHostMaintenance: "MIGRATE", AutomaticRestart: &yes},
+			&compute.Scheduling{OnHostMaintenance: "MIGRATE", AutomaticRestart: &yes},
+			[]string{`scheduling "automaticRestart" added: "true"`, `scheduling "onHostMaintenance" changed: "" -> "MIGRATE"`},
+		},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.populate(ctx)
+		s, _ := w.NewStep("s")
+		w.instances.m = map[string]*Resource{
+			"in": {RealName: "i", link: fmt.Sprintf("projects/%s/zones/%s/instances/i", testProject, testZone)},
+		}
+		c := w.ComputeClient.(*daisyCompute.TestClient)
+		c.GetInstanceFn = func(_, _, name string) (*compute.Instance, error) {
+			return &compute.Instance{Name: name, Scheduling: tt.current}, nil
+		}
+		var got *compute.Scheduling
+		c.SetSchedulingFn = func(project, zone, name string, sc *compute.Scheduling) error {
+			if project != testProject || zone != testZone || name != "i" {
+				t.Errorf("%s: scheduling set on %s/%s/%s", tt.desc, project, zone, name)
+			}
+			got = sc
+			return nil
+		}
+
+		tt.us.Instance = "in"
+		if err := (&UpdateInstancesScheduling{tt.us}).run(ctx, s); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			continue
+		}
+		if diffRes := diff(got, tt.want, 0); diffRes != "" {
+			t.Errorf("%s: scheduling does not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+		var changes []string
+		for _, ch := range w.Changes() {
+			changes = append(changes, ch.Changes...)
+		}
+		if diffRes := diff(changes, tt.wantChanges, 0); diffRes != "" {
+			t.Errorf("%s: changes do not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+// UpdateProjectMetadata is a Daisy UpdateProjectMetadata workflow step. It
+// sets and removes keys of the common instance metadata of a project, leaving
+// the other keys, such as the project-wide ssh-keys, as they are. Unless
+// NoCleanup is set, the changed keys are restored when the workflow finishes.
+type UpdateProjectMetadata struct {
+	// Project to update, defaults to the step's project.
+	Project string `json:",omitempty"`
+	// Metadata keys to set.
+	Metadata map[string]string `json:",omitempty"`
+	// Metadata keys to remove.
+	RemoveKeys []string `json:",omitempty"`
+	// Keep the changes when the workflow finishes.
+	NoCleanup bool `json:",omitempty"`
+}
+
+func (u *UpdateProjectMetadata) populate(ctx context.Context, s *Step) DError {
+	u.Project = strOr(u.Project, s.project())
+	return nil
+}
+
+func (u *UpdateProjectMetadata) validate(ctx context.Context, s *Step) (errs DError) {
+	if len(u.Metadata) == 0 && len(u.RemoveKeys) == 0 {
+		errs = addErrs(errs, Errf("UpdateProjectMetadata: nothing to update for project %q", u.Project))
+	}
+	for _, k := range u.RemoveKeys {
+		if _, ok := u.Metadata[k]; ok {
+			errs = addErrs(errs, Errf("UpdateProjectMetadata: key %q is both set and removed", k))
+		}
+	}
+	return errs
+}
+
+func (u *UpdateProjectMetadata) run(ctx context.Context, s *Step) DError {
+	w := s.w
+	prev, err := PatchProjectMetadata(s.computeClient(), u.Project, u.Metadata, u.RemoveKeys)
+	if err != nil {
+		return err
+	}
+	w.recordChange(s, "UpdateProjectMetadata", "projects/"+u.Project, metadataChanges(prev, u.Metadata))
+
+	if u.NoCleanup || len(prev) == 0 {
+		return nil
+	}
+	w.root().addCleanupHook(func() DError {
+		restore := map[string]string{}
+		var remove []string
+		for k, v := range prev {
+			if v == nil {
+				remove = append(remove, k)
+			} else {
+				restore[k] = *v
+			}
+		}
+		_, err := PatchProjectMetadata(s.computeClient(), u.Project, restore, remove)
+		return err
+	})
+	return nil
+}
+
+// PatchProjectMetadata sets and removes keys of the common instance metadata
+// of project, leaving the other keys as they are. If the metadata changes
+// between reading and setting it, the update is retried on the new metadata.
+// It returns the previous values of the keys changed, nil for keys that were
+// not set.
+func PatchProjectMetadata(c daisyCompute.Client, project string, set map[string]string, remove []string) (map[string]*string, DError) {
+	var prev map[string]*string
+	err := updateMetadata(c, project, "", "", func(md *compute.Metadata) {
+		prev = patchMetadata(md, set, remove)
+	})
+	return prev, err
+}
+
+// patchMetadata sets and removes keys of md, returning the previous values of
+// the keys changed, nil for keys that were not set.
+func patchMetadata(md *compute.Metadata, set map[string]string, remove []string) map[string]*string {
+	prev := map[string]*string{}
+	save := func(k string) {
+		prev[k] = nil
+		if v, ok := metadataItem(md, k); ok {
+			prev[k] = &v
+		}
+	}
+	for k, v := range set {
+		if old, ok := metadataItem(md, k); ok && old == v {
+			continue
+		}
+		save(k)
+		setMetadataValue(md, k, v)
+	}
+	for _, k := range remove {
+		if _, ok := metadataItem(md, k); !ok {
+			continue
+		}
+		save(k)
+		deleteMetadataItem(md, k)
+	}
+	return prev
+}
+
+// metadataChanges describes the changes of a patchMetadata call given the
+// previous values it returned and the keys set.
+func metadataChanges(prev map[string]*string, set map[string]string) []string {
+	before, after := map[string]string{}, map[string]string{}
+	for k, v := range prev {
+		if v != nil {
+			before[k] = *v
+		}
+		if nv, ok := set[k]; ok {
+			after[k] = nv
+		}
+	}
+	return mapChanges("metadata", before, after, false)
+}
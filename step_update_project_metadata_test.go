@@ -0,0 +1,102 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestUpdateProjectMetadataValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+
+	tests := []struct {
+		desc    string
+		u       *UpdateProjectMetadata
+		wantErr bool
+	}{
+		{"set case", &UpdateProjectMetadata{Metadata: map[string]string{"k": "v"}}, false},
+		{"remove case", &UpdateProjectMetadata{RemoveKeys: []string{"k"}}, false},
+		{"nothing to update case", &UpdateProjectMetadata{}, true},
+		{"set and removed case", &UpdateProjectMetadata{Metadata: map[string]string{"k": "v"}, RemoveKeys: []string{"k"}}, true},
+	}
+	for _, tt := range tests {
+		tt.u.populate(ctx, s)
+		if tt.u.Project != testProject {
+			t.Errorf("%s: Project not populated: %q", tt.desc, tt.u.Project)
+		}
+		if err := tt.u.validate(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestUpdateProjectMetadataRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+
+	projectMd := mapToComputeMetadata(map[string]string{sshKeysMetadataKey: "user:key", "remove": "me", "change": "old"})
+	projectMd.Fingerprint = "1"
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetProjectFn = func(_ string) (*compute.Project, error) {
+		md := mapToComputeMetadata(computeMetataToMap(projectMd))
+		md.Fingerprint = projectMd.Fingerprint
+		return &compute.Project{CommonInstanceMetadata: &md}, nil
+	}
+	var sets int
+	c.SetCommonInstanceMetadataFn = func(_ string, md *compute.Metadata) error {
+		sets++
+		if sets == 1 {
+			// Another client adds a key meanwhile.
+			setMetadataValue(&projectMd, "concurrent", "value")
+			projectMd.Fingerprint = "2"
+		}
+		if md.Fingerprint != projectMd.Fingerprint {
+			return &googleapi.Error{Code: http.StatusPreconditionFailed}
+		}
+		projectMd = *md
+		return nil
+	}
+
+	u := &UpdateProjectMetadata{Metadata: map[string]string{"change": "new", "add": "v"}, RemoveKeys: []string{"remove", "missing"}}
+	u.populate(ctx, s)
+	if err := u.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sets != 2 {
+		t.Errorf("expected a retry after the concurrent change, got %d sets", sets)
+	}
+	checkMd := func(desc string, want map[string]string) {
+		if diffRes := diff(computeMetataToMap(projectMd), want, 0); diffRes != "" {
+			t.Errorf("%s: metadata not as expected: (-got +want)\n%s", desc, diffRes)
+		}
+	}
+	checkMd("after run", map[string]string{sshKeysMetadataKey: "user:key", "change": "new", "add": "v", "concurrent": "value"})
+
+	for _, hook := range w.cleanupHooks {
+		if err := hook(); err != nil {
+			t.Errorf("unexpected cleanup error: %v", err)
+		}
+	}
+	checkMd("after cleanup", map[string]string{sshKeysMetadataKey: "user:key", "remove": "me", "change": "old", "concurrent": "value"})
+}
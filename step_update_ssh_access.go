@@ -0,0 +1,276 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	sshKeysMetadataKey = "ssh-keys"
+	osLoginMetadataKey = "enable-oslogin"
+	metadataValueTrue  = "TRUE"
+	metadataValueFalse = "FALSE"
+)
+
+// UpdateSSHAccess is a Daisy UpdateSSHAccess workflow step.
+type UpdateSSHAccess []*SSHAccess
+
+// SSHAccess adds or removes SSH keys and toggles OS Login on an instance, or
+// on the project if Instance is not set. Unless NoCleanup is set, added keys
+// are removed, removed keys are added back and OS Login is restored when the
+// workflow finishes.
+type SSHAccess struct {
+	// Instance to update, if unset the project metadata is updated.
+	Instance string `json:",omitempty"`
+	// SSH keys to add, in the "USERNAME:KEY" format used by the ssh-keys
+	// metadata key.
+	AddKeys []string `json:",omitempty"`
+	// SSH keys to remove, in the same format as AddKeys.
+	RemoveKeys []string `json:",omitempty"`
+	// Enable or disable OS Login, left as is if unset.
+	EnableOSLogin *bool `json:",omitempty"`
+	// Keep the changes when the workflow finishes.
+	NoCleanup bool `json:",omitempty"`
+
+	project, zone, name string
+}
+
+func (u *UpdateSSHAccess) populate(ctx context.Context, s *Step) DError {
+	return nil
+}
+
+func (u *UpdateSSHAccess) validate(ctx context.Context, s *Step) (errs DError) {
+	for _, sa := range *u {
+		if len(sa.AddKeys) == 0 && len(sa.RemoveKeys) == 0 && sa.EnableOSLogin == nil {
+			errs = addErrs(errs, Errf("UpdateSSHAccess: nothing to update for %q", sa.Instance))
+		}
+		for _, k := range append(append([]string{}, sa.AddKeys...), sa.RemoveKeys...) {
+			if !strings.Contains(k, ":") {
+				errs = addErrs(errs, Errf("UpdateSSHAccess: SSH key %q must be in the USERNAME:KEY format", k))
+			}
+		}
+		if sa.Instance == "" {
+			sa.project = s.project()
+			continue
+		}
+		ir, err := s.w.instances.regUse(sa.Instance, s)
+		if ir == nil {
+			return addErrs(errs, Errf("cannot update SSH access: %v", err))
+		}
+		errs = addErrs(errs, err)
+		instance := NamedSubexp(instanceURLRgx, ir.link)
+		sa.project, sa.zone, sa.name = instance["project"], instance["zone"], instance["instance"]
+	}
+	return errs
+}
+
+func (u *UpdateSSHAccess) run(ctx context.Context, s *Step) DError {
+	var wg sync.WaitGroup
+	w := s.w
+	e := make(chan DError)
+	for _, sa := range *u {
+		wg.Add(1)
+		go func(sa *SSHAccess) {
+			defer wg.Done()
+			if sa.Instance != "" {
+				if ir, ok := w.instances.get(sa.Instance); ok {
+					instance := NamedSubexp(instanceURLRgx, ir.link)
+					sa.project, sa.zone, sa.name = instance["project"], instance["zone"], instance["instance"]
+				}
+			}
+
+			var added, removed []string
+			var prevOSLogin string
+			var hadOSLogin bool
+			err := updateMetadata(s.computeClient(), sa.project, sa.zone, sa.name, func(md *compute.Metadata) {
+				added, removed = updateSSHKeys(md, sa.AddKeys, sa.RemoveKeys)
+				if sa.EnableOSLogin != nil {
+					prevOSLogin, hadOSLogin = metadataItem(md, osLoginMetadataKey)
+					value := metadataValueFalse
+					if *sa.EnableOSLogin {
+						value = metadataValueTrue
+					}
+					setMetadataValue(md, osLoginMetadataKey, value)
+				}
+			})
+			if err != nil {
+				e <- err
+				return
+			}
+			w.LogStepInfo(s.name, "UpdateSSHAccess", "Updated SSH access for %s.", sa.target())
+
+			if sa.NoCleanup || (len(added) == 0 && len(removed) == 0 && sa.EnableOSLogin == nil) {
+				return
+			}
+			w.root().addCleanupHook(func() DError {
+				if sa.Instance != "" {
+					// Nothing to restore if the instance is gone.
+					if ir, ok := w.instances.get(sa.Instance); ok && ir.deleted {
+						return nil
+					}
+				}
+				return updateMetadata(s.computeClient(), sa.project, sa.zone, sa.name, func(md *compute.Metadata) {
+					updateSSHKeys(md, removed, added)
+					if sa.EnableOSLogin == nil {
+						return
+					}
+					if hadOSLogin {
+						setMetadataValue(md, osLoginMetadataKey, prevOSLogin)
+					} else {
+						deleteMetadataItem(md, osLoginMetadataKey)
+					}
+				})
+			})
+		}(sa)
+	}
+
+	go func() {
+		wg.Wait()
+		e <- nil
+	}()
+
+	select {
+	case err := <-e:
+		return err
+	case <-w.Cancel:
+		wg.Wait()
+		return nil
+	}
+}
+
+func (sa *SSHAccess) target() string {
+	if sa.name == "" {
+		return "project " + sa.project
+	}
+	return "instance " + sa.name
+}
+
+// updateSSHKeys adds and removes keys from the ssh-keys metadata, returning
+// the keys that were not already present and the keys that were removed.
+func updateSSHKeys(md *compute.Metadata, add, remove []string) (added, removed []string) {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, nil
+	}
+	keys := filter(strings.Split(metadataValue(md, sshKeysMetadataKey), "\n"), "")
+	for _, k := range add {
+		if !strIn(k, keys) {
+			keys = append(keys, k)
+			added = append(added, k)
+		}
+	}
+	for _, k := range remove {
+		if strIn(k, keys) {
+			keys = filter(keys, k)
+			removed = append(removed, k)
+		}
+	}
+	if len(keys) == 0 {
+		deleteMetadataItem(md, sshKeysMetadataKey)
+	} else {
+		setMetadataValue(md, sshKeysMetadataKey, strings.Join(keys, "\n"))
+	}
+	return added, removed
+}
+
+// maxMetadataAttempts is how many times updateMetadata tries to set metadata
+// changed concurrently.
+const maxMetadataAttempts = 5
+
+// updateMetadata applies f to the metadata of an instance, or to the common
+// instance metadata of the project if name is empty. The metadata is set with
+// the fingerprint it was read with; if it changed meanwhile, f is applied
+// again to the new metadata, so concurrent changes are not clobbered.
+func updateMetadata(c daisyCompute.Client, project, zone, name string, f func(md *compute.Metadata)) DError {
+	for attempt := 1; ; attempt++ {
+		md := &compute.Metadata{}
+		var err error
+		if name == "" {
+			p, gErr := c.GetProject(project)
+			if gErr != nil {
+				return typedErr(apiError, "failed to get project", gErr)
+			}
+			if p != nil && p.CommonInstanceMetadata != nil {
+				md = p.CommonInstanceMetadata
+			}
+			f(md)
+			err = c.SetCommonInstanceMetadata(project, md)
+		} else {
+			inst, gErr := c.GetInstance(project, zone, name)
+			if gErr != nil {
+				return typedErr(apiError, "failed to get instance data", gErr)
+			}
+			if inst.Metadata != nil {
+				md = inst.Metadata
+			}
+			f(md)
+			err = c.SetInstanceMetadata(project, zone, name, md)
+		}
+		if err == nil {
+			return nil
+		}
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusPreconditionFailed && attempt < maxMetadataAttempts {
+			continue
+		}
+		if name == "" {
+			return typedErr(apiError, "failed to set project metadata", err)
+		}
+		return typedErr(apiError, "failed to set instance metadata", err)
+	}
+}
+
+func metadataItem(md *compute.Metadata, key string) (string, bool) {
+	for _, item := range md.Items {
+		if item.Key == key {
+			if item.Value == nil {
+				return "", true
+			}
+			return *item.Value, true
+		}
+	}
+	return "", false
+}
+
+func metadataValue(md *compute.Metadata, key string) string {
+	v, _ := metadataItem(md, key)
+	return v
+}
+
+func setMetadataValue(md *compute.Metadata, key, value string) {
+	for _, item := range md.Items {
+		if item.Key == key {
+			item.Value = &value
+			return
+		}
+	}
+	md.Items = append(md.Items, &compute.MetadataItems{Key: key, Value: &value})
+}
+
+func deleteMetadataItem(md *compute.Metadata, key string) {
+	var items []*compute.MetadataItems
+	for _, item := range md.Items {
+		if item.Key != key {
+			items = append(items, item)
+		}
+	}
+	md.Items = items
+}
@@ -0,0 +1,103 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestUpdateSSHAccessValidate(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+	enable := true
+
+	tests := []struct {
+		desc    string
+		u       *UpdateSSHAccess
+		wantErr bool
+	}{
+		{"instance case", &UpdateSSHAccess{{Instance: testInstance, AddKeys: []string{"user:ssh-rsa AAAA"}}}, false},
+		{"project case", &UpdateSSHAccess{{EnableOSLogin: &enable}}, false},
+		{"nothing to update case", &UpdateSSHAccess{{Instance: testInstance}}, true},
+		{"bad key case", &UpdateSSHAccess{{Instance: testInstance, RemoveKeys: []string{"ssh-rsa AAAA"}}}, true},
+		{"bad instance case", &UpdateSSHAccess{{Instance: "bad", AddKeys: []string{"user:ssh-rsa AAAA"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.u.validate(ctx, s); (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestUpdateSSHAccessRun(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{testInstance: {Project: testProject, RealName: testInstance, link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, testInstance)}}
+
+	instanceMd := mapToComputeMetadata(map[string]string{sshKeysMetadataKey: "old:key\nremove:key", "foo": "bar"})
+	projectMd := mapToComputeMetadata(map[string]string{osLoginMetadataKey: metadataValueFalse})
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetInstanceFn = func(_, _, _ string) (*compute.Instance, error) {
+		return &compute.Instance{Metadata: &instanceMd}, nil
+	}
+	c.SetInstanceMetadataFn = func(_, _, _ string, md *compute.Metadata) error {
+		instanceMd = *md
+		return nil
+	}
+	c.GetProjectFn = func(_ string) (*compute.Project, error) {
+		return &compute.Project{CommonInstanceMetadata: &projectMd}, nil
+	}
+	c.SetCommonInstanceMetadataFn = func(_ string, md *compute.Metadata) error {
+		projectMd = *md
+		return nil
+	}
+
+	enable := true
+	u := &UpdateSSHAccess{
+		{Instance: testInstance, AddKeys: []string{"new:key", "old:key"}, RemoveKeys: []string{"remove:key"}},
+		{EnableOSLogin: &enable},
+	}
+	if err := u.validate(ctx, s); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if err := u.run(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkMd := func(desc string, got compute.Metadata, want map[string]string) {
+		if diffRes := diff(computeMetataToMap(got), want, 0); diffRes != "" {
+			t.Errorf("%s: metadata not as expected: (-got +want)\n%s", desc, diffRes)
+		}
+	}
+	checkMd("instance", instanceMd, map[string]string{sshKeysMetadataKey: "old:key\nnew:key", "foo": "bar"})
+	checkMd("project", projectMd, map[string]string{osLoginMetadataKey: metadataValueTrue})
+
+	// Cleanup removes the added keys, adds back the removed ones and restores
+	// OS Login.
+	for _, hook := range w.cleanupHooks {
+		if err := hook(); err != nil {
+			t.Errorf("unexpected cleanup error: %v", err)
+		}
+	}
+	checkMd("instance after cleanup", instanceMd, map[string]string{sshKeysMetadataKey: "old:key\nremove:key", "foo": "bar"})
+	checkMd("project after cleanup", projectMd, map[string]string{osLoginMetadataKey: metadataValueFalse})
+}
@@ -15,9 +15,12 @@
 package daisy
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 	"sync"
@@ -30,6 +33,11 @@ const (
 	defaultInterval           = "10s"
 	defaultGuestAttrNamespace = "daisy"
 	defaultGuestAttrKeyName   = "DaisyResult"
+
+	// The Google guest agent publishes this guest attribute once it is
+	// initialized, on Linux and Windows.
+	guestAgentReadyNamespace = "guest-agent"
+	guestAgentReadyKeyName   = "ready"
 )
 
 var (
@@ -68,11 +76,37 @@ func (fms *FailureMatches) UnmarshalJSON(b []byte) error {
 // A StatusMatch will print out the matching line from the StatusMatch onward.
 // This step will not complete until a line in the serial output matches
 // SuccessMatch or FailureMatch. A match with FailureMatch will cause the step to fail.
+// If AbsentMatch or AbsentMatchRegex is set, the serial output is watched for
+// AbsentWindow after SuccessMatch is found, and a match with AbsentMatch or
+// AbsentMatchRegex will cause the step to fail.
+// If StallTimeout is set and no new serial output is produced within it, the
+// step fails, or only logs a warning if StallWarnOnly is set.
+// If ContextLines is set, up to that many lines before and after a
+// SuccessMatch, FailureMatch or AbsentMatch are logged or added to the error.
+// On a SuccessMatch, FailureMatch or AbsentMatch, all the serial output read
+// so far is saved to the logs of the workflow, as boot output may no longer be
+// retrievable from the instance afterwards.
 type SerialOutput struct {
 	Port         int64          `json:",omitempty"`
 	SuccessMatch string         `json:",omitempty"`
 	FailureMatch FailureMatches `json:"failureMatch,omitempty"`
 	StatusMatch  string         `json:",omitempty"`
+	AbsentMatch  FailureMatches `json:",omitempty"`
+	// Regular expressions, as AbsentMatch, parsable by
+	// https://golang.org/pkg/regexp/syntax/.
+	AbsentMatchRegex FailureMatches `json:",omitempty"`
+	absentMatchRegex []*regexp.Regexp
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	AbsentWindow string `json:",omitempty"`
+	absentWindow time.Duration
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	StallTimeout  string `json:",omitempty"`
+	stallTimeout  time.Duration
+	StallWarnOnly bool  `json:",omitempty"`
+	ContextLines  int64 `json:",omitempty"`
+
+	// onStatus, if set, is called with each status found by StatusMatch.
+	onStatus func(status string)
 }
 
 // GuestAttribute describes text signal strings that will be written to guest
@@ -88,21 +122,91 @@ type GuestAttribute struct {
 
 // InstanceSignal waits for a signal from an instance.
 type InstanceSignal struct {
-	// Instance name to wait for.
+	// Instance name to wait for, or the partial URL of an instance created
+	// outside of the workflow, e.g. zones/z/instances/i. Instances given by
+	// URL are not looked up in the workflow resources and only need to exist
+	// once the step runs.
 	Name string
-	// Interval to check for signal (default is 5s).
+	// Interval to check for signal. Defaults to the PollingIntervals of the
+	// workflow for the kind of signal, or 10s. Signals of several kinds
+	// default to the interval of their serial output, then guest attributes.
 	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
 	Interval string `json:",omitempty"`
 	interval time.Duration
 	// Wait for the instance to stop.
 	Stopped bool `json:",omitempty"`
+	// Wait for the Google guest agent to be initialized, not only for the
+	// instance to boot. This polls the guest attribute the agent publishes
+	// once started, guest attributes must be enabled on the instance.
+	GuestAgentReady bool `json:",omitempty"`
 	// Wait for a string match in the serial output.
 	SerialOutput *SerialOutput `json:",omitempty"`
+	// Wait for string matches in several serial ports, each with its own
+	// matches, along with SerialOutput. The signal is received once all the
+	// ports with a SuccessMatch matched. A list given as SerialOutput is
+	// unmarshalled into SerialOutputs.
+	SerialOutputs []*SerialOutput `json:",omitempty"`
 	// Wait for a key or value match in guest attributes.
 	GuestAttribute *GuestAttribute `json:",omitempty"`
+	// Wait for a string match in the logs the Ops Agent sends to Cloud
+	// Logging, for images where the serial console is disabled.
+	OpsAgentLog *OpsAgentLog `json:",omitempty"`
+	// Wait for Windows setup states reported by the JSON records GCE Windows
+	// agents write to serial ports 3 and 4.
+	WindowsSetup *WindowsSetup `json:",omitempty"`
+	// Fail if the guest does not update the daisy/heartbeat guest attribute
+	// for this long, see daisy_heartbeat and Start-DaisyHeartbeat. Until the
+	// first heartbeat, the time is counted from the start of the wait.
+	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
+	HeartbeatTimeout string `json:",omitempty"`
+	heartbeatTimeout time.Duration
+	// Absolute guest paths to collect once the wait ends, successfully or
+	// not. The startup script harness uploads them when its script ends and
+	// announces them in the daisy-artifacts guest attributes, where guests
+	// can announce GCS URLs of their own too. Announced artifacts are copied
+	// to the scratch bucket and listed in the Artifacts of the workflow.
+	// Requires guest attributes to be enabled on the instance.
+	CollectArtifacts []string `json:",omitempty"`
+}
+
+// UnmarshalJSON unmarshals an InstanceSignal, whose SerialOutput can be a
+// list.
+func (is *InstanceSignal) UnmarshalJSON(b []byte) error {
+	type signal InstanceSignal
+	var aux struct {
+		signal
+		SerialOutput json.RawMessage
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	*is = InstanceSignal(aux.signal)
+	so := bytes.TrimSpace(aux.SerialOutput)
+	if len(so) == 0 || bytes.Equal(so, []byte("null")) {
+		return nil
+	}
+	if so[0] != '[' {
+		return json.Unmarshal(so, &is.SerialOutput)
+	}
+	var sos []*SerialOutput
+	if err := json.Unmarshal(so, &sos); err != nil {
+		return err
+	}
+	is.SerialOutputs = append(sos, is.SerialOutputs...)
+	return nil
 }
 
-func waitForInstanceStopped(s *Step, project, zone, name string, interval time.Duration) DError {
+// serialOutputs returns the SerialOutput and SerialOutputs of is.
+func (is *InstanceSignal) serialOutputs() []*SerialOutput {
+	if is.SerialOutput == nil {
+		return is.SerialOutputs
+	}
+	return append([]*SerialOutput{is.SerialOutput}, is.SerialOutputs...)
+}
+
+// waitForInstanceStopped waits for an instance to stop. It returns nil when
+// done is closed.
+func waitForInstanceStopped(s *Step, project, zone, name string, interval time.Duration, done <-chan struct{}) DError {
 	w := s.w
 	w.LogStepInfo(s.name, "WaitForInstancesSignal", "Waiting for instance %q to stop.", name)
 	tick := time.Tick(interval)
@@ -110,6 +214,8 @@ func waitForInstanceStopped(s *Step, project, zone, name string, interval time.D
 		select {
 		case <-s.w.Cancel:
 			return nil
+		case <-done:
+			return nil
 		case <-tick:
 			stopped, err := s.w.ComputeClient.InstanceStopped(project, zone, name)
 			if err != nil {
@@ -123,7 +229,9 @@ func waitForInstanceStopped(s *Step, project, zone, name string, interval time.D
 	}
 }
 
-func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput, interval time.Duration) DError {
+// waitForSerialOutput watches serial port so.Port of an instance until a match
+// ends the watch. It returns nil when done is closed.
+func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput, interval time.Duration, done <-chan struct{}) DError {
 	w := s.w
 	msg := fmt.Sprintf("Instance %q: watching serial port %d", name, so.Port)
 	if so.SuccessMatch != "" {
@@ -135,15 +243,40 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 	if so.StatusMatch != "" {
 		msg += fmt.Sprintf(", StatusMatch: %q", so.StatusMatch)
 	}
+	if len(so.AbsentMatch) > 0 {
+		msg += fmt.Sprintf(", AbsentMatch: %q for %s", so.AbsentMatch, so.absentWindow)
+	}
+	if len(so.AbsentMatchRegex) > 0 {
+		msg += fmt.Sprintf(", AbsentMatchRegex: %q for %s", so.AbsentMatchRegex, so.absentWindow)
+	}
+	if so.stallTimeout > 0 {
+		msg += fmt.Sprintf(", StallTimeout: %s", so.stallTimeout)
+	}
 	w.LogStepInfo(s.name, "WaitForInstancesSignal", msg+".")
 	var start int64
 	var errs int
 	tailString := ""
 	tick := time.Tick(interval)
+	// absentDone is set once SuccessMatch is found and AbsentMatch is being
+	// watched for.
+	var absentDone <-chan time.Time
+	lastOutput := time.Now()
+	// recent holds the last ContextLines lines seen.
+	var recent []string
+	// output holds the output read, saved on a match.
+	output := newSerialLog(w, serialLogObject(s, name, so.Port), func(format string, a ...interface{}) {
+		w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: "+format, append([]interface{}{name}, a...)...)
+	})
+	defer output.close()
 	for {
 		select {
 		case <-s.w.Cancel:
 			return nil
+		case <-done:
+			return nil
+		case <-absentDone:
+			w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: no AbsentMatch found within %s", name, so.absentWindow)
+			return nil
 		case <-tick:
 			resp, err := w.ComputeClient.GetSerialPortOutput(project, zone, name, so.Port, start)
 			if err != nil {
@@ -156,6 +289,7 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 
 				// Wait until machine restarts to evaluate SerialOutput.
 				if status == "TERMINATED" || status == "STOPPED" || status == "STOPPING" {
+					lastOutput = time.Now()
 					continue
 				}
 
@@ -168,16 +302,39 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 				return Errf("WaitForInstancesSignal: instance %q: error getting serial port: %v", name, err)
 			}
 			start = resp.Next
+			output.WriteString(resp.Contents)
+			if resp.Contents != "" {
+				lastOutput = time.Now()
+				w.recordSerialActivity(project, zone, name)
+			} else if so.stallTimeout > 0 && time.Since(lastOutput) > so.stallTimeout {
+				if !so.StallWarnOnly {
+					return Errf("WaitForInstancesSignal: instance %q: no serial output for %s", name, so.stallTimeout)
+				}
+				w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: no serial output for %s", name, so.stallTimeout)
+				lastOutput = time.Now()
+			}
 			lines := strings.Split(resp.Contents, "\n")
-			for i, ln := range lines {
+			// matchContext returns the lines surrounding line n, available so far.
+			matchContext := func(n int, ln string) string {
+				var following []string
+				if n+1 < len(lines)-1 {
+					following = lines[n+1 : len(lines)-1]
+				}
+				if int64(len(following)) > so.ContextLines {
+					following = following[:so.ContextLines]
+				}
+				ctx := append(append(append([]string{}, recent...), ln), following...)
+				return strings.Join(ctx, "\n")
+			}
+			for n, ln := range lines {
 				// If there is a unconsumed tail string from the previous block of content, concat it with the 1st line of the new block of content.
-				if i == 0 && tailString != "" {
+				if n == 0 && tailString != "" {
 					ln = tailString + ln
 					tailString = ""
 				}
 
 				// If the content is not ended with a "\n", we want to store the last line as tail string, so it can be concat with the next block of content.
-				if i == len(lines)-1 && lines[len(lines)-1] != "" {
+				if n == len(lines)-1 && lines[len(lines)-1] != "" {
 					tailString = ln
 					break
 				}
@@ -185,22 +342,51 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 				if so.StatusMatch != "" {
 					if i := strings.Index(ln, so.StatusMatch); i != -1 {
 						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: StatusMatch found: %q", name, strings.TrimSpace(ln[i:]))
+						w.emitProgress(s, ProgressEvent{Stage: ProgressStatus, StepType: "WaitForInstancesSignal", Instance: name, Message: strings.TrimSpace(ln[i:])})
 						extractOutputValue(w, ln)
+						if so.onStatus != nil {
+							so.onStatus(strings.TrimSpace(ln[i:]))
+						}
 					}
 				}
 				if len(so.FailureMatch) > 0 {
 					for _, failureMatch := range so.FailureMatch {
 						if i := strings.Index(ln, failureMatch); i != -1 {
 							errMsg := strings.TrimSpace(ln[i:])
-							format := "WaitForInstancesSignal FailureMatch found for %q: %q"
-							return newErr(errMsg, fmt.Errorf(format, name, errMsg))
+							msg := fmt.Sprintf("WaitForInstancesSignal FailureMatch found for %q: %q", name, errMsg) + savedOutputSuffix(s, name, so.Port, output)
+							if so.ContextLines > 0 {
+								msg += ", context:\n" + matchContext(n, ln)
+							}
+							return newErr(errMsg, errors.New(msg))
 						}
 					}
 				}
-				if so.SuccessMatch != "" {
+				if absentDone != nil {
+					if i := so.absentMatchIndex(ln); i != -1 {
+						errMsg := strings.TrimSpace(ln[i:])
+						msg := fmt.Sprintf("WaitForInstancesSignal AbsentMatch found for %q after SuccessMatch: %q", name, errMsg) + savedOutputSuffix(s, name, so.Port, output)
+						if so.ContextLines > 0 {
+							msg += ", context:\n" + matchContext(n, ln)
+						}
+						return newErr(errMsg, errors.New(msg))
+					}
+				} else if so.SuccessMatch != "" {
 					if i := strings.Index(ln, so.SuccessMatch); i != -1 {
 						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: SuccessMatch found %q", name, strings.TrimSpace(ln[i:]))
-						return nil
+						if so.ContextLines > 0 {
+							w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: SuccessMatch context:\n%s", name, matchContext(n, ln))
+						}
+						saveSerialOutput(s, name, so.Port, output)
+						if len(so.AbsentMatch) == 0 && len(so.AbsentMatchRegex) == 0 {
+							return nil
+						}
+						absentDone = time.After(so.absentWindow)
+					}
+				}
+				if so.ContextLines > 0 {
+					recent = append(recent, ln)
+					if int64(len(recent)) > so.ContextLines {
+						recent = recent[1:]
 					}
 				}
 			}
@@ -209,9 +395,63 @@ func waitForSerialOutput(s *Step, project, zone, name string, so *SerialOutput,
 	}
 }
 
-func waitForGuestAttribute(s *Step, project, zone, name string, ga *GuestAttribute, interval time.Duration) DError {
-	ga.KeyName = strOr(ga.KeyName, defaultGuestAttrKeyName)
-	ga.Namespace = strOr(ga.Namespace, defaultGuestAttrNamespace)
+// absentMatchIndex returns the index in ln of the first AbsentMatch or
+// AbsentMatchRegex match, or -1 if there is none.
+func (so *SerialOutput) absentMatchIndex(ln string) int {
+	for _, absentMatch := range so.AbsentMatch {
+		if i := strings.Index(ln, absentMatch); i != -1 {
+			return i
+		}
+	}
+	for _, rgx := range so.absentMatchRegex {
+		if loc := rgx.FindStringIndex(ln); loc != nil {
+			return loc[0]
+		}
+	}
+	return -1
+}
+
+// serialLogObject returns the object in the logs of the workflow the serial
+// port output of the instance named name is saved to.
+func serialLogObject(s *Step, name string, port int64) string {
+	return path.Join(s.w.logsPath, fmt.Sprintf("%s-serial-port%d-%s.log", name, port, s.name))
+}
+
+// saveSerialOutput saves the serial port output of the instance named name
+// to the logs of the workflow. The GCS link is logged and set as the
+// serial-output value "<name>-serial-port<port>-output" of the workflow. It
+// returns the link, or "" if saving failed.
+func saveSerialOutput(s *Step, name string, port int64, output *serialLog) string {
+	w := s.w
+	if err := output.save(context.Background()); err != nil {
+		w.LogStepInfo(s.name, "WaitForInstancesSignal", "WARNING: Instance %q: error saving serial port %d output: %v", name, port, err)
+		return ""
+	}
+	link := fmt.Sprintf("gs://%s/%s", w.bucket, output.obj)
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: serial port %d output saved to %s", name, port, link)
+	w.root().AddSerialConsoleOutputValue(fmt.Sprintf("%s-serial-port%d-output", name, port), link)
+	return link
+}
+
+// savedOutputSuffix saves the serial port output like saveSerialOutput, and
+// returns the error message suffix naming where it was saved.
+func savedOutputSuffix(s *Step, name string, port int64, output *serialLog) string {
+	if link := saveSerialOutput(s, name, port, output); link != "" {
+		return ", serial port output saved to " + link
+	}
+	return ""
+}
+
+// guestAttributeMinInterval is the minimum interval between guest attribute
+// queries, the limit is documented as 10 queries/minute.
+var guestAttributeMinInterval = 6 * time.Second
+
+// waitForGuestAttribute waits for a guest attribute of an instance. It returns
+// nil when done is closed.
+func waitForGuestAttribute(s *Step, project, zone, name string, ga *GuestAttribute, interval time.Duration, done <-chan struct{}) DError {
+	gd := s.w.guestAttributeDefaults()
+	ga.KeyName = strOr(ga.KeyName, gd.KeyName)
+	ga.Namespace = strOr(ga.Namespace, gd.Namespace)
 	varkey := fmt.Sprintf("%s/%s", ga.Namespace, ga.KeyName)
 	w := s.w
 	msg := fmt.Sprintf("Instance %q: watching for key %s", name, varkey)
@@ -219,10 +459,8 @@ func waitForGuestAttribute(s *Step, project, zone, name string, ga *GuestAttribu
 		msg += fmt.Sprintf(", SuccessValue: %q", ga.SuccessValue)
 	}
 	w.LogStepInfo(s.name, "WaitForInstancesSignal", msg+".")
-	// The limit for querying guest attributes is documented as 10 queries/minute.
-	minInterval, err := time.ParseDuration("6s")
-	if err == nil && interval < minInterval {
-		interval = minInterval
+	if interval < guestAttributeMinInterval {
+		interval = guestAttributeMinInterval
 	}
 	tick := time.Tick(interval)
 	var errs int
@@ -230,6 +468,8 @@ func waitForGuestAttribute(s *Step, project, zone, name string, ga *GuestAttribu
 		select {
 		case <-s.w.Cancel:
 			return nil
+		case <-done:
+			return nil
 		case <-tick:
 			resp, err := w.ComputeClient.GetGuestAttributes(project, zone, name, "", varkey)
 			if err != nil {
@@ -274,6 +514,42 @@ func waitForGuestAttribute(s *Step, project, zone, name string, ga *GuestAttribu
 	}
 }
 
+// waitForHeartbeat watches the heartbeat guest attribute of an instance and
+// returns an error once it has not changed for timeout. It returns nil when
+// done is closed.
+func waitForHeartbeat(s *Step, project, zone, name string, timeout, interval time.Duration, done <-chan struct{}) DError {
+	w := s.w
+	key := HeartbeatNamespace + "/" + HeartbeatKey
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: watching heartbeat %s, HeartbeatTimeout: %s.", name, key, timeout)
+	if interval < guestAttributeMinInterval {
+		interval = guestAttributeMinInterval
+	}
+	tick := time.Tick(interval)
+	lastBeat := time.Now()
+	var lastValue string
+	for {
+		select {
+		case <-s.w.Cancel:
+			return nil
+		case <-done:
+			return nil
+		case <-tick:
+			resp, err := w.ComputeClient.GetGuestAttributes(project, zone, name, "", key)
+			if err == nil && resp.VariableValue != lastValue {
+				lastValue = resp.VariableValue
+				lastBeat = time.Now()
+				continue
+			}
+			if since := time.Since(lastBeat); since > timeout {
+				if lastValue == "" {
+					return Errf("WaitForInstancesSignal: instance %q: no heartbeat within HeartbeatTimeout %s", name, timeout)
+				}
+				return Errf("WaitForInstancesSignal: instance %q: no heartbeat for %s, guest appears hung", name, since.Round(time.Second))
+			}
+		}
+	}
+}
+
 func extractOutputValue(w *Workflow, s string) {
 	if matches := serialOutputValueRegex.FindStringSubmatch(s); matches != nil && len(matches) == 3 {
 		for w.parent != nil {
@@ -285,24 +561,63 @@ func extractOutputValue(w *Workflow, s string) {
 
 func (w *WaitForInstancesSignal) populate(ctx context.Context, s *Step) DError {
 	is := (*[]*InstanceSignal)(w)
-	return populateForWaitForInstancesSignal(is, "wait_for_instance_signal")
+	return populateForWaitForInstancesSignal(is, s, "wait_for_instance_signal")
 }
 
 func (w *WaitForAnyInstancesSignal) populate(ctx context.Context, s *Step) DError {
 	is := (*[]*InstanceSignal)(w)
-	return populateForWaitForInstancesSignal(is, "wait_for_any_instance_signal")
+	return populateForWaitForInstancesSignal(is, s, "wait_for_any_instance_signal")
 }
 
-func populateForWaitForInstancesSignal(w *[]*InstanceSignal, sn string) DError {
+func populateForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step, sn string) DError {
+	pi := s.w.pollingIntervals()
 	for _, ws := range *w {
-		if ws.Interval == "" {
-			ws.Interval = defaultInterval
+		if instanceURLRgx.MatchString(ws.Name) {
+			ws.Name = extendPartialURL(ws.Name, s.project())
+		}
+		// A signal is polled at the workflow polling interval of what it
+		// waits for, the serial output first.
+		d := pi.InstanceStatus
+		switch {
+		case len(ws.serialOutputs()) > 0 || ws.OpsAgentLog != nil || ws.WindowsSetup != nil:
+			d = pi.SerialOutput
+		case ws.GuestAttribute != nil || ws.GuestAgentReady:
+			d = pi.GuestAttributes
 		}
+		ws.Interval = strOr(ws.Interval, d, pi.Default, defaultInterval)
 		var err error
 		ws.interval, err = time.ParseDuration(ws.Interval)
 		if err != nil {
 			return newErr(fmt.Sprintf("failed to parse duration for step %v", sn), err)
 		}
+		for _, so := range ws.serialOutputs() {
+			if so.AbsentWindow != "" {
+				so.absentWindow, err = time.ParseDuration(so.AbsentWindow)
+				if err != nil {
+					return newErr(fmt.Sprintf("failed to parse AbsentWindow for step %v", sn), err)
+				}
+			}
+			so.absentMatchRegex = nil
+			for _, m := range so.AbsentMatchRegex {
+				rgx, err := regexp.Compile(m)
+				if err != nil {
+					return newErr(fmt.Sprintf("failed to parse AbsentMatchRegex for step %v", sn), err)
+				}
+				so.absentMatchRegex = append(so.absentMatchRegex, rgx)
+			}
+			if so.StallTimeout != "" {
+				so.stallTimeout, err = time.ParseDuration(so.StallTimeout)
+				if err != nil {
+					return newErr(fmt.Sprintf("failed to parse StallTimeout for step %v", sn), err)
+				}
+			}
+		}
+		if ws.HeartbeatTimeout != "" {
+			ws.heartbeatTimeout, err = time.ParseDuration(ws.HeartbeatTimeout)
+			if err != nil {
+				return newErr(fmt.Sprintf("failed to parse HeartbeatTimeout for step %v", sn), err)
+			}
+		}
 	}
 	return nil
 }
@@ -317,51 +632,202 @@ func (w *WaitForAnyInstancesSignal) run(ctx context.Context, s *Step) DError {
 	return runForWaitForInstancesSignal(is, s, false)
 }
 
+// serialTail returns the last n lines of the output of serial port port of
+// the instance named name.
+func serialTail(w *Workflow, name string, port int64, n int) (string, error) {
+	link, ok := signalInstanceLink(w, name)
+	if !ok {
+		return "", fmt.Errorf("unresolved instance %q", name)
+	}
+	m := NamedSubexp(instanceURLRgx, link)
+	resp, err := w.ComputeClient.GetSerialPortOutput(m["project"], m["zone"], m["instance"], port, 0)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimRight(resp.Contents, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// signalInstanceLink returns the URL of the instance an InstanceSignal named
+// name waits for: name itself if it is a URL, else the URL of the workflow
+// instance.
+func signalInstanceLink(w *Workflow, name string) (string, bool) {
+	if instanceURLRgx.MatchString(name) {
+		return name, true
+	}
+	i, ok := w.instances.get(name)
+	if !ok {
+		return "", false
+	}
+	return i.link, true
+}
+
+// pollInterval returns the interval to check for a signal polled at the
+// workflow polling interval d: Interval if set, else d if set, else 10s.
+func (is *InstanceSignal) pollInterval(d time.Duration) time.Duration {
+	if is.interval > 0 {
+		return is.interval
+	}
+	if d > 0 {
+		return d
+	}
+	d, _ = time.ParseDuration(defaultInterval)
+	return d
+}
+
+// hasSuccessMatch reports whether one of sos has a SuccessMatch.
+func hasSuccessMatch(sos []*SerialOutput) bool {
+	for _, so := range sos {
+		if so.SuccessMatch != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func runForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step, waitAll bool) DError {
 	var wg sync.WaitGroup
 	e := make(chan DError)
+	// done is closed when the step returns, stopping the watchers still
+	// running, e.g. of ports with only a FailureMatch.
+	done := make(chan struct{})
+	defer close(done)
+	send := func(err DError) {
+		select {
+		case e <- err:
+		case <-done:
+		}
+	}
+	for _, is := range *w {
+		if len(is.CollectArtifacts) == 0 {
+			continue
+		}
+		link, ok := signalInstanceLink(s.w, is.Name)
+		if !ok {
+			return Errf("unresolved instance %q", is.Name)
+		}
+		m := NamedSubexp(instanceURLRgx, link)
+		if err := prepareArtifacts(s, m["project"], m["zone"], m["instance"], is.CollectArtifacts); err != nil {
+			return err
+		}
+	}
 	for _, is := range *w {
 		wg.Add(1)
 		go func(is *InstanceSignal) {
 			defer wg.Done()
-			i, ok := s.w.instances.get(is.Name)
+			link, ok := signalInstanceLink(s.w, is.Name)
 			if !ok {
-				e <- Errf("unresolved instance %q", is.Name)
+				send(Errf("unresolved instance %q", is.Name))
 				return
 			}
-			m := NamedSubexp(instanceURLRgx, i.link)
+			m := NamedSubexp(instanceURLRgx, link)
+			pi := s.w.pollingIntervals()
 			serialSig := make(chan struct{})
 			guestSig := make(chan struct{})
+			agentSig := make(chan struct{})
+			logSig := make(chan struct{})
+			windowsSig := make(chan struct{})
 			stoppedSig := make(chan struct{})
+			if is.heartbeatTimeout > 0 {
+				hbDone := make(chan struct{})
+				defer close(hbDone)
+				go func() {
+					if err := waitForHeartbeat(s, m["project"], m["zone"], m["instance"], is.heartbeatTimeout, is.pollInterval(pi.guestAttributes), hbDone); err != nil {
+						select {
+						case e <- err:
+						case <-hbDone:
+						case <-done:
+						}
+					}
+				}()
+			}
 			if is.Stopped {
 				go func() {
-					if err := waitForInstanceStopped(s, m["project"], m["zone"], m["instance"], is.interval); err != nil {
-						e <- err
+					if err := waitForInstanceStopped(s, m["project"], m["zone"], m["instance"], is.pollInterval(pi.instanceStatus), done); err != nil {
+						send(err)
 					}
 					close(stoppedSig)
 				}()
 			}
-			if is.SerialOutput != nil {
+			if sos := is.serialOutputs(); len(sos) > 0 {
+				// The signal is received once all the ports with a
+				// SuccessMatch matched, the others only watch for failures,
+				// unless none has a SuccessMatch.
+				var portsWg sync.WaitGroup
+				for _, so := range sos {
+					required := so.SuccessMatch != "" || !hasSuccessMatch(sos)
+					if required {
+						portsWg.Add(1)
+					}
+					go func(so *SerialOutput, required bool) {
+						if required {
+							defer portsWg.Done()
+						}
+						if err := waitForSerialOutput(s, m["project"], m["zone"], m["instance"], so, is.pollInterval(pi.serialOutput), done); err != nil {
+							send(err)
+						}
+					}(so, required)
+				}
 				go func() {
-					if err := waitForSerialOutput(s, m["project"], m["zone"], m["instance"], is.SerialOutput, is.interval); err != nil || !waitAll {
+					portsWg.Wait()
+					if !waitAll {
 						// send a signal to end other waiting instances
-						e <- err
+						send(nil)
 					}
 					close(serialSig)
 				}()
 			}
 			if is.GuestAttribute != nil {
 				go func() {
-					if err := waitForGuestAttribute(s, m["project"], m["zone"], m["instance"], is.GuestAttribute, is.interval); err != nil || !waitAll {
+					if err := waitForGuestAttribute(s, m["project"], m["zone"], m["instance"], is.GuestAttribute, is.pollInterval(pi.guestAttributes), done); err != nil || !waitAll {
 						// send a signal to end other waiting instances
-						e <- err
+						send(err)
 					}
 					close(guestSig)
 				}()
 			}
+			if is.GuestAgentReady {
+				go func() {
+					ga := &GuestAttribute{Namespace: guestAgentReadyNamespace, KeyName: guestAgentReadyKeyName}
+					if err := waitForGuestAttribute(s, m["project"], m["zone"], m["instance"], ga, is.pollInterval(pi.guestAttributes), done); err != nil || !waitAll {
+						// send a signal to end other waiting instances
+						send(err)
+					}
+					close(agentSig)
+				}()
+			}
+			if is.OpsAgentLog != nil {
+				go func() {
+					if err := waitForOpsAgentLog(s, m["project"], m["zone"], m["instance"], is.OpsAgentLog, is.pollInterval(pi.serialOutput), done); err != nil || !waitAll {
+						// send a signal to end other waiting instances
+						send(err)
+					}
+					close(logSig)
+				}()
+			}
+			if is.WindowsSetup != nil {
+				go func() {
+					if err := waitForWindowsSetup(s, m["project"], m["zone"], m["instance"], is.WindowsSetup, is.pollInterval(pi.serialOutput), done); err != nil || !waitAll {
+						// send a signal to end other waiting instances
+						send(err)
+					}
+					close(windowsSig)
+				}()
+			}
 			select {
+			case <-done:
+				return
 			case <-guestSig:
 				return
+			case <-agentSig:
+				return
+			case <-logSig:
+				return
+			case <-windowsSig:
+				return
 			case <-serialSig:
 				return
 			case <-stoppedSig:
@@ -371,14 +837,24 @@ func runForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step, waitAll bool) D
 	}
 	go func() {
 		wg.Wait()
-		e <- nil
+		send(nil)
 	}()
+	var err DError
 	select {
-	case err := <-e:
-		return err
+	case err = <-e:
 	case <-s.w.Cancel:
 		return nil
 	}
+	for _, is := range *w {
+		if len(is.CollectArtifacts) == 0 {
+			continue
+		}
+		if link, ok := signalInstanceLink(s.w, is.Name); ok {
+			m := NamedSubexp(instanceURLRgx, link)
+			collectArtifacts(context.Background(), s, m["project"], m["zone"], m["instance"], is.CollectArtifacts)
+		}
+	}
+	return err
 }
 
 func (w *WaitForInstancesSignal) validate(ctx context.Context, s *Step) DError {
@@ -394,22 +870,61 @@ func (w *WaitForAnyInstancesSignal) validate(ctx context.Context, s *Step) DErro
 func validateForWaitForInstancesSignal(w *[]*InstanceSignal, s *Step) DError {
 	// Instance checking.
 	for _, i := range *w {
-		if _, err := s.w.instances.regUse(i.Name, s); err != nil {
-			return err
+		if !instanceURLRgx.MatchString(i.Name) {
+			if _, err := s.w.instances.regUse(i.Name, s); err != nil {
+				return err
+			}
 		}
-		if i.interval == 0*time.Second {
+		if i.Interval != "" && i.interval <= 0 {
 			return Errf("%q: cannot wait for instance signal, no interval given", i.Name)
 		}
-		if i.SerialOutput == nil && i.GuestAttribute == nil && i.Stopped == false {
+		if len(i.serialOutputs()) == 0 && i.GuestAttribute == nil && i.OpsAgentLog == nil && i.WindowsSetup == nil && !i.GuestAgentReady && i.Stopped == false {
 			return Errf("%q: cannot wait for instance signal, nothing to wait for", i.Name)
 		}
-		if i.SerialOutput != nil {
-			if i.SerialOutput.Port == 0 {
+		if i.HeartbeatTimeout != "" && i.heartbeatTimeout <= 0 {
+			return Errf("%q: cannot wait for instance signal, HeartbeatTimeout must be positive", i.Name)
+		}
+		for _, p := range i.CollectArtifacts {
+			if !isGuestAbsPath(p) || strings.Contains(p, "\n") {
+				return Errf("%q: cannot collect artifact %q, not an absolute path", i.Name, p)
+			}
+		}
+		if i.OpsAgentLog != nil && i.OpsAgentLog.SuccessMatch == "" && len(i.OpsAgentLog.FailureMatch) == 0 {
+			return Errf("%q: cannot wait for instance signal via OpsAgentLog, no SuccessMatch or FailureMatch given", i.Name)
+		}
+		if ws := i.WindowsSetup; ws != nil {
+			if ws.ActivationStatus == "" && ws.SysprepState == "" {
+				return Errf("%q: cannot wait for instance signal via WindowsSetup, no ActivationStatus or SysprepState given", i.Name)
+			}
+			for _, p := range ws.Ports {
+				if p < 1 || p > 4 {
+					return Errf("%q: cannot wait for instance signal via WindowsSetup, invalid Port %d", i.Name, p)
+				}
+			}
+		}
+		ports := map[int64]bool{}
+		for _, so := range i.serialOutputs() {
+			if so == nil {
+				return Errf("%q: cannot wait for instance signal via SerialOutput, empty SerialOutput given", i.Name)
+			}
+			if so.Port == 0 {
 				return Errf("%q: cannot wait for instance signal via SerialOutput, no Port given", i.Name)
 			}
-			if i.SerialOutput.SuccessMatch == "" && len(i.SerialOutput.FailureMatch) == 0 {
+			if ports[so.Port] {
+				return Errf("%q: cannot wait for instance signal via SerialOutput, Port %d given more than once", i.Name, so.Port)
+			}
+			ports[so.Port] = true
+			if so.SuccessMatch == "" && len(so.FailureMatch) == 0 {
 				return Errf("%q: cannot wait for instance signal via SerialOutput, no SuccessMatch or FailureMatch given", i.Name)
 			}
+			if len(so.AbsentMatch) > 0 || len(so.AbsentMatchRegex) > 0 {
+				if so.SuccessMatch == "" {
+					return Errf("%q: cannot wait for instance signal via SerialOutput, AbsentMatch given without SuccessMatch", i.Name)
+				}
+				if so.absentWindow <= 0 {
+					return Errf("%q: cannot wait for instance signal via SerialOutput, AbsentMatch given without AbsentWindow", i.Name)
+				}
+			}
 		}
 	}
 	return nil
@@ -16,10 +16,16 @@ package daisy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -46,7 +52,7 @@ func TestWaitForInstanceStopped(t *testing.T) {
 
 	w.ComputeClient = c
 	s := &Step{name: "foo", w: w}
-	if err := waitForInstanceStopped(s, testProject, testZone, "foo", 1*time.Microsecond); err != nil {
+	if err := waitForInstanceStopped(s, testProject, testZone, "foo", 1*time.Microsecond, nil); err != nil {
 		t.Fatalf("error running waitForInstanceStopped: %v", err)
 	}
 }
@@ -61,7 +67,7 @@ func TestWaitForAnyInstancesSignalPopulate(t *testing.T) {
 
 func testWaitForSignalPopulate(t *testing.T, waitAny bool) {
 	got := getStep(waitAny, []*InstanceSignal{{Name: "test"}})
-	if err := got.populate(context.Background(), &Step{}); err != nil {
+	if err := got.populate(context.Background(), &Step{w: testWorkflow()}); err != nil {
 		t.Fatalf("error running populate: %v", err)
 	}
 
@@ -69,6 +75,26 @@ func testWaitForSignalPopulate(t *testing.T, waitAny bool) {
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("got != want:\ngot:  %+v\nwant: %+v", got, want)
 	}
+
+	// Instance URLs are extended with the project.
+	got = getStep(waitAny, []*InstanceSignal{{Name: "zones/z/instances/i"}})
+	if err := got.populate(context.Background(), &Step{w: testWorkflow()}); err != nil {
+		t.Fatalf("error running populate: %v", err)
+	}
+	want = getStep(waitAny, []*InstanceSignal{{Name: fmt.Sprintf("projects/%s/zones/z/instances/i", testProject), Interval: "10s", interval: 10 * time.Second}})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got != want:\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// AbsentMatchRegex is compiled.
+	got = getStep(waitAny, []*InstanceSignal{{Name: "test", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "ok", AbsentMatchRegex: []string{"oops [0-9]+"}}}})
+	if err := got.populate(context.Background(), &Step{w: testWorkflow()}); err != nil {
+		t.Fatalf("error running populate: %v", err)
+	}
+	got = getStep(waitAny, []*InstanceSignal{{Name: "test", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "ok", AbsentMatchRegex: []string{"oops ["}}}})
+	if err := got.populate(context.Background(), &Step{w: testWorkflow()}); err == nil {
+		t.Error("expected error for bad AbsentMatchRegex")
+	}
 }
 
 func TestWaitForInstancesSignalRun(t *testing.T) {
@@ -164,6 +190,13 @@ func testWaitForSignalRun(t *testing.T, waitAny bool) {
 	if err := ws.run(ctx, s); err != nil {
 		t.Errorf("error running stepImpl.run(): %v", err)
 	}
+	// Instance given by URL, not in the workflow resources.
+	ws = getStep(waitAny, []*InstanceSignal{
+		{Name: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1")), interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{SuccessMatch: "success"}},
+	})
+	if err := ws.run(ctx, s); err != nil {
+		t.Errorf("error running stepImpl.run() on an instance URL: %v", err)
+	}
 	// Failure match error.
 	ws = getStep(waitAny, []*InstanceSignal{
 		{Name: "i2", interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{FailureMatch: []string{"fail"}, SuccessMatch: "success"}},
@@ -237,15 +270,27 @@ func testWaitForSignalValidate(t *testing.T, waitAny bool) {
 		shouldErr bool
 	}{
 		{"normal case Stopped", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, interval: 1 * time.Second}}), false},
+		{"normal case GuestAgentReady", getStep(waitAny, []*InstanceSignal{{Name: "instance1", GuestAgentReady: true, interval: 1 * time.Second}}), false},
 		{"normal SerialOutput SuccessMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, StatusMatch: "test", SuccessMatch: "test"}, interval: 1 * time.Second}}), false},
 		{"normal SerialOutput FailureMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"fail"}}, interval: 1 * time.Second}}), false},
 		{"normal SerialOutput SuccessMatch FailureMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "test", FailureMatch: []string{"fail"}}, interval: 1 * time.Second}}), false},
 		{"normal SerialOutput SuccessMatch FailureMatch-es", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "test", FailureMatch: []string{"fail", "fail2"}}, interval: 1 * time.Second}}), false},
+		{"normal SerialOutput AbsentMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "test", AbsentMatch: []string{"oops"}, absentWindow: 1 * time.Second}, interval: 1 * time.Second}}), false},
+		{"SerialOutput AbsentMatch no SuccessMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"fail"}, AbsentMatch: []string{"oops"}, absentWindow: 1 * time.Second}, interval: 1 * time.Second}}), true},
+		{"SerialOutput AbsentMatch no AbsentWindow", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "test", AbsentMatch: []string{"oops"}}, interval: 1 * time.Second}}), true},
+		{"SerialOutput AbsentMatchRegex no SuccessMatch", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"fail"}, AbsentMatchRegex: []string{"oops"}, absentWindow: 1 * time.Second}, interval: 1 * time.Second}}), true},
+		{"SerialOutput duplicate port", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "test"}, SerialOutputs: []*SerialOutput{{Port: 1, FailureMatch: []string{"fail"}}}, interval: 1 * time.Second}}), true},
 		{"SerialOutput no port", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{SuccessMatch: "test"}, interval: 1 * time.Second}}), true},
 		{"SerialOutput no SuccessMatch or FailureMatch or FailureMatches", getStep(waitAny, []*InstanceSignal{{Name: "instance1", SerialOutput: &SerialOutput{Port: 1}, interval: 1 * time.Second}}), true},
+		{"instance URL not in workflow", getStep(waitAny, []*InstanceSignal{{Name: "projects/p/zones/z/instances/other", Stopped: true, interval: 1 * time.Second}}), false},
 		{"instance DNE error check", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, interval: 1 * time.Second}, {Name: "instance2", Stopped: true, interval: 1 * time.Second}}), true},
 		{"no interval", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, Interval: "0s"}}), true},
 		{"no signal", getStep(waitAny, []*InstanceSignal{{Name: "instance1", interval: 1 * time.Second}}), true},
+		{"normal WindowsSetup", getStep(waitAny, []*InstanceSignal{{Name: "instance1", WindowsSetup: &WindowsSetup{SysprepState: "IMAGE_STATE_COMPLETE"}, interval: 1 * time.Second}}), false},
+		{"WindowsSetup no state", getStep(waitAny, []*InstanceSignal{{Name: "instance1", WindowsSetup: &WindowsSetup{FailureStates: []string{"Notification"}}, interval: 1 * time.Second}}), true},
+		{"WindowsSetup bad port", getStep(waitAny, []*InstanceSignal{{Name: "instance1", WindowsSetup: &WindowsSetup{Ports: []int64{5}, ActivationStatus: "Licensed"}, interval: 1 * time.Second}}), true},
+		{"CollectArtifacts", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, CollectArtifacts: []string{"/var/log/syslog", `C:\Windows\Panther\setupact.log`}}}), false},
+		{"CollectArtifacts relative path", getStep(waitAny, []*InstanceSignal{{Name: "instance1", Stopped: true, CollectArtifacts: []string{"log/syslog"}}}), true},
 	}
 
 	for _, tt := range tests {
@@ -360,3 +405,324 @@ func TestWaitForSignalGetSplitOutput(t *testing.T) {
 		t.Errorf("error running stepImpl.run(): didn't get expected output value")
 	}
 }
+
+func TestWaitForSignalAbsentMatch(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	var output []string
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		if int(start) >= len(output) {
+			return &compute.SerialPortOutput{Next: start}, nil
+		}
+		return &compute.SerialPortOutput{Contents: output[start] + "\n", Next: start + 1}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+
+	tests := []struct {
+		desc        string
+		output      []string
+		absent      []string
+		absentRegex []string
+		shouldErr   bool
+	}{
+		{"absent", []string{"booting", "boot finished", "all good"}, []string{"oops"}, nil, false},
+		{"absent before success", []string{"kernel oops", "boot finished", "all good"}, []string{"oops"}, nil, false},
+		{"present after success", []string{"booting", "boot finished", "kernel oops"}, []string{"oops"}, nil, true},
+		{"regex absent", []string{"booting", "boot finished", "segfault"}, nil, []string{`oops \d+`}, false},
+		{"regex present after success", []string{"booting", "boot finished", "kernel oops 42"}, nil, []string{`oops \d+`}, true},
+	}
+	for _, tt := range tests {
+		output = tt.output
+		so := &SerialOutput{
+			Port: 1, SuccessMatch: "boot finished", AbsentMatch: tt.absent, AbsentMatchRegex: tt.absentRegex, absentWindow: 100 * time.Millisecond,
+		}
+		for _, m := range tt.absentRegex {
+			so.absentMatchRegex = append(so.absentMatchRegex, regexp.MustCompile(m))
+		}
+		si := WaitForInstancesSignal{
+			&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutput: so},
+		}
+		if err := si.run(ctx, s); (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+	}
+}
+
+func TestWaitForSignalStallTimeout(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	var doneAfter time.Time
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		if !doneAfter.IsZero() && time.Now().After(doneAfter) {
+			return &compute.SerialPortOutput{Contents: "done\n", Next: start + 1}, nil
+		}
+		return &compute.SerialPortOutput{Next: start}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+
+	// Stalled output fails the wait.
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Millisecond, SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done", stallTimeout: 10 * time.Millisecond}},
+	}
+	if err := si.run(ctx, s); err == nil {
+		t.Error("expected error on stalled serial output")
+	}
+
+	// With StallWarnOnly the wait continues until SuccessMatch.
+	doneAfter = time.Now().Add(50 * time.Millisecond)
+	si = WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Millisecond, SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done", stallTimeout: 10 * time.Millisecond, StallWarnOnly: true}},
+	}
+	if err := si.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var warned bool
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		if strings.Contains(e.Message, "no serial output") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("expected a stall warning to be logged")
+	}
+}
+
+func TestWaitForSignalContextLines(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		if start > 0 {
+			return &compute.SerialPortOutput{Next: start}, nil
+		}
+		return &compute.SerialPortOutput{Contents: "l1\nl2\nl3\nfailed here\nl5\nl6\nl7\n", Next: 1}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"failed"}, ContextLines: 2}},
+	}
+	err := si.run(ctx, s)
+	if err == nil {
+		t.Fatal("expected FailureMatch error")
+	}
+	want := "context:\nl2\nl3\nfailed here\nl5\nl6"
+	if !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("error %q does not end with context %q", err, want)
+	}
+}
+
+func TestWaitForSignalGuestAgentReady(t *testing.T) {
+	defer func(d time.Duration) { guestAttributeMinInterval = d }(guestAttributeMinInterval)
+	guestAttributeMinInterval = time.Millisecond
+
+	ctx := context.Background()
+	w := testWorkflow()
+	var polls int32
+	w.ComputeClient.(*daisyCompute.TestClient).GetGuestAttributesFn = func(_, _, _, _, key string) (*compute.GuestAttributes, error) {
+		if key != guestAgentReadyNamespace+"/"+guestAgentReadyKeyName || atomic.AddInt32(&polls, 1) < 3 {
+			return nil, &googleapi.Error{Code: 404}
+		}
+		return &compute.GuestAttributes{VariableValue: "true"}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+
+	si := WaitForInstancesSignal{&InstanceSignal{Name: "i1", interval: time.Millisecond, GuestAgentReady: true}}
+	if err := si.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&polls); got < 3 {
+		t.Errorf("signal received after %d polls, want at least 3", got)
+	}
+}
+
+func TestWaitForSignalHeartbeatTimeout(t *testing.T) {
+	defer func(d time.Duration) { guestAttributeMinInterval = d }(guestAttributeMinInterval)
+	guestAttributeMinInterval = time.Millisecond
+
+	ctx := context.Background()
+	w := testWorkflow()
+	// mx guards beats, hung and doneAfter, read by the watchers.
+	var mx sync.Mutex
+	var beats int
+	var hung bool
+	var doneAfter time.Time
+	w.ComputeClient.(*daisyCompute.TestClient).GetGuestAttributesFn = func(_, _, _, _, key string) (*compute.GuestAttributes, error) {
+		if key != HeartbeatNamespace+"/"+HeartbeatKey {
+			return nil, &googleapi.Error{Code: 404}
+		}
+		mx.Lock()
+		defer mx.Unlock()
+		if !hung {
+			beats++
+		}
+		return &compute.GuestAttributes{VariableValue: fmt.Sprint(beats)}, nil
+	}
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		mx.Lock()
+		defer mx.Unlock()
+		if !doneAfter.IsZero() && time.Now().After(doneAfter) {
+			return &compute.SerialPortOutput{Contents: "done\n", Next: start + 1}, nil
+		}
+		return &compute.SerialPortOutput{Next: start}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, w.genName("i1"))},
+	}
+
+	// A guest that keeps beating is still working.
+	mx.Lock()
+	doneAfter = time.Now().Add(50 * time.Millisecond)
+	mx.Unlock()
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: time.Millisecond, heartbeatTimeout: 20 * time.Millisecond, SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done"}},
+	}
+	if err := si.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A guest that stops beating is hung.
+	mx.Lock()
+	hung = true
+	doneAfter = time.Time{}
+	mx.Unlock()
+	si = WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: time.Millisecond, heartbeatTimeout: 20 * time.Millisecond, SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done"}},
+	}
+	if err := si.run(ctx, s); err == nil || !strings.Contains(err.Error(), "heartbeat") {
+		t.Errorf("expected heartbeat error, got: %v", err)
+	}
+}
+
+func TestWaitForSignalSaveOutput(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	fs := &FakeStorage{}
+	w.Storage = fs
+	w.bucket = "bucket"
+	w.logsPath = "logs"
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		if start == 0 {
+			return &compute.SerialPortOutput{Contents: "early boot\n", Next: 1}, nil
+		}
+		return &compute.SerialPortOutput{Contents: "failed here\n", Next: start + 1}, nil
+	}
+	s := &Step{name: "wait", w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutput: &SerialOutput{Port: 1, FailureMatch: []string{"failed"}}},
+	}
+	err := si.run(ctx, s)
+	link := "gs://bucket/logs/i1-serial-port1-wait.log"
+	if err == nil || !strings.Contains(err.Error(), link) {
+		t.Errorf("error %v does not contain %q", err, link)
+	}
+	if got := w.GetSerialConsoleOutputValue("i1-serial-port1-output"); got != link {
+		t.Errorf("serial-output value: got %q, want %q", got, link)
+	}
+	r, gErr := fs.Get(ctx, "bucket", "logs/i1-serial-port1-wait.log", 0)
+	if gErr != nil {
+		t.Fatalf("saved output not found: %v", gErr)
+	}
+	defer r.Close()
+	got, _ := ioutil.ReadAll(r)
+	if want := "early boot\nfailed here\n"; string(got) != want {
+		t.Errorf("saved output: got %q, want %q", got, want)
+	}
+}
+
+func TestInstanceSignalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		desc, json string
+		want       InstanceSignal
+	}{
+		{"object", `{"Name": "i", "SerialOutput": {"Port": 1, "SuccessMatch": "done"}}`, InstanceSignal{Name: "i", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done"}}},
+		{"list", `{"Name": "i", "SerialOutput": [{"Port": 1, "SuccessMatch": "booted"}, {"Port": 4, "FailureMatch": "fail"}]}`, InstanceSignal{Name: "i", SerialOutputs: []*SerialOutput{{Port: 1, SuccessMatch: "booted"}, {Port: 4, FailureMatch: FailureMatches{"fail"}}}}},
+		{"SerialOutputs", `{"Name": "i", "SerialOutput": {"Port": 1, "SuccessMatch": "booted"}, "SerialOutputs": [{"Port": 4, "SuccessMatch": "ready"}]}`, InstanceSignal{Name: "i", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "booted"}, SerialOutputs: []*SerialOutput{{Port: 4, SuccessMatch: "ready"}}}},
+		{"no SerialOutput", `{"Name": "i", "Stopped": true}`, InstanceSignal{Name: "i", Stopped: true}},
+	}
+	for _, tt := range tests {
+		var got InstanceSignal
+		if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForSignalMultiplePorts(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	outputs := map[int64]string{1: "booted\n", 4: "agent ready\n", 3: ""}
+	var polls int64
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, port, start int64) (*compute.SerialPortOutput, error) {
+		if port == 3 {
+			atomic.AddInt64(&polls, 1)
+		}
+		if start > 0 {
+			return &compute.SerialPortOutput{Next: start}, nil
+		}
+		return &compute.SerialPortOutput{Contents: outputs[port], Next: 1}, nil
+	}
+	s := &Step{w: w}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+
+	// Both ports must match.
+	si := WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutputs: []*SerialOutput{
+			{Port: 1, SuccessMatch: "booted"},
+			{Port: 4, SuccessMatch: "agent ready"},
+		}},
+	}
+	if err := si.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A FailureMatch on any port fails.
+	si = WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutputs: []*SerialOutput{
+			{Port: 1, SuccessMatch: "never"},
+			{Port: 4, FailureMatch: FailureMatches{"agent"}},
+		}},
+	}
+	if err := si.run(ctx, s); err == nil || !strings.Contains(err.Error(), "agent ready") {
+		t.Errorf("expected FailureMatch error, got: %v", err)
+	}
+
+	// Ports with only a FailureMatch stop being watched with the step.
+	si = WaitForInstancesSignal{
+		&InstanceSignal{Name: "i1", interval: 1 * time.Microsecond, SerialOutputs: []*SerialOutput{
+			{Port: 1, SuccessMatch: "booted"},
+			{Port: 3, FailureMatch: FailureMatches{"never"}},
+		}},
+	}
+	if err := si.run(ctx, s); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	before := atomic.LoadInt64(&polls)
+	time.Sleep(50 * time.Millisecond)
+	if after := atomic.LoadInt64(&polls); after != before {
+		t.Errorf("port 3 still polled after the step ended: %d polls, then %d", before, after)
+	}
+}
@@ -0,0 +1,139 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Storage is the set of GCS object operations used by Daisy.
+type Storage interface {
+	// Get returns a reader for object, starting at offset.
+	Get(ctx context.Context, bucket, object string, offset int64) (io.ReadCloser, error)
+	// Put writes the content of r to object.
+	Put(ctx context.Context, bucket, object, contentType string, r io.Reader) error
+	// Compose concatenates srcs, objects of bucket, into object.
+	Compose(ctx context.Context, bucket, object string, srcs ...string) error
+	// SignedURL returns a signed URL for object.
+	SignedURL(bucket, object string, opts *storage.SignedURLOptions) (string, error)
+	// Attrs returns the attributes of object.
+	Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error)
+	// BucketAttrs returns the attributes of bucket.
+	BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error)
+}
+
+type gcsStorage struct {
+	client *storage.Client
+}
+
+// NewGCSStorage returns a Storage backed by client.
+func NewGCSStorage(client *storage.Client) Storage {
+	return &gcsStorage{client: client}
+}
+
+func (s *gcsStorage) Get(ctx context.Context, bucket, object string, offset int64) (io.ReadCloser, error) {
+	return s.client.Bucket(bucket).Object(object).NewRangeReader(ctx, offset, -1)
+}
+
+func (s *gcsStorage) Put(ctx context.Context, bucket, object, contentType string, r io.Reader) error {
+	// Closing the writer finalizes the object, canceling its context instead
+	// aborts the upload so that no truncated object is left behind.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := s.client.Bucket(bucket).Object(object).NewWriter(ctx)
+	wc.ContentType = contentType
+	if _, err := io.Copy(wc, r); err != nil {
+		cancel()
+		return err
+	}
+	return wc.Close()
+}
+
+func (s *gcsStorage) Compose(ctx context.Context, bucket, object string, srcs ...string) error {
+	b := s.client.Bucket(bucket)
+	var handles []*storage.ObjectHandle
+	for _, src := range srcs {
+		handles = append(handles, b.Object(src))
+	}
+	_, err := b.Object(object).ComposerFrom(handles...).Run(ctx)
+	return err
+}
+
+func (s *gcsStorage) SignedURL(bucket, object string, opts *storage.SignedURLOptions) (string, error) {
+	return storage.SignedURL(bucket, object, opts)
+}
+
+func (s *gcsStorage) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	return s.client.Bucket(bucket).Object(object).Attrs(ctx)
+}
+
+func (s *gcsStorage) BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error) {
+	return s.client.Bucket(bucket).Attrs(ctx)
+}
+
+// storage returns the Storage used by w, wrapping StorageClient if Storage
+// is not set.
+func (w *Workflow) storage() Storage {
+	if w.Storage == nil {
+		return NewGCSStorage(w.StorageClient)
+	}
+	return w.Storage
+}
+
+// downloadRetries is the number of times DownloadObject resumes a failed
+// download, and downloadRetryDelay the delay before the first retry, doubled
+// for each of the next ones.
+var (
+	downloadRetries    = 3
+	downloadRetryDelay = time.Second
+)
+
+// DownloadObject copies object to dst. If reading fails, the download is
+// resumed from the last byte written, up to three times, with an exponential
+// backoff.
+func DownloadObject(ctx context.Context, s Storage, bucket, object string, dst io.Writer) error {
+	var offset int64
+	var lastErr error
+	for attempt := 0; attempt <= downloadRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("error downloading gs://%s/%s: %v", bucket, object, ctx.Err())
+			case <-time.After(downloadRetryDelay << (attempt - 1)):
+			}
+		}
+		r, err := s.Get(ctx, bucket, object, offset)
+		if err != nil {
+			if err == storage.ErrObjectNotExist {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		n, err := io.Copy(dst, r)
+		r.Close()
+		offset += n
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("error downloading gs://%s/%s: %v", bucket, object, lastErr)
+}
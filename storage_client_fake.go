@@ -0,0 +1,137 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// FakeStorage is an in-memory Storage for tests.
+type FakeStorage struct {
+	// Buckets are returned by BucketAttrs, by bucket name.
+	Buckets map[string]*storage.BucketAttrs
+
+	mx      sync.Mutex
+	objects map[string]*fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func fakeKey(bucket, object string) string {
+	return bucket + "/" + object
+}
+
+// Get implements Storage.
+func (s *FakeStorage) Get(ctx context.Context, bucket, object string, offset int64) (io.ReadCloser, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	o, ok := s.objects[fakeKey(bucket, object)]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	if offset > int64(len(o.data)) {
+		offset = int64(len(o.data))
+	}
+	return ioutil.NopCloser(bytes.NewReader(o.data[offset:])), nil
+}
+
+// Put implements Storage.
+func (s *FakeStorage) Put(ctx context.Context, bucket, object, contentType string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.objects == nil {
+		s.objects = map[string]*fakeObject{}
+	}
+	s.objects[fakeKey(bucket, object)] = &fakeObject{data: data, contentType: contentType}
+	return nil
+}
+
+// Compose implements Storage.
+func (s *FakeStorage) Compose(ctx context.Context, bucket, object string, srcs ...string) error {
+	var buf bytes.Buffer
+	s.mx.Lock()
+	for _, src := range srcs {
+		o, ok := s.objects[fakeKey(bucket, src)]
+		if !ok {
+			s.mx.Unlock()
+			return storage.ErrObjectNotExist
+		}
+		buf.Write(o.data)
+	}
+	s.mx.Unlock()
+	return s.Put(ctx, bucket, object, "", &buf)
+}
+
+// SignedURL implements Storage.
+func (s *FakeStorage) SignedURL(bucket, object string, opts *storage.SignedURLOptions) (string, error) {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s?X-Goog-Signature=fake", bucket, object), nil
+}
+
+// Attrs implements Storage.
+func (s *FakeStorage) Attrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	o, ok := s.objects[fakeKey(bucket, object)]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	sum := md5.Sum(o.data)
+	return &storage.ObjectAttrs{
+		Bucket:      bucket,
+		Name:        object,
+		ContentType: o.contentType,
+		Size:        int64(len(o.data)),
+		MD5:         sum[:],
+		CRC32C:      crc32.Checksum(o.data, crc32.MakeTable(crc32.Castagnoli)),
+	}, nil
+}
+
+// BucketAttrs implements Storage.
+func (s *FakeStorage) BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	b, ok := s.Buckets[bucket]
+	if !ok {
+		return nil, storage.ErrBucketNotExist
+	}
+	return b, nil
+}
+
+// Object returns the content of object, for test assertions.
+func (s *FakeStorage) Object(bucket, object string) ([]byte, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	o, ok := s.objects[fakeKey(bucket, object)]
+	if !ok {
+		return nil, false
+	}
+	return o.data, true
+}
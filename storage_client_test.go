@@ -0,0 +1,152 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// flakyReader fails after returning n bytes.
+type flakyReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+// flakyStorage returns readers that fail after a few bytes.
+type flakyStorage struct {
+	*FakeStorage
+	gets int
+}
+
+func (s *flakyStorage) Get(ctx context.Context, bucket, object string, offset int64) (io.ReadCloser, error) {
+	s.gets++
+	r, err := s.FakeStorage.Get(ctx, bucket, object, offset)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&flakyReader{r: r, n: 4}), nil
+}
+
+func TestFakeStorage(t *testing.T) {
+	ctx := context.Background()
+	s := &FakeStorage{}
+	if _, err := s.Get(ctx, "bkt", "a", 0); err != storage.ErrObjectNotExist {
+		t.Errorf("expected ErrObjectNotExist, got %v", err)
+	}
+	if err := s.Put(ctx, "bkt", "a", "text/plain", strings.NewReader("hello ")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "bkt", "b", "", strings.NewReader("world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compose(ctx, "bkt", "c", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Object("bkt", "c"); string(got) != "hello world" {
+		t.Errorf("unexpected composed object %q", got)
+	}
+	if err := s.Compose(ctx, "bkt", "d", "a", "dne"); err == nil {
+		t.Error("expected error composing missing object")
+	}
+	attrs, err := s.Attrs(ctx, "bkt", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Size != 6 || attrs.ContentType != "text/plain" || len(attrs.MD5) == 0 {
+		t.Errorf("unexpected attrs %+v", attrs)
+	}
+	r, err := s.Get(ctx, "bkt", "c", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(r); string(got) != "world" {
+		t.Errorf("unexpected range read %q", got)
+	}
+}
+
+func TestDownloadObject(t *testing.T) {
+	defer func(d time.Duration) { downloadRetryDelay = d }(downloadRetryDelay)
+	downloadRetryDelay = time.Millisecond
+	ctx := context.Background()
+	fake := &FakeStorage{}
+	fake.Put(ctx, "bkt", "obj", "", strings.NewReader("0123456789ab"))
+
+	s := &flakyStorage{FakeStorage: fake}
+	var buf bytes.Buffer
+	if err := DownloadObject(ctx, s, "bkt", "obj", &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "0123456789ab" {
+		t.Errorf("unexpected content %q", buf.String())
+	}
+	if s.gets != 4 {
+		t.Errorf("expected 4 reads, got %d", s.gets)
+	}
+
+	fake.Put(ctx, "bkt", "big", "", strings.NewReader(strings.Repeat("x", 100)))
+	buf.Reset()
+	if err := DownloadObject(ctx, &flakyStorage{FakeStorage: fake}, "bkt", "big", &buf); err == nil {
+		t.Error("expected error after exhausting retries")
+	}
+	if err := DownloadObject(ctx, fake, "bkt", "dne", &buf); err != storage.ErrObjectNotExist {
+		t.Errorf("expected ErrObjectNotExist, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	downloadRetryDelay = time.Hour
+	s = &flakyStorage{FakeStorage: fake}
+	if err := DownloadObject(canceled, s, "bkt", "obj", &buf); err == nil {
+		t.Error("expected error when canceled during the backoff")
+	}
+	if s.gets != 1 {
+		t.Errorf("expected 1 read before the backoff, got %d", s.gets)
+	}
+}
+
+func TestSourceContentFakeStorage(t *testing.T) {
+	ctx := context.Background()
+	s := &FakeStorage{}
+	s.Put(ctx, "bkt", "script.sh", "", strings.NewReader("echo hello"))
+	w := &Workflow{Storage: s, Sources: map[string]string{"script": "gs://bkt/script.sh"}}
+	got, err := w.sourceContent(ctx, "script")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "echo hello" {
+		t.Errorf("unexpected content %q", got)
+	}
+}
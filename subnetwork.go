@@ -53,7 +53,7 @@ func (sn *Subnetwork) populate(ctx context.Context, s *Step) DError {
 	sn.Name, errs = sn.Resource.populateWithGlobal(ctx, s, sn.Name)
 
 	sn.Description = strOr(sn.Description, defaultDescription("Subnetwork", s.w.Name, s.w.username))
-	sn.link = fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", sn.Project, getRegionFromZone(s.w.Zone), sn.Name)
+	sn.link = fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", sn.Project, getRegionFromZone(s.zone()), sn.Name)
 	return errs
 }
 
@@ -67,13 +67,14 @@ func (sn *Subnetwork) validate(ctx context.Context, s *Step) DError {
 	if sn.Network == "" {
 		errs = addErrs(errs, Errf("%s: network is mandatory", pre))
 	}
-	sn.Region = strOr(sn.Region, getRegionFromZone(s.w.Zone))
+	sn.Region = strOr(sn.Region, getRegionFromZone(s.zone()))
 	if _, _, err := net.ParseCIDR(sn.IpCidrRange); err != nil {
 		errs = addErrs(errs, Errf("%s: bad IpCidrRange: %q, error: %v", pre, sn.IpCidrRange, err))
 	}
 
-	// Register creation.
-	errs = addErrs(errs, s.w.subnetworks.regCreate(sn.daisyName, &sn.Resource, s, false))
+	// Register creation. Stale subnetworks of a reclaimed network are dealt
+	// with when running.
+	errs = addErrs(errs, s.w.subnetworks.regCreate(sn.daisyName, &sn.Resource, s, s.w.networkReclaimMode(sn.Network) != ""))
 	return errs
 }
 
@@ -97,7 +98,7 @@ func newSubnetworkRegistry(w *Workflow) *subnetworkRegistry {
 
 func (nr *subnetworkRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(subnetworkURLRegex, res.link)
-	err := nr.w.ComputeClient.DeleteSubnetwork(m["project"], m["region"], m["subnetwork"])
+	err := nr.w.resourceClient(res).DeleteSubnetwork(m["project"], m["region"], m["subnetwork"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete subnetwork", err)
 	}
@@ -95,7 +95,7 @@ func newTargetInstanceRegistry(w *Workflow) *targetInstanceRegistry {
 
 func (tir *targetInstanceRegistry) deleteFn(res *Resource) DError {
 	m := NamedSubexp(targetInstanceURLRegex, res.link)
-	err := tir.w.ComputeClient.DeleteTargetInstance(m["project"], m["zone"], m["targetInstance"])
+	err := tir.w.resourceClient(res).DeleteTargetInstance(m["project"], m["zone"], m["targetInstance"])
 	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusNotFound {
 		return typedErr(resourceDNEError, "failed to delete target instance", err)
 	}
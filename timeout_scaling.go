@@ -0,0 +1,165 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// TimeoutForSize returns base plus perGb for each of the sizeGb gigabytes to
+// process. It sizes the timeout of operations whose duration grows with the
+// amount of data, such as creating an image from a large disk.
+func TimeoutForSize(base, perGb time.Duration, sizeGb int64) time.Duration {
+	return base + time.Duration(sizeGb)*perGb
+}
+
+// diskSizeGb returns the size of the disk named name, a disk created in the
+// workflow or a disk URL.
+func (w *Workflow) diskSizeGb(name string) (int64, error) {
+	if d, ok := w.disks.get(name); ok {
+		name = d.link
+	}
+	m := NamedSubexp(diskURLRgx, name)
+	d, err := w.ComputeClient.GetDisk(strOr(m["project"], w.Project), m["zone"], m["disk"])
+	if err != nil {
+		return 0, err
+	}
+	return d.SizeGb, nil
+}
+
+// sizeGb returns size bytes in GB, rounded up.
+func sizeGb(size int64) int64 {
+	return (size + 1<<30 - 1) >> 30
+}
+
+// objectSizeGb returns the size in GB, rounded up, of the GCS object at path.
+func (w *Workflow) objectSizeGb(path string) (int64, error) {
+	bkt, obj, err := splitGCSPath(path)
+	if err != nil {
+		return 0, err
+	}
+	attrs, aErr := w.storage().Attrs(context.Background(), bkt, obj)
+	if aErr != nil {
+		return 0, aErr
+	}
+	return sizeGb(attrs.Size), nil
+}
+
+// imageSizeGb returns the disk size of the image named name, an image
+// created in the workflow or an image URL.
+func (w *Workflow) imageSizeGb(name string) (int64, error) {
+	if i, ok := w.images.get(name); ok {
+		name = i.link
+	}
+	m := NamedSubexp(imageURLRgx, name)
+	project := strOr(m["project"], w.Project)
+	var size int64
+	if m["family"] != "" {
+		i, err := w.ComputeClient.GetImageFromFamily(project, m["family"])
+		if err != nil {
+			return 0, err
+		}
+		size = i.DiskSizeGb
+	} else {
+		i, err := w.ComputeClient.GetImage(project, m["image"])
+		if err != nil {
+			return 0, err
+		}
+		size = i.DiskSizeGb
+	}
+	return size, nil
+}
+
+// dataSizeGb returns the size of the largest source processed by s, for
+// steps that support TimeoutPerGb. Resources are created concurrently, so the
+// largest source bounds the step duration.
+func (s *Step) dataSizeGb() (int64, error) {
+	w := s.w
+	var max int64
+	add := func(size int64, err error) error {
+		if err != nil {
+			return err
+		}
+		if size > max {
+			max = size
+		}
+		return nil
+	}
+
+	switch {
+	case s.CreateImages != nil:
+		var images []ImageInterface
+		for _, i := range s.CreateImages.Images {
+			images = append(images, i)
+		}
+		for _, i := range s.CreateImages.ImagesBeta {
+			images = append(images, i)
+		}
+		for _, i := range images {
+			if i.getSourceDisk() != "" {
+				if err := add(w.diskSizeGb(i.getSourceDisk())); err != nil {
+					return 0, err
+				}
+			} else if i.getSourceImage() != "" {
+				if err := add(w.imageSizeGb(i.getSourceImage())); err != nil {
+					return 0, err
+				}
+			}
+		}
+	case s.CreateDisks != nil:
+		for _, d := range *s.CreateDisks {
+			if size, err := strconv.ParseInt(d.SizeGb, 10, 64); err == nil {
+				add(size, nil)
+			}
+			if d.SourceImage != "" {
+				if err := add(w.imageSizeGb(d.SourceImage)); err != nil {
+					return 0, err
+				}
+			}
+		}
+	case s.CreateSnapshots != nil:
+		for _, ss := range *s.CreateSnapshots {
+			if err := add(w.diskSizeGb(ss.SourceDisk)); err != nil {
+				return 0, err
+			}
+		}
+	case s.ExportImage != nil:
+		if err := add(w.imageSizeGb(s.ExportImage.Image)); err != nil {
+			return 0, err
+		}
+	case s.ImportDisk != nil:
+		if err := add(w.objectSizeGb(s.ImportDisk.SourceURI)); err != nil {
+			return 0, err
+		}
+	}
+	return max, nil
+}
+
+// scaleTimeout adds TimeoutPerGb for each gigabyte of the largest source of s
+// to its timeout.
+func (s *Step) scaleTimeout() {
+	if s.timeoutPerGb <= 0 {
+		return
+	}
+	size, err := s.dataSizeGb()
+	if err != nil {
+		s.w.LogWorkflowInfo("WARNING: could not get source size of step %q, keeping timeout of %s: %v", s.name, s.timeout, err)
+		return
+	}
+	s.timeout = TimeoutForSize(s.timeout, s.timeoutPerGb, size)
+	s.w.LogWorkflowInfo("Step %q timeout scaled to %s for %dGB", s.name, s.timeout, size)
+}
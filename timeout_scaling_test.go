@@ -0,0 +1,128 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestTimeoutForSize(t *testing.T) {
+	if got := TimeoutForSize(10*time.Minute, 30*time.Second, 2000); got != 10*time.Minute+1000*time.Minute {
+		t.Errorf("unexpected timeout %s", got)
+	}
+	if got := TimeoutForSize(10*time.Minute, time.Minute, 0); got != 10*time.Minute {
+		t.Errorf("unexpected timeout %s", got)
+	}
+}
+
+func TestScaleTimeout(t *testing.T) {
+	w := testWorkflow()
+	c := w.ComputeClient.(*daisyCompute.TestClient)
+	c.GetDiskFn = func(project, zone, name string) (*compute.Disk, error) {
+		if name == "dne" {
+			return nil, errors.New("not found")
+		}
+		return &compute.Disk{SizeGb: map[string]int64{"small": 10, "big": 2000}[name]}, nil
+	}
+	c.GetImageFn = func(project, name string) (*compute.Image, error) {
+		return &compute.Image{DiskSizeGb: 100}, nil
+	}
+	c.GetImageFromFamilyFn = func(project, family string) (*compute.Image, error) {
+		return &compute.Image{DiskSizeGb: 20}, nil
+	}
+	w.disks.m = map[string]*Resource{"d": {link: "projects/p/zones/z/disks/big"}}
+
+	tests := []struct {
+		desc string
+		step *Step
+		want time.Duration
+	}{
+		{
+			"images from disks, largest wins",
+			&Step{CreateImages: &CreateImages{Images: []*Image{
+				{Image: compute.Image{SourceDisk: "zones/z/disks/small"}},
+				{Image: compute.Image{SourceDisk: "d"}},
+			}}},
+			10*time.Minute + 2000*time.Second,
+		},
+		{
+			"image from image",
+			&Step{CreateImages: &CreateImages{Images: []*Image{
+				{Image: compute.Image{SourceImage: "projects/p/global/images/i"}},
+			}}},
+			10*time.Minute + 100*time.Second,
+		},
+		{
+			"disks, SizeGb larger than image",
+			&Step{CreateDisks: &CreateDisks{
+				{Disk: compute.Disk{SourceImage: "projects/p/global/images/family/f"}, SizeGb: "50"},
+			}},
+			10*time.Minute + 50*time.Second,
+		},
+		{
+			"snapshots",
+			&Step{CreateSnapshots: &CreateSnapshots{
+				{Snapshot: compute.Snapshot{SourceDisk: "zones/z/disks/small"}},
+			}},
+			10*time.Minute + 10*time.Second,
+		},
+		{
+			"error keeps timeout",
+			&Step{CreateSnapshots: &CreateSnapshots{
+				{Snapshot: compute.Snapshot{SourceDisk: "zones/z/disks/dne"}},
+			}},
+			10 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		tt.step.w = w
+		tt.step.name = "s"
+		tt.step.timeout = 10 * time.Minute
+		tt.step.timeoutPerGb = time.Second
+		tt.step.scaleTimeout()
+		if tt.step.timeout != tt.want {
+			t.Errorf("%s: timeout = %s, want %s", tt.desc, tt.step.timeout, tt.want)
+		}
+	}
+}
+
+func TestPopulateStepTimeoutPerGb(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.DefaultTimeout = "10m"
+
+	s := &Step{name: "s", w: w, TimeoutPerGb: "30s", CreateSnapshots: &CreateSnapshots{}}
+	if err := w.populateStep(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.timeoutPerGb != 30*time.Second {
+		t.Errorf("timeoutPerGb = %s, want 30s", s.timeoutPerGb)
+	}
+
+	s = &Step{name: "s", w: w, TimeoutPerGb: "bad", CreateSnapshots: &CreateSnapshots{}}
+	if err := w.populateStep(ctx, s); err == nil {
+		t.Error("expected error for invalid TimeoutPerGb")
+	}
+	s = &Step{name: "s", w: w, TimeoutPerGb: "30s", StopInstances: &StopInstances{}}
+	if err := w.populateStep(ctx, s); err == nil {
+		t.Error("expected error for unsupported step type")
+	}
+}
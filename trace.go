@@ -0,0 +1,112 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"sort"
+	"time"
+)
+
+// StepTrace describes how a single step spent its time during a run.
+type StepTrace struct {
+	Name string
+	// Wait is the time between the step becoming runnable (all of its
+	// dependencies finished) and the step starting.
+	Wait time.Duration
+	// Work is the time the step spent running.
+	Work time.Duration
+}
+
+// RunTrace is the execution trace of a workflow run.
+type RunTrace struct {
+	// Steps holds one entry per executed step, ordered by start time.
+	Steps []StepTrace
+	// CriticalPath is the chain of steps that determined the total run
+	// duration, in execution order.
+	CriticalPath []string
+	// Duration is the time from the first step starting to the last step
+	// finishing.
+	Duration time.Duration
+}
+
+// Trace analyzes the step time records of a finished run and returns the
+// per-step wait/work breakdown and the critical path through the DAG.
+// Only the steps of this workflow are considered; steps of included
+// workflows are accounted for as part of their IncludeWorkflow step.
+func (w *Workflow) Trace() *RunTrace {
+	records := map[string]TimeRecord{}
+	for _, r := range w.GetStepTimeRecords() {
+		if _, ok := w.Steps[r.Name]; ok {
+			records[r.Name] = r
+		}
+	}
+	trace := &RunTrace{}
+	if len(records) == 0 {
+		return trace
+	}
+
+	var start, end time.Time
+	for _, r := range records {
+		if start.IsZero() || r.StartTime.Before(start) {
+			start = r.StartTime
+		}
+		if r.EndTime.After(end) {
+			end = r.EndTime
+		}
+	}
+	trace.Duration = end.Sub(start)
+
+	// lastDep returns the dependency of name that finished last, if any.
+	lastDep := func(name string) (string, bool) {
+		var dep string
+		var depEnd time.Time
+		for _, d := range w.Dependencies[name] {
+			if r, ok := records[d]; ok && (dep == "" || r.EndTime.After(depEnd)) {
+				dep, depEnd = d, r.EndTime
+			}
+		}
+		return dep, dep != ""
+	}
+
+	var last string
+	for name, r := range records {
+		ready := start
+		if dep, ok := lastDep(name); ok {
+			ready = records[dep].EndTime
+		}
+		wait := r.StartTime.Sub(ready)
+		if wait < 0 {
+			wait = 0
+		}
+		trace.Steps = append(trace.Steps, StepTrace{Name: name, Wait: wait, Work: r.EndTime.Sub(r.StartTime)})
+		if last == "" || r.EndTime.After(records[last].EndTime) {
+			last = name
+		}
+	}
+	sort.Slice(trace.Steps, func(i, j int) bool {
+		ri, rj := records[trace.Steps[i].Name], records[trace.Steps[j].Name]
+		if ri.StartTime.Equal(rj.StartTime) {
+			return trace.Steps[i].Name < trace.Steps[j].Name
+		}
+		return ri.StartTime.Before(rj.StartTime)
+	})
+
+	// Walk back from the last step to finish, always following the
+	// dependency that finished last.
+	for name, ok := last, true; ok; name, ok = lastDep(name) {
+		trace.CriticalPath = append([]string{name}, trace.CriticalPath...)
+	}
+	return trace
+}
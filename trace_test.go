@@ -0,0 +1,62 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	w := testWorkflow()
+	for _, n := range []string{"a", "b", "c", "d"} {
+		w.NewStep(n)
+	}
+	// a -> b -> d, a -> c -> d. b is the long branch.
+	w.Dependencies = map[string][]string{"b": {"a"}, "c": {"a"}, "d": {"b", "c"}}
+	t0 := time.Now()
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	w.stepTimeRecords = []TimeRecord{
+		{"a", at(0), at(5)},
+		{"b", at(5), at(40)},
+		{"c", at(7), at(10)},
+		{"d", at(41), at(50)},
+		{"workflow cleanup", at(50), at(52)},
+	}
+
+	got := w.Trace()
+	want := &RunTrace{
+		Steps: []StepTrace{
+			{Name: "a", Wait: 0, Work: 5 * time.Minute},
+			{Name: "b", Wait: 0, Work: 35 * time.Minute},
+			{Name: "c", Wait: 2 * time.Minute, Work: 3 * time.Minute},
+			{Name: "d", Wait: 1 * time.Minute, Work: 9 * time.Minute},
+		},
+		CriticalPath: []string{"a", "b", "d"},
+		Duration:     50 * time.Minute,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected trace:\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestTraceNoRecords(t *testing.T) {
+	w := testWorkflow()
+	w.NewStep("a")
+	if got := w.Trace(); len(got.Steps) != 0 || len(got.CriticalPath) != 0 || got.Duration != 0 {
+		t.Errorf("expected empty trace, got %+v", got)
+	}
+}
@@ -0,0 +1,106 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// imageRef is an image referenced by a resource the workflow creates.
+type imageRef struct {
+	// w is the workflow of the referencing resource.
+	w *Workflow
+	// what references the image, for error messages.
+	what string
+	// project of the referencing resource, used for images given as
+	// "global/images/...".
+	project string
+	image   string
+}
+
+// imageProject returns the project image src resolves to, or "" if it
+// cannot be determined. Images created in the workflow resolve to the project
+// they are created in, partial URLs without a project to project.
+func (w *Workflow) imageProject(src, project string) string {
+	if res, ok := w.images.get(src); ok {
+		src = res.link
+	}
+	if i := strings.Index(src, "projects/"); i > 0 {
+		src = src[i:]
+	}
+	if !imageURLRgx.MatchString(src) {
+		return ""
+	}
+	return strOr(NamedSubexp(imageURLRgx, src)["project"], project)
+}
+
+// imageRefs returns the source images of the instances, disks and images
+// created by w and the workflows its steps run.
+func imageRefs(w *Workflow) []imageRef {
+	var refs []imageRef
+	walkSteps(w, func(s *Step) {
+		switch {
+		case s.CreateInstances != nil:
+			for _, i := range s.CreateInstances.Instances {
+				for _, d := range i.Disks {
+					if d.InitializeParams != nil && d.InitializeParams.SourceImage != "" {
+						refs = append(refs, imageRef{s.w, fmt.Sprintf("instance %q", i.Name), i.Project, d.InitializeParams.SourceImage})
+					}
+				}
+			}
+			for _, i := range s.CreateInstances.InstancesBeta {
+				for _, d := range i.Disks {
+					if d.InitializeParams != nil && d.InitializeParams.SourceImage != "" {
+						refs = append(refs, imageRef{s.w, fmt.Sprintf("instance %q", i.Name), i.Project, d.InitializeParams.SourceImage})
+					}
+				}
+			}
+		case s.CreateDisks != nil:
+			for _, d := range *s.CreateDisks {
+				if d.SourceImage != "" {
+					refs = append(refs, imageRef{s.w, fmt.Sprintf("disk %q", d.Name), d.Project, d.SourceImage})
+				}
+			}
+		case s.CreateImages != nil:
+			for _, i := range s.CreateImages.Images {
+				if i.SourceImage != "" {
+					refs = append(refs, imageRef{s.w, fmt.Sprintf("image %q", i.Name), i.Project, i.SourceImage})
+				}
+			}
+			for _, i := range s.CreateImages.ImagesBeta {
+				if i.SourceImage != "" {
+					refs = append(refs, imageRef{s.w, fmt.Sprintf("image %q", i.Name), i.Project, i.SourceImage})
+				}
+			}
+		}
+	})
+	return refs
+}
+
+// checkTrustedImageProjects checks that every source image of the workflow
+// resolves to one of TrustedImageProjects.
+func (w *Workflow) checkTrustedImageProjects() DError {
+	var errs DError
+	for _, ref := range imageRefs(w) {
+		p := ref.w.imageProject(ref.image, ref.project)
+		if p == "" {
+			errs = addErrs(errs, Errf("%s: cannot determine the project of image %q, TrustedImageProjects: %q", ref.what, ref.image, w.TrustedImageProjects))
+		} else if !strIn(p, w.TrustedImageProjects) {
+			errs = addErrs(errs, Errf("%s: image %q is from project %q, which is not one of TrustedImageProjects %q", ref.what, ref.image, p, w.TrustedImageProjects))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,75 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestImageProject(t *testing.T) {
+	w := testWorkflow()
+	w.images.m = map[string]*Resource{"created": {link: "projects/img-project/global/images/created-abcdef"}}
+	tests := []struct {
+		src, want string
+	}{
+		{"projects/debian-cloud/global/images/family/debian-11", "debian-cloud"},
+		{"https://www.googleapis.com/compute/v1/projects/debian-cloud/global/images/debian-11-v1", "debian-cloud"},
+		{"global/images/mine", "default-project"},
+		{"created", "img-project"},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := w.imageProject(tt.src, "default-project"); got != tt.want {
+			t.Errorf("imageProject(%q): got %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTrustedImageProjects(t *testing.T) {
+	ctx := context.Background()
+	iw := New()
+	iw.Steps = map[string]*Step{
+		"disk": {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "d", SourceImage: "projects/untrusted/global/images/i"}}}},
+	}
+	w := testWorkflow()
+	w.TrustedImageProjects = []string{"debian-cloud"}
+	w.Steps = map[string]*Step{
+		"create": {CreateInstances: &CreateInstances{Instances: []*Instance{{Instance: compute.Instance{
+			Name:  "i",
+			Disks: []*compute.AttachedDisk{{InitializeParams: &compute.AttachedDiskInitializeParams{SourceImage: "projects/debian-cloud/global/images/family/debian-11"}}},
+		}}}}},
+		"include": {IncludeWorkflow: &IncludeWorkflow{Workflow: iw}},
+	}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	err := w.checkTrustedImageProjects()
+	if err == nil || !strings.Contains(err.Error(), `"untrusted"`) {
+		t.Fatalf("expected error for image of included workflow, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "debian-cloud/global") {
+		t.Errorf("unexpected error for trusted image: %v", err)
+	}
+
+	w.TrustedImageProjects = append(w.TrustedImageProjects, "untrusted")
+	if err := w.checkTrustedImageProjects(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"google.golang.org/api/compute/v1"
+)
+
+// ResourceUsage is a count of GCE resources alive at the same time.
+type ResourceUsage struct {
+	Instances   int
+	Disks       int
+	CPUs        int64
+	ExternalIPs int
+}
+
+// stepSlot is the range of schedule slots [start, end) a step occupies.
+type stepSlot struct {
+	start, end int
+}
+
+// nestedWorkflow returns the workflow run by s, if any.
+func nestedWorkflow(s *Step) *Workflow {
+	switch {
+	case s.IncludeWorkflow != nil:
+		return s.IncludeWorkflow.Workflow
+	case s.SubWorkflow != nil:
+		return s.SubWorkflow.Workflow
+	case s.TestBootImage != nil && s.TestBootImage.include != nil:
+		return s.TestBootImage.include.Workflow
+	case s.InspectDisk != nil && s.InspectDisk.include != nil:
+		return s.InspectDisk.include.Workflow
+	case s.ExportImage != nil && s.ExportImage.include != nil:
+		return s.ExportImage.include.Workflow
+	case s.ImportDisk != nil && s.ImportDisk.include != nil:
+		return s.ImportDisk.include.Workflow
+	case s.CloneInstance != nil && s.CloneInstance.include != nil:
+		return s.CloneInstance.include.Workflow
+	}
+	return nil
+}
+
+// oneSlot is the length of every step when only their order matters.
+func oneSlot(*Step) int { return 1 }
+
+// scheduleSteps assigns each step of w, and of any included or sub
+// workflows, a range of slots assuming each step takes length(s) slots, or as
+// long as its nested workflow, and there is no concurrency limit. w starts at
+// slot offset. Returns the slot after the last step of w finishes.
+func scheduleSteps(w *Workflow, offset int, length func(s *Step) int, slots map[*Step]stepSlot) int {
+	end := offset
+	var schedule func(name string) stepSlot
+	schedule = func(name string) stepSlot {
+		s := w.Steps[name]
+		if slot, ok := slots[s]; ok {
+			return slot
+		}
+		start := offset
+		for _, dep := range w.Dependencies[name] {
+			if _, ok := w.Steps[dep]; !ok {
+				continue
+			}
+			if depSlot := schedule(dep); depSlot.end > start {
+				start = depSlot.end
+			}
+		}
+		slot := stepSlot{start: start, end: start + length(s)}
+		if child := nestedWorkflow(s); child != nil {
+			if childEnd := scheduleSteps(child, start, length, slots); childEnd > slot.end {
+				slot.end = childEnd
+			}
+		}
+		slots[s] = slot
+		return slot
+	}
+	for name := range w.Steps {
+		if slot := schedule(name); slot.end > end {
+			end = slot.end
+		}
+	}
+	return end
+}
+
+// instanceInfo is what resource estimates need of an instance definition.
+type instanceInfo struct {
+	machineType string
+	externalIPs int
+}
+
+// instanceInfos indexes the instance definitions of w and of its nested
+// workflows by their registry resource.
+func instanceInfos(w *Workflow) map[*Resource]instanceInfo {
+	instances := map[*Resource]instanceInfo{}
+	var collect func(w *Workflow)
+	collect = func(w *Workflow) {
+		for _, s := range w.Steps {
+			switch {
+			case s.CreateInstances != nil:
+				for _, i := range s.CreateInstances.Instances {
+					info := instanceInfo{machineType: i.MachineType}
+					for _, n := range i.NetworkInterfaces {
+						info.externalIPs += len(n.AccessConfigs)
+					}
+					instances[&i.Resource] = info
+				}
+				for _, i := range s.CreateInstances.InstancesBeta {
+					info := instanceInfo{machineType: i.MachineType}
+					for _, n := range i.NetworkInterfaces {
+						info.externalIPs += len(n.AccessConfigs)
+					}
+					instances[&i.Resource] = info
+				}
+			case nestedWorkflow(s) != nil:
+				collect(nestedWorkflow(s))
+			}
+		}
+	}
+	collect(w)
+	return instances
+}
+
+// lookupMachineType returns the machine type at url, nil for an empty url,
+// getting each one from the API once for the cache given.
+func (w *Workflow) lookupMachineType(url string, cache map[string]*compute.MachineType) (*compute.MachineType, DError) {
+	if url == "" {
+		return nil, nil
+	}
+	if mt, ok := cache[url]; ok {
+		return mt, nil
+	}
+	m := NamedSubexp(machineTypeURLRegex, url)
+	mt, err := w.ComputeClient.GetMachineType(m["project"], m["zone"], m["machinetype"])
+	if err != nil {
+		return nil, typedErr(apiError, "failed to get machine type", err)
+	}
+	cache[url] = mt
+	return mt, nil
+}
+
+// registryScope is a workflow with its own resource registries, and the slot
+// its resources not explicitly deleted are cleaned up at.
+type registryScope struct {
+	w   *Workflow
+	end int
+}
+
+// registryScopes returns w, whose resources live until slot end, and the
+// SubWorkflows run by it or by its included workflows, whose resources live
+// until their SubWorkflow step ends. Included workflows share the registries
+// of the workflow including them.
+func registryScopes(w *Workflow, end int, slots map[*Step]stepSlot) []registryScope {
+	scopes := []registryScope{{w: w, end: end}}
+	var collect func(w *Workflow)
+	collect = func(w *Workflow) {
+		for _, s := range w.Steps {
+			switch child := nestedWorkflow(s); {
+			case s.SubWorkflow != nil && child != nil:
+				scopes = append(scopes, registryScopes(child, slots[s].end, slots)...)
+			case child != nil:
+				collect(child)
+			}
+		}
+	}
+	collect(w)
+	return scopes
+}
+
+// EstimatePeakResourceUsage walks the workflow DAG and estimates the maximum
+// number of instances, disks, CPUs and external IPs alive at any point of the
+// run, assuming every step that can run concurrently does. Included workflows
+// and SubWorkflows are counted too. Resources that are not explicitly deleted
+// are considered alive until the end of the run, or of their SubWorkflow.
+// The workflow must have been validated, so resource registries are populated.
+func (w *Workflow) EstimatePeakResourceUsage() (ResourceUsage, DError) {
+	slots := map[*Step]stepSlot{}
+	total := scheduleSteps(w, 0, oneSlot, slots)
+	usage := make([]ResourceUsage, total+1)
+
+	instances := instanceInfos(w)
+	machineTypes := map[string]*compute.MachineType{}
+	for _, scope := range registryScopes(w, total, slots) {
+		lifetime := func(res *Resource) (int, int) {
+			start := slots[res.creator].start
+			end := scope.end
+			if res.deleter != nil {
+				end = slots[res.deleter].end
+			}
+			return start, end
+		}
+
+		for _, res := range scope.w.instances.m {
+			if res.creator == nil {
+				continue
+			}
+			info := instances[res]
+			mt, err := w.lookupMachineType(info.machineType, machineTypes)
+			if err != nil {
+				return ResourceUsage{}, err
+			}
+			var cpus int64
+			if mt != nil {
+				cpus = mt.GuestCpus
+			}
+			start, end := lifetime(res)
+			for i := start; i < end; i++ {
+				usage[i].Instances++
+				usage[i].CPUs += cpus
+				usage[i].ExternalIPs += info.externalIPs
+			}
+		}
+		for _, res := range scope.w.disks.m {
+			if res.creator == nil {
+				continue
+			}
+			start, end := lifetime(res)
+			for i := start; i < end; i++ {
+				usage[i].Disks++
+			}
+		}
+	}
+
+	var peak ResourceUsage
+	for _, u := range usage {
+		if u.Instances > peak.Instances {
+			peak.Instances = u.Instances
+		}
+		if u.Disks > peak.Disks {
+			peak.Disks = u.Disks
+		}
+		if u.CPUs > peak.CPUs {
+			peak.CPUs = u.CPUs
+		}
+		if u.ExternalIPs > peak.ExternalIPs {
+			peak.ExternalIPs = u.ExternalIPs
+		}
+	}
+	return peak, nil
+}
@@ -0,0 +1,151 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestEstimatePeakResourceUsage(t *testing.T) {
+	w := testWorkflow()
+	c, _ := newTestGCEClient()
+	c.GetMachineTypeFn = func(_, _, mt string) (*compute.MachineType, error) {
+		switch mt {
+		case "n1-standard-4":
+			return &compute.MachineType{GuestCpus: 4}, nil
+		case "n1-standard-2":
+			return &compute.MachineType{GuestCpus: 2}, nil
+		}
+		return nil, errors.New("bad machinetype")
+	}
+	w.ComputeClient = c
+
+	mt := func(name string) string {
+		return fmt.Sprintf("projects/%s/zones/%s/machineTypes/%s", testProject, testZone, name)
+	}
+	ips := func(n int) []*compute.NetworkInterface {
+		ni := &compute.NetworkInterface{}
+		for i := 0; i < n; i++ {
+			ni.AccessConfigs = append(ni.AccessConfigs, &compute.AccessConfig{})
+		}
+		return []*compute.NetworkInterface{ni}
+	}
+	i1 := &Instance{Instance: compute.Instance{MachineType: mt("n1-standard-4"), NetworkInterfaces: ips(1)}}
+	i2 := &Instance{Instance: compute.Instance{MachineType: mt("n1-standard-4"), NetworkInterfaces: ips(0)}}
+	i3 := &Instance{Instance: compute.Instance{MachineType: mt("n1-standard-2"), NetworkInterfaces: ips(2)}}
+	d1 := &Disk{}
+
+	// a -> b -> c -> e, x runs alongside.
+	a := &Step{name: "a", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i1}}}
+	x := &Step{name: "x", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i2}}}
+	b := &Step{name: "b", w: w, CreateDisks: &CreateDisks{d1}}
+	c2 := &Step{name: "c", w: w, DeleteResources: &DeleteResources{Instances: []string{"i1"}}}
+	e := &Step{name: "e", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i3}}}
+	w.Steps = map[string]*Step{"a": a, "x": x, "b": b, "c": c2, "e": e}
+	w.Dependencies = map[string][]string{"b": {"a"}, "c": {"b"}, "e": {"c"}}
+
+	i1.creator, i1.deleter = a, c2
+	i2.creator = x
+	i3.creator = e
+	d1.creator = b
+	w.instances.m = map[string]*Resource{"i1": &i1.Resource, "i2": &i2.Resource, "i3": &i3.Resource}
+	w.disks.m = map[string]*Resource{"d1": &d1.Resource}
+
+	got, err := w.EstimatePeakResourceUsage()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ResourceUsage{Instances: 2, Disks: 1, CPUs: 8, ExternalIPs: 2}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("resource usage does not match expectation: (-got +want)\n%s", diffRes)
+	}
+
+	c.GetMachineTypeFn = func(_, _, _ string) (*compute.MachineType, error) {
+		return nil, errors.New("error")
+	}
+	if _, err := w.EstimatePeakResourceUsage(); err == nil {
+		t.Error("expected error from machine type lookup")
+	}
+}
+
+func TestScheduleStepsIncludeWorkflow(t *testing.T) {
+	w := testWorkflow()
+	child := testWorkflow()
+	c1 := &Step{name: "c1", w: child}
+	c2 := &Step{name: "c2", w: child}
+	child.Steps = map[string]*Step{"c1": c1, "c2": c2}
+	child.Dependencies = map[string][]string{"c2": {"c1"}}
+
+	inc := &Step{name: "inc", w: w, IncludeWorkflow: &IncludeWorkflow{Workflow: child}}
+	after := &Step{name: "after", w: w}
+	w.Steps = map[string]*Step{"inc": inc, "after": after}
+	w.Dependencies = map[string][]string{"after": {"inc"}}
+
+	slots := map[*Step]stepSlot{}
+	if got := scheduleSteps(w, 0, oneSlot, slots); got != 3 {
+		t.Errorf("schedule length: got %d, want 3", got)
+	}
+	want := map[*Step]stepSlot{c1: {0, 1}, c2: {1, 2}, inc: {0, 2}, after: {2, 3}}
+	for s, slot := range want {
+		if slots[s] != slot {
+			t.Errorf("step %q: got slot %v, want %v", s.name, slots[s], slot)
+		}
+	}
+}
+
+func TestEstimatePeakResourceUsageSubWorkflow(t *testing.T) {
+	w := testWorkflow()
+	c, _ := newTestGCEClient()
+	c.GetMachineTypeFn = func(_, _, _ string) (*compute.MachineType, error) {
+		return &compute.MachineType{GuestCpus: 4}, nil
+	}
+	w.ComputeClient = c
+	mt := fmt.Sprintf("projects/%s/zones/%s/machineTypes/n1-standard-4", testProject, testZone)
+
+	// The resources of the SubWorkflow are cleaned up when it ends, before
+	// "after" runs. x runs alongside.
+	sw := testWorkflow()
+	si := &Instance{Instance: compute.Instance{MachineType: mt}}
+	sd := &Disk{}
+	create := &Step{name: "create", w: sw, CreateInstances: &CreateInstances{Instances: []*Instance{si}}, CreateDisks: &CreateDisks{sd}}
+	sw.Steps = map[string]*Step{"create": create}
+	si.creator, sd.creator = create, create
+	sw.instances.m = map[string]*Resource{"si": &si.Resource}
+	sw.disks.m = map[string]*Resource{"sd": &sd.Resource}
+
+	i := &Instance{Instance: compute.Instance{MachineType: mt}}
+	d := &Disk{}
+	sub := &Step{name: "sub", w: w, SubWorkflow: &SubWorkflow{Workflow: sw}}
+	x := &Step{name: "x", w: w, CreateDisks: &CreateDisks{d}}
+	after := &Step{name: "after", w: w, CreateInstances: &CreateInstances{Instances: []*Instance{i}}}
+	w.Steps = map[string]*Step{"sub": sub, "x": x, "after": after}
+	w.Dependencies = map[string][]string{"after": {"sub"}}
+	i.creator, d.creator = after, x
+	w.instances.m = map[string]*Resource{"i": &i.Resource}
+	w.disks.m = map[string]*Resource{"d": &d.Resource}
+
+	got, err := w.EstimatePeakResourceUsage()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ResourceUsage{Instances: 1, Disks: 2, CPUs: 4}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("resource usage does not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
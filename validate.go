@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 var (
@@ -66,23 +67,36 @@ func (w *Workflow) validateRequiredFields() DError {
 }
 
 func (w *Workflow) validate(ctx context.Context) DError {
+	w.registerIsolatedNetwork()
+	if err := w.registerExternalResources(); err != nil {
+		w.reportValidationError(nil, w.fieldPath("ExternalResources"), err)
+		return err
+	}
 	return w.validateDAG(ctx)
 }
 
-// Step through the step DAG, calling each step's validate().
+// Step through the step DAG, calling each step's validate(). All steps are
+// validated but those depending on a step failing validation, and the errors
+// of all steps returned.
 func (w *Workflow) validateDAG(ctx context.Context) DError {
+	w.addCompletionDependencies()
+
 	// Sanitation.
 	for s, deps := range w.Dependencies {
 		// Check for missing steps.
 		if _, ok := w.Steps[s]; !ok {
-			return Errf("dependencies reference non existent step %q: %q:%q", s, s, deps)
+			err := Errf("dependencies reference non existent step %q: %q:%q", s, s, deps)
+			w.reportValidationError(nil, w.fieldPath("Dependencies"), err)
+			return err
 		}
 		seen := map[string]bool{}
 		var clean []string
 		for _, dep := range deps {
 			// Check for missing dependencies.
 			if _, ok := w.Steps[dep]; !ok {
-				return Errf("dependencies reference non existent step %q: %q:%q", dep, s, deps)
+				err := Errf("dependencies reference non existent step %q: %q:%q", dep, s, deps)
+				w.reportValidationError(nil, w.fieldPath("Dependencies"), err)
+				return err
 			}
 			// Remove duplicate dependencies.
 			if !seen[dep] {
@@ -96,10 +110,39 @@ func (w *Workflow) validateDAG(ctx context.Context) DError {
 	// Check for cycles.
 	for _, s := range w.Steps {
 		if s.depends(s) {
-			return Errf("cyclic dependency on step %v", s)
+			err := Errf("cyclic dependency on step %v", s)
+			w.reportValidationError(nil, w.fieldPath("Dependencies"), err)
+			return err
 		}
 	}
-	return w.traverseDAG(func(s *Step) DError { return s.validate(ctx) })
+
+	var mx sync.Mutex
+	var failed []*Step
+	var errs DError
+	if err := w.traverseDAG(func(s *Step) DError {
+		mx.Lock()
+		for _, f := range failed {
+			if s.depends(f) {
+				// Its errors would likely be caused by those of f.
+				mx.Unlock()
+				return nil
+			}
+		}
+		mx.Unlock()
+
+		err := s.validate(ctx)
+		if err != nil {
+			mx.Lock()
+			failed = append(failed, s)
+			errs = addErrs(errs, err)
+			mx.Unlock()
+		}
+		return nil
+	}); err != nil {
+		w.reportValidationError(nil, w.jsonPath(), err)
+		return err
+	}
+	return errs
 }
 
 func (w *Workflow) validateVarsSubbed() DError {
@@ -161,6 +161,38 @@ func TestValidateDAG(t *testing.T) {
 	if err := w.validateDAG(ctx); err == nil {
 		t.Error("step 2 should have failed validation")
 	}
+	// Steps depending on step 2 are skipped, the others validated.
+	if want := []int{1, 1, 1, 0, 1}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("validation calls: got %v, want %v", calls, want)
+	}
+
+	// Reset.
+	reset()
+
+	// Failed steps 1 and 4, both errors returned.
+	errs[1] = Errf("fail 1")
+	errs[4] = Errf("fail 4")
+	if err := w.validateDAG(ctx); err == nil || len(err.errors()) != 2 {
+		t.Errorf("steps 1 and 4 should have failed validation, got: %v", err)
+	}
+
+	// Reset.
+	reset()
+
+	// Dependencies on the completion of steps are dependencies too.
+	w.Steps["s4"].DependsOnCompletionOf = []string{"s3"}
+	if err := w.validateDAG(ctx); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(w.Dependencies["s4"], []string{"s3"}) {
+		t.Errorf("completion dependency not added: %q", w.Dependencies["s4"])
+	}
+	w.Steps["s4"].DependsOnCompletionOf = []string{"dne"}
+	if err := w.validateDAG(ctx); err == nil {
+		t.Error("validation should have failed due to missing completion dependency")
+	}
+	w.Steps["s4"].DependsOnCompletionOf = nil
+	w.Dependencies["s4"] = nil
 
 	// Reset.
 	reset()
@@ -0,0 +1,167 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities of ValidationIssues.
+const (
+	// SeverityError issues make a workflow invalid.
+	SeverityError = "ERROR"
+	// SeverityWarning issues, such as the use of deprecated fields, do not.
+	SeverityWarning = "WARNING"
+)
+
+// ValidationIssue is an error or warning found validating a workflow.
+type ValidationIssue struct {
+	// Severity is SeverityError or SeverityWarning.
+	Severity string
+	// Step is the name of the step of the issue, empty for an issue of a
+	// workflow.
+	Step string
+	// Path is the JSON path of the issue in the workflow, nested workflows
+	// included, e.g. "Steps.create-disks.CreateDisks[0].SizeGb".
+	Path string
+	// Message describes the issue.
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// ValidationReport holds the issues found validating a workflow. Unlike the
+// error returned by Validate, it tells where the issues are, and holds the
+// warnings.
+type ValidationReport struct {
+	Issues []ValidationIssue
+}
+
+// Errors returns the issues of severity SeverityError.
+func (r *ValidationReport) Errors() []ValidationIssue {
+	return r.withSeverity(SeverityError)
+}
+
+// Warnings returns the issues of severity SeverityWarning.
+func (r *ValidationReport) Warnings() []ValidationIssue {
+	return r.withSeverity(SeverityWarning)
+}
+
+func (r *ValidationReport) withSeverity(severity string) []ValidationIssue {
+	var is []ValidationIssue
+	for _, i := range r.Issues {
+		if i.Severity == severity {
+			is = append(is, i)
+		}
+	}
+	return is
+}
+
+func (r *ValidationReport) String() string {
+	lines := make([]string, len(r.Issues))
+	for n, i := range r.Issues {
+		lines[n] = i.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidationReport returns the issues found by the last Validate of w, an
+// empty report if it was not validated.
+func (w *Workflow) ValidationReport() *ValidationReport {
+	root := w.root()
+	root.validationReportMx.Lock()
+	defer root.validationReportMx.Unlock()
+	return &ValidationReport{Issues: append([]ValidationIssue(nil), root.validationIssues...)}
+}
+
+func (w *Workflow) resetValidationReport() {
+	root := w.root()
+	root.validationReportMx.Lock()
+	defer root.validationReportMx.Unlock()
+	root.validationIssues = nil
+}
+
+func (w *Workflow) addValidationIssue(i ValidationIssue) {
+	root := w.root()
+	root.validationReportMx.Lock()
+	defer root.validationReportMx.Unlock()
+	root.validationIssues = append(root.validationIssues, i)
+}
+
+// reportValidationError records the errors of err, found validating w or,
+// if s is not nil, step s of w, at the JSON path path.
+func (w *Workflow) reportValidationError(s *Step, path string, err DError) {
+	if err == nil {
+		return
+	}
+	step := ""
+	if s != nil {
+		step = s.name
+	}
+	for _, e := range err.errors() {
+		w.addValidationIssue(ValidationIssue{Severity: SeverityError, Step: step, Path: path, Message: e.Error()})
+	}
+}
+
+// warnf records a warning found validating s, at the JSON path field of the
+// step, e.g. "CreateNetworks[0].IPv4Range".
+func (s *Step) warnf(field, format string, a ...interface{}) {
+	s.w.addValidationIssue(ValidationIssue{Severity: SeverityWarning, Step: s.name, Path: s.jsonPath() + "." + field, Message: fmt.Sprintf(format, a...)})
+}
+
+// jsonPath returns the JSON path of w in the root workflow, "" for the root.
+func (w *Workflow) jsonPath() string {
+	if w.parent == nil {
+		return ""
+	}
+	for _, ps := range w.parent.Steps {
+		switch {
+		case ps.SubWorkflow != nil && ps.SubWorkflow.Workflow == w:
+			return ps.jsonPath() + ".SubWorkflow.Workflow"
+		case ps.IncludeWorkflow != nil && ps.IncludeWorkflow.Workflow == w:
+			return ps.jsonPath() + ".IncludeWorkflow.Workflow"
+		}
+	}
+	return ""
+}
+
+// jsonPath returns the JSON path of s in the root workflow, e.g.
+// "Steps.create-disks".
+func (s *Step) jsonPath() string {
+	if p := s.w.jsonPath(); p != "" {
+		return p + ".Steps." + s.name
+	}
+	return "Steps." + s.name
+}
+
+// fieldPath returns the JSON path of field in w, e.g. "Dependencies".
+func (w *Workflow) fieldPath(field string) string {
+	if p := w.jsonPath(); p != "" {
+		return p + "." + field
+	}
+	return field
+}
+
+// nestsWorkflow reports whether s runs a nested workflow, whose steps report
+// their own validation errors.
+func (s *Step) nestsWorkflow() bool {
+	return s.SubWorkflow != nil || s.IncludeWorkflow != nil
+}
@@ -0,0 +1,87 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+)
+
+func TestValidationReport(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	failValidate := &mockStep{validateImpl: func(ctx context.Context, s *Step) DError { return Errf("bad %s", s.name) }}
+	sw := w.NewSubWorkflow()
+	sw.Steps = map[string]*Step{"child": {w: sw, testType: failValidate}}
+	w.Steps = map[string]*Step{
+		"net": {w: w, CreateNetworks: &CreateNetworks{
+			{Network: compute.Network{Name: "net", IPv4Range: "10.0.0.0/24"}},
+		}},
+		"fw": {w: w, CreateFirewallRules: &CreateFirewallRules{
+			{Firewall: compute.Firewall{Name: "ssh", Network: "net", SourceRanges: []string{"10.0.0.0/8"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"22"}}}}},
+			{Firewall: compute.Firewall{Name: "open", Network: "net", SourceRanges: []string{"0.0.0.0/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp"}}}},
+		}},
+		"bad":       {w: w, testType: failValidate},
+		"after-bad": {w: w, testType: failValidate},
+		"sub":       {w: w, SubWorkflow: &SubWorkflow{Workflow: sw}},
+	}
+	w.Dependencies = map[string][]string{"fw": {"net"}, "after-bad": {"bad"}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	err := w.validate(ctx)
+	if err == nil || len(err.errors()) != 2 {
+		t.Errorf("want the errors of steps bad and child, got: %v", err)
+	}
+	got := w.ValidationReport().Issues
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	want := []ValidationIssue{
+		{Severity: SeverityError, Step: "bad", Path: "Steps.bad.mockStep", Message: "bad bad"},
+		{Severity: SeverityWarning, Step: "fw", Path: "Steps.fw.CreateFirewallRules[1].SourceRanges", Message: `firewall rule "open" allows all ports from any source`},
+		{Severity: SeverityWarning, Step: "net", Path: "Steps.net.CreateNetworks[0].IPv4Range", Message: "IPv4Range is deprecated: it creates a legacy network, use subnetworks instead"},
+		{Severity: SeverityError, Step: "child", Path: "Steps.sub.SubWorkflow.Workflow.Steps.child.mockStep", Message: "bad child"},
+	}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("validation report does not match expectation: (-got +want)\n%s", diffRes)
+	}
+	if n := len(w.ValidationReport().Warnings()); n != 2 {
+		t.Errorf("got %d warnings, want 2", n)
+	}
+}
+
+func TestFirewallRuleAllowsAnyIngress(t *testing.T) {
+	tests := []struct {
+		desc string
+		fw   compute.Firewall
+		want bool
+	}{
+		{"all protocols", compute.Firewall{SourceRanges: []string{"0.0.0.0/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}}, true},
+		{"all udp ports, IPv6", compute.Firewall{SourceRanges: []string{"::/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "udp"}}}, true},
+		{"some ports", compute.Firewall{SourceRanges: []string{"0.0.0.0/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"443"}}}}, false},
+		{"icmp", compute.Firewall{SourceRanges: []string{"0.0.0.0/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "icmp"}}}, false},
+		{"some sources", compute.Firewall{SourceRanges: []string{"10.0.0.0/8"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}}, false},
+		{"egress", compute.Firewall{Direction: "EGRESS", SourceRanges: []string{"0.0.0.0/0"}, Allowed: []*compute.FirewallAllowed{{IPProtocol: "all"}}}, false},
+	}
+	for _, tt := range tests {
+		fir := &FirewallRule{Firewall: tt.fw}
+		if got := fir.allowsAnyIngress(); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.desc, got, tt.want)
+		}
+	}
+}
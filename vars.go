@@ -0,0 +1,195 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// setVarValue sets the value of the declared var k, keeping its other
+// attributes.
+func (w *Workflow) setVarValue(k, v string) {
+	vr := w.Vars[k]
+	vr.Value = v
+	w.Vars[k] = vr
+}
+
+// PopulateVarsFromEnv sets each declared var from the environment variable
+// named prefix followed by the var name, if it is set. Vars that aren't
+// declared by the workflow are ignored.
+func (w *Workflow) PopulateVarsFromEnv(prefix string) {
+	for k := range w.Vars {
+		if v, ok := os.LookupEnv(prefix + k); ok {
+			w.setVarValue(k, v)
+		}
+	}
+}
+
+// AddVarsFromFile sets vars from a file holding a single JSON or YAML object
+// of var names to scalar values. Files with a .yaml or .yml extension are
+// read as YAML, others as JSON. Values override those already set, so files
+// added later take precedence. All vars in the file must be declared by the
+// workflow.
+func (w *Workflow) AddVarsFromFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read var file %q: %v", file, err)
+	}
+	var vars map[string]interface{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &vars)
+	default:
+		// Numbers are kept as written, float64 would format large integers
+		// with an exponent.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err = dec.Decode(&vars); err == nil && dec.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("invalid data after top-level value")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse var file %q: %v", file, err)
+	}
+
+	for k, v := range vars {
+		if _, ok := w.Vars[k]; !ok {
+			return fmt.Errorf("unknown workflow Var %q in var file %q", k, file)
+		}
+		switch tv := v.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("value of Var %q in var file %q is not a scalar", k, file)
+		case nil:
+			w.setVarValue(k, "")
+		case float64:
+			w.setVarValue(k, strconv.FormatFloat(tv, 'f', -1, 64))
+		default:
+			w.setVarValue(k, fmt.Sprint(v))
+		}
+	}
+	return nil
+}
+
+// redactedValue replaces the values of Sensitive vars.
+const redactedValue = "<redacted>"
+
+// registerSensitiveVars records the values of the Sensitive vars of w in the
+// top level workflow.
+func (w *Workflow) registerSensitiveVars() {
+	for _, v := range w.Vars {
+		if v.Sensitive {
+			w.addSensitiveValue(v.Value)
+		}
+	}
+}
+
+// addSensitiveValue records v in the top level workflow, to be redacted like
+// the values of Sensitive vars.
+func (w *Workflow) addSensitiveValue(v string) {
+	root := w.root()
+	root.sensitiveValuesMx.Lock()
+	defer root.sensitiveValuesMx.Unlock()
+	if v != "" && !strIn(v, root.sensitiveValues) {
+		root.sensitiveValues = append(root.sensitiveValues, v)
+	}
+}
+
+// redact replaces the values of Sensitive vars in s.
+func (w *Workflow) redact(s string) string {
+	root := w.root()
+	root.sensitiveValuesMx.Lock()
+	defer root.sensitiveValuesMx.Unlock()
+	for _, v := range root.sensitiveValues {
+		s = strings.Replace(s, v, redactedValue, -1)
+	}
+	return s
+}
+
+// redactStream redacts the output of a stream read in chunks, such as serial
+// port output, where a Sensitive value can be split across two chunks. held is
+// the output held back from the previous call. The end of the output a
+// Sensitive value could start in without having been read whole is held back
+// in rest, to redact with the next chunk, unless final is set.
+func (w *Workflow) redactStream(held, chunk string, final bool) (out, rest string) {
+	s := held + chunk
+	root := w.root()
+	root.sensitiveValuesMx.Lock()
+	cut := len(s)
+	if !final {
+		for _, v := range root.sensitiveValues {
+			if c := len(s) - (len(v) - 1); c < cut {
+				cut = c
+			}
+		}
+		if cut < 0 {
+			cut = 0
+		}
+	}
+	// Values read whole across the cut are redacted now.
+	for moved := true; moved; {
+		moved = false
+		for _, v := range root.sensitiveValues {
+			for i := 0; i < cut; {
+				j := strings.Index(s[i:], v)
+				if j == -1 || i+j >= cut {
+					break
+				}
+				if end := i + j + len(v); end > cut {
+					cut, moved = end, true
+				}
+				i += j + 1
+			}
+		}
+	}
+	root.sensitiveValuesMx.Unlock()
+	return w.redact(s[:cut]), s[cut:]
+}
+
+// redactErr returns err with the values of Sensitive vars replaced in its
+// messages, keeping its error types. err is returned as is if it holds no
+// Sensitive values.
+func (w *Workflow) redactErr(err DError) DError {
+	if err == nil {
+		return nil
+	}
+	changed := false
+	e := &dErrImpl{errsType: err.errorsType()}
+	for _, er := range err.errors() {
+		msg := w.redact(er.Error())
+		if msg != er.Error() {
+			changed = true
+			er = errors.New(msg)
+		}
+		e.errs = append(e.errs, er)
+	}
+	for _, msg := range err.AnonymizedErrs() {
+		e.anonymizedErrs = append(e.anonymizedErrs, w.redact(msg))
+	}
+	if !changed {
+		return err
+	}
+	return e
+}
@@ -0,0 +1,170 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPopulateVarsFromEnv(t *testing.T) {
+	w := New()
+	w.Vars = map[string]Var{
+		"foo": {Value: "default", Required: true, Description: "foo var"},
+		"bar": {Value: "bar"},
+	}
+	os.Setenv("DAISY_VAR_foo", "from-env")
+	os.Setenv("DAISY_VAR_baz", "undeclared")
+	defer os.Unsetenv("DAISY_VAR_foo")
+	defer os.Unsetenv("DAISY_VAR_baz")
+
+	w.PopulateVarsFromEnv("DAISY_VAR_")
+	want := map[string]Var{
+		"foo": {Value: "from-env", Required: true, Description: "foo var"},
+		"bar": {Value: "bar"},
+	}
+	if !reflect.DeepEqual(w.Vars, want) {
+		t.Errorf("unexpected vars: %v, want %v", w.Vars, want)
+	}
+}
+
+func TestAddVarsFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"vars.json":   `{"foo": "json", "num": 3, "size": 1000000, "id": 12345678, "ratio": 0.5}`,
+		"vars.yaml":   "foo: yaml\nbar: true\nbig: 12345678901234567890\nfloat: 1.5e7\n",
+		"trail.json":  `{"foo": "a"} {}`,
+		"unknown.yml": "baz: 1\n",
+		"nested.json": `{"foo": {"a": "b"}}`,
+		"bad.json":    `{"foo":`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := New()
+	w.Vars = map[string]Var{"foo": {Required: true}, "bar": {}, "num": {}, "size": {}, "id": {}, "ratio": {}, "big": {}, "float": {}}
+	for _, f := range []string{"vars.json", "vars.yaml"} {
+		if err := w.AddVarsFromFile(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("unexpected error for %s: %v", f, err)
+		}
+	}
+	want := map[string]Var{
+		"foo":   {Value: "yaml", Required: true},
+		"bar":   {Value: "true"},
+		"num":   {Value: "3"},
+		"size":  {Value: "1000000"},
+		"id":    {Value: "12345678"},
+		"ratio": {Value: "0.5"},
+		"big":   {Value: "12345678901234567890"},
+		"float": {Value: "15000000"},
+	}
+	if !reflect.DeepEqual(w.Vars, want) {
+		t.Errorf("unexpected vars: %v, want %v", w.Vars, want)
+	}
+
+	for _, f := range []string{"unknown.yml", "nested.json", "bad.json", "trail.json", "dne.json"} {
+		if err := w.AddVarsFromFile(filepath.Join(dir, f)); err == nil {
+			t.Errorf("expected error for %s", f)
+		}
+	}
+}
+
+func TestSensitiveVars(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.Vars = map[string]Var{
+		"token": {Sensitive: true},
+		"name":  {Value: "visible"},
+	}
+	w.AddVar("token", "s3cr3t")
+	if !w.Vars["token"].Sensitive {
+		t.Fatal("AddVar dropped the Sensitive attribute")
+	}
+	iw := New()
+	iw.Vars = map[string]Var{"password": {Sensitive: true}}
+	w.Steps = map[string]*Step{
+		"include": {IncludeWorkflow: &IncludeWorkflow{Workflow: iw, Vars: map[string]string{"password": "hunter2"}}},
+	}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	w.LogWorkflowInfo("token is %s, name is ${name}", w.Vars["token"].Value)
+	iw.LogWorkflowInfo("password is hunter2")
+	var got []string
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		got = append(got, e.Message)
+	}
+	for _, want := range []string{"token is <redacted>, name is ${name}", "password is <redacted>"} {
+		if !strIn(want, got) {
+			t.Errorf("log %q not found in %q", want, got)
+		}
+	}
+
+	err := Errf("failed with s3cr3t")
+	err = addErrs(err, typedErrf(apiError, "api call with hunter2 failed"))
+	red := w.redactErr(err)
+	if strings.Contains(red.Error(), "s3cr3t") || strings.Contains(red.Error(), "hunter2") {
+		t.Errorf("error not redacted: %v", red)
+	}
+	if !reflect.DeepEqual(red.errorsType(), err.errorsType()) {
+		t.Errorf("error types not kept: %v, want %v", red.errorsType(), err.errorsType())
+	}
+	plain := Errf("nothing to hide")
+	if w.redactErr(plain) != plain {
+		t.Error("errors without sensitive values should be returned as is")
+	}
+}
+
+func TestRedactStream(t *testing.T) {
+	tests := []struct {
+		desc   string
+		chunks []string
+		want   string
+	}{
+		{"whole case", []string{"token s3cr3t read\n"}, "token <redacted> read\n"},
+		{"split case", []string{"token s3c", "r3t read\n"}, "token <redacted> read\n"},
+		{"three chunks case", []string{"s", "3cr", "3t"}, "<redacted>"},
+		{"other value case", []string{"hunt", "er2 and s3cr3", "t"}, "<redacted> and <redacted>"},
+		{"no value case", []string{"s3c", "at"}, "s3cat"},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.sensitiveValues = []string{"s3cr3t", "hunter2"}
+		var got, held string
+		for _, c := range tt.chunks {
+			var out string
+			out, held = w.redactStream(held, c, false)
+			got += out
+		}
+		out, _ := w.redactStream(held, "", true)
+		got += out
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// vdiSignature is the signature of VDI files, at offset 0x40.
+const vdiSignature = 0xbeda107f
+
+var (
+	// vhdxMetadataRegion is the GUID of the metadata region of VHDX files,
+	// 8B7CA206-4790-4B9A-B8FE-575F050F886E, as stored.
+	vhdxMetadataRegion = []byte{0x06, 0xa2, 0x7c, 0x8b, 0x90, 0x47, 0x9a, 0x4b, 0xb8, 0xfe, 0x57, 0x5f, 0x05, 0x0f, 0x88, 0x6e}
+	// vhdxVirtualDiskSize is the GUID of the virtual disk size metadata item
+	// of VHDX files, 2FA54224-CD1B-4876-B211-5DBED83BF4B8, as stored.
+	vhdxVirtualDiskSize = []byte{0x24, 0x42, 0xa5, 0x2f, 0x1b, 0xcd, 0x76, 0x48, 0xb2, 0x11, 0x5d, 0xbe, 0xd8, 0x3b, 0xf4, 0xb8}
+)
+
+// VirtualDisk describes a virtual disk file.
+type VirtualDisk struct {
+	// Format is the qemu-img name of the format of the file: "vmdk",
+	// "qcow2", "vhdx", "vpc" (VHD), "vdi" or "raw".
+	Format string
+	// SizeBytes is the size of the disk the file holds.
+	SizeBytes int64
+	// FileSizeBytes is the size of the file.
+	FileSizeBytes int64
+}
+
+// InspectVirtualDisk reads the headers of the virtual disk file at path, a
+// GCS path, to tell its format and the size of the disk it holds. Files of no
+// known format are taken for raw disks.
+func (w *Workflow) InspectVirtualDisk(ctx context.Context, path string) (*VirtualDisk, DError) {
+	bkt, obj, dErr := splitGCSPath(path)
+	if dErr != nil {
+		return nil, dErr
+	}
+	attrs, err := w.storage().Attrs(ctx, bkt, obj)
+	if err != nil {
+		return nil, Errf("error reading %q: %v", path, err)
+	}
+	vd, err := inspectVirtualDisk(&objectReader{ctx: ctx, st: w.storage(), bucket: bkt, object: obj}, attrs.Size)
+	if err != nil {
+		return nil, Errf("error reading virtual disk %q: %v", path, err)
+	}
+	vd.FileSizeBytes = attrs.Size
+	return vd, nil
+}
+
+// objectReader reads parts of a GCS object.
+type objectReader struct {
+	ctx            context.Context
+	st             Storage
+	bucket, object string
+}
+
+// ReadAt implements io.ReaderAt.
+func (o *objectReader) ReadAt(b []byte, offset int64) (int, error) {
+	r, err := o.st.Get(o.ctx, o.bucket, o.object, offset)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.ReadFull(r, b)
+}
+
+// readAt returns the n bytes of r at offset.
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// inspectVirtualDisk tells the format and disk size of the virtual disk file
+// r of size bytes.
+func inspectVirtualDisk(r io.ReaderAt, size int64) (*VirtualDisk, error) {
+	if size < 512 {
+		return &VirtualDisk{Format: "raw", SizeBytes: size}, nil
+	}
+	head, err := readAt(r, 0, 512)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("KDMV")):
+		// Capacity in sectors.
+		return &VirtualDisk{Format: "vmdk", SizeBytes: int64(binary.LittleEndian.Uint64(head[12:])) * 512}, nil
+	case bytes.HasPrefix(head, []byte("# Disk DescriptorFile")):
+		return nil, errors.New("VMDK descriptor files are not supported, use a monolithic sparse or stream-optimized VMDK")
+	case bytes.HasPrefix(head, []byte("QFI\xfb")):
+		return &VirtualDisk{Format: "qcow2", SizeBytes: int64(binary.BigEndian.Uint64(head[24:]))}, nil
+	case bytes.HasPrefix(head, []byte("vhdxfile")):
+		s, err := vhdxSize(r)
+		if err != nil {
+			return nil, err
+		}
+		return &VirtualDisk{Format: "vhdx", SizeBytes: s}, nil
+	case bytes.HasPrefix(head, []byte("conectix")):
+		// Dynamic VHDs start with a copy of their footer.
+		return &VirtualDisk{Format: "vpc", SizeBytes: int64(binary.BigEndian.Uint64(head[48:]))}, nil
+	case binary.LittleEndian.Uint32(head[0x40:]) == vdiSignature:
+		return &VirtualDisk{Format: "vdi", SizeBytes: int64(binary.LittleEndian.Uint64(head[0x170:]))}, nil
+	}
+
+	// Fixed VHDs are raw disks followed by a footer.
+	foot, err := readAt(r, size-512, 512)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(foot, []byte("conectix")) {
+		return &VirtualDisk{Format: "vpc", SizeBytes: int64(binary.BigEndian.Uint64(foot[48:]))}, nil
+	}
+	return &VirtualDisk{Format: "raw", SizeBytes: size}, nil
+}
+
+// vhdxSize returns the virtual disk size of the VHDX file r, found through
+// its region table, at 192KB, and its metadata region.
+func vhdxSize(r io.ReaderAt) (int64, error) {
+	const regionTable = 192 << 10
+	rt, err := readAt(r, regionTable, 16)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(rt, []byte("regi")) {
+		return 0, errors.New("VHDX region table not found")
+	}
+	entries, err := readAt(r, regionTable+16, 32*int(binary.LittleEndian.Uint32(rt[8:])))
+	if err != nil {
+		return 0, err
+	}
+	for e := entries; len(e) >= 32; e = e[32:] {
+		if !bytes.Equal(e[:16], vhdxMetadataRegion) {
+			continue
+		}
+		region := int64(binary.LittleEndian.Uint64(e[16:]))
+		mt, err := readAt(r, region, 32)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.HasPrefix(mt, []byte("metadata")) {
+			return 0, errors.New("VHDX metadata table not found")
+		}
+		items, err := readAt(r, region+32, 32*int(binary.LittleEndian.Uint16(mt[10:])))
+		if err != nil {
+			return 0, err
+		}
+		for i := items; len(i) >= 32; i = i[32:] {
+			if bytes.Equal(i[:16], vhdxVirtualDiskSize) {
+				b, err := readAt(r, region+int64(binary.LittleEndian.Uint32(i[16:])), 8)
+				if err != nil {
+					return 0, err
+				}
+				return int64(binary.LittleEndian.Uint64(b)), nil
+			}
+		}
+		return 0, fmt.Errorf("VHDX virtual disk size not found")
+	}
+	return 0, errors.New("VHDX metadata region not found")
+}
@@ -0,0 +1,102 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+// testDiskFile returns a file of size bytes with magic at offset and the
+// uint64 v at vOffset.
+func testDiskFile(size int, magic string, offset int, v uint64, vOffset int, order binary.ByteOrder) []byte {
+	b := make([]byte, size)
+	copy(b[offset:], magic)
+	order.PutUint64(b[vOffset:], v)
+	return b
+}
+
+// testVHDX returns a VHDX file of a disk of size bytes.
+func testVHDX(size uint64) []byte {
+	const region = 1 << 20
+	b := make([]byte, region+64<<10)
+	copy(b, "vhdxfile")
+	rt := b[192<<10:]
+	copy(rt, "regi")
+	binary.LittleEndian.PutUint32(rt[8:], 2)
+	// A BAT region entry, then the metadata region entry.
+	copy(rt[48:], vhdxMetadataRegion)
+	binary.LittleEndian.PutUint64(rt[64:], region)
+	mt := b[region:]
+	copy(mt, "metadata")
+	binary.LittleEndian.PutUint16(mt[10:], 2)
+	copy(mt[64:], vhdxVirtualDiskSize)
+	binary.LittleEndian.PutUint32(mt[80:], 32<<10)
+	binary.LittleEndian.PutUint64(mt[32<<10:], size)
+	return b
+}
+
+func TestInspectVirtualDisk(t *testing.T) {
+	const gb = 1 << 30
+	tests := []struct {
+		desc      string
+		file      []byte
+		want      *VirtualDisk
+		shouldErr bool
+	}{
+		{"vmdk case", testDiskFile(1024, "KDMV", 0, 20*gb/512, 12, binary.LittleEndian), &VirtualDisk{Format: "vmdk", SizeBytes: 20 * gb}, false},
+		{"qcow2 case", testDiskFile(1024, "QFI\xfb", 0, 20*gb, 24, binary.BigEndian), &VirtualDisk{Format: "qcow2", SizeBytes: 20 * gb}, false},
+		{"vhdx case", testVHDX(20 * gb), &VirtualDisk{Format: "vhdx", SizeBytes: 20 * gb}, false},
+		{"dynamic vhd case", testDiskFile(1024, "conectix", 0, 20*gb, 48, binary.BigEndian), &VirtualDisk{Format: "vpc", SizeBytes: 20 * gb}, false},
+		{"fixed vhd case", testDiskFile(2048, "conectix", 1536, 1536, 1536+48, binary.BigEndian), &VirtualDisk{Format: "vpc", SizeBytes: 1536}, false},
+		{"vdi case", testDiskFile(1024, "\x7f\x10\xda\xbe", 0x40, 20*gb, 0x170, binary.LittleEndian), &VirtualDisk{Format: "vdi", SizeBytes: 20 * gb}, false},
+		{"raw case", make([]byte, 2048), &VirtualDisk{Format: "raw", SizeBytes: 2048}, false},
+		{"small raw case", make([]byte, 100), &VirtualDisk{Format: "raw", SizeBytes: 100}, false},
+		{"vmdk descriptor case", testDiskFile(1024, "# Disk DescriptorFile", 0, 0, 100, binary.LittleEndian), nil, true},
+		{"bad vhdx case", testDiskFile(256<<10, "vhdxfile", 0, 0, 100, binary.LittleEndian), nil, true},
+	}
+	for _, tt := range tests {
+		got, err := inspectVirtualDisk(bytes.NewReader(tt.file), int64(len(tt.file)))
+		if (err != nil) != tt.shouldErr {
+			t.Errorf("%s: unexpected error result: %v", tt.desc, err)
+		}
+		if diffRes := diff(got, tt.want, 0); diffRes != "" {
+			t.Errorf("%s: VirtualDisk not as expected: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
+
+func TestWorkflowInspectVirtualDisk(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	fs := &FakeStorage{}
+	w.Storage = fs
+	file := testDiskFile(1024, "QFI\xfb", 0, 1<<30, 24, binary.BigEndian)
+	fs.Put(ctx, "bucket", "disk.qcow2", "", bytes.NewReader(file))
+
+	got, err := w.InspectVirtualDisk(ctx, "gs://bucket/disk.qcow2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &VirtualDisk{Format: "qcow2", SizeBytes: 1 << 30, FileSizeBytes: 1024}
+	if diffRes := diff(got, want, 0); diffRes != "" {
+		t.Errorf("VirtualDisk not as expected: (-got,+want)\n%s", diffRes)
+	}
+	if _, err := w.InspectVirtualDisk(ctx, "gs://bucket/missing"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
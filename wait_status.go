@@ -0,0 +1,110 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// defaultWaitStatusInterval is how often wait steps log their status unless
+// WaitStatusInterval is set.
+const defaultWaitStatusInterval = 5 * time.Minute
+
+// waitStatusInterval returns the WaitStatusInterval of w, or of the closest
+// parent that sets it, or defaultWaitStatusInterval.
+func (w *Workflow) waitStatusInterval() time.Duration {
+	for ; w != nil; w = w.parent {
+		if w.WaitStatusInterval != "" {
+			// Checked by validateWaitStatusInterval.
+			d, _ := time.ParseDuration(w.WaitStatusInterval)
+			return d
+		}
+	}
+	return defaultWaitStatusInterval
+}
+
+func (w *Workflow) validateWaitStatusInterval() DError {
+	if w.WaitStatusInterval == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(w.WaitStatusInterval); err != nil || d < 0 {
+		return Errf("WaitStatusInterval must be a non negative duration: %q", w.WaitStatusInterval)
+	}
+	return nil
+}
+
+// recordSerialActivity records that an instance wrote to a watched serial
+// port now.
+func (w *Workflow) recordSerialActivity(project, zone, name string) {
+	root := w.root()
+	root.serialActivityMx.Lock()
+	defer root.serialActivityMx.Unlock()
+	if root.serialActivity == nil {
+		root.serialActivity = map[string]time.Time{}
+	}
+	root.serialActivity[path.Join(project, zone, name)] = time.Now()
+}
+
+// lastSerialActivity returns when an instance last wrote to a watched serial
+// port, if it did.
+func (w *Workflow) lastSerialActivity(project, zone, name string) (time.Time, bool) {
+	root := w.root()
+	root.serialActivityMx.Lock()
+	defer root.serialActivityMx.Unlock()
+	t, ok := root.serialActivity[path.Join(project, zone, name)]
+	return t, ok
+}
+
+// instanceSignals returns the signals s waits for, if s is a wait step.
+func (s *Step) instanceSignals() []*InstanceSignal {
+	switch {
+	case s.WaitForInstancesSignal != nil:
+		return *s.WaitForInstancesSignal
+	case s.WaitForAnyInstancesSignal != nil:
+		return *s.WaitForAnyInstancesSignal
+	}
+	return nil
+}
+
+// reportWaitStatus logs how long wait step s has been waiting and, for each
+// instance it waits for, the instance status and when it last wrote to a
+// watched serial port.
+func (s *Step) reportWaitStatus(elapsed time.Duration) {
+	impl, err := s.stepImpl()
+	if err != nil {
+		return
+	}
+	var parts []string
+	for _, is := range s.instanceSignals() {
+		link, ok := signalInstanceLink(s.w, is.Name)
+		if !ok {
+			continue
+		}
+		m := NamedSubexp(instanceURLRgx, link)
+		status, err := s.w.ComputeClient.InstanceStatus(m["project"], m["zone"], m["instance"])
+		if err != nil {
+			status = "unknown"
+		}
+		serial := "no serial output yet"
+		if t, ok := s.w.lastSerialActivity(m["project"], m["zone"], m["instance"]); ok {
+			serial = fmt.Sprintf("last serial output %s ago", time.Since(t).Round(time.Second))
+		}
+		parts = append(parts, fmt.Sprintf("%q %s, %s", is.Name, status, serial))
+	}
+	s.w.LogStepInfo(s.name, stepTypeName(impl), "Still waiting after %s: %s", elapsed.Round(time.Second), strings.Join(parts, "; "))
+}
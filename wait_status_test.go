@@ -0,0 +1,87 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+)
+
+func TestWaitStatusInterval(t *testing.T) {
+	parent := testWorkflow()
+	child := parent.NewSubWorkflow()
+	if got := child.waitStatusInterval(); got != defaultWaitStatusInterval {
+		t.Errorf("default: got %s, want %s", got, defaultWaitStatusInterval)
+	}
+	parent.WaitStatusInterval = "0s"
+	if got := child.waitStatusInterval(); got != 0 {
+		t.Errorf("inherited: got %s, want 0s", got)
+	}
+	child.WaitStatusInterval = "2m"
+	if got := child.waitStatusInterval(); got != 2*time.Minute {
+		t.Errorf("own: got %s, want 2m0s", got)
+	}
+
+	for _, tt := range []struct {
+		interval string
+		wantErr  bool
+	}{
+		{"", false},
+		{"30s", false},
+		{"0s", false},
+		{"-1m", true},
+		{"bad", true},
+	} {
+		w := testWorkflow()
+		w.WaitStatusInterval = tt.interval
+		if err := w.validateWaitStatusInterval(); (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v, want error: %t", tt.interval, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReportWaitStatus(t *testing.T) {
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).InstanceStatusFn = func(_, _, name string) (string, error) {
+		if name == "i2" {
+			return "", errors.New("fail")
+		}
+		return "RUNNING", nil
+	}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+	w.recordSerialActivity(testProject, testZone, "i1")
+	s, _ := w.NewStep("wait")
+	s.WaitForInstancesSignal = &WaitForInstancesSignal{
+		{Name: "i1"},
+		{Name: fmt.Sprintf("projects/%s/zones/%s/instances/i2", testProject, testZone)},
+		{Name: "dne"},
+	}
+	s.reportWaitStatus(10 * time.Minute)
+
+	var got []string
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		got = append(got, e.Message)
+	}
+	want := fmt.Sprintf(`Still waiting after 10m0s: "i1" RUNNING, last serial output 0s ago; "projects/%s/zones/%s/instances/i2" unknown, no serial output yet`, testProject, testZone)
+	if !strIn(want, got) {
+		t.Errorf("log %q not found in %q", want, got)
+	}
+}
@@ -0,0 +1,207 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultWindowsSetupPorts are the serial ports GCE Windows agents write
+// their JSON records to.
+var defaultWindowsSetupPorts = []int64{3, 4}
+
+// WindowsSetupRecord is the state of Windows setup reported by a JSON record
+// GCE Windows agents write to serial port 3 or 4, one record per line.
+type WindowsSetupRecord struct {
+	// Activation status of Windows, e.g. "Licensed".
+	ActivationStatus string `json:"activationStatus,omitempty"`
+	// Sysprep state of Windows, e.g. "IMAGE_STATE_COMPLETE".
+	SysprepState string `json:"sysprepState,omitempty"`
+	// Error reported along with the state.
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// ParseWindowsSetupRecord parses a serial port line holding a JSON record,
+// possibly after a prefix such as a timestamp. Keys are matched case
+// insensitively. It returns false for other lines and for records without an
+// activation status or sysprep state, such as the password responses written
+// to port 4, which must not be logged.
+func ParseWindowsSetupRecord(line string) (*WindowsSetupRecord, bool) {
+	i := strings.Index(line, "{")
+	if i == -1 {
+		return nil, false
+	}
+	var r WindowsSetupRecord
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[i:])), &r); err != nil {
+		return nil, false
+	}
+	if r.ActivationStatus == "" && r.SysprepState == "" {
+		return nil, false
+	}
+	return &r, true
+}
+
+// WindowsSetup waits for the state of Windows setup reported by the JSON
+// records GCE Windows agents write to serial ports 3 and 4, see
+// WindowsSetupRecord, rather than matching text.
+// This step will not complete until the last records reported ActivationStatus
+// and SysprepState, those set. A record with an ErrorMessage or a state in
+// FailureStates will cause the step to fail.
+// The last states reported are set as the serial-output values
+// "<instance>-windows-activation-status" and "<instance>-windows-sysprep-state"
+// of the workflow.
+type WindowsSetup struct {
+	// Serial ports to read, defaults to 3 and 4.
+	Ports []int64 `json:",omitempty"`
+	// Activation status to wait for, e.g. "Licensed".
+	ActivationStatus string `json:",omitempty"`
+	// Sysprep state to wait for, e.g. "IMAGE_STATE_COMPLETE".
+	SysprepState string `json:",omitempty"`
+	// Activation statuses or sysprep states failing the wait.
+	FailureStates FailureMatches `json:",omitempty"`
+}
+
+func (ws *WindowsSetup) ports() []int64 {
+	if len(ws.Ports) == 0 {
+		return defaultWindowsSetupPorts
+	}
+	return ws.Ports
+}
+
+// windowsSetupState is the Windows setup state of an instance, updated by the
+// records read.
+type windowsSetupState struct {
+	activationStatus, sysprepState string
+}
+
+// update updates st with r, and returns the changes to log.
+func (st *windowsSetupState) update(r *WindowsSetupRecord) []string {
+	var changes []string
+	if r.ActivationStatus != "" && r.ActivationStatus != st.activationStatus {
+		st.activationStatus = r.ActivationStatus
+		changes = append(changes, fmt.Sprintf("activation status %q", r.ActivationStatus))
+	}
+	if r.SysprepState != "" && r.SysprepState != st.sysprepState {
+		st.sysprepState = r.SysprepState
+		changes = append(changes, fmt.Sprintf("sysprep state %q", r.SysprepState))
+	}
+	return changes
+}
+
+// done reports whether st has the states ws waits for.
+func (st *windowsSetupState) done(ws *WindowsSetup) bool {
+	return (ws.ActivationStatus == "" || st.activationStatus == ws.ActivationStatus) &&
+		(ws.SysprepState == "" || st.sysprepState == ws.SysprepState)
+}
+
+// failure returns the state of r in FailureStates, or "".
+func (ws *WindowsSetup) failure(r *WindowsSetupRecord) string {
+	for _, f := range ws.FailureStates {
+		if r.ActivationStatus == f || r.SysprepState == f {
+			return f
+		}
+	}
+	return ""
+}
+
+// waitForWindowsSetup watches the Windows setup records of an instance until
+// its wanted state or a failure state. It returns nil when done is closed.
+func waitForWindowsSetup(s *Step, project, zone, name string, ws *WindowsSetup, interval time.Duration, done <-chan struct{}) DError {
+	w := s.w
+	msg := fmt.Sprintf("Instance %q: watching Windows setup records on serial ports %v", name, ws.ports())
+	if ws.ActivationStatus != "" {
+		msg += fmt.Sprintf(", ActivationStatus: %q", ws.ActivationStatus)
+	}
+	if ws.SysprepState != "" {
+		msg += fmt.Sprintf(", SysprepState: %q", ws.SysprepState)
+	}
+	if len(ws.FailureStates) > 0 {
+		msg += fmt.Sprintf(", FailureStates: %q", ws.FailureStates)
+	}
+	w.LogStepInfo(s.name, "WaitForInstancesSignal", msg+".")
+	var state windowsSetupState
+	starts := map[int64]int64{}
+	tails := map[int64]string{}
+	var errs int
+	tick := time.Tick(interval)
+	for {
+		select {
+		case <-s.w.Cancel:
+			return nil
+		case <-done:
+			return nil
+		case <-tick:
+			for _, port := range ws.ports() {
+				resp, err := w.ComputeClient.GetSerialPortOutput(project, zone, name, port, starts[port])
+				if err != nil {
+					status, sErr := w.ComputeClient.InstanceStatus(project, zone, name)
+					if sErr != nil {
+						err = fmt.Errorf("%v, error getting InstanceStatus: %v", err, sErr)
+					} else {
+						err = fmt.Errorf("%v, InstanceStatus: %q", err, status)
+					}
+
+					// Wait until machine restarts to read the records.
+					if status == "TERMINATED" || status == "STOPPED" || status == "STOPPING" {
+						continue
+					}
+
+					// Retry up to 3 times in a row on any error if we successfully got InstanceStatus.
+					if errs < 3 {
+						errs++
+						continue
+					}
+
+					return Errf("WaitForInstancesSignal: instance %q: error getting serial port %d: %v", name, port, err)
+				}
+				errs = 0
+				starts[port] = resp.Next
+				lines := strings.Split(tails[port]+resp.Contents, "\n")
+				// The last line is incomplete, or "", it is read with the next
+				// output.
+				tails[port] = lines[len(lines)-1]
+				for _, ln := range lines[:len(lines)-1] {
+					r, ok := ParseWindowsSetupRecord(ln)
+					if !ok {
+						continue
+					}
+					if r.ErrorMessage != "" {
+						return Errf("WaitForInstancesSignal: instance %q: Windows setup error: %q", name, w.redact(r.ErrorMessage))
+					}
+					if f := ws.failure(r); f != "" {
+						return Errf("WaitForInstancesSignal: instance %q: Windows setup failure state found: %q", name, f)
+					}
+					if changes := state.update(r); len(changes) > 0 {
+						w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: Windows setup reported %s", name, strings.Join(changes, ", "))
+						root := w.root()
+						if state.activationStatus != "" {
+							root.AddSerialConsoleOutputValue(name+"-windows-activation-status", state.activationStatus)
+						}
+						if state.sysprepState != "" {
+							root.AddSerialConsoleOutputValue(name+"-windows-sysprep-state", state.sysprepState)
+						}
+					}
+				}
+			}
+			if state.done(ws) {
+				w.LogStepInfo(s.name, "WaitForInstancesSignal", "Instance %q: Windows setup states found", name)
+				return nil
+			}
+		}
+	}
+}
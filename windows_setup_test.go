@@ -0,0 +1,148 @@
+//  Copyright 2022 Google Inc. All Rights Reserved.
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package daisy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestParseWindowsSetupRecord(t *testing.T) {
+	tests := []struct {
+		desc   string
+		line   string
+		want   *WindowsSetupRecord
+		wantOk bool
+	}{
+		{"record case", `{"activationStatus":"Licensed"}`, &WindowsSetupRecord{ActivationStatus: "Licensed"}, true},
+		{"prefix case", `2022/06/01 10:00:00 GCEWindowsAgent: {"sysprepState":"IMAGE_STATE_COMPLETE"}` + "\r", &WindowsSetupRecord{SysprepState: "IMAGE_STATE_COMPLETE"}, true},
+		{"keys case", `{"ActivationStatus":"Notification","ErrorMessage":"0xC004F074"}`, &WindowsSetupRecord{ActivationStatus: "Notification", ErrorMessage: "0xC004F074"}, true},
+		{"text case", "Windows is activated", nil, false},
+		{"bad JSON case", `{"activationStatus":`, nil, false},
+		{"password response case", `{"modulus":"m","encryptedPassword":"secret","errorMessage":""}`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseWindowsSetupRecord(tt.line)
+		if ok != tt.wantOk {
+			t.Errorf("%s: got ok %v, want %v", tt.desc, ok, tt.wantOk)
+			continue
+		}
+		if diffRes := diff(got, tt.want, 0); diffRes != "" {
+			t.Errorf("%s: record does not match expectation: (-got +want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
+
+func TestWaitForWindowsSetup(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		desc       string
+		ws         *WindowsSetup
+		outputs    map[int64]string
+		wantErr    string
+		wantValues map[string]string
+	}{
+		{
+			"states across ports case",
+			&WindowsSetup{ActivationStatus: "Licensed", SysprepState: "IMAGE_STATE_COMPLETE"},
+			map[int64]string{
+				3: "sysprep starting\n{\"sysprepState\":\"IMAGE_STATE_UNDEPLOYABLE\"}\n{\"sysprepSt",
+				4: "{\"modulus\":\"m\",\"encryptedPassword\":\"secret\"}\n{\"activationStatus\":\"Licensed\"}\n",
+			},
+			"",
+			map[string]string{"i-windows-activation-status": "Licensed", "i-windows-sysprep-state": "IMAGE_STATE_COMPLETE"},
+		},
+		{
+			"custom port case",
+			&WindowsSetup{Ports: []int64{1}, ActivationStatus: "Licensed"},
+			map[int64]string{1: "{\"activationStatus\":\"Licensed\"}\n"},
+			"",
+			map[string]string{"i-windows-activation-status": "Licensed"},
+		},
+		{
+			"error message case",
+			&WindowsSetup{ActivationStatus: "Licensed"},
+			map[int64]string{3: "{\"activationStatus\":\"Notification\",\"errorMessage\":\"KMS unreachable\"}\n"},
+			"KMS unreachable",
+			nil,
+		},
+		{
+			"failure state case",
+			&WindowsSetup{ActivationStatus: "Licensed", FailureStates: []string{"Notification"}},
+			map[int64]string{4: "{\"activationStatus\":\"Notification\"}\n"},
+			"failure state found",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		s := &Step{name: "wait", w: w}
+		var mx sync.Mutex
+		reads := map[int64]int{}
+		w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, port, start int64) (*compute.SerialPortOutput, error) {
+			mx.Lock()
+			defer mx.Unlock()
+			reads[port]++
+			out := tt.outputs[port]
+			// The incomplete record of port 3 is completed by the second read.
+			if port == 3 && reads[port] > 1 {
+				out += "ate\":\"IMAGE_STATE_COMPLETE\"}\n"
+			}
+			if int(start) >= len(out) {
+				return &compute.SerialPortOutput{Next: start}, nil
+			}
+			return &compute.SerialPortOutput{Contents: out[start:], Next: int64(len(out))}, nil
+		}
+
+		err := waitForWindowsSetup(s, testProject, testZone, "i", tt.ws, time.Millisecond, nil)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.desc, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got error %v, want error containing %q", tt.desc, err, tt.wantErr)
+		}
+		for k, want := range tt.wantValues {
+			if got := w.GetSerialConsoleOutputValue(k); got != want {
+				t.Errorf("%s: serial-output value %q = %q, want %q", tt.desc, k, got, want)
+			}
+		}
+		for _, e := range w.Logger.(*MockLogger).getEntries() {
+			if strings.Contains(e.Message, "secret") {
+				t.Errorf("%s: password response logged: %q", tt.desc, e.Message)
+			}
+		}
+	}
+
+	// WindowsSetup is a WaitForInstancesSignal signal.
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, start int64) (*compute.SerialPortOutput, error) {
+		return &compute.SerialPortOutput{Contents: "{\"sysprepState\":\"IMAGE_STATE_COMPLETE\"}\n", Next: start + 1}, nil
+	}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/%s", testProject, testZone, "i1")},
+	}
+	si := WaitForInstancesSignal{{Name: "i1", interval: time.Millisecond, WindowsSetup: &WindowsSetup{SysprepState: "IMAGE_STATE_COMPLETE"}}}
+	if err := si.run(ctx, &Step{w: w}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
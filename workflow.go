@@ -20,11 +20,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,14 +35,34 @@ import (
 	"cloud.google.com/go/logging"
 	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/compute-daisy/compute"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 const defaultTimeout = "10m"
 
+// Values of Workflow.OnStepFailure.
+const (
+	// OnStepFailureAbortAll cancels the workflow on the first step failure.
+	OnStepFailureAbortAll = "abort-all"
+	// OnStepFailureFinishStartedSteps starts no more steps on the first step
+	// failure but lets the running steps finish.
+	OnStepFailureFinishStartedSteps = "finish-started-steps"
+	// OnStepFailureContinueIndependentBranches skips the steps depending on
+	// a failed step and keeps running the others.
+	OnStepFailureContinueIndependentBranches = "continue-independent-branches"
+)
+
+var onStepFailurePolicies = []string{OnStepFailureAbortAll, OnStepFailureFinishStartedSteps, OnStepFailureContinueIndependentBranches}
+
+// daisyBktName returns the name of the default scratch bucket of project.
+func daisyBktName(project string) string {
+	return strings.Replace(project, ":", "-", -1) + "-daisy-bkt"
+}
+
 func daisyBkt(ctx context.Context, client *storage.Client, project string) (string, DError) {
-	dBkt := strings.Replace(project, ":", "-", -1) + "-daisy-bkt"
+	dBkt := daisyBktName(project)
 	it := client.Buckets(ctx, project)
 	for bucketAttrs, err := it.Next(); err != iterator.Done; bucketAttrs, err = it.Next() {
 		if err != nil {
@@ -71,6 +93,9 @@ type Var struct {
 	Value       string
 	Required    bool   `json:",omitempty"`
 	Description string `json:",omitempty"`
+	// Sensitive values are replaced with <redacted> in logs, errors and
+	// printed workflows.
+	Sensitive bool `json:",omitempty"`
 }
 
 // UnmarshalJSON unmarshals a Var.
@@ -106,15 +131,95 @@ type Workflow struct {
 	OAuthPath string `json:",omitempty"`
 	// Sources used by this workflow, map of destination to source.
 	Sources map[string]string `json:",omitempty"`
+	// Expected hex SHA-256 hashes of Sources that are files or GCS objects,
+	// by source. The sources are checked before they are uploaded or their
+	// content is used.
+	SourceSHA256 map[string]string `json:",omitempty"`
 	// Vars defines workflow variables, substitution is done at Workflow run time.
 	Vars  map[string]Var   `json:",omitempty"`
 	Steps map[string]*Step `json:",omitempty"`
 	// Map of steps to their dependencies.
 	Dependencies map[string][]string `json:",omitempty"`
+	// Steps run once the other steps finished, whether they succeeded or
+	// failed, or the workflow was canceled, see Finally.
+	Finally *Finally `json:",omitempty"`
 	// Default timout for each step, defaults to 10m.
 	// Must be parsable by https://golang.org/pkg/time/#ParseDuration.
 	DefaultTimeout string `json:",omitempty"`
 	defaultTimeout time.Duration
+	// Maximum time cleanup takes once the steps are done, e.g. "15m". Past
+	// it, Run logs the resources left and returns. Defaults to no limit.
+	CleanupTimeout string `json:",omitempty"`
+	cleanupTimeout time.Duration
+	// Replace random resource name suffixes with a hash of the workflow name,
+	// RunID and resource name so that generated names are reproducible.
+	DeterministicNames bool `json:",omitempty"`
+	// Identifies this run when DeterministicNames is set.
+	RunID string `json:",omitempty"`
+	// Maximum number of steps of this workflow running at the same time,
+	// 0 means no limit.
+	MaxConcurrency int `json:",omitempty"`
+	// What to do when a step fails: "abort-all", "finish-started-steps" or
+	// "continue-independent-branches", see the OnStepFailure constants.
+	// Defaults to "abort-all". Included and sub workflows inherit it.
+	OnStepFailure string `json:",omitempty"`
+	// Copy gs:// inputs in other buckets, such as startup-script-url
+	// metadata and RawDisk sources, to the scratch bucket before running, so
+	// instance service accounts only need access to the scratch bucket.
+	StageGCSInputs bool `json:",omitempty"`
+	// Log a warning when a step has been running for this percentage of its
+	// timeout, 0 disables the warning. Included and sub workflows inherit it.
+	TimeoutWarningPercent int `json:",omitempty"`
+	// How often WaitForInstancesSignal and WaitForAnyInstancesSignal steps
+	// log how long they have been waiting, the status of their instances and
+	// their last serial output, e.g. "2m", "0s" disables it. Defaults to
+	// "5m". Included and sub workflows inherit it.
+	WaitStatusInterval string `json:",omitempty"`
+	// Caps on the serial output WaitForInstancesSignal steps hold in memory
+	// and save, see SerialLog.
+	SerialLog *SerialLog `json:",omitempty"`
+	// Guest attribute GuestAttribute signals watch and the guest attribute
+	// helpers write unless they set their own, see GuestAttributeDefaults.
+	GuestAttributeDefaults *GuestAttributeDefaults `json:",omitempty"`
+	// Run the workflow several times, see Repeat. Applied by the daisy CLI
+	// and Runner.RunRepeat, Run runs the workflow once.
+	Repeat *Repeat `json:",omitempty"`
+	// Create a network, subnetwork and firewall rule for this run, deleted
+	// at cleanup, and attach instances using the default network to it, so
+	// runs sharing a project do not interfere.
+	IsolatedNetwork bool `json:",omitempty"`
+	// Check the planned instances and disks against commonly hit org policy
+	// constraints during validation.
+	CheckOrgPolicies bool `json:",omitempty"`
+	// If set, validation fails unless every source image of the instances,
+	// disks and images the workflow creates, including in included and sub
+	// workflows, is in one of these projects.
+	TrustedImageProjects []string `json:",omitempty"`
+	// Record every mutating compute API call of the run, with the step that
+	// made it, to this local file or GCS object (gs://bucket/object).
+	AuditLog string `json:",omitempty"`
+	// Maximum number of compute API call retries of the run, 0 means no
+	// limit. Once spent, failed calls are not retried.
+	MaxAPIRetries int `json:",omitempty"`
+	// Cancel the workflow once this many compute API calls in a row failed
+	// with server errors, instead of every step retrying until it times out.
+	// 0 disables the check.
+	MaxConsecutiveAPIFailures int `json:",omitempty"`
+	// How often the compute API is polled while waiting, see
+	// PollingIntervals. Can be overridden by DAISY_POLLING_INTERVAL_*
+	// environment variables.
+	PollingIntervals *PollingIntervals `json:",omitempty"`
+	// Existing resources steps can use by name, see ExternalResources.
+	ExternalResources *ExternalResources `json:",omitempty"`
+	// Labels added to the disks, forwarding rules, images, instances and
+	// snapshots this workflow and its included and sub workflows create, e.g.
+	// billing labels such as a cost center. A resource setting one of them to
+	// another value fails validation.
+	Labels map[string]string `json:",omitempty"`
+	// Keys of the labels every disk, forwarding rule, image, instance and
+	// snapshot the workflow creates, including in included and sub workflows,
+	// must have, e.g. "cost-center", checked during validation.
+	RequiredLabels []string `json:",omitempty"`
 
 	// Working fields.
 	autovars              map[string]string
@@ -137,12 +242,47 @@ type Workflow struct {
 	recordTimeMx          sync.Mutex
 	stepWait              sync.WaitGroup
 	logProcessHook        func(string) string
-
-	// Optional compute endpoint override.stepWait
+	serialActivity        map[string]time.Time
+	serialActivityMx      sync.Mutex
+	defaultLabels         map[string]string
+	validationIssues      []ValidationIssue
+	policies              []Policy
+	validationReportMx    sync.Mutex
+	varUses               []varUse
+	// finally is the included workflow of the Finally steps.
+	finally *Workflow
+	// repeatRun is the number of the run of a repeated sub workflow.
+	repeatRun int
+
+	// Optional compute and storage endpoint overrides.
 	ComputeEndpoint    string          `json:",omitempty"`
 	ComputeClient      compute.Client  `json:"-"`
+	StorageEndpoint    string          `json:",omitempty"`
 	StorageClient      *storage.Client `json:"-"`
+	OrgPolicyClient    OrgPolicyClient `json:"-"`
+	LogReader          LogReader       `json:"-"`
+	Storage            Storage         `json:"-"`
+	SerialConsole      SerialConsole   `json:"-"`
+	KMSClient          KMSClient       `json:"-"`
 	cloudLoggingClient *logging.Client
+	// Add the label daisy-fingerprint, the first 32 characters of the
+	// Fingerprint of the workflow, to the resources it creates.
+	FingerprintLabel bool `json:",omitempty"`
+	fingerprint      string
+
+	// Optional source of the OAuth tokens of the API clients, used instead of
+	// OAuthPath. Unless it is a compute.RefreshingTokenSource, its tokens are
+	// refreshed compute.DefaultRefreshMargin before they expire.
+	TokenSource oauth2.TokenSource `json:"-"`
+	// Optional project billed for the compute and storage API calls and whose
+	// quota they use, sent as X-Goog-User-Project, e.g. in shared VPC setups.
+	QuotaProject string `json:",omitempty"`
+	// Optional reason sent as X-Goog-Request-Reason with the compute and
+	// storage API calls, recorded in Cloud Audit Logs.
+	RequestReason string `json:",omitempty"`
+	// Optional suffix appended to the User-Agent of the compute and storage
+	// API calls, e.g. "image-pipeline/1.2".
+	UserAgentSuffix string `json:",omitempty"`
 
 	// Resource registries.
 	disks           *diskRegistry
@@ -177,25 +317,51 @@ type Workflow struct {
 	stepTimeRecords             []TimeRecord
 	serialControlOutputValues   map[string]string
 	serialControlOutputValuesMx sync.Mutex
+	// Keys of serialControlOutputValues whose values must not be logged.
+	redactedOutputKeys map[string]bool
+	// Values of Sensitive vars, masked in logs and errors.
+	sensitiveValues   []string
+	sensitiveValuesMx sync.Mutex
+	// Changes made by the steps to existing resources, see Changes.
+	changes   []ResourceChange
+	changesMx sync.Mutex
+	// Artifacts collected from instances by the steps, see Artifacts.
+	artifacts   []StepArtifact
+	artifactsMx sync.Mutex
+	// Signatures uploaded by SignArtifacts steps, see Signatures.
+	signatures   []ArtifactSignature
+	signaturesMx sync.Mutex
+	// Progress events are written to progressWriter, see SetProgressWriter.
+	progressWriter io.Writer
+	progressMx     sync.Mutex
+	stepsFinished  int
+	// resumedSteps are the steps that finished in the run w resumes, see
+	// ResumeSteps.
+	resumedSteps map[string]bool
+	// leaveResources is set by LeaveResources.
+	leaveResources bool
 	//Forces cleanup on error of all resources, including those marked with NoCleanup
 	ForceCleanupOnError bool
 	// forceCleanup is set to true when resources should be forced clean, even when NoCleanup is set to true
 	forceCleanup bool
 	// cancelReason provides custom reason when workflow is canceled. f
 	cancelReason string
+	// env holds the defaults inherited from the Env of the step running an
+	// included or sub workflow, its Project and Zone are in the fields above.
+	env StepEnv
 }
 
-//DisableCloudLogging disables logging to Cloud Logging for this workflow.
+// DisableCloudLogging disables logging to Cloud Logging for this workflow.
 func (w *Workflow) DisableCloudLogging() {
 	w.cloudLoggingDisabled = true
 }
 
-//DisableGCSLogging disables logging to GCS for this workflow.
+// DisableGCSLogging disables logging to GCS for this workflow.
 func (w *Workflow) DisableGCSLogging() {
 	w.gcsLoggingDisabled = true
 }
 
-//DisableStdoutLogging disables logging to stdout for this workflow.
+// DisableStdoutLogging disables logging to stdout for this workflow.
 func (w *Workflow) DisableStdoutLogging() {
 	w.stdoutLoggingDisabled = true
 }
@@ -205,7 +371,7 @@ func (w *Workflow) AddVar(k, v string) {
 	if w.Vars == nil {
 		w.Vars = map[string]Var{}
 	}
-	w.Vars[k] = Var{Value: v}
+	w.setVarValue(k, v)
 }
 
 // AddSerialConsoleOutputValue adds an serial-output key-value pair to the Workflow.
@@ -218,6 +384,17 @@ func (w *Workflow) AddSerialConsoleOutputValue(k, v string) {
 	w.serialControlOutputValuesMx.Unlock()
 }
 
+// addRedactedOutputValue adds a serial-output value that is never logged.
+func (w *Workflow) addRedactedOutputValue(k, v string) {
+	w.serialControlOutputValuesMx.Lock()
+	if w.redactedOutputKeys == nil {
+		w.redactedOutputKeys = map[string]bool{}
+	}
+	w.redactedOutputKeys[k] = true
+	w.serialControlOutputValuesMx.Unlock()
+	w.AddSerialConsoleOutputValue(k, v)
+}
+
 // GetSerialConsoleOutputValue gets an serial-output value by key.
 func (w *Workflow) GetSerialConsoleOutputValue(k string) string {
 	return w.serialControlOutputValues[k]
@@ -234,8 +411,20 @@ func (w *Workflow) SetLogProcessHook(hook func(string) string) {
 	w.logProcessHook = hook
 }
 
-// Validate runs validation on the workflow.
-func (w *Workflow) Validate(ctx context.Context) DError {
+// Validate runs validation on the workflow, once populated and allowed by its
+// policies, see AddPolicies. The errors of all steps are returned but those
+// of steps depending on a step failing validation; see ValidationReport for
+// where they are, and for the warnings.
+func (w *Workflow) Validate(ctx context.Context) (err DError) {
+	defer func() { err = w.redactErr(err) }()
+
+	w.resetValidationReport()
+	defer func() {
+		for _, i := range w.ValidationReport().Warnings() {
+			w.LogWorkflowInfo("Validation warning: %s", i)
+		}
+	}()
+
 	if err := w.PopulateClients(ctx); err != nil {
 		w.CancelWorkflow()
 		return Errf("error populating workflow: %v", err)
@@ -246,10 +435,35 @@ func (w *Workflow) Validate(ctx context.Context) DError {
 		return Errf("error validating workflow: %v", err)
 	}
 
+	// Workflows populated beforehand, e.g. to be modified, have no fingerprint.
+	if w.parent == nil && !w.populated() {
+		if _, err := w.Fingerprint(ctx); err != nil {
+			w.CancelWorkflow()
+			return Errf("error fingerprinting workflow: %v", err)
+		}
+	}
+
 	if err := w.populate(ctx); err != nil {
 		w.CancelWorkflow()
 		return Errf("error populating workflow: %v", err)
 	}
+	if err := w.addWorkflowLabels(); err != nil {
+		w.reportValidationError(nil, "Labels", err)
+		w.LogWorkflowInfo("Error validating workflow: %v", err)
+		w.CancelWorkflow()
+		return err
+	}
+	w.addDefaultLabels()
+	if w.FingerprintLabel {
+		w.addFingerprintLabel()
+	}
+
+	if err := w.evaluatePolicies(ctx); err != nil {
+		w.reportValidationError(nil, "", err)
+		w.LogWorkflowInfo("Error evaluating policies: %v", err)
+		w.CancelWorkflow()
+		return err
+	}
 
 	w.LogWorkflowInfo("Validating workflow")
 	if err := w.validate(ctx); err != nil {
@@ -257,24 +471,79 @@ func (w *Workflow) Validate(ctx context.Context) DError {
 		w.CancelWorkflow()
 		return err
 	}
+	if len(w.TrustedImageProjects) > 0 {
+		if err := w.checkTrustedImageProjects(); err != nil {
+			w.reportValidationError(nil, "TrustedImageProjects", err)
+			w.LogWorkflowInfo("Error validating workflow: %v", err)
+			w.CancelWorkflow()
+			return err
+		}
+	}
+	if w.CheckOrgPolicies {
+		if err := w.checkOrgPolicies(); err != nil {
+			w.reportValidationError(nil, "CheckOrgPolicies", err)
+			w.LogWorkflowInfo("Error validating workflow: %v", err)
+			w.CancelWorkflow()
+			return err
+		}
+	}
+	if len(w.RequiredLabels) > 0 {
+		if err := w.checkRequiredLabels(); err != nil {
+			w.reportValidationError(nil, "RequiredLabels", err)
+			w.LogWorkflowInfo("Error validating workflow: %v", err)
+			w.CancelWorkflow()
+			return err
+		}
+	}
 	w.LogWorkflowInfo("Validation Complete")
 	return nil
 }
 
 // WorkflowModifier is a function type for functions that can modify a Workflow object.
 //
-// Deprecated: This will be removed in a future release.
+// Deprecated: This will be removed in a future release. Use RunWithModifiers
+// and PostValidateModifier, which only allow changes that keep the workflow
+// valid.
 type WorkflowModifier func(*Workflow)
 
 // Run runs a workflow.
-func (w *Workflow) Run(ctx context.Context) (err DError) {
+func (w *Workflow) Run(ctx context.Context) DError {
+	return w.RunWithModifiers(ctx)
+}
+
+// RunWithModifiers runs a workflow as Run does, calling modifiers in order
+// once the workflow is validated. The workflow fails if a modifier returns an
+// error or changes the steps or dependencies of the workflow.
+func (w *Workflow) RunWithModifiers(ctx context.Context, modifiers ...PostValidateModifier) (err DError) {
+	defer func() { err = w.redactErr(err) }()
 
 	w.externalLogging = true
 	if err = w.Validate(ctx); err != nil {
 		return err
 	}
+	if err = w.applyModifiers(modifiers); err != nil {
+		w.LogWorkflowInfo("Error modifying workflow: %v", err)
+		return err
+	}
+	stopCancelOnDone := w.cancelOnDone(ctx)
+	defer stopCancelOnDone()
+	if err = w.setupAuditLog(); err != nil {
+		return err
+	}
+	removeRetryBudget := w.setupRetryBudget()
 
+	// Deferred before cleanup so it reports the calls of cleanup too, and the
+	// resources deleted by cleanup.
+	defer func() {
+		w.logAPIUsage()
+		w.logResourceHours()
+		if w.Logger != nil {
+			w.Logger.Flush()
+		}
+	}()
 	defer w.cleanup()
+	// Deferred after cleanup so it runs first.
+	defer removeRetryBudget()
 	defer func() {
 		if err != nil {
 			w.forceCleanup = w.ForceCleanupOnError
@@ -286,6 +555,7 @@ func (w *Workflow) Run(ctx context.Context) (err DError) {
 	}
 	w.LogWorkflowInfo("Workflow Project: %s", w.Project)
 	w.LogWorkflowInfo("Workflow Zone: %s", w.Zone)
+	w.LogWorkflowInfo("Workflow Fingerprint: %s", w.fingerprint)
 	w.LogWorkflowInfo("Workflow GCSPath: %s", w.GCSPath)
 	w.LogWorkflowInfo("Daisy scratch path: https://console.cloud.google.com/storage/browser/%s", path.Join(w.bucket, w.scratchPath))
 
@@ -296,8 +566,13 @@ func (w *Workflow) Run(ctx context.Context) (err DError) {
 		return err
 	}
 	w.LogWorkflowInfo("Running workflow")
+	defer w.logChanges()
+	defer w.logArtifacts()
 	defer func() {
 		for k, v := range w.serialControlOutputValues {
+			if w.redactedOutputKeys[k] {
+				v = "<redacted>"
+			}
 			w.LogWorkflowInfo("Serial-output value -> %v:%v", k, v)
 		}
 	}()
@@ -346,11 +621,7 @@ func (w *Workflow) cleanup() {
 	case <-time.After(4 * time.Second):
 	}
 
-	for _, hook := range w.cleanupHooks {
-		if err := hook(); err != nil {
-			w.LogWorkflowInfo("Error returned from cleanup hook: %s", err)
-		}
-	}
+	w.runCleanupHooks()
 	w.LogWorkflowInfo("Workflow %q finished cleanup.", w.Name)
 	w.recordStepTime("workflow cleanup", startTime, time.Now())
 }
@@ -367,13 +638,25 @@ func (w *Workflow) genName(n string) string {
 	if len(prefix) > 57 {
 		prefix = prefix[0:56]
 	}
-	result := fmt.Sprintf("%s-%s", prefix, w.id)
+	suffix := w.id
+	if root := w.root(); root.DeterministicNames {
+		suffix = hashString(len(w.id), root.Name, root.RunID, name+w.repeatKey(), n)
+	}
+	result := fmt.Sprintf("%s-%s", prefix, suffix)
 	if len(result) > 64 {
 		result = result[0:63]
 	}
 	return strings.ToLower(result)
 }
 
+// root returns the top level workflow w belongs to.
+func (w *Workflow) root() *Workflow {
+	for w.parent != nil {
+		w = w.parent
+	}
+	return w
+}
+
 func (w *Workflow) getSourceGCSAPIPath(s string) string {
 	return fmt.Sprintf("%s/%s", gcsAPIBase, path.Join(w.bucket, w.sourcesPath, s))
 }
@@ -387,20 +670,40 @@ func (w *Workflow) PopulateClients(ctx context.Context, options ...option.Client
 		storageOptions []option.ClientOption
 		loggingOptions []option.ClientOption
 	)
+	// The clients are used by cleanup, which runs even if ctx is canceled.
+	ctx = detachContext(ctx)
 
 	if len(options) > 0 {
 		computeOptions = options
 		storageOptions = options
 		loggingOptions = options
+	} else if w.TokenSource != nil {
+		ts, ok := w.TokenSource.(*compute.RefreshingTokenSource)
+		if !ok {
+			ts = compute.NewRefreshingTokenSource(w.TokenSource, compute.DefaultRefreshMargin)
+		}
+		computeOptions = []option.ClientOption{option.WithTokenSource(ts)}
+		storageOptions = []option.ClientOption{option.WithTokenSource(ts)}
+		loggingOptions = []option.ClientOption{option.WithTokenSource(ts)}
 	} else {
 		computeOptions = []option.ClientOption{option.WithCredentialsFile(w.OAuthPath)}
 		storageOptions = []option.ClientOption{option.WithCredentialsFile(w.OAuthPath)}
 		loggingOptions = []option.ClientOption{option.WithCredentialsFile(w.OAuthPath)}
 	}
 
+	if computeOptions, err = w.requestHeadersOptions(ctx, computeOptions); err != nil {
+		return typedErr(apiError, "failed to create compute client", err)
+	}
+	if storageOptions, err = w.requestHeadersOptions(ctx, storageOptions); err != nil {
+		return err
+	}
+
 	if w.ComputeEndpoint != "" {
 		computeOptions = append(computeOptions, option.WithEndpoint(w.ComputeEndpoint))
 	}
+	if w.StorageEndpoint != "" {
+		storageOptions = append(storageOptions, option.WithEndpoint(w.StorageEndpoint))
+	}
 
 	if w.ComputeClient == nil {
 		w.ComputeClient, err = compute.NewClient(ctx, computeOptions...)
@@ -416,6 +719,21 @@ func (w *Workflow) PopulateClients(ctx context.Context, options ...option.Client
 		}
 	}
 
+	if w.CheckOrgPolicies && w.OrgPolicyClient == nil {
+		w.OrgPolicyClient, err = NewOrgPolicyClient(ctx, storageOptions...)
+		if err != nil {
+			return typedErr(apiError, "failed to create org policy client", err)
+		}
+	}
+
+	if w.LogReader == nil {
+		w.LogReader = NewLogReader(loggingOptions...)
+	}
+
+	if w.KMSClient == nil {
+		w.KMSClient = NewKMSClient(storageOptions...)
+	}
+
 	if w.externalLogging && !w.cloudLoggingDisabled && w.cloudLoggingClient == nil {
 		w.cloudLoggingClient, err = logging.NewClient(ctx, w.Project, loggingOptions...)
 		if err != nil {
@@ -434,6 +752,23 @@ func (w *Workflow) populateStep(ctx context.Context, s *Step) DError {
 		return newErr(fmt.Sprintf("failed to parse duration for workflow %v, step %v", w.Name, s.name), err)
 	}
 	s.timeout = timeout
+	if s.TimeoutPerGb != "" {
+		if s.CreateImages == nil && s.CreateDisks == nil && s.CreateSnapshots == nil && s.ExportImage == nil && s.ImportDisk == nil {
+			return Errf("step %q: TimeoutPerGb is only supported by CreateImages, CreateDisks, CreateSnapshots, ExportImage and ImportDisk steps", s.name)
+		}
+		if s.timeoutPerGb, err = time.ParseDuration(s.TimeoutPerGb); err != nil {
+			return newErr(fmt.Sprintf("failed to parse TimeoutPerGb for workflow %v, step %v", w.Name, s.name), err)
+		}
+	}
+	if s.Repeat != nil {
+		if s.SubWorkflow == nil {
+			return Errf("step %q: Repeat is only supported by SubWorkflow steps", s.name)
+		}
+		if err := s.Repeat.populate(); err != nil {
+			return Errf("step %q: %v", s.name, err)
+		}
+		s.timeout = s.Repeat.timeout(s.timeout)
+	}
 
 	var derr DError
 	var step stepImpl
@@ -457,6 +792,11 @@ func (w *Workflow) populate(ctx context.Context) DError {
 			return Errf("cannot populate workflow, required var %q is unset", k)
 		}
 	}
+	w.registerSensitiveVars()
+
+	if root := w.root(); root.DeterministicNames {
+		w.id = hashString(len(w.id), root.Name, root.RunID, getAbsoluteName(w)+w.repeatKey())
+	}
 
 	// Set some generic autovars and run first round of var substitution.
 	cwd, _ := os.Getwd()
@@ -472,7 +812,11 @@ func (w *Workflow) populate(ctx context.Context) DError {
 		"WFDIR":     w.workflowDir,
 		"CWD":       cwd,
 	}
+	if fp := w.root().fingerprint; fp != "" {
+		w.autovars["FINGERPRINT"] = fp
+	}
 
+	w.recordVarUses()
 	var replacements []string
 	for k, v := range w.autovars {
 		replacements = append(replacements, fmt.Sprintf("${%s}", k), v)
@@ -489,6 +833,53 @@ func (w *Workflow) populate(ctx context.Context) DError {
 	}
 	w.defaultTimeout = timeout
 
+	if w.CleanupTimeout != "" {
+		if w.cleanupTimeout, err = time.ParseDuration(w.CleanupTimeout); err != nil {
+			return Errf("failed to parse CleanupTimeout for workflow: %v", err)
+		}
+	}
+
+	if w.MaxConcurrency < 0 {
+		return Errf("MaxConcurrency must not be negative: %d", w.MaxConcurrency)
+	}
+	if w.OnStepFailure != "" && !strIn(w.OnStepFailure, onStepFailurePolicies) {
+		return Errf("unknown OnStepFailure %q, must be one of %q", w.OnStepFailure, onStepFailurePolicies)
+	}
+	if w.TimeoutWarningPercent < 0 || w.TimeoutWarningPercent >= 100 {
+		return Errf("TimeoutWarningPercent must be between 0 and 99: %d", w.TimeoutWarningPercent)
+	}
+	if err := w.validateWaitStatusInterval(); err != nil {
+		return err
+	}
+	if err := w.validateSerialLog(); err != nil {
+		return err
+	}
+	if err := w.validateGuestAttributeDefaults(); err != nil {
+		return err
+	}
+	if w.Repeat != nil {
+		if w.parent != nil {
+			return Errf("Repeat is only supported by top level workflows, set it on the SubWorkflow step instead")
+		}
+		if err := w.Repeat.populate(); err != nil {
+			return err
+		}
+	}
+	if w.MaxAPIRetries < 0 {
+		return Errf("MaxAPIRetries must not be negative: %d", w.MaxAPIRetries)
+	}
+	if w.MaxConsecutiveAPIFailures < 0 {
+		return Errf("MaxConsecutiveAPIFailures must not be negative: %d", w.MaxConsecutiveAPIFailures)
+	}
+	if err := w.validateSourceSHA256(); err != nil {
+		return err
+	}
+	if w.parent == nil {
+		if err := w.populatePollingIntervals(); err != nil {
+			return err
+		}
+	}
+
 	// Set up GCS paths.
 	if w.GCSPath == "" {
 		dBkt, err := daisyBkt(ctx, w.StorageClient, w.Project)
@@ -528,6 +919,18 @@ func (w *Workflow) populate(ctx context.Context) DError {
 		w.createLogger(ctx)
 	}
 
+	if w.IsolatedNetwork && w.parent == nil {
+		if err := w.addIsolatedNetwork(); err != nil {
+			return err
+		}
+	}
+
+	if w.Finally != nil {
+		if err := w.addFinally(); err != nil {
+			return err
+		}
+	}
+
 	// Run populate on each step.
 	for name, s := range w.Steps {
 		s.name = name
@@ -547,6 +950,10 @@ func (w *Workflow) populate(ctx context.Context) DError {
 		return err
 	}
 
+	// Nested workflows are populated by their steps, by now.
+	if w.parent == nil {
+		w.warnDeprecated()
+	}
 	return nil
 }
 
@@ -570,8 +977,81 @@ func (w *Workflow) AddDependency(dependent *Step, dependencies ...*Step) error {
 	return nil
 }
 
+// addCompletionDependencies adds the DependsOnCompletionOf steps of the steps
+// of w to their Dependencies.
+func (w *Workflow) addCompletionDependencies() {
+	for name, s := range w.Steps {
+		for _, d := range s.DependsOnCompletionOf {
+			if w.Dependencies == nil {
+				w.Dependencies = map[string][]string{}
+			}
+			if !strIn(d, w.Dependencies[name]) {
+				w.Dependencies[name] = append(w.Dependencies[name], d)
+			}
+		}
+	}
+}
+
+// InsertStepBefore makes s, a step of this workflow, run right before the step
+// named name: s takes over the dependencies of that step, which then depends
+// on s only. Dependencies of s are kept.
+func (w *Workflow) InsertStepBefore(name string, s *Step) error {
+	if err := w.checkInsertStep(name, s); err != nil {
+		return err
+	}
+	for _, dep := range w.Dependencies[name] {
+		if !strIn(dep, w.Dependencies[s.name]) {
+			w.Dependencies[s.name] = append(w.Dependencies[s.name], dep)
+		}
+	}
+	w.Dependencies[name] = []string{s.name}
+	return nil
+}
+
+// InsertStepAfter makes s, a step of this workflow, run right after the step
+// named name: s depends on that step, and the steps that depended on it depend
+// on s instead. Dependencies of s are kept.
+func (w *Workflow) InsertStepAfter(name string, s *Step) error {
+	if err := w.checkInsertStep(name, s); err != nil {
+		return err
+	}
+	for dependent, deps := range w.Dependencies {
+		if dependent == s.name {
+			continue
+		}
+		for i, dep := range deps {
+			if dep == name {
+				deps[i] = s.name
+			}
+		}
+	}
+	if !strIn(name, w.Dependencies[s.name]) {
+		w.Dependencies[s.name] = append(w.Dependencies[s.name], name)
+	}
+	return nil
+}
+
+func (w *Workflow) checkInsertStep(name string, s *Step) error {
+	if _, ok := w.Steps[name]; !ok {
+		return fmt.Errorf("can't insert step: step %q does not exist", name)
+	}
+	if w.Steps[s.name] != s {
+		return fmt.Errorf("can't insert step: step %q is not a step of this workflow", s.name)
+	}
+	if s.name == name {
+		return fmt.Errorf("can't insert step %q next to itself", name)
+	}
+	if w.Dependencies == nil {
+		w.Dependencies = map[string][]string{}
+	}
+	return nil
+}
+
 func (w *Workflow) includeWorkflow(iw *Workflow) {
-	iw.Cancel = w.Cancel
+	// The Finally steps run even if w is canceled.
+	if iw != w.finally {
+		iw.Cancel = w.Cancel
+	}
 	iw.parent = w
 	iw.disks = w.disks
 	iw.forwardingRules = w.forwardingRules
@@ -593,8 +1073,18 @@ func (w *Workflow) ID() string {
 
 // NewIncludedWorkflowFromFile reads and unmarshals a workflow with the same resources as the parent.
 func (w *Workflow) NewIncludedWorkflowFromFile(file string) (*Workflow, DError) {
+	return w.newIncludedWorkflowFromFile(context.Background(), file)
+}
+
+func (w *Workflow) newIncludedWorkflowFromFile(ctx context.Context, file string) (*Workflow, DError) {
 	iw := New()
 	w.includeWorkflow(iw)
+	if strings.HasPrefix(file, "gs://") {
+		if err := w.readWorkflowFromGCS(ctx, file, iw); err != nil {
+			return nil, err
+		}
+		return iw, nil
+	}
 	if !filepath.IsAbs(file) {
 		file = filepath.Join(w.workflowDir, file)
 	}
@@ -628,7 +1118,17 @@ func (w *Workflow) NewSubWorkflow() *Workflow {
 
 // NewSubWorkflowFromFile reads and unmarshals a workflow as a child to this workflow.
 func (w *Workflow) NewSubWorkflowFromFile(file string) (*Workflow, DError) {
+	return w.newSubWorkflowFromFile(context.Background(), file)
+}
+
+func (w *Workflow) newSubWorkflowFromFile(ctx context.Context, file string) (*Workflow, DError) {
 	sw := w.NewSubWorkflow()
+	if strings.HasPrefix(file, "gs://") {
+		if err := w.readWorkflowFromGCS(ctx, file, sw); err != nil {
+			return nil, err
+		}
+		return sw, nil
+	}
 	if !filepath.IsAbs(file) {
 		file = filepath.Join(w.workflowDir, file)
 	}
@@ -652,50 +1152,161 @@ func (w *Workflow) Print(ctx context.Context) {
 	if err != nil {
 		fmt.Println("Error marshalling workflow for printing:", err)
 	}
-	fmt.Println(string(b))
+	fmt.Println(w.redact(string(b)))
+}
+
+// Marshal serializes the workflow as indented JSON, with object keys sorted.
+// Called after Validate or Run, the result is the workflow as executed: vars
+// substituted, resource names generated and defaults filled in. If expanded
+// is true, the workflows of IncludeWorkflow and SubWorkflow steps, Finally
+// steps included, are inlined, otherwise only their Path and Vars are kept.
+// Sensitive var values are redacted.
+func (w *Workflow) Marshal(expanded bool) ([]byte, error) {
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	// Decode numbers as json.Number, float64 would round large integers.
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if finally, ok := doc["Finally"].(map[string]interface{}); ok {
+		// The step running the Finally steps is added by populate.
+		if steps, ok := doc["Steps"].(map[string]interface{}); ok {
+			delete(steps, finallyStep)
+		}
+		if !expanded {
+			stripNestedWorkflows(finally)
+		}
+	}
+	if !expanded {
+		stripNestedWorkflows(doc)
+	}
+	if b, err = json.MarshalIndent(doc, "", "  "); err != nil {
+		return nil, err
+	}
+	return []byte(w.redact(string(b))), nil
+}
+
+// stripNestedWorkflows removes the Workflow of IncludeWorkflow and
+// SubWorkflow steps from a decoded workflow document, or from its decoded
+// Finally.
+func stripNestedWorkflows(doc map[string]interface{}) {
+	steps, _ := doc["Steps"].(map[string]interface{})
+	for _, s := range steps {
+		step, _ := s.(map[string]interface{})
+		for _, typ := range []string{"IncludeWorkflow", "SubWorkflow"} {
+			if nested, ok := step[typ].(map[string]interface{}); ok {
+				delete(nested, "Workflow")
+			}
+		}
+	}
 }
 
 func (w *Workflow) run(ctx context.Context) DError {
-	return w.traverseDAG(func(s *Step) DError {
+	return w.traverseDAGOnFailure(w.onStepFailure(), func(s *Step) DError {
 		return w.runStep(ctx, s)
 	})
 }
 
 func (w *Workflow) runStep(ctx context.Context, s *Step) DError {
+	s.scaleTimeout()
 	timeout := make(chan struct{})
 	go func() {
 		time.Sleep(s.timeout)
 		close(timeout)
 	}()
 
+	var warn <-chan time.Time
+	pct := w.timeoutWarningPercent()
+	if pct > 0 {
+		t := time.NewTimer(s.timeout * time.Duration(pct) / 100)
+		defer t.Stop()
+		warn = t.C
+	}
+
+	var status <-chan time.Time
+	start := time.Now()
+	if d := w.waitStatusInterval(); d > 0 && s.instanceSignals() != nil {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		status = t.C
+	}
+
 	e := make(chan DError)
 	go func() {
 		e <- s.run(ctx)
 	}()
 
-	select {
-	case err := <-e:
-		return err
-	case <-timeout:
-		return s.getTimeoutError()
+	for {
+		select {
+		case err := <-e:
+			return err
+		case <-timeout:
+			return s.getTimeoutError()
+		case <-warn:
+			go s.warnTimeout(pct)
+			warn = nil
+		case <-status:
+			s.reportWaitStatus(time.Since(start))
+		}
+	}
+}
+
+// timeoutWarningPercent returns the TimeoutWarningPercent of w, or of the
+// closest parent that sets it.
+func (w *Workflow) timeoutWarningPercent() int {
+	for ; w != nil; w = w.parent {
+		if w.TimeoutWarningPercent > 0 {
+			return w.TimeoutWarningPercent
+		}
 	}
+	return 0
+}
+
+// onStepFailure returns the OnStepFailure of w, or of the closest parent that
+// sets it.
+func (w *Workflow) onStepFailure() string {
+	for ; w != nil; w = w.parent {
+		if w.OnStepFailure != "" {
+			return w.OnStepFailure
+		}
+	}
+	return OnStepFailureAbortAll
 }
 
 // Concurrently traverse the DAG, running func f on each step.
 // Return an error if f returns an error on any step.
 func (w *Workflow) traverseDAG(f func(*Step) DError) DError {
+	return w.traverseDAGOnFailure(OnStepFailureAbortAll, f)
+}
+
+// traverseDAGOnFailure traverses the DAG as traverseDAG does, handling the
+// errors of f as the OnStepFailure policy says. Unless the policy is
+// OnStepFailureAbortAll and no AlwaysRun step is waiting, the errors of all
+// the failed steps are returned once no step is running.
+func (w *Workflow) traverseDAGOnFailure(policy string, f func(*Step) DError) DError {
 	// waiting = steps and the dependencies they are waiting for.
 	// running = the currently running steps.
 	// start = map of steps' start channels/semaphores.
 	// done = map of steps' done channels for signaling step completion.
 	waiting := map[string][]string{}
 	var running []string
+	var errs DError
 	start := map[string]chan DError{}
 	done := map[string]chan DError{}
 
 	// Setup: channels, copy dependencies.
-	for name := range w.Steps {
+	for name, s := range w.Steps {
 		waiting[name] = w.Dependencies[name]
+		for _, d := range s.DependsOnCompletionOf {
+			if !strIn(d, waiting[name]) {
+				waiting[name] = append(waiting[name], d)
+			}
+		}
 		start[name] = make(chan DError)
 		done[name] = make(chan DError)
 	}
@@ -714,21 +1325,43 @@ func (w *Workflow) traverseDAG(f func(*Step) DError) DError {
 
 	// Main signaling logic.
 	for len(waiting) != 0 || len(running) != 0 {
-		// If we got a Cancel signal, kill all waiting steps.
-		// Let running steps finish.
+		// If we got a Cancel signal, kill all waiting steps but the Finally
+		// step. Let running steps finish.
 		select {
 		case <-w.Cancel:
-			waiting = map[string][]string{}
+			var dropped []string
+			for name := range waiting {
+				if !w.Steps[name].runOnCancel {
+					delete(waiting, name)
+					dropped = append(dropped, name)
+				}
+			}
+			w.skipDependents(waiting, dropped)
 		default:
 		}
 
-		// Kick off all steps that aren't waiting for anything.
+		// Kick off all steps that aren't waiting for anything, highest
+		// priority first if concurrency is capped.
+		var ready []string
 		for name, deps := range waiting {
 			if len(deps) == 0 {
-				delete(waiting, name)
-				running = append(running, name)
-				close(start[name])
+				ready = append(ready, name)
+			}
+		}
+		if w.MaxConcurrency > 0 {
+			w.sortByPriority(ready)
+			free := w.MaxConcurrency - len(running)
+			if free < 0 {
+				free = 0
 			}
+			if free < len(ready) {
+				ready = ready[:free]
+			}
+		}
+		for _, name := range ready {
+			delete(waiting, name)
+			running = append(running, name)
+			close(start[name])
 		}
 
 		// Sanity check. There should be at least one running step,
@@ -737,21 +1370,106 @@ func (w *Workflow) traverseDAG(f func(*Step) DError) DError {
 			continue
 		}
 
-		// Get next finished step. Return the step error if it erred.
+		// Get next finished step. Return the step error if it erred, unless
+		// the policy says to go on.
 		finished, err := stepsListen(running, done)
-		if err != nil {
-			return err
+		running = filter(running, finished)
+		if err == nil {
+			// Remove finished step from other steps' waiting lists.
+			for name, deps := range waiting {
+				waiting[name] = filter(deps, finished)
+			}
+			continue
 		}
 
-		// Remove finished step from other steps' waiting lists.
+		errs = addErrs(errs, err)
+		var dropped []string
+		if policy != OnStepFailureContinueIndependentBranches {
+			// Start no more steps but AlwaysRun ones.
+			for name := range waiting {
+				if !w.Steps[name].AlwaysRun {
+					delete(waiting, name)
+					dropped = append(dropped, name)
+				}
+			}
+			if len(dropped) > 0 {
+				sort.Strings(dropped)
+				w.LogWorkflowInfo("Step %q failed, not starting steps %q.", finished, dropped)
+			}
+		}
+		w.skipDependents(waiting, append([]string{finished}, dropped...))
+		if policy == OnStepFailureAbortAll {
+			if len(waiting) == 0 {
+				return errs
+			}
+			// Only the Finally step is left, cancel the running steps as
+			// cleanup would, it runs once they stopped.
+			for name := range waiting {
+				if len(waiting) == 1 && w.parent == nil && w.Steps[name].runOnCancel {
+					w.CancelWorkflow()
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// skipDependents removes from waiting the steps depending on the success of
+// the steps gone, failed or not started, directly or not. The steps depending
+// on their completion stop waiting for them.
+func (w *Workflow) skipDependents(waiting map[string][]string, gone []string) {
+	for i := 0; i < len(gone); i++ {
+		g := gone[i]
 		for name, deps := range waiting {
-			waiting[name] = filter(deps, finished)
+			if !strIn(g, deps) {
+				continue
+			}
+			if strIn(g, w.Steps[name].DependsOnCompletionOf) {
+				waiting[name] = filter(deps, g)
+				continue
+			}
+			w.LogWorkflowInfo("Skipping step %q, it depends on step %q, which failed or was not started.", name, g)
+			delete(waiting, name)
+			gone = append(gone, name)
 		}
+	}
+}
 
-		// Remove finished from currently running list.
-		running = filter(running, finished)
+// sortByPriority sorts step names by descending Priority. Ties are broken by
+// the length of the longest chain of steps depending on each step, so steps on
+// the critical path run first, and then by name.
+func (w *Workflow) sortByPriority(names []string) {
+	dependents := map[string][]string{}
+	for name, deps := range w.Dependencies {
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
 	}
-	return nil
+	heights := map[string]int{}
+	var height func(name string) int
+	height = func(name string) int {
+		if h, ok := heights[name]; ok {
+			return h
+		}
+		h := 0
+		for _, d := range dependents[name] {
+			if dh := height(d) + 1; dh > h {
+				h = dh
+			}
+		}
+		heights[name] = h
+		return h
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := w.Steps[names[i]].Priority, w.Steps[names[j]].Priority
+		if pi != pj {
+			return pi > pj
+		}
+		if hi, hj := height(names[i]), height(names[j]); hi != hj {
+			return hi > hj
+		}
+		return names[i] < names[j]
+	})
 }
 
 // New instantiates a new workflow.
@@ -779,6 +1497,10 @@ func New() *Workflow {
 	w.targetInstances = newTargetInstanceRegistry(w)
 	w.snapshots = newSnapshotRegistry(w)
 	w.addCleanupHook(func() DError {
+		if w.leaveResources {
+			w.LogWorkflowInfo("Workflow %q leaves its resources to the run resuming it.", w.Name)
+			return nil
+		}
 		w.instances.cleanup() // instances need to be done before disks/networks
 		w.images.cleanup()
 		w.machineImages.cleanup()
@@ -837,7 +1559,7 @@ func JSONError(file string, data []byte, err error) error {
 	return fmt.Errorf("%s: JSON syntax error in line %d: %s \n%s\n%s^", file, line, err, data[start:end], strings.Repeat(" ", pos))
 }
 
-func readWorkflow(file string, w *Workflow) (derr DError) {
+func readWorkflow(file string, w *Workflow) DError {
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return newErr("failed to read workflow file", err)
@@ -848,6 +1570,26 @@ func readWorkflow(file string, w *Workflow) (derr DError) {
 		return newErr("failed to get absolute path of workflow file", err)
 	}
 
+	return unmarshalWorkflow(file, data, w)
+}
+
+// readWorkflowFromGCS reads and unmarshals the workflow at GCS path p into
+// cw, a workflow included in or a sub workflow of w. Relative paths in cw
+// are resolved from the directory of w.
+func (w *Workflow) readWorkflowFromGCS(ctx context.Context, p string, cw *Workflow) DError {
+	bkt, obj, err := splitGCSPath(p)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := DownloadObject(ctx, w.storage(), bkt, obj, &buf); err != nil {
+		return newErr("failed to read workflow file", err)
+	}
+	cw.workflowDir = w.workflowDir
+	return unmarshalWorkflow(p, buf.Bytes(), cw)
+}
+
+func unmarshalWorkflow(file string, data []byte, w *Workflow) (derr DError) {
 	if err := json.Unmarshal(data, &w); err != nil {
 		return newErr("failed to unmarshal workflow file", JSONError(file, data, err))
 	}
@@ -860,13 +1602,17 @@ func readWorkflow(file string, w *Workflow) (derr DError) {
 		step.name = name
 		step.w = w
 
+		// Workflows in GCS are read when the step is populated, once the
+		// storage client is available.
 		if step.SubWorkflow != nil &&
 			step.SubWorkflow.Path != "" &&
-			!hasVariableDeclaration(step.SubWorkflow.Path) {
+			!hasVariableDeclaration(step.SubWorkflow.Path) &&
+			!strings.HasPrefix(step.SubWorkflow.Path, "gs://") {
 			step.SubWorkflow.Workflow, derr = w.NewSubWorkflowFromFile(step.SubWorkflow.Path)
 		} else if step.IncludeWorkflow != nil &&
 			step.IncludeWorkflow.Path != "" &&
-			!hasVariableDeclaration(step.IncludeWorkflow.Path) {
+			!hasVariableDeclaration(step.IncludeWorkflow.Path) &&
+			!strings.HasPrefix(step.IncludeWorkflow.Path, "gs://") {
 			step.IncludeWorkflow.Workflow, derr = w.NewIncludedWorkflowFromFile(step.IncludeWorkflow.Path)
 		} else {
 			continue
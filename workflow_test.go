@@ -26,12 +26,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/storage"
+	daisyCompute "github.com/GoogleCloudPlatform/compute-daisy/compute"
 	"github.com/stretchr/testify/assert"
 	computeAlpha "google.golang.org/api/compute/v0.alpha"
 	computeBeta "google.golang.org/api/compute/v0.beta"
@@ -72,6 +75,59 @@ func TestAddDependency(t *testing.T) {
 	}
 }
 
+func TestInsertStep(t *testing.T) {
+	newWorkflow := func() *Workflow {
+		w := &Workflow{}
+		for _, n := range []string{"a", "b", "c", "new"} {
+			w.NewStep(n)
+		}
+		// a -> b -> c, a -> c
+		w.Dependencies = map[string][]string{"b": {"a"}, "c": {"a", "b"}}
+		return w
+	}
+	otherW := &Workflow{}
+	other, _ := otherW.NewStep("new")
+
+	tests := []struct {
+		desc     string
+		after    bool
+		name     string
+		other    bool
+		wantDeps map[string][]string
+		wantErr  bool
+	}{
+		{"before first", false, "a", false, map[string][]string{"a": {"new"}, "b": {"a"}, "c": {"a", "b"}}, false},
+		{"before", false, "b", false, map[string][]string{"b": {"new"}, "c": {"a", "b"}, "new": {"a"}}, false},
+		{"after", true, "a", false, map[string][]string{"b": {"new"}, "c": {"new", "b"}, "new": {"a"}}, false},
+		{"after last", true, "c", false, map[string][]string{"b": {"a"}, "c": {"a", "b"}, "new": {"c"}}, false},
+		{"unknown step", false, "d", false, nil, true},
+		{"step of other workflow", true, "a", true, nil, true},
+		{"next to itself", true, "new", false, nil, true},
+	}
+	for _, tt := range tests {
+		w := newWorkflow()
+		s := w.Steps["new"]
+		if tt.other {
+			s = other
+		}
+		var err error
+		if tt.after {
+			err = w.InsertStepAfter(tt.name, s)
+		} else {
+			err = w.InsertStepBefore(tt.name, s)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tt.desc, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if diffRes := diff(w.Dependencies, tt.wantDeps, 0); diffRes != "" {
+			t.Errorf("%s: incorrect dependencies: (-got,+want)\n%s", tt.desc, diffRes)
+		}
+	}
+}
+
 func TestDaisyBkt(t *testing.T) {
 	client, err := newTestGCSClient()
 	if err != nil {
@@ -147,6 +203,34 @@ func TestGenName(t *testing.T) {
 	}
 }
 
+func TestGenNameDeterministic(t *testing.T) {
+	w1 := New()
+	w1.Name = "wfname"
+	w1.DeterministicNames = true
+	w1.RunID = "run1"
+	w2 := New()
+	w2.Name = "wfname"
+	w2.DeterministicNames = true
+	w2.RunID = "run1"
+	if w1.id == w2.id {
+		t.Fatalf("expected random workflow ids to differ, both are %q", w1.id)
+	}
+
+	if got, want := w1.genName("name"), w2.genName("name"); got != want {
+		t.Errorf("names differ for the same workflow name and run ID: %q != %q", got, want)
+	}
+	if a, b := w1.genName("a"), w1.genName("b"); a[len(a)-len(w1.id):] == b[len(b)-len(w1.id):] {
+		t.Errorf("expected different suffixes for different resources: %q, %q", a, b)
+	}
+	w2.RunID = "run2"
+	if got, other := w1.genName("name"), w2.genName("name"); got == other {
+		t.Errorf("expected names to differ across run IDs, got %q for both", got)
+	}
+	if got := w1.genName("name"); len(got) != len("name-wfname-")+len(w1.id) {
+		t.Errorf("unexpected name length: %q", got)
+	}
+}
+
 func TestGetSourceGCSAPIPath(t *testing.T) {
 	w := testWorkflow()
 	w.sourcesPath = "my/sources"
@@ -711,6 +795,7 @@ func TestPopulate(t *testing.T) {
 	want.logsPath = fmt.Sprintf("%s/logs", got.scratchPath)
 	want.outsPath = fmt.Sprintf("%s/outs", got.scratchPath)
 	want.username = got.username
+	want.varUses = got.varUses
 	want.Steps = map[string]*Step{
 		"wf-name-step1": {
 			name:    "wf-name-step1",
@@ -852,6 +937,109 @@ func TestTraverseDAG(t *testing.T) {
 	}
 }
 
+func TestTraverseDAGMaxConcurrency(t *testing.T) {
+	w := testWorkflow()
+	w.MaxConcurrency = 1
+	w.Steps = map[string]*Step{
+		"a": {name: "a", w: w},
+		"b": {name: "b", w: w, Priority: 5},
+		"c": {name: "c", w: w},
+		"d": {name: "d", w: w},
+	}
+	w.Dependencies = map[string][]string{"d": {"c"}}
+
+	var mx sync.Mutex
+	var order []string
+	var running, maxRunning int
+	err := w.traverseDAG(func(s *Step) DError {
+		mx.Lock()
+		order = append(order, s.name)
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mx.Unlock()
+		time.Sleep(time.Millisecond)
+		mx.Lock()
+		running--
+		mx.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if maxRunning != 1 {
+		t.Errorf("expected at most 1 step running, got %d", maxRunning)
+	}
+	// b has the highest priority, c is on the longest chain.
+	want := []string{"b", "c", "a", "d"}
+	if diffRes := diff(order, want, 0); diffRes != "" {
+		t.Errorf("step order does not match expectation: (-got +want)\n%s", diffRes)
+	}
+}
+
+func TestTraverseDAGOnStepFailure(t *testing.T) {
+	// a fails at once, b takes a while. f and g are AlwaysRun, f depends on
+	// the completion of a, g on its success.
+	// a---->d
+	//  \--->f (completion)
+	//   \-->g
+	// b---->c---->e
+	tests := []struct {
+		policy  string
+		wantRan []string
+	}{
+		{OnStepFailureAbortAll, []string{"a", "b", "f"}},
+		{OnStepFailureFinishStartedSteps, []string{"a", "b", "f"}},
+		{OnStepFailureContinueIndependentBranches, []string{"a", "b", "c", "e", "f"}},
+	}
+	for _, tt := range tests {
+		w := testWorkflow()
+		w.OnStepFailure = tt.policy
+		w.Steps = map[string]*Step{}
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			w.Steps[name] = &Step{name: name, w: w}
+		}
+		w.Steps["f"] = &Step{name: "f", w: w, AlwaysRun: true, DependsOnCompletionOf: []string{"a"}}
+		w.Steps["g"] = &Step{name: "g", w: w, AlwaysRun: true}
+		w.Dependencies = map[string][]string{"c": {"b"}, "d": {"a"}, "e": {"c"}, "g": {"a"}}
+
+		var mx sync.Mutex
+		var ran []string
+		err := w.traverseDAGOnFailure(w.onStepFailure(), func(s *Step) DError {
+			mx.Lock()
+			ran = append(ran, s.name)
+			mx.Unlock()
+			switch s.name {
+			case "a":
+				return Errf("failure")
+			case "b":
+				time.Sleep(10 * time.Millisecond)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "failure" {
+			t.Errorf("%s: unexpected error: %v", tt.policy, err)
+		}
+		sort.Strings(ran)
+		if diffRes := diff(ran, tt.wantRan, 0); diffRes != "" {
+			t.Errorf("%s: steps run not as expected: (-got +want)\n%s", tt.policy, diffRes)
+		}
+	}
+
+	// Included workflows inherit the policy, abort-all is the default.
+	w := testWorkflow()
+	iw := New()
+	w.includeWorkflow(iw)
+	if got := iw.onStepFailure(); got != OnStepFailureAbortAll {
+		t.Errorf("default OnStepFailure = %q, want %q", got, OnStepFailureAbortAll)
+	}
+	w.OnStepFailure = OnStepFailureContinueIndependentBranches
+	if got := iw.onStepFailure(); got != OnStepFailureContinueIndependentBranches {
+		t.Errorf("included workflow OnStepFailure = %q, want %q", got, OnStepFailureContinueIndependentBranches)
+	}
+}
+
 func TestForceCleanupSetOnRunError(t *testing.T) {
 	doTestForceCleanup(t, true, true, true)
 }
@@ -980,6 +1168,52 @@ func TestPrint(t *testing.T) {
 	}
 }
 
+func TestMarshal(t *testing.T) {
+	ctx := context.Background()
+	w := testWorkflow()
+	w.Vars = map[string]Var{
+		"disk":  {Value: "d"},
+		"token": {Value: "s3cr3t", Sensitive: true},
+	}
+	iw := New()
+	iw.Steps = map[string]*Step{"inner": {testType: &mockStep{}}}
+	w.Steps = map[string]*Step{
+		"create":  {CreateDisks: &CreateDisks{{Disk: compute.Disk{Name: "${disk}", Description: "${token}", SizeGb: 1}}}},
+		"include": {IncludeWorkflow: &IncludeWorkflow{Path: "inc.wf.json", Workflow: iw}},
+		"wait":    {WaitForInstancesSignal: &WaitForInstancesSignal{{Name: "i", SerialOutput: &SerialOutput{Port: 1<<53 + 1}}}},
+	}
+	fw := New()
+	fw.Steps = map[string]*Step{"finally-inner": {testType: &mockStep{}}}
+	w.Finally = &Finally{Steps: map[string]*Step{"sub": {SubWorkflow: &SubWorkflow{Path: "sub.wf.json", Workflow: fw}}}}
+	if err := w.populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := w.Marshal(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	wantName := fmt.Sprintf("%q: %q", "name", w.genName("d"))
+	for _, want := range []string{wantName, `"Path": "inc.wf.json"`, `"Path": "sub.wf.json"`, redactedValue, `"Port": 9007199254740993`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Marshal(false) does not contain %s:\n%s", want, got)
+		}
+	}
+	for _, notWant := range []string{"s3cr3t", `"inner"`, `"finally-inner"`, fmt.Sprintf("%q: {", finallyStep), "${disk}"} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("Marshal(false) contains %s:\n%s", notWant, got)
+		}
+	}
+
+	if b, err = w.Marshal(true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"inner"`) || !strings.Contains(string(b), `"finally-inner"`) {
+		t.Errorf("Marshal(true) does not inline the included workflows:\n%s", b)
+	}
+}
+
 func testValidateErrors(w *Workflow, want string) error {
 	wantRegex, err := regexp.Compile(want)
 	if err != nil {
@@ -1051,10 +1285,10 @@ func TestWrite(t *testing.T) {
 		t.Fatal(err)
 	}
 	l := GCSLogger{
-		client: gcsClient,
-		bucket: testBucket,
-		object: testObject,
-		ctx:    context.Background(),
+		storage: NewGCSStorage(gcsClient),
+		bucket:  testBucket,
+		object:  testObject,
+		ctx:     context.Background(),
 	}
 
 	tests := []struct {
@@ -1095,6 +1329,120 @@ func TestRunStepTimeout(t *testing.T) {
 	}
 }
 
+func TestRunStepTimeoutWarning(t *testing.T) {
+	w := testWorkflow()
+	w.TimeoutWarningPercent = 50
+	s, _ := w.NewStep("test")
+	s.timeout = 200 * time.Millisecond
+	s.testType = &mockStep{runImpl: func(ctx context.Context, s *Step) DError {
+		time.Sleep(150 * time.Millisecond)
+		return nil
+	}}
+	if err := w.runStep(context.Background(), s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "WARNING: step has been running for 50% of its timeout of 200ms"
+	var found bool
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		if e.StepName == "test" && e.Message == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("warning %q not logged", want)
+	}
+
+	// Included workflows inherit the setting.
+	iw := New()
+	w.includeWorkflow(iw)
+	if got := iw.timeoutWarningPercent(); got != 50 {
+		t.Errorf("included workflow TimeoutWarningPercent = %d, want 50", got)
+	}
+}
+
+func TestWarnTimeoutSerialTail(t *testing.T) {
+	w := testWorkflow()
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, port, _ int64) (*compute.SerialPortOutput, error) {
+		var lines []string
+		for i := 0; i < 20; i++ {
+			lines = append(lines, fmt.Sprintf("line %d", i))
+		}
+		return &compute.SerialPortOutput{Contents: strings.Join(lines, "\n") + "\n"}, nil
+	}
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+	s, _ := w.NewStep("wait")
+	s.timeout = time.Minute
+	s.WaitForInstancesSignal = &WaitForInstancesSignal{
+		{Name: "i1", SerialOutput: &SerialOutput{Port: 2, SuccessMatch: "done"}, SerialOutputs: []*SerialOutput{{Port: 2, FailureMatch: FailureMatches{"fail"}}}},
+		{Name: fmt.Sprintf("projects/%s/zones/%s/instances/other", testProject, testZone)},
+		{Name: "dne", SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done"}},
+	}
+	s.warnTimeout(80)
+
+	var got []string
+	for _, e := range w.Logger.(*MockLogger).getEntries() {
+		got = append(got, e.Message)
+	}
+	for _, want := range []string{
+		"WARNING: step has been running for 80% of its timeout of 1m0s",
+		"Instance \"i1\" serial port 2 output tail:\nline 10\nline 11\nline 12\nline 13\nline 14\nline 15\nline 16\nline 17\nline 18\nline 19",
+		fmt.Sprintf("Instance %q serial port 1 output tail:\nline 10\nline 11\nline 12\nline 13\nline 14\nline 15\nline 16\nline 17\nline 18\nline 19", fmt.Sprintf("projects/%s/zones/%s/instances/other", testProject, testZone)),
+		"WARNING: could not read serial port 1 output of instance \"dne\": unresolved instance \"dne\"",
+	} {
+		if !strIn(want, got) {
+			t.Errorf("log %q not found in %q", want, got)
+		}
+	}
+	var tails int
+	for _, m := range got {
+		if strings.HasPrefix(m, "Instance \"i1\" serial port 2 output tail") {
+			tails++
+		}
+	}
+	if tails != 1 {
+		t.Errorf("got %d tails of serial port 2 of instance \"i1\", want 1", tails)
+	}
+}
+
+func TestRunStepTimeoutWarningDoesNotBlock(t *testing.T) {
+	w := testWorkflow()
+	w.TimeoutWarningPercent = 10
+	w.instances.m = map[string]*Resource{
+		"i1": {link: fmt.Sprintf("projects/%s/zones/%s/instances/i1", testProject, testZone)},
+	}
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	var firstCalls int32
+	w.ComputeClient.(*daisyCompute.TestClient).GetSerialPortOutputFn = func(_, _, _ string, _, from int64) (*compute.SerialPortOutput, error) {
+		if from == 0 {
+			// The first read from the start is the waiter's, the others
+			// read the tail for the warning: hang them.
+			if atomic.AddInt32(&firstCalls, 1) > 1 {
+				select {
+				case <-release:
+				case <-time.After(time.Second):
+				}
+			}
+			return &compute.SerialPortOutput{Next: 1}, nil
+		}
+		if time.Since(start) > 50*time.Millisecond {
+			return &compute.SerialPortOutput{Contents: "done\n", Next: 2}, nil
+		}
+		return &compute.SerialPortOutput{Next: 1}, nil
+	}
+	s, _ := w.NewStep("wait")
+	s.timeout = 500 * time.Millisecond
+	s.WaitForInstancesSignal = &WaitForInstancesSignal{
+		{Name: "i1", interval: time.Millisecond, SerialOutput: &SerialOutput{Port: 1, SuccessMatch: "done"}},
+	}
+	if err := w.runStep(context.Background(), s); err != nil {
+		t.Errorf("step blocked by the timeout warning: %v", err)
+	}
+}
+
 func TestPopulateClients(t *testing.T) {
 	w := testWorkflow()
 